@@ -1,13 +1,27 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"math"
+	"net/http"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/quic-s/quics/pkg/app"
+	"github.com/quic-s/quics/pkg/client"
+	"github.com/quic-s/quics/pkg/config"
 	"github.com/quic-s/quics/pkg/types"
 	"github.com/quic-s/quics/pkg/utils"
 	"github.com/spf13/cobra"
@@ -20,32 +34,135 @@ import (
 *
 * `qis start`: Start quic-s server (run with default IP)
 * `qis start --ip <server-ip> --port <server-port>`: Start quic-s server (run with custom IP)
+* `qis start --max-streams-per-conn <number>`: Start quic-s server limiting concurrent streams of each connection
+* `qis start --data-dir <directory-path>`: Start quic-s server storing database and synced contents in custom directory
+* `qis start --history-limit <number>`: Start quic-s server returning at most number of histories unless limit is requested
+* `qis start --extension-policies <policies>`: Start quic-s server with server-wide sync policies by extension (e.g., `.tmp=ignore,.mp4=no-versioning`)
+* `qis start --converters <names>`: Start quic-s server transcoding downloads with converters (e.g., `csv-json,image`)
+* `qis start --timestamp-source <server|client>`: Start quic-s server stamping date of histories by server clock or by time reported by client
+* `qis start --cache-ttl <seconds>`: Start quic-s server caching responses of listing endpoints for seconds
+* `qis start --max-scans <number>`: Start quic-s server running at most number of full scans of database at once
+* `qis start --redact-fields <rules>`: Start quic-s server hiding fields of listings from callers without admin token (e.g., `Password,Owner=mask,clients:Ip=mask`)
+* `qis start --access-log [--access-log-bodies]`: Start quic-s server logging every rest request (with redacted bodies)
+* `qis start --enable-browse`: Start quic-s server serving read-only directory index of stored files (html, or json by Accept header)
+* `qis start --watch-dir <local-dir>:<path-prefix>`: Start quic-s server ingesting changes of local directory into files under path prefix
+* `qis start --health-checks <names|none>`: Start quic-s server verifying dependencies before accepting traffic (e.g., `database,data-dir,tls,recovery`)
+* `qis start --safe-mode`: Start quic-s server serving read-only access only, with background workers disabled and writes rejected (to inspect troubled store)
+* `qis start --repair-db`: Start quic-s server moving broken files of database which fails to open aside (e.g., after crash) and reporting data lost
+* `qis start --auto-stop-after <duration>`: Start quic-s server stopping itself after duration without client connections and api activity (e.g., `10m` for CI)
 * `qis stop`: Stop quic-s server
+* `qis stop --ensure-stopped`: Stop quic-s server and succeed even if it is already stopped
 * `qis listen`: Listen quic-s protocol
 * `qis run`: Run quic-s server (combine of start and listen)
 *
-* `qis password set --pw <password>`: Change password for quic-s server
-* `qis password reset`: Reset password for quic-s server
+* `qis password set --pw <password> --current <password>`: Change password for quic-s server
+* `qis password reset [--admin-token <token>]`: Reset password for quic-s server (admin token is read from server machine unless given)
 *
 * `qis show`: Show quic-s server information (needed options)
 * `qis show client --id <client-UUID>`: Show client information
 * `qis show client --all`: Show all clients information
+* `qis show client --root <directory-path>`: Show clients attached to root directory
+* `qis show client --owner <owner> --prefix <path-prefix>`: Show clients attached to root directory of owner or overlapping path prefix
 * `qis show dir --id <directory-path>`: Show directory information
 * `qis show dir --all`: Show all directories information
+* `qis show dir --json-paths [--files-only | --dirs-only]`: Show paths of root directories and files as flat JSON array
+* `qis show dir --owner <owner> --prefix <path-prefix> --uuid <client-UUID>`: Show root directories matched with every given filter
+* `qis show dir --conflicts [--id <directory-path>]`: Show unresolved conflicts grouped by directory with hashes, timestamps and clients of competing versions
 * `qis show file --id <file-path>`: Show file information
+* `qis show file --id <glob-pattern>`: Show information of files matched with glob pattern (e.g., `/root/logs/*.txt`)
 * `qis show file --all`: Show all files information
+* `qis show file --tag <key=value,...>`: Show information of files having every tag (with `--id <glob-pattern>` to narrow down paths)
+* `qis show file --metadata <json-object>`: Show information of files whose custom metadata has every field of JSON object (e.g., `{"project":"web"}`)
+* `qis show file --orphaned`: Show files whose root directory does not exist anymore
+* `qis show file --duplicates [--prefix <path-prefix> ...]`: Show sets of files whose contents are identical and bytes reclaimable by deduplicating them
+* `qis show file --id <file-path> --synced-to <token>`: Show file information after write of consistency token printed by `upload file` is visible
+* `qis show file --owner --prefix --uuid --since --until --min-size --max-size --tag`: Show information of files matched with every given filter
 * `qis show history --id <file-history-key>`: Show history information
+* `qis show history --id <glob-pattern>`: Show histories of files matched with glob pattern
 * `qis show history --all`: Show all history information
+* `qis show history --commit <commit-set-ID>`: Show histories of files committed together with commit set
+* `qis show history --owner --prefix --uuid --since --until --min-size --max-size`: Show histories matched with every given filter
+* `qis show history --range <window>`: Show histories dated in time window (e.g., `today`, `last-7d`, `2024-01-01..2024-02-01`)
+* `qis show bulk --follow`: Show progress of destructive bulk operation running on server, e.g., `remove dir --all` (and keep showing it until it is finished with --follow)
 *
 * `qis remove`: Initialize quic-s server (needed options)
 * `qis remove client --id <client-UUID>`: Initialize client
 * `qis remove client --all`: Initialize all clients
 * `qis remove dir --id <directory-path>`: Initialize directory
 * `qis remove dir --all`: Initialize all directories
-* `qis remove file --id <file-path>`: Initialize file
+* `qis remove file --id <file-path>`: Initialize file (exactly that file)
+* `qis remove file --id <directory-path> --recursive`: Initialize every file under directory
+* `qis remove file --id <path> --dry-run`: Show the number of files to be initialized without initializing them
+* `qis remove file --id <path> --purge`: Initialize file deleting its stored contents and histories as well
 * `qis remove file --all`: Initialize all files
+* `qis remove file --orphaned [--dry-run] [--purge]`: Initialize every file whose root directory does not exist anymore
 *
-* `qis download file --path --version --target`: Download certain file
+* `qis download file --path --version|--timestamp|--latest --target`: Download certain file by 1-based version, raw timestamp or latest version
+* `qis download file --path --version|--timestamp|--latest --target --as <content-type>`: Download certain file transcoded by server (e.g., `--as json` for csv)
+* `qis download file --path --version|--timestamp|--latest --target --synced-to <token>`: Download certain file after write of consistency token printed by `upload file` is visible
+* `qis download file --path <glob-pattern> --target <directory-path>`: Download latest version of every file matched with glob pattern (e.g., `/root/logs/*.txt`)
+* `qis download file --path --version|--timestamp|--latest --target --verify-chunks`: Download certain file verifying each chunk as it arrives, so that corrupted download fails at the first bad chunk
+* `qis download dir --path <directory-path> --target <directory-path>`: Download latest version of every file under directory preserving its subtree under target
+* `qis download dir --path <directory-path> --target <directory-path> --flatten | --strip-prefix <n>`: Download every file under directory into target directory alone (disambiguated on name collision), or dropping n leading path components
+* `qis upload file --path --from <local-file-path>`: Upload local file as new version of certain file
+* `qis upload file --path --from <local-file-path> --if-version <hash>`: Upload local file only if latest hash of certain file is still hash
+* `qis upload file --path --from <local-file-path> --metadata <json-object>`: Upload local file replacing custom metadata of certain file
+* `qis share file --path --version|--timestamp|--latest --expires <duration>`: Create signed url which downloads certain file without login until it expires (e.g., `--expires 1h`)
+* `qis share rotate-key`: Revoke every signed url by rotating signing key
+* `qis verify file --path --version|--timestamp|--latest --local <local-file-path>`: Verify local file against certain version of file by hash without downloading it (fails on mismatch)
+*
+* `qis client`: Manage client (needed sub command)
+* `qis client subscribe --uuid <client-UUID> --prefix <path-prefix>`: Subscribe client to changes under path prefix only
+* `qis client unsubscribe --uuid <client-UUID> --prefix <path-prefix>`: Remove subscription of client (all subscriptions without prefix)
+* `qis client schedule set --uuid <client-UUID> --window <windows>`: Limit bandwidth of transfers with client by time of day (e.g., `00:00-06:00:unlimited,else:1MB`)
+* `qis client provision --file <csv-or-json-file> [--dry-run]`: Create or update many clients with alias, ip and root directories at once
+*
+* `qis file`: Manage file (needed sub command)
+* `qis file move --from <file-path> --to <file-path> [--overwrite]`: Move (rename) file keeping its histories (`qis file rename` is the same)
+* `qis file lock --path <file-path> --uuid <client-UUID> --ttl <seconds>`: Lock file so that only the client can sync it until ttl expires
+* `qis file unlock --path <file-path> --uuid <client-UUID>`: Unlock file held by the client
+* `qis file tag --path <file-path> --set <key=value,...> --unset <key,...>`: Set and remove tags of file
+* `qis file tag --path-prefix <path-prefix> --set <key=value,...> --unset <key,...> --dry-run`: Set and remove tags of every file matched by filter
+* `qis file set --path <file-path> --no-history`: Keep only the latest history of file while still syncing it (`--no-history=false` to keep full history again)
+* `qis file metadata set --path <file-path> --json <json-object>`: Replace custom metadata of file (`--json ''` to clear it)
+* `qis file history graph --path <file-path> [--format <text|dot>]`: Show where file came from and where it went by moves (renames) as tree or Graphviz DOT
+*
+* `qis dir`: Manage directory (needed sub command)
+* `qis dir move --from <directory-path> --to <directory-path>`: Move root directory with its files and histories
+* `qis dir set --path <directory-path> --append-only`: Allow only new files in root directory (`--append-only=false` to disable)
+* `qis dir set --path <directory-path> --versioning <policies>`: Set versioning policies by extension or MIME type (e.g., `.mp4=latest,video/*=latest,.go=full`)
+* `qis dir set --path <directory-path> --policy <policies>`: Set sync policies overriding extension defaults of server (e.g., `.tmp=sync,.log=no-versioning+compress-on-transfer`)
+*
+* `qis conflict resolve --path <file-path> --keep <server|client-UUID>`: Resolve conflict of file keeping version of server or of client (shown by `show dir --conflicts`)
+*
+* `qis sync now --uuid <client-UUID>`: Make connected client run a full sync pass right away and show how many changes are exchanged
+*
+* `qis lock list [--path <path-prefix>]`: Show active file locks with holder, acquired and expiration time
+* `qis lock break --path <file-path> --reason <reason>`: Release lock of file held by any client (e.g., crashed one), logging reason and telling holder by LOCK_BROKEN event
+*
+* `qis policy explain --path <file-path>`: Show sync behaviors applied to file and where each of them came from
+*
+* `qis stats transfers --since <time> --until <time> --bucket <duration>`: Show transfer throughput, counts and sizes by time window (`--json` for graphing tools)
+*
+* `qis count clients|dirs|files|histories [--owner <owner> --prefix <path-prefix> ...]`: Show the number of entries matched with every given filter without listing them
+*
+* `qis diff dir --path <directory-path> --from-time <time> --to-time <time>`: Show files added, modified or removed between two points in time (`--content` to compare contents)
+*
+* `qis watch --path <file-or-directory-path>`: Watch change events of certain path (all paths without option)
+*
+* `qis server`: Manage quic-s server (needed sub command)
+* `qis server scrub`: Verify integrity of stored contents
+* `qis server reindex --index <all|hash>`: Rebuild derived index from primary records (e.g., after restore)
+* `qis server checkpoint`: Flush database to disk (e.g., before taking snapshot of server)
+* `qis server set-password --current <password> --new <password>`: Change password for quic-s server verifying password in use
+* `qis server db-stats`: Show sizes of LSM tree levels and value log of database with estimated garbage and last maintenance times
+* `qis server db-compact --value-log-gc`: Compact levels of LSM tree of database (and collect garbage of value log)
+* `qis server metrics`: Show stream usage of each client connection
+* `qis server metrics snapshot [--json]`: Show uptime, connections, transfers in flight, database size and recent errors at a glance
+* `qis server health [--json]`: Show state of server (starting, ready or degraded) and result of each health check
+* `qis server logs --follow --level <info|warn|error>`: Show recent server logs (and stream new logs with --follow)
+*
+* `qis selftest`: Upload, show, download, verify and remove a generated file and a zero-byte file to check the whole pipeline of running server
  */
 
 /**
@@ -57,10 +174,14 @@ import (
 * `--id`: ID option
 * `-i`: ID short option
 *
+* `--json-paths`: Show only paths as JSON array option
+* `--files-only`: Only paths of files option
+* `--dirs-only`: Only paths of root directories option
+*
 * `--path`: Path option
 * `-p`: Path short option
 *
-* `--version`: Version option
+* `--version`: Version(=1-based ordinal in history of file) option
 * `-v`: Version short option
 *
 * `--target`: Target(=destination directory) option
@@ -70,6 +191,80 @@ import (
 * `--port`: Port option
 *
 * `--password`: Password option
+* `--current`, `--new`: Password in use and new password option
+* `--admin-token`: Admin token of running server option
+*
+* `--data-dir`: Directory for database and synced contents (default: $HOME/.quics)
+* `--scrub-interval`: Scrub interval (seconds) option
+* `--max-streams-per-conn`: Maximum concurrent streams of each connection option
+* `--history-limit`: Number of histories returned when limit is not requested option (0: no limit)
+* `--extension-policies`: Server-wide sync policies by extension or MIME type option (e.g., `.tmp=ignore,.mp4=no-versioning`)
+* `--converters`: Comma separated converters used to transcode downloads option (csv-json, image)
+* `--timestamp-source`: Clock which stamps date of histories option (server or client)
+* `--cache-ttl`: Seconds which responses of listing endpoints are cached option (0: disabled)
+*
+* `--from`: Source directory path option
+* `--from-time`, `--to-time`: Point in time option (RFC3339, `2006-01-02 15:04:05` or `2006-01-02` in local time)
+* `--since`, `--until`: Period of transfer stats option (default: last 24 hours), or time range filter of show file and show history
+* `--range`: Time window filter of show history (`today`, `yesterday`, `last-<n><m|h|d|w>` or `<time>..<time>`) instead of `--since` and `--until`
+* `--bucket`: Window of transfer stats option (e.g., 1h)
+* `--json`: Show result as JSON option
+* `--content`: Compare contents of modified files option
+* `--to`: Destination directory path option
+*
+* `--uuid`: Client UUID option
+* `--ttl`: Lifetime (seconds) of file lock option
+* `--set`, `--unset`: Comma separated tags(=<key>=<value>) to set and tag keys to remove option
+* `--tag`: Comma separated tags(=<key>=<value>) files must have option
+* `--metadata`: Custom metadata of file as JSON object option (fields files must have for show file)
+* `--prefix`: Path prefix option
+* `--window`: Bandwidth windows option (`<HH:MM>-<HH:MM>:<rate>` and `else:<rate>`, rate is bytes per second such as `1MB` or `unlimited`)
+* `--file`: Provisioning file option (csv with header `uuid,alias,ip,root` where root is `;` separated, or json array)
+*
+* `--root`: Root directory path option
+* `--owner`: Owner of root directory filter option
+* `--min-size`, `--max-size`: Size range (bytes) filter option
+*
+* `--ensure-stopped`: Treat already stopped server as success
+*
+* `--recursive`: Remove every file under directory option
+* `--dry-run`: Show the number of files to be removed (or result of provisioning) without applying it
+* `--purge`: Delete stored contents and histories of removed files as well
+*
+* `--access-log`: Log every rest request of server option
+* `--access-log-bodies`: Log request/response bodies of rest requests as well (sensitive fields are redacted)
+* `--enable-browse`: Serve read-only directory index of stored files option
+* `--watch-dir`: Local directory ingested into files under path prefix option (`<local-dir>:<path-prefix>`)
+*
+* `--utc`: Show times in UTC (default: local time)
+* `--epoch`: Show times as unix epoch seconds
+* `--relative`: Show times relative to now (e.g., 3 minutes ago)
+*
+* `--limit`: Number of items per page (0: no limit)
+* `--offset`: Number of items to skip
+* `--all-pages`: Follow every page
+*
+* `--follow`: Stream new server logs
+* `--index`: Derived index to rebuild (all, hash)
+* `--level`: Minimum level of server logs (info, warn, error)
+*
+* `--follow-target-symlink`: Allow writing downloaded file through symbolic link target
+* `--local`: Local file verified against version of file option
+* `--as`: Content type (MIME type or extension) downloaded file is transcoded to option
+* `--if-version`: Expected latest hash of uploaded file option (`*`: file must exist)
+* `--timestamp`: Timestamp of version option (exclusive with `--version` and `--latest`)
+* `--latest`: Latest version option
+* `--commit`: Commit set ID option
+*
+* `--append-only`: Append-only(=existing files can not be modified or deleted) option
+* `--versioning`: Comma separated versioning policies(=<extension or MIME type>=<full|latest>) option
+* `--policy`: Comma separated sync policies(=<extension or MIME type>=<behavior>[+<behavior>]) option
+*   (behavior: ignore, store-content-only, no-versioning, compress-on-transfer, sync)
+*
+* `--insecure`, `-k`: Skip TLS verification of server (every command)
+* `--cacert`: CA certificate file to verify server (every command)
+* `--no-color`: Disable colored output (every command; also disabled when stdout is not a terminal, `NO_COLOR` is set or `TERM=dumb`)
+* `--timeout`: Cancel each request to server after duration, e.g., `30s` (every command; server stops scanning for canceled request)
  */
 
 const (
@@ -82,14 +277,63 @@ const (
 	ShowCommand     = "show"
 	RemoveCommand   = "remove"
 	DownloadCommand = "download"
+	UploadCommand   = "upload"
+	ServerCommand   = "server"
+	WatchCommand    = "watch"
+	DiffCommand     = "diff"
+	SelftestCommand = "selftest"
+	PolicyCommand   = "policy"
+	ShareCommand    = "share"
+	VerifyCommand   = "verify"
+	StatsCommand    = "stats"
+	ConflictCommand = "conflict"
+	CountCommand    = "count"
+	LockCommand     = "lock"
+	SyncCommand     = "sync"
+
+	SetCommand        = "set"
+	ResetCommand      = "reset"
+	ScrubCommand      = "scrub"
+	ReindexCommand    = "reindex"
+	CheckpointCommand = "checkpoint"
+	DBStatsCommand    = "db-stats"
+	DBCompactCommand  = "db-compact"
+	LogsCommand       = "logs"
+	MetricsCommand    = "metrics"
+	HealthCommand     = "health"
+	SnapshotCommand   = "snapshot"
+	MoveCommand       = "move"
+	RenameCommand     = "rename"
+	DirSetCommand     = "set"
+	FileSetCommand    = "set"
+	UnlockCommand     = "unlock"
+	ListCommand       = "list"
+	NowCommand        = "now"
+	BreakCommand      = "break"
+	TagCommand        = "tag"
+	MetadataCommand   = "metadata"
+	GraphCommand      = "graph"
+	ExplainCommand    = "explain"
+	ResolveCommand    = "resolve"
+	RotateKeyCommand  = "rotate-key"
 
-	SetCommand   = "set"
-	ResetCommand = "reset"
+	SubscribeCommand   = "subscribe"
+	UnsubscribeCommand = "unsubscribe"
+	ScheduleCommand    = "schedule"
+	ProvisionCommand   = "provision"
+	SetPasswordCommand = "set-password"
 
-	ClientCommand  = "client"
-	DirCommand     = "dir"
-	FileCommand    = "file"
-	HistoryCommand = "history"
+	ClientCommand    = "client"
+	DirCommand       = "dir"
+	FileCommand      = "file"
+	HistoryCommand   = "history"
+	TransfersCommand = "transfers"
+	BulkCommand      = "bulk"
+
+	ClientsCommand   = "clients"
+	DirsCommand      = "dirs"
+	FilesCommand     = "files"
+	HistoriesCommand = "histories"
 )
 
 const (
@@ -124,6 +368,243 @@ const (
 
 	// --pw (not exist short option)
 	PasswordOption = "pw"
+
+	// --max-streams-per-conn (not exist short option)
+	MaxStreamsPerConnOption = "max-streams-per-conn"
+
+	// --data-dir (not exist short option)
+	DataDirOption = "data-dir"
+
+	// --history-limit (not exist short option)
+	HistoryLimitOption = "history-limit"
+
+	// --access-log, --access-log-bodies (not exist short option)
+	AccessLogOption       = "access-log"
+	AccessLogBodiesOption = "access-log-bodies"
+
+	// --enable-browse (not exist short option)
+	EnableBrowseOption = "enable-browse"
+
+	// --safe-mode (not exist short option)
+	SafeModeOption = "safe-mode"
+
+	// --repair-db (not exist short option)
+	RepairDBOption = "repair-db"
+
+	// --scrub-interval (not exist short option)
+	ScrubIntervalOption = "scrub-interval"
+
+	// --from (not exist short option)
+	FromOption = "from"
+
+	// --to (not exist short option)
+	ToOption = "to"
+
+	// --from-time, --to-time (not exist short option)
+	FromTimeOption = "from-time"
+	ToTimeOption   = "to-time"
+
+	// --content (not exist short option)
+	ContentOption = "content"
+
+	// --since, --until, --range, --bucket (not exist short option)
+	SinceOption  = "since"
+	UntilOption  = "until"
+	RangeOption  = "range"
+	BucketOption = "bucket"
+
+	// --json (not exist short option)
+	JSONOption = "json"
+
+	// --value-log-gc (not exist short option)
+	ValueLogGCOption = "value-log-gc"
+
+	// --uuid (not exist short option)
+	UUIDOption = "uuid"
+
+	// --ttl (not exist short option)
+	TTLOption = "ttl"
+
+	// --set, --unset, --tag (not exist short option)
+	SetOption   = "set"
+	UnsetOption = "unset"
+	TagOption   = "tag"
+
+	// --prefix, --path-prefix (not exist short option)
+	PrefixOption     = "prefix"
+	PathPrefixOption = "path-prefix"
+
+	// --window (not exist short option)
+	WindowOption = "window"
+
+	// --file (not exist short option)
+	ProvisionFileOption = "file"
+
+	// --recursive (not exist short option)
+	RecursiveOption = "recursive"
+
+	// --dry-run (not exist short option)
+	DryRunOption = "dry-run"
+
+	// --purge (not exist short option)
+	PurgeOption = "purge"
+
+	// --overwrite (not exist short option)
+	OverwriteOption = "overwrite"
+
+	// --orphaned (not exist short option)
+	OrphanedOption = "orphaned"
+
+	// --duplicates (not exist short option)
+	DuplicatesOption = "duplicates"
+
+	// --conflicts (not exist short option)
+	ConflictsOption = "conflicts"
+
+	// --keep (not exist short option)
+	KeepOption = "keep"
+
+	// --reason (not exist short option)
+	ReasonOption = "reason"
+
+	// --root (not exist short option)
+	RootOption = "root"
+
+	// --ensure-stopped (not exist short option)
+	EnsureStoppedOption = "ensure-stopped"
+
+	// --utc, --epoch, --relative (not exist short option)
+	UTCOption      = "utc"
+	EpochOption    = "epoch"
+	RelativeOption = "relative"
+
+	// --limit, --offset, --all-pages (not exist short option)
+	LimitOption    = "limit"
+	OffsetOption   = "offset"
+	AllPagesOption = "all-pages"
+
+	// --follow, --level (not exist short option)
+	FollowOption = "follow"
+	LevelOption  = "level"
+
+	// --append-only (not exist short option)
+	AppendOnlyOption = "append-only"
+
+	// --versioning (not exist short option)
+	VersioningOption = "versioning"
+
+	// --no-history (not exist short option)
+	NoHistoryOption = "no-history"
+
+	// --metadata (not exist short option)
+	MetadataOption = "metadata"
+
+	// --policy (not exist short option)
+	PolicyOption = "policy"
+
+	// --extension-policies (not exist short option)
+	ExtensionPoliciesOption = "extension-policies"
+
+	// --converters (not exist short option)
+	ConvertersOption = "converters"
+
+	// --timestamp-source (not exist short option)
+	TimestampSourceOption = "timestamp-source"
+
+	// --cache-ttl (not exist short option)
+	CacheTTLOption = "cache-ttl"
+
+	// --max-scans (not exist short option)
+	MaxScansOption = "max-scans"
+
+	// --redact-fields (not exist short option)
+	RedactFieldsOption = "redact-fields"
+
+	// --watch-dir (not exist short option)
+	WatchDirOption = "watch-dir"
+
+	// --health-checks (not exist short option)
+	HealthChecksOption = "health-checks"
+
+	// --protocol-restarts (not exist short option)
+	ProtocolRestartsOption = "protocol-restarts"
+
+	// --auto-stop-after (not exist short option)
+	AutoStopAfterOption = "auto-stop-after"
+
+	// --format (not exist short option)
+	FormatOption = "format"
+
+	// --as (not exist short option)
+	AsOption = "as"
+
+	// --if-version (not exist short option)
+	IfVersionOption = "if-version"
+
+	// --synced-to (not exist short option)
+	SyncedToOption = "synced-to"
+
+	// --timestamp (not exist short option)
+	TimestampOption = "timestamp"
+
+	// --latest (not exist short option)
+	LatestOption = "latest"
+
+	// --expires (not exist short option)
+	ExpiresOption = "expires"
+
+	// --index (not exist short option)
+	IndexOption = "index"
+
+	// --follow-target-symlink (not exist short option)
+	FollowTargetSymlinkOption = "follow-target-symlink"
+
+	// --verify-chunks (not exist short option)
+	VerifyChunksOption = "verify-chunks"
+
+	// --flatten (not exist short option)
+	FlattenOption = "flatten"
+
+	// --strip-prefix (not exist short option)
+	StripPrefixOption = "strip-prefix"
+
+	// --insecure, -k
+	InsecureOption      = "insecure"
+	InsecureShortOption = "k"
+
+	// --cacert (not exist short option)
+	CACertOption = "cacert"
+
+	// --no-color (not exist short option)
+	NoColorOption = "no-color"
+
+	// --timeout (not exist short option)
+	TimeoutOption = "timeout"
+
+	// --json-paths (not exist short option)
+	JSONPathsOption = "json-paths"
+
+	// --files-only (not exist short option)
+	FilesOnlyOption = "files-only"
+
+	// --dirs-only (not exist short option)
+	DirsOnlyOption = "dirs-only"
+
+	// --commit (not exist short option)
+	CommitOption = "commit"
+
+	// --current, --new, --admin-token (not exist short option)
+	CurrentOption    = "current"
+	NewOption        = "new"
+	AdminTokenOption = "admin-token"
+
+	// --local (not exist short option)
+	LocalOption = "local"
+
+	// --owner, --min-size, --max-size (not exist short option)
+	OwnerOption   = "owner"
+	MinSizeOption = "min-size"
+	MaxSizeOption = "max-size"
 )
 
 var (
@@ -131,11 +612,135 @@ var (
 	id       string = ""
 	path     string = ""
 	version  uint64 = 0
+	expires  string = ""
+	index    string = ""
 	target   string = ""
 	addr     string = ""
 	port     string = ""
 	port3    string = ""
 	password string = ""
+
+	timestamp uint64 = 0
+	latest    bool   = false
+
+	scrubInterval string = ""
+	dataDir       string = ""
+
+	maxStreamsPerConn string = ""
+	historyLimit      string = ""
+
+	accessLog       bool = false
+	accessLogBodies bool = false
+	enableBrowse    bool = false
+	safeMode        bool = false
+	repairDB        bool = false
+
+	from string = ""
+	to   string = ""
+
+	fromTime string = ""
+	toTime   string = ""
+	content  bool   = false
+
+	since      string = ""
+	until      string = ""
+	timeRange  string = ""
+	bucket     string = ""
+	jsonOutput bool   = false
+
+	valueLogGC bool = false
+
+	recursive bool = false
+	dryRun    bool = false
+	purge     bool = false
+	overwrite bool = false
+	orphaned  bool = false
+
+	duplicates bool = false
+	conflicts  bool = false
+
+	keep   string = ""
+	reason string = ""
+
+	uuid          string = ""
+	prefix        string = ""
+	root          string = ""
+	ttl           uint64 = 300
+	provisionFile string = ""
+
+	tagSet    string = ""
+	tagUnset  string = ""
+	tagFilter string = ""
+
+	ensureStopped bool = false
+
+	utc      bool = false
+	epoch    bool = false
+	relative bool = false
+
+	pageLimit  uint64 = 100
+	pageOffset uint64 = 0
+	allPages   bool   = false
+
+	followTargetSymlink bool = false
+	verifyChunks        bool = false
+	flatten             bool = false
+	stripPrefix         int  = 0
+
+	appendOnly bool   = false
+	versioning string = ""
+	policy     string = ""
+
+	noHistory bool = false
+
+	metadataJSON   string = ""
+	metadataFilter string = ""
+
+	window string = ""
+
+	extensionPolicies string = ""
+	timestampSource   string = ""
+	cacheTTL          string = ""
+	maxScans          string = ""
+	redactFields      string = ""
+	watchDir          string = ""
+	healthChecks      string = ""
+	protocolRestarts  string = ""
+	autoStopAfter     string = ""
+	lineageFormat     string = ""
+
+	jsonPaths  bool   = false
+	filesOnly  bool   = false
+	dirsOnly   bool   = false
+	converters string = ""
+	downloadAs string = ""
+	ifVersion  string = ""
+	syncedTo   string = ""
+	commitID   string = ""
+	localPath  string = ""
+
+	currentPassword string = ""
+	adminToken      string = ""
+
+	owner   string = ""
+	minSize int64  = 0
+	maxSize int64  = 0
+
+	follow bool   = false
+	level  string = "info"
+
+	insecure bool   = false
+	caCert   string = ""
+	noColor  bool   = false
+	timeout  string = ""
+)
+
+// ansi escape codes of colored output (see colorize)
+const (
+	colorRed    = "\033[31m"
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+	colorReset  = "\033[0m"
 )
 
 var rootCmd = &cobra.Command{
@@ -144,24 +749,83 @@ var rootCmd = &cobra.Command{
 }
 
 var (
-	startServerCmd   *cobra.Command
-	stopServerCmd    *cobra.Command
-	listenCmd        *cobra.Command
-	runCmd           *cobra.Command
-	passwordCmd      *cobra.Command
-	passwordSetCmd   *cobra.Command
-	passwordResetCmd *cobra.Command
-	showCmd          *cobra.Command
-	showClientCmd    *cobra.Command
-	showDirCmd       *cobra.Command
-	showFileCmd      *cobra.Command
-	showHistoryCmd   *cobra.Command
-	removeCmd        *cobra.Command
-	removeClientCmd  *cobra.Command
-	removeDirCmd     *cobra.Command
-	removeFileCmd    *cobra.Command
-	downloadCmd      *cobra.Command
-	downloadFileCmd  *cobra.Command
+	startServerCmd      *cobra.Command
+	stopServerCmd       *cobra.Command
+	listenCmd           *cobra.Command
+	runCmd              *cobra.Command
+	passwordCmd         *cobra.Command
+	passwordSetCmd      *cobra.Command
+	passwordResetCmd    *cobra.Command
+	showCmd             *cobra.Command
+	showClientCmd       *cobra.Command
+	showDirCmd          *cobra.Command
+	showFileCmd         *cobra.Command
+	showHistoryCmd      *cobra.Command
+	showBulkCmd         *cobra.Command
+	removeCmd           *cobra.Command
+	removeClientCmd     *cobra.Command
+	removeDirCmd        *cobra.Command
+	removeFileCmd       *cobra.Command
+	downloadCmd         *cobra.Command
+	downloadFileCmd     *cobra.Command
+	downloadDirCmd      *cobra.Command
+	uploadCmd           *cobra.Command
+	uploadFileCmd       *cobra.Command
+	shareCmd            *cobra.Command
+	shareFileCmd        *cobra.Command
+	shareRotateKeyCmd   *cobra.Command
+	verifyCmd           *cobra.Command
+	verifyFileCmd       *cobra.Command
+	serverCmd           *cobra.Command
+	serverScrubCmd      *cobra.Command
+	serverReindexCmd    *cobra.Command
+	serverCheckpointCmd *cobra.Command
+	serverDBStatsCmd    *cobra.Command
+	serverDBCompactCmd  *cobra.Command
+	serverPasswordCmd   *cobra.Command
+	serverLogsCmd       *cobra.Command
+	serverMetricsCmd    *cobra.Command
+	serverSnapshotCmd   *cobra.Command
+	serverHealthCmd     *cobra.Command
+	dirCmd              *cobra.Command
+	dirMoveCmd          *cobra.Command
+	dirSetCmd           *cobra.Command
+	policyCmd           *cobra.Command
+	policyExplainCmd    *cobra.Command
+	conflictCmd         *cobra.Command
+	conflictResolveCmd  *cobra.Command
+	syncCmd             *cobra.Command
+	syncNowCmd          *cobra.Command
+	lockCmd             *cobra.Command
+	lockListCmd         *cobra.Command
+	lockBreakCmd        *cobra.Command
+	fileCmd             *cobra.Command
+	fileMoveCmd         *cobra.Command
+	fileLockCmd         *cobra.Command
+	fileUnlockCmd       *cobra.Command
+	fileTagCmd          *cobra.Command
+	fileSetCmd          *cobra.Command
+	fileMetadataCmd     *cobra.Command
+	fileMetadataSetCmd  *cobra.Command
+	fileHistoryCmd      *cobra.Command
+	fileHistoryGraphCmd *cobra.Command
+	clientCmd           *cobra.Command
+	clientSubCmd        *cobra.Command
+	clientUnsubCmd      *cobra.Command
+	clientScheduleCmd   *cobra.Command
+	clientSchedSetCmd   *cobra.Command
+	clientProvisionCmd  *cobra.Command
+	watchCmd            *cobra.Command
+	diffCmd             *cobra.Command
+	diffDirCmd          *cobra.Command
+	statsCmd            *cobra.Command
+	statsTransfersCmd   *cobra.Command
+	countCmd            *cobra.Command
+	countClientCmd      *cobra.Command
+	countDirCmd         *cobra.Command
+	countFileCmd        *cobra.Command
+	countHistoryCmd     *cobra.Command
+	selftestCmd         *cobra.Command
 )
 
 // Run initializes and executes commands using cobra library
@@ -179,36 +843,192 @@ func Run() int {
 	showDirCmd = initShowDirCmd()
 	showFileCmd = initShowFileCmd()
 	showHistoryCmd = initShowHistoryCmd()
+	showBulkCmd = initShowBulkCmd()
 	removeCmd = initRemoveCmd()
 	removeClientCmd = initRemoveClientCmd()
 	removeDirCmd = initRemoveDirCmd()
 	removeFileCmd = initRemoveFileCmd()
 	downloadCmd = initDownloadCmd()
 	downloadFileCmd = initDownloadFileCmd()
+	downloadDirCmd = initDownloadDirCmd()
+	uploadCmd = initUploadCmd()
+	uploadFileCmd = initUploadFileCmd()
+	shareCmd = initShareCmd()
+	shareFileCmd = initShareFileCmd()
+	shareRotateKeyCmd = initShareRotateKeyCmd()
+	verifyCmd = initVerifyCmd()
+	verifyFileCmd = initVerifyFileCmd()
+	serverCmd = initServerCmd()
+	serverScrubCmd = initServerScrubCmd()
+	serverReindexCmd = initServerReindexCmd()
+	serverLogsCmd = initServerLogsCmd()
+	serverMetricsCmd = initServerMetricsCmd()
+	serverSnapshotCmd = initServerMetricsSnapshotCmd()
+	serverHealthCmd = initServerHealthCmd()
+	serverCheckpointCmd = initServerCheckpointCmd()
+	serverDBStatsCmd = initServerDBStatsCmd()
+	serverDBCompactCmd = initServerDBCompactCmd()
+	serverPasswordCmd = initServerPasswordCmd()
+	dirCmd = initDirCmd()
+	dirMoveCmd = initDirMoveCmd()
+	dirSetCmd = initDirSetCmd()
+	policyCmd = initPolicyCmd()
+	policyExplainCmd = initPolicyExplainCmd()
+	conflictCmd = initConflictCmd()
+	conflictResolveCmd = initConflictResolveCmd()
+	syncCmd = initSyncCmd()
+	syncNowCmd = initSyncNowCmd()
+	lockCmd = initLockCmd()
+	lockListCmd = initLockListCmd()
+	lockBreakCmd = initLockBreakCmd()
+	fileCmd = initFileCmd()
+	fileMoveCmd = initFileMoveCmd()
+	fileLockCmd = initFileLockCmd()
+	fileUnlockCmd = initFileUnlockCmd()
+	fileTagCmd = initFileTagCmd()
+	fileSetCmd = initFileSetCmd()
+	fileMetadataCmd = initFileMetadataCmd()
+	fileMetadataSetCmd = initFileMetadataSetCmd()
+	fileHistoryCmd = initFileHistoryCmd()
+	fileHistoryGraphCmd = initFileHistoryGraphCmd()
+	clientCmd = initClientCmd()
+	clientSubCmd = initClientSubscribeCmd()
+	clientUnsubCmd = initClientUnsubscribeCmd()
+	clientScheduleCmd = initClientScheduleCmd()
+	clientSchedSetCmd = initClientScheduleSetCmd()
+	clientProvisionCmd = initClientProvisionCmd()
+	watchCmd = initWatchCmd()
+	diffCmd = initDiffCmd()
+	diffDirCmd = initDiffDirCmd()
+	statsCmd = initStatsCmd()
+	statsTransfersCmd = initStatsTransfersCmd()
+	countCmd = initCountCmd()
+	countClientCmd = initCountClientCmd()
+	countDirCmd = initCountDirCmd()
+	countFileCmd = initCountFileCmd()
+	countHistoryCmd = initCountHistoryCmd()
+	selftestCmd = initSelftestCmd()
 
 	// set flags (= options)
+	// qis <command> --insecure | --cacert <ca-certificate-file>
+	rootCmd.PersistentFlags().BoolVarP(&insecure, InsecureOption, InsecureShortOption, false, "Skip TLS verification of server (insecure)")
+	rootCmd.PersistentFlags().StringVarP(&caCert, CACertOption, "", "", "Verify server with CA certificate file (PEM)")
+	rootCmd.PersistentFlags().BoolVarP(&noColor, NoColorOption, "", false, "Disable colored output (disabled as well when stdout is not a terminal or NO_COLOR is set)")
+	rootCmd.PersistentFlags().StringVarP(&timeout, TimeoutOption, "", "", "Cancel each request to server after duration (e.g., 30s; no limit by default)")
+	rootCmd.MarkFlagsMutuallyExclusive(InsecureOption, CACertOption)
+	rootCmd.PersistentPreRunE = loadClientOptions
 	// qis start --addr <server-ip> --port <http-port> --port3 <http3-port>
 	startServerCmd.Flags().StringVarP(&addr, AddrOption, "", "", "Start server with custom address")
 	startServerCmd.Flags().StringVarP(&port, PortOption, "", "", "Start http rest server with custom port")
 	startServerCmd.Flags().StringVarP(&port3, Port3Option, "", "", "Start http3 rest server with custom port")
+	startServerCmd.Flags().StringVarP(&scrubInterval, ScrubIntervalOption, "", "", "Interval (seconds) of background integrity scrubbing (0: disabled)")
+	startServerCmd.Flags().StringVarP(&maxStreamsPerConn, MaxStreamsPerConnOption, "", "", "Maximum concurrent streams of each connection (default: 100)")
+	startServerCmd.Flags().StringVarP(&historyLimit, HistoryLimitOption, "", "", "Number of histories returned when limit is not requested (default: 100, 0: no limit)")
+	startServerCmd.Flags().StringVarP(&extensionPolicies, ExtensionPoliciesOption, "", "", "Server-wide sync policies by extension or MIME type (e.g., .tmp=ignore,.mp4=no-versioning)")
+	startServerCmd.Flags().StringVarP(&converters, ConvertersOption, "", "", "Converters used to transcode downloads (e.g., csv-json,image; default: disabled)")
+	startServerCmd.Flags().StringVarP(&timestampSource, TimestampSourceOption, "", "", "Clock which stamps date of histories (server or client; default: server)")
+	startServerCmd.Flags().StringVarP(&cacheTTL, CacheTTLOption, "", "", "Seconds which responses of listing endpoints are cached (default: 0, disabled)")
+	startServerCmd.Flags().StringVarP(&maxScans, MaxScansOption, "", "", "Full scans of database (e.g., show file --all) running at once (default: 4, 0: no limit)")
+	startServerCmd.Flags().StringVarP(&redactFields, RedactFieldsOption, "", "", "Fields hidden from listings for callers without admin token (e.g., Password,Owner=mask,clients:Ip=mask; default: Password, none: disabled)")
+	startServerCmd.Flags().StringVarP(&healthChecks, HealthChecksOption, "", "", "Checks which must pass before accepting traffic (default: database,data-dir,tls,recovery,protocol; none: disabled)")
+	startServerCmd.Flags().StringVarP(&protocolRestarts, ProtocolRestartsOption, "", "", "Times dead quics protocol listener is restarted in a row before server is left degraded (default: 5, 0: never)")
+	startServerCmd.Flags().StringVarP(&dataDir, DataDirOption, "", "", "Directory for database and synced contents (default: $HOME/.quics)")
+	startServerCmd.Flags().BoolVarP(&accessLog, AccessLogOption, "", false, "Log method, path, status and duration of every rest request")
+	startServerCmd.Flags().BoolVarP(&accessLogBodies, AccessLogBodiesOption, "", false, "Log request/response bodies as well with sensitive fields redacted (implies --access-log)")
+	startServerCmd.Flags().BoolVarP(&enableBrowse, EnableBrowseOption, "", false, "Serve read-only directory index of stored files at /api/v1/server/browse/")
+	startServerCmd.Flags().BoolVarP(&safeMode, SafeModeOption, "", false, "Disable background workers and reject writes to inspect and export troubled store (this run only)")
+	startServerCmd.Flags().BoolVarP(&repairDB, RepairDBOption, "", false, "Move broken files of database which fails to open aside and start with what is left (this run only; data may be lost)")
+	startServerCmd.MarkFlagsMutuallyExclusive(SafeModeOption, RepairDBOption)
+	startServerCmd.Flags().StringVarP(&watchDir, WatchDirOption, "", "", "Ingest changes of local directory into files under afterPath prefix without client (e.g., /srv/public:/public)")
+	startServerCmd.Flags().StringVarP(&autoStopAfter, AutoStopAfterOption, "", "", "Stop server after duration without client connections and api activity (e.g., 10m; this run only, default: disabled)")
 	// qis run --addr <server-ip> --port <http-port> --port3 <http3-port>
 	runCmd.Flags().StringVarP(&addr, AddrOption, "", "", "Start server with custom address")
 	runCmd.Flags().StringVarP(&port, PortOption, "", "", "Start http rest server with custom port")
 	runCmd.Flags().StringVarP(&port3, Port3Option, "", "", "Start http3 rest server with custom port")
+	runCmd.Flags().StringVarP(&scrubInterval, ScrubIntervalOption, "", "", "Interval (seconds) of background integrity scrubbing (0: disabled)")
+	runCmd.Flags().StringVarP(&maxStreamsPerConn, MaxStreamsPerConnOption, "", "", "Maximum concurrent streams of each connection (default: 100)")
+	runCmd.Flags().StringVarP(&historyLimit, HistoryLimitOption, "", "", "Number of histories returned when limit is not requested (default: 100, 0: no limit)")
+	runCmd.Flags().StringVarP(&extensionPolicies, ExtensionPoliciesOption, "", "", "Server-wide sync policies by extension or MIME type (e.g., .tmp=ignore,.mp4=no-versioning)")
+	runCmd.Flags().StringVarP(&converters, ConvertersOption, "", "", "Converters used to transcode downloads (e.g., csv-json,image; default: disabled)")
+	runCmd.Flags().StringVarP(&timestampSource, TimestampSourceOption, "", "", "Clock which stamps date of histories (server or client; default: server)")
+	runCmd.Flags().StringVarP(&cacheTTL, CacheTTLOption, "", "", "Seconds which responses of listing endpoints are cached (default: 0, disabled)")
+	runCmd.Flags().StringVarP(&maxScans, MaxScansOption, "", "", "Full scans of database (e.g., show file --all) running at once (default: 4, 0: no limit)")
+	runCmd.Flags().StringVarP(&redactFields, RedactFieldsOption, "", "", "Fields hidden from listings for callers without admin token (e.g., Password,Owner=mask,clients:Ip=mask; default: Password, none: disabled)")
+	runCmd.Flags().StringVarP(&healthChecks, HealthChecksOption, "", "", "Checks which must pass before accepting traffic (default: database,data-dir,tls,recovery,protocol; none: disabled)")
+	runCmd.Flags().StringVarP(&protocolRestarts, ProtocolRestartsOption, "", "", "Times dead quics protocol listener is restarted in a row before server is left degraded (default: 5, 0: never)")
+	runCmd.Flags().StringVarP(&dataDir, DataDirOption, "", "", "Directory for database and synced contents (default: $HOME/.quics)")
+	runCmd.Flags().BoolVarP(&accessLog, AccessLogOption, "", false, "Log method, path, status and duration of every rest request")
+	runCmd.Flags().BoolVarP(&accessLogBodies, AccessLogBodiesOption, "", false, "Log request/response bodies as well with sensitive fields redacted (implies --access-log)")
+	runCmd.Flags().BoolVarP(&enableBrowse, EnableBrowseOption, "", false, "Serve read-only directory index of stored files at /api/v1/server/browse/")
+	runCmd.Flags().BoolVarP(&safeMode, SafeModeOption, "", false, "Disable background workers and reject writes to inspect and export troubled store (this run only)")
+	runCmd.Flags().BoolVarP(&repairDB, RepairDBOption, "", false, "Move broken files of database which fails to open aside and start with what is left (this run only; data may be lost)")
+	runCmd.MarkFlagsMutuallyExclusive(SafeModeOption, RepairDBOption)
+	runCmd.Flags().StringVarP(&watchDir, WatchDirOption, "", "", "Ingest changes of local directory into files under afterPath prefix without client (e.g., /srv/public:/public)")
+	runCmd.Flags().StringVarP(&autoStopAfter, AutoStopAfterOption, "", "", "Stop server after duration without client connections and api activity (e.g., 10m; this run only, default: disabled)")
+	// qis stop --ensure-stopped
+	stopServerCmd.Flags().BoolVarP(&ensureStopped, EnsureStoppedOption, "", false, "Succeed even if server is already stopped")
 	// qis password set --pw <password>
 	passwordSetCmd.Flags().StringVarP(&password, PasswordOption, "", "", "Change password for quic-s server")
+	passwordSetCmd.Flags().StringVarP(&currentPassword, CurrentOption, "", "", "Current password of quic-s server")
+	passwordResetCmd.Flags().StringVarP(&adminToken, AdminTokenOption, "", "", "Admin token of running server (default: read from admin token file of server machine)")
+	// qis show <sub command> --utc | --epoch | --relative
+	showCmd.PersistentFlags().BoolVarP(&utc, UTCOption, "", false, "Show times in UTC")
+	showCmd.PersistentFlags().BoolVarP(&epoch, EpochOption, "", false, "Show times as unix epoch seconds")
+	showCmd.PersistentFlags().BoolVarP(&relative, RelativeOption, "", false, "Show times relative to now")
+	showCmd.MarkFlagsMutuallyExclusive(UTCOption, EpochOption, RelativeOption)
+	// qis show <sub command> --limit <number> --offset <number> | --all-pages
+	showCmd.PersistentFlags().Uint64VarP(&pageLimit, LimitOption, "", 100, "Number of items per page (0: no limit, default: 100, or HISTORY_LIMIT of server for histories)")
+	showCmd.PersistentFlags().Uint64VarP(&pageOffset, OffsetOption, "", 0, "Number of items to skip")
+	showCmd.PersistentFlags().BoolVarP(&allPages, AllPagesOption, "", false, "Follow every page")
 	// qis show client --id, qis show client --all
 	showClientCmd.Flags().BoolVarP(&all, AllOption, AllShortOption, false, "Show all status")
 	showClientCmd.Flags().StringVarP(&id, IDOption, IDShortCommand, "", "Show status by ID")
-	// qis show dir --id, qis show dir --all
+	showClientCmd.Flags().StringVarP(&root, RootOption, "", "", "Show clients attached to root directory")
+	showClientCmd.Flags().StringVarP(&owner, OwnerOption, "", "", "Show only clients attached to root directory of owner")
+	showClientCmd.Flags().StringVarP(&prefix, PrefixOption, "", "", "Show only clients attached to root directory overlapping path prefix")
+	// qis show dir --id, qis show dir --all, qis show dir --json-paths --files-only --dirs-only
 	showDirCmd.Flags().BoolVarP(&all, AllOption, AllShortOption, false, "Show all status")
 	showDirCmd.Flags().StringVarP(&id, IDOption, IDShortCommand, "", "Show status by ID")
-	// qis show file --id, qis show file --all
+	showDirCmd.Flags().BoolVarP(&jsonPaths, JSONPathsOption, "", false, "Show only paths of root directories and files as JSON array")
+	showDirCmd.Flags().BoolVarP(&filesOnly, FilesOnlyOption, "", false, "Show only paths of files (with --json-paths)")
+	showDirCmd.Flags().BoolVarP(&dirsOnly, DirsOnlyOption, "", false, "Show only paths of root directories (with --json-paths)")
+	showDirCmd.Flags().StringVarP(&owner, OwnerOption, "", "", "Show only root directories of owner")
+	showDirCmd.Flags().StringVarP(&prefix, PrefixOption, "", "", "Show only root directories overlapping path prefix")
+	showDirCmd.Flags().StringVarP(&uuid, UUIDOption, "", "", "Show only root directories attached to client")
+	// qis show dir --conflicts [--id <directory-path>]
+	showDirCmd.Flags().BoolVarP(&conflicts, ConflictsOption, "", false, "Show unresolved conflicts grouped by directory (of directory of --id)")
+	// qis show file --id, qis show file --all, qis show file --tag, qis show file --id --synced-to
 	showFileCmd.Flags().BoolVarP(&all, AllOption, AllShortOption, false, "Show all status")
 	showFileCmd.Flags().StringVarP(&id, IDOption, IDShortCommand, "", "Show status by ID")
-	// qis show history --id, qis show history --all
+	showFileCmd.Flags().StringVarP(&tagFilter, TagOption, "", "", "Show only files having every tag (e.g., env=prod,team=web)")
+	showFileCmd.Flags().StringVarP(&metadataFilter, MetadataOption, "", "", "Show only files whose custom metadata has every field of JSON object (e.g., {\"project\":\"web\"})")
+	showFileCmd.Flags().BoolVarP(&orphaned, OrphanedOption, "", false, "Show files whose root directory does not exist anymore")
+	showFileCmd.Flags().BoolVarP(&duplicates, DuplicatesOption, "", false, "Show sets of files whose contents are identical (narrowed by filters)")
+	showFileCmd.Flags().StringVarP(&syncedTo, SyncedToOption, "", "", "Show a file after write of consistency token printed by upload file is visible")
+	showFileCmd.Flags().StringVarP(&owner, OwnerOption, "", "", "Show only files in root directory of owner")
+	showFileCmd.Flags().StringVarP(&prefix, PrefixOption, "", "", "Show only files under path prefix")
+	showFileCmd.Flags().StringVarP(&uuid, UUIDOption, "", "", "Show only files whose latest version is edited by client")
+	showFileCmd.Flags().StringVarP(&since, SinceOption, "", "", "Show only files modified at or after time")
+	showFileCmd.Flags().StringVarP(&until, UntilOption, "", "", "Show only files modified before time")
+	showFileCmd.Flags().Int64VarP(&minSize, MinSizeOption, "", 0, "Show only files of at least bytes")
+	showFileCmd.Flags().Int64VarP(&maxSize, MaxSizeOption, "", 0, "Show only files of at most bytes")
+	// qis show history --id, qis show history --all, qis show history --commit
 	showHistoryCmd.Flags().BoolVarP(&all, AllOption, AllShortOption, false, "Show all status")
 	showHistoryCmd.Flags().StringVarP(&id, IDOption, IDShortCommand, "", "Show status by ID")
+	showHistoryCmd.Flags().StringVarP(&commitID, CommitOption, "", "", "Show histories committed with commit set of ID")
+	showHistoryCmd.Flags().StringVarP(&owner, OwnerOption, "", "", "Show only histories in root directory of owner")
+	showHistoryCmd.Flags().StringVarP(&prefix, PrefixOption, "", "", "Show only histories under path prefix")
+	showHistoryCmd.Flags().StringVarP(&uuid, UUIDOption, "", "", "Show only versions synced by client")
+	showHistoryCmd.Flags().StringVarP(&since, SinceOption, "", "", "Show only versions dated at or after time")
+	showHistoryCmd.Flags().StringVarP(&until, UntilOption, "", "", "Show only versions dated before time")
+	showHistoryCmd.Flags().StringVarP(&timeRange, RangeOption, "", "", "Show only versions dated in time window (today, yesterday, last-7d or <time>..<time>)")
+	showHistoryCmd.Flags().Int64VarP(&minSize, MinSizeOption, "", 0, "Show only versions of at least bytes")
+	showHistoryCmd.Flags().Int64VarP(&maxSize, MaxSizeOption, "", 0, "Show only versions of at most bytes")
+	showHistoryCmd.MarkFlagsMutuallyExclusive(AllOption, IDOption, CommitOption)
+	showHistoryCmd.MarkFlagsMutuallyExclusive(RangeOption, SinceOption)
+	showHistoryCmd.MarkFlagsMutuallyExclusive(RangeOption, UntilOption)
+	// qis show bulk --follow
+	showBulkCmd.Flags().BoolVarP(&follow, FollowOption, "", false, "Keep showing progress until bulk operation is finished")
 	// qis remove client --id, qis remove client --all
 	removeClientCmd.Flags().BoolVarP(&all, AllOption, AllShortOption, false, "Initialize all data")
 	removeClientCmd.Flags().StringVarP(&id, IDOption, IDShortCommand, "", "Initialize by ID")
@@ -218,10 +1038,177 @@ func Run() int {
 	// qis remove file --id, qis remove file --all
 	removeFileCmd.Flags().BoolVarP(&all, AllOption, AllShortOption, false, "Initialize all data")
 	removeFileCmd.Flags().StringVarP(&id, IDOption, IDShortCommand, "", "Initialize by ID")
-	// qis download file --path --version
-	downloadFileCmd.Flags().StringVarP(&path, PathOption, PathShortCommand, "", "Download a file by path")
-	downloadFileCmd.Flags().Uint64VarP(&version, VersionOption, VersionShortCommand, 0, "Download a file by version")
+	// qis remove file --id --recursive --dry-run --purge
+	removeFileCmd.Flags().BoolVarP(&recursive, RecursiveOption, "", false, "Remove every file under the directory of ID")
+	removeFileCmd.Flags().BoolVarP(&dryRun, DryRunOption, "", false, "Show the number of files to be removed without removing them")
+	removeFileCmd.Flags().BoolVarP(&purge, PurgeOption, "", false, "Delete stored contents and histories of removed files as well")
+	removeFileCmd.Flags().BoolVarP(&orphaned, OrphanedOption, "", false, "Remove every file whose root directory does not exist anymore")
+	// qis download file --path --version|--timestamp|--latest --synced-to
+	downloadFileCmd.Flags().StringVarP(&path, PathOption, PathShortCommand, "", "Download a file by path (or latest version of files by glob pattern, e.g., /root/logs/*.txt)")
+	downloadFileCmd.Flags().Uint64VarP(&version, VersionOption, VersionShortCommand, 0, "Download a file by version (1-based ordinal in its history, e.g., 1 is the oldest version)")
+	downloadFileCmd.Flags().Uint64VarP(&timestamp, TimestampOption, "", 0, "Download a file by timestamp of version (as listed by show history)")
+	downloadFileCmd.Flags().BoolVarP(&latest, LatestOption, "", false, "Download the latest version of a file")
 	downloadFileCmd.Flags().StringVarP(&target, TargetOption, TargetShortCommand, "", "Download location")
+	downloadFileCmd.Flags().BoolVarP(&followTargetSymlink, FollowTargetSymlinkOption, "", false, "Write through download location even if it is a symbolic link")
+	downloadFileCmd.Flags().StringVarP(&downloadAs, AsOption, "", "", "Download a file transcoded to content type (MIME type or extension, e.g., json)")
+	downloadFileCmd.Flags().StringVarP(&syncedTo, SyncedToOption, "", "", "Download a file after write of consistency token printed by upload file is visible")
+	downloadFileCmd.Flags().BoolVarP(&verifyChunks, VerifyChunksOption, "", false, "Verify each chunk against its hash as it arrives and abort at the first bad chunk")
+	downloadFileCmd.MarkFlagsMutuallyExclusive(AsOption, VerifyChunksOption)
+	// qis download dir --path --target --flatten | --strip-prefix
+	downloadDirCmd.Flags().StringVarP(&path, PathOption, PathShortCommand, "", "Download every file under directory path")
+	downloadDirCmd.Flags().StringVarP(&target, TargetOption, TargetShortCommand, "", "Download location (directory)")
+	downloadDirCmd.Flags().BoolVarP(&flatten, FlattenOption, "", false, "Download every file into download location alone (name collision is disambiguated, e.g., a_1.txt)")
+	downloadDirCmd.Flags().IntVarP(&stripPrefix, StripPrefixOption, "", 0, "Drop leading path components of each file (e.g., 1 downloads /root/sub/a.txt as sub/a.txt)")
+	downloadDirCmd.Flags().BoolVarP(&followTargetSymlink, FollowTargetSymlinkOption, "", false, "Write through download location even if it is a symbolic link")
+	downloadDirCmd.Flags().BoolVarP(&verifyChunks, VerifyChunksOption, "", false, "Verify each chunk against its hash as it arrives and abort the file at the first bad chunk")
+	downloadDirCmd.MarkFlagsMutuallyExclusive(FlattenOption, StripPrefixOption)
+	// qis upload file --path --from --if-version --metadata
+	uploadFileCmd.Flags().StringVarP(&path, PathOption, PathShortCommand, "", "Upload a file to path (/{root directory}/{file path})")
+	uploadFileCmd.Flags().StringVarP(&from, FromOption, "", "", "Local file to upload")
+	uploadFileCmd.Flags().StringVarP(&ifVersion, IfVersionOption, "", "", "Upload only if latest hash of the file is still this hash (*: the file must exist)")
+	uploadFileCmd.Flags().StringVarP(&metadataJSON, MetadataOption, "", "", "Custom metadata of the file as JSON object (replaces current one)")
+	// qis share file --path --version|--timestamp|--latest --expires
+	shareFileCmd.Flags().StringVarP(&path, PathOption, PathShortCommand, "", "Share a file by path")
+	shareFileCmd.Flags().Uint64VarP(&version, VersionOption, VersionShortCommand, 0, "Share a file by version (1-based ordinal in its history)")
+	shareFileCmd.Flags().Uint64VarP(&timestamp, TimestampOption, "", 0, "Share a file by timestamp of version")
+	shareFileCmd.Flags().BoolVarP(&latest, LatestOption, "", false, "Share the latest version of a file")
+	shareFileCmd.Flags().StringVarP(&expires, ExpiresOption, "", "1h", "Duration which the signed url can be used (e.g., 30m, 24h; at most 168h)")
+
+	verifyFileCmd.Flags().StringVarP(&path, PathOption, PathShortCommand, "", "Verify against a file by path")
+	verifyFileCmd.Flags().Uint64VarP(&version, VersionOption, VersionShortCommand, 0, "Verify against a file by version (1-based ordinal in its history)")
+	verifyFileCmd.Flags().Uint64VarP(&timestamp, TimestampOption, "", 0, "Verify against a file by timestamp of version")
+	verifyFileCmd.Flags().BoolVarP(&latest, LatestOption, "", false, "Verify against the latest version of a file")
+	verifyFileCmd.Flags().StringVarP(&localPath, LocalOption, "", "", "Local file to verify (e.g., downloaded by download file)")
+	// qis server reindex --index <all|hash>
+	serverReindexCmd.Flags().StringVarP(&index, IndexOption, "", "all", "Derived index to rebuild (all, hash)")
+	// qis server db-stats --json
+	serverDBStatsCmd.Flags().BoolVarP(&jsonOutput, JSONOption, "", false, "Show result as JSON")
+	// qis server metrics snapshot --json
+	serverSnapshotCmd.Flags().BoolVarP(&jsonOutput, JSONOption, "", false, "Show result as JSON")
+
+	// qis server health --json
+	serverHealthCmd.Flags().BoolVarP(&jsonOutput, JSONOption, "", false, "Show result as JSON")
+	// qis server db-compact --value-log-gc
+	serverDBCompactCmd.Flags().BoolVarP(&valueLogGC, ValueLogGCOption, "", false, "Collect garbage of value log after compaction")
+	serverPasswordCmd.Flags().StringVarP(&currentPassword, CurrentOption, "", "", "Current password of quic-s server")
+	serverPasswordCmd.Flags().StringVarP(&password, NewOption, "", "", "New password of quic-s server")
+	// qis server logs --follow --level <info|warn|error>
+	serverLogsCmd.Flags().BoolVarP(&follow, FollowOption, "", false, "Stream new server logs")
+	serverLogsCmd.Flags().StringVarP(&level, LevelOption, "", "info", "Minimum level of server logs (info, warn, error)")
+	// qis watch --path <file-or-directory-path>
+	watchCmd.Flags().StringVarP(&path, PathOption, PathShortCommand, "", "Watch a file or directory by path")
+	watchCmd.Flags().BoolVarP(&utc, UTCOption, "", false, "Show times in UTC")
+	watchCmd.Flags().BoolVarP(&epoch, EpochOption, "", false, "Show times as unix epoch seconds")
+	watchCmd.Flags().BoolVarP(&relative, RelativeOption, "", false, "Show times relative to now")
+	watchCmd.MarkFlagsMutuallyExclusive(UTCOption, EpochOption, RelativeOption)
+	// qis diff dir --path <directory-path> --from-time <time> --to-time <time> --content
+	diffDirCmd.Flags().StringVarP(&path, PathOption, PathShortCommand, "", "Directory path to compare (all directories without option)")
+	diffDirCmd.Flags().StringVarP(&fromTime, FromTimeOption, "", "", "Point in time to compare from")
+	diffDirCmd.Flags().StringVarP(&toTime, ToTimeOption, "", "", "Point in time to compare to (default: now)")
+	diffDirCmd.Flags().BoolVarP(&content, ContentOption, "", false, "Compare contents of modified files (ignore metadata-only changes)")
+	// qis stats transfers --since <time> --until <time> --bucket <duration> --json
+	statsTransfersCmd.Flags().StringVarP(&since, SinceOption, "", "", "Start of period (default: 24 hours before until)")
+	statsTransfersCmd.Flags().StringVarP(&until, UntilOption, "", "", "End of period (default: now)")
+	statsTransfersCmd.Flags().StringVarP(&bucket, BucketOption, "", "1h", "Window which transfers are bucketed into (e.g., 10m, 1h, 24h)")
+	statsTransfersCmd.Flags().BoolVarP(&jsonOutput, JSONOption, "", false, "Show result as JSON")
+	// qis count clients --owner <owner> --prefix <path-prefix> --uuid <client-UUID>
+	countClientCmd.Flags().StringVarP(&owner, OwnerOption, "", "", "Count only clients attached to root directory of owner")
+	countClientCmd.Flags().StringVarP(&prefix, PrefixOption, "", "", "Count only clients attached to root directory overlapping path prefix")
+	countClientCmd.Flags().StringVarP(&uuid, UUIDOption, "", "", "Count only client of UUID")
+	// qis count dirs --owner <owner> --prefix <path-prefix> --uuid <client-UUID>
+	countDirCmd.Flags().StringVarP(&owner, OwnerOption, "", "", "Count only root directories of owner")
+	countDirCmd.Flags().StringVarP(&prefix, PrefixOption, "", "", "Count only root directories overlapping path prefix")
+	countDirCmd.Flags().StringVarP(&uuid, UUIDOption, "", "", "Count only root directories attached to client")
+	// qis count files --owner --prefix --uuid --since --until --min-size --max-size --tag --metadata
+	countFileCmd.Flags().StringVarP(&owner, OwnerOption, "", "", "Count only files in root directory of owner")
+	countFileCmd.Flags().StringVarP(&prefix, PrefixOption, "", "", "Count only files under path prefix")
+	countFileCmd.Flags().StringVarP(&uuid, UUIDOption, "", "", "Count only files whose latest version is edited by client")
+	countFileCmd.Flags().StringVarP(&since, SinceOption, "", "", "Count only files modified at or after time")
+	countFileCmd.Flags().StringVarP(&until, UntilOption, "", "", "Count only files modified before time")
+	countFileCmd.Flags().Int64VarP(&minSize, MinSizeOption, "", 0, "Count only files of at least bytes")
+	countFileCmd.Flags().Int64VarP(&maxSize, MaxSizeOption, "", 0, "Count only files of at most bytes")
+	countFileCmd.Flags().StringVarP(&tagFilter, TagOption, "", "", "Count only files having every tag (e.g., env=prod,team=web)")
+	countFileCmd.Flags().StringVarP(&metadataFilter, MetadataOption, "", "", "Count only files whose custom metadata has every field of JSON object (e.g., {\"project\":\"web\"})")
+	// qis count histories --owner --prefix --uuid --since --until --range --min-size --max-size
+	countHistoryCmd.Flags().StringVarP(&owner, OwnerOption, "", "", "Count only histories in root directory of owner")
+	countHistoryCmd.Flags().StringVarP(&prefix, PrefixOption, "", "", "Count only histories under path prefix")
+	countHistoryCmd.Flags().StringVarP(&uuid, UUIDOption, "", "", "Count only versions synced by client")
+	countHistoryCmd.Flags().StringVarP(&since, SinceOption, "", "", "Count only versions dated at or after time")
+	countHistoryCmd.Flags().StringVarP(&until, UntilOption, "", "", "Count only versions dated before time")
+	countHistoryCmd.Flags().StringVarP(&timeRange, RangeOption, "", "", "Count only versions dated in time window (today, yesterday, last-7d or <time>..<time>)")
+	countHistoryCmd.Flags().Int64VarP(&minSize, MinSizeOption, "", 0, "Count only versions of at least bytes")
+	countHistoryCmd.Flags().Int64VarP(&maxSize, MaxSizeOption, "", 0, "Count only versions of at most bytes")
+	countHistoryCmd.MarkFlagsMutuallyExclusive(RangeOption, SinceOption)
+	countHistoryCmd.MarkFlagsMutuallyExclusive(RangeOption, UntilOption)
+	// qis dir move --from <directory-path> --to <directory-path>
+	dirMoveCmd.Flags().StringVarP(&from, FromOption, "", "", "Directory path to move from")
+	dirMoveCmd.Flags().StringVarP(&to, ToOption, "", "", "Directory path to move to")
+	// qis dir set --path <directory-path> --append-only --versioning <policies> --policy <policies>
+	dirSetCmd.Flags().StringVarP(&path, PathOption, PathShortCommand, "", "Root directory path to set")
+	dirSetCmd.Flags().BoolVarP(&appendOnly, AppendOnlyOption, "", false, "Allow only new files (existing files can not be modified or deleted)")
+	dirSetCmd.Flags().StringVarP(&versioning, VersioningOption, "", "", "Versioning policies (e.g., .mp4=latest,video/*=latest,.go=full; empty: keep full history)")
+	dirSetCmd.Flags().StringVarP(&policy, PolicyOption, "", "", "Sync policies overriding extension defaults (e.g., .tmp=sync,.log=no-versioning+compress-on-transfer; empty: follow extension defaults)")
+
+	// qis policy explain --path <file-path>
+	policyExplainCmd.Flags().StringVarP(&path, PathOption, PathShortCommand, "", "File path to explain")
+	// qis file move --from <file-path> --to <file-path> --overwrite
+	fileMoveCmd.Flags().StringVarP(&from, FromOption, "", "", "File path to move from")
+	fileMoveCmd.Flags().StringVarP(&to, ToOption, "", "", "File path to move to")
+	fileMoveCmd.Flags().BoolVarP(&overwrite, OverwriteOption, "", false, "Replace existing file of destination (its histories are deleted)")
+	// qis file lock --path <file-path> --uuid <client-UUID> --ttl <seconds>
+	fileLockCmd.Flags().StringVarP(&path, PathOption, PathShortCommand, "", "File path to lock")
+	fileLockCmd.Flags().StringVarP(&uuid, UUIDOption, "", "", "Client UUID holding the lock")
+	fileLockCmd.Flags().Uint64VarP(&ttl, TTLOption, "", 300, "Lifetime (seconds) of the lock")
+	// qis file unlock --path <file-path> --uuid <client-UUID>
+	fileUnlockCmd.Flags().StringVarP(&path, PathOption, PathShortCommand, "", "File path to unlock")
+	fileUnlockCmd.Flags().StringVarP(&uuid, UUIDOption, "", "", "Client UUID holding the lock")
+	// qis file tag --path <file-path> --set <key=value,...> --unset <key,...>
+	fileTagCmd.Flags().StringVarP(&path, PathOption, PathShortCommand, "", "File path to tag")
+	fileTagCmd.Flags().StringVarP(&tagSet, SetOption, "", "", "Tags to set (e.g., env=prod,team=web)")
+	fileTagCmd.Flags().StringVarP(&tagUnset, UnsetOption, "", "", "Tag keys to remove (e.g., draft,owner)")
+	// qis file tag --path-prefix <path-prefix> --set <key=value,...> --dry-run (also with filters of show file)
+	fileTagCmd.Flags().StringVarP(&prefix, PathPrefixOption, "", "", "Tag every file under path prefix instead of a single file")
+	fileTagCmd.Flags().StringVarP(&owner, OwnerOption, "", "", "Tag only files in root directory of owner")
+	fileTagCmd.Flags().StringVarP(&uuid, UUIDOption, "", "", "Tag only files whose latest version is edited by client")
+	fileTagCmd.Flags().StringVarP(&tagFilter, TagOption, "", "", "Tag only files having every tag (e.g., env=prod,team=web)")
+	fileTagCmd.Flags().StringVarP(&metadataFilter, MetadataOption, "", "", "Tag only files whose custom metadata has every field of JSON object (e.g., {\"project\":\"web\"})")
+	fileTagCmd.Flags().StringVarP(&since, SinceOption, "", "", "Tag only files modified at or after time")
+	fileTagCmd.Flags().StringVarP(&until, UntilOption, "", "", "Tag only files modified before time")
+	fileTagCmd.Flags().Int64VarP(&minSize, MinSizeOption, "", 0, "Tag only files of at least bytes")
+	fileTagCmd.Flags().Int64VarP(&maxSize, MaxSizeOption, "", 0, "Tag only files of at most bytes")
+	fileTagCmd.Flags().BoolVarP(&dryRun, DryRunOption, "", false, "Show the number of files to be tagged without tagging them")
+	// qis file set --path <file-path> --no-history
+	fileSetCmd.Flags().StringVarP(&path, PathOption, PathShortCommand, "", "File path to set")
+	fileSetCmd.Flags().BoolVarP(&noHistory, NoHistoryOption, "", false, "Keep only the latest history of file while still syncing it (--no-history=false to keep full history again)")
+	// qis file metadata set --path <file-path> --json <json-object>
+	fileMetadataSetCmd.Flags().StringVarP(&path, PathOption, PathShortCommand, "", "File path to set metadata")
+	fileMetadataSetCmd.Flags().StringVarP(&metadataJSON, JSONOption, "", "", "Custom metadata as JSON object (e.g., {\"project\":\"web\",\"reviewed\":true}; empty: clear metadata)")
+
+	// qis file history graph --path <file-path> --format <text|dot>
+	fileHistoryGraphCmd.Flags().StringVarP(&path, PathOption, PathShortCommand, "", "File path to show lineage")
+	fileHistoryGraphCmd.Flags().StringVarP(&lineageFormat, FormatOption, "", "text", "Output format (text: tree, dot: Graphviz)")
+	// qis conflict resolve --path <file-path> --keep <server|client-UUID>
+	conflictResolveCmd.Flags().StringVarP(&path, PathOption, PathShortCommand, "", "Conflicted file path to resolve")
+	conflictResolveCmd.Flags().StringVarP(&keep, KeepOption, "", "", "Version to keep (server or UUID of client, as Side of show dir --conflicts)")
+	// qis sync now --uuid <client-UUID>
+	syncNowCmd.Flags().StringVarP(&uuid, UUIDOption, "", "", "Client UUID to sync")
+	// qis lock list --path <path-prefix>
+	lockListCmd.Flags().StringVarP(&path, PathOption, PathShortCommand, "", "Show only locks of files under path")
+	// qis lock break --path <file-path> --reason <reason>
+	lockBreakCmd.Flags().StringVarP(&path, PathOption, PathShortCommand, "", "Locked file path")
+	lockBreakCmd.Flags().StringVarP(&reason, ReasonOption, "", "", "Why lock is broken (logged by server and sent to holder)")
+	// qis client subscribe --uuid <client-UUID> --prefix <path-prefix>
+	clientSubCmd.Flags().StringVarP(&uuid, UUIDOption, "", "", "Client UUID")
+	clientSubCmd.Flags().StringVarP(&prefix, PrefixOption, "", "", "Path prefix to subscribe (e.g., /rootDir/sub)")
+	// qis client unsubscribe --uuid <client-UUID> --prefix <path-prefix>
+	clientUnsubCmd.Flags().StringVarP(&uuid, UUIDOption, "", "", "Client UUID")
+	clientUnsubCmd.Flags().StringVarP(&prefix, PrefixOption, "", "", "Path prefix to unsubscribe (all subscriptions when empty)")
+	// qis client schedule set --uuid <client-UUID> --window <windows>
+	clientSchedSetCmd.Flags().StringVarP(&uuid, UUIDOption, "", "", "Client UUID")
+	clientSchedSetCmd.Flags().StringVarP(&window, WindowOption, "", "", "Bandwidth windows by time of day of server (e.g., 00:00-06:00:unlimited,else:1MB; empty: never limited)")
+	// qis client provision --file <csv-or-json-file> [--dry-run]
+	clientProvisionCmd.Flags().StringVarP(&provisionFile, ProvisionFileOption, "", "", "CSV (uuid,alias,ip,root) or JSON file of clients to provision")
+	clientProvisionCmd.Flags().BoolVarP(&dryRun, DryRunOption, "", false, "Validate the file and show results without applying them")
 
 	// add command to root command
 	rootCmd.AddCommand(startServerCmd)
@@ -232,6 +1219,22 @@ func Run() int {
 	rootCmd.AddCommand(showCmd)
 	rootCmd.AddCommand(removeCmd)
 	rootCmd.AddCommand(downloadCmd)
+	rootCmd.AddCommand(uploadCmd)
+	rootCmd.AddCommand(shareCmd)
+	rootCmd.AddCommand(verifyCmd)
+	rootCmd.AddCommand(serverCmd)
+	rootCmd.AddCommand(dirCmd)
+	rootCmd.AddCommand(fileCmd)
+	rootCmd.AddCommand(clientCmd)
+	rootCmd.AddCommand(watchCmd)
+	rootCmd.AddCommand(diffCmd)
+	rootCmd.AddCommand(statsCmd)
+	rootCmd.AddCommand(countCmd)
+	rootCmd.AddCommand(policyCmd)
+	rootCmd.AddCommand(conflictCmd)
+	rootCmd.AddCommand(syncCmd)
+	rootCmd.AddCommand(lockCmd)
+	rootCmd.AddCommand(selftestCmd)
 
 	// add command to password command
 	passwordCmd.AddCommand(passwordSetCmd)
@@ -242,6 +1245,7 @@ func Run() int {
 	showCmd.AddCommand(showDirCmd)
 	showCmd.AddCommand(showFileCmd)
 	showCmd.AddCommand(showHistoryCmd)
+	showCmd.AddCommand(showBulkCmd)
 
 	// add command to remove command
 	removeCmd.AddCommand(removeClientCmd)
@@ -250,9 +1254,80 @@ func Run() int {
 
 	// add command to download command
 	downloadCmd.AddCommand(downloadFileCmd)
+	downloadCmd.AddCommand(downloadDirCmd)
+
+	// add command to upload command
+	uploadCmd.AddCommand(uploadFileCmd)
+
+	// add command to share command
+	shareCmd.AddCommand(shareFileCmd)
+	shareCmd.AddCommand(shareRotateKeyCmd)
+
+	// add command to verify command
+	verifyCmd.AddCommand(verifyFileCmd)
+
+	// add command to server command
+	serverCmd.AddCommand(serverScrubCmd)
+	serverCmd.AddCommand(serverReindexCmd)
+	serverCmd.AddCommand(serverLogsCmd)
+	serverCmd.AddCommand(serverMetricsCmd)
+	serverMetricsCmd.AddCommand(serverSnapshotCmd)
+	serverCmd.AddCommand(serverHealthCmd)
+	serverCmd.AddCommand(serverCheckpointCmd)
+	serverCmd.AddCommand(serverDBStatsCmd)
+	serverCmd.AddCommand(serverDBCompactCmd)
+	serverCmd.AddCommand(serverPasswordCmd)
+
+	// add command to dir command
+	dirCmd.AddCommand(dirMoveCmd)
+	dirCmd.AddCommand(dirSetCmd)
+
+	// add command to file command
+	fileCmd.AddCommand(fileMoveCmd)
+	fileCmd.AddCommand(fileLockCmd)
+	fileCmd.AddCommand(fileUnlockCmd)
+	fileCmd.AddCommand(fileTagCmd)
+	fileCmd.AddCommand(fileSetCmd)
+	fileCmd.AddCommand(fileMetadataCmd)
+	fileMetadataCmd.AddCommand(fileMetadataSetCmd)
+	fileCmd.AddCommand(fileHistoryCmd)
+	fileHistoryCmd.AddCommand(fileHistoryGraphCmd)
+
+	// add command to diff command
+	diffCmd.AddCommand(diffDirCmd)
+
+	// add command to stats command
+	statsCmd.AddCommand(statsTransfersCmd)
+
+	// add command to count command
+	countCmd.AddCommand(countClientCmd)
+	countCmd.AddCommand(countDirCmd)
+	countCmd.AddCommand(countFileCmd)
+	countCmd.AddCommand(countHistoryCmd)
+
+	// add command to policy command
+	policyCmd.AddCommand(policyExplainCmd)
+
+	// add command to conflict command
+	conflictCmd.AddCommand(conflictResolveCmd)
+
+	// add command to sync command
+	syncCmd.AddCommand(syncNowCmd)
+
+	// add command to lock command
+	lockCmd.AddCommand(lockListCmd)
+	lockCmd.AddCommand(lockBreakCmd)
+
+	// add command to client command
+	clientCmd.AddCommand(clientSubCmd)
+	clientCmd.AddCommand(clientUnsubCmd)
+	clientCmd.AddCommand(clientScheduleCmd)
+	clientScheduleCmd.AddCommand(clientSchedSetCmd)
+	clientCmd.AddCommand(clientProvisionCmd)
 
 	// execute command
 	if err := rootCmd.Execute(); err != nil {
+		alertIncompatible(err)
 		return 1
 	}
 	return 0
@@ -264,7 +1339,77 @@ func initStartServerCmd() *cobra.Command {
 		Use:   StartCommand,
 		Short: "start quic-s server",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			quicsApp, err := app.New(addr, port, port3)
+			err := config.SetScrubInterval(scrubInterval)
+			if err != nil {
+				return err
+			}
+
+			err = config.SetMaxStreamsPerConn(maxStreamsPerConn)
+			if err != nil {
+				return err
+			}
+
+			err = config.SetHistoryLimit(historyLimit)
+			if err != nil {
+				return err
+			}
+
+			err = config.SetExtensionPolicies(extensionPolicies)
+			if err != nil {
+				return err
+			}
+
+			err = config.SetConverters(converters)
+			if err != nil {
+				return err
+			}
+
+			err = config.SetTimestampSource(timestampSource)
+			if err != nil {
+				return err
+			}
+
+			err = config.SetCacheTTL(cacheTTL)
+			if err != nil {
+				return err
+			}
+
+			err = config.SetMaxScans(maxScans)
+			if err != nil {
+				return err
+			}
+
+			err = config.SetRedactFields(redactFields)
+			if err != nil {
+				return err
+			}
+
+			err = config.SetHealthChecks(healthChecks)
+			if err != nil {
+				return err
+			}
+
+			err = config.SetProtocolRestarts(protocolRestarts)
+			if err != nil {
+				return err
+			}
+
+			config.SetAccessLog(accessLog, accessLogBodies)
+			config.SetBrowse(enableBrowse)
+			config.SetSafeMode(safeMode)
+			config.SetRepairDB(repairDB)
+
+			err = config.SetWatchDir(watchDir)
+			if err != nil {
+				return err
+			}
+
+			err = config.SetAutoStopAfter(autoStopAfter)
+			if err != nil {
+				return err
+			}
+
+			quicsApp, err := app.New(addr, port, port3, dataDir)
 			if err != nil {
 				return err
 			}
@@ -284,12 +1429,20 @@ func initStopServerCmd() *cobra.Command {
 		Use:   StopCommand,
 		Short: "stop quic-s server",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			url := "/api/v1/server/stop"
-
 			restClient := NewRestClient()
 
-			_, err := restClient.PostRequest(url, "application/json", nil) // /server/stop
+			err := restClient.StopServer() // /server/stop
 			if err != nil {
+				restClient.Close()
+
+				if isServerNotRunning(err) {
+					if ensureStopped {
+						log.Println("quics: ", "Server was already stopped")
+						return nil
+					}
+
+					err = errors.New("server is not running (use --ensure-stopped to treat it as success)")
+				}
 				log.Println("quics err: ", err)
 				return err
 			}
@@ -300,6 +1453,7 @@ func initStopServerCmd() *cobra.Command {
 				return err
 			}
 
+			log.Println("quics: ", "Server is stopped")
 			return nil
 		},
 	}
@@ -311,15 +1465,14 @@ func initListenCmd() *cobra.Command {
 		Use:   ListenCommand,
 		Short: "listen quic-s protocol",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			url := "/api/v1/server/listen"
-
 			restClient := NewRestClient()
 
-			_, err := restClient.PostRequest(url, "application/json", nil) // /server/listen
+			err := restClient.ListenProtocol() // /server/listen
 			if err != nil {
 				log.Println("quics err: ", err)
 				return err
 			}
+			log.Println("quics: ", "Success")
 
 			err = restClient.Close()
 			if err != nil {
@@ -337,87 +1490,83 @@ func initRunCmd() *cobra.Command {
 		Use:   RunCommand,
 		Short: "run quic-s server",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			quicsApp, err := app.New(addr, port, port3)
+			err := config.SetScrubInterval(scrubInterval)
 			if err != nil {
 				return err
 			}
 
-			err = quicsApp.Run()
+			err = config.SetMaxStreamsPerConn(maxStreamsPerConn)
 			if err != nil {
 				return err
 			}
-			return nil
-		},
-	}
-}
-
-func initPasswordCmd() *cobra.Command {
-	return &cobra.Command{
-		Use:   PasswordCommand,
-		Short: "change password for quic-s server",
-	}
-}
 
-func initPasswordSetCmd() *cobra.Command {
-	return &cobra.Command{
-		Use:   SetCommand,
-		Short: "change password for quic-s server",
-		RunE: func(cmd *cobra.Command, args []string) error {
-			if password == "" {
-				log.Println("quics: ", "Please enter password")
-				cmd.Help()
-				return nil
+			err = config.SetHistoryLimit(historyLimit)
+			if err != nil {
+				return err
 			}
 
-			url := "/api/v1/server/password/set"
-
-			server := &types.Server{
-				Password: password,
+			err = config.SetExtensionPolicies(extensionPolicies)
+			if err != nil {
+				return err
 			}
 
-			body, err := json.Marshal(server)
+			err = config.SetConverters(converters)
 			if err != nil {
-				log.Println("quics err: ", err)
 				return err
 			}
 
-			restClient := NewRestClient()
-
-			_, err = restClient.PostRequest(url, "application/json", body)
+			err = config.SetTimestampSource(timestampSource)
 			if err != nil {
-				log.Println("quics err: ", err)
 				return err
 			}
 
-			err = restClient.Close()
+			err = config.SetCacheTTL(cacheTTL)
 			if err != nil {
-				log.Println("quics err: ", err)
 				return err
 			}
 
-			return nil
-		},
-	}
-}
-
-func initPasswordResetCmd() *cobra.Command {
-	return &cobra.Command{
-		Use:   ResetCommand,
-		Short: "reset password for quic-s server",
-		RunE: func(cmd *cobra.Command, args []string) error {
-			url := "/api/v1/server/password/reset"
-
-			restClient := NewRestClient()
-
-			_, err := restClient.PostRequest(url, "application/json", nil)
+			err = config.SetMaxScans(maxScans)
 			if err != nil {
-				log.Println("quics err: ", err)
 				return err
 			}
 
-			err = restClient.Close()
+			err = config.SetRedactFields(redactFields)
+			if err != nil {
+				return err
+			}
+
+			err = config.SetHealthChecks(healthChecks)
+			if err != nil {
+				return err
+			}
+
+			err = config.SetProtocolRestarts(protocolRestarts)
+			if err != nil {
+				return err
+			}
+
+			config.SetAccessLog(accessLog, accessLogBodies)
+			config.SetBrowse(enableBrowse)
+			config.SetSafeMode(safeMode)
+			config.SetRepairDB(repairDB)
+
+			err = config.SetWatchDir(watchDir)
+			if err != nil {
+				return err
+			}
+
+			err = config.SetAutoStopAfter(autoStopAfter)
+			if err != nil {
+				return err
+			}
+
+			quicsApp, err := app.New(addr, port, port3, dataDir)
+			if err != nil {
+				return err
+			}
+
+			err = quicsApp.Run()
 			if err != nil {
-				log.Println("quics err: ", err)
 				return err
 			}
 			return nil
@@ -425,42 +1574,114 @@ func initPasswordResetCmd() *cobra.Command {
 	}
 }
 
-func initShowCmd() *cobra.Command {
+func initPasswordCmd() *cobra.Command {
 	return &cobra.Command{
-		Use:   ShowCommand,
-		Short: "show quic-s server data",
+		Use:   PasswordCommand,
+		Short: "change password for quic-s server",
 	}
 }
 
-func initShowClientCmd() *cobra.Command {
+func initPasswordSetCmd() *cobra.Command {
 	return &cobra.Command{
-		Use:   ClientCommand,
-		Short: "show client information",
+		Use:   SetCommand,
+		Short: "change password for quic-s server",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			validateOptionByCommand(showClientCmd)
+			if password == "" {
+				log.Println("quics: ", "Please enter password")
+				cmd.Help()
+				return nil
+			}
+
+			return setPassword()
+		},
+	}
+}
 
-			url := "/api/v1/server/logs/clients?uuid=" + id
+func initPasswordResetCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   ResetCommand,
+		Short: "reset password for quic-s server",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// admin token is readable only on server machine, so password is reset by local admin unless token is given
+			if adminToken == "" {
+				token, err := os.ReadFile(utils.GetAdminTokenPath())
+				if err != nil {
+					log.Println("quics err: ", err)
+					log.Println("quics: ", "Please run on server machine, or enter --"+AdminTokenOption)
+					return err
+				}
+				adminToken = strings.TrimSpace(string(token))
+			}
 
 			restClient := NewRestClient()
 
-			response, err := restClient.GetRequest(url) // /clients
+			err := restClient.ResetPassword(adminToken) // /server/password/reset
 			if err != nil {
 				log.Println("quics err: ", err)
 				return err
 			}
+			log.Println("quics: ", "Success")
 
 			err = restClient.Close()
 			if err != nil {
 				log.Println("quics err: ", err)
 				return err
 			}
+			return nil
+		},
+	}
+}
+
+func initShowCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   ShowCommand,
+		Short: "show quic-s server data",
+	}
+}
+
+func initShowClientCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   ClientCommand,
+		Short: "show client information",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			filter, err := getLogFilter()
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+			if filter != nil && (id != "" || root != "") {
+				log.Println("quics: ", "Please enter filters without --id and --root")
+				cmd.Help()
+				return nil
+			}
+
+			// clients can be shown by filters alone (without --all or --id)
+			if root == "" && filter == nil {
+				if !validateOptionByCommand(showClientCmd) {
+					return nil
+				}
+			}
+			if id != "" {
+				if err := utils.ValidateUUID(id); err != nil {
+					log.Println("quics: ", err)
+					return nil
+				}
+			}
 
-			clients := []types.Client{}
-			utils.UnmarshalRequestBody(response.Bytes(), clients)
+			clients, err := getPages(func(restClient *client.Client, page *client.PageOptions) (*types.Page[types.Client], error) {
+				if filter != nil {
+					return restClient.ListClientsWhere(filter, page)
+				}
+				return restClient.ListClients(id, root, page) // /clients
+			})
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
 
 			for _, client := range clients {
 				for _, root := range client.Root {
-					fmt.Printf("*   UUID: %s   |   ID: %d   |   IP: %s   |   Root Directoreis: %s   *\n", client.UUID, client.Id, client.Ip, root)
+					fmt.Printf("*   UUID: %s   |   ID: %d   |   Alias: %s   |   IP: %s   |   Transport: %s   |   Root Directoreis: %s   |   Subscriptions: %s   |   Schedule: %s   |   Capabilities: %s   *\n", client.UUID, client.Id, client.Alias, client.Ip, client.Transport, root.AfterPath, client.Subscriptions, formatSchedule(&client.Schedule), formatCapabilities(client.Capabilities))
 				}
 			}
 
@@ -474,29 +1695,85 @@ func initShowDirCmd() *cobra.Command {
 		Use:   DirCommand,
 		Short: "show directory information",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			validateOptionByCommand(showDirCmd)
+			// conflicts are listed of every directory (or of --id), not of filters
+			if conflicts {
+				if jsonPaths || owner != "" || prefix != "" || uuid != "" {
+					log.Println("quics: ", "Please enter --conflicts without --json-paths and filters")
+					cmd.Help()
+					return nil
+				}
 
-			url := "/api/v1/server/logs/directories?afterPath=" + path
+				restClient := NewRestClient()
+				conflictsRes, err := restClient.GetConflicts(id)
+				if err != nil {
+					log.Println("quics err: ", err)
+					return err
+				}
 
-			restClient := NewRestClient()
+				err = restClient.Close()
+				if err != nil {
+					log.Println("quics err: ", err)
+					return err
+				}
+
+				for _, directory := range conflictsRes.Directories {
+					fmt.Printf("*   Root Directory: %s   |   Conflicts: %d   *\n", directory.RootDir, len(directory.Conflicts))
+					for _, conflict := range directory.Conflicts {
+						fmt.Printf("    %s\n", conflict.AfterPath)
+						for _, candidate := range conflict.Candidates {
+							fmt.Printf("        Side: %s   |   UUID: %s   |   Hash: %s   |   Timestamp: %d   |   Date: %s   |   Size: %d\n", candidate.Side, candidate.UUID, candidate.Hash, candidate.Timestamp, candidate.Date, candidate.Size)
+						}
+					}
+				}
+				fmt.Printf("*   Directories: %d   |   Conflicts: %d   *\n", len(conflictsRes.Directories), conflictsRes.Conflicts)
+
+				return nil
+			}
+
+			if jsonPaths {
+				if filesOnly && dirsOnly {
+					log.Println("quics: ", "Please enter only one of --files-only and --dirs-only")
+					cmd.Help()
+					return nil
+				}
+
+				err := printJSONPaths()
+				if err != nil {
+					log.Println("quics err: ", err)
+					return err
+				}
+				return nil
+			}
 
-			response, err := restClient.GetRequest(url) // /directories
+			filter, err := getLogFilter()
 			if err != nil {
 				log.Println("quics err: ", err)
 				return err
 			}
+			if filter != nil && id != "" {
+				log.Println("quics: ", "Please enter filters without --id")
+				cmd.Help()
+				return nil
+			}
 
-			err = restClient.Close()
+			// root directories can be shown by filters alone (without --all or --id)
+			if filter == nil && !validateOptionByCommand(showDirCmd) {
+				return nil
+			}
+
+			dirs, err := getPages(func(restClient *client.Client, page *client.PageOptions) (*types.Page[types.RootDirectory], error) {
+				if filter != nil {
+					return restClient.ListDirectoriesWhere(filter, page)
+				}
+				return restClient.ListDirectories(id, page) // /directories
+			})
 			if err != nil {
 				log.Println("quics err: ", err)
 				return err
 			}
-
-			dirs := []types.RootDirectory{}
-			utils.UnmarshalRequestBody(response.Bytes(), dirs)
 			for _, dir := range dirs {
 				for _, UUID := range dir.UUIDs {
-					fmt.Printf("*   Root Directory: %s   |   Owner: %s   |   Password: %s   |   UUID: %s   *\n", dir.AfterPath, dir.Owner, dir.Password, UUID)
+					fmt.Printf("*   Root Directory: %s   |   Owner: %s   |   Password: %s   |   AppendOnly: %t   |   Versioning: %s   |   Policies: %s   |   UUID: %s   *\n", dir.AfterPath, dir.Owner, dir.Password, dir.AppendOnly, formatVersioning(dir.VersioningPolicies), formatPolicies(dir.Policies), UUID)
 				}
 			}
 
@@ -510,29 +1787,116 @@ func initShowFileCmd() *cobra.Command {
 		Use:   FileCommand,
 		Short: "show file information",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			validateOptionByCommand(showFileCmd)
+			if orphaned {
+				if all || id != "" || tagFilter != "" || metadataFilter != "" || duplicates {
+					log.Println("quics: ", "Please enter --orphaned without other options")
+					cmd.Help()
+					return nil
+				}
 
-			url := "/api/v1/server/logs/files?afterPath=" + path
+				files, err := getPages(func(restClient *client.Client, page *client.PageOptions) (*types.Page[types.File], error) {
+					return restClient.ListOrphanedFiles(page)
+				})
+				if err != nil {
+					log.Println("quics err: ", err)
+					return err
+				}
 
-			restClient := NewRestClient()
+				for _, file := range files {
+					fmt.Printf("*   File: %s   |   Missing Root Directory: %s   |   LatestHash: %s   |   LatestSyncTimestamp: %d   |   ContentsExisted: %t   |   Size: %s   *\n", file.AfterPath, file.RootDirKey, file.LatestHash, file.LatestSyncTimestamp, file.ContentsExisted, formatFileSize(&file))
+				}
+
+				return nil
+			}
+
+			// duplicates are reported of every file matched by filters (not of --id or --all)
+			if duplicates {
+				if all || id != "" || syncedTo != "" {
+					log.Println("quics: ", "Please enter --duplicates without --all, --id and --synced-to")
+					cmd.Help()
+					return nil
+				}
+
+				filter, err := getLogFilter()
+				if err != nil {
+					log.Println("quics err: ", err)
+					return err
+				}
+
+				restClient := NewRestClient()
+				duplicatesRes, err := restClient.GetDuplicateFiles(filter)
+				if err != nil {
+					log.Println("quics err: ", err)
+					return err
+				}
+
+				err = restClient.Close()
+				if err != nil {
+					log.Println("quics err: ", err)
+					return err
+				}
+
+				for _, group := range duplicatesRes.Groups {
+					fmt.Printf("*   ContentHash: %s   |   Size: %d   |   Files: %d   |   Reclaimable: %d   *\n", group.ContentHash, group.Size, len(group.AfterPaths), group.ReclaimableBytes)
+					for _, afterPath := range group.AfterPaths {
+						fmt.Printf("    %s\n", afterPath)
+					}
+				}
+				fmt.Printf("*   Groups: %d   |   Duplicate Files: %d   |   Reclaimable Bytes: %d   *\n", len(duplicatesRes.Groups), duplicatesRes.DuplicateFiles, duplicatesRes.ReclaimableBytes)
+
+				return nil
+			}
+
+			// read-your-writes: the file is shown after the uploaded version is visible
+			if syncedTo != "" {
+				if id == "" || all || tagFilter != "" || metadataFilter != "" || utils.IsGlobPattern(id) {
+					log.Println("quics: ", "Please enter --synced-to with --id of a file")
+					cmd.Help()
+					return nil
+				}
+
+				restClient := NewRestClient()
+				file, err := restClient.GetFileSyncedTo(id, syncedTo)
+				if err != nil {
+					log.Println("quics err: ", err)
+					return err
+				}
 
-			response, err := restClient.GetRequest(url) // /files
+				err = restClient.Close()
+				if err != nil {
+					log.Println("quics err: ", err)
+					return err
+				}
+
+				fmt.Printf("*   File: %s   |   Root Directory: %s   |   LatestHash: %s   |   LatestSyncTimestamp: %d   |   ContentsExisted: %t   |   Size: %s   |   ModTime: %s   |   Lock: %s   |   Tags: %s   |   NoHistory: %t   |   Metadata: %s   |   Encryption: %s   *\n", file.AfterPath, file.RootDirKey, file.LatestHash, file.LatestSyncTimestamp, file.ContentsExisted, formatFileSize(file), formatTime(file.Metadata.ModTime), formatLock(&file.Lock), formatTags(file.Tags), file.NoHistory, formatMetadata(file.CustomMetadata), formatEncryption(&file.Encryption))
+
+				return nil
+			}
+
+			filter, err := getLogFilter()
 			if err != nil {
 				log.Println("quics err: ", err)
 				return err
 			}
 
-			err = restClient.Close()
+			// files can be shown by filters (e.g., tags) alone (without --all or --id)
+			if (filter == nil || all && id != "") && !validateOptionByCommand(showFileCmd) {
+				return nil
+			}
+
+			files, err := getPages(func(restClient *client.Client, page *client.PageOptions) (*types.Page[types.File], error) {
+				if filter != nil {
+					return restClient.ListFilesWhere(id, filter, page)
+				}
+				return restClient.ListFiles(id, page) // /files
+			})
 			if err != nil {
 				log.Println("quics err: ", err)
 				return err
 			}
 
-			files := []types.File{}
-			utils.UnmarshalRequestBody(response.Bytes(), files)
-
 			for _, file := range files {
-				fmt.Printf("*   File: %s   |   Root Directory: %s   |   LatestHash: %s   |   LatestSyncTimestamp: %d   |   ContentsExisted: %t   |   Metadata: %s   *\n", file.AfterPath, file.RootDirKey, file.LatestHash, file.LatestSyncTimestamp, file.ContentsExisted, file.Metadata.ModTime)
+				fmt.Printf("*   File: %s   |   Root Directory: %s   |   LatestHash: %s   |   LatestSyncTimestamp: %d   |   ContentsExisted: %t   |   Size: %s   |   ModTime: %s   |   Lock: %s   |   Tags: %s   |   NoHistory: %t   |   Metadata: %s   |   Encryption: %s   *\n", file.AfterPath, file.RootDirKey, file.LatestHash, file.LatestSyncTimestamp, file.ContentsExisted, formatFileSize(&file), formatTime(file.Metadata.ModTime), formatLock(&file.Lock), formatTags(file.Tags), file.NoHistory, formatMetadata(file.CustomMetadata), formatEncryption(&file.Encryption))
 			}
 
 			return nil
@@ -545,29 +1909,84 @@ func initShowHistoryCmd() *cobra.Command {
 		Use:   HistoryCommand,
 		Short: "show history information",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			validateOptionByCommand(showHistoryCmd)
-
-			url := "/api/v1/server/logs/histories?afterPath=" + path
-
-			restClient := NewRestClient()
-
-			response, err := restClient.GetRequest(url) // /history
+			filter, err := getLogFilter()
 			if err != nil {
 				log.Println("quics err: ", err)
 				return err
 			}
+			if filter != nil && commitID != "" {
+				log.Println("quics: ", "Please enter filters without --commit")
+				cmd.Help()
+				return nil
+			}
 
-			err = restClient.Close()
+			// histories can be shown by filters alone (without --all or --id)
+			if commitID == "" && (filter == nil || all && id != "") && !validateOptionByCommand(showHistoryCmd) {
+				return nil
+			}
+
+			histories, err := getPages(func(restClient *client.Client, page *client.PageOptions) (*types.Page[types.FileHistory], error) {
+				if commitID != "" {
+					return restClient.ListCommitHistories(commitID, page)
+				}
+				if filter != nil {
+					return restClient.ListHistoriesWhere(id, filter, page)
+				}
+				return restClient.ListHistories(id, page) // /history
+			})
 			if err != nil {
 				log.Println("quics err: ", err)
 				return err
 			}
 
-			histories := []types.FileHistory{}
-			utils.UnmarshalRequestBody(response.Bytes(), histories)
-
 			for _, history := range histories {
-				fmt.Printf("*   Path: %s   |   Date: %s   |   UUID: %s   |   Timestamp: %d   |   Hash: %s   |*\n", history.BeforePath+history.AfterPath, history.Date, history.UUID, history.Timestamp, history.Hash)
+				// version recorded by file move shows the path which file was moved from
+				if history.MovedFrom != "" {
+					fmt.Printf("*   Path: %s   |   Date: %s   |   UUID: %s   |   Timestamp: %d   |   Hash: %s   |   Moved From: %s   |*\n", history.BeforePath+history.AfterPath, formatDate(history.Date), history.UUID, history.Timestamp, history.Hash, history.MovedFrom)
+					continue
+				}
+				fmt.Printf("*   Path: %s   |   Date: %s   |   UUID: %s   |   Timestamp: %d   |   Hash: %s   |*\n", history.BeforePath+history.AfterPath, formatDate(history.Date), history.UUID, history.Timestamp, history.Hash)
+			}
+
+			return nil
+		},
+	}
+}
+
+// BulkFollowInterval is the interval of showing progress of bulk operation with --follow
+const BulkFollowInterval = time.Second
+
+func initShowBulkCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   BulkCommand,
+		Short: "show progress of destructive bulk operation running on server",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			restClient := NewRestClient()
+
+			for {
+				progress, err := restClient.GetBulkOperation() // /logs/bulk
+				if err != nil {
+					log.Println("quics err: ", err)
+					return err
+				}
+
+				if !progress.Running {
+					log.Println("quics: ", "No bulk operation is running")
+					break
+				}
+				startedAt, _ := time.Parse(time.RFC3339, progress.StartedAt)
+				fmt.Printf("*   Kind: %s   |   Path: %s   |   Purge: %t   |   Phase: %s   |   Done: %s   |   Started At: %s   *\n", progress.Kind, progress.AfterPath, progress.Purge, progress.Phase, formatBulkProgress(progress), formatTime(startedAt))
+
+				if !follow {
+					break
+				}
+				time.Sleep(BulkFollowInterval)
+			}
+
+			err := restClient.Close()
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
 			}
 
 			return nil
@@ -587,17 +2006,30 @@ func initRemoveClientCmd() *cobra.Command {
 		Use:   ClientCommand,
 		Short: "remove client",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			validateOptionByCommand(removeClientCmd)
-
-			url := "/api/v1/server/remove/clients?uuid=" + id
+			if !validateOptionByCommand(removeClientCmd) {
+				return nil
+			}
+			if id != "" {
+				if err := utils.ValidateUUID(id); err != nil {
+					log.Println("quics: ", err)
+					return nil
+				}
+			}
 
 			restClient := NewRestClient()
 
-			_, err := restClient.PostRequest(url, "application/json", nil)
+			var err error
+			if all {
+				err = restClient.RemoveAllClients()
+			} else {
+				err = restClient.RemoveClient(id)
+			}
 			if err != nil {
 				log.Println("quics err: ", err)
+				alertBulkOperationRunning(err)
 				return err
 			}
+			log.Println("quics: ", "Success")
 
 			err = restClient.Close()
 			if err != nil {
@@ -615,17 +2047,24 @@ func initRemoveDirCmd() *cobra.Command {
 		Use:   DirCommand,
 		Short: "initialize directory",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			validateOptionByCommand(removeDirCmd)
-
-			url := "/api/v1/server/remove/directories?afterPath=" + path
+			if !validateOptionByCommand(removeDirCmd) {
+				return nil
+			}
 
 			restClient := NewRestClient()
 
-			_, err := restClient.PostRequest(url, "application/json", nil)
+			var err error
+			if all {
+				err = restClient.RemoveAllDirectories()
+			} else {
+				err = restClient.RemoveDirectory(id)
+			}
 			if err != nil {
 				log.Println("quics err: ", err)
+				alertBulkOperationRunning(err)
 				return err
 			}
+			log.Println("quics: ", "Success")
 
 			err = restClient.Close()
 			if err != nil {
@@ -643,18 +2082,36 @@ func initRemoveFileCmd() *cobra.Command {
 		Use:   FileCommand,
 		Short: "initialize file",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			validateOptionByCommand(removeFileCmd)
-
-			url := "/api/v1/server/remove/files?afterPath=" + path
+			if orphaned && (all || id != "" || recursive) {
+				log.Println("quics: ", "Please enter --orphaned without --all, --id and --recursive")
+				cmd.Help()
+				return nil
+			}
+			if !orphaned && !validateOptionByCommand(removeFileCmd) {
+				return nil
+			}
 
 			restClient := NewRestClient()
 
-			_, err := restClient.PostRequest(url, "application/json", nil)
+			var removeRes *types.RemoveRes
+			var err error
+			if orphaned {
+				removeRes, err = restClient.RemoveOrphanedFiles(client.RemoveFileOptions{DryRun: dryRun, Purge: purge})
+			} else {
+				removeRes, err = restClient.RemoveFile(id, client.RemoveFileOptions{All: all, Recursive: recursive, DryRun: dryRun, Purge: purge})
+			}
 			if err != nil {
 				log.Println("quics err: ", err)
+				alertBulkOperationRunning(err)
 				return err
 			}
 
+			if removeRes.DryRun {
+				fmt.Printf("*   Would remove: %d   *\n", removeRes.Removed)
+			} else {
+				fmt.Printf("*   Removed: %d   *\n", removeRes.Removed)
+			}
+
 			err = restClient.Close()
 			if err != nil {
 				log.Println("quics err: ", err)
@@ -673,60 +2130,2729 @@ func initDownloadCmd() *cobra.Command {
 	}
 }
 
+func initDownloadDirCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   DirCommand,
+		Short: "download every file under directory",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if path == "" || target == "" || utils.IsGlobPattern(path) {
+				log.Println("quics: ", "Please enter both directory path (not glob pattern) and target directory")
+				cmd.Help()
+				return nil
+			}
+			if stripPrefix < 0 {
+				log.Println("quics: ", "Please enter non-negative number of path components for --"+StripPrefixOption)
+				cmd.Help()
+				return nil
+			}
+
+			err := downloadDir(path, target)
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			return nil
+		},
+	}
+}
+
 func initDownloadFileCmd() *cobra.Command {
 	return &cobra.Command{
 		Use:   FileCommand,
 		Short: "download certain file",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if path == "" || version == 0 || target == "" {
-				log.Println("quics: ", "Please enter both path and version")
+			// glob pattern (e.g., /root/logs/*.txt) downloads latest version of every matched file into target directory
+			if utils.IsGlobPattern(path) {
+				if target == "" || version != 0 || timestamp != 0 || downloadAs != "" || syncedTo != "" {
+					log.Println("quics: ", "Please enter target directory without version, timestamp, --as and --synced-to for glob pattern")
+					cmd.Help()
+					return nil
+				}
+
+				err := downloadFilesByPattern(path, target)
+				if err != nil {
+					log.Println("quics err: ", err)
+					return err
+				}
+				return nil
+			}
+
+			if path == "" || target == "" {
+				log.Println("quics: ", "Please enter both path and target")
+				cmd.Help()
+				return nil
+			}
+			selector, err := getVersionSelector()
+			if err != nil {
+				log.Println("quics: ", "Please "+err.Error())
+				cmd.Help()
+				return nil
+			}
+			if downloadAs != "" && syncedTo != "" {
+				log.Println("quics: ", "Please enter either --as or --synced-to")
 				cmd.Help()
 				return nil
 			}
 
-			url := "/api/v1/server/download/files?afterPath=" + path + "&timestamp=" + fmt.Sprint(version)
+			// check target before downloading not to write through planted symbolic link
+			destination, err := resolveDownloadTarget(target)
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
 
 			restClient := NewRestClient()
 
-			response, err := restClient.GetRequest(url)
+			versionTimestamp, err := resolveVersion(restClient, path, selector, syncedTo)
 			if err != nil {
 				log.Println("quics err: ", err)
 				return err
 			}
 
-			err = restClient.Close()
+			// verified contents are streamed into target, so that large file is not held in memory
+			if verifyChunks {
+				err = downloadVerifiedFile(restClient, path, versionTimestamp, destination)
+				if err != nil {
+					log.Println("quics err: ", err)
+					alertContentMissing(err)
+					return err
+				}
+
+				err = restClient.Close()
+				if err != nil {
+					log.Println("quics err: ", err)
+					return err
+				}
+				return nil
+			}
+
+			var contents []byte
+			if downloadAs != "" {
+				contents, err = restClient.DownloadFileAs(path, versionTimestamp, downloadAs)
+			} else if syncedTo != "" {
+				contents, err = restClient.DownloadFileSyncedTo(path, versionTimestamp, syncedTo)
+			} else {
+				contents, err = restClient.DownloadFile(path, versionTimestamp)
+			}
 			if err != nil {
 				log.Println("quics err: ", err)
+				alertContentMissing(err)
+				alertVersionNotFound(err)
 				return err
 			}
 
-			destinationFile, err := os.Create(target)
+			err = restClient.Close()
 			if err != nil {
+				log.Println("quics err: ", err)
 				return err
 			}
-			defer destinationFile.Close()
 
-			n, err := destinationFile.Write(response.Bytes())
+			// contents are written only after server responded 2xx (error response is returned as error by rest client)
+			err = writeDownloadTarget(destination, contents)
 			if err != nil {
+				log.Println("quics err: ", err)
 				return err
 			}
-			if n != len(response.Bytes()) {
-				return io.ErrShortWrite
-			}
 
 			return nil
 		},
 	}
 }
 
-// ********************************************************************************
-//                                  Private Logic
-// ********************************************************************************
+func initUploadCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   UploadCommand,
+		Short: "upload certain file",
+	}
+}
+
+func initUploadFileCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   FileCommand,
+		Short: "upload certain file",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if path == "" || from == "" {
+				log.Println("quics: ", "Please enter both path and local file")
+				cmd.Help()
+				return nil
+			}
+
+			if ifVersion != "" && cmd.Flags().Changed(MetadataOption) {
+				log.Println("quics: ", "Please enter either --if-version or --metadata (set metadata by file metadata set after conditional upload)")
+				cmd.Help()
+				return nil
+			}
+
+			metadata, err := utils.ParseFileMetadataFields(metadataJSON)
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			contents, err := os.ReadFile(from)
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			restClient := NewRestClient()
+
+			var file *types.File
+			switch {
+			case ifVersion != "":
+				file, err = restClient.UploadIfMatch(path, contents, ifVersion)
+			case cmd.Flags().Changed(MetadataOption):
+				file, err = restClient.UploadWithMetadata(path, contents, metadata)
+			default:
+				file, err = restClient.Upload(path, contents)
+			}
+			if client.IsStatus(err, http.StatusConflict) {
+				log.Println("quics: ", "File has been changed since the version; show the file and retry with its latest hash")
+			}
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			err = restClient.Close()
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			fmt.Printf("*   Path: %s   |   Timestamp: %d   |   Hash: %s   |   Synced-To: %s   *\n", file.AfterPath, file.LatestSyncTimestamp, file.LatestHash, client.SyncToken(file))
+
+			return nil
+		},
+	}
+}
+
+func initShareCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   ShareCommand,
+		Short: "share certain file by signed url",
+	}
+}
+
+func initShareFileCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   FileCommand,
+		Short: "create signed url which downloads certain file without login until it expires",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if path == "" {
+				log.Println("quics: ", "Please enter path")
+				cmd.Help()
+				return nil
+			}
+			selector, err := getVersionSelector()
+			if err != nil {
+				log.Println("quics: ", "Please "+err.Error())
+				cmd.Help()
+				return nil
+			}
+
+			duration, err := time.ParseDuration(expires)
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			restClient := NewRestClient()
+
+			versionTimestamp, err := resolveVersion(restClient, path, selector, "")
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			signedURLRes, err := restClient.ShareFile(path, versionTimestamp, duration)
+			if err != nil {
+				log.Println("quics err: ", err)
+				alertVersionNotFound(err)
+				return err
+			}
+
+			err = restClient.Close()
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			fmt.Printf("*   URL: %s   |   Expires: %s   *\n", signedURLRes.URL, formatTime(signedURLRes.ExpiresAt))
+
+			return nil
+		},
+	}
+}
+
+func initVerifyCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   VerifyCommand,
+		Short: "verify local copy of certain file",
+	}
+}
+
+// initVerifyFileCmd compares local file with a version of file by hash, fetching only hash and size from server
+// (`qis verify file`); it fails on mismatch, so that scripts can check exit status
+func initVerifyFileCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   FileCommand,
+		Short: "verify local file against a version of certain file without downloading it again",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if path == "" || localPath == "" {
+				log.Println("quics: ", "Please enter both path and local file")
+				cmd.Help()
+				return nil
+			}
+			selector, err := getVersionSelector()
+			if err != nil {
+				log.Println("quics: ", "Please "+err.Error())
+				cmd.Help()
+				return nil
+			}
+
+			info, err := os.Stat(localPath)
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+			if !info.Mode().IsRegular() {
+				err = errors.New("local file is not a regular file: " + localPath)
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			restClient := NewRestClient()
+
+			versionTimestamp, err := resolveVersion(restClient, path, selector, "")
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			digest, err := restClient.GetFileDigest(path, versionTimestamp)
+			if err != nil {
+				log.Println("quics err: ", err)
+				alertContentMissing(err)
+				alertVersionNotFound(err)
+				return err
+			}
+
+			err = restClient.Close()
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			// size differs without reading local file
+			contentHash := "-"
+			if info.Size() == digest.Size {
+				contentHash, err = utils.MakeContentHashFromFile(localPath)
+				if err != nil {
+					log.Println("quics err: ", err)
+					return err
+				}
+			}
+
+			if info.Size() != digest.Size || contentHash != digest.ContentHash {
+				fmt.Printf("*   Verify: %s   |   Path: %s   |   Timestamp: %d   |   Size: %d (expected %d)   |   Hash: %s (expected %s)   *\n", colorize(colorRed, "mismatch"), digest.AfterPath, digest.Timestamp, info.Size(), digest.Size, contentHash, digest.ContentHash)
+				return errors.New("local file does not match version " + strconv.FormatUint(digest.Timestamp, 10) + " of " + digest.AfterPath)
+			}
+
+			fmt.Printf("*   Verify: %s   |   Path: %s   |   Timestamp: %d   |   Size: %d   |   Hash: %s   *\n", colorize(colorGreen, "match"), digest.AfterPath, digest.Timestamp, digest.Size, digest.ContentHash)
+			return nil
+		},
+	}
+}
+
+func initShareRotateKeyCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   RotateKeyCommand,
+		Short: "revoke every signed url by rotating signing key",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			restClient := NewRestClient()
+
+			err := restClient.RotateSigningKey()
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			err = restClient.Close()
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			log.Println("quics: ", "Every signed url is revoked")
+
+			return nil
+		},
+	}
+}
+
+func initServerCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   ServerCommand,
+		Short: "manage quic-s server",
+	}
+}
+
+func initServerScrubCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   ScrubCommand,
+		Short: "verify integrity of stored contents",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			restClient := NewRestClient()
+
+			scrubRes, err := restClient.Scrub()
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			err = restClient.Close()
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			corrupted := fmt.Sprint(scrubRes.Corrupted)
+			if scrubRes.Corrupted > 0 {
+				corrupted = colorize(colorRed, corrupted)
+			}
+			fmt.Printf("*   Scanned: %d   |   Corrupted: %s   *\n", scrubRes.Scanned, corrupted)
+			for _, corruptedFile := range scrubRes.CorruptedFiles {
+				fmt.Printf("*   Corrupted File: %s   *\n", corruptedFile)
+			}
+
+			return nil
+		},
+	}
+}
+
+func initServerReindexCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   ReindexCommand,
+		Short: "rebuild derived index from primary records",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			restClient := NewRestClient()
+
+			reindexResList, err := restClient.Reindex(index)
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			err = restClient.Close()
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			for _, reindexRes := range reindexResList {
+				failed := fmt.Sprint(reindexRes.Failed)
+				if reindexRes.Failed > 0 {
+					failed = colorize(colorYellow, failed)
+				}
+				fmt.Printf("*   Index: %s   |   Scanned: %d   |   Updated: %d   |   Failed: %s   *\n", reindexRes.Index, reindexRes.Scanned, reindexRes.Updated, failed)
+			}
+
+			return nil
+		},
+	}
+}
+
+func initServerCheckpointCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   CheckpointCommand,
+		Short: "flush database to disk before taking snapshot or powering down",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			restClient := NewRestClient()
+
+			checkpointRes, err := restClient.Checkpoint()
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			err = restClient.Close()
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			fmt.Printf("*   Synced Files: %d   |   Duration: %s   *\n", checkpointRes.SyncedFiles, checkpointRes.Duration)
+
+			return nil
+		},
+	}
+}
+
+func initServerDBStatsCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   DBStatsCommand,
+		Short: "show sizes of LSM tree and value log of database to decide when to compact or collect garbage",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			restClient := NewRestClient()
+
+			dbStatsRes, err := restClient.GetDBStats()
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			err = restClient.Close()
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			if jsonOutput {
+				output, err := json.MarshalIndent(dbStatsRes, "", "  ")
+				if err != nil {
+					log.Println("quics err: ", err)
+					return err
+				}
+				fmt.Println(string(output))
+				return nil
+			}
+
+			fmt.Printf("*   LSM Size: %d   |   Stale LSM Size: %d   |   Last Compaction: %s   *\n", dbStatsRes.LSMSize, dbStatsRes.StaleLSMSize, formatTime(dbStatsRes.LastCompaction))
+			for _, level := range dbStatsRes.Levels {
+				fmt.Printf("*   Level: %d   |   Tables: %d   |   Size: %d   |   Target Size: %d   |   Stale Size: %d   *\n", level.Level, level.Tables, level.Size, level.TargetSize, level.StaleSize)
+			}
+
+			garbage := fmt.Sprint(dbStatsRes.EstimatedGarbage)
+			if dbStatsRes.ValueLogGCRecommended {
+				garbage = colorize(colorYellow, garbage)
+			}
+			fmt.Printf("*   Value Log Files: %d   |   Value Log Size: %d   |   Live Value Log Size: %d   |   Estimated Garbage: %s   |   Last Value Log GC: %s   *\n", dbStatsRes.ValueLogFiles, dbStatsRes.ValueLogSize, dbStatsRes.LiveValueLogSize, garbage, formatTime(dbStatsRes.LastValueLogGC))
+			if dbStatsRes.ValueLogGCRecommended {
+				log.Println("quics: ", "value log has much garbage; run qis server db-compact --value-log-gc to reclaim it")
+			}
+
+			return nil
+		},
+	}
+}
+
+func initServerDBCompactCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   DBCompactCommand,
+		Short: "compact levels of LSM tree of database (and collect garbage of value log)",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			restClient := NewRestClient()
+
+			compactRes, err := restClient.CompactDB(valueLogGC)
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			err = restClient.Close()
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			fmt.Printf("*   LSM Size: %d -> %d   |   Value Log Size: %d -> %d   |   Rewritten Log Files: %d   |   Duration: %s   *\n", compactRes.LSMSizeBefore, compactRes.LSMSizeAfter, compactRes.ValueLogSizeBefore, compactRes.ValueLogSizeAfter, compactRes.RewrittenLogFiles, compactRes.Duration)
+
+			return nil
+		},
+	}
+}
+
+// initServerPasswordCmd changes password after server verifies current password (`qis server set-password`)
+func initServerPasswordCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   SetPasswordCommand,
+		Short: "change password for quic-s server verifying current password",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if password == "" {
+				log.Println("quics: ", "Please enter new password")
+				cmd.Help()
+				return nil
+			}
+
+			return setPassword()
+		},
+	}
+}
+
+func initServerMetricsCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   MetricsCommand,
+		Short: "show stream usage of each client connection",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			restClient := NewRestClient()
+
+			metrics, err := restClient.GetMetrics()
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			err = restClient.Close()
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			fmt.Printf("*   Max Streams Per Connection: %d   |   Connections: %d   *\n", metrics.MaxStreamsPerConn, len(metrics.Connections))
+			fmt.Printf("*   Accepted Handshakes: %d   |   Rejected Handshakes: %d   |   Rejected By Reason: %s   *\n", metrics.Handshakes.Accepted, metrics.Handshakes.Rejected, formatCounts(metrics.Handshakes.RejectedByReason))
+			fmt.Printf("*   Event Workers: %d (%s ordering, %s on overflow)   |   Event Queue: %d/%d   |   Published Events: %d   |   Delivered Events: %d   |   Dropped Events: queue=%d,listener=%d   *\n", metrics.Events.Workers, metrics.Events.Ordering, metrics.Events.Overflow, metrics.Events.QueueDepth, metrics.Events.QueueCapacity, metrics.Events.Published, metrics.Events.Delivered, metrics.Events.DroppedQueue, metrics.Events.DroppedListener)
+			fmt.Printf("*   Free Disk: %d/%d bytes   |   Low Space: %t (below %d bytes)   |   Read-Only: %t   |   Last Disk Full: %s   *\n", metrics.Disk.Free, metrics.Disk.Total, metrics.Disk.IsLow, metrics.Disk.LowSpace, metrics.Disk.ReadOnly, metrics.Disk.LastFull)
+			if metrics.Disk.CheckErr != "" {
+				log.Println("quics alert: ", "free space of data directory is unknown: ", metrics.Disk.CheckErr)
+			}
+			for _, conn := range metrics.Connections {
+				fmt.Printf("*   Address: %s   |   Active Streams: %d   |   Rejected Streams: %d   *\n", conn.Address, conn.Active, conn.Rejected)
+			}
+
+			return nil
+		},
+	}
+}
+
+// initServerMetricsSnapshotCmd shows key metrics at a glance (`qis server metrics snapshot`)
+func initServerMetricsSnapshotCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   SnapshotCommand,
+		Short: "show uptime, connections, transfers in flight, database size and recent errors at a glance",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			restClient := NewRestClient()
+
+			metrics, err := restClient.GetMetrics()
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			err = restClient.Close()
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			if jsonOutput {
+				output, err := json.MarshalIndent(metrics, "", "  ")
+				if err != nil {
+					log.Println("quics err: ", err)
+					return err
+				}
+				fmt.Println(string(output))
+				return nil
+			}
+
+			activeStreams := 0
+			for _, conn := range metrics.Connections {
+				activeStreams += conn.Active
+			}
+
+			disk := fmt.Sprintf("%d/%d bytes", metrics.Disk.Free, metrics.Disk.Total)
+			switch {
+			case metrics.Disk.ReadOnly:
+				disk = colorize(colorRed, disk+" (read-only)")
+			case metrics.Disk.IsLow:
+				disk = colorize(colorYellow, disk+" (low)")
+			}
+			errs := fmt.Sprint(metrics.Logs.Errors)
+			if metrics.Logs.Errors != 0 {
+				errs = colorize(colorRed, errs)
+			}
+
+			fmt.Printf("*   Uptime: %s (since %s)   |   Connections: %d   |   Active Streams: %d   |   Transfers In Flight: %d   *\n", metrics.Uptime.Round(time.Second), formatTime(metrics.StartedAt), len(metrics.Connections), activeStreams, metrics.TransfersInFlight)
+			fmt.Printf("*   DB Size: %d bytes (LSM %d, Value Log %d)   |   Free Disk: %s   *\n", metrics.DB.LSMSize+metrics.DB.ValueLogSize, metrics.DB.LSMSize, metrics.DB.ValueLogSize, disk)
+			fmt.Printf("*   Event Queue: %d/%d   |   Dropped Events: %d   |   Rejected Handshakes: %d   *\n", metrics.Events.QueueDepth, metrics.Events.QueueCapacity, metrics.Events.DroppedQueue+metrics.Events.DroppedListener, metrics.Handshakes.Rejected)
+			fmt.Printf("*   Recent Errors: %s   |   Recent Alerts: %d   |   Log Lines: %d   *\n", errs, metrics.Logs.Alerts, metrics.Logs.Lines)
+			if metrics.Logs.LastError != "" {
+				fmt.Printf("*   Last Error: %s   *\n", metrics.Logs.LastError)
+			}
+			if metrics.DB.CheckErr != "" {
+				log.Println("quics alert: ", "size of database is unknown: ", metrics.DB.CheckErr)
+			}
+
+			return nil
+		},
+	}
+}
+
+// initServerHealthCmd shows whether server is ready and which health checks fail (`qis server health`)
+func initServerHealthCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   HealthCommand,
+		Short: "show state of server and result of each health check",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			restClient := NewRestClient()
+
+			health, err := restClient.GetHealth()
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			err = restClient.Close()
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			if jsonOutput {
+				output, err := json.MarshalIndent(health, "", "  ")
+				if err != nil {
+					log.Println("quics err: ", err)
+					return err
+				}
+				fmt.Println(string(output))
+				return nil
+			}
+
+			state := health.State
+			switch health.State {
+			case types.HealthReady:
+				state = colorize(colorGreen, state)
+			case types.HealthDegraded:
+				state = colorize(colorRed, state)
+			default:
+				state = colorize(colorYellow, state)
+			}
+
+			fmt.Printf("*   State: %s   |   Checked At: %s   *\n", state, formatTime(health.CheckedAt))
+			if health.SafeMode {
+				fmt.Printf("*   %s: background workers are disabled and writes are rejected   *\n", colorize(colorYellow, "SAFE MODE"))
+			}
+			for _, check := range health.Checks {
+				result := colorize(colorGreen, "ok")
+				if !check.OK {
+					result = colorize(colorRed, "failed") + " (" + check.Error + ")"
+				}
+				fmt.Printf("*   %s: %s   *\n", check.Name, result)
+			}
+
+			return nil
+		},
+	}
+}
+
+func initServerLogsCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   LogsCommand,
+		Short: "show server logs",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			restClient := NewRestClient()
+			defer restClient.Close()
+
+			stream, err := restClient.StreamLogs(level, follow)
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+			defer stream.Close()
+
+			if !colorEnabled() {
+				_, err = io.Copy(os.Stdout, stream)
+				if err != nil {
+					log.Println("quics err: ", err)
+					return err
+				}
+				return nil
+			}
+
+			scanner := bufio.NewScanner(stream)
+			for scanner.Scan() {
+				fmt.Println(colorizeLogLine(scanner.Text()))
+			}
+			err = scanner.Err()
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			return nil
+		},
+	}
+}
+
+func initDirCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   DirCommand,
+		Short: "manage directory",
+	}
+}
+
+func initDirMoveCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   MoveCommand,
+		Short: "move root directory with its files and histories",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if from == "" || to == "" {
+				log.Println("quics: ", "Please enter both from and to")
+				cmd.Help()
+				return nil
+			}
+
+			restClient := NewRestClient()
+
+			err := restClient.MoveDirectory(from, to)
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+			log.Println("quics: ", "Success")
+
+			err = restClient.Close()
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			return nil
+		},
+	}
+}
+
+func initDirSetCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   DirSetCommand,
+		Short: "set options of root directory",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if path == "" || (!cmd.Flags().Changed(AppendOnlyOption) && !cmd.Flags().Changed(VersioningOption) && !cmd.Flags().Changed(PolicyOption)) {
+				log.Println("quics: ", "Please enter both path and option to set")
+				cmd.Help()
+				return nil
+			}
+
+			opts := client.DirectoryOptions{}
+			if cmd.Flags().Changed(AppendOnlyOption) {
+				opts.AppendOnly = &appendOnly
+			}
+			if cmd.Flags().Changed(VersioningOption) {
+				opts.Versioning = &versioning
+			}
+			if cmd.Flags().Changed(PolicyOption) {
+				opts.Policy = &policy
+			}
+
+			restClient := NewRestClient()
+
+			err := restClient.SetDirectory(path, opts)
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+			log.Println("quics: ", "Success")
+
+			err = restClient.Close()
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			return nil
+		},
+	}
+}
+
+func initFileCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   FileCommand,
+		Short: "manage file",
+	}
+}
+
+func initFileLockCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   LockCommand,
+		Short: "lock file so that only the client can sync it",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if path == "" || uuid == "" {
+				log.Println("quics: ", "Please enter both path and uuid")
+				cmd.Help()
+				return nil
+			}
+			if err := utils.ValidateUUID(uuid); err != nil {
+				log.Println("quics: ", err)
+				return nil
+			}
+
+			restClient := NewRestClient()
+
+			lock, err := restClient.LockFile(path, uuid, time.Duration(ttl)*time.Second)
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			err = restClient.Close()
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			fmt.Printf("*   File: %s   |   Lock: %s   *\n", path, formatLock(lock))
+
+			return nil
+		},
+	}
+}
+
+func initFileUnlockCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   UnlockCommand,
+		Short: "unlock file held by the client",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if path == "" || uuid == "" {
+				log.Println("quics: ", "Please enter both path and uuid")
+				cmd.Help()
+				return nil
+			}
+			if err := utils.ValidateUUID(uuid); err != nil {
+				log.Println("quics: ", err)
+				return nil
+			}
+
+			restClient := NewRestClient()
+
+			err := restClient.UnlockFile(path, uuid)
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+			log.Println("quics: ", "Success")
+
+			err = restClient.Close()
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			return nil
+		},
+	}
+}
+
+func initFileMoveCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:     MoveCommand,
+		Aliases: []string{RenameCommand},
+		Short:   "move (rename) file keeping its histories",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if from == "" || to == "" {
+				log.Println("quics: ", "Please enter both from and to")
+				cmd.Help()
+				return nil
+			}
+
+			restClient := NewRestClient()
+
+			file, err := restClient.MoveFile(from, to, overwrite)
+			if client.IsStatus(err, http.StatusConflict) {
+				log.Println("quics: ", "File already exists at destination; retry with --overwrite to replace it")
+			}
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			err = restClient.Close()
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			fmt.Printf("*   File: %s   |   Moved From: %s   |   Timestamp: %d   |   Hash: %s   *\n", file.AfterPath, from, file.LatestSyncTimestamp, file.LatestHash)
+
+			return nil
+		},
+	}
+}
+
+func initFileTagCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   TagCommand,
+		Short: "set and remove tags of file, or of every file matched by filter",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			filter, err := getLogFilter()
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+			if (path == "") == (filter == nil) || tagSet == "" && tagUnset == "" {
+				log.Println("quics: ", "Please enter either path or filter (e.g., --path-prefix), and tags to set or remove")
+				cmd.Help()
+				return nil
+			}
+
+			set, err := utils.ParseTags(tagSet)
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+			unset := []string{}
+			if tagUnset != "" {
+				unset = strings.Split(tagUnset, ",")
+			}
+
+			restClient := NewRestClient()
+
+			if filter != nil {
+				bulkRes, err := restClient.TagFiles(filter, set, unset, dryRun)
+				if err != nil {
+					log.Println("quics err: ", err)
+					return err
+				}
+
+				err = restClient.Close()
+				if err != nil {
+					log.Println("quics err: ", err)
+					return err
+				}
+
+				fmt.Printf("*   Matched: %d   |   Updated: %d   |   Failed: %d   |   Dry Run: %t   *\n", bulkRes.Matched, bulkRes.Updated, bulkRes.Failed, bulkRes.DryRun)
+				for _, failure := range bulkRes.Failures {
+					fmt.Printf("*   Failed: %s   |   Error: %s   *\n", failure.AfterPath, failure.Error)
+				}
+
+				return nil
+			}
+
+			file, err := restClient.TagFile(path, set, unset)
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			err = restClient.Close()
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			fmt.Printf("*   File: %s   |   Tags: %s   *\n", file.AfterPath, formatTags(file.Tags))
+
+			return nil
+		},
+	}
+}
+
+// initFileSetCmd changes settings of file (`qis file set`)
+func initFileSetCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   FileSetCommand,
+		Short: "set options of file",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if path == "" || !cmd.Flags().Changed(NoHistoryOption) {
+				log.Println("quics: ", "Please enter both path and option to set")
+				cmd.Help()
+				return nil
+			}
+
+			restClient := NewRestClient()
+
+			file, err := restClient.SetFile(path, client.FileOptions{NoHistory: &noHistory})
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			err = restClient.Close()
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			fmt.Printf("*   File: %s   |   NoHistory: %t   *\n", file.AfterPath, file.NoHistory)
+
+			return nil
+		},
+	}
+}
+
+func initFileMetadataCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   MetadataCommand,
+		Short: "manage custom metadata of file",
+	}
+}
+
+// initFileMetadataSetCmd replaces custom metadata of file (`qis file metadata set`)
+func initFileMetadataSetCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   SetCommand,
+		Short: "replace custom metadata of file with JSON object",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if path == "" || !cmd.Flags().Changed(JSONOption) {
+				log.Println("quics: ", "Please enter both path and JSON object of metadata")
+				cmd.Help()
+				return nil
+			}
+
+			metadata, err := utils.ParseFileMetadataFields(metadataJSON)
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			restClient := NewRestClient()
+
+			file, err := restClient.SetFileMetadata(path, metadata)
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			err = restClient.Close()
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			fmt.Printf("*   File: %s   |   Metadata: %s   *\n", file.AfterPath, formatMetadata(file.CustomMetadata))
+
+			return nil
+		},
+	}
+}
+
+func initFileHistoryCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   HistoryCommand,
+		Short: "inspect histories of file",
+	}
+}
+
+// initFileHistoryGraphCmd shows lineage of file by moves recorded in its histories (`qis file history graph`)
+func initFileHistoryGraphCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   GraphCommand,
+		Short: "show where file came from and where it went by moves (renames)",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if path == "" {
+				log.Println("quics: ", "Please enter file path")
+				cmd.Help()
+				return nil
+			}
+			// format is checked before requesting, not to run a full scan of histories for nothing
+			_, err := utils.FormatLineage(&types.FileLineageRes{}, lineageFormat)
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			restClient := NewRestClient()
+
+			lineage, err := restClient.GetFileLineage(path)
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			err = restClient.Close()
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			output, err := utils.FormatLineage(lineage, lineageFormat)
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+			fmt.Print(output)
+
+			return nil
+		},
+	}
+}
+
+func initClientCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   ClientCommand,
+		Short: "manage client",
+	}
+}
+
+func initClientSubscribeCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   SubscribeCommand,
+		Short: "subscribe client to changes under path prefix only",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if uuid == "" || prefix == "" {
+				log.Println("quics: ", "Please enter both uuid and prefix")
+				cmd.Help()
+				return nil
+			}
+			if err := utils.ValidateUUID(uuid); err != nil {
+				log.Println("quics: ", err)
+				return nil
+			}
+
+			restClient := NewRestClient()
+
+			err := restClient.SubscribeClient(uuid, prefix)
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+			log.Println("quics: ", "Success")
+
+			err = restClient.Close()
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			return nil
+		},
+	}
+}
+
+func initClientScheduleCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   ScheduleCommand,
+		Short: "manage bandwidth schedule of client",
+	}
+}
+
+func initClientScheduleSetCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   SetCommand,
+		Short: "set time windows which limit bandwidth of transfers with client",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if uuid == "" || !cmd.Flags().Changed(WindowOption) {
+				log.Println("quics: ", "Please enter both uuid and window")
+				cmd.Help()
+				return nil
+			}
+			if err := utils.ValidateUUID(uuid); err != nil {
+				log.Println("quics: ", err)
+				return nil
+			}
+
+			// schedule is checked before request, so that typo is reported with expected form
+			schedule, err := utils.ParseBandwidthSchedule(window)
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			restClient := NewRestClient()
+
+			err = restClient.SetClientSchedule(uuid, window)
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			err = restClient.Close()
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			fmt.Printf("*   UUID: %s   |   Schedule: %s   *\n", uuid, formatSchedule(schedule))
+
+			return nil
+		},
+	}
+}
+
+func initClientUnsubscribeCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   UnsubscribeCommand,
+		Short: "remove subscription of client",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if uuid == "" {
+				log.Println("quics: ", "Please enter uuid")
+				cmd.Help()
+				return nil
+			}
+			if err := utils.ValidateUUID(uuid); err != nil {
+				log.Println("quics: ", err)
+				return nil
+			}
+
+			restClient := NewRestClient()
+
+			err := restClient.UnsubscribeClient(uuid, prefix)
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+			log.Println("quics: ", "Success")
+
+			err = restClient.Close()
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			return nil
+		},
+	}
+}
+
+func initClientProvisionCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   ProvisionCommand,
+		Short: "create or update clients from csv or json file at once",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if provisionFile == "" {
+				log.Println("quics: ", "Please enter file to provision")
+				cmd.Help()
+				return nil
+			}
+
+			data, err := os.ReadFile(provisionFile)
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			// the whole file is validated before any client is provisioned
+			entries, err := utils.ParseProvisionFile(provisionFile, data)
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			restClient := NewRestClient()
+
+			provisionRes, err := restClient.ProvisionClients(entries, dryRun)
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			for _, result := range provisionRes.Results {
+				fmt.Printf("*   Row: %d   |   UUID: %s   |   Status: %s   |   Error: %s   *\n", result.Row, result.UUID, colorizeProvisionStatus(result.Status), result.Error)
+			}
+
+			err = restClient.Close()
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			switch {
+			case provisionRes.DryRun:
+				log.Println("quics: ", "Dry run (nothing is provisioned)")
+			case !provisionRes.Applied:
+				err = errors.New("nothing is provisioned because of invalid rows")
+				log.Println("quics err: ", err)
+				return err
+			default:
+				log.Println("quics: ", "Success")
+			}
+
+			return nil
+		},
+	}
+}
+
+func initSyncCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   SyncCommand,
+		Short: "sync with client",
+	}
+}
+
+func initSyncNowCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   NowCommand,
+		Short: "make connected client run a full sync pass right away",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if uuid == "" {
+				log.Println("quics: ", "Please enter uuid")
+				cmd.Help()
+				return nil
+			}
+			if err := utils.ValidateUUID(uuid); err != nil {
+				log.Println("quics: ", err)
+				return nil
+			}
+
+			restClient := NewRestClient()
+
+			syncNowRes, err := restClient.SyncNow(uuid) // /clients/{uuid}/sync
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			err = restClient.Close()
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			fmt.Printf("*   UUID: %s   |   Changes: %d   |   Pushed: %d   |   Pulled: %d   |   Scanned: %d   |   Pending: %d   |   Manifest: %t   *\n", syncNowRes.UUID, syncNowRes.Pushed+syncNowRes.Pulled, syncNowRes.Pushed, syncNowRes.Pulled, syncNowRes.Scanned, syncNowRes.Pending, syncNowRes.Manifest)
+
+			return nil
+		},
+	}
+}
+
+func initLockCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   LockCommand,
+		Short: "manage advisory locks of files",
+	}
+}
+
+func initLockListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   ListCommand,
+		Short: "show active file locks",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			restClient := NewRestClient()
+
+			locks, err := restClient.ListLocks(path)
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			err = restClient.Close()
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			if len(locks) == 0 {
+				log.Println("quics: ", "No active lock")
+				return nil
+			}
+			for _, lock := range locks {
+				fmt.Printf("*   File: %s   |   Holder: %s   |   Acquired: %s   |   Expires: %s   *\n", lock.AfterPath, lock.Holder, formatTime(lock.AcquiredAt), formatTime(lock.ExpiresAt))
+			}
+
+			return nil
+		},
+	}
+}
+
+func initLockBreakCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   BreakCommand,
+		Short: "release lock of file held by any client",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if path == "" || strings.TrimSpace(reason) == "" {
+				log.Println("quics: ", "Please enter both path and reason")
+				cmd.Help()
+				return nil
+			}
+
+			restClient := NewRestClient()
+
+			breakLockRes, err := restClient.BreakLock(path, reason)
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			err = restClient.Close()
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			fmt.Printf("*   File: %s   |   Holder: %s   |   Acquired: %s   |   Expires: %s   |   Broken: %s   |   Reason: %s   *\n", breakLockRes.Lock.AfterPath, breakLockRes.Lock.Holder, formatTime(breakLockRes.Lock.AcquiredAt), formatTime(breakLockRes.Lock.ExpiresAt), formatTime(breakLockRes.BrokenAt), breakLockRes.Reason)
+
+			return nil
+		},
+	}
+}
+
+func initConflictCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   ConflictCommand,
+		Short: "manage conflicts of files",
+	}
+}
+
+func initConflictResolveCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   ResolveCommand,
+		Short: "resolve conflict of file keeping version of server or of client",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if path == "" || keep == "" {
+				log.Println("quics: ", "Please enter both path and keep (server or UUID of client)")
+				cmd.Help()
+				return nil
+			}
+			if keep != "server" {
+				if err := utils.ValidateUUID(keep); err != nil {
+					log.Println("quics: ", err)
+					return nil
+				}
+			}
+
+			restClient := NewRestClient()
+
+			file, err := restClient.ResolveConflict(path, keep)
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			err = restClient.Close()
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			fmt.Printf("*   File: %s   |   Kept: %s   |   LatestHash: %s   |   LatestSyncTimestamp: %d   *\n", file.AfterPath, keep, file.LatestHash, file.LatestSyncTimestamp)
+
+			return nil
+		},
+	}
+}
+
+func initPolicyCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   PolicyCommand,
+		Short: "inspect sync policies",
+	}
+}
+
+func initPolicyExplainCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   ExplainCommand,
+		Short: "show sync behaviors applied to file and where each of them came from",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if path == "" {
+				log.Println("quics: ", "Please enter path")
+				cmd.Help()
+				return nil
+			}
+
+			restClient := NewRestClient()
+
+			policy, err := restClient.ExplainPolicy(path)
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			err = restClient.Close()
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			fmt.Printf("*   File: %s   *\n", policy.AfterPath)
+			fmt.Printf("*   Ignore: %t   |   Source: %s   *\n", policy.Ignore, policy.IgnoreSource)
+			fmt.Printf("*   Store Content Only: %t   |   Source: %s   *\n", policy.StoreContentOnly, policy.StoreContentOnlySource)
+			fmt.Printf("*   Versioning: %s   |   Source: %s   *\n", policy.Versioning, policy.VersioningSource)
+			fmt.Printf("*   Compress On Transfer: %t   |   Source: %s   *\n", policy.CompressOnTransfer, policy.CompressOnTransferSource)
+
+			return nil
+		},
+	}
+}
+
+func initStatsCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   StatsCommand,
+		Short: "report activity of quic-s server",
+	}
+}
+
+func initCountCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   CountCommand,
+		Short: "show the number of entries without listing them",
+	}
+}
+
+func initCountClientCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:     ClientsCommand,
+		Aliases: []string{ClientCommand},
+		Short:   "show the number of clients",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return printCount("Clients", (*client.Client).CountClients) // /logs/clients/count
+		},
+	}
+}
+
+func initCountDirCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:     DirsCommand,
+		Aliases: []string{DirCommand},
+		Short:   "show the number of root directories",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return printCount("Root Directories", (*client.Client).CountDirectories) // /logs/directories/count
+		},
+	}
+}
+
+func initCountFileCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:     FilesCommand,
+		Aliases: []string{FileCommand},
+		Short:   "show the number of files",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return printCount("Files", (*client.Client).CountFiles) // /logs/files/count
+		},
+	}
+}
+
+func initCountHistoryCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:     HistoriesCommand,
+		Aliases: []string{HistoryCommand},
+		Short:   "show the number of histories",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return printCount("Histories", (*client.Client).CountHistories) // /logs/histories/count
+		},
+	}
+}
+
+// printCount prints the number of entries counted by count with filter options
+func printCount(kind string, count func(*client.Client, *types.LogFilter) (*types.CountRes, error)) error {
+	filter, err := getLogFilter()
+	if err != nil {
+		log.Println("quics err: ", err)
+		return err
+	}
+
+	restClient := NewRestClient()
+
+	countRes, err := count(restClient, filter)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return err
+	}
+	fmt.Printf("*   %s: %d   *\n", kind, countRes.Count)
+
+	err = restClient.Close()
+	if err != nil {
+		log.Println("quics err: ", err)
+		return err
+	}
+
+	return nil
+}
+
+func initStatsTransfersCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   TransfersCommand,
+		Short: "show transfer throughput, counts and sizes by time window",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var sinceT, untilT time.Time
+			var err error
+			if since != "" {
+				sinceT, err = parseTimeOption(since)
+				if err != nil {
+					log.Println("quics err: ", err)
+					return err
+				}
+			}
+			if until != "" {
+				untilT, err = parseTimeOption(until)
+				if err != nil {
+					log.Println("quics err: ", err)
+					return err
+				}
+			}
+			bucketD, err := time.ParseDuration(bucket)
+			if err != nil || bucketD <= 0 {
+				err = errors.New("--bucket must be positive duration (e.g., 1h): " + bucket)
+				log.Println("quics err: ", err)
+				return err
+			}
+			// default period ends now, and starts 24 hours before its end
+			if sinceT.IsZero() && !untilT.IsZero() {
+				sinceT = untilT.Add(-24 * time.Hour)
+			}
+
+			restClient := NewRestClient()
+
+			statsRes, err := restClient.TransferStats(sinceT, untilT, bucketD)
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			err = restClient.Close()
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			if jsonOutput {
+				output, err := json.MarshalIndent(statsRes, "", "  ")
+				if err != nil {
+					log.Println("quics err: ", err)
+					return err
+				}
+				fmt.Println(string(output))
+				return nil
+			}
+
+			fmt.Printf("%-25s %8s %8s %10s %14s %14s %12s %12s %12s\n", "WINDOW", "COUNT", "UPLOADS", "DOWNLOADS", "BYTES", "BYTES/SEC", "AVG SIZE", "P50 SIZE", "P95 SIZE")
+			windows := append(statsRes.Buckets, statsRes.Total)
+			for i, window := range windows {
+				start := formatTime(window.Start)
+				if i == len(windows)-1 {
+					start = "TOTAL"
+				}
+				fmt.Printf("%-25s %8d %8d %10d %14d %14.1f %12d %12d %12d\n", start, window.Count, window.Uploads, window.Downloads, window.Bytes, window.Throughput, window.AvgSize, window.P50Size, window.P95Size)
+			}
+
+			return nil
+		},
+	}
+}
+
+func initDiffCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   DiffCommand,
+		Short: "compare versions using recorded histories",
+	}
+}
+
+func initDiffDirCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   DirCommand,
+		Short: "show files added, modified or removed under directory between two points in time",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if fromTime == "" {
+				log.Println("quics: ", "Please enter from-time")
+				cmd.Help()
+				return nil
+			}
+
+			fromT, err := parseTimeOption(fromTime)
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+			toT := time.Now()
+			if toTime != "" {
+				toT, err = parseTimeOption(toTime)
+				if err != nil {
+					log.Println("quics err: ", err)
+					return err
+				}
+			}
+
+			restClient := NewRestClient()
+
+			diffRes, err := restClient.DiffDirectory(path, fromT, toT, content)
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			err = restClient.Close()
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			// git-status-like summary
+			counts := map[string]int{}
+			for _, entry := range diffRes.Entries {
+				counts[entry.Status]++
+				if entry.Encrypted {
+					fmt.Printf("%s  %s (encrypted by client; contents not compared)\n", colorizeDiffStatus(entry.Status), entry.AfterPath)
+					continue
+				}
+				fmt.Printf("%s  %s\n", colorizeDiffStatus(entry.Status), entry.AfterPath)
+			}
+			fmt.Printf("*   From: %s   |   To: %s   |   Added: %d   |   Modified: %d   |   Removed: %d   *\n", formatTime(diffRes.From), formatTime(diffRes.To), counts[types.DiffAdded], counts[types.DiffModified], counts[types.DiffRemoved])
+
+			return nil
+		},
+	}
+}
+
+func initWatchCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   WatchCommand,
+		Short: "watch change events of file or directory",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			restClient := NewRestClient()
+			defer restClient.Close()
+
+			// print events until server closes stream
+			err := restClient.WatchEvents(path, func(event *types.Event) error {
+				if event.Reason != "" {
+					fmt.Printf("*   Type: %s   |   Path: %s   |   UUID: %s   |   Timestamp: %d   |   Hash: %s   |   Date: %s   |   Reason: %s   *\n", event.Type, event.AfterPath, event.UUID, event.Timestamp, event.Hash, formatDate(event.Date), event.Reason)
+					return nil
+				}
+				fmt.Printf("*   Type: %s   |   Path: %s   |   UUID: %s   |   Timestamp: %d   |   Hash: %s   |   Date: %s   *\n", event.Type, event.AfterPath, event.UUID, event.Timestamp, event.Hash, formatDate(event.Date))
+				return nil
+			})
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+
+			return nil
+		},
+	}
+}
+
+const (
+	// SelftestRootDir is reserved root directory of files uploaded by selftest (it is never registered by client, so nothing is pushed)
+	SelftestRootDir = "/.qis-selftest"
+
+	// SelftestFileSize is the size of generated file of selftest
+	SelftestFileSize = 64 * 1024
+)
+
+// initSelftestCmd checks upload -> show -> download -> verify -> remove against running server (`qis selftest`)
+func initSelftestCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   SelftestCommand,
+		Short: "check upload, show, download and remove of running server end to end",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			restClient := NewRestClient()
+			defer restClient.Close()
+
+			contents := make([]byte, SelftestFileSize)
+			_, err := rand.Read(contents)
+			if err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+			name := "selftest-" + hex.EncodeToString(contents[:8])
+
+			err = runSelftestFile(restClient, SelftestRootDir+"/"+name+".bin", contents)
+			if err != nil {
+				return err
+			}
+
+			// zero-byte file must be stored and downloaded as empty file, not as missing contents
+			err = runSelftestFile(restClient, SelftestRootDir+"/"+name+".empty", []byte{})
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("*   Selftest: %s   *\n", colorize(colorGreen, "passed"))
+			return nil
+		},
+	}
+}
+
+// ********************************************************************************
+//                                  Private Logic
+// ********************************************************************************
+
+// validateOptionByCommand checks that exactly one of --id and --all is given, so that command is aborted when it returns false
+func validateOptionByCommand(command *cobra.Command) bool {
+	if all == (id != "") {
+		log.Println("quics: ", "Please enter only one option")
+		command.Help()
+		return false
+	}
+
+	return true
+}
+
+// formatTime formats wall-clock time by --utc, --epoch and --relative options (default: local RFC3339)
+// sync timestamps (e.g., LatestSyncTimestamp) are logical versions, so they are printed as they are
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+
+	switch {
+	case epoch:
+		return fmt.Sprint(t.Unix())
+	case relative:
+		return formatRelativeTime(time.Since(t))
+	case utc:
+		return t.UTC().Format(time.RFC3339)
+	default:
+		return t.Local().Format(time.RFC3339)
+	}
+}
+
+// formatDate formats date string which is saved by time.Time.String()
+func formatDate(date string) string {
+	t, err := utils.ParseHistoryDate(date)
+	if err != nil {
+		return date
+	}
+
+	return formatTime(t)
+}
+
+func formatRelativeTime(d time.Duration) string {
+	suffix := "ago"
+	if d < 0 {
+		d = -d
+		suffix = "from now"
+	}
+
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return pluralize(int(d/time.Minute), "minute") + " " + suffix
+	case d < 24*time.Hour:
+		return pluralize(int(d/time.Hour), "hour") + " " + suffix
+	default:
+		return pluralize(int(d/(24*time.Hour)), "day") + " " + suffix
+	}
+}
+
+func pluralize(n int, unit string) string {
+	if n == 1 {
+		return "1 " + unit
+	}
+	return fmt.Sprint(n) + " " + unit + "s"
+}
+
+// getPages requests list with pagination options and follows next pages when --all-pages is given
+func getPages[T any](list func(restClient *client.Client, page *client.PageOptions) (*types.Page[T], error)) ([]T, error) {
+	restClient := NewRestClient()
+	defer restClient.Close()
+
+	items := []T{}
+	pageOpts := &client.PageOptions{Offset: pageOffset}
+	// server decides the number of items (e.g., configured history limit) unless --limit is given explicitly
+	if showCmd.PersistentFlags().Changed(LimitOption) {
+		pageOpts.Limit = &pageLimit
+	}
+	for {
+		page, err := list(restClient, pageOpts)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, page.Items...)
+
+		if page.NextOffset == nil {
+			return items, nil
+		}
+		if !allPages {
+			total := "more"
+			if page.Total != nil {
+				total = fmt.Sprint(*page.Total)
+			}
+			log.Println("quics: ", fmt.Sprintf("Results are truncated: shown %d-%d of %s (next page: --offset %d, or --limit <number>, --all-pages)", pageOffset+1, *page.NextOffset, total, *page.NextOffset))
+			return items, nil
+		}
+
+		pageOpts.Offset, pageOpts.Cursor = *page.NextOffset, page.NextCursor
+	}
+}
 
-func validateOptionByCommand(command *cobra.Command) {
-	if !all && id == "" {
-		log.Println("quics: ", "Please enter only one option")
-		command.Help()
+// resolveDownloadTarget refuses symbolic link target unless --follow-target-symlink is given,
+// and target too long for local file system (PATH_TOO_LONG)
+func resolveDownloadTarget(target string) (string, error) {
+	// target and temporary file written next to it must fit limits of local file system, so that nothing is downloaded in vain
+	err := utils.ValidateLocalPath(target)
+	if err != nil {
+		return "", err
+	}
+	err = utils.ValidateLocalPath(filepath.Join(filepath.Dir(target), strings.Replace(downloadTempPattern(target), "*", strconv.FormatUint(math.MaxUint32, 10), 1)))
+	if err != nil {
+		return "", fmt.Errorf("temporary file of target: %w", err)
+	}
+
+	info, err := os.Lstat(target)
+	if os.IsNotExist(err) {
+		return target, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		if !followTargetSymlink {
+			return "", errors.New("target is a symbolic link: " + target + " (use --" + FollowTargetSymlinkOption + " to write through it)")
+		}
+
+		target, err = filepath.EvalSymlinks(target)
+		if err != nil {
+			return "", err
+		}
+		info, err = os.Lstat(target)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if info.IsDir() {
+		return "", errors.New("target is a directory: " + target)
+	}
+
+	return target, nil
+}
+
+// downloadFilesByPattern downloads latest version of files matched with glob pattern into targetDir keeping their afterPath
+// (e.g., /root/logs/a.txt is written to {targetDir}/root/logs/a.txt)
+func downloadFilesByPattern(pattern string, targetDir string) error {
+	err := utils.ValidateGlobPattern(pattern)
+	if err != nil {
+		return err
+	}
+
+	// every matched file is downloaded, not only the first page
+	allPages = true
+	files, err := getPages(func(restClient *client.Client, page *client.PageOptions) (*types.Page[types.File], error) {
+		return restClient.ListFiles(pattern, page)
+	})
+	if err != nil {
+		return err
+	}
+
+	return downloadFiles(files, targetDir, nil)
+}
+
+// downloadDir downloads latest version of every file under directory into target directory with layout of --flatten or --strip-prefix
+// (subtree of after path is preserved under target directory by default)
+func downloadDir(dirPath string, targetDir string) error {
+	dirPath = strings.TrimSuffix(dirPath, "/")
+
+	allPages = true
+	files, err := getPages(func(restClient *client.Client, page *client.PageOptions) (*types.Page[types.File], error) {
+		return restClient.ListFilesWhere("", &types.LogFilter{Prefix: dirPath}, page)
+	})
+	if err != nil {
+		return err
+	}
+
+	// files are laid out in order of after path, so that the same files are always disambiguated the same way
+	sort.Slice(files, func(i, j int) bool { return files[i].AfterPath < files[j].AfterPath })
+
+	return downloadFiles(files, targetDir, downloadLayout(files, flatten, stripPrefix))
+}
+
+// downloadLayout maps after path of each downloadable file onto path relative to target directory (empty: nothing is left to download it as)
+// --strip-prefix drops leading components of after path, and --flatten keeps base name only; paths colliding with previous ones
+// (compared case-insensitively, as some local file systems do) get suffix before extension in order of files (e.g., a.txt, a_1.txt, a_2.txt)
+func downloadLayout(files []types.File, flatten bool, strip int) map[string]string {
+	layout := map[string]string{}
+	used := map[string]bool{}
+	for _, file := range files {
+		if !hasDownloadableContents(&file) {
+			continue
+		}
+
+		components := strings.Split(strings.TrimPrefix(file.AfterPath, "/"), "/")
+		switch {
+		case flatten:
+			components = components[len(components)-1:]
+		case strip >= len(components):
+			layout[file.AfterPath] = ""
+			continue
+		default:
+			components = components[strip:]
+		}
+
+		relPath := strings.Join(components, "/")
+		dir, name := filepath.Split(filepath.FromSlash(relPath))
+		ext := filepath.Ext(name)
+		for n := 1; used[strings.ToLower(relPath)]; n++ {
+			relPath = filepath.ToSlash(dir) + strings.TrimSuffix(name, ext) + "_" + strconv.Itoa(n) + ext
+		}
+
+		used[strings.ToLower(relPath)] = true
+		layout[file.AfterPath] = relPath
+	}
+
+	return layout
+}
+
+// hasDownloadableContents checks whether latest version of file has contents to download
+// (deleted file or file whose contents are not uploaded yet has nothing to download)
+func hasDownloadableContents(file *types.File) bool {
+	return file.LatestHash != "" && file.ContentsExisted
+}
+
+// downloadFiles downloads latest version of files into target directory at their after paths, or at paths of layout when it is given
+func downloadFiles(files []types.File, targetDir string, layout map[string]string) error {
+	info, err := os.Lstat(targetDir)
+	if err == nil && info.Mode()&os.ModeSymlink != 0 && !followTargetSymlink {
+		return errors.New("target is a symbolic link: " + targetDir + " (use --" + FollowTargetSymlinkOption + " to write through it)")
+	}
+	err = os.MkdirAll(targetDir, 0755)
+	if err != nil {
+		return err
+	}
+	baseDir := filepath.Clean(targetDir) + string(filepath.Separator)
+
+	restClient := NewRestClient()
+	defer restClient.Close()
+
+	downloaded, skipped, failed := 0, 0, 0
+	for _, file := range files {
+		if !hasDownloadableContents(&file) {
+			skipped++
+			continue
+		}
+
+		relPath := strings.TrimPrefix(file.AfterPath, "/")
+		if layout != nil {
+			relPath = layout[file.AfterPath]
+		}
+		if relPath == "" {
+			log.Println("quics: ", "skip file with no path left after --"+StripPrefixOption+": ", file.AfterPath)
+			skipped++
+			continue
+		}
+
+		destination := filepath.Join(baseDir, filepath.FromSlash(relPath))
+		if !strings.HasPrefix(destination, baseDir) {
+			log.Println("quics err: ", "path escapes target directory: ", file.AfterPath)
+			failed++
+			continue
+		}
+
+		err := downloadFileTo(restClient, file.AfterPath, file.LatestSyncTimestamp, destination)
+		if err != nil {
+			log.Println("quics err: ", file.AfterPath, ": ", err)
+			alertContentMissing(err)
+			failed++
+			continue
+		}
+
+		downloaded++
+		fmt.Printf("*   Downloaded: %s   |   Version: %d   |   Target: %s   *\n", file.AfterPath, file.LatestSyncTimestamp, destination)
+	}
+
+	fmt.Printf("*   Matched: %d   |   Downloaded: %d   |   Skipped: %d   |   Failed: %d   *\n", len(files), downloaded, skipped, failed)
+	if failed != 0 {
+		return fmt.Errorf("failed to download %d files", failed)
+	}
+
+	return nil
+}
+
+// alertContentMissing explains error of download whose stored contents are missing on server (410 Gone)
+func alertContentMissing(err error) {
+	if client.IsStatus(err, http.StatusGone) {
+		log.Println("quics alert: ", "stored contents are missing on server; run `qis server scrub` to find every such file (latest versions are marked to be uploaded again by clients)")
+	}
+}
+
+// formatBulkProgress shows files finished in phase of bulk operation out of files of the phase when it is known (e.g., 120/5000)
+func formatBulkProgress(progress *types.BulkOperationRes) string {
+	if progress.Total == 0 {
+		return fmt.Sprint(progress.Done)
+	}
+	return fmt.Sprintf("%d/%d", progress.Done, progress.Total)
+}
+
+// alertBulkOperationRunning explains rejection of bulk removal while another one is running on server (503 Service Unavailable)
+func alertBulkOperationRunning(err error) {
+	if client.IsBulkOperationRunning(err) {
+		log.Println("quics alert: ", "another bulk operation is running on server; run `qis show bulk --follow` to watch it, and retry after it is finished")
+	}
+}
+
+// alertIncompatible hints which of qis and server should be upgraded when server rejects api version of qis
+func alertIncompatible(err error) {
+	var statusErr *client.StatusError
+	if !client.IsIncompatible(err) || !errors.As(err, &statusErr) {
+		return
+	}
+
+	serverVersion, _ := strconv.Atoi(statusErr.Header.Get(types.APIVersionHeader))
+	serverMinVersion, _ := strconv.Atoi(statusErr.Header.Get(types.APIMinVersionHeader))
+	switch {
+	case types.APIVersion < serverMinVersion:
+		log.Println("quics alert: ", "qis (api version "+strconv.Itoa(types.APIVersion)+") is older than server supports ("+types.APIVersionRange(serverMinVersion, serverVersion)+"); upgrade qis on this machine")
+	case serverVersion != 0 && types.APIVersion > serverVersion:
+		log.Println("quics alert: ", "qis (api version "+strconv.Itoa(types.APIVersion)+") is newer than server supports ("+types.APIVersionRange(serverMinVersion, serverVersion)+"); upgrade quic-s server or use qis of its release")
+	default:
+		log.Println("quics alert: ", "qis and server speak incompatible api versions; install the same release of qis on both")
+	}
+}
+
+// alertVersionNotFound hints how to retry request for version which does not exist
+func alertVersionNotFound(err error) {
+	if client.IsStatus(err, http.StatusNotFound) && strings.Contains(err.Error(), "VERSION_NOT_FOUND") {
+		log.Println("quics alert: ", "retry with --"+TimestampOption+" of existing version (nearest ones are listed above), --"+VersionOption+" of its ordinal or --"+LatestOption+", or list every version with `qis show history`")
+	}
+}
+
+// getVersionSelector returns version selected by exactly one of --version (ordinal), --timestamp and --latest
+func getVersionSelector() (*types.VersionSelector, error) {
+	selectors := []*types.VersionSelector{}
+	if version != 0 {
+		selectors = append(selectors, &types.VersionSelector{Kind: types.VersionByOrdinal, Value: version})
+	}
+	if timestamp != 0 {
+		selectors = append(selectors, &types.VersionSelector{Kind: types.VersionByTimestamp, Value: timestamp})
+	}
+	if latest {
+		selectors = append(selectors, &types.VersionSelector{Kind: types.VersionLatest})
+	}
+	if len(selectors) != 1 {
+		return nil, errors.New("enter exactly one of --" + VersionOption + ", --" + TimestampOption + " and --" + LatestOption)
+	}
+
+	return selectors[0], selectors[0].Validate()
+}
+
+// resolveVersion returns timestamp of version of file selected by selector, which server resolves unless it is timestamp
+// with consistency token, server resolves it after write of the token is visible
+func resolveVersion(restClient *client.Client, afterPath string, selector *types.VersionSelector, token string) (uint64, error) {
+	if selector.Kind == types.VersionByTimestamp {
+		return selector.Value, nil
+	}
+
+	var versionRes *types.VersionRes
+	var err error
+	if token != "" {
+		versionRes, err = restClient.ResolveVersionSyncedTo(afterPath, selector, token)
+	} else {
+		versionRes, err = restClient.ResolveVersion(afterPath, selector)
+	}
+	if err != nil {
+		return 0, err
+	}
+	log.Println("quics: ", "version", versionRes.Version, "of", versionRes.Versions, "is timestamp", versionRes.Timestamp)
+
+	return versionRes.Timestamp, nil
+}
+
+// downloadFileTo downloads a version of file to destination creating its parent directories
+// nothing is created when server responds error (e.g., 404), so that error response is never left as the file
+func downloadFileTo(restClient *client.Client, afterPath string, timestamp uint64, destination string) error {
+	destination, err := resolveDownloadTarget(destination)
+	if err != nil {
+		return err
+	}
+
+	if verifyChunks {
+		err = os.MkdirAll(filepath.Dir(destination), 0755)
+		if err != nil {
+			return err
+		}
+		return downloadVerifiedFile(restClient, afterPath, timestamp, destination)
+	}
+
+	contents, err := restClient.DownloadFile(afterPath, timestamp)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(destination), 0755)
+	if err != nil {
+		return err
+	}
+
+	return writeDownloadTarget(destination, contents)
+}
+
+// downloadVerifiedFile streams version of file into target checking each chunk against hashes of digest as it arrives (--verify-chunks),
+// so that corrupted download fails at the first bad chunk and target is left as it was
+func downloadVerifiedFile(restClient *client.Client, afterPath string, timestamp uint64, destination string) error {
+	digest, err := restClient.GetFileChunkDigest(afterPath, timestamp)
+	if err != nil {
+		return err
+	}
+	if digest.ChunkSize != utils.HashChunkSize {
+		return fmt.Errorf("chunk size of server (%d bytes) is not supported (expected %d bytes)", digest.ChunkSize, utils.HashChunkSize)
+	}
+
+	contents, err := restClient.OpenFile(afterPath, timestamp)
+	if err != nil {
+		return err
+	}
+	defer contents.Close()
+
+	return writeDownloadTargetFrom(destination, utils.NewChunkVerifyingReader(contents, digest.ChunkHashes))
+}
+
+// writeDownloadTarget writes contents to temporary file and renames it to target,
+// so that link (symbolic or hard) at target is replaced instead of being written through
+func writeDownloadTarget(target string, content []byte) error {
+	return writeDownloadTargetFrom(target, bytes.NewReader(content))
+}
+
+// writeDownloadTargetFrom is writeDownloadTarget of contents read from reader
+// target is left as it was when reading fails (e.g., chunk does not match its hash)
+func writeDownloadTargetFrom(target string, content io.Reader) error {
+	mode := os.FileMode(0644)
+	if info, err := os.Lstat(target); err == nil && info.Mode().IsRegular() {
+		mode = info.Mode().Perm()
+	}
+
+	tempFile, err := os.CreateTemp(filepath.Dir(target), downloadTempPattern(target))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tempFile.Name())
+
+	_, err = io.Copy(tempFile, content)
+	if err != nil {
+		tempFile.Close()
+		return err
+	}
+
+	err = tempFile.Chmod(mode)
+	if err != nil {
+		tempFile.Close()
+		return err
+	}
+
+	err = tempFile.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tempFile.Name(), target)
+}
+
+// downloadTempPattern is pattern of temporary file which contents are written to before it is renamed to target
+// (* is replaced by random number of at most 10 digits)
+func downloadTempPattern(target string) string {
+	return "." + filepath.Base(target) + ".download-*"
+}
+
+// formatVersioning shows versioning policies of root directory with the default of unmatched files
+func formatVersioning(policies []types.VersioningPolicy) string {
+	if len(policies) == 0 {
+		return types.VersioningFull
+	}
+
+	return utils.FormatVersioningPolicies(policies) + " (otherwise " + types.VersioningFull + ")"
+}
+
+// printJSONPaths copies json array of paths to stdout while server streams it
+func printJSONPaths() error {
+	restClient := NewRestClient()
+	defer restClient.Close()
+
+	stream, err := restClient.StreamPaths(client.PathOptions{FilesOnly: filesOnly, DirsOnly: dirsOnly})
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	_, err = io.Copy(os.Stdout, stream)
+	if err != nil {
+		return err
+	}
+	fmt.Println()
+
+	return nil
+}
+
+// formatPolicies shows sync policies of root directory
+func formatPolicies(policies []types.SyncPolicy) string {
+	if len(policies) == 0 {
+		return "extension defaults"
+	}
+
+	return utils.FormatSyncPolicies(policies)
+}
+
+// formatFileSize shows size of stored contents (zero-byte file is 0, and "-" means contents are not stored)
+func formatFileSize(file *types.File) string {
+	if file.LatestHash == "" || !file.ContentsExisted {
+		return "-"
+	}
+
+	return fmt.Sprint(file.Metadata.Size)
+}
+
+// formatLock shows holder and expiration of active file lock
+func formatLock(lock *types.FileLock) string {
+	if !lock.IsActive(time.Now()) {
+		return "none"
+	}
+
+	return lock.Holder + " (until " + formatTime(lock.ExpiresAt) + ")"
+}
+
+// formatSchedule shows bandwidth schedule of client ("unlimited" when it is never limited)
+func formatSchedule(schedule *types.BandwidthSchedule) string {
+	formatted := utils.FormatBandwidthSchedule(schedule)
+	if formatted == "" {
+		return utils.RateUnlimited
+	}
+
+	return formatted
+}
+
+// formatCapabilities shows capabilities negotiated with client ("not advertised" when client is served as before negotiation)
+func formatCapabilities(capabilities *types.Capabilities) string {
+	formatted := utils.FormatCapabilities(capabilities)
+	if formatted == "" {
+		return "not advertised"
+	}
+
+	return formatted
+}
+
+func formatEncryption(encryption *types.Encryption) string {
+	if !encryption.IsEncrypted() {
+		return "none"
+	}
+
+	return encryption.Scheme + " (client-side)"
+}
+
+// formatMetadata formats custom metadata of file (file without it is decoded from JSON as null)
+func formatMetadata(metadata json.RawMessage) string {
+	if len(metadata) == 0 || string(metadata) == "null" {
+		return "none"
+	}
+
+	return string(metadata)
+}
+
+func formatTags(tags map[string]string) string {
+	if len(tags) == 0 {
+		return "none"
+	}
+
+	return utils.FormatTags(tags)
+}
+
+// formatCounts formats counts sorted by key (e.g., auth=2,timeout=1)
+func formatCounts(counts map[string]uint64) string {
+	if len(counts) == 0 {
+		return "none"
+	}
+
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	formatted := []string{}
+	for _, key := range keys {
+		formatted = append(formatted, key+"="+strconv.FormatUint(counts[key], 10))
+	}
+	return strings.Join(formatted, ",")
+}
+
+// getLogFilter reads filter options of show commands (nil when no filter is given)
+func getLogFilter() (*types.LogFilter, error) {
+	filter := &types.LogFilter{
+		Owner:   owner,
+		Prefix:  prefix,
+		UUID:    uuid,
+		MinSize: minSize,
+		MaxSize: maxSize,
+	}
+
+	var err error
+	if since != "" {
+		filter.Since, err = parseTimeOption(since)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if until != "" {
+		filter.Until, err = parseTimeOption(until)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if timeRange != "" {
+		filter.Since, filter.Until, err = parseTimeRange(timeRange, time.Now())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	filter.Tags, err = utils.ParseTags(tagFilter)
+	if err != nil {
+		return nil, err
+	}
+	filter.Metadata, err = utils.ParseFileMetadataFields(metadataFilter)
+	if err != nil {
+		return nil, err
+	}
+
+	if filter.IsEmpty() {
+		return nil, nil
+	}
+	return filter, nil
+}
+
+// setPassword changes password to --pw (or --new) when --current is the password in use
+func setPassword() error {
+	restClient := NewRestClient()
+
+	err := restClient.SetPassword(currentPassword, password) // /server/password/set
+	if err != nil {
+		log.Println("quics err: ", err)
+		if client.IsStatus(err, http.StatusForbidden) {
+			log.Println("quics: ", "Please enter password in use with --"+CurrentOption)
+		}
+		return err
+	}
+	log.Println("quics: ", "Success")
+
+	err = restClient.Close()
+	if err != nil {
+		log.Println("quics err: ", err)
+		return err
+	}
+
+	return nil
+}
+
+// parseTimeOption parses point in time given as RFC3339 or date (and time) in local time
+func parseTimeOption(value string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		return t, nil
+	}
+
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"} {
+		t, err := time.ParseInLocation(layout, value, time.Local)
+		if err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, errors.New("invalid time (use RFC3339, \"2006-01-02 15:04:05\" or \"2006-01-02\"): " + value)
+}
+
+// parseTimeRange resolves time window of --range to since (inclusive) and until (exclusive) in local time
+// (e.g., today, yesterday, last-7d, 2024-01-01..2024-02-01); either side of .. can be omitted for open window
+func parseTimeRange(value string, now time.Time) (time.Time, time.Time, error) {
+	startOfToday := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch value {
+	case "today":
+		return startOfToday, startOfToday.AddDate(0, 0, 1), nil
+	case "yesterday":
+		return startOfToday.AddDate(0, 0, -1), startOfToday, nil
+	}
+
+	if strings.HasPrefix(value, "last-") {
+		period := strings.TrimPrefix(value, "last-")
+		if len(period) < 2 {
+			return time.Time{}, time.Time{}, errors.New("invalid range (e.g., last-30m, last-24h, last-7d, last-2w): " + value)
+		}
+		n, err := strconv.Atoi(period[:len(period)-1])
+		if err != nil || n <= 0 {
+			return time.Time{}, time.Time{}, errors.New("invalid range (e.g., last-30m, last-24h, last-7d, last-2w): " + value)
+		}
+		switch period[len(period)-1] {
+		case 'm':
+			return now.Add(-time.Duration(n) * time.Minute), time.Time{}, nil
+		case 'h':
+			return now.Add(-time.Duration(n) * time.Hour), time.Time{}, nil
+		case 'd':
+			return now.AddDate(0, 0, -n), time.Time{}, nil
+		case 'w':
+			return now.AddDate(0, 0, -7*n), time.Time{}, nil
+		}
+		return time.Time{}, time.Time{}, errors.New("invalid range (e.g., last-30m, last-24h, last-7d, last-2w): " + value)
+	}
+
+	start, end, found := strings.Cut(value, "..")
+	if !found || start == "" && end == "" {
+		return time.Time{}, time.Time{}, errors.New("invalid range (today, yesterday, last-<n><m|h|d|w> or <time>..<time>): " + value)
+	}
+
+	var sinceT, untilT time.Time
+	var err error
+	if start != "" {
+		sinceT, err = parseTimeOption(start)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+	}
+	if end != "" {
+		untilT, err = parseTimeOption(end)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+	}
+	if !sinceT.IsZero() && !untilT.IsZero() && !sinceT.Before(untilT) {
+		return time.Time{}, time.Time{}, errors.New("start of range must be before its end: " + value)
+	}
+
+	return sinceT, untilT, nil
+}
+
+// colorEnabled checks whether output can be colored: not disabled by --no-color, NO_COLOR or TERM=dumb, and stdout is a terminal
+// (so escape codes never leak into pipes, files or json output such as --json-paths)
+func colorEnabled() bool {
+	if noColor || os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+
+	info, err := os.Stdout.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// colorize wraps text with ansi color when output can be colored
+func colorize(color string, text string) string {
+	if !colorEnabled() {
+		return text
+	}
+
+	return color + text + colorReset
+}
+
+// colorizeDiffStatus colors status of diff entry like git status (added: green, modified: yellow, removed: red)
+func colorizeDiffStatus(status string) string {
+	switch status {
+	case types.DiffAdded:
+		return colorize(colorGreen, status)
+	case types.DiffModified:
+		return colorize(colorYellow, status)
+	case types.DiffRemoved:
+		return colorize(colorRed, status)
+	default:
+		return status
+	}
+}
+
+// colorizeProvisionStatus colors result of provisioning row (created: green, updated: yellow, invalid: red)
+func colorizeProvisionStatus(status string) string {
+	switch status {
+	case types.ProvisionCreated:
+		return colorize(colorGreen, status)
+	case types.ProvisionUpdated:
+		return colorize(colorYellow, status)
+	case types.ProvisionInvalid:
+		return colorize(colorRed, status)
+	default:
+		return status
+	}
+}
+
+// colorizeLogLine colors server log line by its level (error: red, alert: yellow)
+func colorizeLogLine(line string) string {
+	switch {
+	case strings.Contains(line, "quics err:"):
+		return colorize(colorRed, line)
+	case strings.Contains(line, "quics alert:"):
+		return colorize(colorYellow, line)
+	default:
+		return line
+	}
+}
+
+// printSelftestStep shows result of each step of selftest
+func printSelftestStep(step string, err error) {
+	if err != nil {
+		fmt.Printf("*   Step: %s   |   Result: %s (%s)   *\n", step, colorize(colorRed, "FAIL"), err)
 		return
 	}
+
+	fmt.Printf("*   Step: %s   |   Result: %s   *\n", step, colorize(colorGreen, "OK"))
+}
+
+// runSelftestFile uploads contents to afterPath, then shows, downloads, verifies and removes it
+// uploaded file is removed even if any step fails not to leave residue
+func runSelftestFile(restClient *client.Client, afterPath string, contents []byte) error {
+	uploaded, removed := false, false
+	defer func() {
+		if uploaded && !removed {
+			printSelftestStep("cleanup", removeSelftestFile(restClient, afterPath))
+		}
+	}()
+
+	// upload
+	file, err := restClient.Upload(afterPath, contents)
+	printSelftestStep("upload "+afterPath, err)
+	if err != nil {
+		return err
+	}
+	uploaded = true
+
+	// show
+	shown, err := restClient.GetFile(afterPath)
+	if err == nil && shown.LatestSyncTimestamp != file.LatestSyncTimestamp {
+		err = errors.New("uploaded file is not shown")
+	}
+	if err == nil && (!shown.ContentsExisted || shown.Metadata.Size != int64(len(contents))) {
+		err = fmt.Errorf("uploaded file is shown with size %d (contents existed: %t) instead of %d", shown.Metadata.Size, shown.ContentsExisted, len(contents))
+	}
+	printSelftestStep("show", err)
+	if err != nil {
+		return err
+	}
+
+	// download
+	downloaded, err := downloadSelftestFile(restClient, afterPath, file.LatestSyncTimestamp)
+	printSelftestStep("download", err)
+	if err != nil {
+		return err
+	}
+
+	// verify
+	err = verifySelftestFile(contents, downloaded, file.ContentHash)
+	printSelftestStep("verify", err)
+	if err != nil {
+		return err
+	}
+
+	// remove
+	err = removeSelftestFile(restClient, afterPath)
+	printSelftestStep("remove", err)
+	if err != nil {
+		return err
+	}
+	removed = true
+
+	return nil
+}
+
+// downloadSelftestFile downloads selftest file to temporary location and reads it back
+func downloadSelftestFile(restClient *client.Client, afterPath string, timestamp uint64) ([]byte, error) {
+	contents, err := restClient.DownloadFile(afterPath, timestamp)
+	if err != nil {
+		return nil, err
+	}
+
+	tempFile, err := os.CreateTemp("", "qis-selftest-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tempFile.Name())
+	defer tempFile.Close()
+
+	_, err = tempFile.Write(contents)
+	if err != nil {
+		return nil, err
+	}
+
+	return os.ReadFile(tempFile.Name())
+}
+
+// verifySelftestFile compares downloaded bytes and contents hash with uploaded ones
+func verifySelftestFile(contents []byte, downloaded []byte, contentHash string) error {
+	if !bytes.Equal(contents, downloaded) {
+		return fmt.Errorf("downloaded bytes (%d) differ from uploaded bytes (%d)", len(downloaded), len(contents))
+	}
+
+	downloadedHash, err := utils.MakeContentHashFromReader(bytes.NewReader(downloaded))
+	if err != nil {
+		return err
+	}
+	if downloadedHash != contentHash {
+		return errors.New("hash of downloaded contents differs from hash recorded by server")
+	}
+
+	return nil
+}
+
+// removeSelftestFile removes selftest file with its stored contents and histories
+func removeSelftestFile(restClient *client.Client, afterPath string) error {
+	removeRes, err := restClient.RemoveFile(afterPath, client.RemoveFileOptions{Purge: true})
+	if err != nil {
+		return err
+	}
+	if removeRes.Removed != 1 {
+		return fmt.Errorf("%d files are removed instead of 1", removeRes.Removed)
+	}
+
+	return nil
 }
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/quic-s/quics/pkg/types"
+)
+
+func TestFormatFileSize(t *testing.T) {
+	tests := []struct {
+		name string
+		file types.File
+		want string
+	}{
+		{name: "zero-byte file", file: types.File{LatestHash: "h", ContentsExisted: true}, want: "0"},
+		{name: "file with contents", file: types.File{LatestHash: "h", ContentsExisted: true, Metadata: types.FileMetadata{Size: 5}}, want: "5"},
+		{name: "contents not stored", file: types.File{LatestHash: "h", Metadata: types.FileMetadata{Size: 5}}, want: "-"},
+		{name: "never synced", file: types.File{ContentsExisted: true}, want: "-"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatFileSize(&tt.file); got != tt.want {
+				t.Errorf("formatFileSize() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	http3 "github.com/quic-go/quic-go/http3"
+	qp "github.com/quic-s/quics-protocol"
+	"github.com/quic-s/quics/pkg/client"
+	"github.com/quic-s/quics/pkg/utils"
+)
+
+func TestResolveDownloadTarget(t *testing.T) {
+	dir := t.TempDir()
+	victim := filepath.Join(dir, "victim")
+	if err := os.WriteFile(victim, []byte("victim"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for name, target := range map[string]string{"link": victim, "dangling": filepath.Join(dir, "missing"), "dirlink": dir} {
+		if err := os.Symlink(target, filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		target  string
+		follow  bool
+		want    string
+		wantErr bool
+	}{
+		{name: "new file", target: filepath.Join(dir, "new"), want: filepath.Join(dir, "new")},
+		{name: "regular file", target: victim, want: victim},
+		{name: "directory", target: dir, wantErr: true},
+		{name: "symlink", target: filepath.Join(dir, "link"), wantErr: true},
+		{name: "symlink followed", target: filepath.Join(dir, "link"), follow: true, want: victim},
+		{name: "dangling symlink", target: filepath.Join(dir, "dangling"), wantErr: true},
+		{name: "dangling symlink followed", target: filepath.Join(dir, "dangling"), follow: true, wantErr: true},
+		{name: "symlink to directory followed", target: filepath.Join(dir, "dirlink"), follow: true, wantErr: true},
+
+		{name: "name too long", target: filepath.Join(dir, strings.Repeat("a", utils.LocalNameMax+1)), wantErr: true},
+		{name: "name of temporary file too long", target: filepath.Join(dir, strings.Repeat("a", utils.LocalNameMax-10)), wantErr: true},
+		{name: "path too long", target: filepath.Join(dir, strings.Repeat(strings.Repeat("a", 100)+"/", utils.LocalPathMax/100+1), "new"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			followTargetSymlink = tt.follow
+			defer func() { followTargetSymlink = false }()
+
+			got, err := resolveDownloadTarget(tt.target)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveDownloadTarget() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("resolveDownloadTarget() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteDownloadTargetReplacesLinks(t *testing.T) {
+	tests := []struct {
+		name string
+		link func(victim string, target string) error
+	}{
+		{name: "symlink", link: os.Symlink},
+		{name: "hardlink", link: os.Link},
+		{name: "no link", link: func(victim string, target string) error { return nil }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			victim := filepath.Join(dir, "victim")
+			target := filepath.Join(dir, "target")
+			if err := os.WriteFile(victim, []byte("victim"), 0600); err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.link(victim, target); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := writeDownloadTarget(target, []byte("downloaded")); err != nil {
+				t.Fatal(err)
+			}
+
+			if data, _ := os.ReadFile(victim); string(data) != "victim" {
+				t.Errorf("file linked by target is written: %q", data)
+			}
+			info, err := os.Lstat(target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !info.Mode().IsRegular() {
+				t.Errorf("target is left as %s, want regular file", info.Mode())
+			}
+			if data, _ := os.ReadFile(target); string(data) != "downloaded" {
+				t.Errorf("target = %q, want downloaded", data)
+			}
+			if matches, _ := filepath.Glob(filepath.Join(dir, ".target.download-*")); len(matches) != 0 {
+				t.Errorf("temporary files are left: %v", matches)
+			}
+		})
+	}
+}
+
+// newTestRestClient serves handler as rest server (http/3 with self-signed certificate) and returns client of it
+func newTestRestClient(t *testing.T, handler http.Handler) *client.Client {
+	t.Helper()
+
+	cert, err := qp.GetCertificate("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http3.Server{
+		Handler:   handler,
+		TLSConfig: http3.ConfigureTLSConfig(&tls.Config{Certificates: cert}),
+	}
+	go server.Serve(conn)
+	t.Cleanup(func() {
+		server.Close()
+		conn.Close()
+	})
+
+	restClient := client.New(
+		client.WithBaseURL("https://"+conn.LocalAddr().String()),
+		client.WithTLSConfig(&tls.Config{InsecureSkipVerify: true}),
+	)
+	t.Cleanup(func() { restClient.Close() })
+	return restClient
+}
+
+func TestDownloadFileToErrorResponse(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		body        string
+		wantStatus  int    // status of returned error (0: downloaded)
+		wantMessage string // message of returned error
+	}{
+		{name: "downloaded", status: http.StatusOK, body: "contents"},
+		{name: "zero-byte file", status: http.StatusOK, body: ""},
+		{name: "not found", status: http.StatusNotFound, body: "VERSION_NOT_FOUND: version 3 of /r/a.txt does not exist\n", wantStatus: http.StatusNotFound, wantMessage: "VERSION_NOT_FOUND: version 3 of /r/a.txt does not exist"},
+		{name: "json error body", status: http.StatusBadGateway, body: `{"error":"upstream is down"}`, wantStatus: http.StatusBadGateway, wantMessage: "upstream is down"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			restClient := newTestRestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, tt.body)
+			}))
+			destination := filepath.Join(t.TempDir(), "sub", "a.txt")
+
+			err := downloadFileTo(restClient, "/r/a.txt", 3, destination)
+			if tt.wantStatus == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if data, _ := os.ReadFile(destination); string(data) != tt.body {
+					t.Errorf("downloaded file = %q, want %q", data, tt.body)
+				}
+				return
+			}
+
+			if !client.IsStatus(err, tt.wantStatus) {
+				t.Fatalf("downloadFileTo() error = %v, want status %d", err, tt.wantStatus)
+			}
+			if !strings.Contains(err.Error(), tt.wantMessage) || strings.Contains(err.Error(), "{") {
+				t.Errorf("error = %q, want message %q", err, tt.wantMessage)
+			}
+			if _, err := os.Stat(filepath.Dir(destination)); !os.IsNotExist(err) {
+				t.Errorf("directory of target is created for error response (stat: %v)", err)
+			}
+		})
+	}
+}
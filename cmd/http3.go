@@ -1,99 +1,134 @@
 package main
 
 import (
-	"bytes"
 	"crypto/tls"
-	"io"
+	"crypto/x509"
+	"errors"
 	"log"
-	"net/http"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
 
 	"github.com/quic-go/quic-go"
-	http3 "github.com/quic-go/quic-go/http3"
+	"github.com/quic-s/quics/pkg/client"
 	"github.com/quic-s/quics/pkg/config"
+	"github.com/quic-s/quics/pkg/utils"
 )
 
-type RestClient struct {
-	qconf        *quic.Config
-	roundTripper *http3.RoundTripper
-	hclient      *http.Client
+// caCertPool is loaded from --cacert before running command
+var caCertPool *x509.CertPool
+
+// requestTimeout is parsed from --timeout before running command (0: no limit)
+var requestTimeout time.Duration
+
+// NewRestClient returns client of rest server in qis.env verified by --insecure and --cacert
+// admin token is sent when it is readable (e.g., on server machine), so that listings are not redacted for local admin
+func NewRestClient() *client.Client {
+	return client.New(
+		client.WithBaseURL("https://"+config.GetRestServerH3Address()),
+		client.WithTLSConfig(newTLSConfig()),
+		client.WithTimeout(requestTimeout),
+		client.WithAdminToken(readAdminToken()),
+	)
 }
 
-func NewRestClient() *RestClient {
-	quicConfig := &quic.Config{
-		KeepAlivePeriod: 60,
+// readAdminToken returns --admin-token, or contents of admin token file of server machine (empty when it is not readable)
+func readAdminToken() string {
+	if adminToken != "" {
+		return adminToken
 	}
 
-	restClient := &RestClient{
-		qconf: quicConfig,
+	token, err := os.ReadFile(utils.GetAdminTokenPath())
+	if err != nil {
+		return ""
 	}
 
-	restClient.roundTripper = &http3.RoundTripper{
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: true,
-		},
-		QuicConfig: restClient.qconf,
-	}
+	return strings.TrimSpace(string(token))
+}
 
-	restClient.hclient = &http.Client{
-		Transport: restClient.roundTripper,
+// isServerNotRunning checks whether the request is failed because rest server is not running
+func isServerNotRunning(err error) bool {
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return true
 	}
 
-	return restClient
+	// http/3 is on udp, so unreachable server is usually reported as handshake timeout
+	var handshakeTimeoutErr *quic.HandshakeTimeoutError
+	var idleTimeoutErr *quic.IdleTimeoutError
+	return errors.As(err, &handshakeTimeoutErr) || errors.As(err, &idleTimeoutErr)
 }
 
-func (r *RestClient) GetRequest(path string) (*bytes.Buffer, error) {
-	url := "https://" + config.GetRestServerH3Address() + path
-
-	rsp, err := r.hclient.Get(url)
-	if err != nil {
-		log.Println("quics err: ", err)
-		return nil, err
-	}
-
-	body := &bytes.Buffer{}
-	_, err = io.Copy(body, rsp.Body)
-	if err != nil {
-		log.Println("quics err: ", err)
-		return nil, err
+// loadClientOptions validates options of rest client (--timeout, --insecure and --cacert) before running any command
+func loadClientOptions(cmd *cobra.Command, args []string) error {
+	if timeout != "" {
+		duration, err := time.ParseDuration(timeout)
+		if err != nil || duration <= 0 {
+			err = errors.New("--timeout must be positive duration (e.g., 30s): " + timeout)
+			log.Println("quics err: ", err)
+			return err
+		}
+		requestTimeout = duration
 	}
 
-	return body, nil
+	return loadTLSOptions(cmd, args)
 }
 
-func (r *RestClient) PostRequest(path string, contentType string, content []byte) (*bytes.Buffer, error) {
-	url := "https://" + config.GetRestServerH3Address() + path
+// loadTLSOptions validates --insecure and --cacert before running any command
+func loadTLSOptions(cmd *cobra.Command, args []string) error {
+	if insecure {
+		log.Println("quics alert: ", "TLS verification is disabled (--insecure), so the identity of server is not checked")
+		return nil
+	}
+
+	if caCert == "" {
+		return nil
+	}
 
-	contentReader := bytes.NewReader(content)
-	rsp, err := r.hclient.Post(url, contentType, contentReader)
+	pem, err := os.ReadFile(caCert)
 	if err != nil {
 		log.Println("quics err: ", err)
-		return nil, err
+		return err
 	}
 
-	buf := make([]byte, rsp.ContentLength)
-	_, err = rsp.Body.Read(buf)
-	if err != nil && err != io.EOF {
+	caCertPool = x509.NewCertPool()
+	if !caCertPool.AppendCertsFromPEM(pem) {
+		err = errors.New("no PEM certificate found in " + caCert)
 		log.Println("quics err: ", err)
-		return nil, err
+		return err
 	}
 
-	if string(buf) != "" {
-		log.Println("quis: ", string(buf))
-	} else {
-		log.Println("quis: ", "Success")
+	return nil
+}
+
+// newTLSConfig returns tls config of rest client by --insecure and --cacert
+func newTLSConfig() *tls.Config {
+	tlsConfig := &tls.Config{}
+
+	switch {
+	case insecure:
+		tlsConfig.InsecureSkipVerify = true
+	case caCertPool != nil:
+		tlsConfig.RootCAs = caCertPool
+	case isLoopbackServer():
+		// generated self-signed certificate has no host name to be verified,
+		// but connection to loopback server does not leave this host
+		tlsConfig.InsecureSkipVerify = true
 	}
 
-	return nil, nil
+	return tlsConfig
 }
 
-func (r *RestClient) Close() error {
-	r.hclient.CloseIdleConnections()
-
-	err := r.roundTripper.Close()
-	if err != nil {
-		log.Println("quics err: ", err)
-		return err
+// isLoopbackServer checks whether rest server address is on this host
+func isLoopbackServer() bool {
+	host := config.GetViperEnvVariables("REST_SERVER_ADDR")
+	if host == "localhost" {
+		return true
 	}
 
-	return nil
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
 }
@@ -9,7 +9,9 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
 	"syscall"
+	"time"
 
 	"github.com/quic-go/quic-go"
 	"github.com/quic-go/quic-go/http3"
@@ -17,6 +19,7 @@ import (
 	"github.com/quic-s/quics/pkg/core/server"
 	"github.com/quic-s/quics/pkg/core/sharing"
 	"github.com/quic-s/quics/pkg/fs"
+	"github.com/quic-s/quics/pkg/logs"
 	quicshttp "github.com/quic-s/quics/pkg/network/http"
 	"github.com/quic-s/quics/pkg/repository/badger"
 	"github.com/quic-s/quics/pkg/utils"
@@ -30,15 +33,45 @@ type App struct {
 	restServer    *http3.Server
 }
 
+// AutoStopCheckInterval is the longest interval between checks of whether server has been idle for auto stop duration
+const AutoStopCheckInterval = 10 * time.Second
+
 // New initialize program
-func New(ip string, port string, port3 string) (*App, error) {
+func New(ip string, port string, port3 string, dataDir string) (*App, error) {
+	// keep recent server logs to stream them through rest api
+	logs.Install()
+
 	err := config.SetServerAddress(ip, port, port3)
 	if err != nil {
 		err = errors.New("[App.New] setting server address: " + err.Error())
 		return nil, err
 	}
 
-	repo, err := badger.NewBadgerRepository()
+	// badger database and synced contents are stored in data directory
+	// (validate it before saving to config not to keep unusable directory)
+	resolvedDataDir, err := config.PrepareDataDir(dataDir)
+	if err != nil {
+		err = errors.New("[App.New] preparing data directory: " + err.Error())
+		return nil, err
+	}
+	err = config.SetDataDir(dataDir)
+	if err != nil {
+		err = errors.New("[App.New] setting data directory: " + err.Error())
+		return nil, err
+	}
+	utils.SetQuicsDataDirPath(resolvedDataDir)
+	log.Println("quics: data directory: ", resolvedDataDir)
+
+	// nothing but requests of operator may change the store in safe mode (e.g., to inspect and export troubled store)
+	safeMode := config.GetViperEnvVariables("SAFE_MODE") == "true"
+	if safeMode {
+		log.Println("quics alert: ", "server is starting in SAFE MODE: background workers are disabled and writes are rejected")
+	}
+
+	// database which fails to open (e.g., broken by crash) is repaired only when operator asks for it, since data may be lost
+	repairDB := config.GetViperEnvVariables("REPAIR_DB") == "true"
+
+	repo, err := badger.NewBadgerRepository(safeMode, repairDB)
 	if err != nil {
 		err = errors.New("[App.New] initializing badger repository: " + err.Error())
 		return nil, err
@@ -57,6 +90,45 @@ func New(ip string, port string, port3 string) (*App, error) {
 		return nil, err
 	}
 
+	// recovery of last run changes the store, so it is left as it is in safe mode
+	if !safeMode {
+		// finish remove --all interrupted by crash not to serve half removed store
+		err = serverService.ResumeBulkOperation()
+		if err != nil {
+			err = errors.New("[App.New] resuming bulk operation: " + err.Error())
+			return nil, err
+		}
+
+		// uploads spooled when server stopped were never committed, so their temp files are discarded
+		err = os.RemoveAll(utils.GetQuicsSpoolDirPath())
+		if err != nil {
+			err = errors.New("[App.New] clearing spool directory: " + err.Error())
+			return nil, err
+		}
+
+		// restore state saved on last shutdown (e.g., recent logs) as if server was not restarted
+		err = serverService.RestoreRuntimeState()
+		if err != nil {
+			err = errors.New("[App.New] restoring runtime state: " + err.Error())
+			return nil, err
+		}
+	}
+
+	// mirror local directory of server machine into its prefix when watch dir is set (ingestion writes, so not in safe mode)
+	if watchDir := config.GetViperEnvVariables("WATCH_DIR"); watchDir != "" && !safeMode {
+		localDir, prefix, err := utils.ParseWatchDir(watchDir)
+		if err != nil {
+			err = errors.New("[App.New] parsing watch dir: " + err.Error())
+			return nil, err
+		}
+		watcher, err := fs.NewWatcher(localDir, prefix, serverService)
+		if err != nil {
+			err = errors.New("[App.New] watching dir: " + err.Error())
+			return nil, err
+		}
+		go watcher.Run()
+	}
+
 	sharingService := sharing.NewService(historyRepository, syncRepository, sharingRepository, syncDirAdapter)
 
 	serverHandler := quicshttp.NewServerHandler(serverService)
@@ -66,10 +138,84 @@ func New(ip string, port string, port3 string) (*App, error) {
 	serverHandler.SetupRoutes(mux)
 	sharingHandler.SetupRoutes(mux)
 
+	maxStreamsPerConn, err := strconv.ParseInt(config.GetViperEnvVariables("MAX_STREAMS_PER_CONN"), 10, 64)
+	if err != nil {
+		err = errors.New("[App.New] parsing max streams per connection: " + err.Error())
+		return nil, err
+	}
+
+	cacheTTL, err := strconv.ParseUint(config.GetViperEnvVariables("CACHE_TTL"), 10, 64)
+	if err != nil {
+		err = errors.New("[App.New] parsing cache ttl: " + err.Error())
+		return nil, err
+	}
+
+	maxScans, err := strconv.ParseUint(config.GetViperEnvVariables("MAX_SCANS"), 10, 31)
+	if err != nil {
+		err = errors.New("[App.New] parsing max scans: " + err.Error())
+		return nil, err
+	}
+
+	redactRules, err := utils.ParseRedactRules(config.GetViperEnvVariables("REDACT_FIELDS"))
+	if err != nil {
+		err = errors.New("[App.New] parsing redact fields: " + err.Error())
+		return nil, err
+	}
+
+	var autoStopAfter time.Duration
+	if config.GetViperEnvVariables("AUTO_STOP_AFTER") != "" {
+		autoStopAfter, err = time.ParseDuration(config.GetViperEnvVariables("AUTO_STOP_AFTER"))
+		if err != nil {
+			err = errors.New("[App.New] parsing auto stop after: " + err.Error())
+			return nil, err
+		}
+	}
+
+	// limit full scans of database running at once, so that concurrent show --all requests do not overwhelm server
+	var handler http.Handler = mux
+	if maxScans > 0 {
+		handler = quicshttp.NewScanLimiter(int(maxScans)).Handler(handler)
+	}
+
+	// cache responses of listing endpoints for polling dashboards when cache ttl is set
+	if cacheTTL > 0 {
+		responseCache := quicshttp.NewResponseCache(time.Duration(cacheTTL) * time.Second)
+		events, _ := serverService.SubscribeEvents("")
+		go responseCache.InvalidateOn(events)
+		handler = responseCache.Handler(handler)
+	}
+
+	// hide sensitive fields of listings from callers without admin token (outside cache, so that cached responses are redacted too)
+	if len(redactRules) != 0 {
+		handler = quicshttp.Redact(handler, redactRules, serverService.IsAdminToken)
+	}
+
+	// reject writes before they reach any handler in safe mode
+	if safeMode {
+		handler = quicshttp.SafeMode(handler)
+	}
+
+	// reject clients speaking api version which server does not support before handling their requests
+	handler = quicshttp.APIVersion(handler)
+
+	// stop ephemeral server (e.g., in CI) once neither clients nor rest api have used it for a while
+	if autoStopAfter > 0 {
+		activity := quicshttp.NewActivityTracker()
+		handler = activity.Handler(handler)
+		go stopWhenIdle(serverService, activity, autoStopAfter)
+	}
+
+	// log every rest request (e.g., to diagnose why a command is rejected) when access log is enabled
+	if config.GetViperEnvVariables("ACCESS_LOG") == "true" {
+		handler = quicshttp.AccessLog(handler, config.GetViperEnvVariables("ACCESS_LOG_BODIES") == "true")
+	}
+
 	restServer := &http3.Server{
-		Addr:       "0.0.0.0:" + config.GetViperEnvVariables("REST_SERVER_H3_PORT"),
-		QuicConfig: &quic.Config{},
-		Handler:    mux,
+		Addr: "0.0.0.0:" + config.GetViperEnvVariables("REST_SERVER_H3_PORT"),
+		QuicConfig: &quic.Config{
+			MaxIncomingStreams: maxStreamsPerConn,
+		},
+		Handler: handler,
 	}
 
 	// get directory path for certification
@@ -87,10 +233,17 @@ func New(ip string, port string, port3 string) (*App, error) {
 		}
 	}
 
+	// fail fast before listeners are bound if a dependency of server is not usable (e.g., data directory is read-only)
+	err = serverService.StartupCheck()
+	if err != nil {
+		err = errors.New("[App.New] startup health check: " + err.Error())
+		return nil, err
+	}
+
 	// set legacy http for first connection
 	entryServer := &http.Server{
 		Addr:    "0.0.0.0:" + config.GetViperEnvVariables("REST_SERVER_PORT"),
-		Handler: mux,
+		Handler: handler,
 	}
 
 	return &App{
@@ -125,13 +278,17 @@ func (a *App) StartRestServer() error {
 
 func (a *App) Run() error {
 	go a.StartRestServer()
-	err := a.serverService.ListenProtocol()
-	if err != nil {
-		err = errors.New("[App.Run] listening protocol: " + err.Error())
-		log.Fatalln("quics err: ", err)
-		return err
+
+	// syncs of clients write to the store, so quics protocol is not started in safe mode
+	if config.GetViperEnvVariables("SAFE_MODE") != "true" {
+		err := a.serverService.ListenProtocol()
+		if err != nil {
+			err = errors.New("[App.Run] listening protocol: " + err.Error())
+			log.Fatalln("quics err: ", err)
+			return err
+		}
 	}
-	err = a.Close()
+	err := a.Close()
 	if err != nil {
 		err = errors.New("[App.Run] closing: " + err.Error())
 		log.Fatalln("quics err: ", err)
@@ -157,6 +314,43 @@ func (a *App) Close() error {
 	return nil
 }
 
+// stopWhenIdle stops server gracefully and exits once it has had no client connection and no rest request for autoStopAfter
+func stopWhenIdle(serverService server.Service, activity *quicshttp.ActivityTracker, autoStopAfter time.Duration) {
+	log.Println("quics: server stops itself after ", autoStopAfter, " without client connections and api activity")
+
+	interval := autoStopAfter / 4
+	if interval > AutoStopCheckInterval {
+		interval = AutoStopCheckInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		restIdleSince, restIdle := activity.IdleSince()
+		protocolIdleSince, protocolIdle := serverService.ProtocolIdleSince()
+		if !restIdle || !protocolIdle {
+			continue
+		}
+
+		idleSince := restIdleSince
+		if protocolIdleSince.After(idleSince) {
+			idleSince = protocolIdleSince
+		}
+		if time.Since(idleSince) < autoStopAfter {
+			continue
+		}
+
+		log.Println("quics alert: ", "server is stopped by auto stop: no client connections and no api activity for "+time.Since(idleSince).Round(time.Second).String())
+		err := serverService.StopServer()
+		if err != nil {
+			err = errors.New("[App.stopWhenIdle] stopping server: " + err.Error())
+			log.Println("quics err: ", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+}
+
 func (a *App) Stop() error {
 	return nil
 }
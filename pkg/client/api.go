@@ -0,0 +1,1244 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"time"
+
+	"github.com/quic-s/quics/pkg/types"
+	"github.com/quic-s/quics/pkg/utils"
+)
+
+// PageOptions selects a page of list
+type PageOptions struct {
+	Limit  *uint64 // nil: default of server (e.g., HISTORY_LIMIT for histories), 0: no limit
+	Offset uint64
+	Cursor string // next cursor of previous page
+}
+
+// RemoveFileOptions selects files removed by RemoveFile
+type RemoveFileOptions struct {
+	All       bool // every file (afterPath must be empty)
+	Recursive bool // every file under afterPath instead of exact afterPath
+	DryRun    bool // only count files to be removed
+	Purge     bool // delete stored contents and histories as well
+}
+
+// DirectoryOptions changes options of root directory by SetDirectory (nil: not changed)
+type DirectoryOptions struct {
+	AppendOnly *bool
+	Versioning *string // e.g., ".mp4=latest,video/*=latest"
+	Policy     *string // sync policies overriding extension defaults (e.g., ".tmp=sync,.log=no-versioning+compress-on-transfer")
+}
+
+// FileOptions changes settings of file by SetFile (nil: not changed)
+type FileOptions struct {
+	NoHistory *bool // keep only the latest history of the file
+}
+
+// StopServer stops rest server and closes database
+func (c *Client) StopServer() error {
+	_, err := c.Post("/api/v1/server/stop", nil, "application/json", nil)
+	return err
+}
+
+// ListenProtocol starts listening quic-s protocol
+func (c *Client) ListenProtocol() error {
+	_, err := c.Post("/api/v1/server/listen", nil, "application/json", nil)
+	return err
+}
+
+// SetPassword changes password which clients use to connect to server
+// currentPassword must be the password in use (server responds 403 Forbidden with WRONG_PASSWORD otherwise)
+func (c *Client) SetPassword(currentPassword string, password string) error {
+	body, err := json.Marshal(&types.SetPasswordReq{CurrentPassword: currentPassword, Password: password})
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Post("/api/v1/server/password/set", nil, "application/json", body)
+	return err
+}
+
+// ResetPassword resets password to default one, authorized by admin token which running server writes to utils.GetAdminTokenPath
+// (server responds 403 Forbidden with INVALID_ADMIN_TOKEN for other token)
+func (c *Client) ResetPassword(adminToken string) error {
+	body, err := json.Marshal(&types.ResetPasswordReq{AdminToken: adminToken})
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Post("/api/v1/server/password/reset", nil, "application/json", body)
+	return err
+}
+
+// Scrub verifies integrity of stored contents
+func (c *Client) Scrub() (*types.ScrubRes, error) {
+	response, err := c.Post("/api/v1/server/scrub", nil, "application/json", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	scrubRes := &types.ScrubRes{}
+	err = utils.UnmarshalRequestBody(response.Bytes(), scrubRes)
+	if err != nil {
+		return nil, err
+	}
+
+	return scrubRes, nil
+}
+
+// Reindex rebuilds derived index of server by scanning primary records (empty index: every index)
+func (c *Client) Reindex(index string) ([]types.ReindexRes, error) {
+	query := neturl.Values{}
+	if index != "" {
+		query.Set("index", index)
+	}
+
+	response, err := c.Post("/api/v1/server/reindex", query, "application/json", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	reindexResList := []types.ReindexRes{}
+	err = utils.UnmarshalRequestBody(response.Bytes(), &reindexResList)
+	if err != nil {
+		return nil, err
+	}
+
+	return reindexResList, nil
+}
+
+// Checkpoint returns after every write committed before it is synced to disk (e.g., before taking snapshot of server)
+func (c *Client) Checkpoint() (*types.CheckpointRes, error) {
+	response, err := c.Post("/api/v1/server/checkpoint", nil, "application/json", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	checkpointRes := &types.CheckpointRes{}
+	err = utils.UnmarshalRequestBody(response.Bytes(), checkpointRes)
+	if err != nil {
+		return nil, err
+	}
+
+	return checkpointRes, nil
+}
+
+// GetDBStats returns sizes of LSM tree levels and value log of database with estimated garbage and last maintenance times
+func (c *Client) GetDBStats() (*types.DBStatsRes, error) {
+	response, err := c.Get("/api/v1/server/db/stats", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	dbStatsRes := &types.DBStatsRes{}
+	err = utils.UnmarshalRequestBody(response.Bytes(), dbStatsRes)
+	if err != nil {
+		return nil, err
+	}
+
+	return dbStatsRes, nil
+}
+
+// CompactDB returns after levels of LSM tree of database are compacted (and value log gc is run when valueLogGC is true)
+func (c *Client) CompactDB(valueLogGC bool) (*types.DBCompactRes, error) {
+	query := neturl.Values{}
+	if valueLogGC {
+		query.Set("valueLogGC", "true")
+	}
+
+	response, err := c.Post("/api/v1/server/db/compact", query, "application/json", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	compactRes := &types.DBCompactRes{}
+	err = utils.UnmarshalRequestBody(response.Bytes(), compactRes)
+	if err != nil {
+		return nil, err
+	}
+
+	return compactRes, nil
+}
+
+// GetMetrics returns stream usage of each client connection
+func (c *Client) GetMetrics() (*types.MetricsRes, error) {
+	response, err := c.Get("/api/v1/server/metrics", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	metrics := &types.MetricsRes{}
+	err = utils.UnmarshalRequestBody(response.Bytes(), metrics)
+	if err != nil {
+		return nil, err
+	}
+
+	return metrics, nil
+}
+
+// GetHealth returns state of server and its health checks
+// server responds 503 with the checks when it is not ready, so the checks are returned with its state instead of an error
+func (c *Client) GetHealth() (*types.HealthRes, error) {
+	ctx := context.Background()
+	if c.timeout != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet, "/api/v1/server/health", nil, "", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	rsp, err := c.hclient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+
+	body := &bytes.Buffer{}
+	_, err = io.Copy(body, rsp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if rsp.StatusCode != http.StatusOK && rsp.StatusCode != http.StatusServiceUnavailable {
+		return nil, newStatusError(rsp, body.Bytes())
+	}
+
+	health := &types.HealthRes{}
+	err = utils.UnmarshalRequestBody(body.Bytes(), health)
+	if err != nil {
+		return nil, err
+	}
+
+	return health, nil
+}
+
+// TransferStats returns transfers completed between since and until bucketed by bucket
+// zero since, until or bucket uses default of server (last 24 hours by 1 hour)
+func (c *Client) TransferStats(since time.Time, until time.Time, bucket time.Duration) (*types.TransferStatsRes, error) {
+	query := neturl.Values{}
+	if !since.IsZero() {
+		query.Set("since", since.Format(time.RFC3339Nano))
+	}
+	if !until.IsZero() {
+		query.Set("until", until.Format(time.RFC3339Nano))
+	}
+	if bucket != 0 {
+		query.Set("bucket", bucket.String())
+	}
+
+	response, err := c.Get("/api/v1/server/stats/transfers", query)
+	if err != nil {
+		return nil, err
+	}
+
+	statsRes := &types.TransferStatsRes{}
+	err = utils.UnmarshalRequestBody(response.Bytes(), statsRes)
+	if err != nil {
+		return nil, err
+	}
+
+	return statsRes, nil
+}
+
+// StreamLogs returns server logs of level and above as text stream, which is kept open for new logs when follow is true
+// the caller must close returned stream
+func (c *Client) StreamLogs(level string, follow bool) (io.ReadCloser, error) {
+	return c.GetStream("/api/v1/server/logs/stream", neturl.Values{"level": {level}, "follow": {fmt.Sprint(follow)}})
+}
+
+// PathOptions filters paths of StreamPaths and ListPaths (both false: root directories and files)
+type PathOptions struct {
+	FilesOnly bool
+	DirsOnly  bool
+}
+
+// StreamPaths returns json array of afterPaths of root directories and files as it is streamed by server
+// the caller must close returned stream
+func (c *Client) StreamPaths(opts PathOptions) (io.ReadCloser, error) {
+	query := neturl.Values{}
+	switch {
+	case opts.FilesOnly && opts.DirsOnly:
+		return nil, errors.New("[Client.StreamPaths] FilesOnly and DirsOnly can not be used together")
+	case opts.FilesOnly:
+		query.Set("type", "files")
+	case opts.DirsOnly:
+		query.Set("type", "dirs")
+	}
+
+	return c.GetStream("/api/v1/server/logs/paths", query)
+}
+
+// ListPaths returns afterPaths of root directories and files without their records
+func (c *Client) ListPaths(opts PathOptions) ([]string, error) {
+	stream, err := c.StreamPaths(opts)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	paths := []string{}
+	err = json.NewDecoder(stream).Decode(&paths)
+	if err != nil {
+		return nil, err
+	}
+
+	return paths, nil
+}
+
+// ListClients returns a page of clients (uuid and root filter them when they are not empty)
+func (c *Client) ListClients(uuid string, root string, page *PageOptions) (*types.Page[types.Client], error) {
+	return getPage[types.Client](c, "/api/v1/server/logs/clients", neturl.Values{"uuid": {uuid}, "root": {root}}, page)
+}
+
+// ListDirectories returns a page of root directories (every root directory when afterPath is empty)
+func (c *Client) ListDirectories(afterPath string, page *PageOptions) (*types.Page[types.RootDirectory], error) {
+	return getPage[types.RootDirectory](c, "/api/v1/server/logs/directories", neturl.Values{"afterPath": {afterPath}}, page)
+}
+
+// ListFiles returns a page of files matched with afterPath (every file when afterPath is empty)
+// afterPath can be glob pattern (e.g., /root/logs/*.txt)
+func (c *Client) ListFiles(afterPath string, page *PageOptions) (*types.Page[types.File], error) {
+	return getPage[types.File](c, "/api/v1/server/logs/files", neturl.Values{"afterPath": {afterPath}}, page)
+}
+
+// ListFilesByTags returns a page of files matched with afterPath (every file when afterPath is empty) having every tag of tags
+func (c *Client) ListFilesByTags(afterPath string, tags map[string]string, page *PageOptions) (*types.Page[types.File], error) {
+	return getPage[types.File](c, "/api/v1/server/logs/files", neturl.Values{"afterPath": {afterPath}, "tag": {utils.FormatTags(tags)}}, page)
+}
+
+// GetDuplicateFiles returns sets of files whose latest contents are identical (narrowed by filter when it is not nil)
+func (c *Client) GetDuplicateFiles(filter *types.LogFilter) (*types.DuplicatesRes, error) {
+	response, err := c.Get("/api/v1/server/logs/files/duplicates", filterQuery(neturl.Values{}, filter))
+	if err != nil {
+		return nil, err
+	}
+
+	duplicatesRes := &types.DuplicatesRes{}
+	err = utils.UnmarshalRequestBody(response.Bytes(), duplicatesRes)
+	if err != nil {
+		return nil, err
+	}
+
+	return duplicatesRes, nil
+}
+
+// GetConflicts returns unresolved conflicts under afterPath grouped by root directory (every conflict when afterPath is empty)
+func (c *Client) GetConflicts(afterPath string) (*types.ConflictsRes, error) {
+	response, err := c.Get("/api/v1/server/logs/directories/conflicts", neturl.Values{"afterPath": {afterPath}})
+	if err != nil {
+		return nil, err
+	}
+
+	conflictsRes := &types.ConflictsRes{}
+	err = utils.UnmarshalRequestBody(response.Bytes(), conflictsRes)
+	if err != nil {
+		return nil, err
+	}
+
+	return conflictsRes, nil
+}
+
+// GetBulkOperation returns progress of destructive bulk operation which is running on server (Running is false when none is running)
+func (c *Client) GetBulkOperation() (*types.BulkOperationRes, error) {
+	response, err := c.Get("/api/v1/server/logs/bulk", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	bulkOperationRes := &types.BulkOperationRes{}
+	err = utils.UnmarshalRequestBody(response.Bytes(), bulkOperationRes)
+	if err != nil {
+		return nil, err
+	}
+
+	return bulkOperationRes, nil
+}
+
+// ResolveConflict resolves conflict of the file by keeping version of keep ("server" or UUID of client which uploaded it)
+func (c *Client) ResolveConflict(afterPath string, keep string) (*types.File, error) {
+	response, err := c.Post("/api/v1/server/conflicts/resolve", neturl.Values{"afterPath": {afterPath}, "keep": {keep}}, "application/json", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	file := &types.File{}
+	err = utils.UnmarshalRequestBody(response.Bytes(), file)
+	if err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// ListOrphanedFiles returns a page of files whose root directory does not exist anymore
+func (c *Client) ListOrphanedFiles(page *PageOptions) (*types.Page[types.File], error) {
+	return getPage[types.File](c, "/api/v1/server/logs/files/orphaned", neturl.Values{}, page)
+}
+
+// ListHistories returns a page of histories matched with afterPath (every history when afterPath is empty)
+// afterPath can be glob pattern (e.g., /root/logs/*.txt)
+func (c *Client) ListHistories(afterPath string, page *PageOptions) (*types.Page[types.FileHistory], error) {
+	return getPage[types.FileHistory](c, "/api/v1/server/logs/histories", neturl.Values{"afterPath": {afterPath}}, page)
+}
+
+// ListCommitHistories returns a page of histories committed with commit set of id
+func (c *Client) ListCommitHistories(id string, page *PageOptions) (*types.Page[types.FileHistory], error) {
+	return getPage[types.FileHistory](c, "/api/v1/server/logs/histories", neturl.Values{"commit": {id}}, page)
+}
+
+// ListClientsWhere returns a page of clients narrowed by filter (owner, prefix, uuid)
+func (c *Client) ListClientsWhere(filter *types.LogFilter, page *PageOptions) (*types.Page[types.Client], error) {
+	return getPage[types.Client](c, "/api/v1/server/logs/clients", filterQuery(neturl.Values{}, filter), page)
+}
+
+// ListDirectoriesWhere returns a page of root directories narrowed by filter (owner, prefix, uuid)
+func (c *Client) ListDirectoriesWhere(filter *types.LogFilter, page *PageOptions) (*types.Page[types.RootDirectory], error) {
+	return getPage[types.RootDirectory](c, "/api/v1/server/logs/directories", filterQuery(neturl.Values{}, filter), page)
+}
+
+// ListFilesWhere returns a page of files matched with afterPath (every file when afterPath is empty) narrowed by filter
+func (c *Client) ListFilesWhere(afterPath string, filter *types.LogFilter, page *PageOptions) (*types.Page[types.File], error) {
+	return getPage[types.File](c, "/api/v1/server/logs/files", filterQuery(neturl.Values{"afterPath": {afterPath}}, filter), page)
+}
+
+// ListHistoriesWhere returns a page of histories matched with afterPath (every history when afterPath is empty) narrowed by filter
+// (tags of filter are not supported, since they belong to files)
+func (c *Client) ListHistoriesWhere(afterPath string, filter *types.LogFilter, page *PageOptions) (*types.Page[types.FileHistory], error) {
+	return getPage[types.FileHistory](c, "/api/v1/server/logs/histories", filterQuery(neturl.Values{"afterPath": {afterPath}}, filter), page)
+}
+
+// CountClients returns the number of clients narrowed by filter (owner, prefix, uuid) without listing them
+func (c *Client) CountClients(filter *types.LogFilter) (*types.CountRes, error) {
+	return getCount(c, "/api/v1/server/logs/clients/count", filter)
+}
+
+// CountDirectories returns the number of root directories narrowed by filter (owner, prefix, uuid) without listing them
+func (c *Client) CountDirectories(filter *types.LogFilter) (*types.CountRes, error) {
+	return getCount(c, "/api/v1/server/logs/directories/count", filter)
+}
+
+// CountFiles returns the number of files narrowed by filter without listing them
+func (c *Client) CountFiles(filter *types.LogFilter) (*types.CountRes, error) {
+	return getCount(c, "/api/v1/server/logs/files/count", filter)
+}
+
+// CountHistories returns the number of histories narrowed by filter without listing them
+// (tags and custom metadata of filter are not supported, since they belong to files)
+func (c *Client) CountHistories(filter *types.LogFilter) (*types.CountRes, error) {
+	return getCount(c, "/api/v1/server/logs/histories/count", filter)
+}
+
+func getCount(c *Client, path string, filter *types.LogFilter) (*types.CountRes, error) {
+	response, err := c.Get(path, filterQuery(neturl.Values{}, filter))
+	if err != nil {
+		return nil, err
+	}
+
+	countRes := &types.CountRes{}
+	err = utils.UnmarshalRequestBody(response.Bytes(), countRes)
+	if err != nil {
+		return nil, err
+	}
+
+	return countRes, nil
+}
+
+// GetFile returns file of afterPath
+func (c *Client) GetFile(afterPath string) (*types.File, error) {
+	if afterPath == "" || utils.IsGlobPattern(afterPath) {
+		return nil, errors.New("[Client.GetFile] path of a file is required: " + afterPath)
+	}
+
+	files, err := c.ListFiles(afterPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(files.Items) == 0 {
+		return nil, errors.New("[Client.GetFile] file not found: " + afterPath)
+	}
+
+	return &files.Items[0], nil
+}
+
+// GetFileSyncedTo returns file of afterPath after write of consistency token (e.g., SyncToken of uploaded file) is fully visible
+// server responds 503 Service Unavailable when it is not visible before SYNC_WAIT_TIMEOUT of server passes
+func (c *Client) GetFileSyncedTo(afterPath string, token string) (*types.File, error) {
+	if afterPath == "" || utils.IsGlobPattern(afterPath) {
+		return nil, errors.New("[Client.GetFileSyncedTo] path of a file is required: " + afterPath)
+	}
+
+	files, err := getPage[types.File](c, "/api/v1/server/logs/files", neturl.Values{"afterPath": {afterPath}, "ifSyncedTo": {token}}, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(files.Items) == 0 {
+		return nil, errors.New("[Client.GetFileSyncedTo] file not found: " + afterPath)
+	}
+
+	return &files.Items[0], nil
+}
+
+// SyncToken returns consistency token of version of file written by the caller (e.g., returned by Upload),
+// which is passed to GetFileSyncedTo and DownloadFileSyncedTo to read the version back
+func SyncToken(file *types.File) string {
+	return utils.MakeSyncToken(file.AfterPath, file.LatestSyncTimestamp)
+}
+
+// ListAll follows every page of list from page (nil: the first page)
+// e.g., client.ListAll(nil, func(page *client.PageOptions) (*types.Page[types.File], error) { return c.ListFiles("/root/*.txt", page) })
+func ListAll[T any](page *PageOptions, list func(page *PageOptions) (*types.Page[T], error)) ([]T, error) {
+	next := &PageOptions{}
+	if page != nil {
+		*next = *page
+	}
+
+	items := []T{}
+	for {
+		result, err := list(next)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, result.Items...)
+
+		if result.NextOffset == nil {
+			return items, nil
+		}
+		next.Offset, next.Cursor = *result.NextOffset, result.NextCursor
+	}
+}
+
+// filterQuery sets filter into query of logs request (server responds 400 Bad Request for filter the endpoint does not support)
+func filterQuery(query neturl.Values, filter *types.LogFilter) neturl.Values {
+	if filter == nil {
+		return query
+	}
+
+	for key, value := range map[string]string{"owner": filter.Owner, "prefix": filter.Prefix, "uuid": filter.UUID, "tag": utils.FormatTags(filter.Tags)} {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+	if !filter.Since.IsZero() {
+		query.Set("since", filter.Since.Format(time.RFC3339))
+	}
+	if !filter.Until.IsZero() {
+		query.Set("until", filter.Until.Format(time.RFC3339))
+	}
+	if filter.MinSize != 0 {
+		query.Set("minSize", fmt.Sprint(filter.MinSize))
+	}
+	if filter.MaxSize != 0 {
+		query.Set("maxSize", fmt.Sprint(filter.MaxSize))
+	}
+	if len(filter.Metadata) != 0 {
+		// metadata which can not be encoded is sent as it is, so that server rejects it instead of listing unfiltered files
+		metadata, err := json.Marshal(filter.Metadata)
+		if err != nil {
+			metadata = []byte(fmt.Sprint(filter.Metadata))
+		}
+		query.Set("metadata", string(metadata))
+	}
+
+	return query
+}
+
+func getPage[T any](c *Client, path string, query neturl.Values, page *PageOptions) (*types.Page[T], error) {
+	if page != nil {
+		if page.Limit != nil {
+			query.Set("limit", fmt.Sprint(*page.Limit))
+		}
+		query.Set("offset", fmt.Sprint(page.Offset))
+		query.Set("cursor", page.Cursor)
+	}
+
+	response, err := c.Get(path, query)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &types.Page[T]{}
+	err = utils.UnmarshalRequestBody(response.Bytes(), result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// RemoveClient removes client of uuid
+func (c *Client) RemoveClient(uuid string) error {
+	if uuid == "" {
+		return errors.New("[Client.RemoveClient] uuid is required (use RemoveAllClients to remove every client)")
+	}
+
+	_, err := c.Post("/api/v1/server/remove/clients", neturl.Values{"uuid": {uuid}}, "application/json", nil)
+	return err
+}
+
+// RemoveAllClients removes every client
+func (c *Client) RemoveAllClients() error {
+	_, err := c.Post("/api/v1/server/remove/clients", neturl.Values{"all": {"true"}}, "application/json", nil)
+	return err
+}
+
+// RemoveDirectory removes root directory of afterPath
+func (c *Client) RemoveDirectory(afterPath string) error {
+	if afterPath == "" {
+		return errors.New("[Client.RemoveDirectory] path is required (use RemoveAllDirectories to remove every root directory)")
+	}
+
+	_, err := c.Post("/api/v1/server/remove/directories", neturl.Values{"afterPath": {afterPath}}, "application/json", nil)
+	return err
+}
+
+// RemoveAllDirectories removes every root directory
+func (c *Client) RemoveAllDirectories() error {
+	_, err := c.Post("/api/v1/server/remove/directories", neturl.Values{"all": {"true"}}, "application/json", nil)
+	return err
+}
+
+// RemoveFile removes file of afterPath (or files under afterPath with Recursive, every file with All)
+func (c *Client) RemoveFile(afterPath string, opts RemoveFileOptions) (*types.RemoveRes, error) {
+	query := neturl.Values{"afterPath": {afterPath}}
+	if opts.All {
+		query.Set("all", "true")
+	}
+	if opts.Recursive {
+		query.Set("recursive", "true")
+	}
+	if opts.DryRun {
+		query.Set("dryRun", "true")
+	}
+	if opts.Purge {
+		query.Set("purge", "true")
+	}
+
+	response, err := c.Post("/api/v1/server/remove/files", query, "application/json", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	removeRes := &types.RemoveRes{}
+	err = utils.UnmarshalRequestBody(response.Bytes(), removeRes)
+	if err != nil {
+		return nil, err
+	}
+
+	return removeRes, nil
+}
+
+// RemoveOrphanedFiles removes every file whose root directory does not exist anymore (only DryRun and Purge of opts are used)
+func (c *Client) RemoveOrphanedFiles(opts RemoveFileOptions) (*types.RemoveRes, error) {
+	query := neturl.Values{}
+	if opts.DryRun {
+		query.Set("dryRun", "true")
+	}
+	if opts.Purge {
+		query.Set("purge", "true")
+	}
+
+	response, err := c.Post("/api/v1/server/remove/files/orphaned", query, "application/json", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	removeRes := &types.RemoveRes{}
+	err = utils.UnmarshalRequestBody(response.Bytes(), removeRes)
+	if err != nil {
+		return nil, err
+	}
+
+	return removeRes, nil
+}
+
+// DownloadFile returns contents of file of afterPath at version of timestamp
+// contents of zero-byte file are empty but not nil, so that nil always means failure
+func (c *Client) DownloadFile(afterPath string, timestamp uint64) ([]byte, error) {
+	response, err := c.Get("/api/v1/server/download/files", neturl.Values{"afterPath": {afterPath}, "timestamp": {fmt.Sprint(timestamp)}})
+	if err != nil {
+		return nil, err
+	}
+
+	return contentsOf(response), nil
+}
+
+// OpenFile returns stream of contents of file of afterPath at version of timestamp, so that large file is not held in memory
+// (caller must close it)
+func (c *Client) OpenFile(afterPath string, timestamp uint64) (io.ReadCloser, error) {
+	return c.GetStream("/api/v1/server/download/files", neturl.Values{"afterPath": {afterPath}, "timestamp": {fmt.Sprint(timestamp)}})
+}
+
+// DownloadFileSyncedTo returns contents of file of afterPath at version of timestamp after write of consistency token is fully visible
+func (c *Client) DownloadFileSyncedTo(afterPath string, timestamp uint64, token string) ([]byte, error) {
+	response, err := c.Get("/api/v1/server/download/files", neturl.Values{"afterPath": {afterPath}, "timestamp": {fmt.Sprint(timestamp)}, "ifSyncedTo": {token}})
+	if err != nil {
+		return nil, err
+	}
+
+	return contentsOf(response), nil
+}
+
+// ShareFile returns signed url which downloads file of afterPath at version of timestamp without login until expires passes
+func (c *Client) ShareFile(afterPath string, timestamp uint64, expires time.Duration) (*types.SignedURLRes, error) {
+	query := neturl.Values{"afterPath": {afterPath}, "timestamp": {fmt.Sprint(timestamp)}, "expires": {expires.String()}}
+
+	response, err := c.Post("/api/v1/server/share/files", query, "application/json", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	signedURLRes := &types.SignedURLRes{}
+	err = utils.UnmarshalRequestBody(response.Bytes(), signedURLRes)
+	if err != nil {
+		return nil, err
+	}
+
+	return signedURLRes, nil
+}
+
+// GetFileDigest returns content hash and size of file of afterPath at version of timestamp without downloading its contents
+// a downloaded copy matches the version when utils.MakeContentHashFromFile of it equals ContentHash
+func (c *Client) GetFileDigest(afterPath string, timestamp uint64) (*types.FileDigestRes, error) {
+	response, err := c.Get("/api/v1/server/digest/files", neturl.Values{"afterPath": {afterPath}, "timestamp": {fmt.Sprint(timestamp)}})
+	if err != nil {
+		return nil, err
+	}
+
+	digest := &types.FileDigestRes{}
+	err = utils.UnmarshalRequestBody(response.Bytes(), digest)
+	if err != nil {
+		return nil, err
+	}
+
+	return digest, nil
+}
+
+// GetFileChunkDigest returns digest of file of afterPath at version of timestamp with hashes of its chunks (ChunkHashes),
+// which utils.NewChunkVerifyingReader checks contents of OpenFile against as they arrive
+func (c *Client) GetFileChunkDigest(afterPath string, timestamp uint64) (*types.FileDigestRes, error) {
+	response, err := c.Get("/api/v1/server/digest/files", neturl.Values{"afterPath": {afterPath}, "timestamp": {fmt.Sprint(timestamp)}, "chunks": {"true"}})
+	if err != nil {
+		return nil, err
+	}
+
+	digest := &types.FileDigestRes{}
+	err = utils.UnmarshalRequestBody(response.Bytes(), digest)
+	if err != nil {
+		return nil, err
+	}
+
+	return digest, nil
+}
+
+// ResolveVersion returns timestamp of version of file of afterPath selected by 1-based ordinal, timestamp or latest,
+// which DownloadFile, GetFileDigest and ShareFile take
+func (c *Client) ResolveVersion(afterPath string, selector *types.VersionSelector) (*types.VersionRes, error) {
+	return c.resolveVersion(selector, neturl.Values{"afterPath": {afterPath}})
+}
+
+// ResolveVersionSyncedTo resolves version of file of afterPath after write of consistency token is fully visible,
+// so that latest is at least the version written with the token
+func (c *Client) ResolveVersionSyncedTo(afterPath string, selector *types.VersionSelector, token string) (*types.VersionRes, error) {
+	return c.resolveVersion(selector, neturl.Values{"afterPath": {afterPath}, "ifSyncedTo": {token}})
+}
+
+func (c *Client) resolveVersion(selector *types.VersionSelector, query neturl.Values) (*types.VersionRes, error) {
+	err := selector.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	switch selector.Kind {
+	case types.VersionByOrdinal:
+		query.Set("version", fmt.Sprint(selector.Value))
+	case types.VersionByTimestamp:
+		query.Set("timestamp", fmt.Sprint(selector.Value))
+	case types.VersionLatest:
+		query.Set("latest", "true")
+	}
+
+	response, err := c.Get("/api/v1/server/versions/resolve", query)
+	if err != nil {
+		return nil, err
+	}
+
+	versionRes := &types.VersionRes{}
+	err = utils.UnmarshalRequestBody(response.Bytes(), versionRes)
+	if err != nil {
+		return nil, err
+	}
+
+	return versionRes, nil
+}
+
+// RotateSigningKey revokes every signed url returned by ShareFile
+func (c *Client) RotateSigningKey() error {
+	_, err := c.Post("/api/v1/server/share/rotate", nil, "application/json", nil)
+	return err
+}
+
+// DownloadFileAs returns contents of file of afterPath at version of timestamp transcoded by server
+// to accept given as MIME type (e.g., application/json) or extension (e.g., json)
+// server responds 406 Not Acceptable when none of its enabled converters can transcode the file
+func (c *Client) DownloadFileAs(afterPath string, timestamp uint64, accept string) ([]byte, error) {
+	response, err := c.Get("/api/v1/server/download/files", neturl.Values{"afterPath": {afterPath}, "timestamp": {fmt.Sprint(timestamp)}, "accept": {accept}})
+	if err != nil {
+		return nil, err
+	}
+
+	return contentsOf(response), nil
+}
+
+// contentsOf returns downloaded contents (bytes.Buffer returns nil for empty response)
+func contentsOf(response *bytes.Buffer) []byte {
+	if response.Len() == 0 {
+		return []byte{}
+	}
+	return response.Bytes()
+}
+
+// Upload saves content as new version of file of afterPath (/{root directory}/{file})
+// and pushes it to clients when root directory is registered
+// nil or empty content uploads zero-byte file
+func (c *Client) Upload(afterPath string, content []byte) (*types.File, error) {
+	return c.upload(afterPath, content, neturl.Values{"afterPath": {afterPath}})
+}
+
+// UploadIfMatch uploads content only if latest hash of file of afterPath is still expectedHash ("*": only if the file exists)
+// server responds 409 Conflict with current hash when it does not match (e.g., file has been changed since it was read)
+func (c *Client) UploadIfMatch(afterPath string, content []byte, expectedHash string) (*types.File, error) {
+	return c.upload(afterPath, content, neturl.Values{"afterPath": {afterPath}, "ifMatch": {expectedHash}})
+}
+
+// UploadWithMetadata uploads content as new version of file of afterPath and replaces custom metadata of the file with metadata (nil clears it)
+func (c *Client) UploadWithMetadata(afterPath string, content []byte, metadata map[string]any) (*types.File, error) {
+	encoded, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, err
+	}
+	return c.upload(afterPath, content, neturl.Values{"afterPath": {afterPath}, "metadata": {string(encoded)}})
+}
+
+func (c *Client) upload(afterPath string, content []byte, query neturl.Values) (*types.File, error) {
+	if content == nil {
+		content = []byte{}
+	}
+	response, err := c.Post("/api/v1/server/upload/files", query, "application/octet-stream", content)
+	if err != nil {
+		return nil, err
+	}
+
+	file := &types.File{}
+	err = utils.UnmarshalRequestBody(response.Bytes(), file)
+	if err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// OpenCommitSet opens commit set of name, then files staged with StageCommitFile appear at once by CommitSet
+func (c *Client) OpenCommitSet(name string) (*types.CommitSet, error) {
+	response, err := c.Post("/api/v1/server/commits", neturl.Values{"name": {name}}, "application/json", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeCommitSet(response)
+}
+
+// StageCommitFile stages content as new version of afterPath in open commit set of id
+func (c *Client) StageCommitFile(id string, afterPath string, content []byte) (*types.CommitSet, error) {
+	if content == nil {
+		content = []byte{}
+	}
+	response, err := c.Post("/api/v1/server/commits/upload", neturl.Values{"id": {id}, "afterPath": {afterPath}}, "application/octet-stream", content)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeCommitSet(response)
+}
+
+// CommitSet commits every staged file of commit set of id (either all new versions appear or none of them does)
+func (c *Client) CommitSet(id string) (*types.CommitSet, error) {
+	response, err := c.Post("/api/v1/server/commits/commit", neturl.Values{"id": {id}}, "application/json", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeCommitSet(response)
+}
+
+// AbortCommitSet discards open commit set of id with its staged files
+func (c *Client) AbortCommitSet(id string) error {
+	_, err := c.Delete("/api/v1/server/commits", neturl.Values{"id": {id}})
+	return err
+}
+
+// GetCommitSet returns commit set of id
+func (c *Client) GetCommitSet(id string) (*types.CommitSet, error) {
+	response, err := c.Get("/api/v1/server/commits", neturl.Values{"id": {id}})
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeCommitSet(response)
+}
+
+func decodeCommitSet(response *bytes.Buffer) (*types.CommitSet, error) {
+	commitSet := &types.CommitSet{}
+	err := utils.UnmarshalRequestBody(response.Bytes(), commitSet)
+	if err != nil {
+		return nil, err
+	}
+
+	return commitSet, nil
+}
+
+// LockFile locks file so that only client of uuid can sync it until ttl expires
+func (c *Client) LockFile(afterPath string, uuid string, ttl time.Duration) (*types.FileLock, error) {
+	query := neturl.Values{"afterPath": {afterPath}, "uuid": {uuid}, "ttl": {fmt.Sprint(uint64(ttl.Seconds()))}}
+
+	response, err := c.Post("/api/v1/server/files/lock", query, "application/json", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	lock := &types.FileLock{}
+	err = utils.UnmarshalRequestBody(response.Bytes(), lock)
+	if err != nil {
+		return nil, err
+	}
+
+	return lock, nil
+}
+
+// TagFile sets tags of set and removes tags of unset keys of file of afterPath
+func (c *Client) TagFile(afterPath string, set map[string]string, unset []string) (*types.File, error) {
+	query := neturl.Values{"afterPath": {afterPath}, "set": {utils.FormatTags(set)}, "unset": {strings.Join(unset, ",")}}
+
+	response, err := c.Post("/api/v1/server/files/tags", query, "application/json", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	file := &types.File{}
+	err = utils.UnmarshalRequestBody(response.Bytes(), file)
+	if err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// TagFiles sets and removes tags of every file matched by filter (required), or only counts them when dryRun is set
+func (c *Client) TagFiles(filter *types.LogFilter, set map[string]string, unset []string, dryRun bool) (*types.BulkUpdateRes, error) {
+	query := filterQuery(neturl.Values{"set": {utils.FormatTags(set)}, "unset": {strings.Join(unset, ",")}}, filter)
+	if dryRun {
+		query.Set("dryRun", "true")
+	}
+
+	response, err := c.Post("/api/v1/server/files/tags/bulk", query, "application/json", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	bulkRes := &types.BulkUpdateRes{}
+	err = utils.UnmarshalRequestBody(response.Bytes(), bulkRes)
+	if err != nil {
+		return nil, err
+	}
+
+	return bulkRes, nil
+}
+
+// SetFileMetadata replaces custom metadata of file of afterPath with metadata (nil or empty clears it)
+func (c *Client) SetFileMetadata(afterPath string, metadata map[string]any) (*types.File, error) {
+	body, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := c.Post("/api/v1/server/files/metadata", neturl.Values{"afterPath": {afterPath}}, "application/json", body)
+	if err != nil {
+		return nil, err
+	}
+
+	file := &types.File{}
+	err = utils.UnmarshalRequestBody(response.Bytes(), file)
+	if err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// UnlockFile unlocks file held by client of uuid
+func (c *Client) UnlockFile(afterPath string, uuid string) error {
+	_, err := c.Delete("/api/v1/server/files/lock", neturl.Values{"afterPath": {afterPath}, "uuid": {uuid}})
+	return err
+}
+
+// ListLocks lists active file locks under afterPath (every lock when it is empty)
+func (c *Client) ListLocks(afterPath string) ([]types.LockInfo, error) {
+	query := neturl.Values{}
+	if afterPath != "" {
+		query.Set("afterPath", afterPath)
+	}
+
+	response, err := c.Get("/api/v1/server/locks", query)
+	if err != nil {
+		return nil, err
+	}
+
+	locks := []types.LockInfo{}
+	err = utils.UnmarshalRequestBody(response.Bytes(), &locks)
+	if err != nil {
+		return nil, err
+	}
+
+	return locks, nil
+}
+
+// BreakLock releases lock of file held by any client with reason, which is logged by server and sent to holder as LOCK_BROKEN event
+// server responds 409 Conflict when file is not locked
+func (c *Client) BreakLock(afterPath string, reason string) (*types.BreakLockRes, error) {
+	response, err := c.Post("/api/v1/server/locks/break", neturl.Values{"afterPath": {afterPath}, "reason": {reason}}, "application/json", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	breakLockRes := &types.BreakLockRes{}
+	err = utils.UnmarshalRequestBody(response.Bytes(), breakLockRes)
+	if err != nil {
+		return nil, err
+	}
+
+	return breakLockRes, nil
+}
+
+// MoveDirectory moves root directory with its files and histories
+func (c *Client) MoveDirectory(from string, to string) error {
+	_, err := c.Post("/api/v1/server/move/directories", neturl.Values{"from": {from}, "to": {to}}, "application/json", nil)
+	return err
+}
+
+// MoveFile renames file keeping its histories; the move is recorded as new version whose history has MovedFrom
+// server responds 409 Conflict when file of to exists unless overwrite is set
+func (c *Client) MoveFile(from string, to string, overwrite bool) (*types.File, error) {
+	query := neturl.Values{"from": {from}, "to": {to}}
+	if overwrite {
+		query.Set("overwrite", "true")
+	}
+	response, err := c.Post("/api/v1/server/move/files", query, "application/json", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	file := &types.File{}
+	err = utils.UnmarshalRequestBody(response.Bytes(), file)
+	if err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// SetDirectory changes options of root directory of afterPath
+func (c *Client) SetDirectory(afterPath string, opts DirectoryOptions) error {
+	query := neturl.Values{"afterPath": {afterPath}}
+	if opts.AppendOnly != nil {
+		query.Set("appendOnly", fmt.Sprint(*opts.AppendOnly))
+	}
+	if opts.Versioning != nil {
+		query.Set("versioning", *opts.Versioning)
+	}
+	if opts.Policy != nil {
+		query.Set("policy", *opts.Policy)
+	}
+
+	_, err := c.Post("/api/v1/server/set/directories", query, "application/json", nil)
+	return err
+}
+
+// SetFile changes settings of file of afterPath and returns the file
+func (c *Client) SetFile(afterPath string, opts FileOptions) (*types.File, error) {
+	query := neturl.Values{"afterPath": {afterPath}}
+	if opts.NoHistory != nil {
+		query.Set("noHistory", fmt.Sprint(*opts.NoHistory))
+	}
+
+	response, err := c.Post("/api/v1/server/set/files", query, "application/json", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	file := &types.File{}
+	err = utils.UnmarshalRequestBody(response.Bytes(), file)
+	if err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// ExplainPolicy returns sync behaviors applied to file of afterPath and where each of them came from
+func (c *Client) ExplainPolicy(afterPath string) (*types.EffectivePolicy, error) {
+	response, err := c.Get("/api/v1/server/policy/explain", neturl.Values{"afterPath": {afterPath}})
+	if err != nil {
+		return nil, err
+	}
+
+	policy := &types.EffectivePolicy{}
+	err = utils.UnmarshalRequestBody(response.Bytes(), policy)
+	if err != nil {
+		return nil, err
+	}
+
+	return policy, nil
+}
+
+// DiffDirectory returns files added, modified or removed under afterPath between from and to
+// contents are compared as well when content is true
+func (c *Client) DiffDirectory(afterPath string, from time.Time, to time.Time, content bool) (*types.DirDiffRes, error) {
+	query := neturl.Values{"afterPath": {afterPath}, "from": {from.Format(time.RFC3339Nano)}, "to": {to.Format(time.RFC3339Nano)}, "content": {fmt.Sprint(content)}}
+
+	response, err := c.Get("/api/v1/server/diff/directories", query)
+	if err != nil {
+		return nil, err
+	}
+
+	diffRes := &types.DirDiffRes{}
+	err = utils.UnmarshalRequestBody(response.Bytes(), diffRes)
+	if err != nil {
+		return nil, err
+	}
+
+	return diffRes, nil
+}
+
+// GetFileLineage returns moves which file of afterPath came from and went to (see utils.FormatLineage to write it as tree or graph)
+func (c *Client) GetFileLineage(afterPath string) (*types.FileLineageRes, error) {
+	response, err := c.Get("/api/v1/server/logs/lineage", neturl.Values{"afterPath": {afterPath}})
+	if err != nil {
+		return nil, err
+	}
+
+	lineage := &types.FileLineageRes{}
+	err = utils.UnmarshalRequestBody(response.Bytes(), lineage)
+	if err != nil {
+		return nil, err
+	}
+
+	return lineage, nil
+}
+
+// SubscribeClient makes client of uuid receive changes under path prefix only
+func (c *Client) SubscribeClient(uuid string, prefix string) error {
+	_, err := c.Post("/api/v1/server/subscribe/clients", neturl.Values{"uuid": {uuid}, "prefix": {prefix}}, "application/json", nil)
+	return err
+}
+
+// SetClientSchedule replaces bandwidth schedule of client of uuid (e.g., "00:00-06:00:unlimited,else:1MB"; empty: never limited)
+func (c *Client) SetClientSchedule(uuid string, window string) error {
+	_, err := c.Post("/api/v1/server/schedule/clients", neturl.Values{"uuid": {uuid}, "window": {window}}, "application/json", nil)
+	return err
+}
+
+// SyncNow asks connected client of uuid to run a full sync pass right away and returns changes exchanged by the pass
+// server responds 409 Conflict with CLIENT_NOT_CONNECTED when client is not connected, and 404 Not Found for unknown client
+func (c *Client) SyncNow(uuid string) (*types.SyncNowRes, error) {
+	response, err := c.Post("/api/v1/server/clients/"+neturl.PathEscape(uuid)+"/sync", nil, "application/json", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	syncNowRes := &types.SyncNowRes{}
+	err = utils.UnmarshalRequestBody(response.Bytes(), syncNowRes)
+	if err != nil {
+		return nil, err
+	}
+
+	return syncNowRes, nil
+}
+
+// UnsubscribeClient removes subscription of prefix (every subscription when prefix is empty) of client of uuid
+func (c *Client) UnsubscribeClient(uuid string, prefix string) error {
+	_, err := c.Post("/api/v1/server/unsubscribe/clients", neturl.Values{"uuid": {uuid}, "prefix": {prefix}}, "application/json", nil)
+	return err
+}
+
+// ProvisionClients creates or updates clients of entries in one request and returns result of each entry
+// nothing is applied when any entry is invalid (see Applied of result) or dryRun is true
+func (c *Client) ProvisionClients(entries []types.ProvisionEntry, dryRun bool) (*types.ProvisionRes, error) {
+	body, err := json.Marshal(entries)
+	if err != nil {
+		return nil, err
+	}
+
+	query := neturl.Values{}
+	if dryRun {
+		query.Set("dryRun", "true")
+	}
+
+	response, err := c.Post("/api/v1/server/provision/clients", query, "application/json", body)
+	if err != nil {
+		return nil, err
+	}
+
+	provisionRes := &types.ProvisionRes{}
+	err = utils.UnmarshalRequestBody(response.Bytes(), provisionRes)
+	if err != nil {
+		return nil, err
+	}
+
+	return provisionRes, nil
+}
+
+// WatchEvents calls handle with each change event under afterPath (every event when afterPath is empty)
+// until server closes stream or handle returns error
+func (c *Client) WatchEvents(afterPath string, handle func(event *types.Event) error) error {
+	stream, err := c.GetStream("/api/v1/server/events", neturl.Values{"afterPath": {afterPath}})
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	// read server-sent events line by line
+	scanner := bufio.NewScanner(stream)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+
+		event := &types.Event{}
+		err = json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), event)
+		if err != nil {
+			log.Println("quics err: ", err)
+			continue
+		}
+
+		err = handle(event)
+		if err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
@@ -0,0 +1,29 @@
+package client
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestContentsOf(t *testing.T) {
+	tests := []struct {
+		name     string
+		response *bytes.Buffer
+		want     string
+	}{
+		{name: "zero-byte file", response: &bytes.Buffer{}, want: ""},
+		{name: "contents", response: bytes.NewBufferString("contents"), want: "contents"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := contentsOf(tt.response)
+			if got == nil {
+				t.Fatal("contents are nil, which means failure of download")
+			}
+			if string(got) != tt.want {
+				t.Errorf("contentsOf() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
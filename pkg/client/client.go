@@ -0,0 +1,282 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	http3 "github.com/quic-go/quic-go/http3"
+	"github.com/quic-s/quics/pkg/config"
+	"github.com/quic-s/quics/pkg/types"
+	"github.com/quic-s/quics/pkg/utils"
+)
+
+// DefaultBaseURL is the address of rest server (http/3) started with default configuration
+const DefaultBaseURL = "https://" + config.DefaultRestServerAddr + ":" + config.DefaultRestServerH3Port
+
+// Client requests rest api of quic-s server over http/3
+type Client struct {
+	baseURL       string
+	authorization string
+	adminToken    string
+	timeout       time.Duration
+	tlsConfig     *tls.Config
+
+	qconf        *quic.Config
+	roundTripper *http3.RoundTripper
+	hclient      *http.Client
+}
+
+// Option configures Client created by New
+type Option func(*Client)
+
+// WithBaseURL sets the address of rest server (e.g., https://quics.example.com:6121)
+func WithBaseURL(baseURL string) Option {
+	return func(c *Client) {
+		c.baseURL = strings.TrimSuffix(baseURL, "/")
+	}
+}
+
+// WithAuthorization sets Authorization header of every request
+// (e.g., "Bearer <token>" when rest server is behind authenticating proxy)
+func WithAuthorization(authorization string) Option {
+	return func(c *Client) {
+		c.authorization = authorization
+	}
+}
+
+// WithAdminToken sends admin token of running server (written to utils.GetAdminTokenPath), so that listings are not redacted
+// by REDACT_FIELDS of server
+func WithAdminToken(adminToken string) Option {
+	return func(c *Client) {
+		c.adminToken = adminToken
+	}
+}
+
+// WithTimeout limits the time of each request including reading its response (0: no limit)
+// streams (e.g., WatchEvents, StreamLogs) are not limited, because they are open until server closes them
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = timeout
+	}
+}
+
+// WithTLSConfig sets tls config used to verify rest server (e.g., RootCAs with certificate of server)
+func WithTLSConfig(tlsConfig *tls.Config) Option {
+	return func(c *Client) {
+		c.tlsConfig = tlsConfig
+	}
+}
+
+// New creates Client of rest server at DefaultBaseURL unless WithBaseURL is given
+func New(opts ...Option) *Client {
+	c := &Client{
+		baseURL:   DefaultBaseURL,
+		tlsConfig: &tls.Config{},
+		qconf: &quic.Config{
+			KeepAlivePeriod: 60,
+		},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	c.roundTripper = &http3.RoundTripper{
+		TLSClientConfig: c.tlsConfig,
+		QuicConfig:      c.qconf,
+	}
+
+	c.hclient = &http.Client{
+		Transport: c.roundTripper,
+	}
+
+	return c
+}
+
+// StatusError is returned when rest server responds with status other than 2xx
+// Body is the message of error response (decoded when it is JSON error body)
+type StatusError struct {
+	StatusCode int
+	Status     string
+	Body       string
+	Header     http.Header // response headers (e.g., Retry-After, Quics-Api-Version)
+}
+
+func (e *StatusError) Error() string {
+	return e.Status + ": " + e.Body
+}
+
+// Get requests path with query and returns whole response body
+func (c *Client) Get(path string, query neturl.Values) (*bytes.Buffer, error) {
+	return c.do(http.MethodGet, path, query, "", nil)
+}
+
+// Post requests path with query and content and returns whole response body
+func (c *Client) Post(path string, query neturl.Values, contentType string, content []byte) (*bytes.Buffer, error) {
+	return c.do(http.MethodPost, path, query, contentType, content)
+}
+
+// Delete requests path with query and returns whole response body
+func (c *Client) Delete(path string, query neturl.Values) (*bytes.Buffer, error) {
+	return c.do(http.MethodDelete, path, query, "", nil)
+}
+
+// GetStream returns response body without reading it to the end (e.g., event stream)
+// the caller must close returned body
+func (c *Client) GetStream(path string, query neturl.Values) (io.ReadCloser, error) {
+	req, err := c.newRequest(context.Background(), http.MethodGet, path, query, "", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	rsp, err := c.hclient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isSuccess(rsp.StatusCode) {
+		defer rsp.Body.Close()
+
+		body := &bytes.Buffer{}
+		io.Copy(body, rsp.Body)
+		return nil, newStatusError(rsp, body.Bytes())
+	}
+
+	return rsp.Body, nil
+}
+
+// Close closes connections to rest server
+func (c *Client) Close() error {
+	c.hclient.CloseIdleConnections()
+
+	return c.roundTripper.Close()
+}
+
+func (c *Client) do(method string, path string, query neturl.Values, contentType string, content []byte) (*bytes.Buffer, error) {
+	ctx := context.Background()
+	if c.timeout != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	req, err := c.newRequest(ctx, method, path, query, contentType, content)
+	if err != nil {
+		return nil, err
+	}
+
+	rsp, err := c.hclient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+
+	body := &bytes.Buffer{}
+	_, err = io.Copy(body, rsp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	// error response must not be handled as requested data (e.g., decoded as json or written as downloaded file)
+	if !isSuccess(rsp.StatusCode) {
+		return nil, newStatusError(rsp, body.Bytes())
+	}
+
+	return body, nil
+}
+
+func (c *Client) newRequest(ctx context.Context, method string, path string, query neturl.Values, contentType string, content []byte) (*http.Request, error) {
+	var contentReader io.Reader
+	if content != nil {
+		contentReader = bytes.NewReader(content)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, buildURL(c.baseURL, path, query), contentReader)
+	if err != nil {
+		return nil, err
+	}
+
+	// server rejects request of api version which it does not support (see IsIncompatible)
+	req.Header.Set(types.APIVersionHeader, strconv.Itoa(types.APIVersion))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.authorization != "" {
+		req.Header.Set("Authorization", c.authorization)
+	}
+	if c.adminToken != "" {
+		req.Header.Set(types.AdminTokenHeader, c.adminToken)
+	}
+
+	return req, nil
+}
+
+// isSuccess checks whether status code of response is 2xx
+func isSuccess(statusCode int) bool {
+	return statusCode >= http.StatusOK && statusCode < http.StatusMultipleChoices
+}
+
+func newStatusError(rsp *http.Response, body []byte) error {
+	return &StatusError{
+		StatusCode: rsp.StatusCode,
+		Status:     rsp.Status,
+		Body:       utils.BodySnippet(errorMessageOf(body)),
+		Header:     rsp.Header,
+	}
+}
+
+// errorMessageOf returns message of error response body, so that it is shown instead of raw body
+// server writes plain text, but JSON error body (e.g., {"error":"..."} or {"message":"..."} of proxy in front of server) is decoded
+func errorMessageOf(body []byte) []byte {
+	body = bytes.TrimSpace(body)
+
+	fields := map[string]any{}
+	if json.Unmarshal(body, &fields) != nil {
+		return body
+	}
+	for _, key := range []string{"error", "message"} {
+		if message, ok := fields[key].(string); ok && message != "" {
+			return []byte(message)
+		}
+	}
+
+	return body
+}
+
+// buildURL joins base, path and query escaping them, so that paths with spaces or reserved characters (e.g., ?, &, #) are sent as they are
+func buildURL(base string, path string, query neturl.Values) string {
+	u := &neturl.URL{
+		Path:     path,
+		RawQuery: query.Encode(),
+	}
+
+	return strings.TrimSuffix(base, "/") + u.String()
+}
+
+// IsStatus checks whether err is StatusError of rest server with status code (e.g., http.StatusNotFound)
+func IsStatus(err error, statusCode int) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == statusCode
+}
+
+// IsBulkOperationRunning checks whether err is rejection of destructive bulk operation while another one is running on server
+func IsBulkOperationRunning(err error) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) && strings.Contains(statusErr.Body, types.BulkOperationRunning)
+}
+
+// IsIncompatible checks whether err is rejection of rest server which does not support api version of this client
+// (Header of StatusError has the range supported by server in Quics-Api-Min-Version and Quics-Api-Version)
+func IsIncompatible(err error) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) && strings.Contains(statusErr.Body, types.VersionIncompatible)
+}
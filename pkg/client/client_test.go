@@ -0,0 +1,72 @@
+package client
+
+import (
+	neturl "net/url"
+	"testing"
+)
+
+func TestBuildURL(t *testing.T) {
+	tests := []struct {
+		name  string
+		base  string
+		path  string
+		query neturl.Values
+		want  string
+	}{
+		{
+			name: "no query",
+			base: "https://localhost:6121",
+			path: "/api/v1/server/logs/clients",
+			want: "https://localhost:6121/api/v1/server/logs/clients",
+		},
+		{
+			name: "trailing slash of base",
+			base: "https://localhost:6121/",
+			path: "/api/v1/server/logs/clients",
+			want: "https://localhost:6121/api/v1/server/logs/clients",
+		},
+		{
+			name:  "query with spaces",
+			base:  "https://localhost:6121",
+			path:  "/api/v1/server/logs/files",
+			query: neturl.Values{"path": {"/root/my docs/a b.txt"}},
+			want:  "https://localhost:6121/api/v1/server/logs/files?path=%2Froot%2Fmy+docs%2Fa+b.txt",
+		},
+		{
+			name:  "query with reserved characters",
+			base:  "https://localhost:6121",
+			path:  "/api/v1/server/logs/files",
+			query: neturl.Values{"path": {"/root/a?b&c=d#e+f%g.txt"}},
+			want:  "https://localhost:6121/api/v1/server/logs/files?path=%2Froot%2Fa%3Fb%26c%3Dd%23e%2Bf%25g.txt",
+		},
+		{
+			name: "path with spaces and reserved characters",
+			base: "https://localhost:6121",
+			path: "/api/v1/files/root/a b?#%.txt",
+			want: "https://localhost:6121/api/v1/files/root/a%20b%3F%23%25.txt",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := buildURL(tt.base, tt.path, tt.query)
+			if got != tt.want {
+				t.Fatalf("buildURL() = %s, want %s", got, tt.want)
+			}
+
+			// server reads the same path and query as they are given
+			parsed, err := neturl.Parse(got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if parsed.Path != tt.path {
+				t.Errorf("path = %q, want %q", parsed.Path, tt.path)
+			}
+			for key := range tt.query {
+				if parsed.Query().Get(key) != tt.query.Get(key) {
+					t.Errorf("query %s = %q, want %q", key, parsed.Query().Get(key), tt.query.Get(key))
+				}
+			}
+		})
+	}
+}
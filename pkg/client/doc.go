@@ -0,0 +1,60 @@
+// Package client is Go client of rest api of quic-s server (the one `qis` uses).
+//
+// Client requests rest server over http/3 and returns structs of package types.
+// Error response of server is returned as *StatusError.
+// The examples below are also runnable examples of the package (see example_test.go).
+//
+// Show a file and download its latest version:
+//
+//	c := client.New(
+//		client.WithBaseURL("https://quics.example.com:6121"),
+//		client.WithTimeout(30*time.Second),
+//	)
+//	defer c.Close()
+//
+//	file, err := c.GetFile("/root/docs/a.txt")
+//	if err != nil {
+//		return err
+//	}
+//	contents, err := c.DownloadFile(file.AfterPath, file.LatestSyncTimestamp)
+//
+// Upload a file and remove it with its stored contents and histories:
+//
+//	file, err := c.Upload("/root/docs/b.txt", []byte("hello"))
+//	if err != nil {
+//		return err
+//	}
+//	removed, err := c.RemoveFile(file.AfterPath, client.RemoveFileOptions{Purge: true})
+//
+// Upload several files as one commit set, so that their new versions appear at once:
+//
+//	commitSet, err := c.OpenCommitSet("release")
+//	if err != nil {
+//		return err
+//	}
+//	_, err = c.StageCommitFile(commitSet.ID, "/root/src/main.go", code)
+//	_, err = c.StageCommitFile(commitSet.ID, "/root/src/main_gen.go", generated)
+//	commitSet, err = c.CommitSet(commitSet.ID)
+//
+// List every history matched with glob pattern following pages:
+//
+//	histories, err := client.ListAll(nil, func(page *client.PageOptions) (*types.Page[types.FileHistory], error) {
+//		return c.ListHistories("/root/docs/*.txt", page)
+//	})
+//
+// Verify server with its certificate (self-signed certificate of server is not trusted by default):
+//
+//	pem, err := os.ReadFile("cert-quics.pem")
+//	if err != nil {
+//		return err
+//	}
+//	pool := x509.NewCertPool()
+//	pool.AppendCertsFromPEM(pem)
+//	c := client.New(client.WithTLSConfig(&tls.Config{RootCAs: pool}))
+//
+// Requests with StatusError of certain status can be checked with IsStatus:
+//
+//	if client.IsStatus(err, http.StatusBadRequest) {
+//		// e.g., invalid glob pattern
+//	}
+package client
@@ -0,0 +1,111 @@
+package client_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/quic-s/quics/pkg/client"
+	"github.com/quic-s/quics/pkg/types"
+)
+
+// Show a file and download its latest version
+func Example() {
+	c := client.New(
+		client.WithBaseURL("https://quics.example.com:6121"),
+		client.WithTimeout(30*time.Second),
+	)
+	defer c.Close()
+
+	file, err := c.GetFile("/root/docs/a.txt")
+	if err != nil {
+		log.Fatal(err)
+	}
+	contents, err := c.DownloadFile(file.AfterPath, file.LatestSyncTimestamp)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(string(contents))
+}
+
+// Upload a file and remove it with its stored contents and histories
+func ExampleClient_RemoveFile() {
+	c := client.New(client.WithBaseURL("https://quics.example.com:6121"))
+	defer c.Close()
+
+	file, err := c.Upload("/root/docs/b.txt", []byte("hello"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	removed, err := c.RemoveFile(file.AfterPath, client.RemoveFileOptions{Purge: true})
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("removed files:", removed.Removed)
+}
+
+// Upload several files as one commit set, so that their new versions appear at once
+func ExampleClient_CommitSet() {
+	c := client.New(client.WithBaseURL("https://quics.example.com:6121"))
+	defer c.Close()
+
+	commitSet, err := c.OpenCommitSet("release")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if _, err := c.StageCommitFile(commitSet.ID, "/root/src/main.go", []byte("package main\n")); err != nil {
+		log.Fatal(err)
+	}
+	if _, err := c.StageCommitFile(commitSet.ID, "/root/src/main_gen.go", []byte("package main\n")); err != nil {
+		log.Fatal(err)
+	}
+	commitSet, err = c.CommitSet(commitSet.ID)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(commitSet.Status)
+}
+
+// List every history matched with glob pattern following pages
+func ExampleListAll() {
+	c := client.New(client.WithBaseURL("https://quics.example.com:6121"))
+	defer c.Close()
+
+	histories, err := client.ListAll(nil, func(page *client.PageOptions) (*types.Page[types.FileHistory], error) {
+		return c.ListHistories("/root/docs/*.txt", page)
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, history := range histories {
+		fmt.Println(history.AfterPath, history.Timestamp)
+	}
+}
+
+// Verify server with its certificate (self-signed certificate of server is not trusted by default)
+func ExampleWithTLSConfig() {
+	pem, err := os.ReadFile("cert-quics.pem")
+	if err != nil {
+		log.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(pem)
+
+	c := client.New(client.WithTLSConfig(&tls.Config{RootCAs: pool}))
+	defer c.Close()
+}
+
+// Requests with StatusError of certain status can be checked with IsStatus
+func ExampleIsStatus() {
+	err := fmt.Errorf("list histories: %w", &client.StatusError{StatusCode: http.StatusBadRequest, Status: "400 Bad Request", Body: "invalid glob pattern"})
+
+	fmt.Println(client.IsStatus(err, http.StatusBadRequest))
+	fmt.Println(client.IsStatus(err, http.StatusNotFound))
+	// Output:
+	// true
+	// false
+}
@@ -21,6 +21,59 @@ const (
 
 	DefaultQuicsCertName = "cert-quics.pem"
 	DefaultQuicsKeyName  = "key-quics.pem"
+
+	DefaultScrubInterval = "86400" // seconds (0: disabled)
+
+	DefaultMaxStreamsPerConn = "100"
+
+	DefaultHistoryLimit = "100" // histories returned when limit is not given (0: no limit)
+
+	DefaultExtensionPolicies = "" // server-wide sync policies by extension (e.g., .tmp=ignore,.mp4=no-versioning)
+
+	DefaultConverters = "" // converters used to transcode downloads (e.g., csv-json,image; empty: disabled)
+
+	DefaultTimestampSource = "server" // clock which stamps date of histories (server or client)
+
+	DefaultRegistrationAuth    = "password" // credential which client must register with (password or proof)
+	DefaultRegistrationTimeout = "10"       // seconds which new connection has to finish registration before it is closed
+
+	DefaultCacheTTL = "0" // seconds which responses of listing endpoints are cached (0: disabled)
+
+	DefaultMaxScans = "4" // full scans of database (e.g., show file --all) running at once (0: no limit)
+
+	DefaultRedactFields = "Password" // fields hidden from listings for caller without admin token (none: disabled)
+
+	DefaultSyncWaitTimeout = "5" // seconds which read given consistency token waits for its write to be visible
+
+	DefaultUploadMemoryBuffer = "8388608" // bytes of upload kept in memory before the rest spills to temp file (8 MiB)
+
+	DefaultAccessLog       = "false"
+	DefaultAccessLogBodies = "false"
+
+	DefaultBrowse = "false"
+
+	DefaultSafeMode = "false" // background mutators disabled and writes rejected to inspect troubled store
+	DefaultRepairDB = "false" // files of database which fails to open are moved aside instead of failing startup
+
+	DefaultWatchDir = "" // <local directory>:<afterPath prefix> ingested by server without client (empty: disabled)
+
+	DefaultEventWorkers   = "4"    // workers delivering events to event stream subscribers
+	DefaultEventQueueSize = "1024" // events waiting for workers before overflow
+	DefaultEventOrdering  = "path" // events of the same afterPath are delivered in order (path or none)
+	DefaultEventOverflow  = "drop" // event published while queue is full is dropped, or publisher waits (drop or block)
+
+	DefaultDiskLowSpace     = "1073741824" // bytes of free space of data directory below which low space is alerted (1 GiB; 0: disabled)
+	DefaultDiskFullReadOnly = "false"      // writes are rejected after disk became full, until free space is above DISK_LOW_SPACE
+
+	DefaultMaxPathLength = "1024" // bytes of afterPath above which new files are rejected with PATH_TOO_LONG (0: unlimited)
+	DefaultMaxPathDepth  = "64"   // components of afterPath above which new files are rejected with PATH_TOO_DEEP (0: unlimited)
+
+	DefaultHealthChecks        = "database,data-dir,tls,recovery,protocol" // checks which must pass before listeners are bound (empty: none)
+	DefaultHealthCheckInterval = "60"                                      // seconds between checks after startup, which report degraded state (0: disabled)
+
+	DefaultProtocolRestarts = "5" // times dead quics protocol listener is restarted in a row before server gives up (0: never restarted)
+
+	DefaultAutoStopAfter = "" // duration without client connections and api activity after which server stops itself (empty: disabled)
 )
 
 func init() {
@@ -82,6 +135,142 @@ func init() {
 		} else {
 			sourceViper.Set("QUICS_KEY_NAME", DefaultQuicsKeyName)
 		}
+		if scrubInterval := os.Getenv("SCRUB_INTERVAL"); scrubInterval != "" {
+			sourceViper.Set("SCRUB_INTERVAL", scrubInterval)
+		} else {
+			sourceViper.Set("SCRUB_INTERVAL", DefaultScrubInterval)
+		}
+
+		if maxStreamsPerConn := os.Getenv("MAX_STREAMS_PER_CONN"); maxStreamsPerConn != "" {
+			sourceViper.Set("MAX_STREAMS_PER_CONN", maxStreamsPerConn)
+		} else {
+			sourceViper.Set("MAX_STREAMS_PER_CONN", DefaultMaxStreamsPerConn)
+		}
+		if historyLimit := os.Getenv("HISTORY_LIMIT"); historyLimit != "" {
+			sourceViper.Set("HISTORY_LIMIT", historyLimit)
+		} else {
+			sourceViper.Set("HISTORY_LIMIT", DefaultHistoryLimit)
+		}
+		if extensionPolicies := os.Getenv("EXTENSION_POLICIES"); extensionPolicies != "" {
+			sourceViper.Set("EXTENSION_POLICIES", extensionPolicies)
+		} else {
+			sourceViper.Set("EXTENSION_POLICIES", DefaultExtensionPolicies)
+		}
+		if converters := os.Getenv("CONVERTERS"); converters != "" {
+			sourceViper.Set("CONVERTERS", converters)
+		} else {
+			sourceViper.Set("CONVERTERS", DefaultConverters)
+		}
+		if timestampSource := os.Getenv("TIMESTAMP_SOURCE"); timestampSource != "" {
+			sourceViper.Set("TIMESTAMP_SOURCE", timestampSource)
+		} else {
+			sourceViper.Set("TIMESTAMP_SOURCE", DefaultTimestampSource)
+		}
+		if registrationAuth := os.Getenv("REGISTRATION_AUTH"); registrationAuth != "" {
+			sourceViper.Set("REGISTRATION_AUTH", registrationAuth)
+		} else {
+			sourceViper.Set("REGISTRATION_AUTH", DefaultRegistrationAuth)
+		}
+		if registrationTimeout := os.Getenv("REGISTRATION_TIMEOUT"); registrationTimeout != "" {
+			sourceViper.Set("REGISTRATION_TIMEOUT", registrationTimeout)
+		} else {
+			sourceViper.Set("REGISTRATION_TIMEOUT", DefaultRegistrationTimeout)
+		}
+		if cacheTTL := os.Getenv("CACHE_TTL"); cacheTTL != "" {
+			sourceViper.Set("CACHE_TTL", cacheTTL)
+		} else {
+			sourceViper.Set("CACHE_TTL", DefaultCacheTTL)
+		}
+		if maxScans := os.Getenv("MAX_SCANS"); maxScans != "" {
+			sourceViper.Set("MAX_SCANS", maxScans)
+		} else {
+			sourceViper.Set("MAX_SCANS", DefaultMaxScans)
+		}
+		if redactFields := os.Getenv("REDACT_FIELDS"); redactFields != "" {
+			sourceViper.Set("REDACT_FIELDS", redactFields)
+		} else {
+			sourceViper.Set("REDACT_FIELDS", DefaultRedactFields)
+		}
+		if syncWaitTimeout := os.Getenv("SYNC_WAIT_TIMEOUT"); syncWaitTimeout != "" {
+			sourceViper.Set("SYNC_WAIT_TIMEOUT", syncWaitTimeout)
+		} else {
+			sourceViper.Set("SYNC_WAIT_TIMEOUT", DefaultSyncWaitTimeout)
+		}
+		if uploadMemoryBuffer := os.Getenv("UPLOAD_MEMORY_BUFFER"); uploadMemoryBuffer != "" {
+			sourceViper.Set("UPLOAD_MEMORY_BUFFER", uploadMemoryBuffer)
+		} else {
+			sourceViper.Set("UPLOAD_MEMORY_BUFFER", DefaultUploadMemoryBuffer)
+		}
+		if watchDir := os.Getenv("WATCH_DIR"); watchDir != "" {
+			sourceViper.Set("WATCH_DIR", watchDir)
+		} else {
+			sourceViper.Set("WATCH_DIR", DefaultWatchDir)
+		}
+		if eventWorkers := os.Getenv("EVENT_WORKERS"); eventWorkers != "" {
+			sourceViper.Set("EVENT_WORKERS", eventWorkers)
+		} else {
+			sourceViper.Set("EVENT_WORKERS", DefaultEventWorkers)
+		}
+		if eventQueueSize := os.Getenv("EVENT_QUEUE_SIZE"); eventQueueSize != "" {
+			sourceViper.Set("EVENT_QUEUE_SIZE", eventQueueSize)
+		} else {
+			sourceViper.Set("EVENT_QUEUE_SIZE", DefaultEventQueueSize)
+		}
+		if eventOrdering := os.Getenv("EVENT_ORDERING"); eventOrdering != "" {
+			sourceViper.Set("EVENT_ORDERING", eventOrdering)
+		} else {
+			sourceViper.Set("EVENT_ORDERING", DefaultEventOrdering)
+		}
+		if eventOverflow := os.Getenv("EVENT_OVERFLOW"); eventOverflow != "" {
+			sourceViper.Set("EVENT_OVERFLOW", eventOverflow)
+		} else {
+			sourceViper.Set("EVENT_OVERFLOW", DefaultEventOverflow)
+		}
+		if diskLowSpace := os.Getenv("DISK_LOW_SPACE"); diskLowSpace != "" {
+			sourceViper.Set("DISK_LOW_SPACE", diskLowSpace)
+		} else {
+			sourceViper.Set("DISK_LOW_SPACE", DefaultDiskLowSpace)
+		}
+		if diskFullReadOnly := os.Getenv("DISK_FULL_READ_ONLY"); diskFullReadOnly != "" {
+			sourceViper.Set("DISK_FULL_READ_ONLY", diskFullReadOnly)
+		} else {
+			sourceViper.Set("DISK_FULL_READ_ONLY", DefaultDiskFullReadOnly)
+		}
+		if maxPathLength := os.Getenv("MAX_PATH_LENGTH"); maxPathLength != "" {
+			sourceViper.Set("MAX_PATH_LENGTH", maxPathLength)
+		} else {
+			sourceViper.Set("MAX_PATH_LENGTH", DefaultMaxPathLength)
+		}
+		if maxPathDepth := os.Getenv("MAX_PATH_DEPTH"); maxPathDepth != "" {
+			sourceViper.Set("MAX_PATH_DEPTH", maxPathDepth)
+		} else {
+			sourceViper.Set("MAX_PATH_DEPTH", DefaultMaxPathDepth)
+		}
+		if healthChecks, ok := os.LookupEnv("HEALTH_CHECKS"); ok {
+			sourceViper.Set("HEALTH_CHECKS", healthChecks)
+		} else {
+			sourceViper.Set("HEALTH_CHECKS", DefaultHealthChecks)
+		}
+		if healthCheckInterval := os.Getenv("HEALTH_CHECK_INTERVAL"); healthCheckInterval != "" {
+			sourceViper.Set("HEALTH_CHECK_INTERVAL", healthCheckInterval)
+		} else {
+			sourceViper.Set("HEALTH_CHECK_INTERVAL", DefaultHealthCheckInterval)
+		}
+		if protocolRestarts := os.Getenv("PROTOCOL_RESTARTS"); protocolRestarts != "" {
+			sourceViper.Set("PROTOCOL_RESTARTS", protocolRestarts)
+		} else {
+			sourceViper.Set("PROTOCOL_RESTARTS", DefaultProtocolRestarts)
+		}
+		if autoStopAfter := os.Getenv("AUTO_STOP_AFTER"); autoStopAfter != "" {
+			sourceViper.Set("AUTO_STOP_AFTER", autoStopAfter)
+		} else {
+			sourceViper.Set("AUTO_STOP_AFTER", DefaultAutoStopAfter)
+		}
+		if dataDir := os.Getenv("DATA_DIR"); dataDir != "" {
+			sourceViper.Set("DATA_DIR", dataDir)
+		} else {
+			sourceViper.Set("DATA_DIR", utils.GetQuicsDirPath())
+		}
 
 		if err := sourceViper.WriteConfigAs(envPath); err != nil {
 			log.Fatalln("quics err: ", err)
@@ -91,6 +280,40 @@ func init() {
 		log.Panicf("quics err: while reading config file: %s", err)
 	}
 
+	// set default values for env variables added after qis.env is created
+	viper.SetDefault("SCRUB_INTERVAL", DefaultScrubInterval)
+	viper.SetDefault("DATA_DIR", utils.GetQuicsDirPath())
+	viper.SetDefault("MAX_STREAMS_PER_CONN", DefaultMaxStreamsPerConn)
+	viper.SetDefault("HISTORY_LIMIT", DefaultHistoryLimit)
+	viper.SetDefault("EXTENSION_POLICIES", DefaultExtensionPolicies)
+	viper.SetDefault("CONVERTERS", DefaultConverters)
+	viper.SetDefault("TIMESTAMP_SOURCE", DefaultTimestampSource)
+	viper.SetDefault("REGISTRATION_AUTH", DefaultRegistrationAuth)
+	viper.SetDefault("REGISTRATION_TIMEOUT", DefaultRegistrationTimeout)
+	viper.SetDefault("CACHE_TTL", DefaultCacheTTL)
+	viper.SetDefault("MAX_SCANS", DefaultMaxScans)
+	viper.SetDefault("REDACT_FIELDS", DefaultRedactFields)
+	viper.SetDefault("SYNC_WAIT_TIMEOUT", DefaultSyncWaitTimeout)
+	viper.SetDefault("UPLOAD_MEMORY_BUFFER", DefaultUploadMemoryBuffer)
+	viper.SetDefault("ACCESS_LOG", DefaultAccessLog)
+	viper.SetDefault("ACCESS_LOG_BODIES", DefaultAccessLogBodies)
+	viper.SetDefault("BROWSE", DefaultBrowse)
+	viper.SetDefault("SAFE_MODE", DefaultSafeMode)
+	viper.SetDefault("REPAIR_DB", DefaultRepairDB)
+	viper.SetDefault("WATCH_DIR", DefaultWatchDir)
+	viper.SetDefault("EVENT_WORKERS", DefaultEventWorkers)
+	viper.SetDefault("EVENT_QUEUE_SIZE", DefaultEventQueueSize)
+	viper.SetDefault("EVENT_ORDERING", DefaultEventOrdering)
+	viper.SetDefault("EVENT_OVERFLOW", DefaultEventOverflow)
+	viper.SetDefault("DISK_LOW_SPACE", DefaultDiskLowSpace)
+	viper.SetDefault("DISK_FULL_READ_ONLY", DefaultDiskFullReadOnly)
+	viper.SetDefault("MAX_PATH_LENGTH", DefaultMaxPathLength)
+	viper.SetDefault("MAX_PATH_DEPTH", DefaultMaxPathDepth)
+	viper.SetDefault("HEALTH_CHECKS", DefaultHealthChecks)
+	viper.SetDefault("HEALTH_CHECK_INTERVAL", DefaultHealthCheckInterval)
+	viper.SetDefault("PROTOCOL_RESTARTS", DefaultProtocolRestarts)
+	viper.SetDefault("AUTO_STOP_AFTER", DefaultAutoStopAfter)
+
 	viper.SetConfigFile(envPath)
 	viper.SetConfigType("env")
 	err = viper.ReadInConfig()
@@ -110,9 +333,12 @@ func GetViperEnvVariables(key string) string {
 func WriteViperEnvVariables(key string, value string) error {
 	envPath := filepath.Join(utils.GetQuicsDirPath(), "qis.env")
 
+	previous := viper.GetString(key)
 	viper.Set(key, value)
 	err := viper.WriteConfigAs(envPath)
 	if err != nil {
+		// value in memory is kept as it is in env file
+		viper.Set(key, previous)
 		err = errors.New("while writing config file: " + err.Error())
 		return err
 	}
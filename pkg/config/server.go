@@ -1,6 +1,19 @@
 package config
 
-import "errors"
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/quic-s/quics/pkg/convert"
+	"github.com/quic-s/quics/pkg/types"
+	"github.com/quic-s/quics/pkg/utils"
+	"github.com/spf13/viper"
+	"golang.org/x/exp/slices"
+)
 
 func GetRestServerAddress() string {
 	serverIP := GetViperEnvVariables("REST_SERVER_ADDR") + ":"
@@ -42,3 +55,353 @@ func SetServerAddress(ip string, port string, port3 string) error {
 	}
 	return nil
 }
+
+func SetScrubInterval(interval string) error {
+	if interval == "" {
+		return nil
+	}
+
+	_, err := strconv.ParseUint(interval, 10, 64)
+	if err != nil {
+		err = errors.New("while setting scrub interval: " + err.Error())
+		return err
+	}
+
+	err = WriteViperEnvVariables("SCRUB_INTERVAL", interval)
+	if err != nil {
+		err = errors.New("while setting scrub interval: " + err.Error())
+		return err
+	}
+	return nil
+}
+
+func SetMaxStreamsPerConn(max string) error {
+	if max == "" {
+		return nil
+	}
+
+	n, err := strconv.ParseUint(max, 10, 31)
+	if err != nil {
+		err = errors.New("while setting max streams per connection: " + err.Error())
+		return err
+	}
+	if n == 0 {
+		return errors.New("while setting max streams per connection: must be positive")
+	}
+
+	err = WriteViperEnvVariables("MAX_STREAMS_PER_CONN", max)
+	if err != nil {
+		err = errors.New("while setting max streams per connection: " + err.Error())
+		return err
+	}
+	return nil
+}
+
+func SetHistoryLimit(limit string) error {
+	if limit == "" {
+		return nil
+	}
+
+	_, err := strconv.ParseUint(limit, 10, 64)
+	if err != nil {
+		err = errors.New("while setting history limit: " + err.Error())
+		return err
+	}
+
+	err = WriteViperEnvVariables("HISTORY_LIMIT", limit)
+	if err != nil {
+		err = errors.New("while setting history limit: " + err.Error())
+		return err
+	}
+	return nil
+}
+
+func SetExtensionPolicies(policies string) error {
+	if policies == "" {
+		return nil
+	}
+
+	_, err := utils.ParseSyncPolicies(policies)
+	if err != nil {
+		err = errors.New("while setting extension policies: " + err.Error())
+		return err
+	}
+
+	err = WriteViperEnvVariables("EXTENSION_POLICIES", policies)
+	if err != nil {
+		err = errors.New("while setting extension policies: " + err.Error())
+		return err
+	}
+	return nil
+}
+
+func SetConverters(converters string) error {
+	if converters == "" {
+		return nil
+	}
+
+	_, err := convert.NewRegistry(converters)
+	if err != nil {
+		err = errors.New("while setting converters: " + err.Error())
+		return err
+	}
+
+	err = WriteViperEnvVariables("CONVERTERS", converters)
+	if err != nil {
+		err = errors.New("while setting converters: " + err.Error())
+		return err
+	}
+	return nil
+}
+
+func SetTimestampSource(source string) error {
+	if source == "" {
+		return nil
+	}
+
+	if source != types.TimestampSourceServer && source != types.TimestampSourceClient {
+		return errors.New("while setting timestamp source: unknown source (server or client): " + source)
+	}
+
+	err := WriteViperEnvVariables("TIMESTAMP_SOURCE", source)
+	if err != nil {
+		err = errors.New("while setting timestamp source: " + err.Error())
+		return err
+	}
+	return nil
+}
+
+func SetCacheTTL(ttl string) error {
+	if ttl == "" {
+		return nil
+	}
+
+	_, err := strconv.ParseUint(ttl, 10, 64)
+	if err != nil {
+		err = errors.New("while setting cache ttl: " + err.Error())
+		return err
+	}
+
+	err = WriteViperEnvVariables("CACHE_TTL", ttl)
+	if err != nil {
+		err = errors.New("while setting cache ttl: " + err.Error())
+		return err
+	}
+	return nil
+}
+
+func SetMaxScans(maxScans string) error {
+	if maxScans == "" {
+		return nil
+	}
+
+	_, err := strconv.ParseUint(maxScans, 10, 31)
+	if err != nil {
+		err = errors.New("while setting max scans: " + err.Error())
+		return err
+	}
+
+	err = WriteViperEnvVariables("MAX_SCANS", maxScans)
+	if err != nil {
+		err = errors.New("while setting max scans: " + err.Error())
+		return err
+	}
+	return nil
+}
+
+// SetRedactFields sets fields hidden from listing responses for caller without admin token (e.g., Password,Owner=mask,clients:Ip=mask)
+func SetRedactFields(fields string) error {
+	if fields == "" {
+		return nil
+	}
+
+	_, err := utils.ParseRedactRules(fields)
+	if err != nil {
+		err = errors.New("while setting redact fields: " + err.Error())
+		return err
+	}
+
+	err = WriteViperEnvVariables("REDACT_FIELDS", fields)
+	if err != nil {
+		err = errors.New("while setting redact fields: " + err.Error())
+		return err
+	}
+	return nil
+}
+
+// SetProtocolRestarts sets how many times in a row dead quics protocol listener is restarted before server gives up
+func SetProtocolRestarts(restarts string) error {
+	if restarts == "" {
+		return nil
+	}
+
+	_, err := strconv.ParseUint(restarts, 10, 31)
+	if err != nil {
+		err = errors.New("while setting protocol restarts: " + err.Error())
+		return err
+	}
+
+	err = WriteViperEnvVariables("PROTOCOL_RESTARTS", restarts)
+	if err != nil {
+		err = errors.New("while setting protocol restarts: " + err.Error())
+		return err
+	}
+	return nil
+}
+
+// SetHealthChecks selects comma separated checks which must pass before listeners are bound ("none": no check)
+func SetHealthChecks(checks string) error {
+	if checks == "" {
+		return nil
+	}
+
+	_, err := ParseHealthChecks(checks)
+	if err != nil {
+		err = errors.New("while setting health checks: " + err.Error())
+		return err
+	}
+
+	err = WriteViperEnvVariables("HEALTH_CHECKS", checks)
+	if err != nil {
+		err = errors.New("while setting health checks: " + err.Error())
+		return err
+	}
+	return nil
+}
+
+// ParseHealthChecks parses comma separated names of types.HealthChecks (empty or "none": no check)
+func ParseHealthChecks(checks string) ([]string, error) {
+	parsed := []string{}
+	if strings.TrimSpace(checks) == "" || strings.TrimSpace(checks) == "none" {
+		return parsed, nil
+	}
+
+	for _, check := range strings.Split(checks, ",") {
+		check = strings.TrimSpace(check)
+		if !slices.Contains(types.HealthChecks, check) {
+			return nil, errors.New("unknown health check (" + strings.Join(types.HealthChecks, ", ") + "): " + check)
+		}
+		if !slices.Contains(parsed, check) {
+			parsed = append(parsed, check)
+		}
+	}
+	return parsed, nil
+}
+
+// SetAccessLog enables access log of rest server for this run only (it is not written to qis.env)
+// bodies enables logging of request/response bodies as well, so it implies enabled
+func SetAccessLog(enabled bool, bodies bool) {
+	if bodies {
+		viper.Set("ACCESS_LOG_BODIES", "true")
+		enabled = true
+	}
+	if enabled {
+		viper.Set("ACCESS_LOG", "true")
+	}
+}
+
+// SetBrowse enables read-only directory index of rest server for this run only (it is not written to qis.env)
+func SetBrowse(enabled bool) {
+	if enabled {
+		viper.Set("BROWSE", "true")
+	}
+}
+
+// SetSafeMode starts server in safe mode for this run only (it is not written to qis.env),
+// so that server starts normally again once it is restarted without it
+func SetSafeMode(enabled bool) {
+	if enabled {
+		viper.Set("SAFE_MODE", "true")
+	}
+}
+
+// SetRepairDB repairs database which fails to open for this run only (it is not written to qis.env),
+// so that files of database are never moved aside without operator asking for it
+func SetRepairDB(enabled bool) {
+	if enabled {
+		viper.Set("REPAIR_DB", "true")
+	}
+}
+
+// SetAutoStopAfter stops server after it has been idle for duration (e.g., 10m) for this run only
+// (it is not written to qis.env, so that ephemeral server in CI does not leave it behind for long-running one)
+func SetAutoStopAfter(duration string) error {
+	if duration == "" {
+		return nil
+	}
+
+	autoStopAfter, err := time.ParseDuration(duration)
+	if err != nil {
+		err = errors.New("while setting auto stop after: " + err.Error())
+		return err
+	}
+	if autoStopAfter <= 0 {
+		return errors.New("while setting auto stop after: duration must be positive: " + duration)
+	}
+
+	viper.Set("AUTO_STOP_AFTER", duration)
+	return nil
+}
+
+// SetWatchDir ingests local directory into afterPath prefix (<local directory>:<afterPath prefix>) for this run only
+// (it is not written to qis.env; set WATCH_DIR to keep it)
+func SetWatchDir(watchDir string) error {
+	if watchDir == "" {
+		return nil
+	}
+
+	_, _, err := utils.ParseWatchDir(watchDir)
+	if err != nil {
+		err = errors.New("while setting watch dir: " + err.Error())
+		return err
+	}
+
+	viper.Set("WATCH_DIR", watchDir)
+	return nil
+}
+
+func SetDataDir(dir string) error {
+	if dir == "" {
+		return nil
+	}
+
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		err = errors.New("while setting data directory: " + err.Error())
+		return err
+	}
+
+	err = WriteViperEnvVariables("DATA_DIR", absDir)
+	if err != nil {
+		err = errors.New("while setting data directory: " + err.Error())
+		return err
+	}
+	return nil
+}
+
+// PrepareDataDir creates data directory (configured one when dir is empty) if it is missing and checks it is writable
+func PrepareDataDir(dir string) (string, error) {
+	if dir == "" {
+		dir = GetViperEnvVariables("DATA_DIR")
+	}
+
+	dataDir, err := filepath.Abs(dir)
+	if err != nil {
+		err = errors.New("while preparing data directory: " + err.Error())
+		return "", err
+	}
+
+	err = os.MkdirAll(dataDir, 0755)
+	if err != nil {
+		err = errors.New("while preparing data directory: " + err.Error())
+		return "", err
+	}
+
+	err = utils.CheckDirWritable(dataDir)
+	if err != nil {
+		err = errors.New("data directory is not writable: " + err.Error())
+		return "", err
+	}
+
+	return dataDir, nil
+}
@@ -0,0 +1,110 @@
+package convert
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+)
+
+// MaxImagePixels bounds size of decoded image, so that small file of huge dimensions can not exhaust memory
+const MaxImagePixels = 50_000_000
+
+// csvConverters converts csv with header row to json array of objects keyed by header
+func csvConverters() []Converter {
+	return []Converter{
+		{Source: "text/csv", Target: "application/json", Convert: csvToJSON},
+	}
+}
+
+func csvToJSON(ctx context.Context, src []byte) ([]byte, error) {
+	reader := csv.NewReader(NewContextReader(ctx, src))
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return []byte("[]"), nil
+	}
+	if err != nil {
+		return nil, errors.New("[csvToJSON] " + err.Error())
+	}
+
+	rows := []map[string]string{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.New("[csvToJSON] " + err.Error())
+		}
+
+		row := map[string]string{}
+		for i, field := range record {
+			if i < len(header) {
+				row[header[i]] = field
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	return json.Marshal(rows)
+}
+
+// imageConverters converts each of png, jpeg and gif to the others
+func imageConverters() []Converter {
+	encoders := map[string]func(io.Writer, image.Image) error{
+		"image/png": png.Encode,
+		"image/jpeg": func(w io.Writer, img image.Image) error {
+			return jpeg.Encode(w, img, &jpeg.Options{Quality: jpeg.DefaultQuality})
+		},
+		"image/gif": func(w io.Writer, img image.Image) error {
+			return gif.Encode(w, img, nil)
+		},
+	}
+
+	converters := []Converter{}
+	for source := range encoders {
+		for target, encode := range encoders {
+			if source == target {
+				continue
+			}
+			converters = append(converters, Converter{Source: source, Target: target, Convert: imageEncoder(encode)})
+		}
+	}
+	return converters
+}
+
+func imageEncoder(encode func(io.Writer, image.Image) error) func(ctx context.Context, src []byte) ([]byte, error) {
+	return func(ctx context.Context, src []byte) ([]byte, error) {
+		config, _, err := image.DecodeConfig(bytes.NewReader(src))
+		if err != nil {
+			return nil, errors.New("[imageEncoder] " + err.Error())
+		}
+		if config.Width*config.Height > MaxImagePixels {
+			return nil, errors.New("[imageEncoder] image is too large to convert")
+		}
+
+		img, _, err := image.Decode(NewContextReader(ctx, src))
+		if ctx.Err() != nil {
+			// decoder reports failed read as unknown format
+			return nil, errors.New("[imageEncoder] " + ctx.Err().Error())
+		}
+		if err != nil {
+			return nil, errors.New("[imageEncoder] " + err.Error())
+		}
+
+		dst := &bytes.Buffer{}
+		err = encode(&contextWriter{ctx: ctx, writer: dst}, img)
+		if err != nil {
+			return nil, errors.New("[imageEncoder] " + err.Error())
+		}
+		return dst.Bytes(), nil
+	}
+}
@@ -0,0 +1,213 @@
+package convert
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// MaxInputSize is the largest contents converted on download (bigger files are refused before they are read)
+	MaxInputSize = 32 << 20
+
+	// MaxOutputSize is the largest converted contents returned (e.g., json of wide csv is larger than its source)
+	MaxOutputSize = 64 << 20
+
+	// Timeout is the longest time of one conversion
+	Timeout = 10 * time.Second
+)
+
+// ErrNoConverter is returned when no enabled converter transcodes source MIME type to target MIME type
+var ErrNoConverter = errors.New("no converter for requested content type")
+
+// Converter transcodes contents of Source MIME type to Target MIME type
+// Convert works only on given bytes in memory (it must not touch file system, network or other processes),
+// and it must return soon after ctx is done (e.g., by reading src with NewContextReader), since it is abandoned on timeout
+type Converter struct {
+	Source  string
+	Target  string
+	Convert func(ctx context.Context, src []byte) ([]byte, error)
+}
+
+// Registry holds converters keyed by source/target MIME type
+// converters are opt-in, so registry of NewRegistry("") converts nothing
+type Registry struct {
+	converters map[string]Converter
+}
+
+// builtins are converters enabled by name (e.g., CONVERTERS=csv-json,image)
+var builtins = map[string][]Converter{
+	"csv-json": csvConverters(),
+	"image":    imageConverters(),
+}
+
+// known MIME types of converted contents (mime package does not know every one of them on every platform)
+var knownTypes = map[string]string{
+	".csv":  "text/csv",
+	".json": "application/json",
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".gif":  "image/gif",
+}
+
+// NewRegistry creates registry with builtin converters of comma separated names
+func NewRegistry(names string) (*Registry, error) {
+	r := &Registry{
+		converters: map[string]Converter{},
+	}
+
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		converters, ok := builtins[name]
+		if !ok {
+			return nil, errors.New("unknown converter (expected one of " + strings.Join(Names(), ", ") + "): " + name)
+		}
+		for _, converter := range converters {
+			r.Register(converter)
+		}
+	}
+
+	return r, nil
+}
+
+// Names returns names of builtin converters
+func Names() []string {
+	return []string{"csv-json", "image"}
+}
+
+// Register adds converter replacing the one of same source/target MIME type
+func (r *Registry) Register(converter Converter) {
+	r.converters[converter.Source+">"+converter.Target] = converter
+}
+
+// Convert transcodes src of source MIME type to target MIME type
+// conversion is bounded by MaxInputSize, MaxOutputSize and Timeout, and panic of converter is returned as error
+func (r *Registry) Convert(source string, target string, src []byte) ([]byte, error) {
+	converter, ok := r.converters[source+">"+target]
+	if !ok {
+		return nil, fmt.Errorf("%w (%s to %s)", ErrNoConverter, source, target)
+	}
+	if len(src) > MaxInputSize {
+		return nil, fmt.Errorf("[Registry.Convert] contents are larger than %d bytes", MaxInputSize)
+	}
+
+	// converter is stopped by cancellation of ctx when it times out, so that it does not keep running after Convert returns
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+
+	type result struct {
+		dst []byte
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				done <- result{err: fmt.Errorf("[Registry.Convert] converter of %s to %s panicked: %v", source, target, p)}
+			}
+		}()
+
+		dst, err := converter.Convert(ctx, src)
+		done <- result{dst: dst, err: err}
+	}()
+
+	select {
+	case res := <-done:
+		if res.err != nil {
+			return nil, res.err
+		}
+		if len(res.dst) > MaxOutputSize {
+			return nil, fmt.Errorf("[Registry.Convert] converted contents are larger than %d bytes", MaxOutputSize)
+		}
+		return res.dst, nil
+	case <-ctx.Done():
+		return nil, errors.New("[Registry.Convert] conversion of " + source + " to " + target + " timed out")
+	}
+}
+
+// contextReader fails reads once ctx is done
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+// NewContextReader returns reader of src which fails with error of ctx once ctx is done,
+// so that decoder reading it stops at the next read after cancellation
+func NewContextReader(ctx context.Context, src []byte) io.Reader {
+	return &contextReader{ctx: ctx, reader: bytes.NewReader(src)}
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.reader.Read(p)
+}
+
+// contextWriter fails writes once ctx is done
+type contextWriter struct {
+	ctx    context.Context
+	writer io.Writer
+}
+
+func (w *contextWriter) Write(p []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return w.writer.Write(p)
+}
+
+// TypeOf guesses MIME type of file by extension of afterPath (empty if it is unknown)
+func TypeOf(afterPath string) string {
+	return typeOfExt(strings.ToLower(filepath.Ext(afterPath)))
+}
+
+// ParseTarget returns MIME type of requested target given as MIME type (e.g., application/json) or extension (e.g., json, .json)
+func ParseTarget(accept string) (string, error) {
+	accept = strings.ToLower(strings.TrimSpace(accept))
+	if strings.Contains(accept, "/") {
+		mimeType, _, _ := strings.Cut(accept, ";")
+		return strings.TrimSpace(mimeType), nil
+	}
+
+	mimeType := typeOfExt("." + strings.TrimPrefix(accept, "."))
+	if mimeType == "" {
+		return "", fmt.Errorf("%w (unknown content type: %s)", ErrNoConverter, accept)
+	}
+	return mimeType, nil
+}
+
+// ExtensionOf returns extension of MIME type used to name converted file (empty if it is unknown)
+func ExtensionOf(mimeType string) string {
+	for _, ext := range []string{".csv", ".json", ".png", ".jpg", ".gif"} {
+		if knownTypes[ext] == mimeType {
+			return ext
+		}
+	}
+
+	exts, err := mime.ExtensionsByType(mimeType)
+	if err != nil || len(exts) == 0 {
+		return ""
+	}
+	return exts[0]
+}
+
+func typeOfExt(ext string) string {
+	if mimeType, ok := knownTypes[ext]; ok {
+		return mimeType
+	}
+
+	mimeType, _, _ := strings.Cut(mime.TypeByExtension(ext), ";")
+	return mimeType
+}
@@ -0,0 +1,72 @@
+package convert
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"testing"
+)
+
+func TestConvertersStopOnCancel(t *testing.T) {
+	img := &bytes.Buffer{}
+	if err := png.Encode(img, image.NewRGBA(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+	registry, err := NewRegistry("csv-json,image")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		source   string
+		target   string
+		src      []byte
+		canceled bool
+		wantErr  error
+	}{
+		{name: "csv", source: "text/csv", target: "application/json", src: []byte("a,b\n1,2\n")},
+		{name: "csv canceled", source: "text/csv", target: "application/json", src: []byte("a,b\n1,2\n"), canceled: true, wantErr: context.Canceled},
+		{name: "image", source: "image/png", target: "image/gif", src: img.Bytes()},
+		{name: "image canceled", source: "image/png", target: "image/gif", src: img.Bytes(), canceled: true, wantErr: context.Canceled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.canceled {
+				cancel()
+			}
+
+			dst, err := registry.converters[tt.source+">"+tt.target].Convert(ctx, tt.src)
+			if tt.wantErr != nil {
+				// converters wrap errors as text
+				if err == nil || !bytes.Contains([]byte(err.Error()), []byte(tt.wantErr.Error())) {
+					t.Fatalf("Convert() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || len(dst) == 0 {
+				t.Fatalf("Convert() = %d bytes, %v", len(dst), err)
+			}
+		})
+	}
+}
+
+func TestRegistryConvertPanic(t *testing.T) {
+	registry := &Registry{converters: map[string]Converter{}}
+	registry.Register(Converter{Source: "text/csv", Target: "application/json", Convert: func(ctx context.Context, src []byte) ([]byte, error) {
+		panic("broken")
+	}})
+
+	_, err := registry.Convert("text/csv", "application/json", []byte("a"))
+	if err == nil {
+		t.Fatal("panic of converter is not returned as error")
+	}
+	if _, err := registry.Convert("text/csv", "image/png", []byte("a")); !errors.Is(err, ErrNoConverter) {
+		t.Fatalf("Convert() error = %v, want %v", err, ErrNoConverter)
+	}
+}
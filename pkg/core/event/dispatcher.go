@@ -0,0 +1,86 @@
+package event
+
+import (
+	"hash/fnv"
+	"sync/atomic"
+
+	"github.com/quic-s/quics/pkg/types"
+)
+
+// dispatcher delivers published events by bounded pool of workers, so that publisher (e.g., sync) does not deliver them itself
+// with path ordering, every event of the same afterPath is queued to the same worker, so that they are delivered in order
+// while events of different paths are delivered in parallel; without ordering, workers share one queue
+type dispatcher struct {
+	ordering string
+	overflow string
+	queues   []chan types.Event
+	workers  int
+
+	published uint64
+	dropped   uint64 // events dropped because queue was full
+}
+
+func newDispatcher(workers int, queueSize int, ordering string, overflow string, deliver func(event types.Event)) *dispatcher {
+	d := &dispatcher{
+		ordering: ordering,
+		overflow: overflow,
+		workers:  workers,
+	}
+
+	if ordering == types.EventOrderingPath {
+		// queue size is shared by queues of workers
+		size := queueSize / workers
+		if size < 1 {
+			size = 1
+		}
+		for i := 0; i < workers; i++ {
+			d.queues = append(d.queues, make(chan types.Event, size))
+		}
+	} else {
+		d.queues = append(d.queues, make(chan types.Event, queueSize))
+	}
+
+	for i := 0; i < workers; i++ {
+		queue := d.queues[i%len(d.queues)]
+		go func() {
+			for event := range queue {
+				deliver(event)
+			}
+		}()
+	}
+
+	return d
+}
+
+// enqueue queues event to its worker; when queue is full, event is dropped or publisher waits for space by overflow
+func (d *dispatcher) enqueue(event types.Event) {
+	atomic.AddUint64(&d.published, 1)
+
+	queue := d.queues[0]
+	if len(d.queues) > 1 {
+		h := fnv.New32a()
+		h.Write([]byte(event.AfterPath))
+		queue = d.queues[h.Sum32()%uint32(len(d.queues))]
+	}
+
+	if d.overflow == types.EventOverflowBlock {
+		queue <- event
+		return
+	}
+
+	select {
+	case queue <- event:
+	default:
+		atomic.AddUint64(&d.dropped, 1)
+	}
+}
+
+// depth returns the number of queued events and capacity of queues
+func (d *dispatcher) depth() (int, int) {
+	depth, capacity := 0, 0
+	for _, queue := range d.queues {
+		depth += len(queue)
+		capacity += cap(queue)
+	}
+	return depth, capacity
+}
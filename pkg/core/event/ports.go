@@ -0,0 +1,9 @@
+package event
+
+import "github.com/quic-s/quics/pkg/types"
+
+type Service interface {
+	Publish(event *types.Event)
+	Subscribe(afterPath string) (<-chan types.Event, func())
+	Stats() types.EventStats
+}
@@ -0,0 +1,118 @@
+package event
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/quic-s/quics/pkg/types"
+)
+
+// size of buffered channel for each listener
+const listenerBufferSize = 64
+
+type EventService struct {
+	mut sync.RWMutex
+
+	// listeners by subscribed afterPath ("" means every path)
+	listeners map[string]map[chan types.Event]struct{}
+
+	dispatcher *dispatcher
+	delivered  uint64
+	dropped    uint64 // events dropped because listener was busy
+}
+
+// NewService returns event service delivering events by workers (EVENT_WORKERS) from queue of queueSize events (EVENT_QUEUE_SIZE)
+// ordering is types.EventOrderingPath or types.EventOrderingNone, and overflow is types.EventOverflowDrop or types.EventOverflowBlock
+func NewService(workers int, queueSize int, ordering string, overflow string) Service {
+	es := &EventService{
+		mut:       sync.RWMutex{},
+		listeners: map[string]map[chan types.Event]struct{}{},
+	}
+	es.dispatcher = newDispatcher(workers, queueSize, ordering, overflow, es.deliver)
+
+	return es
+}
+
+// Publish queues event which is delivered to listeners which subscribed the path or its parent directories
+func (es *EventService) Publish(event *types.Event) {
+	es.dispatcher.enqueue(*event)
+}
+
+// Stats returns queue depth and the number of delivered and dropped events
+func (es *EventService) Stats() types.EventStats {
+	depth, capacity := es.dispatcher.depth()
+
+	return types.EventStats{
+		Workers:         es.dispatcher.workers,
+		Ordering:        es.dispatcher.ordering,
+		Overflow:        es.dispatcher.overflow,
+		QueueDepth:      depth,
+		QueueCapacity:   capacity,
+		Published:       atomic.LoadUint64(&es.dispatcher.published),
+		Delivered:       atomic.LoadUint64(&es.delivered),
+		DroppedQueue:    atomic.LoadUint64(&es.dispatcher.dropped),
+		DroppedListener: atomic.LoadUint64(&es.dropped),
+	}
+}
+
+// deliver sends event to listeners which subscribed the path or its parent directories
+func (es *EventService) deliver(event types.Event) {
+	es.mut.RLock()
+	defer es.mut.RUnlock()
+
+	// look up only listeners of the path and its parents instead of filtering every listener
+	path := strings.TrimSuffix(event.AfterPath, "/")
+	for {
+		for listener := range es.listeners[path] {
+			select {
+			case listener <- event:
+				atomic.AddUint64(&es.delivered, 1)
+			default:
+				// do not block other listeners for slow listener
+				atomic.AddUint64(&es.dropped, 1)
+				log.Println("quics: event listener is busy; drop event of ", event.AfterPath)
+			}
+		}
+
+		if path == "" {
+			break
+		}
+		// path without "/" (e.g., relative path of bad request) has only listeners of every path as its parent
+		parent := strings.LastIndex(path, "/")
+		if parent < 0 {
+			parent = 0
+		}
+		path = path[:parent]
+	}
+}
+
+// Subscribe registers listener of afterPath (file or directory) and returns channel of events with unsubscribe function
+func (es *EventService) Subscribe(afterPath string) (<-chan types.Event, func()) {
+	path := strings.TrimSuffix(afterPath, "/")
+	listener := make(chan types.Event, listenerBufferSize)
+
+	es.mut.Lock()
+	if _, exists := es.listeners[path]; !exists {
+		es.listeners[path] = map[chan types.Event]struct{}{}
+	}
+	es.listeners[path][listener] = struct{}{}
+	es.mut.Unlock()
+
+	unsubscribe := func() {
+		es.mut.Lock()
+		defer es.mut.Unlock()
+
+		if _, exists := es.listeners[path][listener]; !exists {
+			return
+		}
+		delete(es.listeners[path], listener)
+		if len(es.listeners[path]) == 0 {
+			delete(es.listeners, path)
+		}
+		close(listener)
+	}
+
+	return listener, unsubscribe
+}
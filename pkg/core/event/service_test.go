@@ -0,0 +1,53 @@
+package event
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/quic-s/quics/pkg/types"
+)
+
+func TestDeliverToParents(t *testing.T) {
+	subscribed := []string{"", "/r", "/r/a", "/r/ab", "a"}
+
+	tests := []struct {
+		name      string
+		afterPath string
+		want      []string // subscribed paths which receive the event
+	}{
+		{name: "file", afterPath: "/r/a/b", want: []string{"", "/r", "/r/a"}},
+		{name: "directory with trailing slash", afterPath: "/r/a/", want: []string{"", "/r", "/r/a"}},
+		{name: "root", afterPath: "/", want: []string{""}},
+		{name: "empty path", afterPath: "", want: []string{""}},
+		{name: "path without slash", afterPath: "a", want: []string{"", "a"}},
+		{name: "path without leading slash", afterPath: "a/b", want: []string{"", "a"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			es := &EventService{listeners: map[string]map[chan types.Event]struct{}{}}
+			listeners := map[string]<-chan types.Event{}
+			for _, path := range subscribed {
+				listener, unsubscribe := es.Subscribe(path)
+				defer unsubscribe()
+				listeners[path] = listener
+			}
+
+			es.deliver(types.Event{AfterPath: tt.afterPath})
+
+			got := []string{}
+			for path, listener := range listeners {
+				select {
+				case <-listener:
+					got = append(got, path)
+				default:
+				}
+			}
+			sort.Strings(got)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("delivered to %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
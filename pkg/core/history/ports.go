@@ -6,6 +6,7 @@ type Repository interface {
 	SaveNewFileHistory(afterPath string, fileHistory *types.FileHistory) error
 	GetFileHistory(afterPath string, timestamp uint64) (*types.FileHistory, error)
 	GetFileHistoriesForClient(afterPath string, cntFromHead uint64) ([]types.FileHistory, error)
+	DeleteFileHistoriesBefore(afterPath string, timestamp uint64) ([]uint64, error)
 }
 
 type Service interface {
@@ -10,11 +10,14 @@ type Repository interface {
 	GetClientByUUID(uuid string) (*types.Client, error)
 	GetAllClients() ([]types.Client, error)
 	DeleteClient(uuid string) error
+	SaveRootDir(afterPath string, rootDir *types.RootDirectory) error
+	GetRootDirByPath(afterPath string) (*types.RootDirectory, error)
 	GetSequence(key []byte, increment uint64) (uint64, error)
 	ErrKeyNotFound() error
 }
 
 type Service interface {
+	Authenticate(request *types.ClientRegisterReq, keyingMaterial []byte) error
 	RegisterClient(request *types.ClientRegisterReq, conn *qp.Connection) (*types.ClientRegisterRes, error)
 }
 
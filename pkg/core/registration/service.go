@@ -1,49 +1,116 @@
 package registration
 
 import (
+	"crypto/subtle"
 	"errors"
+	"fmt"
 	"log"
+	"reflect"
 
 	qp "github.com/quic-s/quics-protocol"
 	"github.com/quic-s/quics/pkg/types"
+	"github.com/quic-s/quics/pkg/utils"
+	"golang.org/x/exp/slices"
 )
 
+// ErrUnauthenticated is returned when registration request does not have valid credential
+var ErrUnauthenticated = errors.New("UNAUTHENTICATED")
+
 type RegistrationService struct {
 	password               string
+	auth                   string // types.RegistrationAuthPassword or types.RegistrationAuthProof
 	registrationRepository Repository
 	networkAdapter         NetworkAdapter
 }
 
 // NewRegistrationService creates new registration service
-func NewService(password string, registrationRepository Repository, networkAdapter NetworkAdapter) Service {
+func NewService(password string, auth string, registrationRepository Repository, networkAdapter NetworkAdapter) Service {
 	return &RegistrationService{
 		password:               password,
+		auth:                   auth,
 		registrationRepository: registrationRepository,
 		networkAdapter:         networkAdapter,
 	}
 }
 
-// CreateNewClient creates new client entity
+// Authenticate checks credential of registration request before anything else is done for its connection (no database access)
+// keyingMaterial is exported from TLS session of the connection, which password proof is bound to
+func (rs *RegistrationService) Authenticate(request *types.ClientRegisterReq, keyingMaterial []byte) error {
+	if request.PasswordProof != "" {
+		if !utils.VerifyRegistrationProof(rs.password, keyingMaterial, request.UUID, request.PasswordProof) {
+			return fmt.Errorf("%w: password proof is not correct", ErrUnauthenticated)
+		}
+		return nil
+	}
+
+	if rs.auth == types.RegistrationAuthProof {
+		return fmt.Errorf("%w: password proof is required", ErrUnauthenticated)
+	}
+	if subtle.ConstantTimeCompare([]byte(request.ClientPassword), []byte(rs.password)) != 1 {
+		return fmt.Errorf("%w: password is not correct", ErrUnauthenticated)
+	}
+	return nil
+}
+
+// RegisterClient registers client of request authenticated by Authenticate (or updates connection of registered one)
 func (rs *RegistrationService) RegisterClient(request *types.ClientRegisterReq, conn *qp.Connection) (*types.ClientRegisterRes, error) {
-	log.Println("quics: RegisterClient: ", request)
-	if request.ClientPassword != rs.password {
-		return nil, errors.New("[RegistrationService.RegitserClient] password is not correct")
+	log.Println("quics: RegisterClient: ", request.UUID)
+
+	// schedule declared by client is validated before anything is saved
+	var schedule *types.BandwidthSchedule
+	if request.BandwidthSchedule != "" {
+		parsed, err := utils.ParseBandwidthSchedule(request.BandwidthSchedule)
+		if err != nil {
+			err = errors.New("[RegistrationService.RegitserClient] parse bandwidth schedule: " + err.Error())
+			return nil, err
+		}
+		schedule = parsed
+	}
+
+	// features of transfers are negotiated on every registration, since client may be upgraded (or downgraded) between them
+	capabilities := utils.NegotiateCapabilities(request.Capabilities)
+	if capabilities != nil {
+		log.Println("quics: negotiated capabilities of ", request.UUID, ": ", utils.FormatCapabilities(capabilities))
 	}
+
 	client, err := rs.registrationRepository.GetClientByUUID(request.UUID)
 	if err != nil && err != rs.registrationRepository.ErrKeyNotFound() {
 		err = errors.New("[RegistrationService.RegitserClient] get client by uuid: " + err.Error())
 		return nil, err
 	}
 
-	// if client is already existed, just update connection
+	// if client is already existed (e.g., reconnection after server restart), just update connection
+	// root directories of client are kept, so client does not need to register them again
 	if client != nil && request.UUID == client.UUID {
+		log.Println("quics: client is reconnected: ", request.UUID)
+
+		err = rs.restoreRootDirs(client)
+		if err != nil {
+			err = errors.New("[RegistrationService.RegitserClient] restore root directories: " + err.Error())
+			return nil, err
+		}
+
+		if client.Transport != types.TransportQUIC || schedule != nil || !reflect.DeepEqual(client.Capabilities, capabilities) {
+			client.Transport = types.TransportQUIC
+			client.Capabilities = capabilities
+			if schedule != nil {
+				client.Schedule = *schedule
+			}
+			err = rs.registrationRepository.SaveClient(request.UUID, client)
+			if err != nil {
+				err = errors.New("[RegistrationService.RegitserClient] save client to repository: " + err.Error())
+				return nil, err
+			}
+		}
+
 		err = rs.networkAdapter.UpdateClientConnection(request.UUID, conn)
 		if err != nil {
 			err = errors.New("[RegistrationService.RegitserClient] update client connection: " + err.Error())
 			return nil, err
 		}
 		return &types.ClientRegisterRes{
-			UUID: request.UUID,
+			UUID:         request.UUID,
+			Capabilities: capabilities,
 		}, nil
 	}
 
@@ -56,8 +123,13 @@ func (rs *RegistrationService) RegisterClient(request *types.ClientRegisterReq,
 
 	// initialize client information
 	client = &types.Client{
-		Id:   newId,
-		UUID: request.UUID,
+		Id:           newId,
+		UUID:         request.UUID,
+		Transport:    types.TransportQUIC,
+		Capabilities: capabilities,
+	}
+	if schedule != nil {
+		client.Schedule = *schedule
 	}
 
 	// Save client to badger database
@@ -74,7 +146,8 @@ func (rs *RegistrationService) RegisterClient(request *types.ClientRegisterReq,
 	}
 
 	return &types.ClientRegisterRes{
-		UUID: request.UUID,
+		UUID:         request.UUID,
+		Capabilities: capabilities,
 	}, nil
 }
 
@@ -98,3 +171,30 @@ func (rs *RegistrationService) DisconnectClient(request *types.DisconnectClientR
 		UUID: request.UUID,
 	}, nil
 }
+
+// restoreRootDirs makes sure that root directories of client still have the client
+func (rs *RegistrationService) restoreRootDirs(client *types.Client) error {
+	for _, root := range client.Root {
+		rootDir, err := rs.registrationRepository.GetRootDirByPath(root.AfterPath)
+		if err == rs.registrationRepository.ErrKeyNotFound() {
+			// root directory is removed by server
+			log.Println("quics: root directory of client is not existed: ", root.AfterPath)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if slices.Contains(rootDir.UUIDs, client.UUID) {
+			continue
+		}
+
+		rootDir.UUIDs = append(rootDir.UUIDs, client.UUID)
+		err = rs.registrationRepository.SaveRootDir(rootDir.AfterPath, rootDir)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,142 @@
+package registration
+
+import (
+	"strings"
+	"testing"
+
+	qp "github.com/quic-s/quics-protocol"
+	"github.com/quic-s/quics/pkg/repository/badger"
+	"github.com/quic-s/quics/pkg/types"
+	"github.com/quic-s/quics/pkg/utils"
+)
+
+// testNetworkAdapter records clients whose connection is updated
+type testNetworkAdapter struct {
+	connected []string
+}
+
+func (na *testNetworkAdapter) UpdateClientConnection(uuid string, conn *qp.Connection) error {
+	na.connected = append(na.connected, uuid)
+	return nil
+}
+
+func (na *testNetworkAdapter) DeleteConnection(uuid string) error {
+	return nil
+}
+
+func TestRegisterClientAfterRestart(t *testing.T) {
+	tests := []struct {
+		name         string
+		whileStopped func(t *testing.T, repo *badger.Badger) // changes made to database while server is stopped
+		wantRootDirs []string                                // root directories which have the client after re-registration
+	}{
+		{
+			name:         "root directories are kept",
+			wantRootDirs: []string{"/r", "/s"},
+		},
+		{
+			name: "client is added back to root directory",
+			whileStopped: func(t *testing.T, repo *badger.Badger) {
+				if err := repo.NewRegistrationRepository().SaveRootDir("/s", &types.RootDirectory{AfterPath: "/s", Owner: "owner"}); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantRootDirs: []string{"/r", "/s"},
+		},
+		{
+			name: "root directory removed by server is skipped",
+			whileStopped: func(t *testing.T, repo *badger.Badger) {
+				if err := repo.NewServerRepository().DeleteRootDirectoryByAfterPath("/s"); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantRootDirs: []string{"/r"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			utils.SetQuicsDataDirPath(t.TempDir())
+			defer utils.SetQuicsDataDirPath("")
+
+			request := &types.ClientRegisterReq{UUID: "client-a"}
+
+			// register client with root directories and stop server
+			repo, err := badger.NewBadgerRepository(false, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			repository := repo.NewRegistrationRepository()
+			rs := NewService("password", "", repository, &testNetworkAdapter{})
+			if _, err := rs.RegisterClient(request, nil); err != nil {
+				t.Fatal(err)
+			}
+			client, err := repository.GetClientByUUID(request.UUID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, afterPath := range []string{"/r", "/s"} {
+				rootDir := types.RootDirectory{AfterPath: afterPath, Owner: "owner", UUIDs: []string{request.UUID}}
+				client.Root = append(client.Root, rootDir)
+				if err := repository.SaveRootDir(afterPath, &rootDir); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := repository.SaveClient(request.UUID, client); err != nil {
+				t.Fatal(err)
+			}
+			clientId := client.Id
+			if tt.whileStopped != nil {
+				tt.whileStopped(t, repo)
+			}
+			if err := repo.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			// restart server and register client again
+			repo, err = badger.NewBadgerRepository(false, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer repo.Close()
+			repository = repo.NewRegistrationRepository()
+			networkAdapter := &testNetworkAdapter{}
+			rs = NewService("password", "", repository, networkAdapter)
+			if _, err := rs.RegisterClient(request, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			if strings.Join(networkAdapter.connected, ",") != request.UUID {
+				t.Errorf("connections updated = %v, want [%s]", networkAdapter.connected, request.UUID)
+			}
+			client, err = repository.GetClientByUUID(request.UUID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if client.Id != clientId {
+				t.Errorf("client id = %d, want %d (client is not registered again as new one)", client.Id, clientId)
+			}
+			if len(client.Root) != 2 {
+				t.Errorf("root directories of client = %d, want 2", len(client.Root))
+			}
+			rootDirs := []string{}
+			for _, afterPath := range []string{"/r", "/s"} {
+				rootDir, err := repository.GetRootDirByPath(afterPath)
+				if err == repository.ErrKeyNotFound() {
+					continue
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, uuid := range rootDir.UUIDs {
+					if uuid == request.UUID {
+						rootDirs = append(rootDirs, afterPath)
+					}
+				}
+			}
+			if strings.Join(rootDirs, ",") != strings.Join(tt.wantRootDirs, ",") {
+				t.Errorf("root directories with client = %v, want %v", rootDirs, tt.wantRootDirs)
+			}
+		})
+	}
+}
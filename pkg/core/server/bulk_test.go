@@ -0,0 +1,143 @@
+package server
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/quic-s/quics/pkg/types"
+	"github.com/quic-s/quics/pkg/utils"
+)
+
+var errCrash = errors.New("crash")
+
+// bulkTestRepository keeps records of bulk operations and files in memory (methods not used by bulk removal are not implemented)
+type bulkTestRepository struct {
+	Repository
+
+	operations map[string]*types.BulkOperation
+	files      map[string]bool
+	crashAfter int // DeleteFiles fails with errCrash after removing this many files (negative: never fails)
+}
+
+func (r *bulkTestRepository) SetBulkOperation(operation *types.BulkOperation) error {
+	copied := *operation
+	r.operations[operation.ID] = &copied
+	return nil
+}
+
+func (r *bulkTestRepository) GetBulkOperations() ([]*types.BulkOperation, error) {
+	operations := []*types.BulkOperation{}
+	for _, operation := range r.operations {
+		operations = append(operations, operation)
+	}
+	sort.Slice(operations, func(i, j int) bool { return operations[i].ID < operations[j].ID })
+	return operations, nil
+}
+
+func (r *bulkTestRepository) DeleteBulkOperation(id string) error {
+	delete(r.operations, id)
+	return nil
+}
+
+func (r *bulkTestRepository) DeleteAllClients() error {
+	return nil
+}
+
+func (r *bulkTestRepository) DeleteFiles(afterPath string, recursive bool, dryRun bool) (uint64, error) {
+	afterPaths := []string{}
+	for filePath := range r.files {
+		if afterPath == "" || filePath == afterPath || (recursive && utils.IsUnderPath(afterPath, filePath)) {
+			afterPaths = append(afterPaths, filePath)
+		}
+	}
+	sort.Strings(afterPaths)
+
+	removed := uint64(0)
+	for _, filePath := range afterPaths {
+		if r.crashAfter >= 0 && int(removed) == r.crashAfter {
+			return removed, errCrash
+		}
+		delete(r.files, filePath)
+		removed++
+	}
+
+	return removed, nil
+}
+
+func TestBulkRemoveResumedAfterCrash(t *testing.T) {
+	tests := []struct {
+		name       string
+		afterPath  string
+		crashAfter int
+		thenRun    []string // kinds of bulk operations run after crash and before restart
+		wantFiles  []string // files left after restart
+	}{
+		{
+			name:       "crash mid remove",
+			afterPath:  "/r",
+			crashAfter: 1,
+			wantFiles:  []string{"/s/d"},
+		},
+		{
+			name:       "crash before anything is removed",
+			afterPath:  "",
+			crashAfter: 0,
+			wantFiles:  []string{},
+		},
+		{
+			name:       "record of failed remove survives next bulk operation",
+			afterPath:  "/r",
+			crashAfter: 2,
+			thenRun:    []string{types.BulkRemoveClients},
+			wantFiles:  []string{"/s/d"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repository := &bulkTestRepository{
+				operations: map[string]*types.BulkOperation{},
+				files:      map[string]bool{"/r/a": true, "/r/b": true, "/r/c/d": true, "/s/d": true},
+				crashAfter: tt.crashAfter,
+			}
+			ss := &ServerService{serverRepository: repository}
+
+			_, err := ss.runBulkOperation(&types.BulkOperation{Kind: types.BulkRemoveFiles, AfterPath: tt.afterPath})
+			if !errors.Is(err, errCrash) {
+				t.Fatalf("runBulkOperation() error = %v, want %v", err, errCrash)
+			}
+			if len(repository.operations) != 1 {
+				t.Fatalf("records after crash = %d, want 1", len(repository.operations))
+			}
+
+			for _, kind := range tt.thenRun {
+				if _, err := ss.runBulkOperation(&types.BulkOperation{Kind: kind}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// restart
+			repository.crashAfter = -1
+			if err := ss.ResumeBulkOperation(); err != nil {
+				t.Fatal(err)
+			}
+
+			files := []string{}
+			for filePath := range repository.files {
+				files = append(files, filePath)
+			}
+			sort.Strings(files)
+			if strings.Join(files, ",") != strings.Join(tt.wantFiles, ",") {
+				t.Errorf("files after resume = %v, want %v", files, tt.wantFiles)
+			}
+			if len(repository.operations) != 0 {
+				t.Errorf("records after resume = %d, want 0", len(repository.operations))
+			}
+			if ss.ShowBulkOperation().Running {
+				t.Error("bulk operation is still running after resume")
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/quic-s/quics/pkg/types"
+	"github.com/quic-s/quics/pkg/utils"
+)
+
+// diffTestRepository keeps histories in memory for diff of directory
+type diffTestRepository struct {
+	Repository
+
+	histories []types.FileHistory
+}
+
+func (r *diffTestRepository) GetAllHistories() ([]types.FileHistory, error) {
+	return r.histories, nil
+}
+
+func TestDiffDirEmptyFiles(t *testing.T) {
+	emptyHash, err := utils.MakeContentHashFromReader(bytes.NewReader(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	contentsHash, err := utils.MakeContentHashFromReader(bytes.NewReader([]byte("contents")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	from := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+	to := from.Add(24 * time.Hour)
+	before, after := from.Add(-time.Hour).String(), to.Add(-time.Hour).String()
+
+	tests := []struct {
+		name      string
+		histories []types.FileHistory
+		content   bool
+		want      string // status of diff entry (empty: no entry)
+	}{
+		{
+			name:      "empty file created",
+			histories: []types.FileHistory{{Date: after, Timestamp: 1, Hash: "h1", ContentHash: emptyHash}},
+			want:      types.DiffAdded,
+		},
+		{
+			name: "empty file removed",
+			histories: []types.FileHistory{
+				{Date: before, Timestamp: 1, Hash: "h1", ContentHash: emptyHash},
+				{Date: after, Timestamp: 2},
+			},
+			want: types.DiffRemoved,
+		},
+		{
+			name: "file emptied",
+			histories: []types.FileHistory{
+				{Date: before, Timestamp: 1, Hash: "h1", ContentHash: contentsHash},
+				{Date: after, Timestamp: 2, Hash: "h2", ContentHash: emptyHash},
+			},
+			content: true,
+			want:    types.DiffModified,
+		},
+		{
+			name: "empty file saved again",
+			histories: []types.FileHistory{
+				{Date: before, Timestamp: 1, Hash: "h1", ContentHash: emptyHash},
+				{Date: after, Timestamp: 2, Hash: "h2", ContentHash: emptyHash},
+			},
+			content: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := range tt.histories {
+				tt.histories[i].AfterPath = "/r/empty"
+			}
+			ss := &ServerService{serverRepository: &diffTestRepository{histories: tt.histories}}
+
+			diffRes, err := ss.DiffDir("/r", from, to, tt.content)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			statuses := []string{}
+			for _, entry := range diffRes.Entries {
+				statuses = append(statuses, entry.Status)
+			}
+			if got := strings.Join(statuses, ","); got != tt.want {
+				t.Errorf("diff of empty file = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/quic-s/quics/pkg/config"
+	"github.com/quic-s/quics/pkg/repository/badger"
+	"github.com/quic-s/quics/pkg/types"
+	"github.com/quic-s/quics/pkg/utils"
+	"github.com/spf13/viper"
+)
+
+func TestSetPassword(t *testing.T) {
+	tests := []struct {
+		name        string
+		envPassword string // PASSWORD of qis.env
+		changedTo   string // password set by the previous change (empty: never changed)
+		current     string
+		noEnvFile   bool // qis.env can not be written
+		wantErr     error
+		wantChanged bool
+	}{
+		{name: "server has no password", wantChanged: true},
+		{name: "current password", envPassword: "old", current: "old", wantChanged: true},
+		{name: "wrong current password", envPassword: "old", current: "wrong", wantErr: ErrWrongPassword},
+		{name: "password changed before", envPassword: "old", changedTo: "changed", current: "changed", wantChanged: true},
+		{name: "password before the change", envPassword: "old", changedTo: "changed", current: "old", wantErr: ErrWrongPassword},
+		{name: "qis.env not written", envPassword: "old", changedTo: "changed", current: "changed", noEnvFile: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("HOME", t.TempDir())
+			if !tt.noEnvFile {
+				if err := os.MkdirAll(utils.GetQuicsDirPath(), 0700); err != nil {
+					t.Fatal(err)
+				}
+			}
+			utils.SetQuicsDataDirPath(t.TempDir())
+			defer utils.SetQuicsDataDirPath("")
+			viper.Set("PASSWORD", tt.envPassword)
+			defer viper.Set("PASSWORD", "")
+
+			repo, err := badger.NewBadgerRepository(false, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer repo.Close()
+			ss := &ServerService{repo: repo, serverRepository: repo.NewServerRepository()}
+			if tt.changedTo != "" {
+				passwordHash, err := utils.MakePasswordHash(tt.changedTo)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := ss.serverRepository.UpdatePassword(&types.Server{PasswordHash: passwordHash}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err = ss.SetPassword(&types.SetPasswordReq{CurrentPassword: tt.current, Password: "new"})
+			switch {
+			case tt.noEnvFile && err == nil:
+				t.Fatal("SetPassword() error = nil, want error of writing qis.env")
+			case !tt.noEnvFile && !errors.Is(err, tt.wantErr):
+				t.Fatalf("SetPassword() error = %v, want %v", err, tt.wantErr)
+			}
+
+			// only salted hash of new password is recorded, and password in use is verified against it
+			if got := ss.verifyCurrentPassword("new"); got != tt.wantChanged {
+				t.Errorf("new password verified = %t, want %t", got, tt.wantChanged)
+			}
+			server, err := ss.serverRepository.GetPassword()
+			if err == nil && server.Password != "" {
+				t.Errorf("plain password %q is recorded", server.Password)
+			}
+			if want := tt.changedTo != "" || tt.wantChanged; (err == nil) != want {
+				t.Errorf("password record error = %v, want record: %t", err, want)
+			}
+
+			wantEnvPassword := tt.envPassword
+			if tt.wantChanged {
+				wantEnvPassword = "new"
+			}
+			if got := config.GetViperEnvVariables("PASSWORD"); got != wantEnvPassword {
+				t.Errorf("PASSWORD = %q, want %q", got, wantEnvPassword)
+			}
+			if _, err := os.Stat(filepath.Join(utils.GetQuicsDirPath(), "qis.env")); (err == nil) != tt.wantChanged {
+				t.Errorf("qis.env stat error = %v, want written: %t", err, tt.wantChanged)
+			}
+		})
+	}
+}
@@ -1,8 +1,13 @@
 package server
 
 import (
+	"context"
+	"encoding/json"
 	"io"
+	"time"
 
+	"github.com/quic-s/quics/pkg/core/sync"
+	"github.com/quic-s/quics/pkg/logs"
 	"github.com/quic-s/quics/pkg/types"
 )
 
@@ -11,10 +16,22 @@ type Repository interface {
 	DeletePassword() error
 	GetPassword() (*types.Server, error)
 	GetAllClients() ([]types.Client, error)
+	GetClientsPage(match func(*types.Client) bool, request *types.PageReq) (*types.Page[types.Client], error)
+	GetRootDirectoriesPage(afterPathPrefix string, match func(*types.RootDirectory) bool, request *types.PageReq) (*types.Page[types.RootDirectory], error)
+	GetFilesPage(afterPathPrefix string, match func(*types.File) bool, request *types.PageReq) (*types.Page[types.File], error)
+	GetHistoriesPage(afterPathPrefix string, match func(*types.FileHistory) bool, request *types.PageReq) (*types.Page[types.FileHistory], error)
+	CountClients(match func(*types.Client) bool, ctx context.Context) (uint64, error)
+	CountRootDirectories(afterPathPrefix string, matchPath func(afterPath string) bool, match func(*types.RootDirectory) bool, ctx context.Context) (uint64, error)
+	CountFiles(afterPathPrefix string, matchPath func(afterPath string) bool, match func(*types.File) bool, ctx context.Context) (uint64, error)
+	CountHistories(afterPathPrefix string, matchPath func(afterPath string) bool, match func(*types.FileHistory) bool, ctx context.Context) (uint64, error)
 	GetAllRootDirectories() ([]types.RootDirectory, error)
 	GetAllFiles() ([]types.File, error)
+	WalkPaths(files bool, dirs bool, visit func(afterPath string) error) error
 	GetClientByUUID(uuid string) (*types.Client, error)
+	UpdateClient(client *types.Client) error
+	ProvisionClients(clients []*types.Client, rootDirs []*types.RootDirectory) error
 	GetRootDirectoryByPath(afterPath string) (*types.RootDirectory, error)
+	UpdateRootDirectory(rootDir *types.RootDirectory) error
 	GetFileByAfterPath(afterPath string) (*types.File, error)
 	DeleteAllClients() error
 	DeleteAllRootDirectories() error
@@ -22,26 +39,114 @@ type Repository interface {
 	DeleteClientByUUID(uuid string) error
 	DeleteRootDirectoryByAfterPath(afterPath string) error
 	DeleteFileByAfterPath(afterPath string) error
+	DeleteFiles(afterPath string, recursive bool, dryRun bool) (uint64, error)
+	UpdateFiles(afterPathPrefix string, match func(*types.File) bool, update func(*types.File) (bool, error), dryRun bool) (*types.BulkUpdateRes, error)
+
+	SetBulkOperation(operation *types.BulkOperation) error
+	GetBulkOperations() ([]*types.BulkOperation, error)
+	DeleteBulkOperation(id string) error
+	SetRuntimeState(state *types.RuntimeState) error
+	GetRuntimeState() (*types.RuntimeState, error)
+	DeleteRuntimeState() error
+	GetOrSetSigningKey(key []byte) ([]byte, error)
+	GetSigningKey() ([]byte, error)
+	SetSigningKey(key []byte) error
 	GetAllHistories() ([]types.FileHistory, error)
+	GetFilesByPattern(pattern string) ([]types.File, error)
+	GetFilesByTags(tags map[string]string) ([]types.File, error)
+	GetHistoriesByPattern(pattern string) ([]types.FileHistory, error)
+	GetHistoriesByCommit(id string) ([]types.FileHistory, error)
 	GetHistoryByAfterPath(afterPath string) (*types.FileHistory, error)
+	MoveRootDirectory(fromAfterPath string, toAfterPath string) error
+	GetSequence(key []byte, increment uint64) (uint64, error)
+	GetTransfers(since time.Time, until time.Time) ([]types.Transfer, error)
+	DeleteTransfersBefore(before time.Time) (uint64, error)
+	ErrKeyNotFound() error
 }
 
 type Service interface {
 	StopServer() error
 	ListenProtocol() error
-	SetPassword(request *types.Server) error
-	ResetPassword() error
+	SetPassword(request *types.SetPasswordReq) error
+	ResetPassword(request *types.ResetPasswordReq) error
+	IsAdminToken(token string) bool
 	Ping(request *types.Ping) (*types.Ping, error)
-	ShowClient(uuid string) ([]types.Client, error)
-	ShowDir(afterPath string) ([]types.RootDirectory, error)
-	ShowFile(afterPath string) ([]types.File, error)
-	ShowHistory(afterPath string) ([]types.FileHistory, error)
+	ShowClient(uuid string, root string, filter *types.LogFilter, pageReq *types.PageReq) (*types.Page[types.Client], error)
+	ShowDir(afterPath string, filter *types.LogFilter, pageReq *types.PageReq) (*types.Page[types.RootDirectory], error)
+	ShowFile(afterPath string, filter *types.LogFilter, pageReq *types.PageReq) (*types.Page[types.File], error)
+	ShowOrphanedFile(pageReq *types.PageReq) (*types.Page[types.File], error)
+	ShowDuplicateFile(filter *types.LogFilter) (*types.DuplicatesRes, error)
+	ShowConflicts(afterPath string) (*types.ConflictsRes, error)
+	ResolveConflict(afterPath string, keep string) (*types.File, error)
+	ShowHistory(afterPath string, filter *types.LogFilter, pageReq *types.PageReq) (*types.Page[types.FileHistory], error)
+	ShowCommitHistory(id string, filter *types.LogFilter, pageReq *types.PageReq) (*types.Page[types.FileHistory], error)
+	CountClient(filter *types.LogFilter, ctx context.Context) (*types.CountRes, error)
+	CountDir(filter *types.LogFilter, ctx context.Context) (*types.CountRes, error)
+	CountFile(filter *types.LogFilter, ctx context.Context) (*types.CountRes, error)
+	CountHistory(filter *types.LogFilter, ctx context.Context) (*types.CountRes, error)
 	RemoveClient(uuid string) error
 	RemoveDir(afterPath string) error
-	RemoveFile(afterPath string) error
+	RemoveFile(afterPath string, recursive bool, dryRun bool, purge bool) (*types.RemoveRes, error)
+	RemoveOrphanedFile(dryRun bool, purge bool) (*types.RemoveRes, error)
+	ShowBulkOperation() *types.BulkOperationRes
+	MoveDir(fromAfterPath string, toAfterPath string) error
+	MoveFile(fromAfterPath string, toAfterPath string, overwrite bool) (*types.File, error)
+	DiffDir(afterPath string, from time.Time, to time.Time, content bool) (*types.DirDiffRes, error)
+	GetFileLineage(afterPath string) (*types.FileLineageRes, error)
+	SetDirAppendOnly(afterPath string, appendOnly bool) error
+	SetDirVersioning(afterPath string, policies []types.VersioningPolicy) error
+	SetDirPolicies(afterPath string, policies []types.SyncPolicy) error
+	ExplainPolicy(afterPath string) (*types.EffectivePolicy, error)
+	LockFile(afterPath string, uuid string, ttl time.Duration) (*types.FileLock, error)
+	UnlockFile(afterPath string, uuid string) error
+	ShowLocks(afterPath string) ([]types.LockInfo, error)
+	BreakLock(afterPath string, reason string) (*types.BreakLockRes, error)
+	TagFile(afterPath string, set map[string]string, unset []string) (*types.File, error)
+	TagFiles(filter *types.LogFilter, set map[string]string, unset []string, dryRun bool) (*types.BulkUpdateRes, error)
+	SetFileNoHistory(afterPath string, noHistory bool) (*types.File, error)
+	GetFileMetadata(afterPath string) (json.RawMessage, error)
+	SetFileMetadata(afterPath string, metadata json.RawMessage) (*types.File, error)
+	SubscribeEvents(afterPath string) (<-chan types.Event, func())
+	SubscribeLogs(level string) ([]logs.Line, <-chan logs.Line, func())
+	SubscribeClient(uuid string, prefix string) error
+	UnsubscribeClient(uuid string, prefix string) error
+	SetClientSchedule(uuid string, schedule *types.BandwidthSchedule) error
+	SyncClientNow(uuid string) (*types.SyncNowRes, error)
+	ProvisionClients(entries []types.ProvisionEntry, dryRun bool) (*types.ProvisionRes, error)
+	UploadFile(afterPath string, size int64, fileContent io.Reader, expectedHash string) (*types.File, error)
+	OpenCommitSet(name string) (*types.CommitSet, error)
+	StageCommitFile(id string, afterPath string, size int64, fileContent io.Reader) (*types.CommitSet, error)
+	CommitSet(id string) (*types.CommitSet, error)
+	AbortCommitSet(id string) error
+	GetCommitSet(id string) (*types.CommitSet, error)
 	DownloadFile(afterPath string, timestamp uint64) (*types.FileMetadata, io.Reader, error)
+	SignFile(afterPath string, timestamp uint64, expires time.Duration) (*types.SignedURLRes, error)
+	GetFileDigest(afterPath string, timestamp uint64, chunks bool) (*types.FileDigestRes, error)
+	ResolveVersion(afterPath string, selector *types.VersionSelector) (*types.VersionRes, error)
+	DownloadSignedFile(afterPath string, timestamp uint64, expires int64, signature string) (*types.FileMetadata, io.Reader, error)
+	RotateSigningKey() error
+	ResumeBulkOperation() error
+	RestoreRuntimeState() error
+	WalkPaths(files bool, dirs bool, visit func(afterPath string) error) error
+	Browse(afterPath string) (*types.BrowseRes, error)
+	ConvertFile(afterPath string, timestamp uint64, accept string) ([]byte, string, error)
+	Scrub() (*types.ScrubRes, error)
+	Reindex(index string) ([]types.ReindexRes, error)
+	RecordDownload(afterPath string, size int64, startedAt time.Time)
+	BeginTransfer() func()
+	WaitSynced(ctx context.Context, token string, timeout time.Duration) error
+	TransferStats(since time.Time, until time.Time, bucket time.Duration) (*types.TransferStatsRes, error)
+	Checkpoint() (*types.CheckpointRes, error)
+	DBStats() (*types.DBStatsRes, error)
+	CompactDB(valueLogGC bool) (*types.DBCompactRes, error)
+	GetMetrics() *types.MetricsRes
+	ProtocolIdleSince() (time.Time, bool)
+	StartupCheck() error
+	Health() *types.HealthRes
 }
 
 type SyncDirAdapter interface {
+	sync.SyncDirAdapter
 	GetFileFromHistoryDir(afterPath string, timestamp uint64) (*types.FileMetadata, io.Reader, error)
+	MoveRootDir(fromAfterPath string, toAfterPath string) error
 }
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/quic-s/quics/pkg/core/sync"
+	"github.com/quic-s/quics/pkg/logs"
+	"github.com/quic-s/quics/pkg/repository/badger"
+	"github.com/quic-s/quics/pkg/types"
+	"github.com/quic-s/quics/pkg/utils"
+)
+
+// newRuntimeTestService opens database of data directory and creates service with state of a fresh process
+func newRuntimeTestService(t *testing.T) *ServerService {
+	t.Helper()
+
+	repo, err := badger.NewBadgerRepository(false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { repo.Close() })
+
+	syncService := sync.NewService(nil, nil, nil, nil, nil, nil, nil, types.TimestampSourceServer, 0, 0, false, 0, 0)
+	return &ServerService{repo: repo, serverRepository: repo.NewServerRepository(), syncService: syncService}
+}
+
+func TestRuntimeStateRestoredAfterRestart(t *testing.T) {
+	tests := []struct {
+		name     string
+		shutdown bool // state is saved by clean shutdown (otherwise server crashes)
+		wantDate bool // date stamped before restart is restored
+		wantLog  bool // log line written before restart is restored
+	}{
+		{name: "clean shutdown", shutdown: true, wantDate: true, wantLog: true},
+		{name: "crash", shutdown: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			utils.SetQuicsDataDirPath(t.TempDir())
+			defer utils.SetQuicsDataDirPath("")
+
+			// populate runtime state of the first run
+			lastDate := time.Now().Add(time.Hour).Round(0)
+			logLine := "quics: runtime state of " + t.Name()
+			ss := newRuntimeTestService(t)
+			ss.syncService.RestoreLastHistoryDate(lastDate)
+			logs.Restore([]logs.Line{{Level: logs.LevelInfo, Text: logLine}})
+			if tt.shutdown {
+				if err := ss.saveRuntimeState(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := ss.repo.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			// restart with empty state in memory
+			logs.Restore(make([]logs.Line, logs.RingSize))
+			ss = newRuntimeTestService(t)
+			if err := ss.RestoreRuntimeState(); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := ss.syncService.LastHistoryDate().Equal(lastDate); got != tt.wantDate {
+				t.Errorf("last history date = %s, restored: %t, want restored: %t", ss.syncService.LastHistoryDate(), got, tt.wantDate)
+			}
+			restoredLog := false
+			for _, line := range logs.Recent(logs.LevelInfo) {
+				restoredLog = restoredLog || line.Text == logLine
+			}
+			if restoredLog != tt.wantLog {
+				t.Errorf("log line restored: %t, want %t", restoredLog, tt.wantLog)
+			}
+
+			// state is restored only once, so that it is not restored again after later crash
+			state, err := ss.serverRepository.GetRuntimeState()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if state != nil {
+				t.Errorf("runtime state saved at %s is left after restore", state.SavedAt)
+			}
+		})
+	}
+}
@@ -1,41 +1,137 @@
 package server
 
 import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/quic-s/quics/pkg/config"
+	"github.com/quic-s/quics/pkg/convert"
+	"github.com/quic-s/quics/pkg/core/event"
 	"github.com/quic-s/quics/pkg/core/history"
 	"github.com/quic-s/quics/pkg/core/registration"
 	"github.com/quic-s/quics/pkg/core/sharing"
 	"github.com/quic-s/quics/pkg/core/sync"
+	"github.com/quic-s/quics/pkg/logs"
 	"github.com/quic-s/quics/pkg/network/qp"
 	"github.com/quic-s/quics/pkg/network/qp/connection"
 	"github.com/quic-s/quics/pkg/repository/badger"
 	"github.com/quic-s/quics/pkg/types"
+	"github.com/quic-s/quics/pkg/utils"
+	"golang.org/x/exp/slices"
 )
 
+// MaxClientAliasLength is the maximum length of alias of client (in bytes)
+const MaxClientAliasLength = 64
+
+// MaxSignedURLExpiry bounds how long a signed url can be used
+const MaxSignedURLExpiry = 7 * 24 * time.Hour
+
+// SigningKeyLength is the size of key which signs urls (in bytes)
+const SigningKeyLength = 32
+
+// TransferRetention is how long transfer records are kept for stats, and TransferPruneInterval is how often older ones are deleted
+const (
+	TransferRetention     = 90 * 24 * time.Hour
+	TransferPruneInterval = time.Hour
+)
+
+// MaxTransferBuckets bounds the number of windows of transfer stats, so that a tiny bucket over long period is rejected
+const MaxTransferBuckets = 10000
+
+// ErrInvalidSignature is returned when signed url is tampered, expired or signed by rotated key
+var ErrInvalidSignature = errors.New("signed url is invalid or expired")
+
+// ErrWrongPassword is returned when current password given to change password is not the password in use
+var ErrWrongPassword = errors.New("WRONG_PASSWORD")
+
+// ErrInvalidAdminToken is returned when admin token given to reset password is not the token of running server
+var ErrInvalidAdminToken = errors.New("INVALID_ADMIN_TOKEN")
+
+// ErrMoveTooLarge is returned when root directory has too many records to be moved in one transaction
+var ErrMoveTooLarge = badger.ErrMoveTooLarge
+
+// ErrBulkOperationRunning is returned when destructive bulk operation is requested while another one is running
+// its message has progress of the running one, so that caller can retry after it is finished
+var ErrBulkOperationRunning = errors.New(types.BulkOperationRunning)
+
+// AdminTokenLength is the size of admin token which authorizes password reset (in bytes)
+const AdminTokenLength = 32
+
+// DiskCheckInterval is the interval of checking free space of data directory (in seconds)
+const DiskCheckInterval = 30
+
+// quics protocol listener is considered listening once it survives ProtocolStartupWait, and stable once it survives
+// ProtocolStableDuration (its restarts are counted again from zero); restart in a row waits ProtocolRestartBackoff
+// doubled by each previous restart, up to MaxProtocolRestartBackoff
+const (
+	ProtocolStartupWait       = 3 * time.Second
+	ProtocolStableDuration    = 5 * time.Minute
+	ProtocolRestartBackoff    = time.Second
+	MaxProtocolRestartBackoff = time.Minute
+)
+
+// protocolSupervision is how quics protocol listener is started and restarted by superviseProtocol
+type protocolSupervision struct {
+	start          func() error // runs listener until it dies
+	startupWait    time.Duration
+	stableDuration time.Duration
+	backoff        time.Duration
+	maxBackoff     time.Duration
+	maxRestarts    uint64
+}
+
 type ServerService struct {
-	port     int
-	password string
-	repo     *badger.Badger
-	Proto    *qp.Protocol
+	port          int
+	password      string
+	scrubInterval uint64
+	repo          *badger.Badger
+	Proto         *qp.Protocol
+
+	syncService  sync.Service
+	eventService event.Service
+	converters   *convert.Registry
 
-	syncService sync.Service
+	convertFlight utils.FlightGroup[[]byte] // conversions running now by afterPath, timestamp and target
 
 	syncDirAdapter   SyncDirAdapter
 	serverRepository Repository
+
+	adminToken string // written to admin token file, so that only who can read the file (e.g., local admin) resets password
+	startedAt  time.Time
+
+	health   atomic.Pointer[types.HealthRes] // result of the last health checks
+	safeMode bool                            // background mutators are disabled and nothing is written by server itself
+
+	protocolDown     atomic.Pointer[string] // why quics protocol listener is not accepting syncs (nil: listening, or not started yet)
+	protocolStopping atomic.Bool            // listener is closed by StopServer, so it is not restarted
+
+	bulkOperation atomic.Pointer[types.BulkOperationRes] // destructive bulk operation which is running (nil: none)
 }
 
-func NewService(repo *badger.Badger, serverRepository Repository, syncDirAdapter sync.SyncDirAdapter) (Service, error) {
+func NewService(repo *badger.Badger, serverRepository Repository, syncDirAdapter SyncDirAdapter) (Service, error) {
 	password := ""
 
+	// database only keeps hash of password since it is changed by SetPassword, so plain password is read from qis.env
 	server, err := repo.NewServerRepository().GetPassword()
-	if err != nil {
+	if err != nil || server.Password == "" {
 		password = config.GetViperEnvVariables("PASSWORD")
 	} else {
 		password = server.Password
@@ -48,6 +144,117 @@ func NewService(repo *badger.Badger, serverRepository Repository, syncDirAdapter
 		return nil, err
 	}
 
+	scrubInterval, err := strconv.ParseUint(config.GetViperEnvVariables("SCRUB_INTERVAL"), 10, 64)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	// directory policies override these server-wide defaults
+	extensionPolicies, err := utils.ParseSyncPolicies(config.GetViperEnvVariables("EXTENSION_POLICIES"))
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	// converters are opt-in (none is enabled by default)
+	converters, err := convert.NewRegistry(config.GetViperEnvVariables("CONVERTERS"))
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	// histories are stamped by server clock unless client clock is chosen explicitly
+	timestampSource := config.GetViperEnvVariables("TIMESTAMP_SOURCE")
+	if timestampSource != types.TimestampSourceServer && timestampSource != types.TimestampSourceClient {
+		err := errors.New("unknown timestamp source (server or client): " + timestampSource)
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	// every quic connection must register with this credential within registration timeout before any other transaction
+	registrationAuth := config.GetViperEnvVariables("REGISTRATION_AUTH")
+	if registrationAuth != types.RegistrationAuthPassword && registrationAuth != types.RegistrationAuthProof {
+		err := errors.New("unknown registration auth (password or proof): " + registrationAuth)
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+	registrationTimeout, err := strconv.ParseUint(config.GetViperEnvVariables("REGISTRATION_TIMEOUT"), 10, 32)
+	if err != nil || registrationTimeout == 0 {
+		err := errors.New("invalid registration timeout (seconds): " + config.GetViperEnvVariables("REGISTRATION_TIMEOUT"))
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	// uploads are received fully (in memory up to this size, then in temp file) before they are committed
+	uploadMemoryBuffer, err := strconv.ParseInt(config.GetViperEnvVariables("UPLOAD_MEMORY_BUFFER"), 10, 64)
+	if err != nil || uploadMemoryBuffer < 0 {
+		err := errors.New("invalid memory buffer of upload (bytes): " + config.GetViperEnvVariables("UPLOAD_MEMORY_BUFFER"))
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	// events are delivered by bounded pool of workers, in order for each afterPath unless ordering is none
+	eventWorkers, err := strconv.Atoi(config.GetViperEnvVariables("EVENT_WORKERS"))
+	if err != nil || eventWorkers < 1 {
+		err := errors.New("invalid workers of events (at least 1): " + config.GetViperEnvVariables("EVENT_WORKERS"))
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+	eventQueueSize, err := strconv.Atoi(config.GetViperEnvVariables("EVENT_QUEUE_SIZE"))
+	if err != nil || eventQueueSize < 1 {
+		err := errors.New("invalid queue size of events (at least 1): " + config.GetViperEnvVariables("EVENT_QUEUE_SIZE"))
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+	eventOrdering := config.GetViperEnvVariables("EVENT_ORDERING")
+	if eventOrdering != types.EventOrderingPath && eventOrdering != types.EventOrderingNone {
+		err := errors.New("unknown ordering of events (path or none): " + eventOrdering)
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+	eventOverflow := config.GetViperEnvVariables("EVENT_OVERFLOW")
+	if eventOverflow != types.EventOverflowDrop && eventOverflow != types.EventOverflowBlock {
+		err := errors.New("unknown overflow of events (drop or block): " + eventOverflow)
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	// writes failed for disk full are aborted, and server can reject writes until space is freed
+	diskLowSpace, err := strconv.ParseUint(config.GetViperEnvVariables("DISK_LOW_SPACE"), 10, 64)
+	if err != nil {
+		err := errors.New("invalid low space threshold of disk (bytes): " + config.GetViperEnvVariables("DISK_LOW_SPACE"))
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+	diskFullReadOnly, err := strconv.ParseBool(config.GetViperEnvVariables("DISK_FULL_READ_ONLY"))
+	if err != nil {
+		err := errors.New("invalid read-only on disk full (true or false): " + config.GetViperEnvVariables("DISK_FULL_READ_ONLY"))
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	// new files whose afterPath is too long or too deep are rejected before they reach the store or file systems of clients
+	maxPathLength, err := strconv.Atoi(config.GetViperEnvVariables("MAX_PATH_LENGTH"))
+	if err != nil || maxPathLength < 0 {
+		err := errors.New("invalid maximum length of path (bytes): " + config.GetViperEnvVariables("MAX_PATH_LENGTH"))
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+	maxPathDepth, err := strconv.Atoi(config.GetViperEnvVariables("MAX_PATH_DEPTH"))
+	if err != nil || maxPathDepth < 0 {
+		err := errors.New("invalid maximum depth of path (components): " + config.GetViperEnvVariables("MAX_PATH_DEPTH"))
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	// password reset is authorized by token which only users of server machine can read
+	adminToken, err := writeAdminToken()
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
 	pool := connection.NewnPool()
 
 	registrationRepository := repo.NewRegistrationRepository()
@@ -58,17 +265,24 @@ func NewService(repo *badger.Badger, serverRepository Repository, syncDirAdapter
 	registrationNetworkAdapter := qp.NewRegistrationAdapter(pool)
 	syncNetworkAdapter := qp.NewSyncAdapter(pool)
 
-	registrationService := registration.NewService(password, registrationRepository, registrationNetworkAdapter)
+	registrationService := registration.NewService(password, registrationAuth, registrationRepository, registrationNetworkAdapter)
 	historyService := history.NewService(historyRepository)
-	syncService := sync.NewService(registrationRepository, historyRepository, syncRepository, syncNetworkAdapter, syncDirAdapter)
+	eventService := event.NewService(eventWorkers, eventQueueSize, eventOrdering, eventOverflow)
+	syncService := sync.NewService(registrationRepository, historyRepository, syncRepository, syncNetworkAdapter, syncDirAdapter, eventService, extensionPolicies, timestampSource, uploadMemoryBuffer, diskLowSpace, diskFullReadOnly, maxPathLength, maxPathDepth)
 	sharingService := sharing.NewService(historyRepository, syncRepository, sharingRepository, syncDirAdapter)
 
-	registrationHandler := qp.NewRegistrationHandler(registrationService)
+	registrationHandler := qp.NewRegistrationHandler(registrationService, syncService)
 	syncHandler := qp.NewSyncHandler(syncService)
 	historyHandler := qp.NewHistoryHandler(historyService, sharingService)
 	sharingHandler := qp.NewSharingHandler(sharingService)
 
-	proto, err := qp.New("0.0.0.0", port, pool)
+	maxStreamsPerConn, err := strconv.Atoi(config.GetViperEnvVariables("MAX_STREAMS_PER_CONN"))
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	proto, err := qp.New("0.0.0.0", port, pool, maxStreamsPerConn, time.Duration(registrationTimeout)*time.Second)
 	if err != nil {
 		log.Println("quics err: ", err)
 		return nil, err
@@ -90,16 +304,25 @@ func NewService(repo *badger.Badger, serverRepository Repository, syncDirAdapter
 	proto.RecvTransactionHandleFunc(types.STARTSHARING, sharingHandler.StartSharing)
 	proto.RecvTransactionHandleFunc(types.STOPSHARING, sharingHandler.StopSharing)
 
-	return &ServerService{
-		port:     port,
-		password: password,
-		repo:     repo,
-		Proto:    proto,
+	serverService := &ServerService{
+		port:          port,
+		password:      password,
+		scrubInterval: scrubInterval,
+		repo:          repo,
+		Proto:         proto,
 
 		syncService:      syncService,
+		eventService:     eventService,
+		converters:       converters,
 		syncDirAdapter:   syncDirAdapter,
 		serverRepository: serverRepository,
-	}, nil
+		adminToken:       adminToken,
+		startedAt:        time.Now(),
+		safeMode:         config.GetViperEnvVariables("SAFE_MODE") == "true",
+	}
+	serverService.health.Store(&types.HealthRes{State: types.HealthStarting, SafeMode: serverService.safeMode, Checks: []types.HealthCheck{}})
+
+	return serverService, nil
 }
 
 // StopServer stop quic-s server
@@ -108,11 +331,21 @@ func (ss *ServerService) StopServer() error {
 	fmt.Println("                           Stop                             ")
 	fmt.Println("************************************************************")
 
+	// state lost on shutdown does not break anything, so database is closed even if it is not saved
+	// (it is not saved in safe mode, in which server writes nothing to the store)
+	if !ss.safeMode {
+		err := ss.saveRuntimeState()
+		if err != nil {
+			log.Println("quics err: ", err)
+		}
+	}
+
 	err := ss.repo.Close()
 	if err != nil {
 		return err
 	}
 
+	ss.protocolStopping.Store(true)
 	err = ss.Proto.Close()
 	if err != nil {
 		return err
@@ -123,57 +356,221 @@ func (ss *ServerService) StopServer() error {
 }
 
 // ListenProtocol is executed when server starts
+// syncs are not accepted while server is not healthy (startup checks have not passed, or a check is failing)
 func (ss *ServerService) ListenProtocol() error {
+	if ss.safeMode {
+		err := errors.New("[ServerService.ListenProtocol] " + types.SafeMode + ": syncs of clients are not accepted in safe mode")
+		log.Println("quics err: ", err)
+		return err
+	}
+	if health := ss.Health(); health.State != types.HealthReady {
+		err := errors.New("[ServerService.ListenProtocol] server is not ready (state: " + health.State + "): " + failedHealthChecks(health))
+		log.Println("quics err: ", err)
+		return err
+	}
+
 	fmt.Println("************************************************************")
 	fmt.Println("                     Listen Protocol                        ")
 	fmt.Println("************************************************************")
 
 	// start quics protocol server
 	ss.syncService.BackgroundFullScan(300)
-	errChan := make(chan error)
-	go func() {
+	ss.syncService.BackgroundScrub(ss.scrubInterval)
+	ss.syncService.BackgroundDiskCheck(DiskCheckInterval)
+	ss.backgroundPruneTransfers()
+	maxRestarts, err := strconv.ParseUint(config.GetViperEnvVariables("PROTOCOL_RESTARTS"), 10, 31)
+	if err != nil {
+		log.Println("quics alert: ", "invalid PROTOCOL_RESTARTS, use default restarts: ", err)
+		maxRestarts, _ = strconv.ParseUint(config.DefaultProtocolRestarts, 10, 31)
+	}
+	supervision := protocolSupervision{
+		start:          ss.Proto.Start,
+		startupWait:    ProtocolStartupWait,
+		stableDuration: ProtocolStableDuration,
+		backoff:        ProtocolRestartBackoff,
+		maxBackoff:     MaxProtocolRestartBackoff,
+		maxRestarts:    maxRestarts,
+	}
+
+	errChan := make(chan error, 1)
+	go ss.superviseProtocol(supervision, errChan)
+
+	err = <-errChan
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// superviseProtocol runs quics protocol listener and sends to errChan whether it has started listening
+// listener which fails on startup is not restarted, so that server fails fast (e.g., port in use); but once it has listened,
+// listener which dies (e.g., udp socket error or panic) is restarted with backoff up to PROTOCOL_RESTARTS times in a row
+// health is degraded (protocol check) while listener is down, and stays degraded when it can not be restarted
+func (ss *ServerService) superviseProtocol(supervision protocolSupervision, errChan chan<- error) {
+	var err error
+	started := false
+	restarts := uint64(0)
+	for {
+		startedAt := time.Now()
+		done := make(chan error, 1)
 		go func() {
-			time.Sleep(3 * time.Second)
-			errChan <- nil
+			done <- supervision.start()
 		}()
-		err := ss.Proto.Start()
-		if err != nil {
+
+		select {
+		case err = <-done:
+		case <-time.After(supervision.startupWait):
+			if !started {
+				started = true
+				errChan <- nil
+			} else if ss.protocolDown.Swap(nil) != nil {
+				log.Println("quics: quics protocol listener is restarted (", restarts, " restarts in a row)")
+				ss.runHealthChecks(types.HealthDegraded)
+			}
+			err = <-done
+		}
+
+		if ss.protocolStopping.Load() {
+			return
+		}
+		if !started {
 			log.Println("quics err: ", err)
 			errChan <- err
+			return
+		}
+		if err == nil {
+			err = errors.New("listener stopped")
+		}
+		if time.Since(startedAt) >= supervision.stableDuration {
+			restarts = 0
 		}
-	}()
 
-	err := <-errChan
-	if err != nil {
-		return err
+		if restarts >= supervision.maxRestarts {
+			reason := fmt.Sprintf("quics protocol listener died and is not restarted anymore (%d restarts in a row): %s", restarts, err.Error())
+			ss.protocolDown.Store(&reason)
+			log.Println("quics alert: ", reason)
+			ss.runHealthChecks(types.HealthDegraded)
+			return
+		}
+
+		backoff := supervision.backoff << restarts
+		if backoff > supervision.maxBackoff || backoff <= 0 {
+			backoff = supervision.maxBackoff
+		}
+		restarts++
+		reason := fmt.Sprintf("quics protocol listener died, restarting in %s (restart %d of %d): %s", backoff, restarts, supervision.maxRestarts, err.Error())
+		ss.protocolDown.Store(&reason)
+		log.Println("quics alert: ", reason)
+		ss.runHealthChecks(types.HealthDegraded)
+
+		time.Sleep(backoff)
+		if ss.protocolStopping.Load() {
+			return
+		}
 	}
-	return nil
 }
 
-func (ss *ServerService) SetPassword(request *types.Server) error {
+// SetPassword changes password of server after current password of request is verified (not verified when server has no password)
+func (ss *ServerService) SetPassword(request *types.SetPasswordReq) error {
 	log.Println("quics: set password")
 
-	err := config.WriteViperEnvVariables("PASSWORD", request.Password)
+	if !ss.verifyCurrentPassword(request.CurrentPassword) {
+		log.Println("quics: set password is rejected: current password is wrong")
+		return ErrWrongPassword
+	}
+
+	return ss.writePassword(request.Password)
+}
+
+// IsAdminToken checks whether token is admin token of running server, so that its caller is served as admin (e.g., without redaction)
+func (ss *ServerService) IsAdminToken(token string) bool {
+	return token != "" && hmac.Equal([]byte(ss.adminToken), []byte(token))
+}
+
+// ResetPassword resets password of server to default one after admin token of running server is verified
+func (ss *ServerService) ResetPassword(request *types.ResetPasswordReq) error {
+	log.Println("quics: reset password")
+
+	if !hmac.Equal([]byte(ss.adminToken), []byte(request.AdminToken)) {
+		log.Println("quics: reset password is rejected: admin token is wrong")
+		return ErrInvalidAdminToken
+	}
+
+	return ss.writePassword(config.DefaultPassword)
+}
+
+// verifyCurrentPassword checks password against salted hash recorded by the last change of password,
+// or against password read on start (database, then qis.env) when it was not changed yet (true when server has no password)
+func (ss *ServerService) verifyCurrentPassword(password string) bool {
+	server, err := ss.serverRepository.GetPassword()
+	if err == nil && server.PasswordHash != "" {
+		return utils.VerifyPasswordHash(server.PasswordHash, password)
+	}
+
+	current := config.GetViperEnvVariables("PASSWORD")
+	if err == nil && server.Password != "" {
+		current = server.Password
+	}
+
+	return current == "" || hmac.Equal([]byte(current), []byte(password))
+}
+
+// writePassword records salted hash of password to database, and then saves password to qis.env
+// previous record is restored when qis.env is not written, so that password is not verified against hash of password not in use
+func (ss *ServerService) writePassword(password string) error {
+	passwordHash, err := utils.MakePasswordHash(password)
 	if err != nil {
 		log.Println("quics err: ", err)
 		return err
 	}
 
-	return nil
-}
+	previous, err := ss.serverRepository.GetPassword()
+	if err != nil {
+		previous = nil
+	}
 
-func (ss *ServerService) ResetPassword() error {
-	log.Println("quics: reset password")
+	err = ss.serverRepository.UpdatePassword(&types.Server{PasswordHash: passwordHash})
+	if err != nil {
+		log.Println("quics err: ", err)
+		return err
+	}
 
-	err := config.WriteViperEnvVariables("PASSWORD", config.DefaultPassword)
+	err = config.WriteViperEnvVariables("PASSWORD", password)
 	if err != nil {
 		log.Println("quics err: ", err)
+
+		var restoreErr error
+		if previous != nil {
+			restoreErr = ss.serverRepository.UpdatePassword(previous)
+		} else {
+			restoreErr = ss.serverRepository.DeletePassword()
+		}
+		if restoreErr != nil {
+			log.Println("quics err: [ServerService.writePassword] restore password record: ", restoreErr)
+		}
 		return err
 	}
 
 	return nil
 }
 
+// writeAdminToken writes new random admin token to admin token file readable only by owner, and returns it
+func writeAdminToken() (string, error) {
+	token := make([]byte, AdminTokenLength)
+	_, err := rand.Read(token)
+	if err != nil {
+		return "", errors.New("[writeAdminToken] generate admin token: " + err.Error())
+	}
+	adminToken := hex.EncodeToString(token)
+
+	err = os.WriteFile(utils.GetAdminTokenPath(), []byte(adminToken), 0600)
+	if err != nil {
+		return "", errors.New("[writeAdminToken] write admin token: " + err.Error())
+	}
+
+	return adminToken, nil
+}
+
 func (ss *ServerService) Ping(request *types.Ping) (*types.Ping, error) {
 	client, err := ss.serverRepository.GetClientByUUID(request.UUID)
 	if err != nil {
@@ -190,158 +587,2577 @@ func (ss *ServerService) Ping(request *types.Ping) (*types.Ping, error) {
 	}, nil
 }
 
-func (ss *ServerService) ShowClient(uuid string) ([]types.Client, error) {
-	log.Println("quics: show client logs (uudi: ", uuid, ")")
+// ShowClient returns clients (every client when uuid is empty, or clients attached to root directory when root is given)
+// narrowed by filter (owner, prefix)
+func (ss *ServerService) ShowClient(uuid string, root string, filter *types.LogFilter, pageReq *types.PageReq) (*types.Page[types.Client], error) {
+	log.Println("quics: show client logs (uudi: ", uuid, ", root: ", root, ", filter: ", filter, ")")
 
-	if uuid == "" {
-		clients, err := ss.serverRepository.GetAllClients()
-		if err != nil {
-			log.Println("quics err: ", err)
-			return nil, err
-		}
-		return clients, nil
-	}
-	client, err := ss.serverRepository.GetClientByUUID(uuid)
+	match, err := ss.clientMatcher(filter)
 	if err != nil {
 		log.Println("quics err: ", err)
 		return nil, err
 	}
 
-	return []types.Client{*client}, nil
-}
+	if uuid != "" {
+		client, err := ss.serverRepository.GetClientByUUID(uuid)
+		if err != nil {
+			log.Println("quics err: ", err)
+			return nil, err
+		}
 
-func (ss *ServerService) ShowDir(afterPath string) ([]types.RootDirectory, error) {
-	log.Println("quics: show dir logs (afterPath: ", afterPath, ")")
+		return types.NewPageFromItems(filterItems([]types.Client{*client}, match), pageReq), nil
+	}
 
-	if afterPath == "" {
-		dirs, err := ss.serverRepository.GetAllRootDirectories()
+	// find clients which are attached to the root directory
+	if root != "" {
+		clients, err := ss.serverRepository.GetAllClients()
 		if err != nil {
 			log.Println("quics err: ", err)
 			return nil, err
 		}
 
-		return dirs, nil
+		attachedClients := []types.Client{}
+		for _, client := range clients {
+			for _, rootDir := range client.Root {
+				if rootDir.AfterPath == root {
+					attachedClients = append(attachedClients, client)
+					break
+				}
+			}
+		}
+
+		return types.NewPageFromItems(filterItems(attachedClients, match), pageReq), nil
 	}
 
-	dir, err := ss.serverRepository.GetRootDirectoryByPath(afterPath)
+	clients, err := ss.serverRepository.GetClientsPage(match, pageReq)
 	if err != nil {
 		log.Println("quics err: ", err)
 		return nil, err
 	}
-	return []types.RootDirectory{*dir}, nil
+	return clients, nil
 }
 
-func (ss *ServerService) ShowFile(afterPath string) ([]types.File, error) {
-	log.Println("quics: show file logs (afterPath: ", afterPath, ")")
+// ShowDir returns root directory of afterPath (every root directory when it is empty) narrowed by filter (owner, prefix, uuid)
+func (ss *ServerService) ShowDir(afterPath string, filter *types.LogFilter, pageReq *types.PageReq) (*types.Page[types.RootDirectory], error) {
+	log.Println("quics: show dir logs (afterPath: ", afterPath, ", filter: ", filter, ")")
+
+	match := dirMatcher(filter)
 
 	if afterPath == "" {
-		files, err := ss.serverRepository.GetAllFiles()
+		dirs, err := ss.serverRepository.GetRootDirectoriesPage(scanPrefixOf(filter), match, pageReq)
 		if err != nil {
 			log.Println("quics err: ", err)
 			return nil, err
 		}
 
-		return files, nil
+		return dirs, nil
 	}
 
-	file, err := ss.serverRepository.GetFileByAfterPath(afterPath)
+	dir, err := ss.serverRepository.GetRootDirectoryByPath(afterPath)
 	if err != nil {
 		log.Println("quics err: ", err)
 		return nil, err
 	}
-	return []types.File{*file}, nil
+	return types.NewPageFromItems(filterItems([]types.RootDirectory{*dir}, match), pageReq), nil
 }
 
-func (ss *ServerService) ShowHistory(afterPath string) ([]types.FileHistory, error) {
-	log.Println("quics: show history logs (afterPath: ", afterPath, ")")
+// ShowFile returns files of afterPath (every file when it is empty, or files matched with it when it is glob pattern)
+// narrowed by filter (owner, prefix, uuid, time range, size range, tags, custom metadata)
+// files having tags of filter are looked up by tag index when afterPath is empty, and the rest of filter is applied to them
+func (ss *ServerService) ShowFile(afterPath string, filter *types.LogFilter, pageReq *types.PageReq) (*types.Page[types.File], error) {
+	log.Println("quics: show file logs (afterPath: ", afterPath, ", filter: ", filter, ")")
 
-	if afterPath == "" {
-		histories, err := ss.serverRepository.GetAllHistories()
+	match, err := ss.fileMatcher(filter)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	var files []types.File
+	switch {
+	// glob pattern (e.g., /root/logs/*.txt) is matched with every stored afterPath
+	case utils.IsGlobPattern(afterPath):
+		files, err = ss.serverRepository.GetFilesByPattern(afterPath)
+
+	case afterPath != "":
+		var file *types.File
+		file, err = ss.serverRepository.GetFileByAfterPath(afterPath)
+		if err == nil {
+			files = []types.File{*file}
+		}
+
+	case filter != nil && len(filter.Tags) != 0:
+		files, err = ss.serverRepository.GetFilesByTags(filter.Tags)
+
+	default:
+		var page *types.Page[types.File]
+		page, err = ss.serverRepository.GetFilesPage(scanPrefixOf(filter), match, pageReq)
 		if err != nil {
 			log.Println("quics err: ", err)
 			return nil, err
 		}
-
-		return histories, nil
+		return page, nil
 	}
-
-	history, err := ss.serverRepository.GetHistoryByAfterPath(afterPath)
 	if err != nil {
 		log.Println("quics err: ", err)
 		return nil, err
 	}
 
-	fmt.Printf("*   Path: %s   |   Date: %s   |   UUID: %s   |   Timestamp: %d   |   Hash: %s   |*\n", history.BeforePath+history.AfterPath, history.Date, history.UUID, history.Timestamp, history.Hash)
-
-	return []types.FileHistory{*history}, nil
+	return types.NewPageFromItems(filterItems(files, match), pageReq), nil
 }
 
-func (ss *ServerService) RemoveClient(uuid string) error {
-	log.Println("quics: remove client (uuid: ", uuid, ")")
-
-	if uuid == "" {
-		err := ss.serverRepository.DeleteAllClients()
-		if err != nil {
-			log.Println("quics err: ", err)
-			return err
-		}
+// ShowOrphanedFile returns files whose root directory (RootDirKey) does not exist anymore (e.g., removed by remove dir)
+func (ss *ServerService) ShowOrphanedFile(pageReq *types.PageReq) (*types.Page[types.File], error) {
+	log.Println("quics: show orphaned file logs")
 
-		return nil
-	}
-	err := ss.serverRepository.DeleteClientByUUID(uuid)
+	files, err := ss.getOrphanedFiles()
 	if err != nil {
 		log.Println("quics err: ", err)
-		return err
+		return nil, err
 	}
 
-	return nil
+	return types.NewPageFromItems(files, pageReq), nil
 }
 
-func (ss *ServerService) RemoveDir(afterPath string) error {
-	log.Println("quics: remove dir (afterPath: ", afterPath, ")")
-
-	if afterPath == "" {
-		err := ss.serverRepository.DeleteAllRootDirectories()
-		if err != nil {
-			log.Println("quics err: ", err)
-			return err
-		}
+// ShowDuplicateFile returns sets of files narrowed by filter whose latest contents are identical
+// files are grouped by ContentHash in a single pass, so that files are never compared with each other
+// (deleted files, and files whose contents are not received or hashed yet, are not counted)
+func (ss *ServerService) ShowDuplicateFile(filter *types.LogFilter) (*types.DuplicatesRes, error) {
+	log.Println("quics: show duplicate file logs (filter: ", filter, ")")
 
-		return nil
+	match, err := ss.fileMatcher(filter)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
 	}
 
-	err := ss.serverRepository.DeleteRootDirectoryByAfterPath(afterPath)
+	files, err := ss.serverRepository.GetAllFiles()
 	if err != nil {
 		log.Println("quics err: ", err)
-		return err
+		return nil, err
 	}
 
-	return nil
-}
-
-func (ss *ServerService) RemoveFile(afterPath string) error {
-	log.Println("quics: remove file (afterPath: ", afterPath, ")")
+	byContentHash := map[string]*types.DuplicateGroup{}
+	for _, file := range filterItems(files, match) {
+		if file.LatestHash == "" || !file.ContentsExisted || file.ContentHash == "" || file.Metadata.IsDir {
+			continue
+		}
 
-	if afterPath == "" {
-		err := ss.serverRepository.DeleteAllFiles()
-		if err != nil {
-			log.Println("quics err: ", err)
-			return err
+		group, ok := byContentHash[file.ContentHash]
+		if !ok {
+			group = &types.DuplicateGroup{
+				ContentHash: file.ContentHash,
+				Size:        file.Metadata.Size,
+				AfterPaths:  []string{},
+			}
+			byContentHash[file.ContentHash] = group
 		}
+		group.AfterPaths = append(group.AfterPaths, file.AfterPath)
+	}
 
-		return nil
+	duplicatesRes := &types.DuplicatesRes{
+		Groups: []types.DuplicateGroup{},
 	}
-	err := ss.serverRepository.DeleteFileByAfterPath(afterPath)
-	if err != nil {
-		log.Println("quics err: ", err)
-		return err
+	for _, group := range byContentHash {
+		if len(group.AfterPaths) < 2 {
+			continue
+		}
+
+		sort.Strings(group.AfterPaths)
+		group.ReclaimableBytes = group.Size * int64(len(group.AfterPaths)-1)
+		duplicatesRes.Groups = append(duplicatesRes.Groups, *group)
+		duplicatesRes.DuplicateFiles += uint64(len(group.AfterPaths) - 1)
+		duplicatesRes.ReclaimableBytes += group.ReclaimableBytes
 	}
+	sort.Slice(duplicatesRes.Groups, func(i, j int) bool {
+		if duplicatesRes.Groups[i].ReclaimableBytes != duplicatesRes.Groups[j].ReclaimableBytes {
+			return duplicatesRes.Groups[i].ReclaimableBytes > duplicatesRes.Groups[j].ReclaimableBytes
+		}
+		return duplicatesRes.Groups[i].AfterPaths[0] < duplicatesRes.Groups[j].AfterPaths[0]
+	})
 
-	return nil
+	return duplicatesRes, nil
+}
+
+// ShowConflicts returns unresolved conflicts of files under afterPath (every conflict when it is empty) grouped by root directory,
+// with competing versions of each file which can be kept by ResolveConflict
+func (ss *ServerService) ShowConflicts(afterPath string) (*types.ConflictsRes, error) {
+	log.Println("quics: show conflicts (afterPath: ", afterPath, ")")
+
+	conflicts, err := ss.syncService.ListConflicts(afterPath)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	byRootDir := map[string]*types.DirectoryConflicts{}
+	for _, conflict := range conflicts {
+		fileConflict := types.FileConflict{
+			AfterPath:  conflict.AfterPath,
+			Candidates: []types.ConflictCandidate{},
+		}
+		for side, history := range conflict.StagingFiles {
+			fileConflict.Candidates = append(fileConflict.Candidates, types.ConflictCandidate{
+				Side:      side,
+				UUID:      history.UUID,
+				Hash:      history.Hash,
+				Timestamp: history.Timestamp,
+				Date:      history.Date,
+				Size:      history.File.Size,
+			})
+		}
+		sort.Slice(fileConflict.Candidates, func(i, j int) bool {
+			if (fileConflict.Candidates[i].Side == "server") != (fileConflict.Candidates[j].Side == "server") {
+				return fileConflict.Candidates[i].Side == "server"
+			}
+			return fileConflict.Candidates[i].Side < fileConflict.Candidates[j].Side
+		})
+
+		rootDir := rootDirOf(conflict.AfterPath)
+		directory, ok := byRootDir[rootDir]
+		if !ok {
+			directory = &types.DirectoryConflicts{
+				RootDir:   rootDir,
+				Conflicts: []types.FileConflict{},
+			}
+			byRootDir[rootDir] = directory
+		}
+		directory.Conflicts = append(directory.Conflicts, fileConflict)
+	}
+
+	conflictsRes := &types.ConflictsRes{
+		Directories: []types.DirectoryConflicts{},
+	}
+	for _, directory := range byRootDir {
+		sort.Slice(directory.Conflicts, func(i, j int) bool {
+			return directory.Conflicts[i].AfterPath < directory.Conflicts[j].AfterPath
+		})
+		conflictsRes.Directories = append(conflictsRes.Directories, *directory)
+		conflictsRes.Conflicts += uint64(len(directory.Conflicts))
+	}
+	sort.Slice(conflictsRes.Directories, func(i, j int) bool {
+		return conflictsRes.Directories[i].RootDir < conflictsRes.Directories[j].RootDir
+	})
+
+	return conflictsRes, nil
+}
+
+// ResolveConflict resolves conflict of the file by keeping version of keep ("server" or UUID of client), and force syncs it to clients
+func (ss *ServerService) ResolveConflict(afterPath string, keep string) (*types.File, error) {
+	log.Println("quics: resolve conflict (afterPath: ", afterPath, ", keep: ", keep, ")")
+
+	file, err := ss.syncService.ResolveConflict(afterPath, keep)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// ShowHistory returns histories of afterPath (every history when it is empty, or histories matched with it when it is glob pattern)
+// narrowed by filter (owner, prefix, uuid, time range, size range)
+func (ss *ServerService) ShowHistory(afterPath string, filter *types.LogFilter, pageReq *types.PageReq) (*types.Page[types.FileHistory], error) {
+	log.Println("quics: show history logs (afterPath: ", afterPath, ", filter: ", filter, ")")
+
+	match, err := ss.historyMatcher(filter)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	if afterPath == "" {
+		histories, err := ss.serverRepository.GetHistoriesPage(scanPrefixOf(filter), match, pageReq)
+		if err != nil {
+			log.Println("quics err: ", err)
+			return nil, err
+		}
+
+		return histories, nil
+	}
+
+	if utils.IsGlobPattern(afterPath) {
+		histories, err := ss.serverRepository.GetHistoriesByPattern(afterPath)
+		if err != nil {
+			log.Println("quics err: ", err)
+			return nil, err
+		}
+
+		return types.NewPageFromItems(filterItems(histories, match), pageReq), nil
+	}
+
+	history, err := ss.serverRepository.GetHistoryByAfterPath(afterPath)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	fmt.Printf("*   Path: %s   |   Date: %s   |   UUID: %s   |   Timestamp: %d   |   Hash: %s   |*\n", history.BeforePath+history.AfterPath, history.Date, history.UUID, history.Timestamp, history.Hash)
+
+	return types.NewPageFromItems(filterItems([]types.FileHistory{*history}, match), pageReq), nil
+}
+
+// ShowCommitHistory returns histories of files committed with commit set of id narrowed by filter
+func (ss *ServerService) ShowCommitHistory(id string, filter *types.LogFilter, pageReq *types.PageReq) (*types.Page[types.FileHistory], error) {
+	log.Println("quics: show history logs (commit: ", id, ", filter: ", filter, ")")
+
+	match, err := ss.historyMatcher(filter)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	histories, err := ss.serverRepository.GetHistoriesByCommit(id)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	return types.NewPageFromItems(filterItems(histories, match), pageReq), nil
+}
+
+// CountClient counts clients narrowed by filter (owner, prefix, uuid)
+// clients are counted by keys alone when filter is empty, since every filter of clients is matched with their root directories
+func (ss *ServerService) CountClient(filter *types.LogFilter, ctx context.Context) (*types.CountRes, error) {
+	log.Println("quics: count clients (filter: ", filter, ")")
+
+	match, err := ss.clientMatcher(filter)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	count, err := ss.serverRepository.CountClients(match, ctx)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	return &types.CountRes{Count: count, KeysOnly: match == nil}, nil
+}
+
+// CountDir counts root directories narrowed by filter (owner, prefix, uuid)
+// prefix is matched with keys, so root directories are counted by keys alone when filter has nothing else
+func (ss *ServerService) CountDir(filter *types.LogFilter, ctx context.Context) (*types.CountRes, error) {
+	log.Println("quics: count dirs (filter: ", filter, ")")
+
+	prefix, valueFilter := splitCountFilter(filter)
+	match := dirMatcher(valueFilter)
+
+	var matchPath func(afterPath string) bool
+	if prefix != "" {
+		matchPath = func(afterPath string) bool { return overlapsPath(afterPath, prefix) }
+	}
+
+	count, err := ss.serverRepository.CountRootDirectories(prefix, matchPath, match, ctx)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	return &types.CountRes{Count: count, KeysOnly: match == nil}, nil
+}
+
+// CountFile counts files narrowed by filter (owner, prefix, uuid, time range, size range, tags, custom metadata)
+// prefix is matched with keys, so files are counted by keys alone when filter has nothing else
+func (ss *ServerService) CountFile(filter *types.LogFilter, ctx context.Context) (*types.CountRes, error) {
+	log.Println("quics: count files (filter: ", filter, ")")
+
+	prefix, valueFilter := splitCountFilter(filter)
+	match, err := ss.fileMatcher(valueFilter)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	count, err := ss.serverRepository.CountFiles(prefix, underPathMatcher(prefix), match, ctx)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	return &types.CountRes{Count: count, KeysOnly: match == nil}, nil
+}
+
+// CountHistory counts histories narrowed by filter (owner, prefix, uuid, time range, size range)
+// prefix is matched with keys, so histories are counted by keys alone when filter has nothing else
+func (ss *ServerService) CountHistory(filter *types.LogFilter, ctx context.Context) (*types.CountRes, error) {
+	log.Println("quics: count histories (filter: ", filter, ")")
+
+	prefix, valueFilter := splitCountFilter(filter)
+	match, err := ss.historyMatcher(valueFilter)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	count, err := ss.serverRepository.CountHistories(prefix, underPathMatcher(prefix), match, ctx)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	return &types.CountRes{Count: count, KeysOnly: match == nil}, nil
+}
+
+// splitCountFilter splits filter into prefix, which is matched with keys, and the rest, which is matched with values (nil when it is empty)
+func splitCountFilter(filter *types.LogFilter) (string, *types.LogFilter) {
+	if filter == nil {
+		return "", nil
+	}
+
+	valueFilter := *filter
+	valueFilter.Prefix = ""
+	if valueFilter.IsEmpty() {
+		return filter.Prefix, nil
+	}
+	return filter.Prefix, &valueFilter
+}
+
+// underPathMatcher returns matcher of after paths under prefix (nil when prefix is empty)
+func underPathMatcher(prefix string) func(afterPath string) bool {
+	if prefix == "" {
+		return nil
+	}
+
+	return func(afterPath string) bool { return utils.IsUnderPath(prefix, afterPath) }
+}
+
+// filterItems returns items matched with match (every item when it is nil)
+func filterItems[T any](items []T, match func(*T) bool) []T {
+	if match == nil {
+		return items
+	}
+
+	matched := []T{}
+	for i := range items {
+		if match(&items[i]) {
+			matched = append(matched, items[i])
+		}
+	}
+	return matched
+}
+
+// scanPrefixOf returns key range of listing narrowed by prefix of filter (e.g., /root/sub matches /root/sub and /root/sub/*)
+// keys of the range can also be other paths (e.g., /root/subway), so prefix is matched again by matchers
+func scanPrefixOf(filter *types.LogFilter) string {
+	if filter == nil {
+		return ""
+	}
+	return filter.Prefix
+}
+
+// overlapsPath checks whether root directory and prefix overlap (either one is under the other)
+func overlapsPath(rootDir string, prefix string) bool {
+	return utils.IsUnderPath(prefix, rootDir) || utils.IsUnderPath(rootDir, prefix)
+}
+
+// rootDirOf returns after path of root directory of afterPath (e.g., /root of /root/a.txt)
+func rootDirOf(afterPath string) string {
+	rootDirName, _ := utils.GetNamesByAfterPath(afterPath)
+	return "/" + rootDirName
+}
+
+// rootDirOwners returns owners of root directories by after path, which are read only when filter has owner
+func (ss *ServerService) rootDirOwners(filter *types.LogFilter) (map[string]string, error) {
+	owners := map[string]string{}
+	if filter.Owner == "" {
+		return owners, nil
+	}
+
+	rootDirs, err := ss.serverRepository.GetAllRootDirectories()
+	if err != nil {
+		return nil, err
+	}
+	for _, rootDir := range rootDirs {
+		owners[rootDir.AfterPath] = rootDir.Owner
+	}
+	return owners, nil
+}
+
+func (ss *ServerService) clientMatcher(filter *types.LogFilter) (func(*types.Client) bool, error) {
+	if filter.IsEmpty() {
+		return nil, nil
+	}
+	owners, err := ss.rootDirOwners(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(client *types.Client) bool {
+		if filter.UUID != "" && client.UUID != filter.UUID {
+			return false
+		}
+
+		ownerMatched, prefixMatched := filter.Owner == "", filter.Prefix == ""
+		for _, rootDir := range client.Root {
+			ownerMatched = ownerMatched || owners[rootDir.AfterPath] == filter.Owner
+			prefixMatched = prefixMatched || overlapsPath(rootDir.AfterPath, filter.Prefix)
+		}
+		return ownerMatched && prefixMatched
+	}, nil
+}
+
+func dirMatcher(filter *types.LogFilter) func(*types.RootDirectory) bool {
+	if filter.IsEmpty() {
+		return nil
+	}
+
+	return func(dir *types.RootDirectory) bool {
+		return (filter.Owner == "" || dir.Owner == filter.Owner) &&
+			(filter.Prefix == "" || overlapsPath(dir.AfterPath, filter.Prefix)) &&
+			(filter.UUID == "" || slices.Contains(dir.UUIDs, filter.UUID))
+	}
+}
+
+func (ss *ServerService) fileMatcher(filter *types.LogFilter) (func(*types.File) bool, error) {
+	if filter.IsEmpty() {
+		return nil, nil
+	}
+	owners, err := ss.rootDirOwners(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(file *types.File) bool {
+		return (filter.Owner == "" || owners[rootDirOf(file.AfterPath)] == filter.Owner) &&
+			(filter.Prefix == "" || utils.IsUnderPath(filter.Prefix, file.AfterPath)) &&
+			(filter.UUID == "" || file.LatestEditClient == filter.UUID) &&
+			matchTimeRange(filter, file.Metadata.ModTime) &&
+			matchSizeRange(filter, file.Metadata.Size) &&
+			utils.MatchTags(file.Tags, filter.Tags) &&
+			utils.MatchFileMetadata(file.CustomMetadata, filter.Metadata)
+	}, nil
+}
+
+func (ss *ServerService) historyMatcher(filter *types.LogFilter) (func(*types.FileHistory) bool, error) {
+	if filter.IsEmpty() {
+		return nil, nil
+	}
+	owners, err := ss.rootDirOwners(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(history *types.FileHistory) bool {
+		if !filter.Since.IsZero() || !filter.Until.IsZero() {
+			date, err := utils.ParseHistoryDate(history.Date)
+			if err != nil || !matchTimeRange(filter, date) {
+				return false
+			}
+		}
+
+		return (filter.Owner == "" || owners[rootDirOf(history.AfterPath)] == filter.Owner) &&
+			(filter.Prefix == "" || utils.IsUnderPath(filter.Prefix, history.AfterPath)) &&
+			(filter.UUID == "" || history.UUID == filter.UUID) &&
+			matchSizeRange(filter, history.File.Size)
+	}, nil
+}
+
+// matchTimeRange checks whether t is in [Since, Until) of filter
+func matchTimeRange(filter *types.LogFilter, t time.Time) bool {
+	return (filter.Since.IsZero() || !t.Before(filter.Since)) && (filter.Until.IsZero() || t.Before(filter.Until))
+}
+
+// matchSizeRange checks whether size is in [MinSize, MaxSize] of filter
+func matchSizeRange(filter *types.LogFilter, size int64) bool {
+	return size >= filter.MinSize && (filter.MaxSize == 0 || size <= filter.MaxSize)
+}
+
+func (ss *ServerService) RemoveClient(uuid string) error {
+	log.Println("quics: remove client (uuid: ", uuid, ")")
+
+	if uuid == "" {
+		_, err := ss.runBulkOperation(&types.BulkOperation{Kind: types.BulkRemoveClients})
+		if err != nil {
+			log.Println("quics err: ", err)
+			return err
+		}
+
+		return nil
+	}
+	err := ss.serverRepository.DeleteClientByUUID(uuid)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return err
+	}
+
+	return nil
+}
+
+func (ss *ServerService) RemoveDir(afterPath string) error {
+	log.Println("quics: remove dir (afterPath: ", afterPath, ")")
+
+	err := ss.checkAppendOnly(afterPath)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return err
+	}
+
+	if afterPath == "" {
+		_, err := ss.runBulkOperation(&types.BulkOperation{Kind: types.BulkRemoveDirectories})
+		if err != nil {
+			log.Println("quics err: ", err)
+			return err
+		}
+
+		return nil
+	}
+
+	err = ss.serverRepository.DeleteRootDirectoryByAfterPath(afterPath)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return err
+	}
+
+	return nil
+}
+
+// RemoveFile removes the file of afterPath exactly, or every file under afterPath directory when recursive is true
+// (empty afterPath with recursive means all files), and returns the number of removed files
+// when purge is true, stored contents and histories of removed files are deleted as well
+func (ss *ServerService) RemoveFile(afterPath string, recursive bool, dryRun bool, purge bool) (*types.RemoveRes, error) {
+	log.Println("quics: remove file (afterPath: ", afterPath, ", recursive: ", recursive, ", dryRun: ", dryRun, ", purge: ", purge, ")")
+
+	if afterPath == "" && !recursive {
+		err := errors.New("[ServerService.RemoveFile] afterPath is required to remove a file")
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	err := ss.checkAppendOnly(afterPath)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	// removing many files is recorded not to leave them half removed by crash
+	if recursive && !dryRun {
+		removed, err := ss.runBulkOperation(&types.BulkOperation{Kind: types.BulkRemoveFiles, AfterPath: afterPath, Purge: purge})
+		if err != nil {
+			log.Println("quics err: ", err)
+			return nil, err
+		}
+
+		return &types.RemoveRes{
+			Removed: removed,
+		}, nil
+	}
+
+	if purge && !dryRun {
+		err = ss.purgeFileContents(afterPath, false, nil)
+		if err != nil {
+			log.Println("quics err: ", err)
+			return nil, err
+		}
+	}
+
+	removed, err := ss.serverRepository.DeleteFiles(afterPath, recursive, dryRun)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	return &types.RemoveRes{
+		Removed: removed,
+		DryRun:  dryRun,
+	}, nil
+}
+
+// RemoveOrphanedFile removes every file whose root directory does not exist anymore
+// append-only is not checked, because it is option of the removed root directory
+func (ss *ServerService) RemoveOrphanedFile(dryRun bool, purge bool) (*types.RemoveRes, error) {
+	log.Println("quics: remove orphaned file (dryRun: ", dryRun, ", purge: ", purge, ")")
+
+	files, err := ss.getOrphanedFiles()
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+	if dryRun {
+		return &types.RemoveRes{
+			Removed: uint64(len(files)),
+			DryRun:  true,
+		}, nil
+	}
+
+	endBulkOperation, err := ss.beginBulkOperation(&types.BulkOperation{Kind: types.BulkRemoveOrphanedFiles, Purge: purge, StartedAt: time.Now().Format(time.RFC3339)})
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+	defer endBulkOperation()
+
+	removed := uint64(0)
+	for _, file := range files {
+		ss.setBulkProgress(types.BulkPhaseRemove, removed, uint64(len(files)))
+		if purge {
+			err = ss.syncService.DeleteFileContents(file.AfterPath)
+			if err != nil {
+				err = errors.New("[ServerService.RemoveOrphanedFile] purge " + file.AfterPath + ": " + err.Error())
+				log.Println("quics err: ", err)
+				return nil, err
+			}
+		}
+
+		err = ss.serverRepository.DeleteFileByAfterPath(file.AfterPath)
+		if err != nil {
+			err = errors.New("[ServerService.RemoveOrphanedFile] remove " + file.AfterPath + ": " + err.Error())
+			log.Println("quics err: ", err)
+			return nil, err
+		}
+		removed++
+	}
+
+	return &types.RemoveRes{
+		Removed: removed,
+	}, nil
+}
+
+// getOrphanedFiles returns files whose RootDirKey is not one of stored root directories
+func (ss *ServerService) getOrphanedFiles() ([]types.File, error) {
+	rootDirs, err := ss.serverRepository.GetAllRootDirectories()
+	if err != nil {
+		return nil, err
+	}
+	existing := map[string]bool{}
+	for _, rootDir := range rootDirs {
+		existing[rootDir.AfterPath] = true
+	}
+
+	files, err := ss.serverRepository.GetAllFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	orphaned := []types.File{}
+	for _, file := range files {
+		if !existing[file.RootDirKey] {
+			orphaned = append(orphaned, file)
+		}
+	}
+
+	return orphaned, nil
+}
+
+// purgeFileContents deletes stored contents and histories of the file of afterPath, or every file under afterPath when recursive is true
+// progress (if not nil) is called with the number of purged files and matched files before each file is purged
+func (ss *ServerService) purgeFileContents(afterPath string, recursive bool, progress func(done uint64, total uint64)) error {
+	files, err := ss.serverRepository.GetAllFiles()
+	if err != nil {
+		return err
+	}
+
+	matched := []string{}
+	for _, file := range files {
+		if file.AfterPath == afterPath || (recursive && (afterPath == "" || utils.IsUnderPath(afterPath, file.AfterPath))) {
+			matched = append(matched, file.AfterPath)
+		}
+	}
+
+	for i, filePath := range matched {
+		if progress != nil {
+			progress(uint64(i), uint64(len(matched)))
+		}
+
+		err = ss.syncService.DeleteFileContents(filePath)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// runBulkOperation records operation before running it and clears the record after it is finished,
+// so that operation interrupted by crash (or failed) is found and resumed by ResumeBulkOperation on next startup
+// it returns the number of removed files (0 for other kinds)
+func (ss *ServerService) runBulkOperation(operation *types.BulkOperation) (uint64, error) {
+	now := time.Now()
+	operation.ID = fmt.Sprintf("%016x", now.UnixNano())
+	operation.StartedAt = now.Format(time.RFC3339)
+
+	endBulkOperation, err := ss.beginBulkOperation(operation)
+	if err != nil {
+		return 0, err
+	}
+	defer endBulkOperation()
+
+	err = ss.serverRepository.SetBulkOperation(operation)
+	if err != nil {
+		return 0, err
+	}
+
+	removed, err := ss.applyBulkOperation(operation)
+	if err != nil {
+		// record is kept, so that the operation is resumed on next startup
+		return 0, err
+	}
+
+	err = ss.serverRepository.DeleteBulkOperation(operation.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	return removed, nil
+}
+
+// applyBulkOperation removes everything targeted by operation
+// removal is idempotent, so running it again after partial removal leaves the same state as running it once
+func (ss *ServerService) applyBulkOperation(operation *types.BulkOperation) (uint64, error) {
+	switch operation.Kind {
+	case types.BulkRemoveClients:
+		return 0, ss.serverRepository.DeleteAllClients()
+	case types.BulkRemoveDirectories:
+		return 0, ss.serverRepository.DeleteAllRootDirectories()
+	case types.BulkRemoveFiles:
+		if operation.Purge {
+			err := ss.purgeFileContents(operation.AfterPath, true, func(done uint64, total uint64) {
+				ss.setBulkProgress(types.BulkPhasePurge, done, total)
+			})
+			if err != nil {
+				return 0, err
+			}
+		}
+		ss.setBulkProgress(types.BulkPhaseRemove, 0, 0)
+		return ss.serverRepository.DeleteFiles(operation.AfterPath, true, false)
+	default:
+		return 0, errors.New("[ServerService.applyBulkOperation] unknown bulk operation: " + operation.Kind)
+	}
+}
+
+// beginBulkOperation takes the only slot of destructive bulk operations, so that they run one at a time instead of competing scans
+// ErrBulkOperationRunning with progress of the running one is returned while the slot is taken; returned func frees the slot
+func (ss *ServerService) beginBulkOperation(operation *types.BulkOperation) (func(), error) {
+	progress := &types.BulkOperationRes{
+		Running:   true,
+		Kind:      operation.Kind,
+		AfterPath: operation.AfterPath,
+		Purge:     operation.Purge,
+		StartedAt: operation.StartedAt,
+		Phase:     types.BulkPhaseRemove,
+	}
+	for !ss.bulkOperation.CompareAndSwap(nil, progress) {
+		running := ss.bulkOperation.Load()
+		if running != nil {
+			return nil, fmt.Errorf("%w: a bulk operation is already running (kind: %s, afterPath: %s, phase: %s, done: %d of %d, started at: %s)",
+				ErrBulkOperationRunning, running.Kind, running.AfterPath, running.Phase, running.Done, running.Total, running.StartedAt)
+		}
+	}
+
+	return func() {
+		ss.bulkOperation.Store(nil)
+	}, nil
+}
+
+// setBulkProgress updates progress of running bulk operation (only the operation holding the slot calls it)
+func (ss *ServerService) setBulkProgress(phase string, done uint64, total uint64) {
+	running := ss.bulkOperation.Load()
+	if running == nil {
+		return
+	}
+
+	progress := *running
+	progress.Phase = phase
+	progress.Done = done
+	progress.Total = total
+	ss.bulkOperation.Store(&progress)
+}
+
+// ShowBulkOperation returns progress of destructive bulk operation which is running (Running is false when none is running)
+func (ss *ServerService) ShowBulkOperation() *types.BulkOperationRes {
+	running := ss.bulkOperation.Load()
+	if running == nil {
+		return &types.BulkOperationRes{}
+	}
+
+	progress := *running
+	return &progress
+}
+
+// saveRuntimeState saves state kept only in memory (e.g., recent logs), so that it is restored by RestoreRuntimeState on next startup
+func (ss *ServerService) saveRuntimeState() error {
+	state := &types.RuntimeState{
+		SavedAt:         time.Now().Format(time.RFC3339),
+		LastHistoryDate: ss.syncService.LastHistoryDate(),
+		RecentLogs:      []string{},
+	}
+	for _, line := range logs.Recent(logs.LevelInfo) {
+		state.RecentLogs = append(state.RecentLogs, line.Text)
+	}
+
+	err := ss.serverRepository.SetRuntimeState(state)
+	if err != nil {
+		err = errors.New("[ServerService.saveRuntimeState] save runtime state: " + err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// RestoreRuntimeState restores state saved on last shutdown before server accepts requests
+// state is deleted once it is restored, so that state of older run is not restored again after crash
+func (ss *ServerService) RestoreRuntimeState() error {
+	state, err := ss.serverRepository.GetRuntimeState()
+	if err != nil {
+		log.Println("quics err: ", err)
+		return err
+	}
+	if state == nil {
+		return nil
+	}
+
+	ss.syncService.RestoreLastHistoryDate(state.LastHistoryDate)
+
+	lines := []logs.Line{}
+	for _, text := range state.RecentLogs {
+		lines = append(lines, logs.Line{Level: logs.LevelOf(text), Text: text})
+	}
+	logs.Restore(lines)
+
+	err = ss.serverRepository.DeleteRuntimeState()
+	if err != nil {
+		log.Println("quics err: ", err)
+		return err
+	}
+	log.Println("quics: runtime state saved at ", state.SavedAt, " is restored")
+
+	return nil
+}
+
+// ResumeBulkOperation finishes bulk operations interrupted by crash (e.g., remove --all) before server accepts requests
+// removed records can not be restored, so the operations are rolled forward in the order they were started
+func (ss *ServerService) ResumeBulkOperation() error {
+	operations, err := ss.serverRepository.GetBulkOperations()
+	if err != nil {
+		log.Println("quics err: ", err)
+		return err
+	}
+
+	for _, operation := range operations {
+		err = ss.resumeBulkOperation(operation)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// resumeBulkOperation applies operation again and clears its record
+func (ss *ServerService) resumeBulkOperation(operation *types.BulkOperation) error {
+	log.Println("quics alert: ", "resume bulk operation interrupted by crash (kind: ", operation.Kind, ", afterPath: ", operation.AfterPath, ", purge: ", operation.Purge, ", startedAt: ", operation.StartedAt, ")")
+
+	endBulkOperation, err := ss.beginBulkOperation(operation)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return err
+	}
+	defer endBulkOperation()
+
+	removed, err := ss.applyBulkOperation(operation)
+	if err != nil {
+		err = errors.New("[ServerService.ResumeBulkOperation] " + err.Error())
+		log.Println("quics err: ", err)
+		return err
+	}
+
+	err = ss.serverRepository.DeleteBulkOperation(operation.ID)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return err
+	}
+
+	log.Println("quics: bulk operation resumed (kind: ", operation.Kind, ", removed files: ", removed, ")")
+	return nil
+}
+
+// WalkPaths calls visit with afterPath of every managed root directory (dirs) and file (files) without reading their records
+func (ss *ServerService) WalkPaths(files bool, dirs bool, visit func(afterPath string) error) error {
+	log.Println("quics: walk paths (files: ", files, ", dirs: ", dirs, ")")
+
+	return ss.serverRepository.WalkPaths(files, dirs, visit)
+}
+
+// Browse returns directory index of afterPath ("/" lists root directories) built from stored files and histories
+// removed files are not listed, and nil is returned when nothing is stored at afterPath
+func (ss *ServerService) Browse(afterPath string) (*types.BrowseRes, error) {
+	log.Println("quics: browse (afterPath: ", afterPath, ")")
+
+	files, err := ss.serverRepository.GetAllFiles()
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+	histories, err := ss.serverRepository.GetAllHistories()
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+	rootDirs, err := ss.serverRepository.GetAllRootDirectories()
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	versions := map[string][]uint64{}
+	for _, history := range histories {
+		versions[history.AfterPath] = append(versions[history.AfterPath], history.Timestamp)
+	}
+
+	found := afterPath == "/"
+	dirs := map[string]bool{}
+	entries := []types.BrowseEntry{}
+
+	// registered root directory is listed even if it has no file yet
+	for _, rootDir := range rootDirs {
+		if rootDir.AfterPath == afterPath {
+			found = true
+		}
+		if afterPath == "/" {
+			dirs[strings.TrimPrefix(rootDir.AfterPath, "/")] = true
+		}
+	}
+
+	prefix := strings.TrimSuffix(afterPath, "/") + "/"
+	for i := range files {
+		file := &files[i]
+		if file.LatestHash == "" {
+			continue
+		}
+
+		// afterPath of a file lists only the file
+		if file.AfterPath == afterPath {
+			found = true
+			entries = append(entries, newBrowseEntry(file, versions[file.AfterPath]))
+			continue
+		}
+		if !strings.HasPrefix(file.AfterPath, prefix) {
+			continue
+		}
+		found = true
+
+		name, _, isDir := strings.Cut(strings.TrimPrefix(file.AfterPath, prefix), "/")
+		if isDir {
+			dirs[name] = true
+			continue
+		}
+		entries = append(entries, newBrowseEntry(file, versions[file.AfterPath]))
+	}
+	if !found {
+		return nil, nil
+	}
+
+	for name := range dirs {
+		entries = append(entries, types.BrowseEntry{
+			Name:      name,
+			AfterPath: prefix + name,
+			IsDir:     true,
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].IsDir != entries[j].IsDir {
+			return entries[i].IsDir
+		}
+		return entries[i].Name < entries[j].Name
+	})
+
+	return &types.BrowseRes{
+		AfterPath: afterPath,
+		Entries:   entries,
+	}, nil
+}
+
+// newBrowseEntry makes entry of file with its versions (the latest first)
+func newBrowseEntry(file *types.File, versions []uint64) types.BrowseEntry {
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i] > versions[j]
+	})
+
+	_, name := filepath.Split(file.AfterPath)
+	return types.BrowseEntry{
+		Name:                name,
+		AfterPath:           file.AfterPath,
+		Size:                file.Metadata.Size,
+		ModTime:             file.Metadata.ModTime,
+		LatestSyncTimestamp: file.LatestSyncTimestamp,
+		Versions:            versions,
+	}
+}
+
+// SubscribeEvents returns event stream of afterPath (file or directory, empty means every path)
+func (ss *ServerService) SubscribeEvents(afterPath string) (<-chan types.Event, func()) {
+	log.Println("quics: subscribe events (afterPath: ", afterPath, ")")
+
+	return ss.eventService.Subscribe(afterPath)
+}
+
+// SubscribeLogs returns recent server logs and stream of new logs whose level is higher than or equal to level
+func (ss *ServerService) SubscribeLogs(level string) ([]logs.Line, <-chan logs.Line, func()) {
+	return logs.Subscribe(level)
+}
+
+// SubscribeClient adds path prefix filter so that client only receives changes under the prefix
+func (ss *ServerService) SubscribeClient(uuid string, prefix string) error {
+	log.Println("quics: subscribe client (uuid: ", uuid, ", prefix: ", prefix, ")")
+
+	if uuid == "" || !strings.HasPrefix(prefix, "/") {
+		err := errors.New("[ServerService.SubscribeClient] uuid and prefix (e.g., /rootDir/sub) are needed")
+		log.Println("quics err: ", err)
+		return err
+	}
+	prefix = strings.TrimSuffix(prefix, "/")
+
+	client, err := ss.serverRepository.GetClientByUUID(uuid)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return err
+	}
+
+	// prefix must be under root directory which client is syncing
+	registered := false
+	for _, root := range client.Root {
+		if utils.IsUnderPath(root.AfterPath, prefix) {
+			registered = true
+			break
+		}
+	}
+	if !registered {
+		err := errors.New("[ServerService.SubscribeClient] prefix is not under root directories of client: " + prefix)
+		log.Println("quics err: ", err)
+		return err
+	}
+
+	for _, subscription := range client.Subscriptions {
+		if subscription == prefix {
+			return nil
+		}
+	}
+	client.Subscriptions = append(client.Subscriptions, prefix)
+
+	err = ss.serverRepository.UpdateClient(client)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return err
+	}
+
+	return nil
+}
+
+// SetClientSchedule replaces bandwidth schedule of client, which is applied from the next bytes of running transfers
+func (ss *ServerService) SetClientSchedule(uuid string, schedule *types.BandwidthSchedule) error {
+	log.Println("quics: set client schedule (uuid: ", uuid, ", schedule: ", utils.FormatBandwidthSchedule(schedule), ")")
+
+	client, err := ss.serverRepository.GetClientByUUID(uuid)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return err
+	}
+
+	client.Schedule = *schedule
+	err = ss.serverRepository.UpdateClient(client)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return err
+	}
+
+	return nil
+}
+
+// SyncClientNow runs a full sync pass with connected client right away and reports changes exchanged
+func (ss *ServerService) SyncClientNow(uuid string) (*types.SyncNowRes, error) {
+	log.Println("quics: sync client now (uuid: ", uuid, ")")
+
+	syncNowRes, err := ss.syncService.SyncNow(uuid)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+	log.Println("quics: ", fmt.Sprintf("synced %s now: %d files scanned, %d pushed, %d pulled (%d pending changes covered)", uuid, syncNowRes.Scanned, syncNowRes.Pushed, syncNowRes.Pulled, syncNowRes.Pending))
+
+	return syncNowRes, nil
+}
+
+// UnsubscribeClient removes path prefix filter of client (empty prefix removes every filter)
+func (ss *ServerService) UnsubscribeClient(uuid string, prefix string) error {
+	log.Println("quics: unsubscribe client (uuid: ", uuid, ", prefix: ", prefix, ")")
+
+	client, err := ss.serverRepository.GetClientByUUID(uuid)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return err
+	}
+
+	subscriptions := []string{}
+	if prefix != "" {
+		prefix = strings.TrimSuffix(prefix, "/")
+		for _, subscription := range client.Subscriptions {
+			if subscription != prefix {
+				subscriptions = append(subscriptions, subscription)
+			}
+		}
+	}
+	client.Subscriptions = subscriptions
+
+	err = ss.serverRepository.UpdateClient(client)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return err
+	}
+
+	return nil
+}
+
+// ProvisionClients creates (or updates) clients with alias, ip and associations to root directories of entries at once
+// every entry is validated first, so nothing is saved when any entry is invalid or dryRun is requested
+func (ss *ServerService) ProvisionClients(entries []types.ProvisionEntry, dryRun bool) (*types.ProvisionRes, error) {
+	log.Println("quics: provision clients (entries: ", len(entries), ", dryRun: ", dryRun, ")")
+
+	if len(entries) == 0 {
+		err := errors.New("[ServerService.ProvisionClients] no client to provision")
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	provisionRes := &types.ProvisionRes{
+		DryRun:  dryRun,
+		Results: []types.ProvisionResult{},
+	}
+	clients := []*types.Client{}
+	rootDirs := map[string]*types.RootDirectory{}
+	seen := map[string]bool{}
+	valid := true
+
+	for i, entry := range entries {
+		result := types.ProvisionResult{
+			Row:  i + 1,
+			UUID: entry.UUID,
+		}
+
+		client, status, err := ss.provisionClient(entry, seen, rootDirs)
+		if err != nil {
+			result.Status = types.ProvisionInvalid
+			result.Error = err.Error()
+			valid = false
+		} else {
+			result.Status = status
+			clients = append(clients, client)
+		}
+		provisionRes.Results = append(provisionRes.Results, result)
+	}
+
+	if !valid || dryRun {
+		return provisionRes, nil
+	}
+
+	// new clients are given id from the same sequence as clients registered by quics protocol
+	for i, client := range clients {
+		if provisionRes.Results[i].Status != types.ProvisionCreated {
+			continue
+		}
+
+		id, err := ss.serverRepository.GetSequence([]byte("client"), 1)
+		if err != nil {
+			err = errors.New("[ServerService.ProvisionClients] get sequence: " + err.Error())
+			log.Println("quics err: ", err)
+			return nil, err
+		}
+		client.Id = id
+	}
+
+	updatedRootDirs := []*types.RootDirectory{}
+	for _, rootDir := range rootDirs {
+		updatedRootDirs = append(updatedRootDirs, rootDir)
+	}
+	err := ss.serverRepository.ProvisionClients(clients, updatedRootDirs)
+	if err != nil {
+		err = errors.New("[ServerService.ProvisionClients] save clients: " + err.Error())
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+	provisionRes.Applied = true
+
+	return provisionRes, nil
+}
+
+// provisionClient validates entry and returns client updated by it with status (created or updated)
+// root directories are loaded into rootDirs once, so that every entry adds its client to the same root directory
+func (ss *ServerService) provisionClient(entry types.ProvisionEntry, seen map[string]bool, rootDirs map[string]*types.RootDirectory) (*types.Client, string, error) {
+	if err := utils.ValidateUUID(entry.UUID); err != nil {
+		return nil, "", err
+	}
+	if seen[entry.UUID] {
+		return nil, "", errors.New("uuid is duplicated: " + entry.UUID)
+	}
+	seen[entry.UUID] = true
+
+	if len(entry.Alias) > MaxClientAliasLength {
+		return nil, "", fmt.Errorf("alias is longer than %d bytes", MaxClientAliasLength)
+	}
+	if strings.ContainsFunc(entry.Alias, func(r rune) bool { return r < 0x20 || r == 0x7f }) {
+		return nil, "", errors.New("alias must not contain control character")
+	}
+	if entry.Ip != "" && net.ParseIP(entry.Ip) == nil {
+		return nil, "", errors.New("invalid ip: " + entry.Ip)
+	}
+
+	status := types.ProvisionUpdated
+	client, err := ss.serverRepository.GetClientByUUID(entry.UUID)
+	if err == ss.serverRepository.ErrKeyNotFound() {
+		status = types.ProvisionCreated
+		client = &types.Client{
+			UUID: entry.UUID,
+		}
+	} else if err != nil {
+		return nil, "", errors.New("get client: " + err.Error())
+	}
+
+	if entry.Alias != "" {
+		client.Alias = entry.Alias
+	}
+	if entry.Ip != "" {
+		client.Ip = entry.Ip
+	}
+
+	for _, afterPath := range entry.RootDirs {
+		rootDir, ok := rootDirs[afterPath]
+		if !ok {
+			rootDir, err = ss.serverRepository.GetRootDirectoryByPath(afterPath)
+			if err != nil {
+				return nil, "", errors.New("root directory is not registered: " + afterPath)
+			}
+			rootDirs[afterPath] = rootDir
+		}
+
+		if !slices.Contains(rootDir.UUIDs, client.UUID) {
+			rootDir.UUIDs = append(rootDir.UUIDs, client.UUID)
+		}
+		if !slices.ContainsFunc(client.Root, func(root types.RootDirectory) bool { return root.AfterPath == afterPath }) {
+			client.Root = append(client.Root, *rootDir)
+		}
+	}
+
+	return client, status, nil
+}
+
+// SetDirAppendOnly sets whether existing files of root directory can be modified or deleted
+func (ss *ServerService) SetDirAppendOnly(afterPath string, appendOnly bool) error {
+	log.Println("quics: set dir (afterPath: ", afterPath, ", appendOnly: ", appendOnly, ")")
+
+	rootDir, err := ss.serverRepository.GetRootDirectoryByPath(afterPath)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return err
+	}
+
+	rootDir.AppendOnly = appendOnly
+	err = ss.serverRepository.UpdateRootDirectory(rootDir)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return err
+	}
+
+	return nil
+}
+
+// SetDirVersioning replaces versioning policies of root directory (empty policies keep full history of every file)
+func (ss *ServerService) SetDirVersioning(afterPath string, policies []types.VersioningPolicy) error {
+	log.Println("quics: set dir (afterPath: ", afterPath, ", versioning: ", policies, ")")
+
+	rootDir, err := ss.serverRepository.GetRootDirectoryByPath(afterPath)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return err
+	}
+
+	rootDir.VersioningPolicies = policies
+	err = ss.serverRepository.UpdateRootDirectory(rootDir)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return err
+	}
+
+	return nil
+}
+
+// SetDirPolicies replaces sync policies of root directory which override extension defaults (empty policies follow extension defaults)
+func (ss *ServerService) SetDirPolicies(afterPath string, policies []types.SyncPolicy) error {
+	log.Println("quics: set dir (afterPath: ", afterPath, ", policies: ", policies, ")")
+
+	rootDir, err := ss.serverRepository.GetRootDirectoryByPath(afterPath)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return err
+	}
+
+	rootDir.Policies = policies
+	err = ss.serverRepository.UpdateRootDirectory(rootDir)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return err
+	}
+
+	return nil
+}
+
+// ExplainPolicy returns sync behaviors applied to afterPath and where each of them came from
+func (ss *ServerService) ExplainPolicy(afterPath string) (*types.EffectivePolicy, error) {
+	policy, err := ss.syncService.ResolvePolicy(afterPath)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	return policy, nil
+}
+
+// MoveDir relocates root directory from fromAfterPath to toAfterPath with its files and histories
+func (ss *ServerService) MoveDir(fromAfterPath string, toAfterPath string) error {
+	log.Println("quics: move dir (from: ", fromAfterPath, ", to: ", toAfterPath, ")")
+
+	// only root directory (e.g., /rootDir) can be moved, because contents are stored by root directory name
+	for _, afterPath := range []string{fromAfterPath, toAfterPath} {
+		err := utils.ValidateRootDirAfterPath(afterPath)
+		if err != nil {
+			err = errors.New("[ServerService.MoveDir] " + err.Error())
+			log.Println("quics err: ", err)
+			return err
+		}
+	}
+	if fromAfterPath == toAfterPath {
+		err := errors.New("[ServerService.MoveDir] from and to are same")
+		log.Println("quics err: ", err)
+		return err
+	}
+
+	_, err := ss.serverRepository.GetRootDirectoryByPath(fromAfterPath)
+	if err != nil {
+		err = errors.New("[ServerService.MoveDir] root directory not found: " + fromAfterPath)
+		log.Println("quics err: ", err)
+		return err
+	}
+
+	// reject when destination overlaps existing root directory
+	rootDirs, err := ss.serverRepository.GetAllRootDirectories()
+	if err != nil {
+		log.Println("quics err: ", err)
+		return err
+	}
+	for _, rootDir := range rootDirs {
+		if rootDir.AfterPath == toAfterPath ||
+			strings.HasPrefix(rootDir.AfterPath, toAfterPath+"/") ||
+			strings.HasPrefix(toAfterPath, rootDir.AfterPath+"/") {
+			err := errors.New("[ServerService.MoveDir] destination overlaps existing directory: " + rootDir.AfterPath)
+			log.Println("quics err: ", err)
+			return err
+		}
+	}
+
+	err = ss.syncDirAdapter.MoveRootDir(fromAfterPath, toAfterPath)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return err
+	}
+
+	err = ss.serverRepository.MoveRootDirectory(fromAfterPath, toAfterPath)
+	if err != nil {
+		log.Println("quics err: ", err)
+
+		// restore contents to keep them consistent with database
+		if rollbackErr := ss.syncDirAdapter.MoveRootDir(toAfterPath, fromAfterPath); rollbackErr != nil {
+			log.Println("quics err: ", rollbackErr)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// MoveFile renames file from fromAfterPath to toAfterPath keeping its histories (see sync.Service.MoveFile)
+func (ss *ServerService) MoveFile(fromAfterPath string, toAfterPath string, overwrite bool) (*types.File, error) {
+	log.Println("quics: move file (from: ", fromAfterPath, ", to: ", toAfterPath, ", overwrite: ", overwrite, ")")
+
+	for _, afterPath := range []string{fromAfterPath, toAfterPath} {
+		if !isFileAfterPath(afterPath) || utils.IsGlobPattern(afterPath) {
+			err := errors.New("[ServerService.MoveFile] from and to must be /{root directory}/{file path}: " + afterPath)
+			log.Println("quics err: ", err)
+			return nil, err
+		}
+	}
+	if fromAfterPath == toAfterPath {
+		err := errors.New("[ServerService.MoveFile] from and to are same")
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	file, err := ss.syncService.MoveFile(fromAfterPath, toAfterPath, overwrite)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// checkAppendOnly returns error when afterPath is in append-only root directory
+// empty afterPath means every path, so any append-only root directory makes error
+func (ss *ServerService) checkAppendOnly(afterPath string) error {
+	if afterPath == "" {
+		rootDirs, err := ss.serverRepository.GetAllRootDirectories()
+		if err != nil {
+			return err
+		}
+
+		for _, rootDir := range rootDirs {
+			if rootDir.AppendOnly {
+				return errors.New("[ServerService.checkAppendOnly] root directory is append-only: " + rootDir.AfterPath)
+			}
+		}
+		return nil
+	}
+
+	if !strings.HasPrefix(afterPath, "/") {
+		return nil
+	}
+	rootDirName, _ := utils.GetNamesByAfterPath(afterPath)
+	rootDir, err := ss.serverRepository.GetRootDirectoryByPath("/" + rootDirName)
+	if err != nil {
+		// nothing to protect
+		return nil
+	}
+	if rootDir.AppendOnly {
+		return errors.New("[ServerService.checkAppendOnly] root directory is append-only: " + rootDir.AfterPath)
+	}
+
+	return nil
+}
+
+// UploadFile saves contents of size as the new latest version of afterPath (/{root directory}/{file path})
+// when expectedHash is given, the version is saved only if latest hash of the file still matches it
+func (ss *ServerService) UploadFile(afterPath string, size int64, fileContent io.Reader, expectedHash string) (*types.File, error) {
+	log.Println("quics: upload file (afterPath: ", afterPath, ", size: ", size, ", expectedHash: ", expectedHash, ")")
+
+	if !isFileAfterPath(afterPath) {
+		err := errors.New("[ServerService.UploadFile] afterPath must be /{root directory}/{file path}: " + afterPath)
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+	// contents are written under sync and history directories by afterPath, so .. must not climb out of them
+	err := utils.ValidateAfterPath(afterPath)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	file, err := ss.syncService.UploadFile(afterPath, newUploadedFileMetadata(afterPath, size), fileContent, expectedHash)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// OpenCommitSet opens commit set of name which groups uploads of several files
+func (ss *ServerService) OpenCommitSet(name string) (*types.CommitSet, error) {
+	log.Println("quics: open commit set (name: ", name, ")")
+
+	commitSet, err := ss.syncService.OpenCommitSet(name)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	return commitSet, nil
+}
+
+// StageCommitFile stages contents of size as member afterPath of open commit set
+func (ss *ServerService) StageCommitFile(id string, afterPath string, size int64, fileContent io.Reader) (*types.CommitSet, error) {
+	log.Println("quics: stage commit file (id: ", id, ", afterPath: ", afterPath, ", size: ", size, ")")
+
+	if !isFileAfterPath(afterPath) {
+		err := errors.New("[ServerService.StageCommitFile] afterPath must be /{root directory}/{file path}: " + afterPath)
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+	// staged contents are written under sync and history directories by afterPath, so .. must not climb out of them
+	err := utils.ValidateAfterPath(afterPath)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	commitSet, err := ss.syncService.StageCommitFile(id, afterPath, newUploadedFileMetadata(afterPath, size), fileContent)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	return commitSet, nil
+}
+
+// CommitSet makes every staged member of commit set the latest version at once
+func (ss *ServerService) CommitSet(id string) (*types.CommitSet, error) {
+	log.Println("quics: commit set (id: ", id, ")")
+
+	commitSet, err := ss.syncService.CommitSet(id)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	return commitSet, nil
+}
+
+func (ss *ServerService) AbortCommitSet(id string) error {
+	log.Println("quics: abort commit set (id: ", id, ")")
+
+	err := ss.syncService.AbortCommitSet(id)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return err
+	}
+
+	return nil
+}
+
+func (ss *ServerService) GetCommitSet(id string) (*types.CommitSet, error) {
+	commitSet, err := ss.syncService.GetCommitSet(id)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	return commitSet, nil
+}
+
+// isFileAfterPath reports whether afterPath is /{root directory}/{file path}
+func isFileAfterPath(afterPath string) bool {
+	rootDirName, fileName := "", ""
+	if strings.HasPrefix(afterPath, "/") && strings.Count(afterPath, "/") >= 2 {
+		rootDirName, fileName = utils.GetNamesByAfterPath(afterPath)
+	}
+	return rootDirName != "" && fileName != "" && !strings.HasSuffix(afterPath, "/")
+}
+
+// newUploadedFileMetadata returns metadata of contents of size uploaded through REST API
+func newUploadedFileMetadata(afterPath string, size int64) *types.FileMetadata {
+	return &types.FileMetadata{
+		Name:    filepath.Base(afterPath),
+		Size:    size,
+		Mode:    0644,
+		ModTime: time.Now(),
+		IsDir:   false,
+	}
 }
 
 func (ss *ServerService) DownloadFile(afterPath string, timestamp uint64) (*types.FileMetadata, io.Reader, error) {
 	log.Println("quics: download file (afterPath: ", afterPath, ")")
 
-	return ss.syncDirAdapter.GetFileFromHistoryDir(afterPath, timestamp)
+	return ss.syncService.OpenHistoryContents(afterPath, timestamp)
+}
+
+// GetFileDigest returns content hash and size of file of afterPath at version of timestamp, which a downloaded copy is verified against
+func (ss *ServerService) GetFileDigest(afterPath string, timestamp uint64, chunks bool) (*types.FileDigestRes, error) {
+	log.Println("quics: get file digest (afterPath: ", afterPath, ", timestamp: ", timestamp, ", chunks: ", chunks, ")")
+
+	return ss.syncService.GetFileDigest(afterPath, timestamp, chunks)
+}
+
+// ResolveVersion resolves version of file of afterPath selected by ordinal, timestamp or latest to its timestamp
+func (ss *ServerService) ResolveVersion(afterPath string, selector *types.VersionSelector) (*types.VersionRes, error) {
+	log.Println("quics: resolve version (afterPath: ", afterPath, ", ", selector.Kind, ": ", selector.Value, ")")
+
+	return ss.syncService.ResolveVersion(afterPath, selector)
+}
+
+// SignFile returns url which downloads file of afterPath at version of timestamp without login until expires passes
+// every signed url is revoked by RotateSigningKey
+func (ss *ServerService) SignFile(afterPath string, timestamp uint64, expires time.Duration) (*types.SignedURLRes, error) {
+	log.Println("quics: sign file (afterPath: ", afterPath, ", timestamp: ", timestamp, ", expires: ", expires, ")")
+
+	if expires <= 0 || expires > MaxSignedURLExpiry {
+		err := fmt.Errorf("[ServerService.SignFile] expires must be between 1s and %s", MaxSignedURLExpiry)
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	// url is signed only for version which can be downloaded now
+	_, fileContent, err := ss.syncService.OpenHistoryContents(afterPath, timestamp)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+	if closer, ok := fileContent.(io.Closer); ok {
+		closer.Close()
+	}
+
+	key, err := ss.getSigningKey()
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	expiresAt := time.Now().Add(expires).Truncate(time.Second)
+	query := url.Values{
+		"afterPath": {afterPath},
+		"timestamp": {strconv.FormatUint(timestamp, 10)},
+		"expires":   {strconv.FormatInt(expiresAt.Unix(), 10)},
+		"signature": {utils.SignDownload(key, afterPath, timestamp, expiresAt.Unix())},
+	}
+
+	return &types.SignedURLRes{
+		URL:       "https://" + config.GetRestServerAddress() + "/api/v1/server/download/signed?" + query.Encode(),
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// DownloadSignedFile returns contents of file signed by SignFile after checking its signature and expiry
+func (ss *ServerService) DownloadSignedFile(afterPath string, timestamp uint64, expires int64, signature string) (*types.FileMetadata, io.Reader, error) {
+	log.Println("quics: download signed file (afterPath: ", afterPath, ", timestamp: ", timestamp, ")")
+
+	key, err := ss.getSigningKey()
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, nil, err
+	}
+	if time.Now().Unix() > expires || !utils.VerifyDownloadSignature(key, afterPath, timestamp, expires, signature) {
+		log.Println("quics alert: ", "rejected signed url of ", afterPath)
+		return nil, nil, ErrInvalidSignature
+	}
+
+	return ss.syncService.OpenHistoryContents(afterPath, timestamp)
+}
+
+// RotateSigningKey replaces signing key with new random one, so that every url signed before is revoked
+func (ss *ServerService) RotateSigningKey() error {
+	log.Println("quics: rotate signing key")
+
+	key := make([]byte, SigningKeyLength)
+	_, err := rand.Read(key)
+	if err != nil {
+		err = errors.New("[ServerService.RotateSigningKey] generate key: " + err.Error())
+		log.Println("quics err: ", err)
+		return err
+	}
+
+	err = ss.serverRepository.SetSigningKey(key)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return err
+	}
+
+	return nil
+}
+
+// getSigningKey returns stored signing key, generating it on first use
+// (in safe mode key is never generated, so ErrInvalidSignature is returned when there is none)
+func (ss *ServerService) getSigningKey() ([]byte, error) {
+	if ss.safeMode {
+		key, err := ss.serverRepository.GetSigningKey()
+		if err != nil {
+			return nil, err
+		}
+		if key == nil {
+			return nil, ErrInvalidSignature
+		}
+		return key, nil
+	}
+
+	key := make([]byte, SigningKeyLength)
+	_, err := rand.Read(key)
+	if err != nil {
+		return nil, errors.New("[ServerService.getSigningKey] generate key: " + err.Error())
+	}
+
+	return ss.serverRepository.GetOrSetSigningKey(key)
+}
+
+// ConvertFile returns contents of file of afterPath at version of timestamp transcoded to accept (MIME type or extension) with its content type
+// stored contents are not changed, and convert.ErrNoConverter is returned when no enabled converter can transcode the file
+func (ss *ServerService) ConvertFile(afterPath string, timestamp uint64, accept string) ([]byte, string, error) {
+	log.Println("quics: convert file (afterPath: ", afterPath, ", accept: ", accept, ")")
+
+	target, err := convert.ParseTarget(accept)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, "", err
+	}
+
+	// version of timestamp never changes, so concurrent downloads of the same conversion read and convert it once
+	key := afterPath + "\x00" + strconv.FormatUint(timestamp, 10) + "\x00" + target
+	converted, shared, err := ss.convertFlight.Do(key, func() ([]byte, error) {
+		return ss.convertFile(afterPath, timestamp, target)
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	if shared {
+		log.Println("quics: conversion of ", afterPath, " (timestamp: ", timestamp, ") is shared by concurrent downloads")
+	}
+
+	return converted, target, nil
+}
+
+// convertFile reads contents of version of timestamp and transcodes them to target
+func (ss *ServerService) convertFile(afterPath string, timestamp uint64, target string) ([]byte, error) {
+	// server can not read contents encrypted by client
+	fileHistory, err := ss.syncService.GetFileHistory(afterPath, timestamp)
+	if err == nil && fileHistory.Encryption.IsEncrypted() {
+		err := fmt.Errorf("%w: contents of %s are encrypted by client, so server can not convert them", sync.ErrClientEncrypted, afterPath)
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	fileInfo, fileContent, err := ss.syncService.OpenHistoryContents(afterPath, timestamp)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+	if closer, ok := fileContent.(io.Closer); ok {
+		defer closer.Close()
+	}
+	if fileInfo.Size > convert.MaxInputSize {
+		err := fmt.Errorf("[ServerService.ConvertFile] file is larger than %d bytes to convert", convert.MaxInputSize)
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	contents, err := io.ReadAll(fileContent)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	source := convert.TypeOf(afterPath)
+	if source == target {
+		return contents, nil
+	}
+
+	converted, err := ss.converters.Convert(source, target, contents)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	return converted, nil
+}
+
+// DiffDir computes which files under afterPath were added, modified or removed between from and to using recorded histories
+// when content is true, modified files are compared by their contents (merkle root) not to report metadata-only changes
+func (ss *ServerService) DiffDir(afterPath string, from time.Time, to time.Time, content bool) (*types.DirDiffRes, error) {
+	log.Println("quics: diff dir (afterPath: ", afterPath, ", from: ", from, ", to: ", to, ", content: ", content, ")")
+
+	if from.After(to) {
+		err := errors.New("[ServerService.DiffDir] from is later than to")
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	histories, err := ss.serverRepository.GetAllHistories()
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	// find the latest history of each file at from and to
+	type historyAt struct {
+		history *types.FileHistory
+		date    time.Time
+	}
+	isLater := func(date time.Time, history *types.FileHistory, than *historyAt) bool {
+		return than == nil || date.After(than.date) || (date.Equal(than.date) && history.Timestamp > than.history.Timestamp)
+	}
+	fromStates := map[string]*historyAt{}
+	toStates := map[string]*historyAt{}
+	for i := range histories {
+		history := &histories[i]
+		if afterPath != "" && !utils.IsUnderPath(afterPath, history.AfterPath) {
+			continue
+		}
+
+		date, err := utils.ParseHistoryDate(history.Date)
+		if err != nil {
+			log.Println("quics alert: skip history with invalid date: ", history.AfterPath, history.Timestamp)
+			continue
+		}
+
+		if !date.After(from) && isLater(date, history, fromStates[history.AfterPath]) {
+			fromStates[history.AfterPath] = &historyAt{history: history, date: date}
+		}
+		if !date.After(to) && isLater(date, history, toStates[history.AfterPath]) {
+			toStates[history.AfterPath] = &historyAt{history: history, date: date}
+		}
+	}
+
+	diffRes := &types.DirDiffRes{
+		AfterPath: afterPath,
+		From:      from,
+		To:        to,
+		Entries:   []types.DiffEntry{},
+	}
+	for path, toState := range toStates {
+		fromState := fromStates[path]
+		existedFrom := fromState != nil && fromState.history.Hash != ""
+		existsTo := toState.history.Hash != ""
+
+		entry := types.DiffEntry{AfterPath: path}
+		if existedFrom {
+			entry.FromTimestamp = fromState.history.Timestamp
+			entry.FromHash = fromState.history.Hash
+		}
+		if existsTo {
+			entry.ToTimestamp = toState.history.Timestamp
+			entry.ToHash = toState.history.Hash
+		}
+
+		switch {
+		case !existedFrom && existsTo:
+			entry.Status = types.DiffAdded
+		case existedFrom && !existsTo:
+			entry.Status = types.DiffRemoved
+		case existedFrom && existsTo && fromState.history.Hash != toState.history.Hash:
+			// ciphertext differs whenever contents are encrypted again, so encrypted contents are not compared
+			entry.Encrypted = fromState.history.Encryption.IsEncrypted() || toState.history.Encryption.IsEncrypted()
+			if content && !entry.Encrypted && ss.isSameContents(fromState.history, toState.history) {
+				continue
+			}
+			entry.Status = types.DiffModified
+		default:
+			continue
+		}
+
+		diffRes.Entries = append(diffRes.Entries, entry)
+	}
+
+	sort.Slice(diffRes.Entries, func(i, j int) bool {
+		return diffRes.Entries[i].AfterPath < diffRes.Entries[j].AfterPath
+	})
+
+	return diffRes, nil
+}
+
+// GetFileLineage reconstructs where file of afterPath came from and where it went by moves recorded in histories (MovedFrom)
+// histories are re-keyed to the path file is moved to, so each move goes to the path which the next move of the same file
+// is from, or to the current path of the file for its last move
+func (ss *ServerService) GetFileLineage(afterPath string) (*types.FileLineageRes, error) {
+	histories, err := ss.serverRepository.GetAllHistories()
+	if err != nil {
+		err = errors.New("[ServerService.GetFileLineage] get all histories: " + err.Error())
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	movedHistories := map[string][]*types.FileHistory{}
+	for i := range histories {
+		if histories[i].MovedFrom != "" {
+			movedHistories[histories[i].AfterPath] = append(movedHistories[histories[i].AfterPath], &histories[i])
+		}
+	}
+	moves := []types.FileMove{}
+	for path, moved := range movedHistories {
+		sort.Slice(moved, func(i, j int) bool {
+			return moved[i].Timestamp < moved[j].Timestamp
+		})
+		for i, history := range moved {
+			to := path
+			if i+1 < len(moved) {
+				to = moved[i+1].MovedFrom
+			}
+			moves = append(moves, types.FileMove{
+				From:      history.MovedFrom,
+				To:        to,
+				Date:      history.Date,
+				Timestamp: history.Timestamp,
+				Hash:      history.Hash,
+			})
+		}
+	}
+
+	// follow moves toward afterPath (where it came from) and away from afterPath (where it went) transitively,
+	// so that other files which only passed through the same paths are not included
+	ancestors := map[string]bool{afterPath: true}
+	descendants := map[string]bool{afterPath: true}
+	for changed := true; changed; {
+		changed = false
+		for _, move := range moves {
+			if ancestors[move.To] && !ancestors[move.From] {
+				ancestors[move.From] = true
+				changed = true
+			}
+			if descendants[move.From] && !descendants[move.To] {
+				descendants[move.To] = true
+				changed = true
+			}
+		}
+	}
+
+	lineage := &types.FileLineageRes{
+		AfterPath: afterPath,
+		Moves:     []types.FileMove{},
+	}
+	for _, move := range moves {
+		if ancestors[move.To] || descendants[move.From] {
+			lineage.Moves = append(lineage.Moves, move)
+		}
+	}
+
+	sort.SliceStable(lineage.Moves, func(i, j int) bool {
+		a, errA := utils.ParseHistoryDate(lineage.Moves[i].Date)
+		b, errB := utils.ParseHistoryDate(lineage.Moves[j].Date)
+		if errA != nil || errB != nil || a.Equal(b) {
+			return lineage.Moves[i].From < lineage.Moves[j].From
+		}
+		return a.Before(b)
+	})
+
+	return lineage, nil
+}
+
+// isSameContents compares contents of two histories by merkle root (computed from history file when it is not recorded)
+func (ss *ServerService) isSameContents(a *types.FileHistory, b *types.FileHistory) bool {
+	contentHashOf := func(history *types.FileHistory) string {
+		if history.ContentHash != "" {
+			return history.ContentHash
+		}
+
+		contentHash, err := ss.syncDirAdapter.GetContentHashFromHistoryDir(history.AfterPath, history.Timestamp)
+		if err != nil {
+			log.Println("quics err: ", err)
+			return ""
+		}
+		return contentHash
+	}
+
+	contentHashA := contentHashOf(a)
+	return contentHashA != "" && contentHashA == contentHashOf(b)
+}
+
+// StartupCheck runs health checks of HEALTH_CHECKS before listeners are bound, and fails with every failed check
+// server becomes ready when they pass, and the checks are run again every HEALTH_CHECK_INTERVAL to report degraded state
+func (ss *ServerService) StartupCheck() error {
+	health := ss.runHealthChecks(types.HealthStarting)
+	if health.State != types.HealthReady {
+		err := errors.New("[ServerService.StartupCheck] " + failedHealthChecks(health))
+		log.Println("quics err: ", err)
+		return err
+	}
+	log.Println("quics: startup checks passed (", len(health.Checks), " checks)")
+
+	interval, err := strconv.ParseUint(config.GetViperEnvVariables("HEALTH_CHECK_INTERVAL"), 10, 64)
+	if err != nil {
+		log.Println("quics alert: ", "invalid HEALTH_CHECK_INTERVAL, use default interval: ", err)
+		interval, _ = strconv.ParseUint(config.DefaultHealthCheckInterval, 10, 64)
+	}
+	if interval > 0 {
+		go func() {
+			for {
+				time.Sleep(time.Duration(interval) * time.Second)
+				ss.runHealthChecks(types.HealthDegraded)
+			}
+		}()
+	}
+
+	return nil
+}
+
+// Health returns state of server and result of the last health checks
+func (ss *ServerService) Health() *types.HealthRes {
+	return ss.health.Load()
+}
+
+// runHealthChecks runs checks of HEALTH_CHECKS and saves the result, whose state is ready when every check passes and failedState otherwise
+func (ss *ServerService) runHealthChecks(failedState string) *types.HealthRes {
+	names, err := config.ParseHealthChecks(config.GetViperEnvVariables("HEALTH_CHECKS"))
+	if err != nil {
+		log.Println("quics alert: ", "invalid HEALTH_CHECKS, run every check: ", err)
+		names = types.HealthChecks
+	}
+
+	health := &types.HealthRes{
+		State:     types.HealthReady,
+		SafeMode:  ss.safeMode,
+		CheckedAt: time.Now(),
+		Checks:    []types.HealthCheck{},
+	}
+	for _, name := range names {
+		// bulk operation interrupted by crash is intentionally left unfinished in safe mode to be inspected
+		if ss.safeMode && name == types.HealthCheckRecovery {
+			continue
+		}
+		check := types.HealthCheck{Name: name, OK: true}
+		err := ss.checkHealth(name)
+		if err != nil {
+			check.OK = false
+			check.Error = err.Error()
+			health.State = failedState
+		}
+		health.Checks = append(health.Checks, check)
+	}
+
+	previous := ss.health.Swap(health)
+	if previous.State != health.State {
+		switch health.State {
+		case types.HealthDegraded:
+			log.Println("quics alert: ", "server is degraded: ", failedHealthChecks(health))
+		case types.HealthReady:
+			if previous.State == types.HealthDegraded {
+				log.Println("quics: server is ready again")
+			}
+		}
+	}
+
+	return health
+}
+
+func (ss *ServerService) checkHealth(name string) error {
+	switch name {
+	case types.HealthCheckDatabase:
+		return ss.repo.Ping()
+
+	case types.HealthCheckDataDir:
+		err := utils.CheckDirWritable(utils.GetQuicsDataDirPath())
+		if err != nil {
+			return err
+		}
+		// directory of synced contents is created by the first sync, so it is checked only when it exists
+		_, err = os.Stat(utils.GetQuicsSyncDirPath())
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return utils.CheckDirWritable(utils.GetQuicsSyncDirPath())
+
+	case types.HealthCheckTLS:
+		certFile := filepath.Join(utils.GetQuicsDirPath(), config.GetViperEnvVariables("QUICS_CERT_NAME"))
+		keyFile := filepath.Join(utils.GetQuicsDirPath(), config.GetViperEnvVariables("QUICS_KEY_NAME"))
+		certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return err
+		}
+		leaf, err := x509.ParseCertificate(certificate.Certificate[0])
+		if err != nil {
+			return err
+		}
+		// certificate generated by server has no validity period (zero times), which clients skip verifying
+		now := time.Now()
+		if leaf.NotAfter.Year() > 1 && now.After(leaf.NotAfter) {
+			return errors.New("certificate expired at " + leaf.NotAfter.Format(time.RFC3339) + ": " + certFile)
+		}
+		if leaf.NotBefore.Year() > 1 && now.Before(leaf.NotBefore) {
+			return errors.New("certificate is not valid until " + leaf.NotBefore.Format(time.RFC3339) + ": " + certFile)
+		}
+		return nil
+
+	case types.HealthCheckProtocol:
+		if reason := ss.protocolDown.Load(); reason != nil {
+			return errors.New(*reason)
+		}
+		return nil
+
+	case types.HealthCheckRecovery:
+		operations, err := ss.serverRepository.GetBulkOperations()
+		if err != nil {
+			return err
+		}
+		if len(operations) > 0 {
+			operation := operations[0]
+			return fmt.Errorf("bulk operation interrupted by crash is not finished (kind: %s, afterPath: %s, unfinished operations: %d)", operation.Kind, operation.AfterPath, len(operations))
+		}
+		return nil
+	}
+
+	return errors.New("unknown health check: " + name)
+}
+
+// failedHealthChecks formats failed checks of health (e.g., tls: certificate expired at ...; data-dir: permission denied)
+func failedHealthChecks(health *types.HealthRes) string {
+	failed := []string{}
+	for _, check := range health.Checks {
+		if !check.OK {
+			failed = append(failed, check.Name+": "+check.Error)
+		}
+	}
+	if len(failed) == 0 {
+		return "no check failed"
+	}
+	return strings.Join(failed, "; ")
+}
+
+// GetMetrics returns stream usage of each quics-protocol connection and delivery of events
+func (ss *ServerService) GetMetrics() *types.MetricsRes {
+	return &types.MetricsRes{
+		StartedAt:         ss.startedAt,
+		Uptime:            time.Since(ss.startedAt),
+		MaxStreamsPerConn: ss.Proto.Streams.Max(),
+		Connections:       ss.Proto.Streams.Stats(),
+		Handshakes:        ss.Proto.Handshakes.Stats(),
+		Events:            ss.eventService.Stats(),
+		Disk:              ss.syncService.DiskStats(),
+		TransfersInFlight: ss.syncService.TransfersInFlight(),
+		DB:                *ss.repo.DBSize(),
+		Logs:              recentLogStats(),
+	}
+}
+
+// ProtocolIdleSince returns when clients last used quics protocol, and false while any client is connected
+func (ss *ServerService) ProtocolIdleSince() (time.Time, bool) {
+	return ss.Proto.Streams.IdleSince()
+}
+
+// recentLogStats counts errors and alerts among recent server logs
+func recentLogStats() types.LogStats {
+	lines := logs.Recent(logs.LevelInfo)
+	logStats := types.LogStats{Lines: len(lines)}
+	for _, line := range lines {
+		switch line.Level {
+		case logs.LevelError:
+			logStats.Errors++
+			logStats.LastError = line.Text
+		case logs.LevelWarn:
+			logStats.Alerts++
+		}
+	}
+
+	return logStats
+}
+
+// LockFile acquires advisory lock of the file for the client during ttl
+func (ss *ServerService) LockFile(afterPath string, uuid string, ttl time.Duration) (*types.FileLock, error) {
+	log.Println("quics: lock file (afterPath: ", afterPath, ", uuid: ", uuid, ", ttl: ", ttl, ")")
+
+	lock, err := ss.syncService.LockFile(afterPath, uuid, ttl)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	return lock, nil
+}
+
+// UnlockFile releases advisory lock of the file held by the client
+func (ss *ServerService) UnlockFile(afterPath string, uuid string) error {
+	log.Println("quics: unlock file (afterPath: ", afterPath, ", uuid: ", uuid, ")")
+
+	err := ss.syncService.UnlockFile(afterPath, uuid)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return err
+	}
+
+	return nil
+}
+
+// ShowLocks returns active locks of files under afterPath (every lock when it is empty)
+func (ss *ServerService) ShowLocks(afterPath string) ([]types.LockInfo, error) {
+	log.Println("quics: show locks (afterPath: ", afterPath, ")")
+
+	locks, err := ss.syncService.ListLocks(afterPath)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	return locks, nil
+}
+
+// BreakLock releases lock of file held by any client, and leaves alert of who held it and why it was broken in server log
+func (ss *ServerService) BreakLock(afterPath string, reason string) (*types.BreakLockRes, error) {
+	log.Println("quics: break lock (afterPath: ", afterPath, ", reason: ", reason, ")")
+
+	breakLockRes, err := ss.syncService.BreakLock(afterPath, reason)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+	log.Println("quics alert: ", fmt.Sprintf("lock of %s held by %s (acquired at %s, expires at %s) is broken by admin: %s",
+		breakLockRes.Lock.AfterPath, breakLockRes.Lock.Holder, breakLockRes.Lock.AcquiredAt.Format(time.RFC3339), breakLockRes.Lock.ExpiresAt.Format(time.RFC3339), reason))
+
+	return breakLockRes, nil
+}
+
+// TagFile sets tags of set and removes tags of unset keys of file of afterPath
+func (ss *ServerService) TagFile(afterPath string, set map[string]string, unset []string) (*types.File, error) {
+	log.Println("quics: tag file (afterPath: ", afterPath, ", set: ", set, ", unset: ", unset, ")")
+
+	file, err := ss.syncService.TagFile(afterPath, set, unset)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// TagFiles sets and removes tags of every file matched by filter in batches, and reports how many files are changed
+// filter is required not to tag every file by mistake; nothing is written when dryRun is set
+func (ss *ServerService) TagFiles(filter *types.LogFilter, set map[string]string, unset []string, dryRun bool) (*types.BulkUpdateRes, error) {
+	log.Println("quics: tag files (filter: ", filter, ", set: ", set, ", unset: ", unset, ", dryRun: ", dryRun, ")")
+
+	if filter.IsEmpty() {
+		err := errors.New("[ServerService.TagFiles] filter is required to tag files in bulk (e.g., prefix)")
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+	for key, value := range set {
+		err := utils.ValidateTag(key, value)
+		if err != nil {
+			err = errors.New("[ServerService.TagFiles] " + err.Error())
+			log.Println("quics err: ", err)
+			return nil, err
+		}
+	}
+
+	match, err := ss.fileMatcher(filter)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	bulkRes, err := ss.serverRepository.UpdateFiles(scanPrefixOf(filter), match, func(file *types.File) (bool, error) {
+		tags, changed, err := utils.ApplyTags(file.Tags, set, unset)
+		if err != nil {
+			return false, err
+		}
+		file.Tags = tags
+		return changed, nil
+	}, dryRun)
+	if err != nil {
+		err = errors.New("[ServerService.TagFiles] update files: " + err.Error())
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+	log.Println("quics: tagged files (matched: ", bulkRes.Matched, ", updated: ", bulkRes.Updated, ", failed: ", bulkRes.Failed, ", dryRun: ", dryRun, ")")
+
+	return bulkRes, nil
+}
+
+func (ss *ServerService) SetFileNoHistory(afterPath string, noHistory bool) (*types.File, error) {
+	log.Println("quics: set file no history (afterPath: ", afterPath, ", noHistory: ", noHistory, ")")
+
+	file, err := ss.syncService.SetFileNoHistory(afterPath, noHistory)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// GetFileMetadata returns custom metadata of file of afterPath (nil when it has none)
+func (ss *ServerService) GetFileMetadata(afterPath string) (json.RawMessage, error) {
+	file, err := ss.serverRepository.GetFileByAfterPath(afterPath)
+	if err != nil {
+		err = errors.New("[ServerService.GetFileMetadata] get file by afterPath: " + err.Error())
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	return file.CustomMetadata, nil
+}
+
+// SetFileMetadata replaces custom metadata of file of afterPath (nil clears it)
+func (ss *ServerService) SetFileMetadata(afterPath string, metadata json.RawMessage) (*types.File, error) {
+	log.Println("quics: set file metadata (afterPath: ", afterPath, ", size: ", len(metadata), ")")
+
+	file, err := ss.syncService.SetFileMetadata(afterPath, metadata)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// Scrub verifies stored contents of all files on demand
+func (ss *ServerService) Scrub() (*types.ScrubRes, error) {
+	log.Println("quics: scrub")
+
+	scrubRes, err := ss.syncService.Scrub()
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	return scrubRes, nil
+}
+
+// Reindex rebuilds derived index (sync.ReindexAll: every index) from primary records while server is running
+func (ss *ServerService) Reindex(index string) ([]types.ReindexRes, error) {
+	log.Println("quics: reindex (index: ", index, ")")
+
+	reindexResList, err := ss.syncService.Reindex(index)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	return reindexResList, nil
+}
+
+// BeginTransfer counts download through rest api as transfer in flight until returned function is called
+func (ss *ServerService) BeginTransfer() func() {
+	return ss.syncService.BeginTransfer()
+}
+
+// RecordDownload records contents of afterPath downloaded through rest api started at startedAt
+// (nothing is recorded in safe mode)
+func (ss *ServerService) RecordDownload(afterPath string, size int64, startedAt time.Time) {
+	if ss.safeMode {
+		return
+	}
+	ss.syncService.RecordTransfer(types.TransferDownload, "", afterPath, size, startedAt)
+}
+
+// WaitSynced waits up to timeout until write of consistency token is fully visible (read-your-writes)
+func (ss *ServerService) WaitSynced(ctx context.Context, token string, timeout time.Duration) error {
+	afterPath, timestamp, err := utils.ParseSyncToken(token)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	return ss.syncService.WaitSynced(ctx, afterPath, timestamp)
+}
+
+// TransferStats aggregates transfers completed in [since, until) into windows of bucket (the last window can be shorter)
+func (ss *ServerService) TransferStats(since time.Time, until time.Time, bucket time.Duration) (*types.TransferStatsRes, error) {
+	log.Println("quics: transfer stats (since: ", since, ", until: ", until, ", bucket: ", bucket, ")")
+
+	if !since.Before(until) {
+		err := errors.New("[ServerService.TransferStats] since must be earlier than until")
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+	if bucket <= 0 || until.Sub(since)/bucket >= MaxTransferBuckets {
+		err := fmt.Errorf("[ServerService.TransferStats] bucket must be positive and make less than %d windows", MaxTransferBuckets)
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	transfers, err := ss.serverRepository.GetTransfers(since, until)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	windows := [][]types.Transfer{}
+	for start := since; start.Before(until); start = start.Add(bucket) {
+		windows = append(windows, []types.Transfer{})
+	}
+	for _, transfer := range transfers {
+		i := int(transfer.Date.Sub(since) / bucket)
+		windows[i] = append(windows[i], transfer)
+	}
+
+	statsRes := &types.TransferStatsRes{
+		Since:   since,
+		Until:   until,
+		Bucket:  bucket,
+		Buckets: []types.TransferBucket{},
+		Total:   aggregateTransfers(since, until, transfers),
+	}
+	for i, window := range windows {
+		start := since.Add(time.Duration(i) * bucket)
+		end := start.Add(bucket)
+		if end.After(until) {
+			end = until
+		}
+		statsRes.Buckets = append(statsRes.Buckets, aggregateTransfers(start, end, window))
+	}
+
+	return statsRes, nil
+}
+
+// aggregateTransfers sums up transfers of window [start, end); sizes are percentiles by nearest rank
+func aggregateTransfers(start time.Time, end time.Time, transfers []types.Transfer) types.TransferBucket {
+	bucket := types.TransferBucket{Start: start}
+	if len(transfers) == 0 {
+		return bucket
+	}
+
+	sizes := []int64{}
+	for _, transfer := range transfers {
+		bucket.Count++
+		bucket.Bytes += transfer.Size
+		if transfer.Direction == types.TransferUpload {
+			bucket.Uploads++
+		} else {
+			bucket.Downloads++
+		}
+		sizes = append(sizes, transfer.Size)
+	}
+	slices.Sort(sizes)
+
+	percentile := func(p int) int64 {
+		rank := (p*len(sizes) + 99) / 100
+		return sizes[rank-1]
+	}
+	bucket.Throughput = float64(bucket.Bytes) / end.Sub(start).Seconds()
+	bucket.AvgSize = bucket.Bytes / int64(bucket.Count)
+	bucket.P50Size = percentile(50)
+	bucket.P95Size = percentile(95)
+
+	return bucket
+}
+
+// backgroundPruneTransfers deletes transfer records older than TransferRetention periodically
+func (ss *ServerService) backgroundPruneTransfers() {
+	go func() {
+		for {
+			deleted, err := ss.serverRepository.DeleteTransfersBefore(time.Now().Add(-TransferRetention))
+			if err != nil {
+				err = errors.New("[ServerService.backgroundPruneTransfers] delete transfers: " + err.Error())
+				log.Println("quics err: ", err, "; continue to next")
+			} else if deleted > 0 {
+				log.Println("quics: pruned ", deleted, " transfer records")
+			}
+			time.Sleep(TransferPruneInterval)
+		}
+	}()
+}
+
+// Checkpoint flushes database to disk, so that operator can take snapshot (or power down) without losing committed writes
+func (ss *ServerService) Checkpoint() (*types.CheckpointRes, error) {
+	log.Println("quics: checkpoint")
+
+	checkpointRes, err := ss.repo.Checkpoint()
+	if err != nil {
+		err = errors.New("[ServerService.Checkpoint] sync database: " + err.Error())
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	log.Println("quics: checkpoint done (synced files: ", checkpointRes.SyncedFiles, ", duration: ", checkpointRes.Duration, ")")
+	return checkpointRes, nil
+}
+
+// DBStats reports internals of database (LSM tree and value log), so that operator can decide whether to run CompactDB
+func (ss *ServerService) DBStats() (*types.DBStatsRes, error) {
+	log.Println("quics: db stats")
+
+	dbStatsRes, err := ss.repo.DBStats()
+	if err != nil {
+		err = errors.New("[ServerService.DBStats] get stats of database: " + err.Error())
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	return dbStatsRes, nil
+}
+
+// CompactDB compacts levels of LSM tree of database, and collects garbage of value log as well when valueLogGC is true
+func (ss *ServerService) CompactDB(valueLogGC bool) (*types.DBCompactRes, error) {
+	log.Println("quics: compact db (valueLogGC: ", valueLogGC, ")")
+
+	compactRes, err := ss.repo.CompactDB(valueLogGC)
+	if err != nil {
+		err = errors.New("[ServerService.CompactDB] compact database: " + err.Error())
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	log.Println("quics: compact db done (lsm: ", compactRes.LSMSizeBefore, " -> ", compactRes.LSMSizeAfter, ", value log: ", compactRes.ValueLogSizeBefore, " -> ", compactRes.ValueLogSizeAfter, ", duration: ", compactRes.Duration, ")")
+	return compactRes, nil
 }
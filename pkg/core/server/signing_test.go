@@ -0,0 +1,64 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/quic-s/quics/pkg/repository/badger"
+	"github.com/quic-s/quics/pkg/utils"
+)
+
+func TestGetSigningKeyInSafeMode(t *testing.T) {
+	tests := []struct {
+		name     string
+		safeMode bool
+		stored   []byte // signing key saved before (nil: never generated)
+		wantErr  error
+		wantKey  bool // key is stored after the call
+	}{
+		{name: "generated on first use", wantKey: true},
+		{name: "stored key", stored: []byte("stored"), wantKey: true},
+		{name: "safe mode without key", safeMode: true, wantErr: ErrInvalidSignature},
+		{name: "safe mode with stored key", safeMode: true, stored: []byte("stored"), wantKey: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			utils.SetQuicsDataDirPath(t.TempDir())
+			defer utils.SetQuicsDataDirPath("")
+
+			repo, err := badger.NewBadgerRepository(false, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer repo.Close()
+			ss := &ServerService{repo: repo, serverRepository: repo.NewServerRepository(), safeMode: tt.safeMode}
+			if tt.stored != nil {
+				if err := ss.serverRepository.SetSigningKey(tt.stored); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			key, err := ss.getSigningKey()
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("getSigningKey() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.stored != nil && !bytes.Equal(key, tt.stored) {
+				t.Errorf("getSigningKey() = %q, want stored key %q", key, tt.stored)
+			}
+
+			// nothing is written in safe mode
+			stored, err := ss.serverRepository.GetSigningKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (stored != nil) != tt.wantKey {
+				t.Errorf("stored key = %q, want stored: %t", stored, tt.wantKey)
+			}
+			if stored != nil && !bytes.Equal(stored, key) {
+				t.Errorf("stored key = %q, want returned key %q", stored, key)
+			}
+		})
+	}
+}
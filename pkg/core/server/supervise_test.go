@@ -0,0 +1,174 @@
+package server
+
+import (
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/quic-s/quics/pkg/types"
+	"github.com/spf13/viper"
+)
+
+var (
+	errBind   = errors.New("address already in use")
+	errSocket = errors.New("udp socket closed")
+)
+
+// listenerLife is how long a run of listener lasts before it dies with err
+type listenerLife struct {
+	lasts time.Duration
+	err   error
+}
+
+// scriptedListener dies as its lives are scripted, and listens until stopped once they are over
+type scriptedListener struct {
+	lives  []listenerLife
+	starts atomic.Int32
+	stop   chan struct{}
+}
+
+func (l *scriptedListener) start() error {
+	n := int(l.starts.Add(1))
+	if n > len(l.lives) {
+		<-l.stop
+		return nil
+	}
+	life := l.lives[n-1]
+	time.Sleep(life.lasts)
+	return life.err
+}
+
+func TestSuperviseProtocol(t *testing.T) {
+	viper.Set("HEALTH_CHECKS", types.HealthCheckProtocol)
+	defer viper.Set("HEALTH_CHECKS", "")
+
+	const startupWait = 20 * time.Millisecond
+	const survived = 3 * startupWait // listener dies after it has started listening
+
+	tests := []struct {
+		name         string
+		lives        []listenerLife
+		maxRestarts  uint64
+		wantStartErr error
+		wantReturn   bool   // supervisor gives up by itself (otherwise listener is listening until server stops it)
+		wantStarts   int    // times listener is started
+		wantDown     string // reason of failing protocol check ("": listening)
+	}{
+		{
+			name:         "fails on startup",
+			lives:        []listenerLife{{lasts: 0, err: errBind}},
+			maxRestarts:  5,
+			wantStartErr: errBind,
+			wantReturn:   true,
+			wantStarts:   1,
+		},
+		{
+			name:        "stopped by server",
+			maxRestarts: 5,
+			wantStarts:  1,
+		},
+		{
+			name:        "restarted after death",
+			lives:       []listenerLife{{lasts: survived, err: errSocket}},
+			maxRestarts: 5,
+			wantStarts:  2,
+		},
+		{
+			name:        "listener stopped without error",
+			lives:       []listenerLife{{lasts: survived, err: nil}},
+			maxRestarts: 5,
+			wantStarts:  2,
+		},
+		{
+			name:        "restarts failing on startup",
+			lives:       []listenerLife{{lasts: survived, err: errSocket}, {lasts: 0, err: errBind}, {lasts: 0, err: errBind}},
+			maxRestarts: 3,
+			wantStarts:  4,
+		},
+		{
+			name:        "restarts exhausted",
+			lives:       []listenerLife{{lasts: survived, err: errSocket}, {lasts: 0, err: errBind}, {lasts: 0, err: errBind}},
+			maxRestarts: 2,
+			wantReturn:  true,
+			wantStarts:  3,
+			wantDown:    "not restarted anymore (2 restarts in a row): address already in use",
+		},
+		{
+			name:        "never restarted",
+			lives:       []listenerLife{{lasts: survived, err: errSocket}},
+			maxRestarts: 0,
+			wantReturn:  true,
+			wantStarts:  1,
+			wantDown:    "not restarted anymore (0 restarts in a row): udp socket closed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ss := &ServerService{}
+			ss.health.Store(&types.HealthRes{State: types.HealthReady, Checks: []types.HealthCheck{}})
+			listener := &scriptedListener{lives: tt.lives, stop: make(chan struct{})}
+			supervision := protocolSupervision{
+				start:          listener.start,
+				startupWait:    startupWait,
+				stableDuration: time.Hour,
+				backoff:        time.Millisecond,
+				maxBackoff:     2 * time.Millisecond,
+				maxRestarts:    tt.maxRestarts,
+			}
+
+			errChan := make(chan error, 1)
+			done := make(chan struct{})
+			go func() {
+				ss.superviseProtocol(supervision, errChan)
+				close(done)
+			}()
+
+			if err := <-errChan; !errors.Is(err, tt.wantStartErr) {
+				t.Fatalf("start error = %v, want %v", err, tt.wantStartErr)
+			}
+
+			if !tt.wantReturn {
+				// wait until the last start is listening, then stop it as StopServer does
+				deadline := time.Now().Add(5 * time.Second)
+				for int(listener.starts.Load()) < tt.wantStarts || ss.protocolDown.Load() != nil {
+					if time.Now().After(deadline) {
+						t.Fatalf("listener is not listening again (starts: %d, want %d)", listener.starts.Load(), tt.wantStarts)
+					}
+					time.Sleep(time.Millisecond)
+				}
+				if health := ss.Health(); health.State != types.HealthReady {
+					t.Errorf("health = %s, want %s", health.State, types.HealthReady)
+				}
+				ss.protocolStopping.Store(true)
+				close(listener.stop)
+			}
+
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("supervisor does not return")
+			}
+			if starts := int(listener.starts.Load()); starts != tt.wantStarts {
+				t.Errorf("starts = %d, want %d", starts, tt.wantStarts)
+			}
+
+			reason := ss.protocolDown.Load()
+			if tt.wantDown == "" {
+				if reason != nil {
+					t.Errorf("protocol is down: %s", *reason)
+				}
+				return
+			}
+			if reason == nil || !strings.Contains(*reason, tt.wantDown) {
+				t.Fatalf("reason of protocol down = %v, want %q", reason, tt.wantDown)
+			}
+			health := ss.Health()
+			if health.State != types.HealthDegraded || len(health.Checks) != 1 || health.Checks[0].OK {
+				t.Errorf("health = %+v, want %s with failed protocol check", health, types.HealthDegraded)
+			}
+		})
+	}
+}
@@ -1,9 +1,13 @@
 package sync
 
 import (
+	"context"
+	"encoding/json"
 	"io"
+	"time"
 
 	"github.com/quic-s/quics/pkg/types"
+	"github.com/quic-s/quics/pkg/utils"
 )
 
 type Repository interface {
@@ -16,12 +20,24 @@ type Repository interface {
 	GetFileByPath(afterPath string) (*types.File, error)
 	UpdateFile(file *types.File) error
 	GetAllFiles(prefix string) ([]types.File, error)
+	MoveFile(removed *types.File, removedHistory *types.FileHistory, file *types.File, movedHistory *types.FileHistory, overwrite bool) error
 
 	UpdateConflict(afterpath string, conflict *types.Conflict) error
 	GetConflict(afterpath string) (*types.Conflict, error)
 	GetConflictList(rootDirs []string) ([]types.Conflict, error)
 	DeleteConflict(afterpath string) error
 
+	AddPendingChange(uuid string, afterPath string, maxLen int) error
+	PopPendingChanges(uuid string) (*types.PendingChanges, error)
+	RequeuePendingChanges(popped *types.PendingChanges, maxLen int) error
+
+	SaveTransfer(transfer *types.Transfer) error
+
+	SaveCommitSet(commitSet *types.CommitSet) error
+	GetCommitSet(id string) (*types.CommitSet, error)
+	DeleteCommitSet(id string) error
+	CommitFiles(commitSet *types.CommitSet, files []*types.File, fileHistories []*types.FileHistory) error
+
 	ErrKeyNotFound() error
 }
 
@@ -38,18 +54,58 @@ type Service interface {
 
 	GetConflictList(*types.AskConflictListReq) (*types.AskConflictListRes, error)
 	ChooseOne(request *types.PleaseFileReq) (*types.PleaseFileRes, error)
+	ListConflicts(afterPath string) ([]types.Conflict, error)
+	ResolveConflict(afterPath string, side string) (*types.File, error)
 	CallForceSync(filePath string, UUIDs []string) error
+	DeliverPendingChanges(uuid string) error
 
 	FullScan(uuid string) error
+	SyncNow(uuid string) (*types.SyncNowRes, error)
 	BackgroundFullScan(interval uint64) error
 	Rescan(*types.RescanReq) (*types.RescanRes, error)
 
+	RecordTransfer(direction string, uuid string, afterPath string, size int64, startedAt time.Time)
+	BeginTransfer() func()
+	TransfersInFlight() int64
+
+	Scrub() (*types.ScrubRes, error)
+	Reindex(index string) ([]types.ReindexRes, error)
+	BackgroundScrub(interval uint64) error
+	BackgroundDiskCheck(interval uint64) error
+	DiskStats() types.DiskStats
+	LastHistoryDate() time.Time
+	RestoreLastHistoryDate(date time.Time)
+
 	GetFilesByRootDir(rootDirPath string) []types.File
 	GetFiles() []types.File
 	GetFileByPath(afterPath string) (*types.File, error)
+	GetFileHistory(afterPath string, timestamp uint64) (*types.FileHistory, error)
+	WaitSynced(ctx context.Context, afterPath string, timestamp uint64) error
 
 	RollbackFileByHistory(request *types.RollBackReq) (*types.RollBackRes, error)
 
+	UploadFile(afterPath string, fileMetadata *types.FileMetadata, fileContent io.Reader, expectedHash string) (*types.File, error)
+	ResolvePolicy(afterPath string) (*types.EffectivePolicy, error)
+	DeleteFileContents(afterPath string) error
+	MoveFile(fromAfterPath string, toAfterPath string, overwrite bool) (*types.File, error)
+	OpenHistoryContents(afterPath string, timestamp uint64) (*types.FileMetadata, io.Reader, error)
+	GetFileDigest(afterPath string, timestamp uint64, chunks bool) (*types.FileDigestRes, error)
+	ResolveVersion(afterPath string, selector *types.VersionSelector) (*types.VersionRes, error)
+
+	OpenCommitSet(name string) (*types.CommitSet, error)
+	StageCommitFile(id string, afterPath string, fileMetadata *types.FileMetadata, fileContent io.Reader) (*types.CommitSet, error)
+	CommitSet(id string) (*types.CommitSet, error)
+	AbortCommitSet(id string) error
+	GetCommitSet(id string) (*types.CommitSet, error)
+
+	LockFile(afterPath string, uuid string, ttl time.Duration) (*types.FileLock, error)
+	UnlockFile(afterPath string, uuid string) error
+	ListLocks(afterPath string) ([]types.LockInfo, error)
+	BreakLock(afterPath string, reason string) (*types.BreakLockRes, error)
+	TagFile(afterPath string, set map[string]string, unset []string) (*types.File, error)
+	SetFileNoHistory(afterPath string, noHistory bool) (*types.File, error)
+	SetFileMetadata(afterPath string, metadata json.RawMessage) (*types.File, error)
+
 	DownloadHistory(request *types.DownloadHistoryReq) (*types.DownloadHistoryRes, string, error)
 
 	GetStagingNum(request *types.AskStagingNumReq) (*types.AskStagingNumRes, error)
@@ -67,10 +123,19 @@ type SyncDirAdapter interface {
 	SaveFileToHistoryDir(afterPath string, timestamp uint64, fileMetadata *types.FileMetadata, fileContent io.Reader) error
 	GetFileFromHistoryDir(afterPath string, timestamp uint64) (*types.FileMetadata, io.Reader, error)
 	GetFileInfoFromHistoryDir(afterPath string, timestamp uint64) (*types.FileMetadata, error)
+	GetContentHashFromHistoryDir(afterPath string, timestamp uint64) (string, error)
+	GetContentLeavesFromHistoryDir(afterPath string, timestamp uint64) ([][]byte, error)
+	ExtendContentLeavesFromHistoryDir(afterPath string, timestamp uint64, baseLeaves [][]byte, baseSize int64) ([][]byte, error)
+	DeleteFileFromHistoryDir(afterPath string, timestamp uint64) error
+	MoveFile(fromAfterPath string, toAfterPath string, timestamps []uint64) error
+	SaveFileToCommitDir(id string, index int, fileMetadata *types.FileMetadata, fileContent io.Reader) error
+	GetFileFromCommitDir(id string, index int) (*types.FileMetadata, io.Reader, error)
+	DeleteCommitDir(id string) error
 }
 
 type NetworkAdapter interface {
 	OpenTransaction(transactionName string, uuid string) (Transaction, error)
+	IsConnected(uuid string) bool
 }
 
 type Transaction interface {
@@ -78,7 +143,9 @@ type Transaction interface {
 	RequestGiveYou(giveYouReq *types.GiveYouReq, historyFilePath string) (*types.GiveYouRes, error)
 	RequestForceSync(mustSyncReq *types.MustSyncReq, historyFilePath string) (*types.MustSyncRes, error)
 	RequestAskAllMeta(askAllMetaReq *types.AskAllMetaReq) (*types.AskAllMetaRes, error)
+	RequestAskManifest(askManifestReq *types.AskManifestReq) (*types.AskManifestRes, error)
 	RequestNeedSync(needSyncReq *types.NeedSyncReq) (*types.NeedSyncRes, error)
 	RequestNeedContent(needContentReq *types.NeedContentReq) (*types.NeedContentRes, *types.FileMetadata, io.Reader, error)
+	Throttle(throttle *utils.Throttle)
 	Close() error
 }
@@ -2,15 +2,25 @@ package sync
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"os"
+	"path/filepath"
 	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/quic-s/quics/pkg/core/event"
 	"github.com/quic-s/quics/pkg/core/history"
 	"github.com/quic-s/quics/pkg/core/registration"
 	"github.com/quic-s/quics/pkg/types"
@@ -18,27 +28,128 @@ import (
 	"golang.org/x/exp/slices"
 )
 
+// MaxPendingChanges is the number of changed paths queued for offline client before collapsing to full resync
+const MaxPendingChanges = 1000
+
+// ManifestScanThreshold is the number of files of client from which fullscan reconciles merkle manifest instead of full listing
+const ManifestScanThreshold = 1000
+
+// ErrContentMissing is returned when file data records a version whose stored contents are missing or do not match the record
+// (e.g., contents are deleted out of band)
+var ErrContentMissing = errors.New("CONTENT_MISSING")
+
+// ErrAppendBaseMismatch is returned when contents are sent as appended bytes but their base version can not be used
+// (e.g., it is removed by versioning policy), so client must send whole contents
+var ErrAppendBaseMismatch = errors.New("APPEND_BASE_MISMATCH")
+
+// ErrClientEncrypted is returned by server-side features which need plaintext (e.g., conversion, content diff)
+// for contents encrypted by client, because server never has the key
+var ErrClientEncrypted = errors.New("CLIENT_ENCRYPTED")
+
+// ErrFileExists is returned when file is moved onto existing file without overwrite
+var ErrFileExists = errors.New("FILE_EXISTS")
+
+// ErrUnknownIndex is returned when reindex is requested for an index which does not exist
+var ErrUnknownIndex = errors.New("UNKNOWN_INDEX")
+
+// ErrNotSynced is returned when write of consistency token is not fully visible before timeout
+// (e.g., contents of the version have not been received from client yet)
+var ErrNotSynced = errors.New("NOT_SYNCED")
+
+// ErrVersionNotFound is returned when file has no version of requested timestamp
+// its message lists the nearest versions which exist, so that the request can be retried with one of them
+var ErrVersionNotFound = errors.New("VERSION_NOT_FOUND")
+
+// ErrDiskFull is returned when write is aborted because volume of data directory has no space left
+// contents being written are removed, so that nothing partially written is left in the store
+var ErrDiskFull = errors.New("DISK_FULL")
+
+// ErrReadOnly is returned for writes while server is read-only after disk became full (DISK_FULL_READ_ONLY)
+var ErrReadOnly = errors.New("READ_ONLY")
+
+// ErrClientNotFound is returned when sync is requested for client which is not registered
+var ErrClientNotFound = errors.New("CLIENT_NOT_FOUND")
+
+// ErrClientNotConnected is returned when sync is requested for client which is not connected to server now
+var ErrClientNotConnected = errors.New("CLIENT_NOT_CONNECTED")
+
+// NearestVersionCount is the number of existing versions listed by ErrVersionNotFound
+const NearestVersionCount = 3
+
+// SyncWaitInterval is the interval of checking whether write of consistency token is visible
+const SyncWaitInterval = 50 * time.Millisecond
+
+// ReindexAll rebuilds every derived index, and ReindexHash rebuilds content hashes (merkle roots) of files and histories from stored contents
+const (
+	ReindexAll  = "all"
+	ReindexHash = "hash"
+)
+
+// ReindexIndexes are derived indexes which can be rebuilt by Reindex (in the order ReindexAll rebuilds them)
+var ReindexIndexes = []string{ReindexHash}
+
+// ReindexProgressInterval is the number of scanned records between progress logs of reindex
+const ReindexProgressInterval = 1000
+
+// HashMismatchError is returned by conditional upload when latest hash of file is not the expected one
+// (e.g., other client has synced the file since the caller read it)
+type HashMismatchError struct {
+	AfterPath   string
+	CurrentHash string // empty if the file does not exist
+}
+
+func (e *HashMismatchError) Error() string {
+	return "latest hash of file does not match: " + e.AfterPath + " (current: " + e.CurrentHash + ")"
+}
+
 type SyncService struct {
 	cancelMut              sync.RWMutex
 	cancel                 map[string]context.CancelFunc
+	uploadMut              sync.Mutex // serializes uploads, syncs of clients and changes of commit sets
 	FSTrigger              chan string
 	registrationRepository registration.Repository
 	historyRepository      history.Repository
 	syncRepository         Repository
 	networkAdapter         NetworkAdapter
 	syncDirAdapter         SyncDirAdapter
+	eventService           event.Service
+	extensionPolicies      []types.SyncPolicy // server-wide defaults which root directory can override
+	timestampSource        string             // types.TimestampSourceServer or types.TimestampSourceClient
+	uploadMemoryBuffer     int64              // bytes of upload kept in memory before the rest spills to temp file
+	dateMut                sync.Mutex
+	lastDate               time.Time // latest date stamped by server clock
+	diskLowSpace           uint64    // free bytes below which low space is alerted (0: never)
+	diskFullReadOnly       bool      // writes are rejected after disk became full until free space is above diskLowSpace
+	maxPathLength          int       // bytes of afterPath of new file (0: unlimited)
+	maxPathDepth           int       // components of afterPath of new file (0: unlimited)
+	diskMut                sync.Mutex
+	readOnly               bool
+	lowSpace               bool      // low space has been alerted, so it is not alerted again until space is freed
+	lastDiskFull           time.Time // when write was last aborted for disk full
+	transfersInFlight      atomic.Int64
+	throttleMut            sync.Mutex
+	throttles              map[string]*utils.Throttle // by UUID of client, shared by every transfer with the client
 }
 
-func NewService(registrationRepository registration.Repository, historyRepository history.Repository, syncRepository Repository, networkAdapter NetworkAdapter, syncDirAdpater SyncDirAdapter) Service {
+func NewService(registrationRepository registration.Repository, historyRepository history.Repository, syncRepository Repository, networkAdapter NetworkAdapter, syncDirAdpater SyncDirAdapter, eventService event.Service, extensionPolicies []types.SyncPolicy, timestampSource string, uploadMemoryBuffer int64, diskLowSpace uint64, diskFullReadOnly bool, maxPathLength int, maxPathDepth int) Service {
 	return &SyncService{
 		cancelMut:              sync.RWMutex{},
 		cancel:                 map[string]context.CancelFunc{},
+		throttles:              map[string]*utils.Throttle{},
 		FSTrigger:              make(chan string),
 		registrationRepository: registrationRepository,
 		historyRepository:      historyRepository,
 		syncRepository:         syncRepository,
 		networkAdapter:         networkAdapter,
 		syncDirAdapter:         syncDirAdpater,
+		eventService:           eventService,
+		extensionPolicies:      extensionPolicies,
+		timestampSource:        timestampSource,
+		uploadMemoryBuffer:     uploadMemoryBuffer,
+		diskLowSpace:           diskLowSpace,
+		diskFullReadOnly:       diskFullReadOnly,
+		maxPathLength:          maxPathLength,
+		maxPathDepth:           maxPathDepth,
 	}
 }
 
@@ -225,8 +336,27 @@ func (ss *SyncService) DisconnectRootDir(request *types.DisconnectRootDirReq) (*
 
 // UpdateFileWithoutContents updates file (ContentExisted = false)
 func (ss *SyncService) UpdateFileWithoutContents(pleaseSyncReq *types.PleaseSyncReq) (*types.PleaseSyncRes, error) {
+	err := ss.checkWritable()
+	if err != nil {
+		return nil, err
+	}
+	err = ss.checkPathLimits(pleaseSyncReq.AfterPath)
+	if err != nil {
+		return nil, err
+	}
+
+	pleaseSyncRes, err := ss.updateFileWithoutContents(pleaseSyncReq)
+	return pleaseSyncRes, ss.checkDiskFull(pleaseSyncReq.AfterPath, err)
+}
+
+func (ss *SyncService) updateFileWithoutContents(pleaseSyncReq *types.PleaseSyncReq) (*types.PleaseSyncRes, error) {
 	log.Println("quics: UpdateFileWithoutContents: ", pleaseSyncReq)
 
+	// new version is committed under the same lock as uploads, so that they do not take the same timestamp
+	ss.uploadMut.Lock()
+	defer ss.uploadMut.Unlock()
+
+	newFile := false
 	file, err := ss.syncRepository.GetFileByPath(pleaseSyncReq.AfterPath)
 	if err == ss.syncRepository.ErrKeyNotFound() {
 		// check request type is remove and file is not exist
@@ -248,6 +378,7 @@ func (ss *SyncService) UpdateFileWithoutContents(pleaseSyncReq *types.PleaseSync
 		}
 
 		// If file not exist, then create the file information to database
+		newFile = true
 		fileMetadata := types.FileMetadata{
 			Name:    "",
 			Size:    0,
@@ -285,6 +416,18 @@ func (ss *SyncService) UpdateFileWithoutContents(pleaseSyncReq *types.PleaseSync
 		return nil, errors.New("[SyncService.UpdateFileWithoutContents] request on unconnected rootDir err")
 	}
 
+	// ignored file is reported as updated, so that client does not retry to sync it
+	policy := utils.ResolvePolicy(rootDir, ss.extensionPolicies, pleaseSyncReq.AfterPath)
+	if policy.Ignore {
+		log.Println("quics: file is ignored by policy (", policy.IgnoreSource, "): ", pleaseSyncReq.AfterPath)
+		pleaseSyncRes := &types.PleaseSyncRes{
+			UUID:      pleaseSyncReq.UUID,
+			AfterPath: pleaseSyncReq.AfterPath,
+			Status:    "ALREADYUPDATED",
+		}
+		return pleaseSyncRes, nil
+	}
+
 	switch {
 	// check file has been updated
 	case file.LatestHash == pleaseSyncReq.LastUpdateHash:
@@ -297,9 +440,32 @@ func (ss *SyncService) UpdateFileWithoutContents(pleaseSyncReq *types.PleaseSync
 		}
 		return pleaseSyncRes, nil
 
+	// append-only directory allows only new files
+	case rootDir.AppendOnly && !newFile && file.LatestHash != "":
+		return nil, errors.New("[SyncService.UpdateFileWithoutContents] root directory is append-only; existing file can not be modified or deleted: " + file.AfterPath)
+
+	// locked file can be synced only by lock holder
+	case file.Lock.IsHeldByOther(pleaseSyncReq.UUID, time.Now()):
+		return nil, errors.New("[SyncService.UpdateFileWithoutContents] file is locked by " + file.Lock.Holder + ": " + file.AfterPath)
+
 	// check file is coflict
 	// conflict case LastestSyncTimestamp < LastUpdateTimestamp && LastestSyncHash == LastSyncHash
 	case reflect.ValueOf(file.Conflict).IsZero() && file.LatestSyncTimestamp < pleaseSyncReq.LastUpdateTimestamp && file.LatestHash == pleaseSyncReq.LastSyncHash:
+		// stored previous version can be base of appended contents (e.g., log file), so that client sends only appended bytes
+		pleaseSyncRes := &types.PleaseSyncRes{
+			UUID:      pleaseSyncReq.UUID,
+			AfterPath: pleaseSyncReq.AfterPath,
+			Status:    "GIVEME",
+			SyncToken: utils.MakeSyncToken(pleaseSyncReq.AfterPath, pleaseSyncReq.LastUpdateTimestamp),
+		}
+		// (ciphertext is not offered, since ciphertext of appended contents is not an append of it, and neither is client not supporting append extension)
+		if file.ContentsExisted && file.LatestHash != "" && pleaseSyncReq.LastUpdateHash != "" && !file.Metadata.IsDir && !pleaseSyncReq.Metadata.IsDir && pleaseSyncReq.Metadata.Size >= file.Metadata.Size && !file.Encryption.IsEncrypted() &&
+			ss.clientCapabilities(pleaseSyncReq.UUID).SupportsExtension(types.ExtensionAppend) {
+			pleaseSyncRes.AppendBaseTimestamp = file.LatestSyncTimestamp
+			pleaseSyncRes.AppendBaseHash = file.LatestHash
+			pleaseSyncRes.AppendBaseSize = file.Metadata.Size
+		}
+
 		// check event type
 		if pleaseSyncReq.LastUpdateHash == "" {
 			// if event type is REMOVE then set empty file metadata
@@ -326,14 +492,16 @@ func (ss *SyncService) UpdateFileWithoutContents(pleaseSyncReq *types.PleaseSync
 		}
 
 		// create file history entity
+		date, clientDate := ss.historyDate(pleaseSyncReq.Metadata.ModTime)
 		fileHistory := &types.FileHistory{
-			Date:       time.Now().String(),
+			Date:       date,
 			UUID:       pleaseSyncReq.UUID,
 			BeforePath: file.BeforePath,
 			AfterPath:  file.AfterPath,
 			Timestamp:  file.LatestSyncTimestamp,
 			Hash:       file.LatestHash,
 			File:       file.Metadata,
+			ClientDate: clientDate,
 		}
 		err = ss.historyRepository.SaveNewFileHistory(fileHistory.AfterPath, fileHistory)
 		if err != nil {
@@ -341,13 +509,6 @@ func (ss *SyncService) UpdateFileWithoutContents(pleaseSyncReq *types.PleaseSync
 			return nil, err
 		}
 
-		// update sync file
-		pleaseSyncRes := &types.PleaseSyncRes{
-			UUID:      pleaseSyncReq.UUID,
-			AfterPath: pleaseSyncReq.AfterPath,
-			Status:    "GIVEME",
-		}
-
 		return pleaseSyncRes, nil
 
 	// otherwise, file is conflicted
@@ -367,13 +528,15 @@ func (ss *SyncService) UpdateFileWithoutContents(pleaseSyncReq *types.PleaseSync
 			file.Conflict.StagingFiles["server"] = *latestFileHistory
 		}
 
+		date, clientDate := ss.historyDate(pleaseSyncReq.Metadata.ModTime)
 		file.Conflict.StagingFiles[pleaseSyncReq.UUID] = types.FileHistory{
-			Date:      time.Now().String(),
-			UUID:      pleaseSyncReq.UUID,
-			AfterPath: pleaseSyncReq.AfterPath,
-			Timestamp: pleaseSyncReq.LastUpdateTimestamp,
-			Hash:      pleaseSyncReq.LastUpdateHash,
-			File:      pleaseSyncReq.Metadata,
+			Date:       date,
+			UUID:       pleaseSyncReq.UUID,
+			AfterPath:  pleaseSyncReq.AfterPath,
+			Timestamp:  pleaseSyncReq.LastUpdateTimestamp,
+			Hash:       pleaseSyncReq.LastUpdateHash,
+			File:       pleaseSyncReq.Metadata,
+			ClientDate: clientDate,
 		}
 
 		err = ss.syncRepository.UpdateFile(file)
@@ -399,22 +562,93 @@ func (ss *SyncService) UpdateFileWithoutContents(pleaseSyncReq *types.PleaseSync
 
 // UpdateFileWithContents updates file (ContentExisted = true)
 func (ss *SyncService) UpdateFileWithContents(pleaseTakeReq *types.PleaseTakeReq, fileMetadata *types.FileMetadata, fileContent io.Reader) (*types.PleaseTakeRes, error) {
+	err := ss.checkWritable()
+	if err != nil {
+		return nil, err
+	}
+	err = ss.checkPathLimits(pleaseTakeReq.AfterPath)
+	if err != nil {
+		return nil, err
+	}
+
+	pleaseTakeRes, err := ss.updateFileWithContents(pleaseTakeReq, fileMetadata, fileContent)
+	return pleaseTakeRes, ss.checkDiskFull(pleaseTakeReq.AfterPath, err)
+}
+
+func (ss *SyncService) updateFileWithContents(pleaseTakeReq *types.PleaseTakeReq, fileMetadata *types.FileMetadata, fileContent io.Reader) (*types.PleaseTakeRes, error) {
 	log.Println("quics: UpdateFileWithContents: ", pleaseTakeReq)
+	startedAt := time.Now()
+	endTransfer := ss.BeginTransfer()
+	defer endTransfer()
+	receivedSize := fileMetadata.Size
+
+	err := validateEncryption(&pleaseTakeReq.Encryption)
+	if err != nil {
+		err = errors.New("[SyncService.UpdateFileWithContents] " + err.Error())
+		return nil, err
+	}
+
+	// contents are received as fast as bandwidth schedule of client allows, unless client marks them urgent
+	if !pleaseTakeReq.Urgent {
+		fileContent = ss.clientThrottle(pleaseTakeReq.UUID).Reader(fileContent)
+	}
+
+	// contents are received fully before they are committed, so that slow client does not hold the lock of uploads
+	spool, err := utils.SpoolContents(fileContent, ss.uploadMemoryBuffer)
+	if err != nil {
+		err = errors.New("[SyncService.UpdateFileWithContents] receive contents: " + err.Error())
+		return nil, err
+	}
+	defer spool.Close()
+	fileContent = spool
+
+	ss.uploadMut.Lock()
+	defer ss.uploadMut.Unlock()
+
 	file, err := ss.syncRepository.GetFileByPath(pleaseTakeReq.AfterPath)
 	if err != nil {
 		err = errors.New("[SyncService.UpdateFileWithContents] get file data by path: " + err.Error())
 		return nil, err
 	}
 
+	// contents of appended file are only appended bytes, so they are joined to stored contents of base version
+	var appendBase *types.FileHistory
+	if pleaseTakeReq.AppendBaseTimestamp != 0 {
+		var baseContent io.Reader
+		appendBase, baseContent, err = ss.openAppendBase(pleaseTakeReq)
+		if err != nil {
+			err = errors.New("[SyncService.UpdateFileWithContents] open base of appended contents: " + err.Error())
+			return nil, err
+		}
+		if closer, ok := baseContent.(io.Closer); ok {
+			defer closer.Close()
+		}
+
+		appended := *fileMetadata
+		appended.Size += appendBase.File.Size
+		fileMetadata = &appended
+		fileContent = io.MultiReader(baseContent, fileContent)
+	}
+
 	// check file is coflicted
 	if reflect.ValueOf(file.Conflict).IsZero() {
+		// version requested from this client can be superseded by upload after it was requested,
+		// and its contents must not overwrite contents of the newer version
+		if file.LatestEditClient != pleaseTakeReq.UUID {
+			return nil, errors.New("[SyncService.UpdateFileWithContents] file is updated by other since contents were requested: " + file.AfterPath)
+		}
+
 		// if file is not conflicted then update file
+		// contents are hashed while they are streamed into the store, so that they are not read again to be hashed
+		hasher := teeContentHasher(fileMetadata, &fileContent)
+
 		// save latest file to {rootDir}
 		err = ss.syncDirAdapter.SaveFileToHistoryDir(file.AfterPath, file.LatestSyncTimestamp, fileMetadata, fileContent)
 		if err != nil {
 			err = errors.New("[SyncService.UpdateFileWithContents] save file to historyDir: " + err.Error())
 			return nil, err
 		}
+		ss.RecordTransfer(types.TransferUpload, pleaseTakeReq.UUID, file.AfterPath, receivedSize, startedAt)
 
 		// check file is deleted
 		if file.LatestHash == "" {
@@ -452,6 +686,15 @@ func (ss *SyncService) UpdateFileWithContents(pleaseTakeReq *types.PleaseTakeReq
 
 		}
 
+		file.Encryption = pleaseTakeReq.Encryption
+		if file.LatestHash != "" {
+			err = ss.updateContentHash(file, appendBase, hasher.Leaves())
+			if err != nil {
+				err = errors.New("[SyncService.UpdateFileWithContents] update content hash: " + err.Error())
+				return nil, err
+			}
+		}
+
 		file.ContentsExisted = true
 		err = ss.syncRepository.UpdateFile(file)
 		if err != nil {
@@ -459,6 +702,19 @@ func (ss *SyncService) UpdateFileWithContents(pleaseTakeReq *types.PleaseTakeReq
 			return nil, err
 		}
 
+		// latest contents are saved, so older histories can be dropped by versioning policy
+		err = ss.applyVersioningPolicy(file)
+		if err != nil {
+			err = errors.New("[SyncService.UpdateFileWithContents] apply versioning policy: " + err.Error())
+			log.Println("quics err: ", err)
+		}
+
+		if file.LatestHash == "" {
+			ss.publishEvent(types.EventRemove, file)
+		} else {
+			ss.publishEvent(types.EventUpdate, file)
+		}
+
 		// TODO: call must sync
 		// -> must sync transaction with goroutine (and end please transaction)
 
@@ -507,6 +763,7 @@ func (ss *SyncService) UpdateFileWithContents(pleaseTakeReq *types.PleaseTakeReq
 			err = errors.New("[SyncService.UpdateFileWithContents] save file to conflictDir: " + err.Error())
 			return nil, err
 		}
+		ss.RecordTransfer(types.TransferUpload, pleaseTakeReq.UUID, file.AfterPath, receivedSize, startedAt)
 
 		// check file hash is correct
 		fileInfo, err := ss.syncDirAdapter.GetFileInfoFromConflictDir(file.AfterPath, pleaseTakeReq.UUID)
@@ -523,6 +780,25 @@ func (ss *SyncService) UpdateFileWithContents(pleaseTakeReq *types.PleaseTakeReq
 			return nil, errors.New("[SyncService.UpdateFileWithContents] file hash is not correct")
 		}
 
+		// encryption of candidate is kept, so that it is set to file when the candidate is chosen
+		if pleaseTakeReq.Encryption.IsEncrypted() {
+			stagingFile := file.Conflict.StagingFiles[pleaseTakeReq.UUID]
+			stagingFile.Encryption = pleaseTakeReq.Encryption
+			file.Conflict.StagingFiles[pleaseTakeReq.UUID] = stagingFile
+			err = ss.syncRepository.UpdateFile(file)
+			if err != nil {
+				err = errors.New("[SyncService.UpdateFileWithContents] update file data: " + err.Error())
+				return nil, err
+			}
+			err = ss.syncRepository.UpdateConflict(file.AfterPath, &file.Conflict)
+			if err != nil {
+				err = errors.New("[SyncService.UpdateFileWithContents] update conflict data: " + err.Error())
+				return nil, err
+			}
+		}
+
+		ss.publishEvent(types.EventConflict, file)
+
 		// update sync file
 		pleaseTakeRes := &types.PleaseTakeRes{
 			UUID:      pleaseTakeReq.UUID,
@@ -535,6 +811,16 @@ func (ss *SyncService) UpdateFileWithContents(pleaseTakeReq *types.PleaseTakeReq
 
 // CallMustSync calls must sync transaction
 func (ss *SyncService) CallMustSync(filePath string, UUIDs []string) error {
+	// contents of store-content-only file are kept on server without being pushed to clients
+	policy, err := ss.ResolvePolicy(filePath)
+	if err != nil {
+		return err
+	}
+	if policy.StoreContentOnly {
+		log.Println("quics: MUSTSYNC is skipped by policy (", policy.StoreContentOnlySource, "): ", filePath)
+		return nil
+	}
+
 	ss.cancelMut.Lock()
 	if _, exists := ss.cancel[filePath]; exists {
 		log.Println("quics: Cancel MUSTSYNC of ", filePath)
@@ -556,11 +842,18 @@ func (ss *SyncService) CallMustSync(filePath string, UUIDs []string) error {
 	}()
 
 	for _, UUID := range UUIDs {
+		if !ss.isSubscribed(UUID, filePath) {
+			continue
+		}
+
 		transaction, err := ss.networkAdapter.OpenTransaction(types.MUSTSYNC, UUID)
 		if err != nil {
-			err = errors.New("[SyncService.CallMustSync] open transaction: " + err.Error())
-			return err
+			// client is offline, so change is delivered when it reconnects
+			ss.queuePendingChange(UUID, filePath)
+			continue
 		}
+		transaction.Throttle(ss.clientThrottle(UUID))
+		capabilities := ss.clientCapabilities(UUID)
 		log.Println("quics: MUSTSYNC to ", UUID)
 
 		// -> must sync
@@ -584,12 +877,17 @@ func (ss *SyncService) CallMustSync(filePath string, UUIDs []string) error {
 				log.Println("quics err: ", ctx.Err())
 				return
 			}
+			if file.Encryption.IsEncrypted() && !capabilities.SupportsEncryption(file.Encryption.Scheme) {
+				log.Println("quics alert: ", "MUSTSYNC of "+filePath+" is skipped: client can not decrypt "+file.Encryption.Scheme)
+				return
+			}
 
 			mustSyncReq := &types.MustSyncReq{
 				LatestHash:          file.LatestHash,
 				LatestSyncTimestamp: file.LatestSyncTimestamp,
 				BeforePath:          file.BeforePath,
 				AfterPath:           file.AfterPath,
+				Encryption:          file.Encryption,
 			}
 			if ctx.Err() != nil {
 				log.Println("quics err: ", ctx.Err())
@@ -624,13 +922,19 @@ func (ss *SyncService) CallMustSync(filePath string, UUIDs []string) error {
 				return
 			}
 
-			historyFilePath := utils.GetHistoryFileNameByAfterPath(mustSyncRes.AfterPath, mustSyncRes.LatestSyncTimestamp)
+			historyFilePath, compression, cleanup := ss.transferFile(file, mustSyncRes.LatestSyncTimestamp, capabilities)
+			defer cleanup()
+			giveYouReq.Compression = compression
+			startedAt := time.Now()
+			endTransfer := ss.BeginTransfer()
 			giveYouRes, err := transaction.RequestGiveYou(giveYouReq, historyFilePath)
+			endTransfer()
 			if err != nil {
 				err = errors.New("[SyncService.CallMustSync] request giveyou using transaction: " + err.Error())
 				log.Println("quics err: ", err)
 				return
 			}
+			ss.RecordTransfer(types.TransferDownload, mustSyncRes.UUID, mustSyncRes.AfterPath, file.Metadata.Size, startedAt)
 			if ctx.Err() != nil {
 				log.Println("quics err: ", ctx.Err())
 				return
@@ -682,7 +986,37 @@ func (ss *SyncService) GetConflictList(request *types.AskConflictListReq) (*type
 	}, nil
 }
 
+// ListConflicts returns unresolved conflicts of files under afterPath (every conflict when it is empty) for operator
+func (ss *SyncService) ListConflicts(afterPath string) ([]types.Conflict, error) {
+	// conflict keys are prefixed by after path, so /root also scans /root2 which is filtered out here
+	conflicts, err := ss.syncRepository.GetConflictList([]string{afterPath})
+	if err != nil {
+		err = errors.New("[SyncService.ListConflicts] get conflict list using repository: " + err.Error())
+		return nil, err
+	}
+
+	matched := []types.Conflict{}
+	for _, conflict := range conflicts {
+		if afterPath == "" || utils.IsUnderPath(afterPath, conflict.AfterPath) {
+			matched = append(matched, conflict)
+		}
+	}
+
+	return matched, nil
+}
+
+// ChooseOne resolves conflict of file by candidate chosen by client
 func (ss *SyncService) ChooseOne(request *types.PleaseFileReq) (*types.PleaseFileRes, error) {
+	err := ss.checkWritable()
+	if err != nil {
+		return nil, err
+	}
+
+	pleaseFileRes, err := ss.chooseOne(request)
+	return pleaseFileRes, ss.checkDiskFull(request.AfterPath, err)
+}
+
+func (ss *SyncService) chooseOne(request *types.PleaseFileReq) (*types.PleaseFileRes, error) {
 	log.Println("quics: ChooseOne: ", request)
 	client, err := ss.registrationRepository.GetClientByUUID(request.UUID)
 	if err != nil {
@@ -701,28 +1035,68 @@ func (ss *SyncService) ChooseOne(request *types.PleaseFileReq) (*types.PleaseFil
 		return nil, errors.New("[SyncService.ChooseOne] root directory is not registered")
 	}
 
+	_, err = ss.resolveConflict(file, request.Side, request.UUID)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &types.PleaseFileRes{
+		UUID:      request.UUID,
+		AfterPath: request.AfterPath,
+	}
+
+	return response, nil
+}
+
+// ResolveConflict resolves conflict of file of afterPath by candidate of side ("server" or UUID of client which uploaded it)
+// on behalf of operator (e.g., qis conflict resolve), as if a client registered to its root directory chose it
+func (ss *SyncService) ResolveConflict(afterPath string, side string) (*types.File, error) {
+	err := ss.checkWritable()
+	if err != nil {
+		return nil, err
+	}
+
+	log.Println("quics: ResolveConflict: ", afterPath, side)
+	file, err := ss.syncRepository.GetFileByPath(afterPath)
+	if err != nil {
+		err = errors.New("[SyncService.ResolveConflict] get file data by path: " + err.Error())
+		return nil, err
+	}
+
+	file, err = ss.resolveConflict(file, side, "")
+	return file, ss.checkDiskFull(afterPath, err)
+}
+
+// resolveConflict saves candidate of side as new latest version of conflicted file and pushes it to clients by force sync
+// uuid is client choosing it ("" for operator), which can not choose while another client holds lock of file
+func (ss *SyncService) resolveConflict(file *types.File, side string, uuid string) (*types.File, error) {
 	if reflect.ValueOf(file.Conflict).IsZero() {
-		return nil, errors.New("[SyncService.ChooseOne] file is not conflicted")
+		return nil, errors.New("[SyncService.resolveConflict] file is not conflicted")
+	}
+
+	if _, exists := file.Conflict.StagingFiles[side]; !exists {
+		return nil, errors.New("[SyncService.resolveConflict] side is not exists")
 	}
 
-	if _, exists := file.Conflict.StagingFiles[request.Side]; !exists {
-		return nil, errors.New("[SyncService.ChooseOne] side is not exists")
+	if file.Lock.IsHeldByOther(uuid, time.Now()) {
+		return nil, errors.New("[SyncService.resolveConflict] file is locked by " + file.Lock.Holder + ": " + file.AfterPath)
 	}
 
+	var err error
 	// save file to {rootDir}
-	if request.Side == "server" {
+	if side == "server" {
 		fileMetadata, fileContent := &types.FileMetadata{}, io.Reader(nil)
 		if file.ContentsExisted {
 			fileMetadata, fileContent, err = ss.syncDirAdapter.GetFileFromHistoryDir(file.AfterPath, file.LatestSyncTimestamp)
 			if err != nil {
-				err = errors.New("[SyncService.ChooseOne] get file from historyDir: " + err.Error())
+				err = errors.New("[SyncService.resolveConflict] get file from historyDir: " + err.Error())
 				return nil, err
 			}
 		}
 		// when selected side is server
 		// save server file as new file to {rootDir}
 		file.LatestSyncTimestamp = file.LatestSyncTimestamp + 1
-		file.LatestEditClient = request.UUID
+		file.LatestEditClient = uuid
 		file.NeedForceSync = true
 		file.Conflict = types.Conflict{}
 
@@ -730,82 +1104,132 @@ func (ss *SyncService) ChooseOne(request *types.PleaseFileReq) (*types.PleaseFil
 		if file.ContentsExisted {
 			err = ss.syncDirAdapter.SaveFileToHistoryDir(file.AfterPath, file.LatestSyncTimestamp, fileMetadata, fileContent)
 			if err != nil {
-				err = errors.New("[SyncService.ChooseOne] save file to historyDir: " + err.Error())
+				err = errors.New("[SyncService.resolveConflict] save file to historyDir: " + err.Error())
+				return nil, err
+			}
+
+			err = ss.historyRepository.SaveNewFileHistory(file.AfterPath, &types.FileHistory{
+				Date:        ss.serverDate().String(),
+				UUID:        uuid,
+				BeforePath:  file.BeforePath,
+				AfterPath:   file.AfterPath,
+				Timestamp:   file.LatestSyncTimestamp,
+				Hash:        file.LatestHash,
+				ContentHash: file.ContentHash,
+				File:        file.Metadata,
+				Encryption:  file.Encryption,
+			})
+			if err != nil {
+				err = errors.New("[SyncService.resolveConflict] save new file history data: " + err.Error())
 				return nil, err
 			}
 		}
 
 		err = ss.syncDirAdapter.DeleteFilesFromConflictDir(file.AfterPath)
 		if err != nil {
-			err = errors.New("[SyncService.ChooseOne] delete file from conflictDir: " + err.Error())
+			err = errors.New("[SyncService.resolveConflict] delete file from conflictDir: " + err.Error())
 			return nil, err
 		}
 
 		err = ss.syncRepository.DeleteConflict(file.AfterPath)
 		if err != nil {
-			err = errors.New("[SyncService.ChooseOne] delete conflict data from repository: " + err.Error())
+			err = errors.New("[SyncService.resolveConflict] delete conflict data from repository: " + err.Error())
 			return nil, err
 		}
 
 		err = ss.syncRepository.UpdateFile(file)
 		if err != nil {
-			err = errors.New("[SyncService.ChooseOne] update file data using repository: " + err.Error())
+			err = errors.New("[SyncService.resolveConflict] update file data using repository: " + err.Error())
 			return nil, err
 		}
 	} else {
 		// when selected side is client
 		// save client file as new file to {rootDir}
-		selectedConflictFile := file.Conflict.StagingFiles[request.Side]
+		selectedConflictFile := file.Conflict.StagingFiles[side]
 		file.LatestHash = selectedConflictFile.Hash
 		file.LatestSyncTimestamp = file.LatestSyncTimestamp + 1
 		file.LatestEditClient = selectedConflictFile.UUID
 		file.ContentsExisted = true
 		file.NeedForceSync = true
 		file.Conflict = types.Conflict{}
+		file.Encryption = selectedConflictFile.Encryption
 
 		fileMetadata, fileContent, err := ss.syncDirAdapter.GetFileFromConflictDir(file.AfterPath, selectedConflictFile.UUID)
 		if err != nil {
-			err = errors.New("[SyncService.ChooseOne] get file from conflictDir: " + err.Error())
+			err = errors.New("[SyncService.resolveConflict] get file from conflictDir: " + err.Error())
 			return nil, err
 		}
 
 		err = ss.syncDirAdapter.SaveFileToHistoryDir(file.AfterPath, file.LatestSyncTimestamp, fileMetadata, fileContent)
 		if err != nil {
-			err = errors.New("[SyncService.ChooseOne] save file to historyDir: " + err.Error())
+			err = errors.New("[SyncService.resolveConflict] save file to historyDir: " + err.Error())
 			return nil, err
 		}
 
 		fileMetadata, fileContent, err = ss.syncDirAdapter.GetFileFromHistoryDir(file.AfterPath, file.LatestSyncTimestamp)
 		if err != nil {
-			err = errors.New("[SyncService.ChooseOne] get file from historyDir: " + err.Error())
+			err = errors.New("[SyncService.resolveConflict] get file from historyDir: " + err.Error())
 			return nil, err
 		}
 
 		err = ss.syncDirAdapter.SaveFileToLatestDir(file.AfterPath, fileMetadata, fileContent)
 		if err != nil {
-			err = errors.New("[SyncService.ChooseOne] save file to latestDir: " + err.Error())
+			err = errors.New("[SyncService.resolveConflict] save file to latestDir: " + err.Error())
 			return nil, err
 		}
 
 		err = ss.syncDirAdapter.DeleteFilesFromConflictDir(file.AfterPath)
 		if err != nil {
-			err = errors.New("[SyncService.ChooseOne] delete candidate files from conflictDir: " + err.Error())
+			err = errors.New("[SyncService.resolveConflict] delete candidate files from conflictDir: " + err.Error())
 			return nil, err
 		}
 
 		err = ss.syncRepository.DeleteConflict(file.AfterPath)
 		if err != nil {
-			err = errors.New("[SyncService.ChooseOne] delete conflict data: " + err.Error())
+			err = errors.New("[SyncService.resolveConflict] delete conflict data: " + err.Error())
+			return nil, err
+		}
+
+		// selected contents are recorded as new version, so that versioning policy keeps its history
+		err = ss.historyRepository.SaveNewFileHistory(file.AfterPath, &types.FileHistory{
+			Date:       ss.serverDate().String(),
+			UUID:       selectedConflictFile.UUID,
+			BeforePath: file.BeforePath,
+			AfterPath:  file.AfterPath,
+			Timestamp:  file.LatestSyncTimestamp,
+			Hash:       selectedConflictFile.Hash,
+			File:       selectedConflictFile.File,
+			Encryption: selectedConflictFile.Encryption,
+		})
+		if err != nil {
+			err = errors.New("[SyncService.resolveConflict] save new file history data: " + err.Error())
+			return nil, err
+		}
+
+		err = ss.updateContentHash(file, nil, nil)
+		if err != nil {
+			err = errors.New("[SyncService.resolveConflict] update content hash: " + err.Error())
 			return nil, err
 		}
 
 		err = ss.syncRepository.UpdateFile(file)
 		if err != nil {
-			err = errors.New("[SyncService.ChooseOne] update file data using repository: " + err.Error())
+			err = errors.New("[SyncService.resolveConflict] update file data using repository: " + err.Error())
 			return nil, err
 		}
 	}
 
+	// resolved contents are saved as the latest version, so older histories can be dropped by versioning policy
+	if file.ContentsExisted {
+		err = ss.applyVersioningPolicy(file)
+		if err != nil {
+			err = errors.New("[SyncService.resolveConflict] apply versioning policy: " + err.Error())
+			log.Println("quics err: ", err)
+		}
+	}
+
+	ss.publishEvent(types.EventResolve, file)
+
 	// call force sync
 	// -> force sync transaction with goroutine (and end please transaction)
 
@@ -814,26 +1238,21 @@ func (ss *SyncService) ChooseOne(request *types.PleaseFileReq) (*types.PleaseFil
 			// extract root directory of this file
 			rootDir, err := ss.syncRepository.GetRootDirByPath(file.RootDirKey)
 			if err != nil {
-				err = errors.New("[goroutine in SyncService.ChooseOne] get rootDiy by path: " + err.Error())
+				err = errors.New("[goroutine in SyncService.resolveConflict] get rootDiy by path: " + err.Error())
 				log.Println("quics err: ", err)
 				return
 			}
 
 			err = ss.CallForceSync(file.AfterPath, rootDir.UUIDs)
 			if err != nil {
-				err = errors.New("[goroutine in SyncService.ChooseOne] call forcesync: " + err.Error())
+				err = errors.New("[goroutine in SyncService.resolveConflict] call forcesync: " + err.Error())
 				log.Println("quics err: ", err)
 				return
 			}
 		}()
 	}
 
-	response := &types.PleaseFileRes{
-		UUID:      request.UUID,
-		AfterPath: request.AfterPath,
-	}
-
-	return response, nil
+	return file, nil
 }
 
 func (ss *SyncService) CallForceSync(filePath string, UUIDs []string) error {
@@ -850,11 +1269,18 @@ func (ss *SyncService) CallForceSync(filePath string, UUIDs []string) error {
 		delete(ss.cancel, filePath)
 	}()
 	for _, UUID := range UUIDs {
+		if !ss.isSubscribed(UUID, filePath) {
+			continue
+		}
+
 		transaction, err := ss.networkAdapter.OpenTransaction(types.FORCESYNC, UUID)
 		if err != nil {
-			err = errors.New("[SyncService.CallForceSync] open transaction: " + err.Error())
-			return err
+			// client is offline, so change is delivered when it reconnects
+			ss.queuePendingChange(UUID, filePath)
+			continue
 		}
+		transaction.Throttle(ss.clientThrottle(UUID))
+		capabilities := ss.clientCapabilities(UUID)
 		log.Println("quics: FORCESYNC to ", UUID)
 
 		// -> force sync
@@ -878,25 +1304,36 @@ func (ss *SyncService) CallForceSync(filePath string, UUIDs []string) error {
 				log.Println("quics err: ", ctx.Err())
 				return
 			}
+			if file.Encryption.IsEncrypted() && !capabilities.SupportsEncryption(file.Encryption.Scheme) {
+				log.Println("quics alert: ", "FORCESYNC of "+filePath+" is skipped: client can not decrypt "+file.Encryption.Scheme)
+				return
+			}
 
 			mustSyncReq := &types.MustSyncReq{
 				LatestHash:          file.LatestHash,
 				LatestSyncTimestamp: file.LatestSyncTimestamp,
 				BeforePath:          file.BeforePath,
 				AfterPath:           file.AfterPath,
+				Encryption:          file.Encryption,
 			}
 			if ctx.Err() != nil {
 				log.Println("quics err: ", ctx.Err())
 				return
 			}
 
-			historyFilePath := utils.GetHistoryFileNameByAfterPath(mustSyncReq.AfterPath, mustSyncReq.LatestSyncTimestamp)
+			historyFilePath, compression, cleanup := ss.transferFile(file, mustSyncReq.LatestSyncTimestamp, capabilities)
+			defer cleanup()
+			mustSyncReq.Compression = compression
+			startedAt := time.Now()
+			endTransfer := ss.BeginTransfer()
 			mustSyncRes, err := transaction.RequestForceSync(mustSyncReq, historyFilePath)
+			endTransfer()
 			if err != nil {
 				err = errors.New("[SyncService.CallForceSync] request forcesync using transaction: " + err.Error())
 				log.Println("quics err: ", err)
 				return
 			}
+			ss.RecordTransfer(types.TransferDownload, mustSyncRes.UUID, mustSyncReq.AfterPath, file.Metadata.Size, startedAt)
 			if ctx.Err() != nil {
 				log.Println("quics err: ", ctx.Err())
 				return
@@ -910,18 +1347,107 @@ func (ss *SyncService) CallForceSync(filePath string, UUIDs []string) error {
 	return nil
 }
 
+// FullScan pushes files which client does not have or has older version of without local changes
+// root directories of ManifestScanThreshold files or more are reconciled by merkle manifest, so that only changed files are exchanged,
+// and the others (or client not supporting MANIFESTSCAN) are compared with full listing of sync metadata of client
 func (ss *SyncService) FullScan(uuid string) error {
+	_, err := ss.fullScan(uuid)
+	return err
+}
+
+// SyncNow runs a full sync pass with connected client right away instead of waiting for background full scan or reconnection,
+// and reports how many changes are exchanged; changes queued while client was offline are covered by the pass, so they are dropped
+func (ss *SyncService) SyncNow(uuid string) (*types.SyncNowRes, error) {
+	log.Println("quics: SyncNow: ", uuid)
+	_, err := ss.registrationRepository.GetClientByUUID(uuid)
+	if err == ss.registrationRepository.ErrKeyNotFound() {
+		return nil, fmt.Errorf("%w: %s", ErrClientNotFound, uuid)
+	} else if err != nil {
+		err = errors.New("[SyncService.SyncNow] get client data by uuid: " + err.Error())
+		return nil, err
+	}
+
+	if !ss.networkAdapter.IsConnected(uuid) {
+		return nil, fmt.Errorf("%w: %s", ErrClientNotConnected, uuid)
+	}
+
+	pendingChanges, err := ss.syncRepository.PopPendingChanges(uuid)
+	if err != nil {
+		err = errors.New("[SyncService.SyncNow] pop pending changes: " + err.Error())
+		return nil, err
+	}
+
+	syncNowRes, err := ss.fullScan(uuid)
+	if err != nil {
+		err = errors.New("[SyncService.SyncNow] full scan: " + err.Error())
+
+		// queued changes are not delivered by failed scan, so they are kept for next sync
+		requeueErr := ss.syncRepository.RequeuePendingChanges(pendingChanges, MaxPendingChanges)
+		if requeueErr != nil {
+			log.Println("quics err: ", errors.New("[SyncService.SyncNow] requeue pending changes: "+requeueErr.Error()))
+		}
+		return nil, err
+	}
+	syncNowRes.Pending = len(pendingChanges.AfterPaths)
+
+	return syncNowRes, nil
+}
+
+// fullScan reconciles files of root directories of client with those of client, counting changes exchanged
+func (ss *SyncService) fullScan(uuid string) (*types.SyncNowRes, error) {
 	log.Println("quics: FullScan: ", uuid)
 	client, err := ss.registrationRepository.GetClientByUUID(uuid)
 	if err != nil {
 		err = errors.New("[SyncService.FullScan] get client data by uuid: " + err.Error())
-		return err
+		return nil, err
+	}
+
+	syncNowRes := &types.SyncNowRes{
+		UUID: uuid,
+	}
+
+	// nothing to scan before client registers root directory
+	if len(client.Root) == 0 {
+		return syncNowRes, nil
+	}
+
+	allFiles := []types.File{}
+	for _, rootDir := range client.Root {
+		files, err := ss.syncRepository.GetAllFiles(rootDir.AfterPath)
+		if err != nil {
+			err = errors.New("[SyncService.FullScan] get all file data from repository: " + err.Error())
+			return nil, err
+		}
+		allFiles = append(allFiles, files...)
+	}
+	syncNowRes.Scanned = len(allFiles)
+
+	for i, file := range allFiles {
+		if !file.ContentsExisted && file.LatestEditClient == uuid {
+			err := ss.CallNeedContent(&allFiles[i])
+			if err != nil {
+				err = errors.New("[SyncService.FullScan] call needcontent: " + err.Error())
+				log.Println("quics err: ", err, "; continue to next")
+				continue
+			}
+			syncNowRes.Pulled++
+		}
+	}
+
+	if len(allFiles) >= ManifestScanThreshold && client.Capabilities.SupportsExtension(types.ExtensionManifestScan) {
+		err = ss.manifestScan(uuid, allFiles, syncNowRes)
+		if err == nil {
+			syncNowRes.Manifest = true
+			return syncNowRes, nil
+		}
+		err = errors.New("[SyncService.FullScan] manifest scan: " + err.Error())
+		log.Println("quics err: ", err, "; fall back to full listing")
 	}
 
 	transaction, err := ss.networkAdapter.OpenTransaction(types.FULLSCAN, uuid)
 	if err != nil {
 		err = errors.New("[SyncService.FullScan] open transaction: " + err.Error())
-		return err
+		return nil, err
 	}
 
 	askAllMetaReq := &types.AskAllMetaReq{
@@ -931,77 +1457,181 @@ func (ss *SyncService) FullScan(uuid string) error {
 	askAllMetaRes, err := transaction.RequestAskAllMeta(askAllMetaReq)
 	if err != nil {
 		err = errors.New("[SyncService.FullScan] request askAllMeta using transaction: " + err.Error())
-		return err
+		return nil, err
 	}
 
 	if askAllMetaRes.UUID != uuid {
-		return errors.New("[SyncService.FullScan] UUID is not equal")
+		return nil, errors.New("[SyncService.FullScan] UUID is not equal")
 	}
 
-	for _, rootDir := range client.Root {
-		allFiles, err := ss.syncRepository.GetAllFiles(rootDir.AfterPath)
-		if err != nil {
-			err = errors.New("[SyncService.FullScan] get all file data from repository: " + err.Error())
-			return err
+	clientFiles := make(map[string]*types.SyncMetadata, len(askAllMetaRes.SyncMetaList))
+	for i, clientFile := range askAllMetaRes.SyncMetaList {
+		clientFiles[clientFile.AfterPath] = &askAllMetaRes.SyncMetaList[i]
+	}
+
+	for i := range allFiles {
+		if ss.pushScannedFile(&allFiles[i], clientFiles[allFiles[i].AfterPath], uuid) {
+			syncNowRes.Pushed++
 		}
-		for i, file := range allFiles {
-			if !file.ContentsExisted && file.LatestEditClient == uuid {
-				err := ss.CallNeedContent(&allFiles[i])
-				if err != nil {
-					err = errors.New("[SyncService.FullScan] call needcontent: " + err.Error())
-					log.Println("quics err: ", err, "; continue to next")
-				}
-			}
-			if !reflect.ValueOf(file.Conflict).IsZero() {
-				continue
-			}
+	}
 
-			exist := false
-			for _, clientFile := range askAllMetaRes.SyncMetaList {
-				if file.AfterPath == clientFile.AfterPath {
-					exist = true
-					if clientFile.LastUpdateTimestamp == clientFile.LastSyncTimestamp && file.LatestSyncTimestamp > clientFile.LastUpdateTimestamp {
-						// need must synce
-						if file.NeedForceSync {
-							err = ss.CallForceSync(file.AfterPath, []string{uuid})
-							if err != nil {
-								err = errors.New("[SyncService.FullScan] call forcesync: " + err.Error())
-								log.Println("quics err: ", err, "; continue to next")
-								break
-							}
-						} else {
-							err = ss.CallMustSync(file.AfterPath, []string{uuid})
-							if err != nil {
-								err = errors.New("[SyncService.FullScan] call mustsync: " + err.Error())
-								log.Println("quics err: ", err, "; continue to next")
-								break
-							}
-						}
-					}
-					break
-				}
-			}
+	return syncNowRes, nil
+}
 
-			// when file is not exist in client and it is not deleted
-			if !exist && file.LatestHash != "" {
-				// need must sync
-				if file.NeedForceSync {
-					err = ss.CallForceSync(file.AfterPath, []string{uuid})
-					if err != nil {
-						err = errors.New("[SyncService.FullScan] call forcesync: " + err.Error())
-						log.Println("quics err: ", err, "; continue to next")
-						continue
-					}
-				} else {
-					err = ss.CallMustSync(file.AfterPath, []string{uuid})
-					if err != nil {
-						err = errors.New("[SyncService.FullScan] call mustsync: " + err.Error())
-						log.Println("quics err: ", err, "; continue to next")
-						continue
-					}
-				}
-			}
+// manifestScan reconciles merkle manifest of files with the one of client, and pushes files only in differing buckets
+func (ss *SyncService) manifestScan(uuid string, allFiles []types.File, syncNowRes *types.SyncNowRes) error {
+	transaction, err := ss.networkAdapter.OpenTransaction(types.MANIFESTSCAN, uuid)
+	if err != nil {
+		err = errors.New("[SyncService.manifestScan] open transaction: " + err.Error())
+		return err
+	}
+	defer transaction.Close()
+
+	// file synced to client without local changes is recorded by client with the same hash and timestamp for update and sync
+	files := make(map[string]*types.File, len(allFiles))
+	entries := make([]types.SyncMetadata, 0, len(allFiles))
+	for i, file := range allFiles {
+		files[file.AfterPath] = &allFiles[i]
+		entries = append(entries, types.SyncMetadata{
+			AfterPath:           file.AfterPath,
+			LastUpdateTimestamp: file.LatestSyncTimestamp,
+			LastUpdateHash:      file.LatestHash,
+			LastSyncTimestamp:   file.LatestSyncTimestamp,
+			LastSyncHash:        file.LatestHash,
+		})
+	}
+	manifest := utils.NewManifest(entries)
+
+	rounds := 0
+	diff, clientFiles, err := utils.ReconcileManifest(manifest, func(prefixes []string) ([]types.ManifestNode, error) {
+		rounds++
+		askManifestRes, err := transaction.RequestAskManifest(&types.AskManifestReq{
+			UUID:     uuid,
+			Prefixes: prefixes,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if askManifestRes.UUID != uuid {
+			return nil, errors.New("UUID is not equal")
+		}
+		return askManifestRes.Nodes, nil
+	})
+	if err != nil {
+		err = errors.New("[SyncService.manifestScan] reconcile manifest: " + err.Error())
+		return err
+	}
+
+	// request without prefixes ends transaction of client
+	_, err = transaction.RequestAskManifest(&types.AskManifestReq{
+		UUID: uuid,
+	})
+	if err != nil {
+		err = errors.New("[SyncService.manifestScan] end manifest scan: " + err.Error())
+		log.Println("quics err: ", err)
+	}
+	log.Println("quics: manifest scan of ", uuid, ": ", len(diff), " of ", len(allFiles), " files differ (", rounds, " rounds)")
+
+	for _, afterPath := range diff {
+		file, ok := files[afterPath]
+		if !ok {
+			// file only in client is synced by client itself
+			continue
+		}
+
+		var clientFile *types.SyncMetadata
+		if syncMeta, ok := clientFiles[afterPath]; ok {
+			clientFile = &syncMeta
+		}
+		if ss.pushScannedFile(file, clientFile, uuid) {
+			syncNowRes.Pushed++
+		}
+	}
+
+	return nil
+}
+
+// pushScannedFile pushes file found by scan when client does not have it (nil clientFile),
+// or has older version without local changes, and returns whether it is pushed
+func (ss *SyncService) pushScannedFile(file *types.File, clientFile *types.SyncMetadata, uuid string) bool {
+	if !reflect.ValueOf(file.Conflict).IsZero() {
+		return false
+	}
+
+	if clientFile != nil {
+		if clientFile.LastUpdateTimestamp != clientFile.LastSyncTimestamp || file.LatestSyncTimestamp <= clientFile.LastUpdateTimestamp {
+			return false
+		}
+	} else if file.LatestHash == "" {
+		// file is not exist in client and it is deleted
+		return false
+	}
+
+	// file out of subscriptions is not sent, so it is not counted as pushed either
+	if !ss.isSubscribed(uuid, file.AfterPath) {
+		return false
+	}
+
+	var err error
+	if file.NeedForceSync {
+		err = ss.CallForceSync(file.AfterPath, []string{uuid})
+		if err != nil {
+			err = errors.New("[SyncService.pushScannedFile] call forcesync: " + err.Error())
+		}
+	} else {
+		err = ss.CallMustSync(file.AfterPath, []string{uuid})
+		if err != nil {
+			err = errors.New("[SyncService.pushScannedFile] call mustsync: " + err.Error())
+		}
+	}
+	if err != nil {
+		log.Println("quics err: ", err, "; continue to next")
+		return false
+	}
+
+	return true
+}
+
+// DeliverPendingChanges pushes changes queued while client was offline
+// client is fully scanned when the queue was collapsed or nothing is queued (e.g., client connected before server restart)
+func (ss *SyncService) DeliverPendingChanges(uuid string) error {
+	pendingChanges, err := ss.syncRepository.PopPendingChanges(uuid)
+	if err != nil {
+		err = errors.New("[SyncService.DeliverPendingChanges] pop pending changes: " + err.Error())
+		return err
+	}
+
+	if pendingChanges.FullResync || len(pendingChanges.AfterPaths) == 0 {
+		err = ss.FullScan(uuid)
+		if err != nil {
+			err = errors.New("[SyncService.DeliverPendingChanges] full scan: " + err.Error())
+			return err
+		}
+		return nil
+	}
 
+	log.Println("quics: deliver ", len(pendingChanges.AfterPaths), " pending changes to ", uuid)
+	for _, afterPath := range pendingChanges.AfterPaths {
+		file, err := ss.syncRepository.GetFileByPath(afterPath)
+		if err != nil {
+			err = errors.New("[SyncService.DeliverPendingChanges] get file by path: " + err.Error())
+			log.Println("quics err: ", err, "; continue to next")
+			continue
+		}
+
+		// conflicted file is delivered after it is resolved
+		if !reflect.ValueOf(file.Conflict).IsZero() {
+			continue
+		}
+
+		if file.NeedForceSync {
+			err = ss.CallForceSync(afterPath, []string{uuid})
+		} else {
+			err = ss.CallMustSync(afterPath, []string{uuid})
+		}
+		if err != nil {
+			err = errors.New("[SyncService.DeliverPendingChanges] push change: " + err.Error())
+			log.Println("quics err: ", err, "; continue to next")
 		}
 	}
 
@@ -1056,7 +1686,366 @@ func (ss *SyncService) Rescan(request *types.RescanReq) (*types.RescanRes, error
 	return rescanRes, nil
 }
 
+// Scrub re-reads the latest contents of all files and compares the recomputed hash against the recorded one
+// corrupted files are marked as not having contents, so that the next fullscan requests re-upload from the last editor,
+// and EventContentCorrupted is published for each of them
+func (ss *SyncService) Scrub() (*types.ScrubRes, error) {
+	log.Println("quics: Scrub")
+	files, err := ss.syncRepository.GetAllFiles("")
+	if err != nil {
+		err = errors.New("[SyncService.Scrub] get all file data from repository: " + err.Error())
+		return nil, err
+	}
+
+	scrubRes := &types.ScrubRes{
+		CorruptedFiles: []string{},
+	}
+	for _, file := range files {
+		// deleted files or files not uploaded yet have no contents to verify
+		if !file.ContentsExisted || file.LatestHash == "" {
+			continue
+		}
+		scrubRes.Scanned++
+
+		leaves, verified := ss.verifyHistoryContents(file.AfterPath, file.LatestSyncTimestamp, file.LatestHash, file.ContentHash)
+		if verified {
+			if leaves != nil {
+				ss.backfillContentHash(file, leaves)
+			}
+			continue
+		}
+
+		// file could be updated while scrubbing, so check the latest one before marking
+		latestFile, err := ss.syncRepository.GetFileByPath(file.AfterPath)
+		if err != nil {
+			err = errors.New("[SyncService.Scrub] get file data by path: " + err.Error())
+			log.Println("quics err: ", err, "; continue to next")
+			continue
+		}
+		if latestFile.LatestSyncTimestamp != file.LatestSyncTimestamp {
+			continue
+		}
+
+		log.Println("quics alert: [SyncService.Scrub] contents of ", file.AfterPath, " (timestamp: ", file.LatestSyncTimestamp, ") are corrupted")
+		latestFile.ContentsExisted = false
+		err = ss.syncRepository.UpdateFile(latestFile)
+		if err != nil {
+			err = errors.New("[SyncService.Scrub] update file data: " + err.Error())
+			return nil, err
+		}
+
+		scrubRes.Corrupted++
+		scrubRes.CorruptedFiles = append(scrubRes.CorruptedFiles, file.AfterPath)
+
+		if ss.eventService != nil {
+			ss.eventService.Publish(&types.Event{
+				Type:      types.EventContentCorrupted,
+				AfterPath: file.AfterPath,
+				UUID:      file.LatestEditClient,
+				Timestamp: file.LatestSyncTimestamp,
+				Hash:      file.LatestHash,
+				Date:      time.Now().String(),
+			})
+		}
+	}
+
+	return scrubRes, nil
+}
+
+// backfillContentHash records merkle root of verified contents to file saved before it was recorded,
+// so that the next scrub compares contents with it rather than only with metadata
+func (ss *SyncService) backfillContentHash(file types.File, leaves [][]byte) {
+	// file could be updated while scrubbing, so only the verified version is updated
+	latestFile, err := ss.syncRepository.GetFileByPath(file.AfterPath)
+	if err != nil || latestFile.LatestSyncTimestamp != file.LatestSyncTimestamp || latestFile.ContentHash != "" {
+		return
+	}
+
+	err = ss.updateContentHash(latestFile, nil, leaves)
+	if err == nil {
+		err = ss.syncRepository.UpdateFile(latestFile)
+	}
+	if err != nil {
+		err = errors.New("[SyncService.backfillContentHash] record content hash of " + file.AfterPath + ": " + err.Error())
+		log.Println("quics err: ", err)
+	}
+}
+
+// Reindex rebuilds derived index (ReindexAll: every index) by scanning primary records
+// each entry is replaced in its own transaction, so it is safe to run online; readers see the old entry until the new one is written
+func (ss *SyncService) Reindex(index string) ([]types.ReindexRes, error) {
+	log.Println("quics: Reindex: ", index)
+	indexes := []string{index}
+	if index == ReindexAll {
+		indexes = ReindexIndexes
+	}
+
+	reindexResList := []types.ReindexRes{}
+	for _, index := range indexes {
+		var reindexRes *types.ReindexRes
+		var err error
+		switch index {
+		case ReindexHash:
+			reindexRes, err = ss.reindexHash()
+		default:
+			return nil, fmt.Errorf("%w: %s (available: %s, %s)", ErrUnknownIndex, index, ReindexAll, strings.Join(ReindexIndexes, ", "))
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		log.Println("quics: reindex ", index, " finished (scanned: ", reindexRes.Scanned, ", updated: ", reindexRes.Updated, ", failed: ", reindexRes.Failed, ")")
+		reindexResList = append(reindexResList, *reindexRes)
+	}
+
+	return reindexResList, nil
+}
+
+// reindexHash computes merkle root of stored contents of every history again, and sets the latest one to its file
+// when recorded one has drifted (e.g., database is restored from backup taken at another time than contents)
+func (ss *SyncService) reindexHash() (*types.ReindexRes, error) {
+	files, err := ss.syncRepository.GetAllFiles("")
+	if err != nil {
+		err = errors.New("[SyncService.reindexHash] get all file data from repository: " + err.Error())
+		return nil, err
+	}
+
+	reindexRes := &types.ReindexRes{Index: ReindexHash}
+	scanned := func() {
+		reindexRes.Scanned++
+		if reindexRes.Scanned%ReindexProgressInterval == 0 {
+			log.Println("quics: reindex ", ReindexHash, " in progress (scanned: ", reindexRes.Scanned, ")")
+		}
+	}
+	for _, file := range files {
+		if !file.ContentsExisted || file.LatestHash == "" || file.Metadata.IsDir {
+			continue
+		}
+
+		fileHistories, err := ss.historyRepository.GetFileHistoriesForClient(file.AfterPath, 0)
+		if err != nil {
+			err = errors.New("[SyncService.reindexHash] get file histories: " + err.Error())
+			return nil, err
+		}
+
+		latestContentHash := ""
+		for _, fileHistory := range fileHistories {
+			// prefix of histories matches other files whose path starts with this path as well
+			if fileHistory.AfterPath != file.AfterPath || fileHistory.Hash == "" || fileHistory.File.IsDir {
+				continue
+			}
+			scanned()
+
+			contentHash, err := ss.syncDirAdapter.GetContentHashFromHistoryDir(fileHistory.AfterPath, fileHistory.Timestamp)
+			if err != nil {
+				reindexRes.Failed++
+				continue
+			}
+			if fileHistory.Timestamp == file.LatestSyncTimestamp {
+				latestContentHash = contentHash
+			}
+			if fileHistory.ContentHash == contentHash {
+				continue
+			}
+
+			// kept hashes of chunks are of drifted contents as well, so appended contents are hashed from scratch
+			fileHistory.ContentHash = contentHash
+			fileHistory.ContentLeaves = nil
+			err = ss.historyRepository.SaveNewFileHistory(fileHistory.AfterPath, &fileHistory)
+			if err != nil {
+				err = errors.New("[SyncService.reindexHash] save file history data: " + err.Error())
+				return nil, err
+			}
+			reindexRes.Updated++
+		}
+
+		scanned()
+		if latestContentHash == "" {
+			reindexRes.Failed++
+			continue
+		}
+		if file.ContentHash == latestContentHash {
+			continue
+		}
+
+		// file could be updated while reindexing, so only the same version is updated
+		latestFile, err := ss.syncRepository.GetFileByPath(file.AfterPath)
+		if err != nil || latestFile.LatestSyncTimestamp != file.LatestSyncTimestamp {
+			continue
+		}
+		latestFile.ContentHash = latestContentHash
+		err = ss.syncRepository.UpdateFile(latestFile)
+		if err != nil {
+			err = errors.New("[SyncService.reindexHash] update file data: " + err.Error())
+			return nil, err
+		}
+		reindexRes.Updated++
+	}
+
+	return reindexRes, nil
+}
+
+// BackgroundScrub runs scrub periodically (interval: seconds, 0 means disabled)
+func (ss *SyncService) BackgroundScrub(secInterval uint64) error {
+	if secInterval == 0 {
+		return nil
+	}
+
+	go func() {
+		for {
+			time.Sleep(time.Duration(secInterval) * time.Second)
+			scrubRes, err := ss.Scrub()
+			if err != nil {
+				err = errors.New("[SyncService.BackgroundScrub] run scrub: " + err.Error())
+				log.Println("quics err: ", err, "; continue to next")
+				continue
+			}
+			log.Println("quics: scrub finished (scanned: ", scrubRes.Scanned, ", corrupted: ", scrubRes.Corrupted, ")")
+		}
+	}()
+	return nil
+}
+
+// BackgroundDiskCheck checks free space of data directory every secInterval seconds,
+// so that low space is alerted before disk becomes full and server becomes writable again once space is freed
+func (ss *SyncService) BackgroundDiskCheck(secInterval uint64) error {
+	if secInterval == 0 {
+		return nil
+	}
+
+	go func() {
+		for {
+			ss.checkDiskSpace()
+			time.Sleep(time.Duration(secInterval) * time.Second)
+		}
+	}()
+	return nil
+}
+
+// DiskStats returns free space of volume which data directory is on
+func (ss *SyncService) DiskStats() types.DiskStats {
+	free, total, err := utils.GetDiskSpace(utils.GetQuicsDataDirPath())
+
+	ss.diskMut.Lock()
+	defer ss.diskMut.Unlock()
+
+	diskStats := types.DiskStats{
+		Free:     free,
+		Total:    total,
+		LowSpace: ss.diskLowSpace,
+		IsLow:    err == nil && ss.diskLowSpace > 0 && free < ss.diskLowSpace,
+		ReadOnly: ss.readOnly,
+	}
+	if !ss.lastDiskFull.IsZero() {
+		diskStats.LastFull = ss.lastDiskFull.String()
+	}
+	if err != nil {
+		diskStats.CheckErr = err.Error()
+	}
+
+	return diskStats
+}
+
+// checkDiskSpace alerts low space once until space is freed, and makes read-only server writable when free space is above the threshold
+func (ss *SyncService) checkDiskSpace() {
+	diskStats := ss.DiskStats()
+	if diskStats.CheckErr != "" {
+		log.Println("quics err: [SyncService.checkDiskSpace] get free space of data directory: ", diskStats.CheckErr)
+		return
+	}
+
+	ss.diskMut.Lock()
+	defer ss.diskMut.Unlock()
+
+	if diskStats.IsLow && !ss.lowSpace {
+		log.Println("quics alert: free space of data directory is low (free: ", diskStats.Free, " bytes, threshold: ", ss.diskLowSpace, " bytes)")
+	}
+	ss.lowSpace = diskStats.IsLow
+
+	if ss.readOnly && !diskStats.IsLow && diskStats.Free > 0 {
+		ss.readOnly = false
+		log.Println("quics alert: server is writable again (free: ", diskStats.Free, " bytes)")
+	}
+}
+
+// checkWritable returns ErrReadOnly while server is read-only after disk became full
+// free space is checked again first, so that server becomes writable as soon as space is freed
+func (ss *SyncService) checkWritable() error {
+	ss.diskMut.Lock()
+	readOnly := ss.readOnly
+	ss.diskMut.Unlock()
+	if !readOnly {
+		return nil
+	}
+
+	ss.checkDiskSpace()
+
+	ss.diskMut.Lock()
+	defer ss.diskMut.Unlock()
+
+	if ss.readOnly {
+		return fmt.Errorf("%w: server is read-only since disk became full at %s", ErrReadOnly, ss.lastDiskFull.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// checkPathLimits returns utils.ErrPathTooLong or utils.ErrPathTooDeep when afterPath of new file exceeds MAX_PATH_LENGTH or MAX_PATH_DEPTH
+// files stored before the limits were lowered are still accepted, so that they can be updated or removed
+func (ss *SyncService) checkPathLimits(afterPath string) error {
+	err := utils.CheckPathLimits(afterPath, ss.maxPathLength, ss.maxPathDepth)
+	if err == nil {
+		return nil
+	}
+
+	_, getErr := ss.syncRepository.GetFileByPath(afterPath)
+	if getErr == nil {
+		return nil
+	}
+	return err
+}
+
+// checkDiskFull returns ErrDiskFull when err is caused by disk full, alerting it by log and EventDiskFull
+// and making server read-only when DISK_FULL_READ_ONLY is set; other err is returned as it is
+func (ss *SyncService) checkDiskFull(afterPath string, err error) error {
+	if !utils.IsDiskFull(err) {
+		return err
+	}
+
+	ss.diskMut.Lock()
+	ss.lastDiskFull = time.Now()
+	enterReadOnly := ss.diskFullReadOnly && !ss.readOnly
+	if enterReadOnly {
+		ss.readOnly = true
+	}
+	ss.diskMut.Unlock()
+
+	log.Println("quics alert: write of ", afterPath, " is aborted because disk is full: ", err)
+	if enterReadOnly {
+		log.Println("quics alert: server is read-only until free space is above ", ss.diskLowSpace, " bytes")
+	}
+
+	if ss.eventService != nil {
+		ss.eventService.Publish(&types.Event{
+			Type:      types.EventDiskFull,
+			AfterPath: afterPath,
+			Date:      time.Now().String(),
+		})
+	}
+
+	return fmt.Errorf("%w: %s", ErrDiskFull, err.Error())
+}
+
+// CallNeedContent fetches contents of file which server does not have from its latest editing client
 func (ss *SyncService) CallNeedContent(file *types.File) error {
+	err := ss.checkWritable()
+	if err != nil {
+		return err
+	}
+
+	return ss.checkDiskFull(file.AfterPath, ss.callNeedContent(file))
+}
+
+func (ss *SyncService) callNeedContent(file *types.File) error {
 	log.Println("quics: [SyncService.CallNeedContent] ", file)
 	if file.ContentsExisted {
 		return errors.New("[SyncService.CallNeedContent] file contents is already existed")
@@ -1067,6 +2056,7 @@ func (ss *SyncService) CallNeedContent(file *types.File) error {
 		err = errors.New("[SyncService.CallNeedContent] open transaction: " + err.Error())
 		return err
 	}
+	transaction.Throttle(ss.clientThrottle(file.LatestEditClient))
 
 	needContentReq := &types.NeedContentReq{
 		UUID:                file.LatestEditClient,
@@ -1096,11 +2086,13 @@ func (ss *SyncService) CallNeedContent(file *types.File) error {
 	if fileMetadata == nil {
 		return errors.New("[SyncService.CallNeedContent] fileMetadata is nil")
 	}
-	if fileContent == nil {
+	// zero-byte file has nothing to read, so only contents of non-empty file are required
+	if fileContent == nil && fileMetadata.Size != 0 {
 		return errors.New("[SyncService.CallNeedContent] fileContent is nil")
 	}
 
-	// save file to history dir
+	// save file to history dir (hashing contents while they are received)
+	hasher := teeContentHasher(fileMetadata, &fileContent)
 	err = ss.syncDirAdapter.SaveFileToHistoryDir(file.AfterPath, file.LatestSyncTimestamp, fileMetadata, fileContent)
 	if err != nil {
 		err = errors.New("[SyncService.CallNeedContent] save file to historyDir: " + err.Error())
@@ -1120,6 +2112,12 @@ func (ss *SyncService) CallNeedContent(file *types.File) error {
 		return err
 	}
 
+	err = ss.updateContentHash(file, nil, hasher.Leaves())
+	if err != nil {
+		err = errors.New("[SyncService.CallNeedContent] update content hash: " + err.Error())
+		return err
+	}
+
 	// update file
 	file.ContentsExisted = true
 	err = ss.syncRepository.UpdateFile(file)
@@ -1158,7 +2156,23 @@ func (ss *SyncService) GetFileByPath(path string) (*types.File, error) {
 	return ss.syncRepository.GetFileByPath(path)
 }
 
+// GetFileHistory returns history of file of afterPath at version of timestamp
+func (ss *SyncService) GetFileHistory(afterPath string, timestamp uint64) (*types.FileHistory, error) {
+	return ss.historyRepository.GetFileHistory(afterPath, timestamp)
+}
+
+// RollbackFileByHistory makes version of history the new latest version of file
 func (ss *SyncService) RollbackFileByHistory(request *types.RollBackReq) (*types.RollBackRes, error) {
+	err := ss.checkWritable()
+	if err != nil {
+		return nil, err
+	}
+
+	rollBackRes, err := ss.rollbackFileByHistory(request)
+	return rollBackRes, ss.checkDiskFull(request.AfterPath, err)
+}
+
+func (ss *SyncService) rollbackFileByHistory(request *types.RollBackReq) (*types.RollBackRes, error) {
 	log.Println("quics: RollbackFileByHistory: ", request)
 	fileData, err := ss.syncRepository.GetFileByPath(request.AfterPath)
 	if err != nil {
@@ -1166,6 +2180,18 @@ func (ss *SyncService) RollbackFileByHistory(request *types.RollBackReq) (*types
 		return nil, err
 	}
 
+	rootDir, err := ss.syncRepository.GetRootDirByPath(fileData.RootDirKey)
+	if err != nil {
+		err = errors.New("[SyncService.RollbackFileByHistory] get rootDir data by path: " + err.Error())
+		return nil, err
+	}
+	if rootDir.AppendOnly {
+		return nil, errors.New("[SyncService.RollbackFileByHistory] root directory is append-only; existing file can not be modified: " + fileData.AfterPath)
+	}
+	if fileData.Lock.IsHeldByOther(request.UUID, time.Now()) {
+		return nil, errors.New("[SyncService.RollbackFileByHistory] file is locked by " + fileData.Lock.Holder + ": " + fileData.AfterPath)
+	}
+
 	historyData, err := ss.historyRepository.GetFileHistory(request.AfterPath, request.Version)
 	if err != nil {
 		err = errors.New("[SyncService.RollbackFileByHistory] get file history data by path: " + err.Error())
@@ -1173,13 +2199,15 @@ func (ss *SyncService) RollbackFileByHistory(request *types.RollBackReq) (*types
 	}
 
 	newHistoryData := &types.FileHistory{
-		Date:       time.Now().String(),
-		UUID:       request.UUID,
-		BeforePath: historyData.BeforePath,
-		AfterPath:  historyData.AfterPath,
-		Timestamp:  fileData.LatestSyncTimestamp + 1,
-		Hash:       historyData.Hash,
-		File:       historyData.File,
+		Date:        ss.serverDate().String(),
+		UUID:        request.UUID,
+		BeforePath:  historyData.BeforePath,
+		AfterPath:   historyData.AfterPath,
+		Timestamp:   fileData.LatestSyncTimestamp + 1,
+		Hash:        historyData.Hash,
+		ContentHash: historyData.ContentHash,
+		File:        historyData.File,
+		Encryption:  historyData.Encryption,
 	}
 	err = ss.historyRepository.SaveNewFileHistory(request.AfterPath, newHistoryData)
 	if err != nil {
@@ -1192,11 +2220,16 @@ func (ss *SyncService) RollbackFileByHistory(request *types.RollBackReq) (*types
 		AfterPath:           fileData.AfterPath,
 		RootDirKey:          fileData.RootDirKey,
 		LatestHash:          newHistoryData.Hash,
+		ContentHash:         newHistoryData.ContentHash,
 		LatestSyncTimestamp: newHistoryData.Timestamp,
 		LatestEditClient:    request.UUID,
 		ContentsExisted:     true,
 		NeedForceSync:       false,
+		Lock:                fileData.Lock,
+		NoHistory:           fileData.NoHistory,
 		Metadata:            newHistoryData.File,
+		CustomMetadata:      fileData.CustomMetadata,
+		Encryption:          newHistoryData.Encryption,
 	}
 	err = ss.syncRepository.SaveFileByPath(newFileData.AfterPath, newFileData)
 	if err != nil {
@@ -1228,13 +2261,16 @@ func (ss *SyncService) RollbackFileByHistory(request *types.RollBackReq) (*types
 		return nil, err
 	}
 
-	// call must sync
-	rootDir, err := ss.syncRepository.GetRootDirByPath(newFileData.RootDirKey)
+	err = ss.applyVersioningPolicy(newFileData)
 	if err != nil {
-		err = errors.New("[SyncService.RollbackFileByHistory] get rootDir data by path: " + err.Error())
-		return nil, err
+		err = errors.New("[SyncService.RollbackFileByHistory] apply versioning policy: " + err.Error())
+		log.Println("quics err: ", err)
 	}
 
+	ss.publishEvent(types.EventRollback, newFileData)
+
+	// call must sync
+
 	UUIDs := rootDir.UUIDs
 
 	err = ss.CallMustSync(newFileData.AfterPath, UUIDs)
@@ -1313,7 +2349,1455 @@ func (ss *SyncService) DownloadHistory(request *types.DownloadHistoryReq) (*type
 //                                  Private Logic
 // ********************************************************************************
 
-func validateGiveYouTransaction(file *types.File, giveYouRes *types.GiveYouRes) error {
+// publishEvent notifies change of file to event stream listeners
+func (ss *SyncService) publishEvent(eventType string, file *types.File) {
+	if ss.eventService == nil {
+		return
+	}
+
+	ss.eventService.Publish(&types.Event{
+		Type:      eventType,
+		AfterPath: file.AfterPath,
+		UUID:      file.LatestEditClient,
+		Timestamp: file.LatestSyncTimestamp,
+		Hash:      file.LatestHash,
+		Date:      time.Now().String(),
+	})
+}
+
+// isSubscribed checks whether the file is under subscription filters of client
+func (ss *SyncService) isSubscribed(uuid string, afterPath string) bool {
+	client, err := ss.registrationRepository.GetClientByUUID(uuid)
+	if err != nil {
+		// send changes when client information is not available
+		return true
+	}
+
+	return utils.IsSubscribedPath(client.Subscriptions, afterPath)
+}
+
+// UploadFile saves contents as the new latest version of afterPath on behalf of server (not any client),
+// and pushes it to clients of its root directory when the root directory is registered
+// expectedHash makes upload conditional: new version is saved only if latest hash of file is still expectedHash
+// ("*": only if the file exists, empty: unconditional)
+func (ss *SyncService) UploadFile(afterPath string, fileMetadata *types.FileMetadata, fileContent io.Reader, expectedHash string) (*types.File, error) {
+	err := ss.checkWritable()
+	if err != nil {
+		return nil, err
+	}
+	err = ss.checkPathLimits(afterPath)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := ss.uploadFile(afterPath, fileMetadata, fileContent, expectedHash)
+	return file, ss.checkDiskFull(afterPath, err)
+}
+
+func (ss *SyncService) uploadFile(afterPath string, fileMetadata *types.FileMetadata, fileContent io.Reader, expectedHash string) (*types.File, error) {
+	log.Println("quics: UploadFile: ", afterPath)
+	startedAt := time.Now()
+	endTransfer := ss.BeginTransfer()
+	defer endTransfer()
+
+	// contents are received fully before anything is committed, so that failed upload leaves nothing in the store
+	// and conditional upload does not hold the lock while slow client is sending
+	spool, err := utils.SpoolContents(fileContent, ss.uploadMemoryBuffer)
+	if err != nil {
+		err = errors.New("[SyncService.UploadFile] receive contents: " + err.Error())
+		return nil, err
+	}
+	defer spool.Close()
+	if spool.Size() != fileMetadata.Size {
+		return nil, errors.New("[SyncService.UploadFile] size of uploaded contents does not match")
+	}
+
+	// every upload is serialized with syncs of clients, so that no other version is saved between checking hash and saving new version
+	// (and no two of them take the same timestamp)
+	ss.uploadMut.Lock()
+	defer ss.uploadMut.Unlock()
+
+	file, rootDir, err := ss.prepareUpload(afterPath)
+	if err != nil {
+		return nil, err
+	}
+	if expectedHash != "" && !matchesHash(file.LatestHash, expectedHash) {
+		return nil, &HashMismatchError{AfterPath: afterPath, CurrentHash: file.LatestHash}
+	}
+
+	timestamp := file.LatestSyncTimestamp + 1
+	err = ss.syncDirAdapter.SaveFileToHistoryDir(afterPath, timestamp, fileMetadata, spool)
+	if err != nil {
+		err = errors.New("[SyncService.UploadFile] save file to historyDir: " + err.Error())
+		return nil, err
+	}
+
+	fileInfo, err := ss.syncDirAdapter.GetFileInfoFromHistoryDir(afterPath, timestamp)
+	if err != nil {
+		err = errors.New("[SyncService.UploadFile] get file info from historyDir: " + err.Error())
+		return nil, err
+	}
+	if fileInfo.Size != fileMetadata.Size {
+		ss.syncDirAdapter.DeleteFileFromHistoryDir(afterPath, timestamp)
+		return nil, errors.New("[SyncService.UploadFile] size of uploaded contents does not match")
+	}
+	ss.RecordTransfer(types.TransferUpload, "", afterPath, fileInfo.Size, startedAt)
+
+	file.LatestHash = utils.MakeHashFromFileMetadata(afterPath, fileInfo)
+	file.LatestSyncTimestamp = timestamp
+	file.LatestEditClient = ""
+	file.Metadata = *fileInfo
+	file.ContentsExisted = true
+	file.NeedForceSync = false
+
+	fileHistory := &types.FileHistory{
+		Date:       ss.serverDate().String(),
+		BeforePath: file.BeforePath,
+		AfterPath:  file.AfterPath,
+		Timestamp:  file.LatestSyncTimestamp,
+		Hash:       file.LatestHash,
+		File:       file.Metadata,
+	}
+	// history file is not referred by any data until history data is saved, so it is just deleted when saving fails (e.g., disk full)
+	err = ss.historyRepository.SaveNewFileHistory(fileHistory.AfterPath, fileHistory)
+	if err != nil {
+		ss.syncDirAdapter.DeleteFileFromHistoryDir(afterPath, timestamp)
+		err = errors.New("[SyncService.UploadFile] save new file history data: " + err.Error())
+		return nil, err
+	}
+
+	err = ss.updateContentHash(file, nil, nil)
+	if err != nil {
+		err = errors.New("[SyncService.UploadFile] update content hash: " + err.Error())
+		return nil, err
+	}
+
+	err = ss.syncRepository.SaveFileByPath(afterPath, file)
+	if err != nil {
+		err = errors.New("[SyncService.UploadFile] save file data: " + err.Error())
+		return nil, err
+	}
+
+	// latest directory is updated after the version is saved, so that it is not overwritten by version which failed to be saved
+	latestMetadata, latestContent, err := ss.syncDirAdapter.GetFileFromHistoryDir(afterPath, timestamp)
+	if err == nil {
+		err = ss.syncDirAdapter.SaveFileToLatestDir(afterPath, latestMetadata, latestContent)
+	}
+	if err != nil {
+		err = errors.New("[SyncService.UploadFile] save file to latestDir: " + err.Error())
+		log.Println("quics err: ", ss.checkDiskFull(afterPath, err))
+	}
+
+	ss.publishEvent(types.EventUpdate, file)
+
+	err = ss.applyVersioningPolicy(file)
+	if err != nil {
+		err = errors.New("[SyncService.UploadFile] apply versioning policy: " + err.Error())
+		log.Println("quics err: ", err)
+	}
+
+	if rootDir != nil {
+		err = ss.CallMustSync(afterPath, rootDir.UUIDs)
+		if err != nil {
+			err = errors.New("[SyncService.UploadFile] call mustsync: " + err.Error())
+			log.Println("quics err: ", err)
+		}
+	}
+
+	return file, nil
+}
+
+// OpenCommitSet opens new commit set, then files uploaded to it are staged until the set is committed
+func (ss *SyncService) OpenCommitSet(name string) (*types.CommitSet, error) {
+	id := make([]byte, 8)
+	_, err := rand.Read(id)
+	if err != nil {
+		err = errors.New("[SyncService.OpenCommitSet] make id: " + err.Error())
+		return nil, err
+	}
+
+	commitSet := &types.CommitSet{
+		ID:        hex.EncodeToString(id),
+		Name:      name,
+		Status:    types.CommitSetOpen,
+		CreatedAt: time.Now().Format(time.RFC3339),
+	}
+	err = ss.syncRepository.SaveCommitSet(commitSet)
+	if err != nil {
+		err = errors.New("[SyncService.OpenCommitSet] save commit set: " + err.Error())
+		return nil, err
+	}
+
+	return commitSet, nil
+}
+
+// StageCommitFile stages contents of afterPath in open commit set (contents staged before for the same path are replaced)
+// nothing is visible to clients until the set is committed
+func (ss *SyncService) StageCommitFile(id string, afterPath string, fileMetadata *types.FileMetadata, fileContent io.Reader) (*types.CommitSet, error) {
+	err := ss.checkWritable()
+	if err != nil {
+		return nil, err
+	}
+	err = ss.checkPathLimits(afterPath)
+	if err != nil {
+		return nil, err
+	}
+
+	commitSet, err := ss.stageCommitFile(id, afterPath, fileMetadata, fileContent)
+	return commitSet, ss.checkDiskFull(afterPath, err)
+}
+
+func (ss *SyncService) stageCommitFile(id string, afterPath string, fileMetadata *types.FileMetadata, fileContent io.Reader) (*types.CommitSet, error) {
+	ss.uploadMut.Lock()
+	defer ss.uploadMut.Unlock()
+
+	commitSet, err := ss.getOpenCommitSet(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// refuse the file as early as plain upload does, rather than when whole set is committed
+	_, _, err = ss.prepareUpload(afterPath)
+	if err != nil {
+		return nil, err
+	}
+
+	index := slices.IndexFunc(commitSet.Members, func(member types.CommitMember) bool {
+		return member.AfterPath == afterPath
+	})
+	if index < 0 {
+		index = len(commitSet.Members)
+		commitSet.Members = append(commitSet.Members, types.CommitMember{AfterPath: afterPath})
+	}
+
+	err = ss.syncDirAdapter.SaveFileToCommitDir(id, index, fileMetadata, fileContent)
+	if err != nil {
+		err = errors.New("[SyncService.StageCommitFile] save file to commitDir: " + err.Error())
+		return nil, err
+	}
+
+	stagedMetadata, stagedContent, err := ss.syncDirAdapter.GetFileFromCommitDir(id, index)
+	if err != nil {
+		err = errors.New("[SyncService.StageCommitFile] get file from commitDir: " + err.Error())
+		return nil, err
+	}
+	if closer, ok := stagedContent.(io.Closer); ok {
+		closer.Close()
+	}
+	if stagedMetadata.Size != fileMetadata.Size {
+		return nil, errors.New("[SyncService.StageCommitFile] size of uploaded contents does not match")
+	}
+	commitSet.Members[index].Size = stagedMetadata.Size
+
+	err = ss.syncRepository.SaveCommitSet(commitSet)
+	if err != nil {
+		err = errors.New("[SyncService.StageCommitFile] save commit set: " + err.Error())
+		return nil, err
+	}
+
+	return commitSet, nil
+}
+
+// CommitSet makes staged members of commit set the new latest versions of their files at once
+// every member is checked and saved to history directory first, then file and history data of all members are saved in one transaction,
+// so that either all new versions appear or none of them does
+func (ss *SyncService) CommitSet(id string) (*types.CommitSet, error) {
+	err := ss.checkWritable()
+	if err != nil {
+		return nil, err
+	}
+
+	commitSet, err := ss.commitSet(id)
+	return commitSet, ss.checkDiskFull("", err)
+}
+
+func (ss *SyncService) commitSet(id string) (*types.CommitSet, error) {
+	log.Println("quics: CommitSet: ", id)
+
+	ss.uploadMut.Lock()
+	defer ss.uploadMut.Unlock()
+
+	commitSet, err := ss.getOpenCommitSet(id)
+	if err != nil {
+		return nil, err
+	}
+	if len(commitSet.Members) == 0 {
+		return nil, errors.New("[SyncService.CommitSet] commit set has no file: " + id)
+	}
+
+	files := []*types.File{}
+	rootDirs := []*types.RootDirectory{}
+	fileHistories := []*types.FileHistory{}
+
+	// history files are not referred by any data until the transaction, so they are just deleted when commit fails
+	rollback := func() {
+		for _, fileHistory := range fileHistories {
+			ss.syncDirAdapter.DeleteFileFromHistoryDir(fileHistory.AfterPath, fileHistory.Timestamp)
+		}
+	}
+
+	date := ss.serverDate()
+	for i, member := range commitSet.Members {
+		file, rootDir, err := ss.prepareUpload(member.AfterPath)
+		if err != nil {
+			rollback()
+			return nil, err
+		}
+
+		fileHistory, err := ss.saveCommitMember(commitSet, i, file)
+		if err != nil {
+			rollback()
+			err = errors.New("[SyncService.CommitSet] save " + member.AfterPath + ": " + err.Error())
+			return nil, err
+		}
+		fileHistory.Date = date.String()
+
+		files = append(files, file)
+		rootDirs = append(rootDirs, rootDir)
+		fileHistories = append(fileHistories, fileHistory)
+		commitSet.Members[i].Timestamp = file.LatestSyncTimestamp
+	}
+
+	commitSet.Status = types.CommitSetCommitted
+	commitSet.CommittedAt = date.Format(time.RFC3339)
+	err = ss.syncRepository.CommitFiles(commitSet, files, fileHistories)
+	if err != nil {
+		rollback()
+		err = errors.New("[SyncService.CommitSet] commit files: " + err.Error())
+		return nil, err
+	}
+
+	for i, file := range files {
+		latestMetadata, latestContent, err := ss.syncDirAdapter.GetFileFromHistoryDir(file.AfterPath, file.LatestSyncTimestamp)
+		if err == nil {
+			err = ss.syncDirAdapter.SaveFileToLatestDir(file.AfterPath, latestMetadata, latestContent)
+		}
+		if err != nil {
+			err = errors.New("[SyncService.CommitSet] save file to latestDir: " + err.Error())
+			log.Println("quics err: ", err)
+		}
+
+		ss.publishEvent(types.EventUpdate, file)
+
+		err = ss.applyVersioningPolicy(file)
+		if err != nil {
+			err = errors.New("[SyncService.CommitSet] apply versioning policy: " + err.Error())
+			log.Println("quics err: ", err)
+		}
+
+		if rootDirs[i] != nil {
+			err = ss.CallMustSync(file.AfterPath, rootDirs[i].UUIDs)
+			if err != nil {
+				err = errors.New("[SyncService.CommitSet] call mustsync: " + err.Error())
+				log.Println("quics err: ", err)
+			}
+		}
+	}
+
+	err = ss.syncDirAdapter.DeleteCommitDir(id)
+	if err != nil {
+		err = errors.New("[SyncService.CommitSet] delete commitDir: " + err.Error())
+		log.Println("quics err: ", err)
+	}
+
+	return commitSet, nil
+}
+
+// AbortCommitSet discards open commit set and its staged files
+func (ss *SyncService) AbortCommitSet(id string) error {
+	ss.uploadMut.Lock()
+	defer ss.uploadMut.Unlock()
+
+	_, err := ss.getOpenCommitSet(id)
+	if err != nil {
+		return err
+	}
+
+	err = ss.syncDirAdapter.DeleteCommitDir(id)
+	if err != nil {
+		err = errors.New("[SyncService.AbortCommitSet] delete commitDir: " + err.Error())
+		return err
+	}
+
+	err = ss.syncRepository.DeleteCommitSet(id)
+	if err != nil {
+		err = errors.New("[SyncService.AbortCommitSet] delete commit set: " + err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func (ss *SyncService) GetCommitSet(id string) (*types.CommitSet, error) {
+	commitSet, err := ss.syncRepository.GetCommitSet(id)
+	if err == ss.syncRepository.ErrKeyNotFound() {
+		return nil, errors.New("[SyncService.GetCommitSet] commit set does not exist: " + id)
+	}
+	if err != nil {
+		err = errors.New("[SyncService.GetCommitSet] get commit set: " + err.Error())
+		return nil, err
+	}
+
+	return commitSet, nil
+}
+
+func (ss *SyncService) getOpenCommitSet(id string) (*types.CommitSet, error) {
+	commitSet, err := ss.GetCommitSet(id)
+	if err != nil {
+		return nil, err
+	}
+	if commitSet.Status != types.CommitSetOpen {
+		return nil, errors.New("[SyncService.getOpenCommitSet] commit set is already " + commitSet.Status + ": " + id)
+	}
+
+	return commitSet, nil
+}
+
+// saveCommitMember saves index-th staged member of commit set to history directory as the next version of file,
+// and updates file (not saved yet) to the version
+func (ss *SyncService) saveCommitMember(commitSet *types.CommitSet, index int, file *types.File) (*types.FileHistory, error) {
+	stagedMetadata, stagedContent, err := ss.syncDirAdapter.GetFileFromCommitDir(commitSet.ID, index)
+	if err != nil {
+		return nil, err
+	}
+	if closer, ok := stagedContent.(io.Closer); ok {
+		defer closer.Close()
+	}
+	stagedMetadata.Name = filepath.Base(file.AfterPath)
+
+	timestamp := file.LatestSyncTimestamp + 1
+	err = ss.syncDirAdapter.SaveFileToHistoryDir(file.AfterPath, timestamp, stagedMetadata, stagedContent)
+	if err != nil {
+		return nil, err
+	}
+
+	fileInfo, err := ss.syncDirAdapter.GetFileInfoFromHistoryDir(file.AfterPath, timestamp)
+	if err != nil {
+		return nil, err
+	}
+	if fileInfo.Size != commitSet.Members[index].Size {
+		ss.syncDirAdapter.DeleteFileFromHistoryDir(file.AfterPath, timestamp)
+		return nil, errors.New("size of staged contents does not match")
+	}
+
+	contentHash, err := ss.syncDirAdapter.GetContentHashFromHistoryDir(file.AfterPath, timestamp)
+	if err != nil {
+		ss.syncDirAdapter.DeleteFileFromHistoryDir(file.AfterPath, timestamp)
+		return nil, err
+	}
+
+	file.LatestHash = utils.MakeHashFromFileMetadata(file.AfterPath, fileInfo)
+	file.LatestSyncTimestamp = timestamp
+	file.LatestEditClient = ""
+	file.Metadata = *fileInfo
+	file.ContentsExisted = true
+	file.NeedForceSync = false
+	file.ContentHash = contentHash
+
+	return &types.FileHistory{
+		BeforePath:  file.BeforePath,
+		AfterPath:   file.AfterPath,
+		Timestamp:   file.LatestSyncTimestamp,
+		Hash:        file.LatestHash,
+		ContentHash: contentHash,
+		File:        file.Metadata,
+		CommitID:    commitSet.ID,
+	}, nil
+}
+
+// historyDate returns date of new history by timestamp source and time reported by client (clientTime) for reference
+// client source uses clientTime as date, unless client does not report it
+func (ss *SyncService) historyDate(clientTime time.Time) (string, string) {
+	if clientTime.IsZero() {
+		return ss.serverDate().String(), ""
+	}
+
+	clientDate := clientTime.String()
+	if ss.timestampSource == types.TimestampSourceClient {
+		return clientDate, clientDate
+	}
+	return ss.serverDate().String(), clientDate
+}
+
+// serverDate returns current time of server which is always later than the previous one,
+// so that order of histories is kept even if wall clock of server is set back
+func (ss *SyncService) serverDate() time.Time {
+	ss.dateMut.Lock()
+	defer ss.dateMut.Unlock()
+
+	// monotonic reading is stripped to compare wall clock, which is saved in history
+	now := time.Now()
+	if !now.Round(0).After(ss.lastDate.Round(0)) {
+		now = ss.lastDate.Add(time.Nanosecond)
+	}
+	ss.lastDate = now
+
+	return now
+}
+
+// LastHistoryDate returns the latest date of history stamped by server clock (zero if nothing is stamped yet)
+func (ss *SyncService) LastHistoryDate() time.Time {
+	ss.dateMut.Lock()
+	defer ss.dateMut.Unlock()
+
+	return ss.lastDate
+}
+
+// RestoreLastHistoryDate makes dates stamped by server clock later than date saved before restart,
+// so that they do not go backwards even if wall clock is set back while server is stopped
+func (ss *SyncService) RestoreLastHistoryDate(date time.Time) {
+	ss.dateMut.Lock()
+	defer ss.dateMut.Unlock()
+
+	if date.After(ss.lastDate.Round(0)) {
+		ss.lastDate = date
+	}
+}
+
+// matchesHash reports whether latestHash satisfies expectedHash of conditional upload ("*" matches any existing file)
+func matchesHash(latestHash string, expectedHash string) bool {
+	if expectedHash == "*" {
+		return latestHash != ""
+	}
+	return latestHash == expectedHash
+}
+
+// prepareUpload returns file data of afterPath (new one if it does not exist) and its root directory (nil if it is not registered),
+// and checks whether new version of the file can be uploaded
+func (ss *SyncService) prepareUpload(afterPath string) (*types.File, *types.RootDirectory, error) {
+	newFile := false
+	file, err := ss.syncRepository.GetFileByPath(afterPath)
+	if err == ss.syncRepository.ErrKeyNotFound() {
+		newFile = true
+		rootDirName, _ := utils.GetNamesByAfterPath(afterPath)
+		file = &types.File{
+			AfterPath:  afterPath,
+			RootDirKey: "/" + rootDirName,
+		}
+	} else if err != nil {
+		err = errors.New("[SyncService.prepareUpload] get file data by path: " + err.Error())
+		return nil, nil, err
+	}
+
+	// file can be uploaded out of registered root directories (e.g., by selftest), then it is not pushed to any client
+	rootDir, err := ss.syncRepository.GetRootDirByPath(file.RootDirKey)
+	if err == ss.syncRepository.ErrKeyNotFound() {
+		rootDir = nil
+	} else if err != nil {
+		err = errors.New("[SyncService.prepareUpload] get root directory data by path: " + err.Error())
+		return nil, nil, err
+	}
+
+	switch {
+	case rootDir != nil && rootDir.AppendOnly && !newFile && file.LatestHash != "":
+		return nil, nil, errors.New("[SyncService.prepareUpload] root directory is append-only; existing file can not be modified: " + afterPath)
+	case file.Lock.IsActive(time.Now()):
+		return nil, nil, errors.New("[SyncService.prepareUpload] file is locked by " + file.Lock.Holder + ": " + afterPath)
+	case !reflect.ValueOf(file.Conflict).IsZero():
+		return nil, nil, errors.New("[SyncService.prepareUpload] file is conflicted: " + afterPath)
+	case utils.ResolvePolicy(rootDir, ss.extensionPolicies, afterPath).Ignore:
+		return nil, nil, errors.New("[SyncService.prepareUpload] file is ignored by policy: " + afterPath)
+	}
+
+	// contents uploaded through server are plaintext
+	file.Encryption = types.Encryption{}
+
+	return file, rootDir, nil
+}
+
+// MoveFile renames file of fromAfterPath to toAfterPath keeping its histories, and records the move as new version
+// whose history has MovedFrom, then pushes the file to clients of destination root directory and its removal to clients of
+// source root directory, since fromAfterPath is left as removed file
+// existing destination is replaced only when overwrite is set (otherwise ErrFileExists is returned), and removed one is always replaced
+func (ss *SyncService) MoveFile(fromAfterPath string, toAfterPath string, overwrite bool) (*types.File, error) {
+	err := ss.checkWritable()
+	if err != nil {
+		return nil, err
+	}
+	err = ss.checkPathLimits(toAfterPath)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := ss.moveFile(fromAfterPath, toAfterPath, overwrite)
+	return file, ss.checkDiskFull(toAfterPath, err)
+}
+
+func (ss *SyncService) moveFile(fromAfterPath string, toAfterPath string, overwrite bool) (*types.File, error) {
+	log.Println("quics: MoveFile: ", fromAfterPath, " -> ", toAfterPath)
+
+	ss.uploadMut.Lock()
+	defer ss.uploadMut.Unlock()
+
+	file, err := ss.syncRepository.GetFileByPath(fromAfterPath)
+	if err != nil {
+		err = errors.New("[SyncService.MoveFile] get file data by path: " + err.Error())
+		return nil, err
+	}
+	fromRootDir, err := ss.syncRepository.GetRootDirByPath(file.RootDirKey)
+	if err != nil && err != ss.syncRepository.ErrKeyNotFound() {
+		err = errors.New("[SyncService.MoveFile] get root directory data by path: " + err.Error())
+		return nil, err
+	}
+
+	switch {
+	case fromRootDir != nil && fromRootDir.AppendOnly:
+		return nil, errors.New("[SyncService.MoveFile] root directory is append-only; existing file can not be moved: " + fromAfterPath)
+	case file.Lock.IsActive(time.Now()):
+		return nil, errors.New("[SyncService.MoveFile] file is locked by " + file.Lock.Holder + ": " + fromAfterPath)
+	case !reflect.ValueOf(file.Conflict).IsZero():
+		return nil, errors.New("[SyncService.MoveFile] file is conflicted: " + fromAfterPath)
+	case file.LatestHash == "":
+		return nil, errors.New("[SyncService.MoveFile] file is removed: " + fromAfterPath)
+	case !file.ContentsExisted:
+		return nil, errors.New("[SyncService.MoveFile] contents of file are not received yet: " + fromAfterPath)
+	}
+
+	// destination is resolved like upload (e.g., append-only, lock, conflict and ignore policy are checked)
+	to, toRootDir, err := ss.prepareUpload(toAfterPath)
+	if err != nil {
+		return nil, err
+	}
+	replace := to.LatestSyncTimestamp != 0
+	if replace && to.LatestHash != "" && !overwrite {
+		return nil, fmt.Errorf("%w: %s", ErrFileExists, toAfterPath)
+	}
+
+	timestamps, err := ss.getHistoryTimestamps(fromAfterPath)
+	if err != nil {
+		err = errors.New("[SyncService.MoveFile] get file histories: " + err.Error())
+		return nil, err
+	}
+
+	// contents of replaced destination are moved aside and deleted only after file data is moved,
+	// so that failed move leaves destination as it was
+	replacedAfterPath := toAfterPath + ".quics-replaced"
+	replacedTimestamps := []uint64{}
+	if replace {
+		replacedTimestamps, err = ss.getHistoryTimestamps(toAfterPath)
+		if err != nil {
+			err = errors.New("[SyncService.MoveFile] get file histories of destination: " + err.Error())
+			return nil, err
+		}
+		err = ss.syncDirAdapter.MoveFile(toAfterPath, replacedAfterPath, replacedTimestamps)
+		if err != nil {
+			err = errors.New("[SyncService.MoveFile] move contents of destination aside: " + err.Error())
+			return nil, err
+		}
+	}
+	restoreReplaced := func() {
+		if replace {
+			ss.rollbackMoveFile(toAfterPath, replacedAfterPath, replacedTimestamps)
+		}
+	}
+
+	err = ss.syncDirAdapter.MoveFile(fromAfterPath, toAfterPath, timestamps)
+	if err != nil {
+		err = errors.New("[SyncService.MoveFile] move contents: " + err.Error())
+		restoreReplaced()
+		return nil, err
+	}
+
+	// move is recorded as new version having the same contents, so that every history still has its contents
+	// it is newer than replaced destination too, so that clients of destination root directory take it
+	timestamp := max(file.LatestSyncTimestamp, to.LatestSyncTimestamp) + 1
+	latestMetadata, latestContent, err := ss.syncDirAdapter.GetFileFromLatestDir(toAfterPath)
+	if err == nil {
+		err = ss.syncDirAdapter.SaveFileToHistoryDir(toAfterPath, timestamp, latestMetadata, latestContent)
+	}
+	if err != nil {
+		err = errors.New("[SyncService.MoveFile] save moved version to historyDir: " + err.Error())
+		ss.rollbackMoveFile(fromAfterPath, toAfterPath, timestamps)
+		restoreReplaced()
+		return nil, err
+	}
+
+	// source is left as removed file (as removed by client), so that clients of source root directory remove it
+	removedTimestamp := file.LatestSyncTimestamp + 1
+	removedMetadata := file.Metadata
+	removedMetadata.Size = 0
+	err = ss.syncDirAdapter.SaveFileToHistoryDir(fromAfterPath, removedTimestamp, &removedMetadata, nil)
+	if err != nil {
+		err = errors.New("[SyncService.MoveFile] save removed version to historyDir: " + err.Error())
+		ss.syncDirAdapter.DeleteFileFromHistoryDir(toAfterPath, timestamp)
+		ss.rollbackMoveFile(fromAfterPath, toAfterPath, timestamps)
+		restoreReplaced()
+		return nil, err
+	}
+
+	date := ss.serverDate().String()
+	movedHistory := &types.FileHistory{
+		Date:        date,
+		BeforePath:  file.BeforePath,
+		AfterPath:   toAfterPath,
+		Timestamp:   timestamp,
+		Hash:        file.LatestHash,
+		ContentHash: file.ContentHash,
+		File:        file.Metadata,
+		Encryption:  file.Encryption,
+		MovedFrom:   fromAfterPath,
+	}
+	removed := &types.File{
+		BeforePath:          file.BeforePath,
+		AfterPath:           fromAfterPath,
+		RootDirKey:          file.RootDirKey,
+		LatestSyncTimestamp: removedTimestamp,
+		ContentsExisted:     true,
+		Metadata:            removedMetadata,
+	}
+	removedHistory := &types.FileHistory{
+		Date:       date,
+		BeforePath: file.BeforePath,
+		AfterPath:  fromAfterPath,
+		Timestamp:  removedTimestamp,
+		File:       removedMetadata,
+	}
+
+	file.AfterPath = toAfterPath
+	file.RootDirKey = to.RootDirKey
+	file.LatestSyncTimestamp = timestamp
+	file.NeedForceSync = false
+	file.Lock = types.FileLock{}
+
+	err = ss.syncRepository.MoveFile(removed, removedHistory, file, movedHistory, replace)
+	if err != nil {
+		err = errors.New("[SyncService.MoveFile] move file data: " + err.Error())
+		ss.syncDirAdapter.DeleteFileFromHistoryDir(fromAfterPath, removedTimestamp)
+		ss.syncDirAdapter.DeleteFileFromHistoryDir(toAfterPath, timestamp)
+		ss.rollbackMoveFile(fromAfterPath, toAfterPath, timestamps)
+		restoreReplaced()
+		return nil, err
+	}
+
+	// file data is moved, so contents of replaced destination are not referred anymore
+	if replace {
+		ss.deleteReplacedContents(replacedAfterPath, replacedTimestamps)
+	}
+
+	// policy of destination decides histories which moved file keeps
+	err = ss.applyVersioningPolicy(file)
+	if err != nil {
+		err = errors.New("[SyncService.MoveFile] apply versioning policy: " + err.Error())
+		log.Println("quics err: ", err)
+	}
+
+	ss.publishEvent(types.EventRemove, removed)
+	ss.publishEvent(types.EventUpdate, file)
+
+	if fromRootDir != nil {
+		err = ss.CallMustSync(fromAfterPath, fromRootDir.UUIDs)
+		if err != nil {
+			err = errors.New("[SyncService.MoveFile] call mustsync of removed file: " + err.Error())
+			log.Println("quics err: ", err)
+		}
+	}
+	if toRootDir != nil {
+		err = ss.CallMustSync(toAfterPath, toRootDir.UUIDs)
+		if err != nil {
+			err = errors.New("[SyncService.MoveFile] call mustsync: " + err.Error())
+			log.Println("quics err: ", err)
+		}
+	}
+
+	return file, nil
+}
+
+// getHistoryTimestamps returns timestamps of every history of the file of afterPath
+func (ss *SyncService) getHistoryTimestamps(afterPath string) ([]uint64, error) {
+	fileHistories, err := ss.historyRepository.GetFileHistoriesForClient(afterPath, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	timestamps := []uint64{}
+	for _, fileHistory := range fileHistories {
+		// prefix can also match other file (e.g., /root/a and /root/a_b)
+		if fileHistory.AfterPath == afterPath {
+			timestamps = append(timestamps, fileHistory.Timestamp)
+		}
+	}
+
+	return timestamps, nil
+}
+
+// rollbackMoveFile restores contents moved by MoveFile when its data can not be moved
+func (ss *SyncService) rollbackMoveFile(fromAfterPath string, toAfterPath string, timestamps []uint64) {
+	err := ss.syncDirAdapter.MoveFile(toAfterPath, fromAfterPath, timestamps)
+	if err != nil {
+		err = errors.New("[SyncService.rollbackMoveFile] restore contents: " + err.Error())
+		log.Println("quics err: ", err)
+	}
+}
+
+// deleteReplacedContents deletes contents of destination replaced by MoveFile, which are moved aside to afterPath
+// contents left by failure are only logged, since file data is already moved
+func (ss *SyncService) deleteReplacedContents(afterPath string, timestamps []uint64) {
+	for _, timestamp := range timestamps {
+		err := ss.syncDirAdapter.DeleteFileFromHistoryDir(afterPath, timestamp)
+		if err != nil && !os.IsNotExist(err) {
+			err = errors.New("[SyncService.deleteReplacedContents] delete file from historyDir: " + err.Error())
+			log.Println("quics err: ", err)
+		}
+	}
+
+	err := ss.syncDirAdapter.DeleteFileFromLatestDir(afterPath)
+	if err != nil && !os.IsNotExist(err) {
+		err = errors.New("[SyncService.deleteReplacedContents] delete file from latestDir: " + err.Error())
+		log.Println("quics err: ", err)
+	}
+}
+
+// DeleteFileContents deletes stored contents (latest, histories and conflicts) and history data of the file
+// file data itself is kept, so that caller decides when to remove it
+func (ss *SyncService) DeleteFileContents(afterPath string) error {
+	timestamps, err := ss.historyRepository.DeleteFileHistoriesBefore(afterPath, math.MaxUint64)
+	if err != nil {
+		err = errors.New("[SyncService.DeleteFileContents] delete file histories: " + err.Error())
+		return err
+	}
+	for _, timestamp := range timestamps {
+		err = ss.syncDirAdapter.DeleteFileFromHistoryDir(afterPath, timestamp)
+		if err != nil {
+			err = errors.New("[SyncService.DeleteFileContents] delete file from historyDir: " + err.Error())
+			return err
+		}
+	}
+
+	err = ss.syncDirAdapter.DeleteFileFromLatestDir(afterPath)
+	if err != nil {
+		err = errors.New("[SyncService.DeleteFileContents] delete file from latestDir: " + err.Error())
+		return err
+	}
+
+	_, err = ss.syncRepository.GetConflict(afterPath)
+	if err == nil {
+		err = ss.syncDirAdapter.DeleteFilesFromConflictDir(afterPath)
+		if err != nil && !os.IsNotExist(err) {
+			err = errors.New("[SyncService.DeleteFileContents] delete files from conflictDir: " + err.Error())
+			return err
+		}
+		err = ss.syncRepository.DeleteConflict(afterPath)
+		if err != nil {
+			err = errors.New("[SyncService.DeleteFileContents] delete conflict data: " + err.Error())
+			return err
+		}
+	}
+
+	return nil
+}
+
+// queuePendingChange stores change of afterPath for offline client
+func (ss *SyncService) queuePendingChange(uuid string, afterPath string) {
+	log.Println("quics: ", uuid, " is offline; queue change of ", afterPath)
+
+	err := ss.syncRepository.AddPendingChange(uuid, afterPath, MaxPendingChanges)
+	if err != nil {
+		err = errors.New("[SyncService.queuePendingChange] add pending change: " + err.Error())
+		log.Println("quics err: ", err)
+	}
+}
+
+// LockFile acquires (or renews) advisory lock of the file for the client during ttl
+func (ss *SyncService) LockFile(afterPath string, uuid string, ttl time.Duration) (*types.FileLock, error) {
+	log.Println("quics: LockFile: ", afterPath, uuid, ttl)
+	if ttl <= 0 {
+		return nil, errors.New("[SyncService.LockFile] ttl must be positive")
+	}
+
+	_, err := ss.registrationRepository.GetClientByUUID(uuid)
+	if err != nil {
+		err = errors.New("[SyncService.LockFile] get client data by uuid: " + err.Error())
+		return nil, err
+	}
+
+	file, err := ss.syncRepository.GetFileByPath(afterPath)
+	if err != nil {
+		err = errors.New("[SyncService.LockFile] get file data by path: " + err.Error())
+		return nil, err
+	}
+
+	now := time.Now()
+	if file.Lock.IsHeldByOther(uuid, now) {
+		return nil, errors.New("[SyncService.LockFile] file is already locked by " + file.Lock.Holder + " until " + file.Lock.ExpiresAt.String())
+	}
+
+	// renewal by the holder keeps when the lock was acquired
+	acquiredAt := now
+	if file.Lock.IsActive(now) && !file.Lock.AcquiredAt.IsZero() {
+		acquiredAt = file.Lock.AcquiredAt
+	}
+
+	file.Lock = types.FileLock{
+		Holder:     uuid,
+		AcquiredAt: acquiredAt,
+		ExpiresAt:  now.Add(ttl),
+	}
+	err = ss.syncRepository.UpdateFile(file)
+	if err != nil {
+		err = errors.New("[SyncService.LockFile] update file data: " + err.Error())
+		return nil, err
+	}
+
+	return &file.Lock, nil
+}
+
+// TagFile sets tags of set and removes tags of unset keys of the file
+// tags are validated, and the file can not have more than utils.MaxTags tags
+func (ss *SyncService) TagFile(afterPath string, set map[string]string, unset []string) (*types.File, error) {
+	log.Println("quics: TagFile: ", afterPath, set, unset)
+	for key, value := range set {
+		err := utils.ValidateTag(key, value)
+		if err != nil {
+			return nil, errors.New("[SyncService.TagFile] " + err.Error())
+		}
+	}
+
+	file, err := ss.syncRepository.GetFileByPath(afterPath)
+	if err != nil {
+		err = errors.New("[SyncService.TagFile] get file data by path: " + err.Error())
+		return nil, err
+	}
+
+	file.Tags, _, err = utils.ApplyTags(file.Tags, set, unset)
+	if err != nil {
+		return nil, errors.New("[SyncService.TagFile] " + err.Error() + ": " + afterPath)
+	}
+
+	err = ss.syncRepository.UpdateFile(file)
+	if err != nil {
+		err = errors.New("[SyncService.TagFile] update file data: " + err.Error())
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// SetFileNoHistory sets whether only the latest history of the file is kept
+// older histories are removed at once when it is turned on, and file keeps syncing as before
+func (ss *SyncService) SetFileNoHistory(afterPath string, noHistory bool) (*types.File, error) {
+	log.Println("quics: SetFileNoHistory: ", afterPath, noHistory)
+
+	file, err := ss.syncRepository.GetFileByPath(afterPath)
+	if err != nil {
+		err = errors.New("[SyncService.SetFileNoHistory] get file data by path: " + err.Error())
+		return nil, err
+	}
+
+	file.NoHistory = noHistory
+	err = ss.syncRepository.UpdateFile(file)
+	if err != nil {
+		err = errors.New("[SyncService.SetFileNoHistory] update file data: " + err.Error())
+		return nil, err
+	}
+
+	if noHistory {
+		err = ss.applyVersioningPolicy(file)
+		if err != nil {
+			err = errors.New("[SyncService.SetFileNoHistory] apply versioning policy: " + err.Error())
+			return nil, err
+		}
+	}
+
+	return file, nil
+}
+
+// SetFileMetadata replaces custom metadata of the file (nil clears it)
+// metadata must be compact JSON object validated by utils.ParseFileMetadata
+func (ss *SyncService) SetFileMetadata(afterPath string, metadata json.RawMessage) (*types.File, error) {
+	log.Println("quics: SetFileMetadata: ", afterPath, string(metadata))
+	if len(metadata) > utils.MaxFileMetadataSize {
+		return nil, fmt.Errorf("[SyncService.SetFileMetadata] metadata is larger than %d bytes: %s", utils.MaxFileMetadataSize, afterPath)
+	}
+
+	file, err := ss.syncRepository.GetFileByPath(afterPath)
+	if err != nil {
+		err = errors.New("[SyncService.SetFileMetadata] get file data by path: " + err.Error())
+		return nil, err
+	}
+
+	file.CustomMetadata = metadata
+	err = ss.syncRepository.UpdateFile(file)
+	if err != nil {
+		err = errors.New("[SyncService.SetFileMetadata] update file data: " + err.Error())
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// UnlockFile releases advisory lock of the file (expired lock can be released by anyone)
+func (ss *SyncService) UnlockFile(afterPath string, uuid string) error {
+	log.Println("quics: UnlockFile: ", afterPath, uuid)
+	file, err := ss.syncRepository.GetFileByPath(afterPath)
+	if err != nil {
+		err = errors.New("[SyncService.UnlockFile] get file data by path: " + err.Error())
+		return err
+	}
+
+	if file.Lock.IsHeldByOther(uuid, time.Now()) {
+		return errors.New("[SyncService.UnlockFile] file is locked by " + file.Lock.Holder)
+	}
+
+	file.Lock = types.FileLock{}
+	err = ss.syncRepository.UpdateFile(file)
+	if err != nil {
+		err = errors.New("[SyncService.UnlockFile] update file data: " + err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// ListLocks returns active locks of files under afterPath (every lock when it is empty) ordered by AfterPath
+func (ss *SyncService) ListLocks(afterPath string) ([]types.LockInfo, error) {
+	files, err := ss.syncRepository.GetAllFiles(afterPath)
+	if err != nil {
+		err = errors.New("[SyncService.ListLocks] get all files: " + err.Error())
+		return nil, err
+	}
+
+	now := time.Now()
+	locks := []types.LockInfo{}
+	for _, file := range files {
+		// file keys are prefixed by after path, so /root also scans /root2 which is filtered out here
+		if afterPath != "" && !utils.IsUnderPath(afterPath, file.AfterPath) {
+			continue
+		}
+		if !file.Lock.IsActive(now) {
+			continue
+		}
+
+		locks = append(locks, types.LockInfo{
+			AfterPath:  file.AfterPath,
+			Holder:     file.Lock.Holder,
+			AcquiredAt: file.Lock.AcquiredAt,
+			ExpiresAt:  file.Lock.ExpiresAt,
+		})
+	}
+
+	return locks, nil
+}
+
+// BreakLock releases active lock of the file regardless of its holder (e.g., client crashed while holding it)
+// the holder is told by EventLockBroken with reason, so that it does not keep editing as if it still held the lock
+func (ss *SyncService) BreakLock(afterPath string, reason string) (*types.BreakLockRes, error) {
+	log.Println("quics: BreakLock: ", afterPath, reason)
+	if strings.TrimSpace(reason) == "" {
+		return nil, errors.New("[SyncService.BreakLock] reason is required")
+	}
+
+	file, err := ss.syncRepository.GetFileByPath(afterPath)
+	if err != nil {
+		err = errors.New("[SyncService.BreakLock] get file data by path: " + err.Error())
+		return nil, err
+	}
+
+	now := time.Now()
+	if !file.Lock.IsActive(now) {
+		return nil, errors.New("[SyncService.BreakLock] file is not locked: " + afterPath)
+	}
+
+	breakLockRes := &types.BreakLockRes{
+		Lock: types.LockInfo{
+			AfterPath:  file.AfterPath,
+			Holder:     file.Lock.Holder,
+			AcquiredAt: file.Lock.AcquiredAt,
+			ExpiresAt:  file.Lock.ExpiresAt,
+		},
+		Reason:   reason,
+		BrokenAt: now,
+	}
+
+	file.Lock = types.FileLock{}
+	err = ss.syncRepository.UpdateFile(file)
+	if err != nil {
+		err = errors.New("[SyncService.BreakLock] update file data: " + err.Error())
+		return nil, err
+	}
+
+	if ss.eventService != nil {
+		ss.eventService.Publish(&types.Event{
+			Type:      types.EventLockBroken,
+			AfterPath: file.AfterPath,
+			UUID:      breakLockRes.Lock.Holder,
+			Timestamp: file.LatestSyncTimestamp,
+			Hash:      file.LatestHash,
+			Date:      now.String(),
+			Reason:    reason,
+		})
+	}
+
+	return breakLockRes, nil
+}
+
+// ResolvePolicy returns sync behaviors of afterPath resolved from its root directory and extension defaults
+func (ss *SyncService) ResolvePolicy(afterPath string) (*types.EffectivePolicy, error) {
+	if !strings.HasPrefix(afterPath, "/") || len(strings.Split(afterPath, "/")) < 3 {
+		return nil, errors.New("[SyncService.ResolvePolicy] path must be /{root directory}/{file}: " + afterPath)
+	}
+
+	rootDirName, _ := utils.GetNamesByAfterPath(afterPath)
+	rootDir, err := ss.syncRepository.GetRootDirByPath("/" + rootDirName)
+	if err == ss.syncRepository.ErrKeyNotFound() {
+		rootDir = nil
+	} else if err != nil {
+		err = errors.New("[SyncService.ResolvePolicy] get root directory data by path: " + err.Error())
+		return nil, err
+	}
+
+	file, err := ss.syncRepository.GetFileByPath(afterPath)
+	if err == ss.syncRepository.ErrKeyNotFound() {
+		return utils.ResolvePolicy(rootDir, ss.extensionPolicies, afterPath), nil
+	} else if err != nil {
+		err = errors.New("[SyncService.ResolvePolicy] get file data by path: " + err.Error())
+		return nil, err
+	}
+
+	return utils.ResolveFilePolicy(rootDir, ss.extensionPolicies, file), nil
+}
+
+// applyVersioningPolicy removes older histories of the file when the file or its root directory keeps only latest version of it
+func (ss *SyncService) applyVersioningPolicy(file *types.File) error {
+	rootDir, err := ss.syncRepository.GetRootDirByPath(file.RootDirKey)
+	if err == ss.syncRepository.ErrKeyNotFound() {
+		rootDir = nil
+	} else if err != nil {
+		return err
+	}
+
+	if utils.ResolveFilePolicy(rootDir, ss.extensionPolicies, file).Versioning != types.VersioningLatest {
+		return nil
+	}
+
+	timestamps, err := ss.historyRepository.DeleteFileHistoriesBefore(file.AfterPath, file.LatestSyncTimestamp)
+	if err != nil {
+		return err
+	}
+
+	for _, timestamp := range timestamps {
+		err = ss.syncDirAdapter.DeleteFileFromHistoryDir(file.AfterPath, timestamp)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// updateContentHash sets merkle root of latest contents to file and its history
+// leaves hashed while contents were received are used as they are; otherwise stored contents are hashed,
+// and when latest contents are appended to appendBase, only its last partial chunk and appended bytes are hashed
+// (every chunk is hashed again when hashes of chunks of appendBase are not kept, e.g., version saved before they were kept)
+func (ss *SyncService) updateContentHash(file *types.File, appendBase *types.FileHistory, leaves [][]byte) error {
+	var err error
+	if leaves == nil && appendBase != nil && len(appendBase.ContentLeaves) != 0 {
+		leaves, err = ss.syncDirAdapter.ExtendContentLeavesFromHistoryDir(file.AfterPath, file.LatestSyncTimestamp, appendBase.ContentLeaves, appendBase.File.Size)
+		if err != nil {
+			log.Println("quics alert: [SyncService.updateContentHash] hash whole contents of ", file.AfterPath, " instead of appended bytes: ", err)
+			leaves = nil
+		}
+	}
+	if leaves == nil {
+		leaves, err = ss.syncDirAdapter.GetContentLeavesFromHistoryDir(file.AfterPath, file.LatestSyncTimestamp)
+		if err != nil {
+			return err
+		}
+	}
+	contentHash := utils.MakeContentHashFromLeaves(leaves)
+	file.ContentHash = contentHash
+
+	fileHistory, err := ss.historyRepository.GetFileHistory(file.AfterPath, file.LatestSyncTimestamp)
+	if err != nil {
+		// history can be absent (e.g., version saved before it was recorded as history), so only file is updated
+		return nil
+	}
+	fileHistory.ContentHash = contentHash
+	fileHistory.ContentLeaves = leaves
+	fileHistory.Encryption = file.Encryption
+
+	return ss.historyRepository.SaveNewFileHistory(fileHistory.AfterPath, fileHistory)
+}
+
+// teeContentHasher makes contents hashed while they are read from fileContent (nil when there are no contents to hash)
+func teeContentHasher(fileMetadata *types.FileMetadata, fileContent *io.Reader) *utils.ContentHasher {
+	if fileMetadata.IsDir || *fileContent == nil {
+		return nil
+	}
+
+	hasher := utils.NewContentHasher()
+	*fileContent = io.TeeReader(*fileContent, hasher)
+	return hasher
+}
+
+// openAppendBase opens stored contents of version which contents of pleaseTakeReq are appended to
+// base must be the version offered by PleaseSyncRes with the same hash, so that joined contents are a true append of it;
+// otherwise client has to send whole contents again
+func (ss *SyncService) openAppendBase(pleaseTakeReq *types.PleaseTakeReq) (*types.FileHistory, io.Reader, error) {
+	appendBase, err := ss.historyRepository.GetFileHistory(pleaseTakeReq.AfterPath, pleaseTakeReq.AppendBaseTimestamp)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: version %d is not recorded", ErrAppendBaseMismatch, pleaseTakeReq.AppendBaseTimestamp)
+	}
+	if appendBase.Hash != pleaseTakeReq.AppendBaseHash || appendBase.File.IsDir {
+		return nil, nil, fmt.Errorf("%w: version %d has different hash", ErrAppendBaseMismatch, pleaseTakeReq.AppendBaseTimestamp)
+	}
+	if appendBase.Encryption.IsEncrypted() || pleaseTakeReq.Encryption.IsEncrypted() {
+		return nil, nil, fmt.Errorf("%w: encrypted contents can not be appended", ErrAppendBaseMismatch)
+	}
+
+	_, baseContent, err := ss.OpenHistoryContents(pleaseTakeReq.AfterPath, pleaseTakeReq.AppendBaseTimestamp)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %s", ErrAppendBaseMismatch, err.Error())
+	}
+
+	return appendBase, baseContent, nil
+}
+
+// OpenHistoryContents opens stored contents of file of afterPath at version of timestamp
+// when history of the version is recorded but its contents are missing or differ in size from the record, ErrContentMissing is returned,
+// the file is marked to be uploaded again (if it is the latest version) and EventContentMissing is published
+func (ss *SyncService) OpenHistoryContents(afterPath string, timestamp uint64) (*types.FileMetadata, io.Reader, error) {
+	fileInfo, fileContent, err := ss.syncDirAdapter.GetFileFromHistoryDir(afterPath, timestamp)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+
+	fileHistory, historyErr := ss.historyRepository.GetFileHistory(afterPath, timestamp)
+	if historyErr != nil {
+		// version is neither recorded nor stored, so it is reported with versions which can be downloaded instead
+		if err != nil {
+			return nil, nil, ss.versionNotFound(afterPath, timestamp)
+		}
+		return fileInfo, fileContent, nil
+	}
+	if err == nil && (fileHistory.File.IsDir || fileInfo.Size == fileHistory.File.Size) {
+		return fileInfo, fileContent, nil
+	}
+	if closer, ok := fileContent.(io.Closer); ok && err == nil {
+		closer.Close()
+	}
+
+	log.Println("quics alert: [SyncService.OpenHistoryContents] contents of ", afterPath, " (timestamp: ", timestamp, ") are missing")
+	ss.markContentMissing(afterPath, timestamp, fileHistory.Hash)
+
+	return nil, nil, fmt.Errorf("%w: stored contents of %s (timestamp: %d) are missing", ErrContentMissing, afterPath, timestamp)
+}
+
+// GetFileDigest returns content hash and size of file of afterPath at version of timestamp without reading its contents
+// content hash is read from stored contents only when it is not recorded (e.g., version saved before content hashes)
+func (ss *SyncService) GetFileDigest(afterPath string, timestamp uint64, chunks bool) (*types.FileDigestRes, error) {
+	fileHistory, err := ss.historyRepository.GetFileHistory(afterPath, timestamp)
+	if err != nil {
+		// contents can be stored without history record, as OpenHistoryContents serves them
+		fileInfo, fileContent, err := ss.syncDirAdapter.GetFileFromHistoryDir(afterPath, timestamp)
+		if err != nil {
+			return nil, ss.versionNotFound(afterPath, timestamp)
+		}
+		if closer, ok := fileContent.(io.Closer); ok {
+			closer.Close()
+		}
+		fileHistory = &types.FileHistory{AfterPath: afterPath, Timestamp: timestamp, File: *fileInfo}
+	}
+	if fileHistory.File.IsDir {
+		return nil, errors.New("[SyncService.GetFileDigest] version is directory: " + afterPath)
+	}
+
+	contentHash := fileHistory.ContentHash
+	if contentHash == "" {
+		contentHash, err = ss.syncDirAdapter.GetContentHashFromHistoryDir(afterPath, timestamp)
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: stored contents of %s (timestamp: %d) are missing", ErrContentMissing, afterPath, timestamp)
+		}
+		if err != nil {
+			return nil, errors.New("[SyncService.GetFileDigest] hash stored contents: " + err.Error())
+		}
+	}
+
+	digest := &types.FileDigestRes{
+		AfterPath:   afterPath,
+		Timestamp:   timestamp,
+		ContentHash: contentHash,
+		Size:        fileHistory.File.Size,
+		Encryption:  fileHistory.Encryption,
+	}
+	if !chunks {
+		return digest, nil
+	}
+
+	// hashes of chunks are recorded with version, and made from stored contents for version recorded without them
+	leaves := fileHistory.ContentLeaves
+	if len(leaves) == 0 && fileHistory.File.Size > 0 {
+		leaves, err = ss.syncDirAdapter.GetContentLeavesFromHistoryDir(afterPath, timestamp)
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: stored contents of %s (timestamp: %d) are missing", ErrContentMissing, afterPath, timestamp)
+		}
+		if err != nil {
+			return nil, errors.New("[SyncService.GetFileDigest] hash chunks of stored contents: " + err.Error())
+		}
+	}
+
+	digest.ChunkSize = utils.HashChunkSize
+	digest.ChunkHashes = []string{}
+	for _, leaf := range leaves {
+		digest.ChunkHashes = append(digest.ChunkHashes, hex.EncodeToString(leaf))
+	}
+	return digest, nil
+}
+
+// ResolveVersion resolves version of file of afterPath selected by selector to its timestamp
+// ordinal counts recorded versions ordered by timestamp from 1, so that it shifts when old versions are pruned (e.g., latest versioning)
+// timestamp is returned as it is even when it is not recorded, as contents can be stored without history record
+func (ss *SyncService) ResolveVersion(afterPath string, selector *types.VersionSelector) (*types.VersionRes, error) {
+	err := selector.Validate()
+	if err != nil {
+		return nil, errors.New("[SyncService.ResolveVersion] " + err.Error())
+	}
+
+	fileHistories, err := ss.historyRepository.GetFileHistoriesForClient(afterPath, 0)
+	if err != nil {
+		return nil, errors.New("[SyncService.ResolveVersion] get file histories: " + err.Error())
+	}
+
+	timestamps := []uint64{}
+	for _, fileHistory := range fileHistories {
+		// prefix can also match other file (e.g., /root/a and /root/a_b)
+		if fileHistory.AfterPath == afterPath {
+			timestamps = append(timestamps, fileHistory.Timestamp)
+		}
+	}
+	sort.Slice(timestamps, func(i, j int) bool {
+		return timestamps[i] < timestamps[j]
+	})
+
+	versionRes := &types.VersionRes{
+		AfterPath: afterPath,
+		Versions:  len(timestamps),
+	}
+	switch selector.Kind {
+	case types.VersionByOrdinal:
+		if selector.Value > uint64(len(timestamps)) {
+			return nil, fmt.Errorf("%w: version %d of %s does not exist (file has %d versions)", ErrVersionNotFound, selector.Value, afterPath, len(timestamps))
+		}
+		versionRes.Version = int(selector.Value)
+		versionRes.Timestamp = timestamps[selector.Value-1]
+	case types.VersionByTimestamp:
+		versionRes.Timestamp = selector.Value
+		for i, timestamp := range timestamps {
+			if timestamp == selector.Value {
+				versionRes.Version = i + 1
+			}
+		}
+	case types.VersionLatest:
+		if len(timestamps) == 0 {
+			return nil, fmt.Errorf("%w: latest version of %s does not exist (file has no versions)", ErrVersionNotFound, afterPath)
+		}
+		versionRes.Version = len(timestamps)
+		versionRes.Timestamp = timestamps[len(timestamps)-1]
+	}
+
+	return versionRes, nil
+}
+
+// versionNotFound returns ErrVersionNotFound listing up to NearestVersionCount versions of file closest to timestamp
+func (ss *SyncService) versionNotFound(afterPath string, timestamp uint64) error {
+	fileHistories, err := ss.historyRepository.GetFileHistoriesForClient(afterPath, 0)
+	if err != nil {
+		err = errors.New("[SyncService.versionNotFound] get file histories: " + err.Error())
+		log.Println("quics err: ", err)
+	}
+
+	timestamps := []uint64{}
+	for _, fileHistory := range fileHistories {
+		// prefix can also match other file (e.g., /root/a and /root/a_b)
+		if fileHistory.AfterPath == afterPath {
+			timestamps = append(timestamps, fileHistory.Timestamp)
+		}
+	}
+	if len(timestamps) == 0 {
+		return fmt.Errorf("%w: version %d of %s does not exist (file has no versions)", ErrVersionNotFound, timestamp, afterPath)
+	}
+
+	distance := func(t uint64) uint64 {
+		if t > timestamp {
+			return t - timestamp
+		}
+		return timestamp - t
+	}
+	sort.Slice(timestamps, func(i, j int) bool {
+		if distance(timestamps[i]) != distance(timestamps[j]) {
+			return distance(timestamps[i]) < distance(timestamps[j])
+		}
+		return timestamps[i] < timestamps[j]
+	})
+	if len(timestamps) > NearestVersionCount {
+		timestamps = timestamps[:NearestVersionCount]
+	}
+	sort.Slice(timestamps, func(i, j int) bool {
+		return timestamps[i] < timestamps[j]
+	})
+
+	nearest := make([]string, 0, len(timestamps))
+	for _, t := range timestamps {
+		nearest = append(nearest, strconv.FormatUint(t, 10))
+	}
+	return fmt.Errorf("%w: version %d of %s does not exist (nearest versions: %s)", ErrVersionNotFound, timestamp, afterPath, strings.Join(nearest, ", "))
+}
+
+// markContentMissing marks the file to be uploaded again when missing contents are of its latest version (as scrub does), and notifies it
+func (ss *SyncService) markContentMissing(afterPath string, timestamp uint64, hash string) {
+	file, err := ss.syncRepository.GetFileByPath(afterPath)
+	if err == nil && file.LatestSyncTimestamp == timestamp && file.ContentsExisted {
+		file.ContentsExisted = false
+		err = ss.syncRepository.UpdateFile(file)
+		if err != nil {
+			err = errors.New("[SyncService.markContentMissing] update file data: " + err.Error())
+			log.Println("quics err: ", err)
+		}
+	}
+
+	if ss.eventService == nil {
+		return
+	}
+	ss.eventService.Publish(&types.Event{
+		Type:      types.EventContentMissing,
+		AfterPath: afterPath,
+		Timestamp: timestamp,
+		Hash:      hash,
+		Date:      time.Now().String(),
+	})
+}
+
+// verifyHistoryContents reads whole contents of the history file and checks whether its hash equals the recorded hash
+// when merkle root of contents is recorded, contents are verified with it as well;
+// otherwise hashes of chunks of read contents are returned, so that merkle root can be recorded for the next verification
+func (ss *SyncService) verifyHistoryContents(afterPath string, timestamp uint64, hash string, contentHash string) ([][]byte, bool) {
+	fileInfo, fileContent, err := ss.syncDirAdapter.GetFileFromHistoryDir(afterPath, timestamp)
+	if err != nil {
+		return nil, false
+	}
+	if closer, ok := fileContent.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	var leaves [][]byte
+	if contentHash != "" {
+		readHash, err := utils.MakeContentHashFromReader(fileContent)
+		if err != nil || readHash != contentHash {
+			return nil, false
+		}
+	} else {
+		// read all contents to detect unreadable blocks
+		hasher := utils.NewContentHasher()
+		n, err := io.Copy(hasher, fileContent)
+		if err != nil || n != fileInfo.Size {
+			return nil, false
+		}
+		leaves = hasher.Leaves()
+	}
+
+	return leaves, utils.MakeHashFromFileMetadata(afterPath, fileInfo) == hash
+}
+
+func validateGiveYouTransaction(file *types.File, giveYouRes *types.GiveYouRes) error {
 	if file.LatestSyncTimestamp != giveYouRes.LastSyncTimestamp && file.LatestHash != giveYouRes.LastHash {
 		err := errors.New("not equals hash and timestamp")
 		if err != nil {
@@ -1337,3 +3821,151 @@ func validateGiveYouTransaction(file *types.File, giveYouRes *types.GiveYouRes)
 
 	return nil
 }
+
+// validateEncryption checks encryption of contents sent by client is of supported scheme with nonce
+func validateEncryption(encryption *types.Encryption) error {
+	if !encryption.IsEncrypted() {
+		return nil
+	}
+	if encryption.Scheme != types.EncryptionAES256GCM && encryption.Scheme != types.EncryptionXChaCha20Poly1305 {
+		return errors.New("unsupported encryption scheme: " + encryption.Scheme)
+	}
+	if encryption.Nonce == "" {
+		return errors.New("nonce of encrypted contents is required")
+	}
+
+	return nil
+}
+
+// clientThrottle returns throttle shared by transfers with client, updated to current bandwidth schedule of the client
+// (transfers with client which can not be read are not limited)
+func (ss *SyncService) clientThrottle(uuid string) *utils.Throttle {
+	ss.throttleMut.Lock()
+	throttle, exists := ss.throttles[uuid]
+	if !exists {
+		throttle = utils.NewThrottle()
+		ss.throttles[uuid] = throttle
+	}
+	ss.throttleMut.Unlock()
+
+	client, err := ss.registrationRepository.GetClientByUUID(uuid)
+	if err != nil {
+		log.Println("quics alert: [SyncService.clientThrottle] transfers with ", uuid, " are not limited: ", err)
+		throttle.SetSchedule(types.BandwidthSchedule{})
+		return throttle
+	}
+	throttle.SetSchedule(client.Schedule)
+
+	return throttle
+}
+
+// clientCapabilities returns capabilities negotiated with client
+// (nil when client did not advertise them or can not be read, so that client is served as before negotiation)
+func (ss *SyncService) clientCapabilities(uuid string) *types.Capabilities {
+	client, err := ss.registrationRepository.GetClientByUUID(uuid)
+	if err != nil {
+		return nil
+	}
+	return client.Capabilities
+}
+
+// transferFile returns path of contents of version of file sent to client, with codec they are compressed with
+// contents are compressed into temp file in spool directory (removed by returned function) only when policy of file says
+// compress-on-transfer and client negotiated a codec; otherwise, or when compressing fails, stored contents are sent as they are
+func (ss *SyncService) transferFile(file *types.File, timestamp uint64, capabilities *types.Capabilities) (string, string, func()) {
+	historyFilePath := utils.GetHistoryFileNameByAfterPath(file.AfterPath, timestamp)
+
+	// ciphertext does not get smaller by compression
+	compression := capabilities.PickCompression()
+	if compression == "" || file.Metadata.IsDir || file.Encryption.IsEncrypted() {
+		return historyFilePath, "", func() {}
+	}
+	policy, err := ss.ResolvePolicy(file.AfterPath)
+	if err != nil || !policy.CompressOnTransfer {
+		return historyFilePath, "", func() {}
+	}
+
+	err = os.MkdirAll(utils.GetQuicsSpoolDirPath(), 0700)
+	if err != nil {
+		log.Println("quics err: ", errors.New("[SyncService.transferFile] make spool directory: "+err.Error()), "; send uncompressed")
+		return historyFilePath, "", func() {}
+	}
+	tempDir, err := os.MkdirTemp(utils.GetQuicsSpoolDirPath(), "transfer-*")
+	if err != nil {
+		log.Println("quics err: ", errors.New("[SyncService.transferFile] make temp directory: "+err.Error()), "; send uncompressed")
+		return historyFilePath, "", func() {}
+	}
+	cleanup := func() {
+		err := os.RemoveAll(tempDir)
+		if err != nil {
+			log.Println("quics err: ", errors.New("[SyncService.transferFile] remove temp directory: "+err.Error()))
+		}
+	}
+
+	// compressed copy keeps name of history file, since name of sent file is given to client
+	compressedPath := filepath.Join(tempDir, filepath.Base(historyFilePath))
+	err = utils.CompressFile(historyFilePath, compressedPath, compression)
+	if err != nil {
+		cleanup()
+		log.Println("quics err: ", errors.New("[SyncService.transferFile] compress contents: "+err.Error()), "; send uncompressed")
+		return historyFilePath, "", func() {}
+	}
+
+	return compressedPath, compression, cleanup
+}
+
+// BeginTransfer counts contents being received from or sent to client until returned function is called
+func (ss *SyncService) BeginTransfer() func() {
+	ss.transfersInFlight.Add(1)
+	return func() {
+		ss.transfersInFlight.Add(-1)
+	}
+}
+
+// TransfersInFlight returns the number of transfers begun but not ended yet
+func (ss *SyncService) TransfersInFlight() int64 {
+	return ss.transfersInFlight.Load()
+}
+
+// RecordTransfer records contents completely received from or sent to client started at startedAt
+// failure of recording is only logged, since it must not fail the transfer itself
+func (ss *SyncService) RecordTransfer(direction string, uuid string, afterPath string, size int64, startedAt time.Time) {
+	now := time.Now()
+	err := ss.syncRepository.SaveTransfer(&types.Transfer{
+		Date:      now,
+		Direction: direction,
+		UUID:      uuid,
+		AfterPath: afterPath,
+		Size:      size,
+		Duration:  now.Sub(startedAt),
+	})
+	if err != nil {
+		err = errors.New("[SyncService.RecordTransfer] save transfer: " + err.Error())
+		log.Println("quics err: ", err)
+	}
+}
+
+// WaitSynced waits until version of timestamp (or newer one) of afterPath is fully visible, i.e., saved with its contents,
+// so that read after write of the version returns it; ErrNotSynced is returned when ctx is done before that
+func (ss *SyncService) WaitSynced(ctx context.Context, afterPath string, timestamp uint64) error {
+	ticker := time.NewTicker(SyncWaitInterval)
+	defer ticker.Stop()
+
+	for {
+		file, err := ss.syncRepository.GetFileByPath(afterPath)
+		if err != nil && err != ss.syncRepository.ErrKeyNotFound() {
+			err = errors.New("[SyncService.WaitSynced] get file by path: " + err.Error())
+			return err
+		}
+		// removed version has no contents to wait for
+		if err == nil && (file.LatestSyncTimestamp > timestamp || (file.LatestSyncTimestamp == timestamp && (file.ContentsExisted || file.LatestHash == ""))) {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: version %d of %s is not visible yet", ErrNotSynced, timestamp, afterPath)
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,543 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/quic-s/quics/pkg/core/event"
+	"github.com/quic-s/quics/pkg/core/history"
+	"github.com/quic-s/quics/pkg/fs"
+	"github.com/quic-s/quics/pkg/types"
+	"github.com/quic-s/quics/pkg/utils"
+)
+
+var errNotFound = errors.New("not found")
+
+// contentTestHistoryRepository keeps histories in memory by timestamp (methods not used by reading contents are not implemented)
+type contentTestHistoryRepository struct {
+	history.Repository
+
+	mut       sync.Mutex
+	histories map[uint64]*types.FileHistory
+}
+
+func (r *contentTestHistoryRepository) GetFileHistory(afterPath string, timestamp uint64) (*types.FileHistory, error) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	fileHistory, ok := r.histories[timestamp]
+	if !ok {
+		return nil, errNotFound
+	}
+	return fileHistory, nil
+}
+
+func (r *contentTestHistoryRepository) GetFileHistoriesForClient(afterPath string, cntFromHead uint64) ([]types.FileHistory, error) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	fileHistories := []types.FileHistory{}
+	for _, fileHistory := range r.histories {
+		fileHistories = append(fileHistories, *fileHistory)
+	}
+	return fileHistories, nil
+}
+
+func (r *contentTestHistoryRepository) SaveNewFileHistory(afterPath string, fileHistory *types.FileHistory) error {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	r.histories[fileHistory.Timestamp] = fileHistory
+	return nil
+}
+
+func (r *contentTestHistoryRepository) DeleteFileHistoriesBefore(afterPath string, timestamp uint64) ([]uint64, error) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	deleted := []uint64{}
+	for historyTimestamp := range r.histories {
+		if historyTimestamp < timestamp {
+			delete(r.histories, historyTimestamp)
+			deleted = append(deleted, historyTimestamp)
+		}
+	}
+	return deleted, nil
+}
+
+// contentTestRepository keeps one file and its root directory in memory
+type contentTestRepository struct {
+	Repository
+
+	mut     sync.Mutex
+	file    *types.File
+	rootDir *types.RootDirectory
+}
+
+func (r *contentTestRepository) GetFileByPath(afterPath string) (*types.File, error) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	copied := *r.file
+	return &copied, nil
+}
+
+func (r *contentTestRepository) UpdateFile(file *types.File) error {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	r.file = file
+	return nil
+}
+
+func (r *contentTestRepository) GetAllFiles(prefix string) ([]types.File, error) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	return []types.File{*r.file}, nil
+}
+
+func (r *contentTestRepository) SaveFileByPath(afterPath string, file *types.File) error {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	r.file = file
+	return nil
+}
+
+func (r *contentTestRepository) GetRootDirByPath(afterPath string) (*types.RootDirectory, error) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	if r.rootDir == nil {
+		return nil, errNotFound
+	}
+	return r.rootDir, nil
+}
+
+func (r *contentTestRepository) DeleteConflict(afterPath string) error {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	return nil
+}
+
+func (r *contentTestRepository) SaveTransfer(transfer *types.Transfer) error {
+	return nil
+}
+
+func (r *contentTestRepository) ErrKeyNotFound() error {
+	return errNotFound
+}
+
+// contentTestEventService records published events
+type contentTestEventService struct {
+	event.Service
+
+	events []*types.Event
+}
+
+func (s *contentTestEventService) Publish(event *types.Event) {
+	s.events = append(s.events, event)
+}
+
+func TestOpenHistoryContents(t *testing.T) {
+	const afterPath = "/r/a.txt"
+
+	tests := []struct {
+		name        string
+		timestamp   uint64
+		behindBack  func(historyFilePath string) error // change made to stored contents out of band
+		wantErr     error
+		wantEvent   bool
+		wantExisted bool // ContentsExisted of file after download
+	}{
+		{
+			name:        "contents stored",
+			timestamp:   2,
+			wantExisted: true,
+		},
+		{
+			name:        "contents of latest version deleted",
+			timestamp:   2,
+			behindBack:  os.Remove,
+			wantErr:     ErrContentMissing,
+			wantEvent:   true,
+			wantExisted: false,
+		},
+		{
+			name:        "contents of latest version truncated",
+			timestamp:   2,
+			behindBack:  func(historyFilePath string) error { return os.Truncate(historyFilePath, 1) },
+			wantErr:     ErrContentMissing,
+			wantEvent:   true,
+			wantExisted: false,
+		},
+		{
+			name:        "contents of older version deleted",
+			timestamp:   1,
+			behindBack:  os.Remove,
+			wantErr:     ErrContentMissing,
+			wantEvent:   true,
+			wantExisted: true,
+		},
+		{
+			name:        "version not recorded",
+			timestamp:   3,
+			wantErr:     ErrVersionNotFound,
+			wantExisted: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			utils.SetQuicsDataDirPath(t.TempDir())
+			defer utils.SetQuicsDataDirPath("")
+
+			historyRepository := &contentTestHistoryRepository{histories: map[uint64]*types.FileHistory{}}
+			for _, timestamp := range []uint64{1, 2} {
+				historyFilePath := utils.GetHistoryFileNameByAfterPath(afterPath, timestamp)
+				if err := os.MkdirAll(filepath.Dir(historyFilePath), 0700); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(historyFilePath, []byte("contents"), 0600); err != nil {
+					t.Fatal(err)
+				}
+				historyRepository.histories[timestamp] = &types.FileHistory{
+					AfterPath: afterPath,
+					Timestamp: timestamp,
+					Hash:      "hash",
+					File:      types.FileMetadata{Size: int64(len("contents"))},
+				}
+			}
+			if tt.behindBack != nil {
+				if err := tt.behindBack(utils.GetHistoryFileNameByAfterPath(afterPath, tt.timestamp)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			syncRepository := &contentTestRepository{file: &types.File{AfterPath: afterPath, LatestSyncTimestamp: 2, ContentsExisted: true}}
+			eventService := &contentTestEventService{}
+			ss := &SyncService{
+				historyRepository: historyRepository,
+				syncRepository:    syncRepository,
+				syncDirAdapter:    fs.NewSyncDir(utils.GetQuicsSyncDirPath()),
+				eventService:      eventService,
+			}
+
+			fileInfo, fileContent, err := ss.OpenHistoryContents(afterPath, tt.timestamp)
+			switch {
+			case !errors.Is(err, tt.wantErr):
+				t.Fatalf("OpenHistoryContents() error = %v, want %v", err, tt.wantErr)
+			case err == nil:
+				contents, err := io.ReadAll(fileContent)
+				if err != nil {
+					t.Fatal(err)
+				}
+				fileContent.(io.Closer).Close()
+				if string(contents) != "contents" || fileInfo.Size != int64(len(contents)) {
+					t.Errorf("contents = %q (size %d), want contents", contents, fileInfo.Size)
+				}
+			}
+
+			if got := len(eventService.events) == 1 && eventService.events[0].Type == types.EventContentMissing; got != tt.wantEvent {
+				t.Errorf("events = %v, want content missing event: %t", eventService.events, tt.wantEvent)
+			}
+			if syncRepository.file.ContentsExisted != tt.wantExisted {
+				t.Errorf("contents existed = %t, want %t", syncRepository.file.ContentsExisted, tt.wantExisted)
+			}
+		})
+	}
+}
+
+func TestScrub(t *testing.T) {
+	const afterPath = "/r/a.txt"
+
+	tests := []struct {
+		name          string
+		noContentHash bool                               // file was saved before merkle root of contents was recorded
+		behindBack    func(historyFilePath string) error // change made to stored contents out of band
+		wantEvent     bool
+		wantExisted   bool // ContentsExisted of file after scrub
+	}{
+		{
+			name:        "contents intact",
+			wantExisted: true,
+		},
+		{
+			name:          "content hash not recorded",
+			noContentHash: true,
+			wantExisted:   true,
+		},
+		{
+			name:        "contents corrupted",
+			behindBack:  func(historyFilePath string) error { return os.WriteFile(historyFilePath, []byte("CONTENTS"), 0600) },
+			wantEvent:   true,
+			wantExisted: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			utils.SetQuicsDataDirPath(t.TempDir())
+			defer utils.SetQuicsDataDirPath("")
+
+			syncDir := fs.NewSyncDir(utils.GetQuicsSyncDirPath())
+			if err := syncDir.SaveFileToHistoryDir(afterPath, 1, &types.FileMetadata{Size: int64(len("contents")), Mode: 0600}, strings.NewReader("contents")); err != nil {
+				t.Fatal(err)
+			}
+			metadata, fileContent, err := syncDir.GetFileFromHistoryDir(afterPath, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fileContent.(io.Closer).Close()
+			contentHash, err := utils.MakeContentHashFromFile(utils.GetHistoryFileNameByAfterPath(afterPath, 1))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.behindBack != nil {
+				historyFilePath := utils.GetHistoryFileNameByAfterPath(afterPath, 1)
+				if err := tt.behindBack(historyFilePath); err != nil {
+					t.Fatal(err)
+				}
+				// modification time is kept, so that only merkle root of contents tells the corruption
+				if err := os.Chtimes(historyFilePath, metadata.ModTime, metadata.ModTime); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			file := &types.File{
+				AfterPath:           afterPath,
+				LatestHash:          utils.MakeHashFromFileMetadata(afterPath, metadata),
+				ContentHash:         contentHash,
+				LatestSyncTimestamp: 1,
+				LatestEditClient:    "client-a",
+				ContentsExisted:     true,
+				Metadata:            *metadata,
+			}
+			historyRepository := &contentTestHistoryRepository{histories: map[uint64]*types.FileHistory{
+				1: {AfterPath: afterPath, Timestamp: 1, Hash: file.LatestHash, ContentHash: file.ContentHash, File: *metadata},
+			}}
+			if tt.noContentHash {
+				file.ContentHash = ""
+				historyRepository.histories[1].ContentHash = ""
+			}
+			syncRepository := &contentTestRepository{file: file}
+			eventService := &contentTestEventService{}
+			ss := &SyncService{
+				historyRepository: historyRepository,
+				syncRepository:    syncRepository,
+				syncDirAdapter:    syncDir,
+				eventService:      eventService,
+			}
+
+			scrubRes, err := ss.Scrub()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if (scrubRes.Corrupted == 1) != tt.wantEvent {
+				t.Errorf("corrupted = %d, want corrupted: %t", scrubRes.Corrupted, tt.wantEvent)
+			}
+			if got := len(eventService.events) == 1 && eventService.events[0].Type == types.EventContentCorrupted && eventService.events[0].UUID == "client-a"; got != tt.wantEvent {
+				t.Errorf("events = %v, want content corrupted event: %t", eventService.events, tt.wantEvent)
+			}
+			if syncRepository.file.ContentsExisted != tt.wantExisted {
+				t.Errorf("contents existed = %t, want %t", syncRepository.file.ContentsExisted, tt.wantExisted)
+			}
+			// merkle root is recorded for verified contents
+			if tt.wantExisted && (syncRepository.file.ContentHash != contentHash || historyRepository.histories[1].ContentHash != contentHash) {
+				t.Errorf("content hash = %q (history %q), want %q", syncRepository.file.ContentHash, historyRepository.histories[1].ContentHash, contentHash)
+			}
+		})
+	}
+}
+
+func TestConditionalUploadRacingUnconditionalUpload(t *testing.T) {
+	const afterPath = "/r/a.txt"
+
+	for i := 0; i < 50; i++ {
+		utils.SetQuicsDataDirPath(t.TempDir())
+
+		file := &types.File{AfterPath: afterPath, RootDirKey: "/r", LatestHash: "base", LatestSyncTimestamp: 1, ContentsExisted: true}
+		ss := &SyncService{
+			historyRepository: &contentTestHistoryRepository{histories: map[uint64]*types.FileHistory{}},
+			syncRepository:    &contentTestRepository{file: file},
+			syncDirAdapter:    fs.NewSyncDir(utils.GetQuicsSyncDirPath()),
+		}
+
+		// conditional upload expects base version, and unconditional one is started at the same time
+		var conditional, unconditional *types.File
+		var conditionalErr, unconditionalErr error
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			contents := "conditional"
+			conditional, conditionalErr = ss.UploadFile(afterPath, &types.FileMetadata{Size: int64(len(contents)), Mode: 0600}, strings.NewReader(contents), "base")
+		}()
+		go func() {
+			defer wg.Done()
+			contents := "unconditional upload"
+			unconditional, unconditionalErr = ss.UploadFile(afterPath, &types.FileMetadata{Size: int64(len(contents)), Mode: 0600}, strings.NewReader(contents), "")
+		}()
+		wg.Wait()
+
+		if unconditionalErr != nil {
+			t.Fatal(unconditionalErr)
+		}
+		// conditional upload is either saved right after base version, or rejected because unconditional one was saved first
+		var mismatch *HashMismatchError
+		switch {
+		case errors.As(conditionalErr, &mismatch):
+			if unconditional.LatestSyncTimestamp != 2 || mismatch.CurrentHash != unconditional.LatestHash {
+				t.Fatalf("conditional upload is rejected by %v, but unconditional one is saved as version %d", conditionalErr, unconditional.LatestSyncTimestamp)
+			}
+		case conditionalErr != nil:
+			t.Fatal(conditionalErr)
+		case conditional.LatestSyncTimestamp != 2 || unconditional.LatestSyncTimestamp != 3:
+			t.Fatalf("conditional upload is saved as version %d and unconditional one as version %d, want 2 and 3", conditional.LatestSyncTimestamp, unconditional.LatestSyncTimestamp)
+		}
+	}
+	utils.SetQuicsDataDirPath("")
+}
+
+func TestVersioningPolicyOfNewVersion(t *testing.T) {
+	const afterPath = "/r/a.txt"
+
+	tests := []struct {
+		name     string
+		conflict bool // client-a uploaded conflicting contents
+		change   func(ss *SyncService) error
+	}{
+		{
+			name: "rollback",
+			change: func(ss *SyncService) error {
+				_, err := ss.RollbackFileByHistory(&types.RollBackReq{UUID: "client-a", AfterPath: afterPath, Version: 1})
+				return err
+			},
+		},
+		{
+			name:     "resolve conflict by server side",
+			conflict: true,
+			change: func(ss *SyncService) error {
+				_, err := ss.resolveConflict(ss.syncRepository.(*contentTestRepository).file, "server", "client-a")
+				return err
+			},
+		},
+		{
+			name:     "resolve conflict by client side",
+			conflict: true,
+			change: func(ss *SyncService) error {
+				_, err := ss.resolveConflict(ss.syncRepository.(*contentTestRepository).file, "client-a", "client-a")
+				return err
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			utils.SetQuicsDataDirPath(t.TempDir())
+			defer utils.SetQuicsDataDirPath("")
+
+			syncDir := fs.NewSyncDir(utils.GetQuicsSyncDirPath())
+			historyRepository := &contentTestHistoryRepository{histories: map[uint64]*types.FileHistory{}}
+			metadata := &types.FileMetadata{Size: int64(len("contents")), Mode: 0600}
+			for _, timestamp := range []uint64{1, 2} {
+				if err := syncDir.SaveFileToHistoryDir(afterPath, timestamp, metadata, strings.NewReader("contents")); err != nil {
+					t.Fatal(err)
+				}
+				historyRepository.histories[timestamp] = &types.FileHistory{AfterPath: afterPath, Timestamp: timestamp, Hash: "hash", File: *metadata}
+			}
+
+			file := &types.File{AfterPath: afterPath, RootDirKey: "/r", LatestHash: "hash", LatestSyncTimestamp: 2, ContentsExisted: true, Metadata: *metadata}
+			if tt.conflict {
+				if err := syncDir.SaveFileToConflictDir("client-a", afterPath, metadata, strings.NewReader("contents")); err != nil {
+					t.Fatal(err)
+				}
+				file.Conflict = types.Conflict{AfterPath: afterPath, StagingFiles: map[string]types.FileHistory{
+					"server":   {AfterPath: afterPath, Timestamp: 2, Hash: "hash", File: *metadata},
+					"client-a": {AfterPath: afterPath, UUID: "client-a", Hash: "hash", File: *metadata},
+				}}
+			}
+
+			// root directory keeps only latest version of text files
+			rootDir := &types.RootDirectory{AfterPath: "/r", VersioningPolicies: []types.VersioningPolicy{{Pattern: ".txt", Mode: types.VersioningLatest}}}
+			ss := &SyncService{
+				cancel:            map[string]context.CancelFunc{},
+				historyRepository: historyRepository,
+				syncRepository:    &contentTestRepository{file: file, rootDir: rootDir},
+				syncDirAdapter:    syncDir,
+			}
+
+			if err := tt.change(ss); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, ok := historyRepository.histories[3]; len(historyRepository.histories) != 1 || !ok {
+				t.Errorf("histories = %v, want only history of version 3", historyRepository.histories)
+			}
+			for _, timestamp := range []uint64{1, 2} {
+				if _, err := os.Stat(utils.GetHistoryFileNameByAfterPath(afterPath, timestamp)); !os.IsNotExist(err) {
+					t.Errorf("contents of version %d are kept (stat error = %v)", timestamp, err)
+				}
+			}
+		})
+	}
+}
+
+// pathTestRepository keeps afterPaths of stored files
+type pathTestRepository struct {
+	Repository
+
+	files map[string]bool
+}
+
+func (r *pathTestRepository) GetFileByPath(afterPath string) (*types.File, error) {
+	if !r.files[afterPath] {
+		return nil, errNotFound
+	}
+	return &types.File{AfterPath: afterPath}, nil
+}
+
+func TestCheckPathLimits(t *testing.T) {
+	longPath := "/root/" + strings.Repeat("a", 100)
+	deepPath := "/root" + strings.Repeat("/d", 10)
+
+	tests := []struct {
+		name      string
+		afterPath string
+		stored    bool // file was stored before limits were lowered
+		wantErr   error
+	}{
+		{name: "new file within limits", afterPath: "/root/a.txt"},
+		{name: "new file too long", afterPath: longPath, wantErr: utils.ErrPathTooLong},
+		{name: "new file too deep", afterPath: deepPath, wantErr: utils.ErrPathTooDeep},
+		{name: "stored file too long", afterPath: longPath, stored: true},
+		{name: "stored file too deep", afterPath: deepPath, stored: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ss := &SyncService{
+				syncRepository: &pathTestRepository{files: map[string]bool{}},
+				maxPathLength:  64,
+				maxPathDepth:   8,
+			}
+			if tt.stored {
+				ss.syncRepository.(*pathTestRepository).files[tt.afterPath] = true
+			}
+
+			err := ss.checkPathLimits(tt.afterPath)
+			if !errors.Is(err, tt.wantErr) || (err == nil) != (tt.wantErr == nil) {
+				t.Errorf("checkPathLimits() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package fs
 
 import (
+	"bytes"
 	"crypto/sha1"
 	"errors"
 	"io"
@@ -8,7 +9,9 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/quic-s/quics/pkg/types"
 	"github.com/quic-s/quics/pkg/utils"
@@ -48,7 +51,7 @@ func (s *SyncDir) SaveFileToLatestDir(afterPath string, fileMetadata *types.File
 
 	latestFilePath := filepath.Join(s.SyncDir, afterPath)
 
-	err := fileMetadata.WriteFileWithInfo(latestFilePath, fileContent)
+	err := writeFileAtomically(latestFilePath, fileMetadata, fileContent)
 	if err != nil {
 		log.Println("quics err: ", err)
 		return err
@@ -117,7 +120,7 @@ func (s *SyncDir) DeleteFileFromLatestDir(afterPath string) error {
 }
 
 func (s *SyncDir) SaveFileToConflictDir(uuid string, afterPath string, fileMetadata *types.FileMetadata, fileContent io.Reader) error {
-	err := fileMetadata.WriteFileWithInfo(utils.GetConflictFileNameByAfterPath(afterPath, uuid), fileContent)
+	err := writeFileAtomically(utils.GetConflictFileNameByAfterPath(afterPath, uuid), fileMetadata, fileContent)
 	if err != nil {
 		log.Println("quics err: ", err)
 		return err
@@ -222,7 +225,7 @@ func (s *SyncDir) SaveFileToHistoryDir(afterPath string, timestamp uint64, fileM
 	// create history directory
 	historyFilePath := utils.GetHistoryFileNameByAfterPath(afterPath, timestamp)
 
-	err := fileMetadata.WriteFileWithInfo(historyFilePath, fileContent)
+	err := writeFileAtomically(historyFilePath, fileMetadata, fileContent)
 	if err != nil {
 		log.Println("quics err: ", err)
 		return err
@@ -256,3 +259,234 @@ func (s *SyncDir) GetFileInfoFromHistoryDir(afterPath string, timestamp uint64)
 
 	return types.NewFileMetadataFromOSFileInfo(fileInfo), nil
 }
+
+func (s *SyncDir) DeleteFileFromHistoryDir(afterPath string, timestamp uint64) error {
+	// lock mutex by hash value of file path
+	// using hash value is to reduce the number of mutex
+	h := sha1.New()
+	h.Write([]byte(afterPath))
+	hash := h.Sum(nil)
+
+	s.pathMut[uint8(hash[0]%s.lockNum)].Lock()
+	defer s.pathMut[uint8(hash[0]%s.lockNum)].Unlock()
+
+	err := os.Remove(utils.GetHistoryFileNameByAfterPath(afterPath, timestamp))
+	if err != nil && !os.IsNotExist(err) {
+		log.Println("quics err: ", err)
+		return err
+	}
+
+	return nil
+}
+
+// GetContentHashFromHistoryDir makes merkle root of contents of history file
+func (s *SyncDir) GetContentHashFromHistoryDir(afterPath string, timestamp uint64) (string, error) {
+	contentHash, err := utils.MakeContentHashFromFile(utils.GetHistoryFileNameByAfterPath(afterPath, timestamp))
+	if err != nil {
+		log.Println("quics err: ", err)
+		return "", err
+	}
+
+	return contentHash, nil
+}
+
+// GetContentLeavesFromHistoryDir makes hashes of chunks (leaves of merkle tree) of contents of history file
+func (s *SyncDir) GetContentLeavesFromHistoryDir(afterPath string, timestamp uint64) ([][]byte, error) {
+	leaves, err := utils.MakeContentLeavesFromFile(utils.GetHistoryFileNameByAfterPath(afterPath, timestamp))
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	return leaves, nil
+}
+
+// ExtendContentLeavesFromHistoryDir makes hashes of chunks of history file appended to contents of baseSize hashed into baseLeaves
+func (s *SyncDir) ExtendContentLeavesFromHistoryDir(afterPath string, timestamp uint64, baseLeaves [][]byte, baseSize int64) ([][]byte, error) {
+	leaves, err := utils.ExtendContentLeavesFromFile(utils.GetHistoryFileNameByAfterPath(afterPath, timestamp), baseLeaves, baseSize)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	return leaves, nil
+}
+
+// SaveFileToCommitDir stages contents of index-th member of commit set
+func (s *SyncDir) SaveFileToCommitDir(id string, index int, fileMetadata *types.FileMetadata, fileContent io.Reader) error {
+	commitFilePath := filepath.Join(utils.GetQuicsCommitDirPath(id), strconv.Itoa(index))
+
+	err := writeFileAtomically(commitFilePath, fileMetadata, fileContent)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *SyncDir) GetFileFromCommitDir(id string, index int) (*types.FileMetadata, io.Reader, error) {
+	file, err := os.Open(filepath.Join(utils.GetQuicsCommitDirPath(id), strconv.Itoa(index)))
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, nil, err
+	}
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, nil, err
+	}
+
+	return types.NewFileMetadataFromOSFileInfo(fileInfo), file, nil
+}
+
+// DeleteCommitDir deletes every staged member of commit set
+func (s *SyncDir) DeleteCommitDir(id string) error {
+	err := os.RemoveAll(utils.GetQuicsCommitDirPath(id))
+	if err != nil {
+		log.Println("quics err: ", err)
+		return err
+	}
+
+	return nil
+}
+
+// MoveRootDir renames latest, history and conflict directories of root directory
+func (s *SyncDir) MoveRootDir(fromAfterPath string, toAfterPath string) error {
+	fromRootDir, _ := utils.GetNamesByAfterPath(fromAfterPath)
+	toRootDir, _ := utils.GetNamesByAfterPath(toAfterPath)
+
+	moved := []string{}
+	for _, suffix := range []string{"", ".history", ".conflict"} {
+		from := filepath.Join(s.SyncDir, fromRootDir+suffix)
+		to := filepath.Join(s.SyncDir, toRootDir+suffix)
+
+		if _, err := os.Stat(from); os.IsNotExist(err) {
+			continue
+		}
+		if _, err := os.Stat(to); err == nil {
+			err = errors.New("[SyncDir.MoveRootDir] destination already exists: " + to)
+			s.rollbackMoveRootDir(moved, fromRootDir, toRootDir)
+			return err
+		}
+
+		err := os.Rename(from, to)
+		if err != nil {
+			log.Println("quics err: ", err)
+			s.rollbackMoveRootDir(moved, fromRootDir, toRootDir)
+			return err
+		}
+		moved = append(moved, suffix)
+	}
+
+	return nil
+}
+
+// rollbackMoveRootDir restores directories which are already renamed by MoveRootDir
+func (s *SyncDir) rollbackMoveRootDir(moved []string, fromRootDir string, toRootDir string) {
+	for _, suffix := range moved {
+		err := os.Rename(filepath.Join(s.SyncDir, toRootDir+suffix), filepath.Join(s.SyncDir, fromRootDir+suffix))
+		if err != nil {
+			log.Println("quics err: ", err)
+		}
+	}
+}
+
+// MoveFile renames latest contents and history contents of timestamps of file from fromAfterPath to toAfterPath
+// contents which do not exist (e.g., not received yet) are skipped
+func (s *SyncDir) MoveFile(fromAfterPath string, toAfterPath string, timestamps []uint64) error {
+	froms := []string{filepath.Join(s.SyncDir, fromAfterPath)}
+	tos := []string{filepath.Join(s.SyncDir, toAfterPath)}
+	for _, timestamp := range timestamps {
+		froms = append(froms, utils.GetHistoryFileNameByAfterPath(fromAfterPath, timestamp))
+		tos = append(tos, utils.GetHistoryFileNameByAfterPath(toAfterPath, timestamp))
+	}
+
+	moved := 0
+	for i := range froms {
+		if _, err := os.Stat(froms[i]); os.IsNotExist(err) {
+			froms[i] = ""
+			continue
+		}
+		if _, err := os.Stat(tos[i]); err == nil {
+			err = errors.New("[SyncDir.MoveFile] destination already exists: " + tos[i])
+			s.rollbackMoveFile(froms[:moved], tos[:moved])
+			return err
+		}
+
+		err := os.MkdirAll(filepath.Dir(tos[i]), 0755)
+		if err == nil {
+			err = os.Rename(froms[i], tos[i])
+		}
+		if err != nil {
+			log.Println("quics err: ", err)
+			s.rollbackMoveFile(froms[:moved], tos[:moved])
+			return err
+		}
+		moved = i + 1
+	}
+
+	return nil
+}
+
+// rollbackMoveFile restores contents which are already renamed by MoveFile (empty from was not moved)
+func (s *SyncDir) rollbackMoveFile(froms []string, tos []string) {
+	for i, from := range froms {
+		if from == "" {
+			continue
+		}
+		err := os.Rename(tos[i], from)
+		if err != nil {
+			log.Println("quics err: ", err)
+		}
+	}
+}
+
+// writeFileAtomically writes contents to temp file next to filePath, then renames it to filePath,
+// so that failed write (e.g., no space left on disk) leaves neither partial file nor partially overwritten file
+func writeFileAtomically(filePath string, fileMetadata *types.FileMetadata, fileContent io.Reader) error {
+	if fileMetadata.IsDir {
+		return fileMetadata.WriteFileWithInfo(filePath, fileContent)
+	}
+	// zero-byte file can come without reader of its contents
+	if fileContent == nil && fileMetadata.Size == 0 {
+		fileContent = bytes.NewReader(nil)
+	}
+
+	dir, name := filepath.Split(filePath)
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return err
+	}
+	tempFile, err := os.CreateTemp(dir, "."+name+".*.partial")
+	if err != nil {
+		return err
+	}
+	tempPath := tempFile.Name()
+
+	n, err := io.Copy(tempFile, fileContent)
+	// write can fail on close as well (e.g., delayed allocation of file system)
+	closeErr := tempFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil && n != fileMetadata.Size {
+		err = errors.New("file content size is not equal with fileinfo.size")
+	}
+	if err == nil {
+		err = os.Chmod(tempPath, fileMetadata.Mode)
+	}
+	if err == nil {
+		err = os.Chtimes(tempPath, time.Now(), fileMetadata.ModTime)
+	}
+	if err == nil {
+		err = os.Rename(tempPath, filePath)
+	}
+	if err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+
+	return nil
+}
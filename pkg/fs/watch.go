@@ -0,0 +1,330 @@
+package fs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/quic-s/quics/pkg/types"
+	"github.com/quic-s/quics/pkg/utils"
+)
+
+// WatchDebounce is the quiet period after last change of watched directory before changes are ingested,
+// so that a file written in several steps (or saved by editor through temp file) is ingested once
+const WatchDebounce = 500 * time.Millisecond
+
+// Ingester stores changes of watched directory (server.Service satisfies it)
+type Ingester interface {
+	WalkPaths(files bool, dirs bool, visit func(afterPath string) error) error
+	ShowFile(afterPath string, filter *types.LogFilter, pageReq *types.PageReq) (*types.Page[types.File], error)
+	UploadFile(afterPath string, size int64, fileContent io.Reader, expectedHash string) (*types.File, error)
+	RemoveFile(afterPath string, recursive bool, dryRun bool, purge bool) (*types.RemoveRes, error)
+	MoveFile(fromAfterPath string, toAfterPath string, overwrite bool) (*types.File, error)
+}
+
+// Watcher mirrors local directory of server machine into files under afterPath prefix without client
+// local directory is the source of truth: created/modified files are uploaded as new versions, removed ones are removed,
+// and renamed ones are moved keeping their histories (ingestion is one-way, so changes of prefix by clients are not written back)
+type Watcher struct {
+	localDir string
+	prefix   string
+	ingester Ingester
+	watcher  *fsnotify.Watcher
+
+	known map[string]string // after path -> content hash of latest version of live file under prefix
+}
+
+func NewWatcher(localDir string, prefix string, ingester Ingester) (*Watcher, error) {
+	info, err := os.Stat(localDir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, errors.New("watch dir is not a directory: " + localDir)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Watcher{
+		localDir: localDir,
+		prefix:   prefix,
+		ingester: ingester,
+		watcher:  watcher,
+		known:    map[string]string{},
+	}, nil
+}
+
+// Run ingests changes made while server was stopped, then ingests changes of watched directory until Close is called
+func (w *Watcher) Run() {
+	log.Println("quics: watch dir ", w.localDir, " into ", w.prefix)
+
+	err := w.loadKnown()
+	if err != nil {
+		log.Println("quics err: [Watcher.Run] load stored files: ", err)
+		return
+	}
+
+	// directories are watched before they are scanned, so that no change is missed between them
+	w.ingest(map[string]bool{w.localDir: true})
+
+	pending := map[string]bool{}
+	timer := time.NewTimer(WatchDebounce)
+	timer.Stop()
+	for {
+		select {
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+			pending[event.Name] = true
+			timer.Reset(WatchDebounce)
+
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			// events can be dropped (e.g., overflow), so the whole directory is scanned again
+			log.Println("quics err: [Watcher.Run] ", err)
+			pending[w.localDir] = true
+			timer.Reset(WatchDebounce)
+
+		case <-timer.C:
+			w.ingest(pending)
+			pending = map[string]bool{}
+		}
+	}
+}
+
+// Close stops watching
+func (w *Watcher) Close() error {
+	return w.watcher.Close()
+}
+
+// loadKnown reads content hashes of live files stored under prefix
+func (w *Watcher) loadKnown() error {
+	afterPaths := []string{}
+	err := w.ingester.WalkPaths(true, false, func(afterPath string) error {
+		if utils.IsUnderPath(w.prefix, afterPath) && afterPath != w.prefix && !utils.IsGlobPattern(afterPath) {
+			afterPaths = append(afterPaths, afterPath)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, afterPath := range afterPaths {
+		page, err := w.ingester.ShowFile(afterPath, nil, nil)
+		if err != nil {
+			return err
+		}
+		for _, file := range page.Items {
+			// removed file is not live, so it is uploaded again when it appears
+			if file.AfterPath == afterPath && file.LatestHash != "" {
+				w.known[afterPath] = file.ContentHash
+			}
+		}
+	}
+
+	return nil
+}
+
+// ingest stores current state of pending local paths (files, or directories scanned recursively)
+func (w *Watcher) ingest(pending map[string]bool) {
+	appeared := map[string]string{} // after path -> content hash of local file
+	vanished := map[string]bool{}
+
+	for localPath := range pending {
+		afterPath, ok := w.afterPath(localPath)
+		if !ok {
+			continue
+		}
+
+		info, err := os.Lstat(localPath)
+		if os.IsNotExist(err) {
+			// removed directory takes every file under it
+			for knownPath := range w.known {
+				if utils.IsUnderPath(afterPath, knownPath) {
+					vanished[knownPath] = true
+				}
+			}
+			continue
+		}
+		if err != nil {
+			log.Println("quics err: [Watcher.ingest] ", err)
+			continue
+		}
+
+		if info.IsDir() {
+			w.scan(localPath, appeared, vanished)
+			continue
+		}
+		w.hashFile(localPath, info, appeared)
+	}
+
+	// path which is removed and created again within debounce is just modified
+	for afterPath := range appeared {
+		delete(vanished, afterPath)
+	}
+
+	// file which vanished while file of the same contents appeared is moved, so that history follows rename
+	for toAfterPath, contentHash := range appeared {
+		if _, ok := w.known[toAfterPath]; ok {
+			continue
+		}
+		for fromAfterPath := range vanished {
+			if w.known[fromAfterPath] != contentHash {
+				continue
+			}
+
+			_, err := w.ingester.MoveFile(fromAfterPath, toAfterPath, true)
+			if err != nil {
+				log.Println("quics err: [Watcher.ingest] move ", fromAfterPath, " to ", toAfterPath, ": ", err)
+				break
+			}
+			delete(vanished, fromAfterPath)
+			delete(w.known, fromAfterPath)
+			delete(appeared, toAfterPath)
+			w.known[toAfterPath] = contentHash
+			break
+		}
+	}
+
+	for afterPath, contentHash := range appeared {
+		if knownHash, ok := w.known[afterPath]; ok && knownHash == contentHash {
+			continue
+		}
+
+		err := w.upload(afterPath)
+		if err != nil {
+			log.Println("quics err: [Watcher.ingest] upload ", afterPath, ": ", err)
+			continue
+		}
+		w.known[afterPath] = contentHash
+	}
+
+	for afterPath := range vanished {
+		_, err := w.ingester.RemoveFile(afterPath, false, false, false)
+		if err != nil {
+			log.Println("quics err: [Watcher.ingest] remove ", afterPath, ": ", err)
+			continue
+		}
+		delete(w.known, afterPath)
+	}
+}
+
+// scan watches directory of localPath and every directory under it, and collects files under it
+// known files under it which do not exist anymore are collected as vanished
+func (w *Watcher) scan(localPath string, appeared map[string]string, vanished map[string]bool) {
+	seen := map[string]bool{}
+	err := filepath.WalkDir(localPath, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			log.Println("quics err: [Watcher.scan] ", err)
+			return nil
+		}
+
+		if entry.IsDir() {
+			err = w.watcher.Add(path)
+			if err != nil {
+				log.Println("quics err: [Watcher.scan] watch ", path, ": ", err)
+			}
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+		afterPath, ok := w.afterPath(path)
+		if ok && w.hashFile(path, info, appeared) {
+			seen[afterPath] = true
+		}
+		return nil
+	})
+	if err != nil {
+		log.Println("quics err: [Watcher.scan] ", err)
+		return
+	}
+
+	dirAfterPath, ok := w.afterPath(localPath)
+	if !ok {
+		return
+	}
+	for knownPath := range w.known {
+		if utils.IsUnderPath(dirAfterPath, knownPath) && !seen[knownPath] {
+			vanished[knownPath] = true
+		}
+	}
+}
+
+// hashFile collects content hash of regular file (symbolic links and special files are not ingested)
+func (w *Watcher) hashFile(localPath string, info fs.FileInfo, appeared map[string]string) bool {
+	if !info.Mode().IsRegular() {
+		return false
+	}
+	afterPath, ok := w.afterPath(localPath)
+	if !ok {
+		return false
+	}
+
+	file, err := os.Open(localPath)
+	if err != nil {
+		log.Println("quics err: [Watcher.hashFile] ", err)
+		return false
+	}
+	defer file.Close()
+
+	contentHash, err := utils.MakeContentHashFromReader(file)
+	if err != nil {
+		log.Println("quics err: [Watcher.hashFile] ", err)
+		return false
+	}
+
+	appeared[afterPath] = contentHash
+	return true
+}
+
+func (w *Watcher) upload(afterPath string) error {
+	file, err := os.Open(w.localPath(afterPath))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	_, err = w.ingester.UploadFile(afterPath, info.Size(), file, "")
+	return err
+}
+
+// afterPath converts local path under watched directory to after path under prefix
+func (w *Watcher) afterPath(localPath string) (string, bool) {
+	rel, err := filepath.Rel(w.localDir, localPath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	if rel == "." {
+		return w.prefix, true
+	}
+
+	return w.prefix + "/" + filepath.ToSlash(rel), true
+}
+
+func (w *Watcher) localPath(afterPath string) string {
+	return filepath.Join(w.localDir, filepath.FromSlash(strings.TrimPrefix(afterPath, w.prefix)))
+}
@@ -0,0 +1,30 @@
+package logs
+
+import (
+	"io"
+	"log"
+	"os"
+)
+
+// std keeps recent lines of standard logger
+var std = NewRing(RingSize)
+
+// Install makes standard logger write to the ring as well as stderr
+func Install() {
+	log.SetOutput(io.MultiWriter(os.Stderr, std))
+}
+
+// Recent returns recent lines of standard logger
+func Recent(level string) []Line {
+	return std.Recent(level)
+}
+
+// Subscribe subscribes lines of standard logger
+func Subscribe(level string) ([]Line, <-chan Line, func()) {
+	return std.Subscribe(level)
+}
+
+// Restore puts lines before recent lines of standard logger (e.g., lines kept before restart)
+func Restore(lines []Line) {
+	std.Restore(lines)
+}
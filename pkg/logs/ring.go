@@ -0,0 +1,168 @@
+package logs
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+)
+
+const (
+	LevelInfo  = "info"
+	LevelWarn  = "warn"
+	LevelError = "error"
+)
+
+// RingSize is the number of recent log lines which are kept for new subscribers
+const RingSize = 1000
+
+// size of buffered channel for each subscriber
+const subscriberBufferSize = 256
+
+var levelOrder = map[string]int{
+	LevelInfo:  0,
+	LevelWarn:  1,
+	LevelError: 2,
+}
+
+// Line is one line of server log with its level
+type Line struct {
+	Level string
+	Text  string
+}
+
+// Ring keeps recent log lines and delivers new lines to subscribers
+// it is used as a writer of standard log package
+type Ring struct {
+	mut         sync.RWMutex
+	lines       []Line
+	next        int
+	full        bool
+	partial     []byte
+	subscribers map[chan Line]int // minimum level order of subscriber
+}
+
+func NewRing(size int) *Ring {
+	return &Ring{
+		lines:       make([]Line, size),
+		subscribers: map[chan Line]int{},
+	}
+}
+
+// Write splits written bytes into lines and keeps them
+func (r *Ring) Write(p []byte) (int, error) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	r.partial = append(r.partial, p...)
+	for {
+		i := bytes.IndexByte(r.partial, '\n')
+		if i == -1 {
+			break
+		}
+
+		text := string(r.partial[:i])
+		r.partial = r.partial[i+1:]
+		r.appendLine(Line{Level: LevelOf(text), Text: text})
+	}
+
+	return len(p), nil
+}
+
+func (r *Ring) appendLine(line Line) {
+	r.lines[r.next] = line
+	r.next = (r.next + 1) % len(r.lines)
+	if r.next == 0 {
+		r.full = true
+	}
+
+	for subscriber, minLevel := range r.subscribers {
+		if levelOrder[line.Level] < minLevel {
+			continue
+		}
+
+		select {
+		case subscriber <- line:
+		default:
+			// do not block logging for slow subscriber
+		}
+	}
+}
+
+// Recent returns kept lines whose level is higher than or equal to level
+func (r *Ring) Recent(level string) []Line {
+	r.mut.RLock()
+	defer r.mut.RUnlock()
+
+	return r.recent(levelOrder[level])
+}
+
+func (r *Ring) recent(minLevel int) []Line {
+	lines := []Line{}
+	if r.full {
+		lines = append(lines, r.lines[r.next:]...)
+	}
+	lines = append(lines, r.lines[:r.next]...)
+
+	filtered := []Line{}
+	for _, line := range lines {
+		if levelOrder[line.Level] >= minLevel {
+			filtered = append(filtered, line)
+		}
+	}
+
+	return filtered
+}
+
+// Restore puts lines (e.g., kept before restart) before kept lines, dropping the oldest lines which do not fit
+func (r *Ring) Restore(lines []Line) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	lines = append(lines, r.recent(levelOrder[LevelInfo])...)
+	if len(lines) > len(r.lines) {
+		lines = lines[len(lines)-len(r.lines):]
+	}
+
+	r.next = copy(r.lines, lines) % len(r.lines)
+	r.full = len(lines) == len(r.lines)
+}
+
+// Subscribe returns recent lines and channel of new lines whose level is higher than or equal to level
+func (r *Ring) Subscribe(level string) ([]Line, <-chan Line, func()) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	subscriber := make(chan Line, subscriberBufferSize)
+	r.subscribers[subscriber] = levelOrder[level]
+
+	unsubscribe := func() {
+		r.mut.Lock()
+		defer r.mut.Unlock()
+
+		if _, exists := r.subscribers[subscriber]; !exists {
+			return
+		}
+		delete(r.subscribers, subscriber)
+		close(subscriber)
+	}
+
+	return r.recent(levelOrder[level]), subscriber, unsubscribe
+}
+
+// IsValidLevel checks whether level is one of info, warn and error
+func IsValidLevel(level string) bool {
+	_, exists := levelOrder[level]
+	return exists
+}
+
+// LevelOf guesses level of log line by its prefix (e.g., quics err:)
+func LevelOf(text string) string {
+	switch {
+	case strings.Contains(text, "quics err"):
+		return LevelError
+	case strings.Contains(text, "quics alert"), strings.Contains(text, "quics warn"):
+		return LevelWarn
+	default:
+		return LevelInfo
+	}
+}
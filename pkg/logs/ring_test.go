@@ -0,0 +1,85 @@
+package logs
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestRingRestore(t *testing.T) {
+	tests := []struct {
+		name     string
+		size     int
+		kept     []string // lines written before restore
+		restored []string // lines kept before restart
+		want     []string
+		thenLine string // line written after restore, which goes after every restored line
+	}{
+		{
+			name:     "empty ring",
+			size:     4,
+			restored: []string{"a", "b"},
+			want:     []string{"a", "b"},
+			thenLine: "c",
+		},
+		{
+			name:     "restored before kept lines",
+			size:     4,
+			kept:     []string{"c"},
+			restored: []string{"a", "b"},
+			want:     []string{"a", "b", "c"},
+			thenLine: "d",
+		},
+		{
+			name:     "oldest restored lines dropped",
+			size:     3,
+			kept:     []string{"d"},
+			restored: []string{"a", "b", "c"},
+			want:     []string{"b", "c", "d"},
+			thenLine: "e",
+		},
+		{
+			name:     "ring filled exactly",
+			size:     3,
+			kept:     []string{"c"},
+			restored: []string{"a", "b"},
+			want:     []string{"a", "b", "c"},
+			thenLine: "d",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ring := NewRing(tt.size)
+			for _, text := range tt.kept {
+				fmt.Fprintln(ring, text)
+			}
+			lines := []Line{}
+			for _, text := range tt.restored {
+				lines = append(lines, Line{Level: LevelInfo, Text: text})
+			}
+
+			ring.Restore(lines)
+			if got := texts(ring.Recent(LevelInfo)); got != strings.Join(tt.want, ",") {
+				t.Fatalf("lines after restore = %s, want %s", got, strings.Join(tt.want, ","))
+			}
+
+			fmt.Fprintln(ring, tt.thenLine)
+			want := append(tt.want, tt.thenLine)
+			if len(want) > tt.size {
+				want = want[len(want)-tt.size:]
+			}
+			if got := texts(ring.Recent(LevelInfo)); got != strings.Join(want, ",") {
+				t.Errorf("lines after new line = %s, want %s", got, strings.Join(want, ","))
+			}
+		})
+	}
+}
+
+func texts(lines []Line) string {
+	texts := []string{}
+	for _, line := range lines {
+		texts = append(texts, line.Text)
+	}
+	return strings.Join(texts, ",")
+}
@@ -0,0 +1,154 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AccessLogBodyLen is the maximum number of body bytes kept for access log
+const AccessLogBodyLen = 4096
+
+// redacted is written instead of the value of sensitive field
+const redacted = "[REDACTED]"
+
+// sensitiveFields are json fields and query keys (case-insensitive) whose values are never written to access log
+var sensitiveFields = map[string]bool{
+	"password":        true,
+	"currentpassword": true,
+	"pw":              true,
+	"token":           true,
+	"admintoken":      true,
+	"signature":       true,
+	"secret":          true,
+	"authorization":   true,
+}
+
+// AccessLog wraps handler to log method, path, status and duration of each request
+// request and response bodies are logged as well when bodies is true (json and text only, sensitive fields are redacted)
+func AccessLog(next http.Handler, bodies bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		requestContentType := r.Header.Get("Content-Type")
+
+		var requestBody []byte
+		if bodies && isLoggableContentType(requestContentType) && r.Body != nil {
+			requestBody, _ = io.ReadAll(io.LimitReader(r.Body, AccessLogBodyLen+1))
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(requestBody), r.Body), r.Body}
+		}
+
+		recorder := &accessLogRecorder{
+			ResponseWriter: w,
+			status:         http.StatusOK,
+			keepBody:       bodies,
+		}
+		next.ServeHTTP(recorder, r)
+
+		line := "quics: access method=" + r.Method +
+			" path=" + r.URL.Path +
+			" query=" + redactQuery(r.URL.Query()) +
+			" status=" + strconv.Itoa(recorder.status) +
+			" duration=" + time.Since(start).String()
+		if bodies {
+			line += " request_body=" + redactBody(requestContentType, requestBody) +
+				" response_body=" + redactBody(recorder.Header().Get("Content-Type"), recorder.body)
+		}
+		log.Println(line)
+	})
+}
+
+// accessLogRecorder keeps status and the beginning of response body for access log
+type accessLogRecorder struct {
+	http.ResponseWriter
+	status   int
+	keepBody bool
+	body     []byte
+}
+
+func (ar *accessLogRecorder) WriteHeader(status int) {
+	ar.status = status
+	ar.ResponseWriter.WriteHeader(status)
+}
+
+func (ar *accessLogRecorder) Write(p []byte) (int, error) {
+	if ar.keepBody && len(ar.body) <= AccessLogBodyLen {
+		ar.body = append(ar.body, p[:min(len(p), AccessLogBodyLen+1-len(ar.body))]...)
+	}
+	return ar.ResponseWriter.Write(p)
+}
+
+// Flush keeps streaming responses (e.g., events, logs) working through access log
+func (ar *accessLogRecorder) Flush() {
+	if flusher, ok := ar.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func isLoggableContentType(contentType string) bool {
+	return strings.HasPrefix(contentType, "application/json") || strings.HasPrefix(contentType, "text/plain")
+}
+
+// redactQuery returns encoded query whose sensitive values are redacted
+func redactQuery(query url.Values) string {
+	for key := range query {
+		if sensitiveFields[strings.ToLower(key)] {
+			query[key] = []string{redacted}
+		}
+	}
+	return query.Encode()
+}
+
+// redactBody returns body whose sensitive json fields are redacted
+// binary (e.g., downloaded file), truncated or invalid json body is not written, because it can not be checked for sensitive fields
+func redactBody(contentType string, body []byte) string {
+	switch {
+	case len(body) == 0:
+		return `""`
+	case !isLoggableContentType(contentType):
+		return "(not logged)"
+	case len(body) > AccessLogBodyLen:
+		return "(truncated)"
+	case strings.HasPrefix(contentType, "text/plain"):
+		// e.g., error message of http.Error
+		return strconv.Quote(strings.TrimSpace(string(body)))
+	}
+
+	var value any
+	if err := json.Unmarshal(body, &value); err != nil {
+		return "(not logged)"
+	}
+
+	redactedBody, err := json.Marshal(redactValue(value))
+	if err != nil {
+		return "(not logged)"
+	}
+	return string(redactedBody)
+}
+
+func redactValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, field := range v {
+			if sensitiveFields[strings.ToLower(key)] {
+				v[key] = redacted
+				continue
+			}
+			v[key] = redactValue(field)
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = redactValue(item)
+		}
+	}
+	return value
+}
@@ -0,0 +1,48 @@
+package http
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ActivityTracker records when rest api was last used, so that server idle for a while can stop itself (e.g., --auto-stop-after)
+// requests in progress (e.g., event stream being watched) keep server busy until they end
+type ActivityTracker struct {
+	mut          sync.Mutex
+	inFlight     int
+	lastActivity time.Time
+}
+
+func NewActivityTracker() *ActivityTracker {
+	return &ActivityTracker{
+		lastActivity: time.Now(),
+	}
+}
+
+// Handler wraps next to record activity of every request when it begins and ends
+func (t *ActivityTracker) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.mut.Lock()
+		t.inFlight++
+		t.lastActivity = time.Now()
+		t.mut.Unlock()
+
+		defer func() {
+			t.mut.Lock()
+			t.inFlight--
+			t.lastActivity = time.Now()
+			t.mut.Unlock()
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// IdleSince returns when the last request ended, and false while any request is in progress
+func (t *ActivityTracker) IdleSince() (time.Time, bool) {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+
+	return t.lastActivity, t.inFlight == 0
+}
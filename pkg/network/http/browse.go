@@ -0,0 +1,114 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/quic-s/quics/pkg/config"
+	"github.com/quic-s/quics/pkg/utils"
+)
+
+// BrowsePath is the route of read-only directory index (enabled by --enable-browse)
+const BrowsePath = "/api/v1/server/browse"
+
+var browseTemplate = template.Must(template.New("browse").Funcs(template.FuncMap{
+	"browseURL":   browseURL,
+	"downloadURL": downloadURL,
+	"parentURL": func(afterPath string) string {
+		return browseURL(afterPath[:strings.LastIndex(afterPath, "/")+1])
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>quics: {{.AfterPath}}</title></head>
+<body>
+<h1>Index of {{.AfterPath}}</h1>
+<table>
+<tr><th>Name</th><th>Size</th><th>Modified</th><th>Download</th></tr>
+{{if ne .AfterPath "/"}}<tr><td><a href="{{parentURL .AfterPath}}">../</a></td><td></td><td></td><td></td></tr>
+{{end}}{{range .Entries}}{{if .IsDir}}<tr><td><a href="{{browseURL .AfterPath}}">{{.Name}}/</a></td><td>-</td><td></td><td></td></tr>
+{{else}}<tr><td><a href="{{downloadURL .AfterPath .LatestSyncTimestamp}}">{{.Name}}</a></td><td>{{.Size}}</td><td>{{.ModTime.UTC.Format "2006-01-02T15:04:05Z07:00"}}</td><td>
+<form action="/api/v1/server/download/files" method="get">
+<input type="hidden" name="afterPath" value="{{.AfterPath}}">
+<select name="timestamp">{{range .Versions}}<option value="{{.}}">version {{.}}</option>{{end}}</select>
+<input type="submit" value="Download">
+</form>
+</td></tr>
+{{end}}{{end}}</table>
+</body>
+</html>
+`))
+
+// Browse responds read-only directory index of stored files as html, or as json when client accepts application/json
+// e.g., GET /api/v1/server/browse/root/docs
+func (sh *ServerHandler) Browse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Alt-Svc", "h3=\":"+config.GetViperEnvVariables("REST_SERVER_H3_PORT")+"\"")
+	switch r.Method {
+	case "GET":
+		afterPath := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, BrowsePath), "/")
+		if afterPath == "" {
+			afterPath = "/"
+		}
+
+		// path is never joined to directories of quics here, but it is checked in the same way as other paths
+		if afterPath != "/" {
+			err := utils.ValidateAfterPath(afterPath)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		browseRes, err := sh.ServerService.Browse(afterPath)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if browseRes == nil {
+			http.Error(w, "nothing is stored at "+afterPath, http.StatusNotFound)
+			return
+		}
+
+		if strings.Contains(r.Header.Get("Accept"), "application/json") {
+			w.Header().Set("Content-Type", "application/json")
+
+			response, err := json.Marshal(browseRes)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			n, err := w.Write(response)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if n != len(response) {
+				http.Error(w, "failed to write response", http.StatusInternalServerError)
+				return
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		err = browseTemplate.Execute(w, browseRes)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// browseURL returns link to directory index of afterPath escaping each path component
+func browseURL(afterPath string) string {
+	u := &url.URL{Path: BrowsePath + afterPath}
+	return u.EscapedPath()
+}
+
+// downloadURL returns link to download file of afterPath at version of timestamp
+func downloadURL(afterPath string, timestamp uint64) string {
+	query := url.Values{"afterPath": {afterPath}, "timestamp": {fmt.Sprint(timestamp)}}
+	return "/api/v1/server/download/files?" + query.Encode()
+}
@@ -0,0 +1,147 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/quic-s/quics/pkg/types"
+)
+
+// CachedPaths are read-only endpoints which scan the whole database, so their responses are cached when cache ttl is set
+var CachedPaths = []string{
+	"/api/v1/server/logs/clients",
+	"/api/v1/server/logs/directories",
+	"/api/v1/server/logs/files",
+	"/api/v1/server/logs/files/orphaned",
+	"/api/v1/server/logs/histories",
+	"/api/v1/server/logs/clients/count",
+	"/api/v1/server/logs/directories/count",
+	"/api/v1/server/logs/files/count",
+	"/api/v1/server/logs/histories/count",
+	"/api/v1/server/diff/directories",
+}
+
+// ResponseCache keeps responses of CachedPaths for ttl, so that frequently polling dashboards do not trigger full scans
+// every cached response is dropped on mutation (any rest request other than GET, or change event of file synced by client)
+type ResponseCache struct {
+	ttl time.Duration
+
+	mut        sync.Mutex
+	generation uint64 // increased on every invalidation, so that response computed before mutation is not cached
+	responses  map[string]*cachedResponse
+}
+
+type cachedResponse struct {
+	header   http.Header
+	body     []byte
+	cachedAt time.Time
+}
+
+func NewResponseCache(ttl time.Duration) *ResponseCache {
+	return &ResponseCache{
+		ttl:       ttl,
+		responses: map[string]*cachedResponse{},
+	}
+}
+
+// Handler wraps next to serve GET requests of CachedPaths from cache (fresh=true bypasses it) and invalidates cache after any other request
+// reads carrying consistency token (If-Synced-To header or ifSyncedTo query) bypass it too, so that they always wait for their write
+func (rc *ResponseCache) Handler(next http.Handler) http.Handler {
+	cached := map[string]bool{}
+	for _, path := range CachedPaths {
+		cached[path] = true
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" && r.Method != "HEAD" {
+			next.ServeHTTP(w, r)
+			rc.Invalidate()
+			return
+		}
+		if r.Method != "GET" || !cached[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		query := r.URL.Query()
+		fresh := query.Get("fresh") == "true" || strings.TrimSpace(r.Header.Get("If-Synced-To")) != "" || query.Get("ifSyncedTo") != ""
+		query.Del("fresh")
+		query.Del("ifSyncedTo")
+		key := r.URL.Path + "?" + query.Encode()
+
+		rc.mut.Lock()
+		response, ok := rc.responses[key]
+		if ok && time.Since(response.cachedAt) >= rc.ttl {
+			delete(rc.responses, key)
+			ok = false
+		}
+		generation := rc.generation
+		rc.mut.Unlock()
+
+		w.Header().Set("Cache-Control", "max-age="+strconv.Itoa(int(rc.ttl.Seconds())))
+		if ok && !fresh {
+			for key, values := range response.header {
+				w.Header()[key] = values
+			}
+			w.Header().Set("Age", strconv.Itoa(int(time.Since(response.cachedAt).Seconds())))
+			w.Write(response.body)
+			return
+		}
+
+		w.Header().Set("Age", "0")
+		recorder := &cacheRecorder{
+			ResponseWriter: w,
+			status:         http.StatusOK,
+		}
+		next.ServeHTTP(recorder, r)
+		if recorder.status != http.StatusOK {
+			return
+		}
+
+		rc.mut.Lock()
+		defer rc.mut.Unlock()
+		if rc.generation == generation {
+			rc.responses[key] = &cachedResponse{
+				header:   w.Header().Clone(),
+				body:     recorder.body,
+				cachedAt: time.Now(),
+			}
+		}
+	})
+}
+
+// Invalidate drops every cached response
+func (rc *ResponseCache) Invalidate() {
+	rc.mut.Lock()
+	defer rc.mut.Unlock()
+
+	rc.generation++
+	rc.responses = map[string]*cachedResponse{}
+}
+
+// InvalidateOn invalidates cache on every event (e.g., file synced by client) until events is closed
+func (rc *ResponseCache) InvalidateOn(events <-chan types.Event) {
+	for range events {
+		rc.Invalidate()
+	}
+}
+
+// cacheRecorder keeps status and whole response body to cache it
+type cacheRecorder struct {
+	http.ResponseWriter
+	status int
+	body   []byte
+}
+
+func (cr *cacheRecorder) WriteHeader(status int) {
+	cr.status = status
+	cr.ResponseWriter.WriteHeader(status)
+}
+
+func (cr *cacheRecorder) Write(p []byte) (int, error) {
+	cr.body = append(cr.body, p...)
+	return cr.ResponseWriter.Write(p)
+}
@@ -0,0 +1,187 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/quic-s/quics/pkg/types"
+)
+
+func TestResponseCache(t *testing.T) {
+	const listPath = "/api/v1/server/logs/files"
+
+	type step struct {
+		method   string
+		target   string
+		syncedTo string // If-Synced-To header of request
+		event    bool   // publish change event instead of request
+		want     string // body of response (number of requests served by handler so far)
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "listing is cached",
+			steps: []step{
+				{method: "GET", target: listPath, want: "1"},
+				{method: "GET", target: listPath, want: "1"},
+			},
+		},
+		{
+			name: "write invalidates cache",
+			steps: []step{
+				{method: "GET", target: listPath, want: "1"},
+				{method: "POST", target: "/api/v1/server/upload/files", want: "2"},
+				{method: "GET", target: listPath, want: "3"},
+			},
+		},
+		{
+			name: "change event invalidates cache",
+			steps: []step{
+				{method: "GET", target: listPath, want: "1"},
+				{event: true},
+				{method: "GET", target: listPath, want: "2"},
+			},
+		},
+		{
+			name: "fresh bypasses cache and caches new response",
+			steps: []step{
+				{method: "GET", target: listPath, want: "1"},
+				{method: "GET", target: listPath + "?fresh=true", want: "2"},
+				{method: "GET", target: listPath, want: "2"},
+			},
+		},
+		{
+			name: "if-synced-to header bypasses cache",
+			steps: []step{
+				{method: "GET", target: listPath, want: "1"},
+				{method: "GET", target: listPath, syncedTo: "token", want: "2"},
+				{method: "GET", target: listPath, want: "2"},
+			},
+		},
+		{
+			name: "ifSyncedTo query bypasses cache",
+			steps: []step{
+				{method: "GET", target: listPath, want: "1"},
+				{method: "GET", target: listPath + "?ifSyncedTo=token", want: "2"},
+				{method: "GET", target: listPath + "?ifSyncedTo=token", want: "3"},
+				{method: "GET", target: listPath, want: "3"},
+			},
+		},
+		{
+			name: "not synced read is not cached",
+			steps: []step{
+				{method: "GET", target: listPath, want: "1"},
+				{method: "GET", target: listPath, syncedTo: "unsynced", want: "2"},
+				{method: "GET", target: listPath, want: "1"},
+			},
+		},
+		{
+			name: "queries are cached apart",
+			steps: []step{
+				{method: "GET", target: listPath + "?afterPath=/a", want: "1"},
+				{method: "GET", target: listPath + "?afterPath=/b", want: "2"},
+				{method: "GET", target: listPath + "?afterPath=/a", want: "1"},
+			},
+		},
+		{
+			name: "head does not invalidate cache",
+			steps: []step{
+				{method: "GET", target: listPath, want: "1"},
+				{method: "HEAD", target: listPath},
+				{method: "GET", target: listPath, want: "1"},
+			},
+		},
+		{
+			name: "other path is not cached",
+			steps: []step{
+				{method: "GET", target: "/api/v1/server/logs/bulk", want: "1"},
+				{method: "GET", target: "/api/v1/server/logs/bulk", want: "2"},
+			},
+		},
+		{
+			name: "error response is not cached",
+			steps: []step{
+				{method: "GET", target: listPath + "?fail=true", want: "1"},
+				{method: "GET", target: listPath + "?fail=true", want: "2"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			served := 0
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				served++
+				if r.URL.Query().Get("fail") == "true" {
+					w.WriteHeader(http.StatusInternalServerError)
+				}
+				// like waitSynced, read of write which is not visible yet is rejected
+				if r.Header.Get("If-Synced-To") == "unsynced" {
+					w.WriteHeader(http.StatusServiceUnavailable)
+				}
+				fmt.Fprint(w, served)
+			})
+			rc := NewResponseCache(time.Minute)
+			handler := rc.Handler(next)
+
+			for i, step := range tt.steps {
+				if step.event {
+					events := make(chan types.Event)
+					done := make(chan struct{})
+					go func() {
+						rc.InvalidateOn(events)
+						close(done)
+					}()
+					events <- types.Event{Type: "sync", AfterPath: "/r/a"}
+					close(events)
+					<-done
+					continue
+				}
+
+				recorder := httptest.NewRecorder()
+				request := httptest.NewRequest(step.method, step.target, nil)
+				if step.syncedTo != "" {
+					request.Header.Set("If-Synced-To", step.syncedTo)
+				}
+				handler.ServeHTTP(recorder, request)
+				if step.method == "HEAD" {
+					continue
+				}
+				if got := recorder.Body.String(); got != step.want {
+					t.Fatalf("step %d (%s %s) = %s, want %s", i, step.method, step.target, got, step.want)
+				}
+				if step.method == "GET" && strings.HasPrefix(step.target, listPath) && recorder.Header().Get("Age") == "" {
+					t.Errorf("step %d (%s %s) has no Age header", i, step.method, step.target)
+				}
+			}
+		})
+	}
+}
+
+func TestResponseCacheExpires(t *testing.T) {
+	served := 0
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served++
+		fmt.Fprint(w, served)
+	})
+	handler := NewResponseCache(10 * time.Millisecond).Handler(next)
+
+	get := func() string {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/api/v1/server/logs/clients", nil))
+		return recorder.Body.String()
+	}
+	if got := get(); got != "1" {
+		t.Fatalf("first response = %s, want 1", got)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if got := get(); got != "2" {
+		t.Errorf("response after ttl = %s, want 2", got)
+	}
+}
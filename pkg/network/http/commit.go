@@ -0,0 +1,135 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/quic-s/quics/pkg/config"
+	"github.com/quic-s/quics/pkg/types"
+	"github.com/quic-s/quics/pkg/utils"
+)
+
+// CommitSets opens commit set (POST), shows it (GET) or aborts it (DELETE)
+// e.g., POST /api/v1/server/commits?name=release, GET /api/v1/server/commits?id=...
+func (sh *ServerHandler) CommitSets(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Alt-Svc", "h3=\":"+config.GetViperEnvVariables("REST_SERVER_H3_PORT")+"\"")
+	switch r.Method {
+	case "POST":
+		commitSet, err := sh.ServerService.OpenCommitSet(r.URL.Query().Get("name"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		writeCommitSet(w, commitSet)
+	case "GET":
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			http.Error(w, "id is required", http.StatusBadRequest)
+			return
+		}
+
+		commitSet, err := sh.ServerService.GetCommitSet(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		writeCommitSet(w, commitSet)
+	case "DELETE":
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			http.Error(w, "id is required", http.StatusBadRequest)
+			return
+		}
+
+		err := sh.ServerService.AbortCommitSet(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// StageCommitFile stages request body as member afterPath of open commit set
+// e.g., POST /api/v1/server/commits/upload?id=...&afterPath=/root/a.txt
+func (sh *ServerHandler) StageCommitFile(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Alt-Svc", "h3=\":"+config.GetViperEnvVariables("REST_SERVER_H3_PORT")+"\"")
+	switch r.Method {
+	case "POST":
+		id := r.URL.Query().Get("id")
+		afterPath := r.URL.Query().Get("afterPath")
+		if id == "" || afterPath == "" {
+			http.Error(w, "id and afterPath are required", http.StatusBadRequest)
+			return
+		}
+
+		// afterPath is joined to sync and history directories, so it must not climb out of them
+		err := utils.ValidateAfterPath(afterPath)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// size of contents must be known to save file with its metadata
+		if r.ContentLength < 0 {
+			http.Error(w, "Content-Length is required", http.StatusLengthRequired)
+			return
+		}
+
+		commitSet, err := sh.ServerService.StageCommitFile(id, afterPath, r.ContentLength, r.Body)
+		if writePathLimitError(w, err) || writeDiskError(w, err) {
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		writeCommitSet(w, commitSet)
+	}
+}
+
+// CommitSet commits every staged member of commit set at once
+// e.g., POST /api/v1/server/commits/commit?id=...
+func (sh *ServerHandler) CommitSet(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Alt-Svc", "h3=\":"+config.GetViperEnvVariables("REST_SERVER_H3_PORT")+"\"")
+	switch r.Method {
+	case "POST":
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			http.Error(w, "id is required", http.StatusBadRequest)
+			return
+		}
+
+		commitSet, err := sh.ServerService.CommitSet(id)
+		if writeDiskError(w, err) {
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		writeCommitSet(w, commitSet)
+	}
+}
+
+func writeCommitSet(w http.ResponseWriter, commitSet *types.CommitSet) {
+	w.Header().Set("Content-Type", "application/json")
+
+	response, err := json.Marshal(commitSet)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	n, err := w.Write(response)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n != len(response) {
+		http.Error(w, "failed to write response", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,136 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/quic-s/quics/pkg/types"
+)
+
+// RedactedPaths are listing endpoints whose responses are redacted by REDACT_FIELDS, mapped to names which rules are scoped to
+var RedactedPaths = map[string]string{
+	"/api/v1/server/logs/clients":               "clients",
+	"/api/v1/server/logs/directories":           "directories",
+	"/api/v1/server/logs/directories/conflicts": "conflicts",
+	"/api/v1/server/logs/files":                 "files",
+	"/api/v1/server/logs/files/orphaned":        "orphaned",
+	"/api/v1/server/logs/files/duplicates":      "duplicates",
+	"/api/v1/server/logs/histories":             "histories",
+	"/api/v1/server/logs/paths":                 "paths",
+	"/api/v1/server/logs/lineage":               "lineage",
+	"/api/v1/server/locks":                      "locks",
+}
+
+// Redact wraps next to hide fields of rules from json responses of RedactedPaths, so that listings can be exposed to less trusted
+// callers; caller whose AdminTokenHeader is accepted by isAdmin is served as is (e.g., qis on server machine)
+func Redact(next http.Handler, rules []types.RedactRule, isAdmin func(token string) bool) http.Handler {
+	// modes of lower-cased fields by path, so that each response is redacted in a single walk
+	fieldsByPath := map[string]map[string]string{}
+	for path, endpoint := range RedactedPaths {
+		fields := map[string]string{}
+		for _, rule := range rules {
+			if rule.Endpoint != "" && rule.Endpoint != endpoint {
+				continue
+			}
+			// mask wins over strip, so that field masked by a rule is never removed by another one
+			if fields[strings.ToLower(rule.Field)] != types.RedactMask {
+				fields[strings.ToLower(rule.Field)] = rule.Mode
+			}
+		}
+		if len(fields) != 0 {
+			fieldsByPath[path] = fields
+		}
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fields, ok := fieldsByPath[r.URL.Path]
+		if !ok || r.Method != "GET" || isAdmin(r.Header.Get(types.AdminTokenHeader)) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		recorder := &redactRecorder{
+			ResponseWriter: w,
+			status:         http.StatusOK,
+		}
+		next.ServeHTTP(recorder, r)
+
+		body := recorder.body.Bytes()
+		if recorder.status == http.StatusOK && strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+			// numbers are kept as they are, so that large ids and timestamps do not lose precision
+			decoder := json.NewDecoder(bytes.NewReader(body))
+			decoder.UseNumber()
+			var value any
+			err := decoder.Decode(&value)
+			if err == nil {
+				body, err = json.Marshal(redactFields(value, fields))
+			}
+			// fail closed: response which can not be redacted is never sent as is
+			if err != nil {
+				http.Error(w, "failed to redact response: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set(types.RedactedHeader, "true")
+			w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		}
+
+		w.WriteHeader(recorder.status)
+		w.Write(body)
+	})
+}
+
+// redactFields strips or masks fields of json value decoded into any at any depth
+func redactFields(value any, fields map[string]string) any {
+	switch value := value.(type) {
+	case map[string]any:
+		for key, child := range value {
+			switch fields[strings.ToLower(key)] {
+			case types.RedactStrip:
+				delete(value, key)
+			case types.RedactMask:
+				value[key] = maskValue(child)
+			default:
+				value[key] = redactFields(child, fields)
+			}
+		}
+	case []any:
+		for i, child := range value {
+			value[i] = redactFields(child, fields)
+		}
+	}
+
+	return value
+}
+
+// maskValue replaces strings (also in arrays) with redacted, and other values with null
+func maskValue(value any) any {
+	switch value := value.(type) {
+	case string:
+		return redacted
+	case []any:
+		for i, child := range value {
+			value[i] = maskValue(child)
+		}
+		return value
+	}
+
+	return nil
+}
+
+// redactRecorder keeps response of next in memory until it is redacted
+type redactRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rr *redactRecorder) WriteHeader(status int) {
+	rr.status = status
+}
+
+func (rr *redactRecorder) Write(p []byte) (int, error) {
+	return rr.body.Write(p)
+}
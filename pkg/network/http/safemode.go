@@ -0,0 +1,52 @@
+package http
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/quic-s/quics/pkg/types"
+)
+
+// SafeModeAllowedPaths are endpoints which are still served for methods other than GET in safe mode (e.g., to stop server)
+var SafeModeAllowedPaths = []string{
+	"/api/v1/server/stop",
+}
+
+// SafeModeRejectedPaths are GET endpoints which write to the store, so they are rejected in safe mode as well
+// (e.g., download of shared link counts its uses)
+var SafeModeRejectedPaths = []string{
+	"/api/v1/download/files",
+}
+
+// SafeMode wraps next to reject writes with 503 and SAFE_MODE while server runs in safe mode,
+// so that operator can inspect and export the store without anything changing it
+func SafeMode(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isSafeModeWrite(r) {
+			log.Println("quics alert: ", "write rejected in safe mode: ", r.Method, " ", r.URL.Path)
+			http.Error(w, types.SafeMode+": server is running in safe mode, so writes are rejected (restart server without --safe-mode to write)", http.StatusServiceUnavailable)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func isSafeModeWrite(r *http.Request) bool {
+	for _, path := range SafeModeRejectedPaths {
+		if r.URL.Path == path {
+			return true
+		}
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	for _, path := range SafeModeAllowedPaths {
+		if r.URL.Path == path {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,94 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/quic-s/quics/pkg/utils"
+)
+
+// ScanRetryAfter is seconds which client is asked to wait when too many scans are running
+const ScanRetryAfter = "1"
+
+// ScanPaths are endpoints which iterate the whole database, mapped to query parameter which narrows them down to a single record
+// (empty: always a full scan), so that e.g. show file --id is not limited but show file --all is
+var ScanPaths = map[string]string{
+	"/api/v1/server/logs/clients":           "uuid",
+	"/api/v1/server/logs/directories":       "afterPath",
+	"/api/v1/server/logs/files":             "afterPath",
+	"/api/v1/server/logs/files/orphaned":    "",
+	"/api/v1/server/logs/files/duplicates":  "",
+	"/api/v1/server/logs/histories":         "afterPath",
+	"/api/v1/server/logs/clients/count":     "",
+	"/api/v1/server/logs/directories/count": "",
+	"/api/v1/server/logs/files/count":       "",
+	"/api/v1/server/logs/histories/count":   "",
+	"/api/v1/server/logs/paths":             "",
+	"/api/v1/server/logs/lineage":           "",
+	"/api/v1/server/locks":                  "",
+	"/api/v1/server/files/tags/bulk":        "",
+	"/api/v1/server/diff/directories":       "",
+	"/api/v1/server/remove/files/orphaned":  "",
+	"/api/v1/server/reindex":                "",
+	"/api/v1/server/db/stats":               "",
+}
+
+// ScanLimiter limits the number of full scans running at once server-wide
+// excess scans wait in queue (as many as running ones), and scans beyond the queue are rejected with 503 and Retry-After
+type ScanLimiter struct {
+	running chan struct{}
+	queued  chan struct{}
+}
+
+func NewScanLimiter(maxScans int) *ScanLimiter {
+	return &ScanLimiter{
+		running: make(chan struct{}, maxScans),
+		queued:  make(chan struct{}, maxScans),
+	}
+}
+
+// Handler wraps next to run full scans within the limit (requests of a single record are passed through)
+func (sl *ScanLimiter) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isScan(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		select {
+		case sl.running <- struct{}{}:
+		default:
+			select {
+			case sl.queued <- struct{}{}:
+			default:
+				w.Header().Set("Retry-After", ScanRetryAfter)
+				http.Error(w, "too many scans are running, retry later", http.StatusServiceUnavailable)
+				return
+			}
+
+			select {
+			case sl.running <- struct{}{}:
+				<-sl.queued
+			case <-r.Context().Done():
+				<-sl.queued
+				return
+			}
+		}
+		defer func() { <-sl.running }()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isScan checks whether r iterates the whole database (e.g., without afterPath, or with glob pattern or tags only)
+func isScan(r *http.Request) bool {
+	key, ok := ScanPaths[r.URL.Path]
+	if !ok {
+		return false
+	}
+	if key == "" {
+		return true
+	}
+
+	value := r.URL.Query().Get(key)
+	return value == "" || utils.IsGlobPattern(value)
+}
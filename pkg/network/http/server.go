@@ -1,19 +1,47 @@
 package http
 
 import (
+	"compress/gzip"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/quic-s/quics/pkg/config"
+	"github.com/quic-s/quics/pkg/convert"
 	"github.com/quic-s/quics/pkg/core/server"
+	"github.com/quic-s/quics/pkg/core/sync"
+	"github.com/quic-s/quics/pkg/logs"
 	"github.com/quic-s/quics/pkg/types"
 	"github.com/quic-s/quics/pkg/utils"
+	"golang.org/x/exp/slices"
 )
 
+// DefaultPageLimit is the number of items of list response when limit is not given (limit=0 means no limit)
+const DefaultPageLimit = 100
+
+// DefaultLockTTL is the lifetime of file lock when ttl is not given
+const DefaultLockTTL = 5 * time.Minute
+
+// ClientsPath is the route of actions of a client addressed by its uuid (e.g., ClientsPath/{uuid}/sync)
+const ClientsPath = "/api/v1/server/clients"
+
+// DefaultTransferStatsPeriod and DefaultTransferStatsBucket are used for transfer stats when since and bucket are not given
+const (
+	DefaultTransferStatsPeriod = 24 * time.Hour
+	DefaultTransferStatsBucket = time.Hour
+)
+
+// BulkRetryAfter is seconds which client is asked to wait when another destructive bulk operation is running
+const BulkRetryAfter = "5"
+
 type ServerHandler struct {
 	ServerService server.Service
 }
@@ -32,11 +60,64 @@ func (sh *ServerHandler) SetupRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/api/v1/server/logs/clients", sh.ShowClientLogs)
 	mux.HandleFunc("/api/v1/server/logs/directories", sh.ShowDirLogs)
 	mux.HandleFunc("/api/v1/server/logs/files", sh.ShowFileLogs)
+	mux.HandleFunc("/api/v1/server/logs/files/orphaned", sh.ShowOrphanedFileLogs)
+	mux.HandleFunc("/api/v1/server/logs/files/duplicates", sh.ShowDuplicateFileLogs)
+	mux.HandleFunc("/api/v1/server/logs/directories/conflicts", sh.ShowConflictLogs)
 	mux.HandleFunc("/api/v1/server/logs/histories", sh.ShowHistoryLogs)
+	mux.HandleFunc("/api/v1/server/logs/bulk", sh.ShowBulkLogs)
+	mux.HandleFunc("/api/v1/server/logs/clients/count", sh.CountClientLogs)
+	mux.HandleFunc("/api/v1/server/logs/directories/count", sh.CountDirLogs)
+	mux.HandleFunc("/api/v1/server/logs/files/count", sh.CountFileLogs)
+	mux.HandleFunc("/api/v1/server/logs/histories/count", sh.CountHistoryLogs)
 	mux.HandleFunc("/api/v1/server/remove/clients", sh.RemoveClient)
 	mux.HandleFunc("/api/v1/server/remove/directories", sh.RemoveDir)
 	mux.HandleFunc("/api/v1/server/remove/files", sh.RemoveFile)
+	mux.HandleFunc("/api/v1/server/remove/files/orphaned", sh.RemoveOrphanedFile)
+	mux.HandleFunc("/api/v1/server/move/directories", sh.MoveDir)
+	mux.HandleFunc("/api/v1/server/move/files", sh.MoveFile)
+	mux.HandleFunc("/api/v1/server/set/directories", sh.SetDir)
+	mux.HandleFunc("/api/v1/server/set/files", sh.SetFile)
+	mux.HandleFunc("/api/v1/server/policy/explain", sh.ExplainPolicy)
+	mux.HandleFunc("/api/v1/server/logs/paths", sh.ShowPaths)
+	mux.HandleFunc("/api/v1/server/logs/lineage", sh.ShowFileLineage)
+	mux.HandleFunc("/api/v1/server/files/lock", sh.LockFile)
+	mux.HandleFunc("/api/v1/server/locks", sh.ShowLocks)
+	mux.HandleFunc("/api/v1/server/locks/break", sh.BreakLock)
+	mux.HandleFunc("/api/v1/server/files/tags", sh.TagFile)
+	mux.HandleFunc("/api/v1/server/files/tags/bulk", sh.TagFiles)
+	mux.HandleFunc("/api/v1/server/files/metadata", sh.SetFileMetadata)
+	mux.HandleFunc("/api/v1/server/conflicts/resolve", sh.ResolveConflict)
+	mux.HandleFunc("/api/v1/server/diff/directories", sh.DiffDir)
+	mux.HandleFunc("/api/v1/server/metrics", sh.GetMetrics)
+	mux.HandleFunc("/api/v1/server/health", sh.GetHealth)
+	mux.HandleFunc("/api/v1/server/stats/transfers", sh.GetTransferStats)
+	mux.HandleFunc("/api/v1/server/subscribe/clients", sh.SubscribeClient)
+	mux.HandleFunc("/api/v1/server/schedule/clients", sh.SetClientSchedule)
+	mux.HandleFunc(ClientsPath+"/", sh.SyncClientNow)
+	mux.HandleFunc("/api/v1/server/unsubscribe/clients", sh.UnsubscribeClient)
+	mux.HandleFunc("/api/v1/server/provision/clients", sh.ProvisionClients)
+	mux.HandleFunc("/api/v1/server/upload/files", sh.UploadFile)
 	mux.HandleFunc("/api/v1/server/download/files", sh.DownloadFile)
+	mux.HandleFunc("/api/v1/server/download/signed", sh.DownloadSignedFile)
+	mux.HandleFunc("/api/v1/server/digest/files", sh.DigestFile)
+	mux.HandleFunc("/api/v1/server/versions/resolve", sh.ResolveVersion)
+	mux.HandleFunc("/api/v1/server/share/files", sh.ShareFile)
+	mux.HandleFunc("/api/v1/server/share/rotate", sh.RotateSigningKey)
+	mux.HandleFunc("/api/v1/server/commits", sh.CommitSets)
+	mux.HandleFunc("/api/v1/server/commits/upload", sh.StageCommitFile)
+	mux.HandleFunc("/api/v1/server/commits/commit", sh.CommitSet)
+	mux.HandleFunc("/api/v1/server/scrub", sh.Scrub)
+	mux.HandleFunc("/api/v1/server/reindex", sh.Reindex)
+	mux.HandleFunc("/api/v1/server/checkpoint", sh.Checkpoint)
+	mux.HandleFunc("/api/v1/server/db/stats", sh.DBStats)
+	mux.HandleFunc("/api/v1/server/db/compact", sh.CompactDB)
+	mux.HandleFunc("/api/v1/server/events", sh.Events)
+	mux.HandleFunc("/api/v1/server/logs/stream", sh.StreamLogs)
+
+	// directory index is served only when it is enabled (e.g., qis start --enable-browse)
+	if config.GetViperEnvVariables("BROWSE") == "true" {
+		mux.HandleFunc(BrowsePath+"/", sh.Browse)
+	}
 }
 
 func (sh *ServerHandler) StopRestServer(w http.ResponseWriter, r *http.Request) {
@@ -67,7 +148,7 @@ func (sh *ServerHandler) SetPassword(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Alt-Svc", "h3=\":"+config.GetViperEnvVariables("REST_SERVER_H3_PORT")+"\"")
 	switch r.Method {
 	case "POST":
-		body := &types.Server{}
+		body := &types.SetPasswordReq{}
 
 		buf := make([]byte, r.ContentLength)
 		n, err := r.Body.Read(buf)
@@ -82,11 +163,20 @@ func (sh *ServerHandler) SetPassword(w http.ResponseWriter, r *http.Request) {
 
 		err = utils.UnmarshalRequestBody(buf, body)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if body.Password == "" {
+			http.Error(w, "new password is required", http.StatusBadRequest)
 			return
 		}
 
 		err = sh.ServerService.SetPassword(body)
+		if errors.Is(err, server.ErrWrongPassword) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -98,7 +188,24 @@ func (sh *ServerHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Alt-Svc", "h3=\":"+config.GetViperEnvVariables("REST_SERVER_H3_PORT")+"\"")
 	switch r.Method {
 	case "POST":
-		err := sh.ServerService.ResetPassword()
+		buf, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		body := &types.ResetPasswordReq{}
+		err = utils.UnmarshalRequestBody(buf, body)
+		if err != nil {
+			http.Error(w, "admin token is required: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		err = sh.ServerService.ResetPassword(body)
+		if errors.Is(err, server.ErrInvalidAdminToken) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -111,8 +218,25 @@ func (sh *ServerHandler) ShowClientLogs(w http.ResponseWriter, r *http.Request)
 	switch r.Method {
 	case "GET":
 		uuid := r.URL.Query().Get("uuid")
+		root := r.URL.Query().Get("root")
+		if uuid != "" {
+			if err := utils.ValidateUUID(uuid); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		pageReq, err := getPageReq(r, DefaultPageLimit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		filter, err := getLogFilter(r, "owner", "prefix", "uuid")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
-		clients, err := sh.ServerService.ShowClient(uuid)
+		clients, err := sh.ServerService.ShowClient(uuid, root, filter, pageReq)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -141,9 +265,19 @@ func (sh *ServerHandler) ShowDirLogs(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Alt-Svc", "h3=\":"+config.GetViperEnvVariables("REST_SERVER_H3_PORT")+"\"")
 	switch r.Method {
 	case "GET":
-		afterPath := r.URL.Query().Get("afterpath")
+		afterPath := r.URL.Query().Get("afterPath")
+		pageReq, err := getPageReq(r, DefaultPageLimit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		filter, err := getLogFilter(r, "owner", "prefix", "uuid")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
-		dirs, err := sh.ServerService.ShowDir(afterPath)
+		dirs, err := sh.ServerService.ShowDir(afterPath, filter, pageReq)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -172,9 +306,31 @@ func (sh *ServerHandler) ShowFileLogs(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Alt-Svc", "h3=\":"+config.GetViperEnvVariables("REST_SERVER_H3_PORT")+"\"")
 	switch r.Method {
 	case "GET":
-		afterPath := r.URL.Query().Get("afterpath")
+		afterPath := r.URL.Query().Get("afterPath")
+		pageReq, err := getPageReq(r, DefaultPageLimit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if utils.IsGlobPattern(afterPath) {
+			err = utils.ValidateGlobPattern(afterPath)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		filter, err := getLogFilter(r, logFilterParams...)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if !sh.waitSynced(w, r) {
+			return
+		}
 
-		files, err := sh.ServerService.ShowFile(afterPath)
+		files, err := sh.ServerService.ShowFile(afterPath, filter, pageReq)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -199,13 +355,18 @@ func (sh *ServerHandler) ShowFileLogs(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (sh *ServerHandler) ShowHistoryLogs(w http.ResponseWriter, r *http.Request) {
+// ShowOrphanedFileLogs returns files whose root directory does not exist anymore
+func (sh *ServerHandler) ShowOrphanedFileLogs(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Alt-Svc", "h3=\":"+config.GetViperEnvVariables("REST_SERVER_H3_PORT")+"\"")
 	switch r.Method {
 	case "GET":
-		afterPath := r.URL.Query().Get("afterpath")
+		pageReq, err := getPageReq(r, DefaultPageLimit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
-		histories, err := sh.ServerService.ShowHistory(afterPath)
+		files, err := sh.ServerService.ShowOrphanedFile(pageReq)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -213,7 +374,7 @@ func (sh *ServerHandler) ShowHistoryLogs(w http.ResponseWriter, r *http.Request)
 
 		w.Header().Set("Content-Type", "application/json")
 
-		response, err := json.Marshal(histories)
+		response, err := json.Marshal(files)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -230,77 +391,2340 @@ func (sh *ServerHandler) ShowHistoryLogs(w http.ResponseWriter, r *http.Request)
 	}
 }
 
-func (sh *ServerHandler) RemoveClient(w http.ResponseWriter, r *http.Request) {
+// ShowDuplicateFileLogs returns sets of files whose latest contents are identical, narrowed by filter of logs endpoints
+// e.g., GET /api/v1/server/logs/files/duplicates?prefix=/root/photos
+func (sh *ServerHandler) ShowDuplicateFileLogs(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Alt-Svc", "h3=\":"+config.GetViperEnvVariables("REST_SERVER_H3_PORT")+"\"")
 	switch r.Method {
-	case "POST":
-		afterPath := r.URL.Query().Get("afterpath")
+	case "GET":
+		filter, err := getLogFilter(r, logFilterParams...)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		duplicatesRes, err := sh.ServerService.ShowDuplicateFile(filter)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
 
-		err := sh.ServerService.RemoveClient(afterPath)
+		response, err := json.Marshal(duplicatesRes)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		n, err := w.Write(response)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		if n != len(response) {
+			http.Error(w, "failed to write response", http.StatusInternalServerError)
+			return
+		}
 	}
 }
 
-func (sh *ServerHandler) RemoveDir(w http.ResponseWriter, r *http.Request) {
+// ShowConflictLogs returns unresolved conflicts grouped by root directory, with competing versions of each conflicted file
+// e.g., GET /api/v1/server/logs/directories/conflicts?afterPath=/root
+func (sh *ServerHandler) ShowConflictLogs(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Alt-Svc", "h3=\":"+config.GetViperEnvVariables("REST_SERVER_H3_PORT")+"\"")
 	switch r.Method {
-	case "POST":
-		afterPath := r.URL.Query().Get("afterpath")
+	case "GET":
+		afterPath := r.URL.Query().Get("afterPath")
 
-		err := sh.ServerService.RemoveDir(afterPath)
+		conflictsRes, err := sh.ServerService.ShowConflicts(afterPath)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		response, err := json.Marshal(conflictsRes)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		n, err := w.Write(response)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		if n != len(response) {
+			http.Error(w, "failed to write response", http.StatusInternalServerError)
+			return
+		}
 	}
 }
 
-func (sh *ServerHandler) RemoveFile(w http.ResponseWriter, r *http.Request) {
+// ResolveConflict resolves conflict of the file by keeping version of keep ("server" or UUID of client which uploaded it)
+// e.g., POST /api/v1/server/conflicts/resolve?afterPath=/root/a.txt&keep=server
+func (sh *ServerHandler) ResolveConflict(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Alt-Svc", "h3=\":"+config.GetViperEnvVariables("REST_SERVER_H3_PORT")+"\"")
 	switch r.Method {
 	case "POST":
-		afterPath := r.URL.Query().Get("afterpath")
+		afterPath := r.URL.Query().Get("afterPath")
+		if afterPath == "" {
+			http.Error(w, "afterPath is required", http.StatusBadRequest)
+			return
+		}
+		keep := r.URL.Query().Get("keep")
+		if keep == "" {
+			http.Error(w, "keep is required (server or uuid of client)", http.StatusBadRequest)
+			return
+		}
+
+		file, err := sh.ServerService.ResolveConflict(afterPath, keep)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 
-		err := sh.ServerService.RemoveFile(afterPath)
+		w.Header().Set("Content-Type", "application/json")
+
+		response, err := json.Marshal(file)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		n, err := w.Write(response)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		if n != len(response) {
+			http.Error(w, "failed to write response", http.StatusInternalServerError)
+			return
+		}
 	}
 }
 
-func (sh *ServerHandler) DownloadFile(w http.ResponseWriter, r *http.Request) {
+func (sh *ServerHandler) ShowHistoryLogs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Alt-Svc", "h3=\":"+config.GetViperEnvVariables("REST_SERVER_H3_PORT")+"\"")
+	switch r.Method {
+	case "GET":
+		afterPath := r.URL.Query().Get("afterPath")
+		pageReq, err := getPageReq(r, getHistoryLimit())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if utils.IsGlobPattern(afterPath) {
+			err = utils.ValidateGlobPattern(afterPath)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		// tags belong to files, not to their versions
+		filter, err := getLogFilter(r, "owner", "prefix", "uuid", "since", "until", "minSize", "maxSize")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var histories *types.Page[types.FileHistory]
+		if commitID := r.URL.Query().Get("commit"); commitID != "" {
+			histories, err = sh.ServerService.ShowCommitHistory(commitID, filter, pageReq)
+		} else {
+			histories, err = sh.ServerService.ShowHistory(afterPath, filter, pageReq)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		response, err := json.Marshal(histories)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		n, err := w.Write(response)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if n != len(response) {
+			http.Error(w, "failed to write response", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// ShowBulkLogs returns progress of destructive bulk operation which is running (e.g., remove dir --all)
+func (sh *ServerHandler) ShowBulkLogs(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Alt-Svc", "h3=\":"+config.GetViperEnvVariables("REST_SERVER_H3_PORT")+"\"")
 	switch r.Method {
 	case "GET":
-		afterPath := r.URL.Query().Get("afterpath")
-		timestamp, err := strconv.Atoi(r.URL.Query().Get("timestamp"))
+		progress := sh.ServerService.ShowBulkOperation()
+
+		w.Header().Set("Content-Type", "application/json")
+
+		response, err := json.Marshal(progress)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		n, err := w.Write(response)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		if n != len(response) {
+			http.Error(w, "failed to write response", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// CountClientLogs returns the number of clients narrowed by filter (owner, prefix, uuid) without listing them
+// e.g., GET /api/v1/server/logs/clients/count?owner=alice
+func (sh *ServerHandler) CountClientLogs(w http.ResponseWriter, r *http.Request) {
+	sh.countLogs(w, r, sh.ServerService.CountClient, "owner", "prefix", "uuid")
+}
+
+// CountDirLogs returns the number of root directories narrowed by filter (owner, prefix, uuid) without listing them
+func (sh *ServerHandler) CountDirLogs(w http.ResponseWriter, r *http.Request) {
+	sh.countLogs(w, r, sh.ServerService.CountDir, "owner", "prefix", "uuid")
+}
+
+// CountFileLogs returns the number of files narrowed by filter without listing them
+// e.g., GET /api/v1/server/logs/files/count?prefix=/root/photos
+func (sh *ServerHandler) CountFileLogs(w http.ResponseWriter, r *http.Request) {
+	sh.countLogs(w, r, sh.ServerService.CountFile, logFilterParams...)
+}
+
+// CountHistoryLogs returns the number of histories narrowed by filter without listing them
+func (sh *ServerHandler) CountHistoryLogs(w http.ResponseWriter, r *http.Request) {
+	sh.countLogs(w, r, sh.ServerService.CountHistory, "owner", "prefix", "uuid", "since", "until", "minSize", "maxSize")
+}
+
+// countLogs responds the number of entries counted by count with filter of allowed parameters
+func (sh *ServerHandler) countLogs(w http.ResponseWriter, r *http.Request, count func(*types.LogFilter, context.Context) (*types.CountRes, error), allowed ...string) {
+	w.Header().Set("Alt-Svc", "h3=\":"+config.GetViperEnvVariables("REST_SERVER_H3_PORT")+"\"")
+	switch r.Method {
+	case "GET":
+		filter, err := getLogFilter(r, allowed...)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if !sh.waitSynced(w, r) {
+			return
+		}
 
-		fileInfo, fileContent, err := sh.ServerService.DownloadFile(afterPath, uint64(timestamp))
+		countRes, err := count(filter, r.Context())
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		_, fileName := filepath.Split(afterPath)
-		w.Header().Set("Content-Type", "application/octet-stream")
-		w.Header().Set("Content-Disposition", "attachment; filename="+fileName)
-		w.Header().Set("Content-Length", fmt.Sprint(fileInfo.Size))
+		w.Header().Set("Content-Type", "application/json")
 
-		n, err := io.Copy(w, fileContent)
+		response, err := json.Marshal(countRes)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		if n != fileInfo.Size {
-			http.Error(w, "file is modified", http.StatusInternalServerError)
+		n, err := w.Write(response)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if n != len(response) {
+			http.Error(w, "failed to write response", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func (sh *ServerHandler) RemoveClient(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Alt-Svc", "h3=\":"+config.GetViperEnvVariables("REST_SERVER_H3_PORT")+"\"")
+	switch r.Method {
+	case "POST":
+		uuid := r.URL.Query().Get("uuid")
+
+		// removing every client must be requested explicitly
+		if uuid == "" && r.URL.Query().Get("all") != "true" {
+			http.Error(w, "uuid is required (or all=true to remove every client)", http.StatusBadRequest)
+			return
+		}
+		if uuid != "" {
+			if err := utils.ValidateUUID(uuid); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		err := sh.ServerService.RemoveClient(uuid)
+		if writeBulkBusyError(w, err) {
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func (sh *ServerHandler) RemoveDir(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Alt-Svc", "h3=\":"+config.GetViperEnvVariables("REST_SERVER_H3_PORT")+"\"")
+	switch r.Method {
+	case "POST":
+		afterPath := r.URL.Query().Get("afterPath")
+
+		// removing every directory must be requested explicitly
+		if afterPath == "" && r.URL.Query().Get("all") != "true" {
+			http.Error(w, "afterPath is required (or all=true to remove every directory)", http.StatusBadRequest)
+			return
+		}
+
+		err := sh.ServerService.RemoveDir(afterPath)
+		if writeBulkBusyError(w, err) {
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
 		}
 	}
 }
+
+func (sh *ServerHandler) RemoveFile(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Alt-Svc", "h3=\":"+config.GetViperEnvVariables("REST_SERVER_H3_PORT")+"\"")
+	switch r.Method {
+	case "POST":
+		query := r.URL.Query()
+		afterPath := query.Get("afterPath")
+		all := query.Get("all") == "true"
+
+		// file is removed exactly by default, directory must be removed with recursive explicitly
+		recursive := query.Get("recursive") == "true"
+		dryRun := query.Get("dryRun") == "true"
+		purge := query.Get("purge") == "true"
+
+		switch {
+		case all && afterPath != "":
+			http.Error(w, "afterPath and all=true can not be used together", http.StatusBadRequest)
+			return
+		case all:
+			recursive = true
+		case afterPath == "":
+			http.Error(w, "afterPath is required (or all=true to remove every file)", http.StatusBadRequest)
+			return
+		}
+
+		removeRes, err := sh.ServerService.RemoveFile(afterPath, recursive, dryRun, purge)
+		if writeBulkBusyError(w, err) {
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		response, err := json.Marshal(removeRes)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		n, err := w.Write(response)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if n != len(response) {
+			http.Error(w, "failed to write response", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// RemoveOrphanedFile removes every file whose root directory does not exist anymore
+func (sh *ServerHandler) RemoveOrphanedFile(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Alt-Svc", "h3=\":"+config.GetViperEnvVariables("REST_SERVER_H3_PORT")+"\"")
+	switch r.Method {
+	case "POST":
+		query := r.URL.Query()
+		dryRun := query.Get("dryRun") == "true"
+		purge := query.Get("purge") == "true"
+
+		removeRes, err := sh.ServerService.RemoveOrphanedFile(dryRun, purge)
+		if writeBulkBusyError(w, err) {
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		response, err := json.Marshal(removeRes)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		n, err := w.Write(response)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if n != len(response) {
+			http.Error(w, "failed to write response", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func (sh *ServerHandler) GetMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Alt-Svc", "h3=\":"+config.GetViperEnvVariables("REST_SERVER_H3_PORT")+"\"")
+	switch r.Method {
+	case "GET":
+		metrics := sh.ServerService.GetMetrics()
+
+		w.Header().Set("Content-Type", "application/json")
+
+		response, err := json.Marshal(metrics)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		n, err := w.Write(response)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if n != len(response) {
+			http.Error(w, "failed to write response", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// GetHealth responds state of server and its health checks, with 503 when server is not ready (e.g., for load balancers)
+func (sh *ServerHandler) GetHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Alt-Svc", "h3=\":"+config.GetViperEnvVariables("REST_SERVER_H3_PORT")+"\"")
+	switch r.Method {
+	case "GET":
+		health := sh.ServerService.Health()
+
+		response, err := json.Marshal(health)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if health.State != types.HealthReady {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		n, err := w.Write(response)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if n != len(response) {
+			http.Error(w, "failed to write response", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func (sh *ServerHandler) DiffDir(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Alt-Svc", "h3=\":"+config.GetViperEnvVariables("REST_SERVER_H3_PORT")+"\"")
+	switch r.Method {
+	case "GET":
+		query := r.URL.Query()
+		afterPath := query.Get("afterPath")
+
+		from, err := time.Parse(time.RFC3339, query.Get("from"))
+		if err != nil {
+			http.Error(w, "from must be RFC3339 time: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		to := time.Now()
+		if query.Get("to") != "" {
+			to, err = time.Parse(time.RFC3339, query.Get("to"))
+			if err != nil {
+				http.Error(w, "to must be RFC3339 time: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		content := false
+		if query.Get("content") != "" {
+			content, err = strconv.ParseBool(query.Get("content"))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		diffRes, err := sh.ServerService.DiffDir(afterPath, from, to, content)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		response, err := json.Marshal(diffRes)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		n, err := w.Write(response)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if n != len(response) {
+			http.Error(w, "failed to write response", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// ShowFileLineage responds moves which file of afterPath came from and went to as json (default),
+// or as text tree or DOT graph of Graphviz by format
+func (sh *ServerHandler) ShowFileLineage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Alt-Svc", "h3=\":"+config.GetViperEnvVariables("REST_SERVER_H3_PORT")+"\"")
+	switch r.Method {
+	case "GET":
+		afterPath := r.URL.Query().Get("afterPath")
+		if afterPath == "" {
+			http.Error(w, "afterPath is required", http.StatusBadRequest)
+			return
+		}
+		format := r.URL.Query().Get("format")
+		if format != "" && format != "json" && !slices.Contains(utils.LineageFormats, format) {
+			http.Error(w, "unknown format (json, "+strings.Join(utils.LineageFormats, ", ")+"): "+format, http.StatusBadRequest)
+			return
+		}
+
+		lineage, err := sh.ServerService.GetFileLineage(afterPath)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		var response []byte
+		if format == "" || format == "json" {
+			w.Header().Set("Content-Type", "application/json")
+			response, err = json.Marshal(lineage)
+		} else {
+			contentType := "text/plain; charset=utf-8"
+			if format == "dot" {
+				contentType = "text/vnd.graphviz; charset=utf-8"
+			}
+			w.Header().Set("Content-Type", contentType)
+
+			var formatted string
+			formatted, err = utils.FormatLineage(lineage, format)
+			response = []byte(formatted)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		n, err := w.Write(response)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if n != len(response) {
+			http.Error(w, "failed to write response", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func (sh *ServerHandler) LockFile(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Alt-Svc", "h3=\":"+config.GetViperEnvVariables("REST_SERVER_H3_PORT")+"\"")
+	afterPath := r.URL.Query().Get("afterPath")
+	uuid := r.URL.Query().Get("uuid")
+	if afterPath == "" || uuid == "" {
+		http.Error(w, "afterPath and uuid are required", http.StatusBadRequest)
+		return
+	}
+	if err := utils.ValidateUUID(uuid); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		ttl := DefaultLockTTL
+		if r.URL.Query().Get("ttl") != "" {
+			seconds, err := strconv.ParseUint(r.URL.Query().Get("ttl"), 10, 64)
+			if err != nil || seconds == 0 {
+				http.Error(w, "ttl must be positive seconds", http.StatusBadRequest)
+				return
+			}
+			ttl = time.Duration(seconds) * time.Second
+		}
+
+		lock, err := sh.ServerService.LockFile(afterPath, uuid, ttl)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		response, err := json.Marshal(lock)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		n, err := w.Write(response)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if n != len(response) {
+			http.Error(w, "failed to write response", http.StatusInternalServerError)
+			return
+		}
+
+	case "DELETE":
+		err := sh.ServerService.UnlockFile(afterPath, uuid)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+	}
+}
+
+// SyncClientNow asks connected client to run a full sync pass right away, and responds changes exchanged by the pass
+// e.g., POST /api/v1/server/clients/0b2c5e1a-7f3d-4c2b-9e8a-1d2c3b4a5f6e/sync
+func (sh *ServerHandler) SyncClientNow(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Alt-Svc", "h3=\":"+config.GetViperEnvVariables("REST_SERVER_H3_PORT")+"\"")
+	uuid, action, found := strings.Cut(strings.TrimPrefix(r.URL.Path, ClientsPath+"/"), "/")
+	if !found || action != "sync" {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		if err := utils.ValidateUUID(uuid); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		syncNowRes, err := sh.ServerService.SyncClientNow(uuid)
+		if errors.Is(err, sync.ErrClientNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, sync.ErrClientNotConnected) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if writeDiskError(w, err) {
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		response, err := json.Marshal(syncNowRes)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		n, err := w.Write(response)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if n != len(response) {
+			http.Error(w, "failed to write response", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// ShowLocks lists active file locks under afterPath (every lock without it)
+// e.g., GET /api/v1/server/locks?afterPath=/root
+func (sh *ServerHandler) ShowLocks(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Alt-Svc", "h3=\":"+config.GetViperEnvVariables("REST_SERVER_H3_PORT")+"\"")
+	switch r.Method {
+	case "GET":
+		afterPath := r.URL.Query().Get("afterPath")
+
+		locks, err := sh.ServerService.ShowLocks(afterPath)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		response, err := json.Marshal(locks)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		n, err := w.Write(response)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if n != len(response) {
+			http.Error(w, "failed to write response", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// BreakLock releases lock of the file regardless of its holder, recording reason in server log and LOCK_BROKEN event
+// e.g., POST /api/v1/server/locks/break?afterPath=/root/a.txt&reason=client+crashed
+func (sh *ServerHandler) BreakLock(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Alt-Svc", "h3=\":"+config.GetViperEnvVariables("REST_SERVER_H3_PORT")+"\"")
+	switch r.Method {
+	case "POST":
+		afterPath := r.URL.Query().Get("afterPath")
+		reason := strings.TrimSpace(r.URL.Query().Get("reason"))
+		if afterPath == "" || reason == "" {
+			http.Error(w, "afterPath and reason are required", http.StatusBadRequest)
+			return
+		}
+
+		breakLockRes, err := sh.ServerService.BreakLock(afterPath, reason)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		response, err := json.Marshal(breakLockRes)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		n, err := w.Write(response)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if n != len(response) {
+			http.Error(w, "failed to write response", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// TagFile sets comma separated key=value tags of set query and removes comma separated keys of unset query
+// e.g., POST /api/v1/server/files/tags?afterPath=/root/a.txt&set=env=prod,team=web&unset=draft
+func (sh *ServerHandler) TagFile(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Alt-Svc", "h3=\":"+config.GetViperEnvVariables("REST_SERVER_H3_PORT")+"\"")
+	switch r.Method {
+	case "POST":
+		afterPath := r.URL.Query().Get("afterPath")
+		if afterPath == "" {
+			http.Error(w, "afterPath is required", http.StatusBadRequest)
+			return
+		}
+
+		set, err := utils.ParseTags(r.URL.Query().Get("set"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(set) > utils.MaxTags {
+			http.Error(w, fmt.Sprintf("file can not have more than %d tags", utils.MaxTags), http.StatusBadRequest)
+			return
+		}
+		unset := []string{}
+		if r.URL.Query().Get("unset") != "" {
+			unset = strings.Split(r.URL.Query().Get("unset"), ",")
+		}
+
+		file, err := sh.ServerService.TagFile(afterPath, set, unset)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		response, err := json.Marshal(file)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		n, err := w.Write(response)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if n != len(response) {
+			http.Error(w, "failed to write response", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// TagFiles sets and removes tags of every file matched by filter (same filter as logs endpoints, at least one is required)
+// e.g., POST /api/v1/server/files/tags/bulk?prefix=/root/logs&set=archived=true&dryRun=true
+func (sh *ServerHandler) TagFiles(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Alt-Svc", "h3=\":"+config.GetViperEnvVariables("REST_SERVER_H3_PORT")+"\"")
+	switch r.Method {
+	case "POST":
+		filter, err := getLogFilter(r, logFilterParams...)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if filter == nil {
+			http.Error(w, "filter is required (e.g., prefix)", http.StatusBadRequest)
+			return
+		}
+
+		set, err := utils.ParseTags(r.URL.Query().Get("set"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(set) > utils.MaxTags {
+			http.Error(w, fmt.Sprintf("file can not have more than %d tags", utils.MaxTags), http.StatusBadRequest)
+			return
+		}
+		unset := []string{}
+		if r.URL.Query().Get("unset") != "" {
+			unset = strings.Split(r.URL.Query().Get("unset"), ",")
+		}
+		if len(set) == 0 && len(unset) == 0 {
+			http.Error(w, "set or unset is required", http.StatusBadRequest)
+			return
+		}
+		dryRun := r.URL.Query().Get("dryRun") == "true"
+
+		bulkRes, err := sh.ServerService.TagFiles(filter, set, unset, dryRun)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		response, err := json.Marshal(bulkRes)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		n, err := w.Write(response)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if n != len(response) {
+			http.Error(w, "failed to write response", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// SetFileMetadata replaces custom metadata of file by JSON object of body (empty body, null or {} clears it)
+// e.g., POST /api/v1/server/files/metadata?afterPath=/root/a.txt with body {"project":"web","reviewed":true}
+func (sh *ServerHandler) SetFileMetadata(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Alt-Svc", "h3=\":"+config.GetViperEnvVariables("REST_SERVER_H3_PORT")+"\"")
+	switch r.Method {
+	case "POST":
+		afterPath := r.URL.Query().Get("afterPath")
+		if afterPath == "" {
+			http.Error(w, "afterPath is required", http.StatusBadRequest)
+			return
+		}
+
+		buf, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		metadata, err := utils.ParseFileMetadata(string(buf))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		file, err := sh.ServerService.SetFileMetadata(afterPath, metadata)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		response, err := json.Marshal(file)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		n, err := w.Write(response)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if n != len(response) {
+			http.Error(w, "failed to write response", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func (sh *ServerHandler) MoveDir(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Alt-Svc", "h3=\":"+config.GetViperEnvVariables("REST_SERVER_H3_PORT")+"\"")
+	switch r.Method {
+	case "POST":
+		from := r.URL.Query().Get("from")
+		to := r.URL.Query().Get("to")
+		for _, afterPath := range []string{from, to} {
+			err := utils.ValidateRootDirAfterPath(afterPath)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		err := sh.ServerService.MoveDir(from, to)
+		if errors.Is(err, server.ErrMoveTooLarge) {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// MoveFile renames file keeping its histories; moving onto existing file is 409 Conflict (FILE_EXISTS) unless overwrite=true
+func (sh *ServerHandler) MoveFile(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Alt-Svc", "h3=\":"+config.GetViperEnvVariables("REST_SERVER_H3_PORT")+"\"")
+	switch r.Method {
+	case "POST":
+		from := r.URL.Query().Get("from")
+		to := r.URL.Query().Get("to")
+		for _, afterPath := range []string{from, to} {
+			err := utils.ValidateAfterPath(afterPath)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		overwrite := r.URL.Query().Get("overwrite") == "true"
+
+		file, err := sh.ServerService.MoveFile(from, to, overwrite)
+		if errors.Is(err, sync.ErrFileExists) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if writePathLimitError(w, err) || writeDiskError(w, err) {
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		response, err := json.Marshal(file)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		n, err := w.Write(response)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if n != len(response) {
+			http.Error(w, "failed to write response", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func (sh *ServerHandler) SetDir(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Alt-Svc", "h3=\":"+config.GetViperEnvVariables("REST_SERVER_H3_PORT")+"\"")
+	switch r.Method {
+	case "POST":
+		query := r.URL.Query()
+		afterPath := query.Get("afterPath")
+
+		// validate every option before setting any of them
+		appendOnly := false
+		if query.Has("appendOnly") {
+			parsed, err := strconv.ParseBool(query.Get("appendOnly"))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			appendOnly = parsed
+		}
+
+		policies := []types.VersioningPolicy{}
+		if query.Has("versioning") {
+			parsed, err := utils.ParseVersioningPolicies(query.Get("versioning"))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			policies = parsed
+		}
+
+		syncPolicies := []types.SyncPolicy{}
+		if query.Has("policy") {
+			parsed, err := utils.ParseSyncPolicies(query.Get("policy"))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			syncPolicies = parsed
+		}
+
+		if query.Has("appendOnly") {
+			err := sh.ServerService.SetDirAppendOnly(afterPath, appendOnly)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		if query.Has("versioning") {
+			err := sh.ServerService.SetDirVersioning(afterPath, policies)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		if query.Has("policy") {
+			err := sh.ServerService.SetDirPolicies(afterPath, syncPolicies)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+}
+
+// SetFile changes settings of file (noHistory: keep only the latest history of the file) and responds the file
+// e.g., POST /api/v1/server/set/files?afterPath=/root/cache.bin&noHistory=true
+func (sh *ServerHandler) SetFile(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Alt-Svc", "h3=\":"+config.GetViperEnvVariables("REST_SERVER_H3_PORT")+"\"")
+	switch r.Method {
+	case "POST":
+		query := r.URL.Query()
+		afterPath := query.Get("afterPath")
+		if afterPath == "" {
+			http.Error(w, "afterPath is required", http.StatusBadRequest)
+			return
+		}
+		if !query.Has("noHistory") {
+			http.Error(w, "noHistory is required", http.StatusBadRequest)
+			return
+		}
+
+		noHistory, err := strconv.ParseBool(query.Get("noHistory"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		file, err := sh.ServerService.SetFileNoHistory(afterPath, noHistory)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		response, err := json.Marshal(file)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		n, err := w.Write(response)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if n != len(response) {
+			http.Error(w, "failed to write response", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// ExplainPolicy responds sync behaviors resolved for afterPath (file setting > directory policy > extension default > global default)
+func (sh *ServerHandler) ExplainPolicy(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Alt-Svc", "h3=\":"+config.GetViperEnvVariables("REST_SERVER_H3_PORT")+"\"")
+	switch r.Method {
+	case "GET":
+		afterPath := r.URL.Query().Get("afterPath")
+		if afterPath == "" {
+			http.Error(w, "afterPath is required", http.StatusBadRequest)
+			return
+		}
+
+		policy, err := sh.ServerService.ExplainPolicy(afterPath)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		response, err := json.Marshal(policy)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		n, err := w.Write(response)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if n != len(response) {
+			http.Error(w, "failed to write response", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func (sh *ServerHandler) SubscribeClient(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Alt-Svc", "h3=\":"+config.GetViperEnvVariables("REST_SERVER_H3_PORT")+"\"")
+	switch r.Method {
+	case "POST":
+		uuid := r.URL.Query().Get("uuid")
+		prefix := r.URL.Query().Get("prefix")
+		if err := utils.ValidateUUID(uuid); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		err := sh.ServerService.SubscribeClient(uuid, prefix)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// SetClientSchedule replaces bandwidth schedule of client by window query (empty: never limited)
+// e.g., POST /api/v1/server/schedule/clients?uuid=<uuid>&window=00:00-06:00:unlimited,else:1MB
+func (sh *ServerHandler) SetClientSchedule(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Alt-Svc", "h3=\":"+config.GetViperEnvVariables("REST_SERVER_H3_PORT")+"\"")
+	switch r.Method {
+	case "POST":
+		uuid := r.URL.Query().Get("uuid")
+		if err := utils.ValidateUUID(uuid); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		schedule, err := utils.ParseBandwidthSchedule(r.URL.Query().Get("window"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		err = sh.ServerService.SetClientSchedule(uuid, schedule)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func (sh *ServerHandler) UnsubscribeClient(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Alt-Svc", "h3=\":"+config.GetViperEnvVariables("REST_SERVER_H3_PORT")+"\"")
+	switch r.Method {
+	case "POST":
+		uuid := r.URL.Query().Get("uuid")
+		prefix := r.URL.Query().Get("prefix")
+		if err := utils.ValidateUUID(uuid); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		err := sh.ServerService.UnsubscribeClient(uuid, prefix)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// ProvisionClients creates or updates clients of json array of entries in request body at once
+// e.g., POST /api/v1/server/provision/clients?dryRun=true
+func (sh *ServerHandler) ProvisionClients(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Alt-Svc", "h3=\":"+config.GetViperEnvVariables("REST_SERVER_H3_PORT")+"\"")
+	switch r.Method {
+	case "POST":
+		dryRun := r.URL.Query().Get("dryRun") == "true"
+
+		buf, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		entries := []types.ProvisionEntry{}
+		err = utils.UnmarshalRequestBody(buf, &entries)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		provisionRes, err := sh.ServerService.ProvisionClients(entries, dryRun)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		response, err := json.Marshal(provisionRes)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		n, err := w.Write(response)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if n != len(response) {
+			http.Error(w, "failed to write response", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func (sh *ServerHandler) UploadFile(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Alt-Svc", "h3=\":"+config.GetViperEnvVariables("REST_SERVER_H3_PORT")+"\"")
+	switch r.Method {
+	case "POST":
+		afterPath := r.URL.Query().Get("afterPath")
+
+		// afterPath is joined to sync and history directories, so it must not climb out of them (e.g., /root/../../tmp/a)
+		err := utils.ValidateAfterPath(afterPath)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// size of contents must be known to save file with its metadata
+		if r.ContentLength < 0 {
+			http.Error(w, "Content-Length is required", http.StatusLengthRequired)
+			return
+		}
+
+		// If-Match makes upload conditional on latest hash of file (ifMatch query is for clients which can not set headers)
+		expectedHash := strings.Trim(strings.TrimPrefix(strings.TrimSpace(r.Header.Get("If-Match")), "W/"), "\"")
+		if expectedHash == "" {
+			expectedHash = r.URL.Query().Get("ifMatch")
+		}
+
+		// custom metadata replaces that of file once contents are uploaded (metadata query is for clients which can not set headers)
+		rawMetadata := r.Header.Get(types.FileMetadataHeader)
+		if rawMetadata == "" {
+			rawMetadata = r.URL.Query().Get("metadata")
+		}
+		metadata, err := utils.ParseFileMetadata(rawMetadata)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		file, err := sh.ServerService.UploadFile(afterPath, r.ContentLength, r.Body, expectedHash)
+		var mismatchErr *sync.HashMismatchError
+		if errors.As(err, &mismatchErr) {
+			w.Header().Set("ETag", "\""+mismatchErr.CurrentHash+"\"")
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if writePathLimitError(w, err) || writeDiskError(w, err) {
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if rawMetadata != "" {
+			file, err = sh.ServerService.SetFileMetadata(file.AfterPath, metadata)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		// consistency token lets uploader read this version back with If-Synced-To
+		w.Header().Set("Synced-To", utils.MakeSyncToken(file.AfterPath, file.LatestSyncTimestamp))
+		w.Header().Set("Content-Type", "application/json")
+
+		response, err := json.Marshal(file)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		n, err := w.Write(response)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if n != len(response) {
+			http.Error(w, "failed to write response", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func (sh *ServerHandler) DownloadFile(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Alt-Svc", "h3=\":"+config.GetViperEnvVariables("REST_SERVER_H3_PORT")+"\"")
+	switch r.Method {
+	case "GET":
+		afterPath := r.URL.Query().Get("afterPath")
+
+		// afterPath is joined to history directory, so it must not climb out of it (e.g., /root/../../etc/passwd)
+		err := utils.ValidateAfterPath(afterPath)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if !sh.waitSynced(w, r) {
+			return
+		}
+
+		// version is resolved after waiting for sync, so that latest is the version synced to the token
+		timestamp, ok := sh.resolveTimestamp(w, r, afterPath)
+		if !ok {
+			return
+		}
+
+		// accept transcodes contents on the fly (e.g., accept=application/json for csv) by enabled converters
+		if accept := r.URL.Query().Get("accept"); accept != "" {
+			sh.downloadConvertedFile(w, afterPath, timestamp, accept)
+			return
+		}
+
+		// contents recorded but missing from storage are reported as 410 Gone (CONTENT_MISSING) rather than as server error,
+		// and version which does not exist at all as 404 Not Found (VERSION_NOT_FOUND) listing nearest versions
+		startedAt := time.Now()
+		endTransfer := sh.ServerService.BeginTransfer()
+		defer endTransfer()
+		fileInfo, fileContent, err := sh.ServerService.DownloadFile(afterPath, timestamp)
+		if errors.Is(err, sync.ErrContentMissing) {
+			http.Error(w, err.Error(), http.StatusGone)
+			return
+		}
+		if errors.Is(err, sync.ErrVersionNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// contents are compressed only when policy of the file says so and client accepts gzip
+		compress := false
+		if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			policy, err := sh.ServerService.ExplainPolicy(afterPath)
+			compress = err == nil && policy.CompressOnTransfer
+		}
+
+		_, fileName := filepath.Split(afterPath)
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", "attachment; filename="+fileName)
+
+		// custom metadata belongs to file rather than to its version, so the current one is sent with any version
+		metadata, err := sh.ServerService.GetFileMetadata(afterPath)
+		if err == nil && len(metadata) != 0 {
+			w.Header().Set(types.FileMetadataHeader, string(metadata))
+		}
+
+		if compress {
+			w.Header().Set("Content-Encoding", "gzip")
+
+			gzipWriter := gzip.NewWriter(w)
+			_, err = io.Copy(gzipWriter, fileContent)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			err = gzipWriter.Close()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			sh.ServerService.RecordDownload(afterPath, fileInfo.Size, startedAt)
+			return
+		}
+
+		w.Header().Set("Content-Length", fmt.Sprint(fileInfo.Size))
+
+		n, err := io.Copy(w, fileContent)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if n != fileInfo.Size {
+			http.Error(w, "file is modified", http.StatusInternalServerError)
+			return
+		}
+		sh.ServerService.RecordDownload(afterPath, n, startedAt)
+	}
+}
+
+// ResolveVersion returns timestamp of version of file selected by version (1-based ordinal), timestamp or latest,
+// which is used to download, verify or share the version
+func (sh *ServerHandler) ResolveVersion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Alt-Svc", "h3=\":"+config.GetViperEnvVariables("REST_SERVER_H3_PORT")+"\"")
+	switch r.Method {
+	case "GET":
+		afterPath := r.URL.Query().Get("afterPath")
+		err := utils.ValidateAfterPath(afterPath)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		selector, err := getVersionSelector(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if !sh.waitSynced(w, r) {
+			return
+		}
+
+		versionRes, err := sh.ServerService.ResolveVersion(afterPath, selector)
+		if errors.Is(err, sync.ErrVersionNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		response, err := json.Marshal(versionRes)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		n, err := w.Write(response)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if n != len(response) {
+			http.Error(w, "failed to write response", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// DigestFile returns content hash and size of a version of file without its contents,
+// so that a downloaded copy is verified without downloading it again
+func (sh *ServerHandler) DigestFile(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Alt-Svc", "h3=\":"+config.GetViperEnvVariables("REST_SERVER_H3_PORT")+"\"")
+	switch r.Method {
+	case "GET":
+		query := r.URL.Query()
+		afterPath := query.Get("afterPath")
+		err := utils.ValidateAfterPath(afterPath)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		timestamp, ok := sh.resolveTimestamp(w, r, afterPath)
+		if !ok {
+			return
+		}
+
+		digest, err := sh.ServerService.GetFileDigest(afterPath, timestamp, query.Get("chunks") == "true")
+		if errors.Is(err, sync.ErrContentMissing) {
+			http.Error(w, err.Error(), http.StatusGone)
+			return
+		}
+		if errors.Is(err, sync.ErrVersionNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		response, err := json.Marshal(digest)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		n, err := w.Write(response)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if n != len(response) {
+			http.Error(w, "failed to write response", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// ShareFile responds signed url which downloads a version of file without login until expires (e.g., 1h) passes
+func (sh *ServerHandler) ShareFile(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Alt-Svc", "h3=\":"+config.GetViperEnvVariables("REST_SERVER_H3_PORT")+"\"")
+	switch r.Method {
+	case "POST":
+		query := r.URL.Query()
+		afterPath := query.Get("afterPath")
+		err := utils.ValidateAfterPath(afterPath)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		timestamp, ok := sh.resolveTimestamp(w, r, afterPath)
+		if !ok {
+			return
+		}
+		expires, err := time.ParseDuration(query.Get("expires"))
+		if err != nil {
+			http.Error(w, "invalid expires (e.g., 1h): "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if expires <= 0 || expires > server.MaxSignedURLExpiry {
+			http.Error(w, "expires must be between 1s and "+server.MaxSignedURLExpiry.String(), http.StatusBadRequest)
+			return
+		}
+
+		signedURLRes, err := sh.ServerService.SignFile(afterPath, timestamp, expires)
+		if errors.Is(err, sync.ErrContentMissing) {
+			http.Error(w, err.Error(), http.StatusGone)
+			return
+		}
+		if errors.Is(err, sync.ErrVersionNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		response, err := json.Marshal(signedURLRes)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		n, err := w.Write(response)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if n != len(response) {
+			http.Error(w, "failed to write response", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// RotateSigningKey revokes every signed url by replacing signing key
+func (sh *ServerHandler) RotateSigningKey(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Alt-Svc", "h3=\":"+config.GetViperEnvVariables("REST_SERVER_H3_PORT")+"\"")
+	switch r.Method {
+	case "POST":
+		err := sh.ServerService.RotateSigningKey()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// DownloadSignedFile downloads file by signed url of ShareFile, so that it does not need login
+// tampered, expired or revoked url is rejected with 403
+func (sh *ServerHandler) DownloadSignedFile(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Alt-Svc", "h3=\":"+config.GetViperEnvVariables("REST_SERVER_H3_PORT")+"\"")
+	switch r.Method {
+	case "GET":
+		query := r.URL.Query()
+		afterPath := query.Get("afterPath")
+		err := utils.ValidateAfterPath(afterPath)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		timestamp, err := strconv.ParseUint(query.Get("timestamp"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid timestamp: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid expires: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		startedAt := time.Now()
+		endTransfer := sh.ServerService.BeginTransfer()
+		defer endTransfer()
+		fileInfo, fileContent, err := sh.ServerService.DownloadSignedFile(afterPath, timestamp, expires, query.Get("signature"))
+		if errors.Is(err, server.ErrInvalidSignature) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if errors.Is(err, sync.ErrContentMissing) {
+			http.Error(w, err.Error(), http.StatusGone)
+			return
+		}
+		if errors.Is(err, sync.ErrVersionNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if closer, ok := fileContent.(io.Closer); ok {
+			defer closer.Close()
+		}
+
+		_, fileName := filepath.Split(afterPath)
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", "attachment; filename="+fileName)
+		w.Header().Set("Content-Length", fmt.Sprint(fileInfo.Size))
+
+		n, err := io.Copy(w, fileContent)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if n != fileInfo.Size {
+			http.Error(w, "file is modified", http.StatusInternalServerError)
+			return
+		}
+		sh.ServerService.RecordDownload(afterPath, n, startedAt)
+	}
+}
+
+func (sh *ServerHandler) downloadConvertedFile(w http.ResponseWriter, afterPath string, timestamp uint64, accept string) {
+	contents, contentType, err := sh.ServerService.ConvertFile(afterPath, timestamp, accept)
+	if errors.Is(err, convert.ErrNoConverter) {
+		http.Error(w, err.Error(), http.StatusNotAcceptable)
+		return
+	}
+	if errors.Is(err, sync.ErrClientEncrypted) {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if errors.Is(err, sync.ErrContentMissing) {
+		http.Error(w, err.Error(), http.StatusGone)
+		return
+	}
+	if errors.Is(err, sync.ErrVersionNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	_, fileName := filepath.Split(afterPath)
+	fileName = strings.TrimSuffix(fileName, filepath.Ext(fileName)) + convert.ExtensionOf(contentType)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", "attachment; filename="+fileName)
+	w.Header().Set("Content-Length", fmt.Sprint(len(contents)))
+
+	n, err := w.Write(contents)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n != len(contents) {
+		http.Error(w, "failed to write response", http.StatusInternalServerError)
+	}
+}
+
+func (sh *ServerHandler) Scrub(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Alt-Svc", "h3=\":"+config.GetViperEnvVariables("REST_SERVER_H3_PORT")+"\"")
+	switch r.Method {
+	case "POST":
+		scrubRes, err := sh.ServerService.Scrub()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		response, err := json.Marshal(scrubRes)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		n, err := w.Write(response)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if n != len(response) {
+			http.Error(w, "failed to write response", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func (sh *ServerHandler) Reindex(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Alt-Svc", "h3=\":"+config.GetViperEnvVariables("REST_SERVER_H3_PORT")+"\"")
+	switch r.Method {
+	case "POST":
+		index := r.URL.Query().Get("index")
+		if index == "" {
+			index = sync.ReindexAll
+		}
+
+		reindexResList, err := sh.ServerService.Reindex(index)
+		if errors.Is(err, sync.ErrUnknownIndex) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		response, err := json.Marshal(reindexResList)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		n, err := w.Write(response)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if n != len(response) {
+			http.Error(w, "failed to write response", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// GetTransferStats responds transfers completed between since and until (RFC3339; default: last 24 hours) bucketed by bucket (default: 1h)
+func (sh *ServerHandler) GetTransferStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Alt-Svc", "h3=\":"+config.GetViperEnvVariables("REST_SERVER_H3_PORT")+"\"")
+	switch r.Method {
+	case "GET":
+		query := r.URL.Query()
+
+		var err error
+		until := time.Now()
+		if query.Get("until") != "" {
+			until, err = time.Parse(time.RFC3339, query.Get("until"))
+			if err != nil {
+				http.Error(w, "until must be RFC3339 time: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		since := until.Add(-DefaultTransferStatsPeriod)
+		if query.Get("since") != "" {
+			since, err = time.Parse(time.RFC3339, query.Get("since"))
+			if err != nil {
+				http.Error(w, "since must be RFC3339 time: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		bucket := DefaultTransferStatsBucket
+		if query.Get("bucket") != "" {
+			bucket, err = time.ParseDuration(query.Get("bucket"))
+			if err != nil {
+				http.Error(w, "bucket must be duration (e.g., 1h): "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		if !since.Before(until) || bucket <= 0 || until.Sub(since)/bucket >= server.MaxTransferBuckets {
+			http.Error(w, fmt.Sprintf("since must be earlier than until, and bucket must be positive and make less than %d windows", server.MaxTransferBuckets), http.StatusBadRequest)
+			return
+		}
+
+		statsRes, err := sh.ServerService.TransferStats(since, until, bucket)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		response, err := json.Marshal(statsRes)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		n, err := w.Write(response)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if n != len(response) {
+			http.Error(w, "failed to write response", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// Checkpoint responds after every write committed before the request is synced to disk
+func (sh *ServerHandler) Checkpoint(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Alt-Svc", "h3=\":"+config.GetViperEnvVariables("REST_SERVER_H3_PORT")+"\"")
+	switch r.Method {
+	case "POST":
+		checkpointRes, err := sh.ServerService.Checkpoint()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		response, err := json.Marshal(checkpointRes)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		n, err := w.Write(response)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if n != len(response) {
+			http.Error(w, "failed to write response", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// DBStats responds sizes of LSM tree levels and value log of database with estimated garbage and last maintenance times
+func (sh *ServerHandler) DBStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Alt-Svc", "h3=\":"+config.GetViperEnvVariables("REST_SERVER_H3_PORT")+"\"")
+	switch r.Method {
+	case "GET":
+		dbStatsRes, err := sh.ServerService.DBStats()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		response, err := json.Marshal(dbStatsRes)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		n, err := w.Write(response)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if n != len(response) {
+			http.Error(w, "failed to write response", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// CompactDB compacts levels of LSM tree (valueLogGC=true runs value log gc after it) and responds once done
+func (sh *ServerHandler) CompactDB(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Alt-Svc", "h3=\":"+config.GetViperEnvVariables("REST_SERVER_H3_PORT")+"\"")
+	switch r.Method {
+	case "POST":
+		valueLogGC := r.URL.Query().Get("valueLogGC") == "true"
+
+		compactRes, err := sh.ServerService.CompactDB(valueLogGC)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		response, err := json.Marshal(compactRes)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		n, err := w.Write(response)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if n != len(response) {
+			http.Error(w, "failed to write response", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// ShowPaths streams afterPaths of root directories and files as flat json array (type=files or type=dirs filters them)
+// paths are written while they are read, so large namespace is not held in memory
+func (sh *ServerHandler) ShowPaths(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Alt-Svc", "h3=\":"+config.GetViperEnvVariables("REST_SERVER_H3_PORT")+"\"")
+	switch r.Method {
+	case "GET":
+		files, dirs := true, true
+		switch r.URL.Query().Get("type") {
+		case "":
+		case "files":
+			dirs = false
+		case "dirs":
+			files = false
+		default:
+			http.Error(w, "type must be files or dirs", http.StatusBadRequest)
+			return
+		}
+
+		flusher, _ := w.(http.Flusher)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		count := 0
+		_, err := w.Write([]byte("["))
+		if err != nil {
+			return
+		}
+		err = sh.ServerService.WalkPaths(files, dirs, func(afterPath string) error {
+			path, err := json.Marshal(afterPath)
+			if err != nil {
+				return err
+			}
+			if count > 0 {
+				path = append([]byte(","), path...)
+			}
+			_, err = w.Write(path)
+			if err != nil {
+				return err
+			}
+
+			count++
+			if flusher != nil && count%1000 == 0 {
+				flusher.Flush()
+			}
+			return nil
+		})
+		if err != nil {
+			// status is already written, so broken array tells client that the stream is incomplete
+			log.Println("quics err: ", err)
+			return
+		}
+		w.Write([]byte("]"))
+	}
+}
+
+// Events streams change events of afterPath as server-sent events
+func (sh *ServerHandler) Events(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Alt-Svc", "h3=\":"+config.GetViperEnvVariables("REST_SERVER_H3_PORT")+"\"")
+	switch r.Method {
+	case "GET":
+		afterPath := r.URL.Query().Get("afterPath")
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+			return
+		}
+
+		events, unsubscribe := sh.ServerService.SubscribeEvents(afterPath)
+		defer unsubscribe()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+
+				data, err := json.Marshal(event)
+				if err != nil {
+					log.Println("quics err: ", err)
+					continue
+				}
+
+				_, err = w.Write([]byte("event: " + event.Type + "\ndata: " + string(data) + "\n\n"))
+				if err != nil {
+					log.Println("quics err: ", err)
+					return
+				}
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+// StreamLogs writes recent server logs and streams new logs when follow is true
+func (sh *ServerHandler) StreamLogs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Alt-Svc", "h3=\":"+config.GetViperEnvVariables("REST_SERVER_H3_PORT")+"\"")
+	switch r.Method {
+	case "GET":
+		level := r.URL.Query().Get("level")
+		if level == "" {
+			level = logs.LevelInfo
+		}
+		if !logs.IsValidLevel(level) {
+			http.Error(w, "level must be one of info, warn and error", http.StatusBadRequest)
+			return
+		}
+		follow := r.URL.Query().Get("follow") == "true"
+
+		flusher, ok := w.(http.Flusher)
+		if follow && !ok {
+			http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+			return
+		}
+
+		recentLines, lines, unsubscribe := sh.ServerService.SubscribeLogs(level)
+		defer unsubscribe()
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+
+		for _, line := range recentLines {
+			_, err := w.Write([]byte(line.Text + "\n"))
+			if err != nil {
+				return
+			}
+		}
+		if !follow {
+			return
+		}
+		flusher.Flush()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case line, ok := <-lines:
+				if !ok {
+					return
+				}
+
+				// do not log write error here, because it would be written to this stream again
+				_, err := w.Write([]byte(line.Text + "\n"))
+				if err != nil {
+					return
+				}
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+// getPageReq reads limit, offset, cursor and total of list request (defaultLimit is used when limit is not given)
+// total is counted for pages requested without cursor unless total=false is given, since it takes scan of every entry
+// and pages followed by cursor can take it from the first page
+func getPageReq(r *http.Request, defaultLimit uint64) (*types.PageReq, error) {
+	pageReq := &types.PageReq{
+		Limit:   defaultLimit,
+		Cursor:  r.URL.Query().Get("cursor"),
+		Context: r.Context(),
+	}
+	pageReq.CountTotal = pageReq.Cursor == ""
+
+	if total := r.URL.Query().Get("total"); total != "" {
+		countTotal, err := strconv.ParseBool(total)
+		if err != nil {
+			return nil, err
+		}
+		pageReq.CountTotal = countTotal
+	}
+
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		parsedLimit, err := strconv.ParseUint(limit, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		pageReq.Limit = parsedLimit
+	}
+
+	if offset := r.URL.Query().Get("offset"); offset != "" {
+		parsedOffset, err := strconv.ParseUint(offset, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		pageReq.Offset = parsedOffset
+	}
+
+	return pageReq, nil
+}
+
+// filter parameters of logs endpoints (see types.LogFilter)
+var logFilterParams = []string{"owner", "prefix", "uuid", "since", "until", "minSize", "maxSize", "tag", "metadata"}
+
+// getLogFilter reads filter of logs request (nil when no filter is given)
+// filter parameter which is not in allowed does not apply to entries of the endpoint, so it is rejected instead of ignored
+func getLogFilter(r *http.Request, allowed ...string) (*types.LogFilter, error) {
+	query := r.URL.Query()
+	for _, param := range logFilterParams {
+		if query.Get(param) != "" && !slices.Contains(allowed, param) {
+			return nil, errors.New("filter is not supported by this endpoint: " + param)
+		}
+	}
+
+	filter := &types.LogFilter{
+		Owner:  query.Get("owner"),
+		Prefix: query.Get("prefix"),
+		UUID:   query.Get("uuid"),
+	}
+
+	if filter.Prefix != "" {
+		if !strings.HasPrefix(filter.Prefix, "/") {
+			return nil, errors.New("prefix must be after path starting with /: " + filter.Prefix)
+		}
+		filter.Prefix = strings.TrimSuffix(filter.Prefix, "/")
+	}
+	if filter.UUID != "" {
+		if err := utils.ValidateUUID(filter.UUID); err != nil {
+			return nil, err
+		}
+	}
+
+	var err error
+	if since := query.Get("since"); since != "" {
+		filter.Since, err = time.Parse(time.RFC3339, since)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if until := query.Get("until"); until != "" {
+		filter.Until, err = time.Parse(time.RFC3339, until)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !filter.Since.IsZero() && !filter.Until.IsZero() && !filter.Since.Before(filter.Until) {
+		return nil, errors.New("since must be before until")
+	}
+
+	if minSize := query.Get("minSize"); minSize != "" {
+		filter.MinSize, err = strconv.ParseInt(minSize, 10, 64)
+		if err != nil || filter.MinSize < 0 {
+			return nil, errors.New("invalid minSize: " + minSize)
+		}
+	}
+	if maxSize := query.Get("maxSize"); maxSize != "" {
+		filter.MaxSize, err = strconv.ParseInt(maxSize, 10, 64)
+		if err != nil || filter.MaxSize <= 0 {
+			return nil, errors.New("invalid maxSize: " + maxSize)
+		}
+	}
+	if filter.MaxSize != 0 && filter.MinSize > filter.MaxSize {
+		return nil, errors.New("minSize must not be greater than maxSize")
+	}
+
+	filter.Tags, err = utils.ParseTags(query.Get("tag"))
+	if err != nil {
+		return nil, err
+	}
+	filter.Metadata, err = utils.ParseFileMetadataFields(query.Get("metadata"))
+	if err != nil {
+		return nil, err
+	}
+
+	if filter.IsEmpty() {
+		return nil, nil
+	}
+	return filter, nil
+}
+
+// waitSynced waits until write of consistency token given by If-Synced-To header (or ifSyncedTo query) is fully visible,
+// so that client reads its own write; it responds error and returns false when the read can not be served
+func (sh *ServerHandler) waitSynced(w http.ResponseWriter, r *http.Request) bool {
+	token := strings.TrimSpace(r.Header.Get("If-Synced-To"))
+	if token == "" {
+		token = r.URL.Query().Get("ifSyncedTo")
+	}
+	if token == "" {
+		return true
+	}
+
+	timeout, err := strconv.ParseUint(config.GetViperEnvVariables("SYNC_WAIT_TIMEOUT"), 10, 32)
+	if err != nil {
+		log.Println("quics alert: ", "invalid SYNC_WAIT_TIMEOUT, use default timeout: ", err)
+		timeout, _ = strconv.ParseUint(config.DefaultSyncWaitTimeout, 10, 32)
+	}
+
+	err = sh.ServerService.WaitSynced(r.Context(), token, time.Duration(timeout)*time.Second)
+	if errors.Is(err, utils.ErrInvalidSyncToken) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	if errors.Is(err, sync.ErrNotSynced) {
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+
+	return true
+}
+
+// writeDiskError responds 507 Insufficient Storage for write aborted because disk is full,
+// and 503 Service Unavailable for write rejected while server is read-only after disk became full
+// it returns false without writing anything for other errors
+func writeDiskError(w http.ResponseWriter, err error) bool {
+	if errors.Is(err, sync.ErrDiskFull) {
+		http.Error(w, err.Error(), http.StatusInsufficientStorage)
+		return true
+	}
+	if errors.Is(err, sync.ErrReadOnly) {
+		w.Header().Set("Retry-After", strconv.Itoa(server.DiskCheckInterval))
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return true
+	}
+	return false
+}
+
+// writeBulkBusyError responds 503 Service Unavailable with Retry-After for destructive bulk operation
+// requested while another one is running (BULK_OPERATION_RUNNING with its progress)
+// it returns false without writing anything for other errors
+func writeBulkBusyError(w http.ResponseWriter, err error) bool {
+	if !errors.Is(err, server.ErrBulkOperationRunning) {
+		return false
+	}
+
+	w.Header().Set("Retry-After", BulkRetryAfter)
+	http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	return true
+}
+
+// writePathLimitError responds 400 Bad Request for write of afterPath exceeding MAX_PATH_LENGTH (PATH_TOO_LONG) or MAX_PATH_DEPTH (PATH_TOO_DEEP)
+// it returns false without writing anything for other errors
+func writePathLimitError(w http.ResponseWriter, err error) bool {
+	if errors.Is(err, utils.ErrPathTooLong) || errors.Is(err, utils.ErrPathTooDeep) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return true
+	}
+	return false
+}
+
+// getVersionSelector returns version selected by exactly one of version (1-based ordinal), timestamp and latest query parameters
+func getVersionSelector(r *http.Request) (*types.VersionSelector, error) {
+	query := r.URL.Query()
+	selectors := []*types.VersionSelector{}
+	if version := query.Get("version"); version != "" {
+		value, err := strconv.ParseUint(version, 10, 64)
+		if err != nil {
+			return nil, errors.New("invalid version: " + err.Error())
+		}
+		selectors = append(selectors, &types.VersionSelector{Kind: types.VersionByOrdinal, Value: value})
+	}
+	if timestamp := query.Get("timestamp"); timestamp != "" {
+		value, err := strconv.ParseUint(timestamp, 10, 64)
+		if err != nil {
+			return nil, errors.New("invalid timestamp: " + err.Error())
+		}
+		selectors = append(selectors, &types.VersionSelector{Kind: types.VersionByTimestamp, Value: value})
+	}
+	if latest := query.Get("latest"); latest != "" {
+		isLatest, err := strconv.ParseBool(latest)
+		if err != nil {
+			return nil, errors.New("invalid latest: " + err.Error())
+		}
+		if isLatest {
+			selectors = append(selectors, &types.VersionSelector{Kind: types.VersionLatest})
+		}
+	}
+	if len(selectors) != 1 {
+		return nil, errors.New("exactly one of version, timestamp and latest is required")
+	}
+
+	err := selectors[0].Validate()
+	if err != nil {
+		return nil, err
+	}
+	return selectors[0], nil
+}
+
+// resolveTimestamp writes error response and returns false when version selected by query parameters cannot be resolved to its timestamp
+func (sh *ServerHandler) resolveTimestamp(w http.ResponseWriter, r *http.Request, afterPath string) (uint64, bool) {
+	selector, err := getVersionSelector(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return 0, false
+	}
+	// raw timestamp does not need history of file
+	if selector.Kind == types.VersionByTimestamp {
+		return selector.Value, true
+	}
+
+	versionRes, err := sh.ServerService.ResolveVersion(afterPath, selector)
+	if errors.Is(err, sync.ErrVersionNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return 0, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return 0, false
+	}
+	return versionRes.Timestamp, true
+}
+
+// getHistoryLimit returns configured number of histories returned when limit is not given,
+// so that listing histories does not scan and return every history by accident
+func getHistoryLimit() uint64 {
+	limit, err := strconv.ParseUint(config.GetViperEnvVariables("HISTORY_LIMIT"), 10, 64)
+	if err != nil {
+		log.Println("quics alert: ", "invalid HISTORY_LIMIT, use default page limit: ", err)
+		return DefaultPageLimit
+	}
+
+	return limit
+}
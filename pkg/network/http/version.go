@@ -0,0 +1,39 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/quic-s/quics/pkg/types"
+)
+
+// APIVersion wraps next to reject requests of clients whose api version (types.APIVersionHeader) is not supported by server
+// with 426 and the supported range, so that mismatched client and server fail clearly instead of misreading each other
+// requests without the header (e.g., curl, browser or shared links) are handled as the current version
+func APIVersion(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(types.APIVersionHeader, strconv.Itoa(types.APIVersion))
+		w.Header().Set(types.APIMinVersionHeader, strconv.Itoa(types.MinAPIVersion))
+
+		value := r.Header.Get(types.APIVersionHeader)
+		if value == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		version, err := strconv.Atoi(value)
+		switch {
+		case err != nil:
+			http.Error(w, types.VersionIncompatible+": invalid api version of client: "+value, http.StatusBadRequest)
+			return
+		case version < types.MinAPIVersion:
+			http.Error(w, types.VersionIncompatible+": api version "+value+" of client is older than supported by server ("+types.APIVersionRange(types.MinAPIVersion, types.APIVersion)+"), upgrade client", http.StatusUpgradeRequired)
+			return
+		case version > types.APIVersion:
+			http.Error(w, types.VersionIncompatible+": api version "+value+" of client is newer than supported by server ("+types.APIVersionRange(types.MinAPIVersion, types.APIVersion)+"), upgrade server", http.StatusUpgradeRequired)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
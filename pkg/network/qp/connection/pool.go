@@ -27,6 +27,8 @@ func (cp *Pool) UpdateConnection(uuid string, conn *qp.Connection) error {
 }
 
 func (cp *Pool) GetConnection(uuid string) (*qp.Connection, error) {
+	cp.connsMut.RLock()
+	defer cp.connsMut.RUnlock()
 	if conn, exists := cp.Conns[uuid]; exists {
 		return conn, nil
 	}
@@ -34,6 +36,9 @@ func (cp *Pool) GetConnection(uuid string) (*qp.Connection, error) {
 }
 
 func (cp *Pool) GetConnections(uuid []string) ([]*qp.Connection, error) {
+	cp.connsMut.RLock()
+	defer cp.connsMut.RUnlock()
+
 	conns := []*qp.Connection{}
 	for _, value := range uuid {
 		if conn, exists := cp.Conns[value]; exists {
@@ -0,0 +1,165 @@
+package qp
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	qp "github.com/quic-s/quics-protocol"
+	"github.com/quic-s/quics/pkg/core/registration"
+	"github.com/quic-s/quics/pkg/types"
+)
+
+// reasons of rejected handshakes reported by metrics
+const (
+	HandshakeRejectedTransaction = "transaction" // first transaction of connection is not registration
+	HandshakeRejectedAuth        = "auth"        // credential of registration is not valid
+	HandshakeRejectedTimeout     = "timeout"     // registration is not finished within registration timeout
+	HandshakeRejectedError       = "error"       // registration failed otherwise (e.g., malformed request)
+)
+
+// HandshakeGate requires registration on every connection before any other transaction is handled,
+// and drops connection which does not register in time after it is accepted (also when it never opens a stream)
+type HandshakeGate struct {
+	timeout time.Duration
+
+	mut      sync.Mutex
+	conns    map[*qp.Connection]*handshake
+	accepted uint64
+	rejected map[string]uint64
+}
+
+// handshake is registration state of a connection
+type handshake struct {
+	timer      *time.Timer
+	registered bool
+	timedOut   bool
+}
+
+func NewHandshakeGate(timeout time.Duration) *HandshakeGate {
+	return &HandshakeGate{
+		timeout:  timeout,
+		conns:    map[*qp.Connection]*handshake{},
+		rejected: map[string]uint64{},
+	}
+}
+
+// Accept starts registration timeout of conn as soon as it is accepted
+func (g *HandshakeGate) Accept(conn *qp.Connection) {
+	g.mut.Lock()
+	h := g.getHandshake(conn)
+	if !h.registered {
+		h.timer = time.AfterFunc(g.timeout, func() {
+			if g.expire(conn) {
+				conn.CloseWithError("registration timeout")
+			}
+		})
+	}
+	g.mut.Unlock()
+
+	// state is kept while connection is open, so that later transactions are checked against it
+	go func() {
+		<-conn.Conn.Context().Done()
+		g.mut.Lock()
+		defer g.mut.Unlock()
+		if h := g.conns[conn]; h != nil && h.timer != nil {
+			h.timer.Stop()
+		}
+		delete(g.conns, conn)
+	}()
+}
+
+// WrapRegistration runs handleFunc (registration) and marks connection registered when it succeeds in time
+// connection whose registration fails is closed
+func (g *HandshakeGate) WrapRegistration(handleFunc func(conn *qp.Connection, stream *qp.Stream, transactionName string, transactionID []byte) error) func(conn *qp.Connection, stream *qp.Stream, transactionName string, transactionID []byte) error {
+	return func(conn *qp.Connection, stream *qp.Stream, transactionName string, transactionID []byte) error {
+		// closing connection by timeout unblocks registration waiting for request of silent peer
+		err := handleFunc(conn, stream, transactionName, transactionID)
+
+		g.mut.Lock()
+		defer g.mut.Unlock()
+
+		h := g.getHandshake(conn)
+		switch {
+		case h.timedOut:
+			return errors.New("registration is not finished within " + g.timeout.String())
+		case errors.Is(err, registration.ErrUnauthenticated):
+			g.rejected[HandshakeRejectedAuth]++
+		case err != nil:
+			g.rejected[HandshakeRejectedError]++
+		case !h.registered:
+			if h.timer != nil {
+				h.timer.Stop()
+			}
+			h.registered = true
+			g.accepted++
+		}
+		if err != nil && !h.registered {
+			conn.CloseWithError(err.Error())
+		}
+		return err
+	}
+}
+
+// WrapRegistered runs handleFunc only on registered connection, and closes connection which is not registered yet
+func (g *HandshakeGate) WrapRegistered(handleFunc func(conn *qp.Connection, stream *qp.Stream, transactionName string, transactionID []byte) error) func(conn *qp.Connection, stream *qp.Stream, transactionName string, transactionID []byte) error {
+	return func(conn *qp.Connection, stream *qp.Stream, transactionName string, transactionID []byte) error {
+		g.mut.Lock()
+		registered := g.getHandshake(conn).registered
+		if !registered {
+			g.rejected[HandshakeRejectedTransaction]++
+		}
+		g.mut.Unlock()
+
+		if !registered {
+			err := errors.New("first transaction of connection must be " + types.REGISTERCLIENT + ": " + transactionName)
+			conn.CloseWithError(err.Error())
+			return err
+		}
+		return handleFunc(conn, stream, transactionName, transactionID)
+	}
+}
+
+// Stats returns the number of accepted handshakes and rejected ones by reason
+func (g *HandshakeGate) Stats() types.HandshakeStats {
+	g.mut.Lock()
+	defer g.mut.Unlock()
+
+	stats := types.HandshakeStats{
+		Accepted:         g.accepted,
+		RejectedByReason: map[string]uint64{},
+	}
+	for reason, count := range g.rejected {
+		stats.Rejected += count
+		stats.RejectedByReason[reason] = count
+	}
+
+	return stats
+}
+
+// getHandshake returns registration state of conn, creating it when transaction comes before conn is accepted by Accept
+// state of closed connection is not kept, since it is never deleted again; g.mut must be held
+func (g *HandshakeGate) getHandshake(conn *qp.Connection) *handshake {
+	h := g.conns[conn]
+	if h == nil {
+		h = &handshake{}
+		if conn.Conn.Context().Err() == nil {
+			g.conns[conn] = h
+		}
+	}
+	return h
+}
+
+// expire marks conn timed out unless it is registered, and reports whether it should be closed
+func (g *HandshakeGate) expire(conn *qp.Connection) bool {
+	g.mut.Lock()
+	defer g.mut.Unlock()
+
+	h := g.conns[conn]
+	if h == nil || h.registered {
+		return false
+	}
+	h.timedOut = true
+	g.rejected[HandshakeRejectedTimeout]++
+	return true
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/quic-s/quics/pkg/core/history"
 	"github.com/quic-s/quics/pkg/core/sharing"
 	"github.com/quic-s/quics/pkg/types"
+	"github.com/quic-s/quics/pkg/utils"
 )
 
 type HistoryHandler struct {
@@ -35,6 +36,7 @@ func (hh *HistoryHandler) ShowHistory(conn *qp.Connection, stream *qp.Stream, tr
 		log.Println("quics err: [", transactionName, "] decode request: ", err)
 		return err
 	}
+	request.AfterPath = utils.NormalizeAfterPath(request.AfterPath)
 
 	response, err := hh.historyService.ShowHistory(request)
 	if err != nil {
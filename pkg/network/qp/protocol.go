@@ -4,6 +4,7 @@ import (
 	"crypto/tls"
 	"fmt"
 	"log"
+	"time"
 
 	qp "github.com/quic-s/quics-protocol"
 	"github.com/quic-s/quics/pkg/network/qp/connection"
@@ -11,14 +12,15 @@ import (
 )
 
 type Protocol struct {
-	udpaddr            string
-	tlsConf            *tls.Config
-	initialTransaction func(conn *qp.Connection, stream *qp.Stream, transactionName string, transactionID []byte) error
-	Proto              *qp.QP
-	Pool               *connection.Pool
+	udpaddr    string
+	tlsConf    *tls.Config
+	Proto      *qp.QP
+	Pool       *connection.Pool
+	Streams    *StreamLimiter
+	Handshakes *HandshakeGate
 }
 
-func New(ip string, port int, pool *connection.Pool) (*Protocol, error) {
+func New(ip string, port int, pool *connection.Pool, maxStreamsPerConn int, registrationTimeout time.Duration) (*Protocol, error) {
 	// initialize protocol server
 	proto, err := qp.New(qp.LOG_LEVEL_ERROR)
 	if err != nil {
@@ -39,26 +41,36 @@ func New(ip string, port int, pool *connection.Pool) (*Protocol, error) {
 		NextProtos:   []string{"quic-s"},
 	}
 
-	err = proto.RecvTransactionHandleFunc(types.PING, ping)
+	p := &Protocol{
+		udpaddr:    ":6122",
+		tlsConf:    tlsConfig,
+		Proto:      proto,
+		Pool:       pool,
+		Streams:    NewStreamLimiter(maxStreamsPerConn),
+		Handshakes: NewHandshakeGate(registrationTimeout),
+	}
+
+	err = p.RecvTransactionHandleFunc(types.PING, ping)
 	if err != nil {
-		log.Println("quics err: ", err)
 		return nil, err
 	}
 
-	return &Protocol{
-		udpaddr: ":6122",
-		tlsConf: tlsConfig,
-		Proto:   proto,
-		Pool:    pool,
-	}, nil
+	return p, nil
 }
 
 // Start starts quics protocol server
 func (p *Protocol) Start() error {
 	errChan := make(chan error)
 	go func() {
-		// listen quics protocol with client
-		err := p.Proto.ListenWithTransaction(p.udpaddr, p.tlsConf, p.initialTransaction)
+		// panic of listener is returned as error, so that server can restart listener instead of crashing
+		defer func() {
+			if r := recover(); r != nil {
+				errChan <- fmt.Errorf("listener panicked: %v", r)
+			}
+		}()
+
+		// listen quics protocol with client, and start registration timeout of each connection as soon as it is accepted
+		err := p.Proto.Listen(p.udpaddr, p.tlsConf, p.Handshakes.Accept)
 		if err != nil {
 			log.Println("quics err: ", err)
 			errChan <- err
@@ -84,9 +96,12 @@ func (p *Protocol) Close() error {
 }
 
 func (p *Protocol) RecvTransactionHandleFunc(transactionName string, handleFunc func(conn *qp.Connection, stream *qp.Stream, transactionName string, transactionID []byte) error) error {
+	// registration must be finished on connection before any other transaction is handled
+	handleFunc = p.Streams.Wrap(handleFunc)
 	if transactionName == types.REGISTERCLIENT {
-		p.initialTransaction = handleFunc
-		return nil
+		handleFunc = p.Handshakes.WrapRegistration(handleFunc)
+	} else {
+		handleFunc = p.Handshakes.WrapRegistered(handleFunc)
 	}
 	err := p.Proto.RecvTransactionHandleFunc(transactionName, handleFunc)
 	if err != nil {
@@ -6,17 +6,21 @@ import (
 
 	qp "github.com/quic-s/quics-protocol"
 	"github.com/quic-s/quics/pkg/core/registration"
+	"github.com/quic-s/quics/pkg/core/sync"
 	"github.com/quic-s/quics/pkg/network/qp/connection"
 	"github.com/quic-s/quics/pkg/types"
+	"github.com/quic-s/quics/pkg/utils"
 )
 
 type RegistrationHandler struct {
 	registrationService registration.Service
+	syncService         sync.Service
 }
 
-func NewRegistrationHandler(service registration.Service) *RegistrationHandler {
+func NewRegistrationHandler(service registration.Service, syncService sync.Service) *RegistrationHandler {
 	return &RegistrationHandler{
 		registrationService: service,
+		syncService:         syncService,
 	}
 }
 
@@ -34,6 +38,19 @@ func (rh *RegistrationHandler) RegisterClient(conn *qp.Connection, stream *qp.St
 		return err
 	}
 
+	// credential is checked first, so that unauthenticated connection is dropped before any other work
+	state := conn.Conn.ConnectionState().TLS
+	keyingMaterial, err := state.ExportKeyingMaterial(utils.RegistrationProofLabel, nil, utils.RegistrationProofLength)
+	if err != nil {
+		log.Println("quics err: [", transactionName, "] ", err)
+		return err
+	}
+	err = rh.registrationService.Authenticate(request, keyingMaterial)
+	if err != nil {
+		log.Println("quics err: [", transactionName, "] ", conn.Conn.RemoteAddr(), ": ", err)
+		return err
+	}
+
 	// call registration service
 	response, err := rh.registrationService.RegisterClient(request, conn)
 	if err != nil {
@@ -52,6 +69,15 @@ func (rh *RegistrationHandler) RegisterClient(conn *qp.Connection, stream *qp.St
 		return err
 	}
 	log.Println("quics: [", transactionName, "] transaction finished")
+
+	// deliver changes queued while client was offline without waiting for background full scan
+	go func() {
+		err := rh.syncService.DeliverPendingChanges(request.UUID)
+		if err != nil {
+			log.Println("quics err: [", transactionName, "] resume sync: ", err)
+		}
+	}()
+
 	return nil
 }
 
@@ -6,6 +6,7 @@ import (
 	qp "github.com/quic-s/quics-protocol"
 	"github.com/quic-s/quics/pkg/core/sharing"
 	"github.com/quic-s/quics/pkg/types"
+	"github.com/quic-s/quics/pkg/utils"
 )
 
 type SharingHandler struct {
@@ -32,6 +33,7 @@ func (sh *SharingHandler) StartSharing(conn *qp.Connection, stream *qp.Stream, t
 		log.Println("quics err: [", transactionName, "] ", err)
 		return err
 	}
+	request.AfterPath = utils.NormalizeAfterPath(request.AfterPath)
 
 	response, err := sh.sharingService.CreateLink(request)
 	if err != nil {
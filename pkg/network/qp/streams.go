@@ -0,0 +1,111 @@
+package qp
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	qp "github.com/quic-s/quics-protocol"
+	"github.com/quic-s/quics/pkg/types"
+)
+
+// StreamLimiter bounds the number of concurrent transactions (= incoming streams) of each connection,
+// because quics-protocol does not expose quic config of its listener
+type StreamLimiter struct {
+	max int
+
+	mut          sync.Mutex
+	conns        map[*qp.Connection]*types.StreamStats
+	lastActivity time.Time // when a transaction began or ended, or a connection was closed
+}
+
+func NewStreamLimiter(max int) *StreamLimiter {
+	return &StreamLimiter{
+		max:          max,
+		conns:        map[*qp.Connection]*types.StreamStats{},
+		lastActivity: time.Now(),
+	}
+}
+
+// Wrap rejects transaction of handleFunc when its connection already has max transactions in progress
+func (l *StreamLimiter) Wrap(handleFunc func(conn *qp.Connection, stream *qp.Stream, transactionName string, transactionID []byte) error) func(conn *qp.Connection, stream *qp.Stream, transactionName string, transactionID []byte) error {
+	return func(conn *qp.Connection, stream *qp.Stream, transactionName string, transactionID []byte) error {
+		err := l.acquire(conn)
+		if err != nil {
+			return err
+		}
+		defer l.release(conn)
+
+		return handleFunc(conn, stream, transactionName, transactionID)
+	}
+}
+
+// Stats returns stream counts of every connection
+func (l *StreamLimiter) Stats() []types.StreamStats {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+
+	stats := []types.StreamStats{}
+	for _, stat := range l.conns {
+		stats = append(stats, *stat)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Address < stats[j].Address
+	})
+
+	return stats
+}
+
+func (l *StreamLimiter) Max() int {
+	return l.max
+}
+
+// IdleSince returns when clients last used quics protocol, and false while any client is connected
+func (l *StreamLimiter) IdleSince() (time.Time, bool) {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+
+	return l.lastActivity, len(l.conns) == 0
+}
+
+func (l *StreamLimiter) acquire(conn *qp.Connection) error {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+
+	stat, exists := l.conns[conn]
+	if !exists {
+		stat = &types.StreamStats{Address: conn.Conn.RemoteAddr().String()}
+		l.conns[conn] = stat
+
+		// forget the connection when it is closed
+		go func() {
+			<-conn.Conn.Context().Done()
+
+			l.mut.Lock()
+			defer l.mut.Unlock()
+			delete(l.conns, conn)
+			l.lastActivity = time.Now()
+		}()
+	}
+	l.lastActivity = time.Now()
+
+	if l.max > 0 && stat.Active >= l.max {
+		stat.Rejected++
+		return errors.New("[StreamLimiter] too many concurrent streams on connection (max: " + strconv.Itoa(l.max) + ")")
+	}
+
+	stat.Active++
+	return nil
+}
+
+func (l *StreamLimiter) release(conn *qp.Connection) {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+
+	if stat, exists := l.conns[conn]; exists {
+		stat.Active--
+	}
+	l.lastActivity = time.Now()
+}
@@ -4,11 +4,13 @@ import (
 	"crypto/sha1"
 	"io"
 	"log"
+	"path/filepath"
 	stdsync "sync"
 
 	"github.com/quic-s/quics/pkg/network/qp/connection"
 	"github.com/quic-s/quics/pkg/utils"
 
+	"github.com/quic-go/quic-go"
 	qp "github.com/quic-s/quics-protocol"
 	"github.com/quic-s/quics/pkg/core/sync"
 	"github.com/quic-s/quics/pkg/types"
@@ -48,6 +50,7 @@ func (sh *SyncHandler) RegisterRootDir(conn *qp.Connection, stream *qp.Stream, t
 		log.Println("quics err: [", transactionName, "] ", err)
 		return err
 	}
+	request.AfterPath = utils.NormalizeAfterPath(request.AfterPath)
 
 	// Register root directory of client to database
 	response, err := sh.syncService.RegisterRootDir(request)
@@ -96,6 +99,7 @@ func (sh *SyncHandler) SyncRootDir(conn *qp.Connection, stream *qp.Stream, trans
 		log.Println("quics err: [", transactionName, "] ", err)
 		return err
 	}
+	request.AfterPath = utils.NormalizeAfterPath(request.AfterPath)
 
 	// get root directory path of requested data
 	rootDirRegisterRes, err := sh.syncService.SyncRootDir(request)
@@ -180,6 +184,7 @@ func (sh *SyncHandler) DisconnectRootDir(conn *qp.Connection, stream *qp.Stream,
 		log.Println("quics err: [", transactionName, "] ", err)
 		return err
 	}
+	request.AfterPath = utils.NormalizeAfterPath(request.AfterPath)
 
 	// get root directory path of requested data
 	disconnectRootDirRes, err := sh.syncService.DisconnectRootDir(request)
@@ -221,6 +226,7 @@ func (sh *SyncHandler) PleaseSync(conn *qp.Connection, stream *qp.Stream, transa
 		log.Println("quics err: [", transactionName, "] ", err)
 		return err
 	}
+	pleaseSyncReq.AfterPath = utils.NormalizeAfterPath(pleaseSyncReq.AfterPath)
 
 	// lock mutex by hash value of file path
 	// using hash value is to reduce the number of mutex
@@ -264,6 +270,8 @@ func (sh *SyncHandler) PleaseSync(conn *qp.Connection, stream *qp.Stream, transa
 		log.Println("quics err: [", transactionName, "] ", err)
 		return err
 	}
+	pleaseTakeReq.AfterPath = utils.NormalizeAfterPath(pleaseTakeReq.AfterPath)
+
 	fileMetedata := &types.FileMetadata{
 		Name:    fileInfo.Name,
 		Size:    fileInfo.Size,
@@ -349,6 +357,7 @@ func (sh *SyncHandler) ChooseOne(conn *qp.Connection, stream *qp.Stream, transac
 		log.Println("quics err: [", transactionName, "] ", err)
 		return err
 	}
+	request.AfterPath = utils.NormalizeAfterPath(request.AfterPath)
 
 	// lock mutex by hash value of file path
 	// using hash value is to reduce the number of mutex
@@ -397,6 +406,9 @@ func (sh *SyncHandler) Rescan(conn *qp.Connection, stream *qp.Stream, transactio
 		log.Println("quics err: [", transactionName, "] ", err)
 		return err
 	}
+	for i, rootAfterPath := range request.RootAfterPath {
+		request.RootAfterPath[i] = utils.NormalizeAfterPath(rootAfterPath)
+	}
 
 	rescanRes, err := sh.syncService.Rescan(request)
 	if err != nil {
@@ -435,6 +447,7 @@ func (sh *SyncHandler) RollbackFileByHistory(conn *qp.Connection, stream *qp.Str
 		log.Println("quics err: [", transactionName, "] ", err)
 		return err
 	}
+	request.AfterPath = utils.NormalizeAfterPath(request.AfterPath)
 
 	response, err := sh.syncService.RollbackFileByHistory(request)
 	if err != nil {
@@ -473,6 +486,7 @@ func (sh *SyncHandler) ConflictDownload(conn *qp.Connection, stream *qp.Stream,
 		log.Println("quics err: [", transactionName, "] ", err)
 		return err
 	}
+	request.AfterPath = utils.NormalizeAfterPath(request.AfterPath)
 
 	response, err := sh.syncService.GetStagingNum(request)
 	if err != nil {
@@ -511,7 +525,7 @@ func (sh *SyncHandler) ConflictDownload(conn *qp.Connection, stream *qp.Stream,
 		}
 
 		if request.Candidate == "server" {
-			filePath := utils.GetQuicsSyncDirPath() + request.AfterPath
+			filePath := filepath.Join(utils.GetQuicsSyncDirPath(), filepath.FromSlash(request.AfterPath))
 			err = stream.SendFileBMessage(data, filePath)
 			if err != nil {
 				log.Println("quics err: [", transactionName, "] ", err)
@@ -546,6 +560,7 @@ func (sh *SyncHandler) DownloadHistory(conn *qp.Connection, stream *qp.Stream, t
 		log.Println("quics err: [", transactionName, "] ", err)
 		return err
 	}
+	request.AfterPath = utils.NormalizeAfterPath(request.AfterPath)
 
 	response, filePath, err := sh.syncService.DownloadHistory(request)
 	if err != nil {
@@ -585,6 +600,12 @@ type Transaction struct {
 	stream          *qp.Stream
 }
 
+// IsConnected checks whether client of uuid is connected to server, so that server can open transaction to it
+func (sa *SyncAdapter) IsConnected(uuid string) bool {
+	_, err := sa.Pool.GetConnection(uuid)
+	return err == nil
+}
+
 // OpenTransaction opens transaction
 // this method is called when server wants to open transaction (server-push)
 func (sa *SyncAdapter) OpenTransaction(transactionName string, uuid string) (sync.Transaction, error) {
@@ -634,6 +655,30 @@ func (sa *SyncAdapter) OpenTransaction(transactionName string, uuid string) (syn
 	return transaction, nil
 }
 
+// Throttle paces contents sent and received through the transaction by throttle (e.g., of bandwidth schedule of client)
+func (t *Transaction) Throttle(throttle *utils.Throttle) {
+	t.stream.Stream = &throttledStream{
+		Stream: t.stream.Stream,
+		reader: throttle.Reader(t.stream.Stream),
+		writer: throttle.Writer(t.stream.Stream),
+	}
+}
+
+// throttledStream is quic stream whose reads and writes are paced
+type throttledStream struct {
+	quic.Stream
+	reader io.Reader
+	writer io.Writer
+}
+
+func (ts *throttledStream) Read(p []byte) (int, error) {
+	return ts.reader.Read(p)
+}
+
+func (ts *throttledStream) Write(p []byte) (int, error) {
+	return ts.writer.Write(p)
+}
+
 func (t *Transaction) Close() error {
 	t.wg.Done()
 	log.Println("quics: close ", t.transactionName, " transaction")
@@ -666,6 +711,7 @@ func (t *Transaction) RequestMustSync(mustSyncReq *types.MustSyncReq) (*types.Mu
 		log.Println("quics err: [", t.transactionName, "] ", err)
 		return nil, err
 	}
+	mustSyncRes.AfterPath = utils.NormalizeAfterPath(mustSyncRes.AfterPath)
 	return mustSyncRes, nil
 }
 
@@ -697,6 +743,7 @@ func (t *Transaction) RequestGiveYou(giveYouReq *types.GiveYouReq, historyFilePa
 		log.Println("quics err: [", t.transactionName, "] ", err)
 		return nil, err
 	}
+	giveYouRes.AfterPath = utils.NormalizeAfterPath(giveYouRes.AfterPath)
 	return giveYouRes, nil
 }
 
@@ -728,6 +775,7 @@ func (t *Transaction) RequestForceSync(mustSyncReq *types.MustSyncReq, historyFi
 		log.Println("quics err: [", t.transactionName, "] ", err)
 		return nil, err
 	}
+	mustSyncRes.AfterPath = utils.NormalizeAfterPath(mustSyncRes.AfterPath)
 	return mustSyncRes, nil
 }
 
@@ -758,9 +806,47 @@ func (t *Transaction) RequestAskAllMeta(askAllMetaReq *types.AskAllMetaReq) (*ty
 		log.Println("quics err: [", t.transactionName, "] ", err)
 		return nil, err
 	}
+	for i, syncMeta := range askAllMetaRes.SyncMetaList {
+		askAllMetaRes.SyncMetaList[i].AfterPath = utils.NormalizeAfterPath(syncMeta.AfterPath)
+	}
 	return askAllMetaRes, nil
 }
 
+// send and receive askmanifest request and response
+// using on FullScan method in sync service for large root directories
+func (t *Transaction) RequestAskManifest(askManifestReq *types.AskManifestReq) (*types.AskManifestRes, error) {
+	request, err := askManifestReq.Encode()
+	if err != nil {
+		log.Println("quics err: [", t.transactionName, "] ", err)
+		return nil, err
+	}
+
+	err = t.stream.SendBMessage(request)
+	if err != nil {
+		log.Println("quics err: [", t.transactionName, "] ", err)
+		return nil, err
+	}
+
+	// receive
+	res, err := t.stream.RecvBMessage()
+	if err != nil {
+		log.Println("quics err: [", t.transactionName, "] ", err)
+		return nil, err
+	}
+
+	askManifestRes := &types.AskManifestRes{}
+	if err := askManifestRes.Decode(res); err != nil {
+		log.Println("quics err: [", t.transactionName, "] ", err)
+		return nil, err
+	}
+	for i, node := range askManifestRes.Nodes {
+		for j, syncMeta := range node.Entries {
+			askManifestRes.Nodes[i].Entries[j].AfterPath = utils.NormalizeAfterPath(syncMeta.AfterPath)
+		}
+	}
+	return askManifestRes, nil
+}
+
 // send and receive needsync request and response
 // using when server wants to get PleaseSync request from client
 func (t *Transaction) RequestNeedSync(needSyncReq *types.NeedSyncReq) (*types.NeedSyncRes, error) {
@@ -818,6 +904,7 @@ func (t *Transaction) RequestNeedContent(needContentReq *types.NeedContentReq) (
 		log.Println("quics err: [", t.transactionName, "] ", err)
 		return nil, nil, nil, err
 	}
+	needContentRes.AfterPath = utils.NormalizeAfterPath(needContentRes.AfterPath)
 
 	fileMetadata := &types.FileMetadata{
 		Name:    fileInfo.Name,
@@ -1,23 +1,70 @@
 package badger
 
 import (
+	"errors"
 	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/dgraph-io/badger/v3"
+	"github.com/quic-s/quics/pkg/types"
 	"github.com/quic-s/quics/pkg/utils"
 )
 
+// ValueLogGCDiscardRatio is the fraction of garbage which value log file must have to be rewritten by value log gc,
+// and ValueLogGCMinGarbage is garbage below which value log gc is not worth running (e.g., headers of value log files)
+const (
+	ValueLogGCDiscardRatio = 0.5
+	ValueLogGCMinGarbage   = 1 << 20
+)
+
 type Badger struct {
-	db *badger.DB
+	db             *badger.DB
+	maintenanceMut sync.Mutex // compaction and value log gc are not run at once
 }
 
-func NewBadgerRepository() (*Badger, error) {
-	// initialize badger database in .quics/badger directory
-	opts := badger.DefaultOptions(utils.GetQuicsDirPath() + "/badger")
+// NewBadgerRepository opens badger database in data directory
+// safeMode disables background compaction, so that files of database are not rewritten while it is inspected,
+// and repair moves files of database which fails to open aside instead of failing (see repairDB)
+func NewBadgerRepository(safeMode bool, repair bool) (*Badger, error) {
+	// initialize badger database in {dataDir}/badger directory
+	opts := badger.DefaultOptions(utils.GetQuicsDataDirPath() + "/badger")
 	opts.Logger = nil
+	if safeMode {
+		opts.NumCompactors = 0
+	}
+
+	// write-ahead log files left by unclean shutdown are replayed (and their torn tail is truncated) on open
+	// checking them only reports what is lost, so database is opened without the report when they can not be read
+	walFiles, err := findWALFiles(opts.Dir)
+	if err != nil {
+		log.Println("quics err: ", "write-ahead log files of the database can not be checked, so recovery is not reported: ", err)
+		walFiles = nil
+	}
+
 	db, err := badger.Open(opts)
+	if err != nil && repair {
+		db, err = repairDB(opts, err)
+	} else if err == nil {
+		logWALRecovery(walFiles)
+	}
 	if err != nil {
 		log.Println("quics: Error while connecting to the database: ", err)
+		if !repair {
+			log.Println("quics alert: ", "database can not be recovered; start server with --repair-db to move broken files aside and start with what is left (data may be lost)")
+		}
+		return nil, err
+	}
+
+	// records saved by older version are updated before any service reads them
+	err = migrate(db)
+	if err != nil {
+		log.Println("quics: Error while migrating the database: ", err)
+		db.Close()
 		return nil, err
 	}
 
@@ -36,6 +83,273 @@ func (b *Badger) Close() error {
 	return nil
 }
 
+// Ping checks that database is open and readable by reading a key in a read-only transaction
+func (b *Badger) Ping() error {
+	if b.db.IsClosed() {
+		return errors.New("database is closed")
+	}
+
+	return b.db.View(func(txn *badger.Txn) error {
+		_, err := txn.Get([]byte(PrefixServerPassword))
+		if err != nil && err != badger.ErrKeyNotFound {
+			return err
+		}
+		return nil
+	})
+}
+
+// Checkpoint makes every write committed before it durable on disk
+// db.Sync only syncs value log, and memtable WAL is not synced without SyncWrites,
+// so files of database (e.g., *.mem, *.vlog, *.sst, MANIFEST) and the directory are synced as well
+func (b *Badger) Checkpoint() (*types.CheckpointRes, error) {
+	start := time.Now()
+
+	err := b.db.Sync()
+	if err != nil {
+		return nil, err
+	}
+
+	dir := b.db.Opts().Dir
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	checkpointRes := &types.CheckpointRes{}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+
+		err = syncFile(filepath.Join(dir, entry.Name()))
+		if os.IsNotExist(err) {
+			// e.g., memtable flushed or value log garbage collected while syncing
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		checkpointRes.SyncedFiles++
+	}
+
+	// new files (e.g., memtable WAL) are kept only when their directory entries are durable
+	err = syncFile(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	checkpointRes.Duration = time.Since(start).String()
+	return checkpointRes, nil
+}
+
+// DBStats reports sizes of LSM tree and value log, and estimates garbage of value log by scanning latest versions of all keys
+func (b *Badger) DBStats() (*types.DBStatsRes, error) {
+	dbStatsRes := &types.DBStatsRes{}
+
+	sstSize, vlogSize, vlogFiles, err := b.diskUsage()
+	if err != nil {
+		return nil, err
+	}
+	dbStatsRes.LSMSize = sstSize
+	dbStatsRes.ValueLogSize = vlogSize
+	dbStatsRes.ValueLogFiles = vlogFiles
+
+	for _, level := range b.db.Levels() {
+		dbStatsRes.Levels = append(dbStatsRes.Levels, types.DBLevelStats{
+			Level:      level.Level,
+			Tables:     level.NumTables,
+			Size:       level.Size,
+			TargetSize: level.TargetSize,
+			StaleSize:  level.StaleDatSize,
+		})
+		dbStatsRes.StaleLSMSize += level.StaleDatSize
+	}
+
+	// values at least as large as value threshold are stored in value log, and estimated size of them is their entry in it
+	threshold := b.db.Opts().ValueThreshold
+	err = b.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			if item.ValueSize() >= threshold {
+				dbStatsRes.LiveValueLogSize += item.EstimatedSize()
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// live values of the newest value log file are counted as well, so estimated garbage is a lower bound
+	if dbStatsRes.ValueLogSize > dbStatsRes.LiveValueLogSize {
+		dbStatsRes.EstimatedGarbage = dbStatsRes.ValueLogSize - dbStatsRes.LiveValueLogSize
+	}
+	dbStatsRes.ValueLogGCRecommended = dbStatsRes.EstimatedGarbage >= ValueLogGCMinGarbage && float64(dbStatsRes.EstimatedGarbage) >= float64(dbStatsRes.ValueLogSize)*ValueLogGCDiscardRatio
+
+	maintenance, err := b.getDBMaintenance()
+	if err != nil {
+		return nil, err
+	}
+	dbStatsRes.DBMaintenance = *maintenance
+
+	return dbStatsRes, nil
+}
+
+// CompactDB compacts tables spread over levels of LSM tree into one level (dropping stale entries), then runs value log gc
+// until no value log file has ValueLogGCDiscardRatio of garbage when valueLogGC is true
+func (b *Badger) CompactDB(valueLogGC bool) (*types.DBCompactRes, error) {
+	b.maintenanceMut.Lock()
+	defer b.maintenanceMut.Unlock()
+
+	start := time.Now()
+	compactRes := &types.DBCompactRes{}
+
+	sstSize, vlogSize, _, err := b.diskUsage()
+	if err != nil {
+		return nil, err
+	}
+	compactRes.LSMSizeBefore = sstSize
+	compactRes.ValueLogSizeBefore = vlogSize
+
+	maintenance, err := b.getDBMaintenance()
+	if err != nil {
+		return nil, err
+	}
+
+	err = b.db.Flatten(runtime.NumCPU())
+	if err != nil {
+		return nil, err
+	}
+	maintenance.LastCompaction = time.Now()
+
+	if valueLogGC {
+		for {
+			err = b.db.RunValueLogGC(ValueLogGCDiscardRatio)
+			if err == badger.ErrNoRewrite {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			compactRes.RewrittenLogFiles++
+		}
+		maintenance.LastValueLogGC = time.Now()
+	}
+
+	err = b.db.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte(PrefixDBMaintenance), maintenance.Encode())
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sstSize, vlogSize, _, err = b.diskUsage()
+	if err != nil {
+		return nil, err
+	}
+	compactRes.LSMSizeAfter = sstSize
+	compactRes.ValueLogSizeAfter = vlogSize
+	compactRes.Duration = time.Since(start).String()
+
+	return compactRes, nil
+}
+
+// DBSize reports bytes of sst files and sealed value log files without scanning keys (cheap enough for metrics)
+func (b *Badger) DBSize() *types.DBSizeStats {
+	sstSize, vlogSize, _, err := b.diskUsage()
+	if err != nil {
+		return &types.DBSizeStats{CheckErr: err.Error()}
+	}
+
+	return &types.DBSizeStats{
+		LSMSize:      sstSize,
+		ValueLogSize: vlogSize,
+	}
+}
+
+// diskUsage returns bytes of sst files and sealed value log files, and the number of value log files in database directory
+// the newest value log file is being written and preallocated (e.g., 2GB of sparse file), so only older ones are measured
+func (b *Badger) diskUsage() (int64, int64, int, error) {
+	entries, err := os.ReadDir(b.db.Opts().Dir)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	sstSize := int64(0)
+	vlogSizes := map[string]int64{}
+	activeVlog := ""
+	for _, entry := range entries {
+		isSST := strings.HasSuffix(entry.Name(), ".sst")
+		isVlog := strings.HasSuffix(entry.Name(), ".vlog")
+		if !entry.Type().IsRegular() || (!isSST && !isVlog) {
+			continue
+		}
+
+		info, err := entry.Info()
+		if os.IsNotExist(err) {
+			// e.g., table dropped by compaction while listing
+			continue
+		}
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		if isSST {
+			sstSize += info.Size()
+			continue
+		}
+
+		// value log files are named by zero-padded id, so the newest one is the last by name
+		vlogSizes[entry.Name()] = info.Size()
+		if entry.Name() > activeVlog {
+			activeVlog = entry.Name()
+		}
+	}
+
+	vlogSize := int64(0)
+	for name, size := range vlogSizes {
+		if name != activeVlog {
+			vlogSize += size
+		}
+	}
+
+	return sstSize, vlogSize, len(vlogSizes), nil
+}
+
+// getDBMaintenance returns when maintenance of database was last run
+func (b *Badger) getDBMaintenance() (*types.DBMaintenance, error) {
+	maintenance := &types.DBMaintenance{}
+	err := b.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(PrefixDBMaintenance))
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		return item.Value(maintenance.Decode)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return maintenance, nil
+}
+
+func syncFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return file.Sync()
+}
+
 func (b *Badger) NewHistoryRepository() *HistoryRepository {
 	return &HistoryRepository{
 		db: b.db,
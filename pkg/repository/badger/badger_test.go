@@ -0,0 +1,28 @@
+package badger
+
+import (
+	"testing"
+
+	"github.com/dgraph-io/badger/v3"
+)
+
+// openTestDB opens in-memory database which is closed when test ends
+func openTestDB(t *testing.T) *badger.DB {
+	t.Helper()
+
+	return openTestDBWithOptions(t, badger.DefaultOptions("").WithInMemory(true))
+}
+
+// openTestDBWithOptions opens database of opts which is closed when test ends
+func openTestDBWithOptions(t *testing.T, opts badger.Options) *badger.DB {
+	t.Helper()
+
+	opts.Logger = nil
+	db, err := badger.Open(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
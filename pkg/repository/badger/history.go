@@ -95,3 +95,49 @@ func (hr *HistoryRepository) GetFileHistoriesForClient(afterPath string, cntFrom
 
 	return fileHistories, nil
 }
+
+// DeleteFileHistoriesBefore deletes the histories of the file older than timestamp and returns deleted timestamps
+func (hr *HistoryRepository) DeleteFileHistoriesBefore(afterPath string, timestamp uint64) ([]uint64, error) {
+	deleted := []uint64{}
+
+	err := hr.db.Update(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = true
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		prefix := []byte(PrefixHistory + afterPath + "_")
+
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			item := it.Item()
+			val, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+
+			fileHistory := &types.FileHistory{}
+			err = fileHistory.Decode(val)
+			if err != nil {
+				return err
+			}
+
+			// prefix can also match other file (e.g., /root/a and /root/a_b)
+			if fileHistory.AfterPath != afterPath || fileHistory.Timestamp >= timestamp {
+				continue
+			}
+
+			err = txn.Delete(item.KeyCopy(nil))
+			if err != nil {
+				return err
+			}
+			deleted = append(deleted, fileHistory.Timestamp)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return deleted, nil
+}
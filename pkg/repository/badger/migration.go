@@ -0,0 +1,107 @@
+package badger
+
+import (
+	"bytes"
+	"log"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/quic-s/quics/pkg/types"
+)
+
+const (
+	// PrefixMigration marks migrations which are already applied to database
+	PrefixMigration string = "migration_"
+
+	MigrationNormalizeRootLists string = "normalize_root_lists"
+)
+
+// migrate applies migrations which are not applied to database yet
+func migrate(db *badger.DB) error {
+	return runMigration(db, MigrationNormalizeRootLists, normalizeRootLists)
+}
+
+// runMigration runs migration of name once and marks it in the same transaction
+func runMigration(db *badger.DB, name string, migration func(txn *badger.Txn) error) error {
+	key := []byte(PrefixMigration + name)
+
+	return db.Update(func(txn *badger.Txn) error {
+		_, err := txn.Get(key)
+		if err == nil {
+			return nil
+		}
+		if err != badger.ErrKeyNotFound {
+			return err
+		}
+
+		err = migration(txn)
+		if err != nil {
+			return err
+		}
+
+		log.Println("quics: migration applied: ", name)
+		return txn.Set(key, []byte{})
+	})
+}
+
+// normalizeRootLists rewrites clients and root directories saved before Encode removed duplicates of Root and UUIDs and sorted them
+func normalizeRootLists(txn *badger.Txn) error {
+	for _, prefix := range []string{PrefixClient, PrefixRootDir} {
+		err := rewriteByPrefix(txn, prefix, func(val []byte) ([]byte, error) {
+			if prefix == PrefixClient {
+				client := &types.Client{}
+				if err := client.Decode(val); err != nil {
+					return nil, err
+				}
+				return client.Encode(), nil
+			}
+
+			rootDir := &types.RootDirectory{}
+			if err := rootDir.Decode(val); err != nil {
+				return nil, err
+			}
+			return rootDir.Encode(), nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rewriteByPrefix sets value of every key with prefix updated by update (unchanged values are not written)
+func rewriteByPrefix(txn *badger.Txn, prefix string, update func(val []byte) ([]byte, error)) error {
+	it := txn.NewIterator(badger.DefaultIteratorOptions)
+	defer it.Close()
+
+	type entry struct {
+		key []byte
+		val []byte
+	}
+	entries := []entry{}
+	for it.Seek([]byte(prefix)); it.ValidForPrefix([]byte(prefix)); it.Next() {
+		item := it.Item()
+		val, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+
+		updated, err := update(val)
+		if err != nil {
+			log.Println("quics alert: ", "skip undecodable value of ", string(item.Key()), ": ", err)
+			continue
+		}
+		if bytes.Equal(val, updated) {
+			continue
+		}
+		entries = append(entries, entry{key: item.KeyCopy(nil), val: updated})
+	}
+
+	for _, e := range entries {
+		if err := txn.Set(e.key, e.val); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
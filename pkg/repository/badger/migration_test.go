@@ -0,0 +1,159 @@
+package badger
+
+import (
+	"bytes"
+	"encoding/gob"
+	"strings"
+	"testing"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/quic-s/quics/pkg/types"
+)
+
+func TestSaveRootListsIdempotent(t *testing.T) {
+	tests := []struct {
+		name      string
+		roots     [][]string // after paths of root directories associated with client by each save
+		uuids     [][]string // uuids associated with root directory by each save
+		wantRoots string
+		wantUUIDs string
+	}{
+		{
+			name:      "same association repeated",
+			roots:     [][]string{{"/r"}, {"/r"}, {"/r"}},
+			uuids:     [][]string{{"a"}, {"a"}, {"a"}},
+			wantRoots: "/r",
+			wantUUIDs: "a",
+		},
+		{
+			name:      "associations in different order",
+			roots:     [][]string{{"/s"}, {"/r"}, {"/s"}, {"/q"}},
+			uuids:     [][]string{{"b"}, {"a"}, {"b"}, {"c"}},
+			wantRoots: "/q,/r,/s",
+			wantUUIDs: "a,b,c",
+		},
+		{
+			name:      "duplicates in one save",
+			roots:     [][]string{{"/s", "/r", "/s", "/r"}},
+			uuids:     [][]string{{"b", "a", "b", "a"}},
+			wantRoots: "/r,/s",
+			wantUUIDs: "a,b",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := &RegistrationRepository{db: openTestDB(t)}
+
+			client := &types.Client{UUID: "a"}
+			rootDir := &types.RootDirectory{AfterPath: "/r"}
+			for i := range tt.roots {
+				for _, afterPath := range tt.roots[i] {
+					client.Root = append(client.Root, types.RootDirectory{AfterPath: afterPath})
+				}
+				if err := rr.SaveClient(client.UUID, client); err != nil {
+					t.Fatal(err)
+				}
+				rootDir.UUIDs = append(rootDir.UUIDs, tt.uuids[i]...)
+				if err := rr.SaveRootDir(rootDir.AfterPath, rootDir); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			savedClient, err := rr.GetClientByUUID(client.UUID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			roots := []string{}
+			for _, root := range savedClient.Root {
+				roots = append(roots, root.AfterPath)
+			}
+			if got := strings.Join(roots, ","); got != tt.wantRoots {
+				t.Errorf("roots = %s, want %s", got, tt.wantRoots)
+			}
+
+			savedRootDir, err := rr.GetRootDirByPath(rootDir.AfterPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Join(savedRootDir.UUIDs, ","); got != tt.wantUUIDs {
+				t.Errorf("uuids = %s, want %s", got, tt.wantUUIDs)
+			}
+
+			// saving normalized records again stores the same bytes
+			if !bytes.Equal(savedClient.Encode(), client.Encode()) {
+				t.Error("client is encoded differently when it is saved again")
+			}
+			if !bytes.Equal(savedRootDir.Encode(), rootDir.Encode()) {
+				t.Error("root directory is encoded differently when it is saved again")
+			}
+		})
+	}
+}
+
+func TestMigrateNormalizeRootLists(t *testing.T) {
+	db := openTestDB(t)
+
+	// records saved by older version, which Encode did not normalize
+	encode := func(value any) []byte {
+		buffer := bytes.Buffer{}
+		if err := gob.NewEncoder(&buffer).Encode(value); err != nil {
+			t.Fatal(err)
+		}
+		return buffer.Bytes()
+	}
+	client := &types.Client{UUID: "a", Root: []types.RootDirectory{{AfterPath: "/s"}, {AfterPath: "/r"}, {AfterPath: "/s"}}}
+	rootDir := &types.RootDirectory{AfterPath: "/r", UUIDs: []string{"b", "a", "b"}}
+	err := db.Update(func(txn *badger.Txn) error {
+		if err := txn.Set([]byte(PrefixClient+client.UUID), encode(client)); err != nil {
+			return err
+		}
+		if err := txn.Set([]byte(PrefixRootDir+rootDir.AfterPath), encode(rootDir)); err != nil {
+			return err
+		}
+		return txn.Set([]byte(PrefixRootDir+"/broken"), []byte("not gob"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// migration is applied once however many times server starts
+	for i := 0; i < 2; i++ {
+		if err := migrate(db); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rr := &RegistrationRepository{db: db}
+	migratedClient, err := rr.GetClientByUUID(client.UUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migratedClient.Root) != 2 || migratedClient.Root[0].AfterPath != "/r" || migratedClient.Root[1].AfterPath != "/s" {
+		t.Errorf("roots after migration = %v, want [/r /s]", migratedClient.Root)
+	}
+	migratedRootDir, err := rr.GetRootDirByPath(rootDir.AfterPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(migratedRootDir.UUIDs, ","); got != "a,b" {
+		t.Errorf("uuids after migration = %s, want a,b", got)
+	}
+
+	// undecodable record is left as it is
+	err = db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(PrefixRootDir + "/broken"))
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			if string(val) != "not gob" {
+				t.Errorf("undecodable record = %q, want it unchanged", val)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,297 @@
+package badger
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/quic-s/quics/pkg/types"
+)
+
+// CancelCheckInterval is the number of iterated keys between checks of cancellation of scan
+const CancelCheckInterval = 256
+
+// decodable is constraint for pointer of database data which can be decoded
+type decodable[T any] interface {
+	*T
+	Decode(data []byte) error
+}
+
+// encodeCursor makes cursor of the position (offset of next item) and the key (after prefix) of last item
+func encodeCursor(position uint64, key string) string {
+	return strconv.FormatUint(position, 10) + ":" + key
+}
+
+// decodeCursor reads position and key (after prefix) of the cursor
+// cursor without position is read as the key, and the offset of request is used as position
+func decodeCursor(request *types.PageReq) (uint64, string) {
+	position, key, found := strings.Cut(request.Cursor, ":")
+	if !found {
+		return request.Offset, request.Cursor
+	}
+	offset, err := strconv.ParseUint(position, 10, 64)
+	if err != nil {
+		return request.Offset, request.Cursor
+	}
+
+	return offset, key
+}
+
+// countTotal counts entries which have the prefix with key-only iteration
+func countTotal(txn *badger.Txn, prefix string, request *types.PageReq) (uint64, error) {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	total := uint64(0)
+	for it.Seek([]byte(prefix)); it.ValidForPrefix([]byte(prefix)); it.Next() {
+		total++
+		if total%CancelCheckInterval == 0 {
+			if err := request.Err(); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	return total, nil
+}
+
+// getPageByPrefix reads a page of entries which have the prefix
+// when cursor is given, it seeks the cursor key directly instead of skipping entries by offset,
+// and Total is counted only when CountTotal of request is set
+func getPageByPrefix[T any, PT decodable[T]](db *badger.DB, prefix string, request *types.PageReq) (*types.Page[T], error) {
+	page := &types.Page[T]{
+		Items:  []T{},
+		Limit:  request.Limit,
+		Offset: request.Offset,
+	}
+
+	err := db.View(func(txn *badger.Txn) error {
+		if request.CountTotal {
+			total, err := countTotal(txn, prefix, request)
+			if err != nil {
+				return err
+			}
+			page.Total = &total
+		}
+
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchSize = 10
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		if request.Cursor != "" {
+			// cursor has the key of last item of previous page
+			position, key := decodeCursor(request)
+			page.Offset = position
+			it.Seek([]byte(prefix + key))
+			if it.ValidForPrefix([]byte(prefix)) && string(it.Item().Key()) == prefix+key {
+				it.Next()
+			}
+		} else {
+			it.Seek([]byte(prefix))
+			skipped := uint64(0)
+			for ; skipped < request.Offset && it.ValidForPrefix([]byte(prefix)); skipped++ {
+				if skipped%CancelCheckInterval == 0 {
+					if err := request.Err(); err != nil {
+						return err
+					}
+				}
+				it.Next()
+			}
+			page.Offset = skipped
+		}
+
+		lastKey := ""
+		for ; it.ValidForPrefix([]byte(prefix)); it.Next() {
+			if request.Limit != 0 && uint64(len(page.Items)) >= request.Limit {
+				// there are remaining entries
+				nextOffset := page.Offset + uint64(len(page.Items))
+				page.NextOffset = &nextOffset
+				page.NextCursor = encodeCursor(nextOffset, lastKey[len(prefix):])
+				break
+			}
+
+			if uint64(len(page.Items))%CancelCheckInterval == 0 {
+				if err := request.Err(); err != nil {
+					return err
+				}
+			}
+
+			item := it.Item()
+			val, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+
+			var data T
+			if err := PT(&data).Decode(val); err != nil {
+				return err
+			}
+
+			page.Items = append(page.Items, data)
+			lastKey = string(item.Key())
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+// getPageByPrefixWhere reads a page of entries which have the prefix followed by scanPrefix and are matched with match
+// entries are decoded to be matched, and cursor is made as getPageByPrefix, so that pages of the same filter can be followed by cursor
+// the scan stops after the page unless CountTotal of request is set (Total counts every matched entry in the range then)
+func getPageByPrefixWhere[T any, PT decodable[T]](db *badger.DB, prefix string, scanPrefix string, match func(*T) bool, request *types.PageReq) (*types.Page[T], error) {
+	if match == nil && scanPrefix == "" {
+		return getPageByPrefix[T, PT](db, prefix, request)
+	}
+
+	page := &types.Page[T]{
+		Items:  []T{},
+		Limit:  request.Limit,
+		Offset: request.Offset,
+	}
+
+	err := db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchSize = 10
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		rangePrefix := []byte(prefix + scanPrefix)
+		start := rangePrefix
+		cursorKey := ""
+		if request.Cursor != "" {
+			position, key := decodeCursor(request)
+			page.Offset = position
+			cursorKey = prefix + key
+			// entries before cursor are skipped by seeking unless they have to be counted
+			if !request.CountTotal && cursorKey > string(rangePrefix) {
+				start = []byte(cursorKey)
+			}
+		}
+
+		scanned := uint64(0)
+		matched := uint64(0)
+		lastKey := ""
+		for it.Seek(start); it.ValidForPrefix(rangePrefix); it.Next() {
+			scanned++
+			if scanned%CancelCheckInterval == 0 {
+				if err := request.Err(); err != nil {
+					return err
+				}
+			}
+
+			item := it.Item()
+			key := string(item.Key())
+			val, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+
+			var data T
+			if err := PT(&data).Decode(val); err != nil {
+				return err
+			}
+			if match != nil && !match(&data) {
+				continue
+			}
+
+			// entries before cursor (or offset) are counted but not returned
+			matched++
+			if cursorKey != "" && key <= cursorKey {
+				continue
+			}
+			if cursorKey == "" && matched <= request.Offset {
+				continue
+			}
+			if request.Limit != 0 && uint64(len(page.Items)) >= request.Limit {
+				if page.NextOffset == nil {
+					nextOffset := page.Offset + uint64(len(page.Items))
+					page.NextOffset = &nextOffset
+					page.NextCursor = encodeCursor(nextOffset, lastKey[len(prefix):])
+				}
+				if !request.CountTotal {
+					break
+				}
+				continue
+			}
+
+			page.Items = append(page.Items, data)
+			lastKey = key
+		}
+		if request.CountTotal {
+			page.Total = &matched
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+// countByPrefix counts entries which have the prefix followed by scanPrefix, whose keys (after prefix) are matched with matchKey
+// and whose values are matched with match (nil matches everything)
+// entries are counted with key-only iteration when match is nil, so that values are neither read nor decoded,
+// and matchKey is checked before value is read otherwise
+func countByPrefix[T any, PT decodable[T]](db *badger.DB, prefix string, scanPrefix string, matchKey func(key string) bool, match func(*T) bool, ctx context.Context) (uint64, error) {
+	count := uint64(0)
+
+	err := db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = match != nil
+		if match != nil {
+			opts.PrefetchSize = 10
+		}
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		rangePrefix := []byte(prefix + scanPrefix)
+		scanned := uint64(0)
+		for it.Seek(rangePrefix); it.ValidForPrefix(rangePrefix); it.Next() {
+			scanned++
+			if scanned%CancelCheckInterval == 0 && ctx != nil {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+			}
+
+			item := it.Item()
+			if matchKey != nil && !matchKey(string(item.Key()[len(prefix):])) {
+				continue
+			}
+			if match != nil {
+				val, err := item.ValueCopy(nil)
+				if err != nil {
+					return err
+				}
+
+				var data T
+				if err := PT(&data).Decode(val); err != nil {
+					return err
+				}
+				if !match(&data) {
+					continue
+				}
+			}
+
+			count++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
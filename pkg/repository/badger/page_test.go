@@ -0,0 +1,228 @@
+package badger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/quic-s/quics/pkg/types"
+)
+
+func TestGetPageByPrefix(t *testing.T) {
+	tests := []struct {
+		name       string
+		match      func(*types.FileHistory) bool // nil reads pages with getPageByPrefix
+		countTotal bool
+		wantPages  []string // after paths of items of each page
+		wantTotal  uint64
+	}{
+		{
+			name:       "all entries",
+			countTotal: true,
+			wantPages:  []string{"/r/a,/r/b", "/r/c,/r/d", "/r/e"},
+			wantTotal:  5,
+		},
+		{
+			name:      "all entries without total",
+			wantPages: []string{"/r/a,/r/b", "/r/c,/r/d", "/r/e"},
+		},
+		{
+			name:       "matched entries",
+			match:      func(history *types.FileHistory) bool { return history.AfterPath != "/r/b" },
+			countTotal: true,
+			wantPages:  []string{"/r/a,/r/c", "/r/d,/r/e"},
+			wantTotal:  4,
+		},
+		{
+			name:      "matched entries without total",
+			match:     func(history *types.FileHistory) bool { return history.AfterPath != "/r/b" },
+			wantPages: []string{"/r/a,/r/c", "/r/d,/r/e"},
+		},
+	}
+
+	db := openTestDB(t)
+	err := db.Update(func(txn *badger.Txn) error {
+		for _, afterPath := range []string{"/r/a", "/r/b", "/r/c", "/r/d", "/r/e"} {
+			history := &types.FileHistory{AfterPath: afterPath, Timestamp: 1}
+			if err := txn.Set([]byte(PrefixHistory+afterPath), history.Encode()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	getPage := func(match func(*types.FileHistory) bool, request *types.PageReq) (*types.Page[types.FileHistory], error) {
+		if match == nil {
+			return getPageByPrefix[types.FileHistory](db, PrefixHistory, request)
+		}
+		return getPageByPrefixWhere[types.FileHistory](db, PrefixHistory, "/r/", match, request)
+	}
+
+	for _, tt := range tests {
+		for _, byCursor := range []bool{true, false} {
+			name := tt.name + " by offset"
+			if byCursor {
+				name = tt.name + " by cursor"
+			}
+			t.Run(name, func(t *testing.T) {
+				request := &types.PageReq{Limit: 2, CountTotal: tt.countTotal, Context: context.Background()}
+				for i, want := range tt.wantPages {
+					page, err := getPage(tt.match, request)
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					afterPaths := []string{}
+					for _, history := range page.Items {
+						afterPaths = append(afterPaths, history.AfterPath)
+					}
+					if got := strings.Join(afterPaths, ","); got != want {
+						t.Fatalf("page %d = %s, want %s", i, got, want)
+					}
+					if page.Offset != uint64(i)*2 {
+						t.Errorf("offset of page %d = %d, want %d", i, page.Offset, i*2)
+					}
+					if tt.countTotal && (page.Total == nil || *page.Total != tt.wantTotal) {
+						t.Errorf("total of page %d = %v, want %d", i, page.Total, tt.wantTotal)
+					}
+					if !tt.countTotal && page.Total != nil {
+						t.Errorf("total of page %d = %d, want none", i, *page.Total)
+					}
+
+					if i == len(tt.wantPages)-1 {
+						if page.NextOffset != nil {
+							t.Errorf("last page has next offset %d", *page.NextOffset)
+						}
+						break
+					}
+					if page.NextOffset == nil || *page.NextOffset != page.Offset+uint64(len(page.Items)) {
+						t.Fatalf("next offset of page %d = %v, want %d", i, page.NextOffset, page.Offset+uint64(len(page.Items)))
+					}
+
+					request = &types.PageReq{Limit: 2, CountTotal: tt.countTotal, Context: context.Background()}
+					if byCursor {
+						request.Cursor = page.NextCursor
+					} else {
+						request.Offset = *page.NextOffset
+					}
+				}
+			})
+		}
+	}
+}
+
+// cancelAfterContext is canceled after Err is checked checks times, so that scan is canceled while it is running
+type cancelAfterContext struct {
+	context.Context
+	checks int
+}
+
+func (ctx *cancelAfterContext) Err() error {
+	ctx.checks--
+	if ctx.checks < 0 {
+		return context.Canceled
+	}
+	return nil
+}
+
+func TestGetPageByPrefixCanceled(t *testing.T) {
+	const entries = 5 * CancelCheckInterval
+
+	db := openTestDB(t)
+	err := db.Update(func(txn *badger.Txn) error {
+		for i := 0; i < entries; i++ {
+			history := &types.FileHistory{AfterPath: fmt.Sprintf("/r/%05d", i), Timestamp: 1}
+			if err := txn.Set([]byte(PrefixHistory+history.AfterPath), history.Encode()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scanned := 0
+	match := func(history *types.FileHistory) bool {
+		scanned++
+		return true
+	}
+
+	tests := []struct {
+		name string
+		scan func(request *types.PageReq) error
+	}{
+		{
+			name: "counting total",
+			scan: func(request *types.PageReq) error {
+				request.CountTotal = true
+				_, err := getPageByPrefix[types.FileHistory](db, PrefixHistory, request)
+				return err
+			},
+		},
+		{
+			name: "skipping offset",
+			scan: func(request *types.PageReq) error {
+				request.Offset = entries - 1
+				_, err := getPageByPrefix[types.FileHistory](db, PrefixHistory, request)
+				return err
+			},
+		},
+		{
+			name: "reading every entry",
+			scan: func(request *types.PageReq) error {
+				_, err := getPageByPrefix[types.FileHistory](db, PrefixHistory, request)
+				return err
+			},
+		},
+		{
+			name: "matching entries",
+			scan: func(request *types.PageReq) error {
+				_, err := getPageByPrefixWhere[types.FileHistory](db, PrefixHistory, "/r/", match, request)
+				return err
+			},
+		},
+		{
+			name: "counting matched entries",
+			scan: func(request *types.PageReq) error {
+				_, err := countByPrefix[types.FileHistory](db, PrefixHistory, "/r/", nil, match, request.Context)
+				return err
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// canceled mid scan
+			scanned = 0
+			ctx := &cancelAfterContext{Context: context.Background(), checks: 1}
+			err := tt.scan(&types.PageReq{Context: ctx})
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("scan canceled mid scan returned %v, want %v", err, context.Canceled)
+			}
+			if scanned >= entries {
+				t.Errorf("scan went on to the end (%d entries) after it was canceled", scanned)
+			}
+
+			// canceled before scan (e.g., client went away while request was queued)
+			canceled, cancel := context.WithCancel(context.Background())
+			cancel()
+			err = tt.scan(&types.PageReq{Context: canceled})
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("scan of canceled request returned %v, want %v", err, context.Canceled)
+			}
+
+			// not canceled
+			err = tt.scan(&types.PageReq{Context: context.Background()})
+			if err != nil {
+				t.Errorf("scan returned %v, want no error", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,359 @@
+package badger
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+)
+
+// WALScanChunkSize is the size of chunks which write-ahead log files are read backward in to find the end of written data
+// (they are preallocated, e.g., 128 MiB of memtable WAL, and the rest after written data is zero)
+const WALScanChunkSize = 1 << 20
+
+// RepairBackupPrefix is prefix of directory (next to database directory) which files moved by repair are kept in
+const RepairBackupPrefix = "badger-repair-"
+
+// walHeaderSize is the size of header of write-ahead log file (key id and base iv of encryption) which entries follow,
+// and walBitTxn and walBitFinTxn are bits of meta of entry which is part of transaction and which commits it
+const (
+	walHeaderSize = 20
+	walBitTxn     = 1 << 6
+	walBitFinTxn  = 1 << 7
+)
+
+// walFile is write-ahead log file left by last run (memtable WAL or the newest value log file), which is replayed on open
+// badger truncates tail of it which can not be replayed (e.g., transaction being written when process was killed) without
+// telling it, so the end of replayed entries is found before open and compared with the end of written data
+//
+// this duplicates replay of badger v3 (memTable.UpdateSkipList, which calls logFile.iterate reading entries with
+// safeRead.Entry and then truncates WAL at the returned offset): neither Options nor DB exposes the truncated offset,
+// and DB.VerifyChecksum and DB.Flatten work on tables only, so they can not tell what was discarded from WAL
+// the report is best-effort; database is opened by badger itself whatever is found here
+type walFile struct {
+	name      string
+	dataEnd   int64 // offset after the last byte written to it
+	replayEnd int64 // offset after the last committed entry
+}
+
+// discarded returns bytes written to tail of file which are not replayed
+func (wal *walFile) discarded() int64 {
+	if wal.dataEnd <= wal.replayEnd {
+		return 0
+	}
+	return wal.dataEnd - wal.replayEnd
+}
+
+// findWALFiles returns write-ahead log files which are replayed on open
+// clean shutdown flushes memtable and leaves no memtable WAL, so nothing is returned then
+func findWALFiles(dir string) ([]walFile, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	newestVlog := ""
+	for _, entry := range entries {
+		switch {
+		case !entry.Type().IsRegular():
+		case strings.HasSuffix(entry.Name(), ".mem"):
+			names = append(names, entry.Name())
+		// value log files are named by zero-padded id, so the newest one is the last by name
+		case strings.HasSuffix(entry.Name(), ".vlog") && entry.Name() > newestVlog:
+			newestVlog = entry.Name()
+		}
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+	if newestVlog != "" {
+		names = append(names, newestVlog)
+	}
+
+	walFiles := []walFile{}
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		dataEnd, err := findDataEnd(path)
+		if err != nil {
+			return nil, err
+		}
+		replayEnd, err := findReplayEnd(path)
+		if err != nil {
+			return nil, err
+		}
+		walFiles = append(walFiles, walFile{name: name, dataEnd: dataEnd, replayEnd: replayEnd})
+	}
+
+	return walFiles, nil
+}
+
+// findDataEnd returns offset after the last non-zero byte of file by reading it backward
+func findDataEnd(path string) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	buf := make([]byte, WALScanChunkSize)
+	for end := info.Size(); end > 0; {
+		start := end - WALScanChunkSize
+		if start < 0 {
+			start = 0
+		}
+
+		n, err := file.ReadAt(buf[:end-start], start)
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		if written := len(bytes.TrimRight(buf[:n], "\x00")); written != 0 {
+			return start + int64(written), nil
+		}
+		end = start
+	}
+
+	return 0, nil
+}
+
+// findReplayEnd returns offset after the last entry of write-ahead log file which badger replays on open:
+// entries are read as badger does (header, key, value and crc32 checksum) until one is broken, zero or incomplete,
+// and only entries out of transaction or transactions followed by their commit entry are replayed
+// (entries of database encrypted by badger can not be read, but database of quics is not encrypted)
+func findReplayEnd(path string) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(io.NewSectionReader(file, walHeaderSize, math.MaxInt64-walHeaderSize))
+	offset, replayEnd := int64(walHeaderSize), int64(walHeaderSize)
+	lastCommit := uint64(0)
+	for {
+		entry, ok := readWALEntry(reader)
+		if !ok || len(entry.key) == 0 {
+			return replayEnd, nil
+		}
+		offset += entry.size
+
+		switch {
+		case entry.meta&walBitTxn != 0:
+			commitTs := parseWALTs(entry.key)
+			if lastCommit == 0 {
+				lastCommit = commitTs
+			}
+			if lastCommit != commitTs {
+				return replayEnd, nil
+			}
+
+		case entry.meta&walBitFinTxn != 0:
+			commitTs, err := strconv.ParseUint(string(entry.value), 10, 64)
+			if err != nil || lastCommit != commitTs {
+				return replayEnd, nil
+			}
+			lastCommit = 0
+			replayEnd = offset
+
+		default:
+			if lastCommit != 0 {
+				return replayEnd, nil
+			}
+			replayEnd = offset
+		}
+	}
+}
+
+// walEntry is entry of write-ahead log file
+type walEntry struct {
+	meta  byte
+	key   []byte
+	value []byte
+	size  int64 // bytes of entry in file (header, key, value and checksum)
+}
+
+// walHashReader hashes bytes of entry as they are read, to be checked against checksum of entry
+type walHashReader struct {
+	reader *bufio.Reader
+	hash   hash.Hash32
+	read   int64
+}
+
+func (r *walHashReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.hash.Write(p[:n])
+	r.read += int64(n)
+	return n, err
+}
+
+func (r *walHashReader) ReadByte() (byte, error) {
+	b, err := r.reader.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	r.hash.Write([]byte{b})
+	r.read++
+	return b, nil
+}
+
+// readWALEntry reads an entry of write-ahead log file (ok is false when it is incomplete or its checksum does not match)
+func readWALEntry(reader *bufio.Reader) (*walEntry, bool) {
+	hashReader := &walHashReader{reader: reader, hash: crc32.New(crc32.MakeTable(crc32.Castagnoli))}
+
+	// header is meta, user meta, then uvarints of key length, value length and expiration
+	meta, err := hashReader.ReadByte()
+	if err != nil {
+		return nil, false
+	}
+	if _, err = hashReader.ReadByte(); err != nil {
+		return nil, false
+	}
+	lengths := [3]uint64{}
+	for i := range lengths {
+		lengths[i], err = binary.ReadUvarint(hashReader)
+		if err != nil {
+			return nil, false
+		}
+	}
+	// key is shorter than 64 KiB, so longer one is garbage (e.g., torn header)
+	if lengths[0] > 1<<16 || lengths[1] > math.MaxUint32 {
+		return nil, false
+	}
+
+	kv := make([]byte, lengths[0]+lengths[1])
+	if _, err = io.ReadFull(hashReader, kv); err != nil {
+		return nil, false
+	}
+	checksum := make([]byte, crc32.Size)
+	if _, err = io.ReadFull(reader, checksum); err != nil {
+		return nil, false
+	}
+	if binary.BigEndian.Uint32(checksum) != hashReader.hash.Sum32() {
+		return nil, false
+	}
+
+	return &walEntry{
+		meta:  meta,
+		key:   kv[:lengths[0]],
+		value: kv[lengths[0]:],
+		size:  hashReader.read + crc32.Size,
+	}, true
+}
+
+// parseWALTs returns commit timestamp which badger appends to key (inverted big endian of the last 8 bytes)
+func parseWALTs(key []byte) uint64 {
+	if len(key) <= 8 {
+		return 0
+	}
+	return math.MaxUint64 - binary.BigEndian.Uint64(key[len(key)-8:])
+}
+
+// logWALRecovery tells operator whether unclean shutdown of last run is recovered cleanly or with data lost
+func logWALRecovery(walFiles []walFile) {
+	if len(walFiles) == 0 {
+		return
+	}
+
+	names := []string{}
+	discarded := int64(0)
+	for _, wal := range walFiles {
+		if wal.discarded() != 0 {
+			names = append(names, wal.name+" ("+strconv.FormatInt(wal.discarded(), 10)+" bytes)")
+			discarded += wal.discarded()
+		}
+	}
+	if discarded == 0 {
+		log.Println("quics: ", fmt.Sprintf("database RECOVERED CLEANLY after unclean shutdown: replayed %d write-ahead log files, no data lost", len(walFiles)))
+		return
+	}
+
+	log.Println("quics alert: ", fmt.Sprintf("database recovered after unclean shutdown with DATA LOST: discarded %d bytes of incomplete writes at tail of %s; "+
+		"writes being made when server stopped are not stored, so clients may need to sync them again", discarded, strings.Join(names, ", ")))
+}
+
+// repairDB moves files of database which fails to open into backup directory next to it and opens database again (--repair-db)
+// memtable WALs (writes not flushed to tables yet) are moved first, then every file when database still fails to open,
+// so that server starts with what is left instead of refusing to start forever; moved files are kept to be inspected
+func repairDB(opts badger.Options, openErr error) (*badger.DB, error) {
+	log.Println("quics alert: ", "database fails to open, so best-effort repair is running: ", openErr)
+
+	backupDir := filepath.Join(filepath.Dir(opts.Dir), RepairBackupPrefix+strconv.FormatInt(time.Now().Unix(), 10))
+	err := os.MkdirAll(backupDir, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(opts.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	// unflushed writes are the most likely to be broken by crash, and the rest of database does not depend on them
+	moved, lostBytes := 0, int64(0)
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".mem") {
+			continue
+		}
+
+		dataEnd, err := findDataEnd(filepath.Join(opts.Dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		err = os.Rename(filepath.Join(opts.Dir, entry.Name()), filepath.Join(backupDir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		moved++
+		lostBytes += dataEnd
+	}
+	if moved != 0 {
+		db, err := badger.Open(opts)
+		if err == nil {
+			log.Println("quics alert: ", fmt.Sprintf("database REPAIRED with DATA LOST: %d memtable WAL files (%d bytes of writes not flushed to tables) are moved to %s; "+
+				"records changed shortly before crash are lost, so clients may need to sync them again", moved, lostBytes, backupDir))
+			return db, nil
+		}
+		log.Println("quics err: ", "database still fails to open without memtable WAL files: ", err)
+	}
+
+	// nothing but a new database is left to start with
+	entries, err = os.ReadDir(opts.Dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		err = os.Rename(filepath.Join(opts.Dir, entry.Name()), filepath.Join(backupDir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	db, err := badger.Open(opts)
+	if err != nil {
+		return nil, err
+	}
+	log.Println("quics alert: ", "database REPAIRED with ALL RECORDS LOST: every file of database is moved to "+backupDir+" and server starts with empty database; "+
+		"stored contents are left under sync directory, but clients, directories, files and histories must be registered and synced again")
+
+	return db, nil
+}
@@ -0,0 +1,118 @@
+package badger
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dgraph-io/badger/v3"
+)
+
+// copyWALFiles writes transactions to database and copies its write-ahead log files before it is closed (as crash leaves them)
+func copyWALFiles(t *testing.T, keys int) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	// small files, since WAL files are preallocated to their size
+	opts := badger.DefaultOptions(dir).WithSyncWrites(true).WithMemTableSize(1 << 20).WithValueLogFileSize(1 << 20).WithValueThreshold(1 << 10)
+	opts.Logger = nil
+	db, err := badger.Open(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for i := 0; i < keys; i++ {
+		err := db.Update(func(txn *badger.Txn) error {
+			return txn.Set([]byte("key_"+strings.Repeat("k", i)), []byte("value"))
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	crashed := t.TempDir()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".mem") && !strings.HasSuffix(entry.Name(), ".vlog") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(crashed, entry.Name()), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return crashed
+}
+
+func TestFindWALFiles(t *testing.T) {
+	tests := []struct {
+		name          string
+		keys          int
+		torn          []byte // bytes written after the last entry of memtable WAL (e.g., transaction being written)
+		wantDiscarded int64
+	}{
+		{name: "clean", keys: 3},
+		{name: "torn entry", keys: 3, torn: []byte{walBitTxn, 0, 4, 5, 0, 'k', 'e'}, wantDiscarded: 7},
+		{name: "nothing written", keys: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := copyWALFiles(t, tt.keys)
+
+			walFiles, err := findWALFiles(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.torn != nil {
+				for _, wal := range walFiles {
+					if !strings.HasSuffix(wal.name, ".mem") {
+						continue
+					}
+					file, err := os.OpenFile(filepath.Join(dir, wal.name), os.O_WRONLY, 0600)
+					if err != nil {
+						t.Fatal(err)
+					}
+					_, err = file.WriteAt(tt.torn, wal.dataEnd)
+					file.Close()
+					if err != nil {
+						t.Fatal(err)
+					}
+				}
+				if walFiles, err = findWALFiles(dir); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if tt.keys > 0 && len(walFiles) == 0 {
+				t.Fatal("no write-ahead log file is found")
+			}
+			discarded := int64(0)
+			for _, wal := range walFiles {
+				if wal.replayEnd < walHeaderSize {
+					t.Errorf("replay end of %s = %d, before header", wal.name, wal.replayEnd)
+				}
+				discarded += wal.discarded()
+			}
+			if discarded != tt.wantDiscarded {
+				t.Errorf("discarded = %d, want %d", discarded, tt.wantDiscarded)
+			}
+		})
+	}
+}
+
+func TestFindWALFilesMissingDir(t *testing.T) {
+	walFiles, err := findWALFiles(filepath.Join(t.TempDir(), "badger"))
+	if err != nil || walFiles != nil {
+		t.Fatalf("findWALFiles() = %v, %v, want nothing", walFiles, err)
+	}
+}
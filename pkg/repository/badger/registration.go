@@ -61,10 +61,11 @@ func (rr *RegistrationRepository) GetClientByUUID(uuid string) (*types.Client, e
 	return client, nil
 }
 
+// DeleteClient deletes client of uuid with changes pending for it
 func (rr *RegistrationRepository) DeleteClient(uuid string) error {
 	key := []byte(PrefixClient + uuid)
 
-	err := rr.db.DropPrefix(key)
+	err := rr.db.DropPrefix(key, []byte(PrefixPending+uuid))
 	if err != nil {
 		return err
 	}
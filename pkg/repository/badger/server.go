@@ -1,16 +1,34 @@
 package badger
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"log"
+	"strings"
+	"time"
 
 	"github.com/dgraph-io/badger/v3"
 	"github.com/quic-s/quics/pkg/types"
+	"github.com/quic-s/quics/pkg/utils"
 )
 
 const (
 	PrefixServerPassword = "password_"
+	PrefixBulkOperation  = "bulk_operation_"
+	PrefixRuntimeState   = "runtime_state_"
+	PrefixSigningKey     = "signing_key_"
+	PrefixDBMaintenance  = "db_maintenance_"
 )
 
+// BulkUpdateBatchSize is the number of files updated in one transaction by UpdateFiles
+const BulkUpdateBatchSize = 1000
+
+// ErrMoveTooLarge is returned when records under root directory do not fit in one transaction,
+// in which case nothing is moved, because the move is never split into several transactions
+var ErrMoveTooLarge = errors.New("MOVE_TOO_LARGE")
+
 type ServerRepository struct {
 	db *badger.DB
 }
@@ -53,6 +71,189 @@ func (sr *ServerRepository) DeletePassword() error {
 	return nil
 }
 
+// SetBulkOperation records bulk operation of operation.ID before it starts
+func (sr *ServerRepository) SetBulkOperation(operation *types.BulkOperation) error {
+	key := []byte(PrefixBulkOperation + operation.ID)
+
+	err := sr.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(key, operation.Encode())
+	})
+	if err != nil {
+		log.Println("quics err: ", err)
+		return err
+	}
+
+	return nil
+}
+
+// GetBulkOperations returns bulk operations which are not finished in order of their IDs (the order they were started)
+func (sr *ServerRepository) GetBulkOperations() ([]*types.BulkOperation, error) {
+	operations := []*types.BulkOperation{}
+
+	err := sr.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		prefix := []byte(PrefixBulkOperation)
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			val, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+
+			operation := &types.BulkOperation{}
+			if err := operation.Decode(val); err != nil {
+				return err
+			}
+			operations = append(operations, operation)
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	return operations, nil
+}
+
+// DeleteBulkOperation clears record of bulk operation of id after it is finished
+func (sr *ServerRepository) DeleteBulkOperation(id string) error {
+	key := []byte(PrefixBulkOperation + id)
+
+	err := sr.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(key)
+	})
+	if err != nil {
+		log.Println("quics err: ", err)
+		return err
+	}
+
+	return nil
+}
+
+// SetRuntimeState saves runtime state on shutdown
+func (sr *ServerRepository) SetRuntimeState(state *types.RuntimeState) error {
+	key := []byte(PrefixRuntimeState)
+
+	err := sr.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(key, state.Encode())
+	})
+	if err != nil {
+		log.Println("quics err: ", err)
+		return err
+	}
+
+	return nil
+}
+
+// GetRuntimeState returns runtime state saved on last shutdown (nil if there is none, e.g., after crash)
+func (sr *ServerRepository) GetRuntimeState() (*types.RuntimeState, error) {
+	key := []byte(PrefixRuntimeState)
+	state := &types.RuntimeState{}
+
+	err := sr.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(key)
+		if err != nil {
+			return err
+		}
+
+		val, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+
+		return state.Decode(val)
+	})
+	if err == badger.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	return state, nil
+}
+
+// GetOrSetSigningKey returns signing key of signed urls, saving key when there is none yet
+func (sr *ServerRepository) GetOrSetSigningKey(key []byte) ([]byte, error) {
+	var signingKey []byte
+
+	err := sr.db.Update(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(PrefixSigningKey))
+		if err == badger.ErrKeyNotFound {
+			signingKey = key
+			return txn.Set([]byte(PrefixSigningKey), key)
+		}
+		if err != nil {
+			return err
+		}
+
+		signingKey, err = item.ValueCopy(nil)
+		return err
+	})
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	return signingKey, nil
+}
+
+// GetSigningKey returns signing key of signed urls (nil if there is none yet)
+func (sr *ServerRepository) GetSigningKey() ([]byte, error) {
+	var signingKey []byte
+
+	err := sr.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(PrefixSigningKey))
+		if err != nil {
+			return err
+		}
+
+		signingKey, err = item.ValueCopy(nil)
+		return err
+	})
+	if err == badger.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	return signingKey, nil
+}
+
+// SetSigningKey replaces signing key of signed urls, so that every url signed by previous key is revoked
+func (sr *ServerRepository) SetSigningKey(key []byte) error {
+	err := sr.db.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte(PrefixSigningKey), key)
+	})
+	if err != nil {
+		log.Println("quics err: ", err)
+		return err
+	}
+
+	return nil
+}
+
+// DeleteRuntimeState clears runtime state after it is restored
+func (sr *ServerRepository) DeleteRuntimeState() error {
+	key := []byte(PrefixRuntimeState)
+
+	err := sr.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(key)
+	})
+	if err != nil {
+		log.Println("quics err: ", err)
+		return err
+	}
+
+	return nil
+}
+
 func (sr *ServerRepository) GetPassword() (*types.Server, error) {
 	key := []byte(PrefixServerPassword)
 	server := &types.Server{}
@@ -153,6 +354,41 @@ func (sr *ServerRepository) GetAllRootDirectories() ([]types.RootDirectory, erro
 	return rootDirs, nil
 }
 
+// WalkPaths calls visit with afterPath of every root directory (dirs) and file (files) in key order
+// only keys are read, so it is much cheaper than getting whole records
+func (sr *ServerRepository) WalkPaths(files bool, dirs bool, visit func(afterPath string) error) error {
+	prefixes := []string{}
+	if dirs {
+		prefixes = append(prefixes, PrefixRootDir)
+	}
+	if files {
+		prefixes = append(prefixes, PrefixFile)
+	}
+
+	err := sr.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for _, prefix := range prefixes {
+			for it.Seek([]byte(prefix)); it.ValidForPrefix([]byte(prefix)); it.Next() {
+				if err := visit(strings.TrimPrefix(string(it.Item().Key()), prefix)); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Println("quics err: ", err)
+		return err
+	}
+
+	return nil
+}
+
 func (sr *ServerRepository) GetAllFiles() ([]types.File, error) {
 	files := []types.File{}
 
@@ -221,6 +457,70 @@ func (sr *ServerRepository) GetClientByUUID(uuid string) (*types.Client, error)
 	return client, nil
 }
 
+func (sr *ServerRepository) UpdateClient(client *types.Client) error {
+	key := []byte(PrefixClient + client.UUID)
+
+	err := sr.db.Update(func(txn *badger.Txn) error {
+		if err := txn.Set(key, client.Encode()); err != nil {
+			log.Println("quics err: ", err)
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Println("quics err: ", err)
+		return err
+	}
+
+	return nil
+}
+
+// ProvisionClients saves clients and root directories associated with them in a single transaction
+func (sr *ServerRepository) ProvisionClients(clients []*types.Client, rootDirs []*types.RootDirectory) error {
+	err := sr.db.Update(func(txn *badger.Txn) error {
+		for _, client := range clients {
+			if err := txn.Set([]byte(PrefixClient+client.UUID), client.Encode()); err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+		}
+		for _, rootDir := range rootDirs {
+			if err := txn.Set([]byte(PrefixRootDir+rootDir.AfterPath), rootDir.Encode()); err != nil {
+				log.Println("quics err: ", err)
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Println("quics err: ", err)
+		return err
+	}
+
+	return nil
+}
+
+func (sr *ServerRepository) UpdateRootDirectory(rootDir *types.RootDirectory) error {
+	key := []byte(PrefixRootDir + rootDir.AfterPath)
+
+	err := sr.db.Update(func(txn *badger.Txn) error {
+		if err := txn.Set(key, rootDir.Encode()); err != nil {
+			log.Println("quics err: ", err)
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Println("quics err: ", err)
+		return err
+	}
+
+	return nil
+}
+
 func (sr *ServerRepository) GetRootDirectoryByPath(afterPath string) (*types.RootDirectory, error) {
 	key := []byte(PrefixRootDir + afterPath)
 	rootDir := &types.RootDirectory{}
@@ -285,25 +585,15 @@ func (sr *ServerRepository) GetFileByAfterPath(afterPath string) (*types.File, e
 	return file, nil
 }
 
+// DeleteAllClients deletes every client with changes pending for it
 func (sr *ServerRepository) DeleteAllClients() error {
-	key := []byte(PrefixClient)
-
-	err := sr.db.Update(func(txn *badger.Txn) error {
-		opts := badger.DefaultIteratorOptions
-		opts.PrefetchSize = 10
-		it := txn.NewIterator(opts)
-		defer it.Close()
-
-		for it.Seek(key); it.ValidForPrefix(key); it.Next() {
-			item := it.Item()
-			if err := txn.Delete(item.Key()); err != nil {
-				log.Println("quics err: ", err)
-				return err
-			}
-		}
+	_, err := deleteByPrefix(sr.db, PrefixClient, nil)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return err
+	}
 
-		return nil
-	})
+	_, err = deleteByPrefix(sr.db, PrefixPending, nil)
 	if err != nil {
 		log.Println("quics err: ", err)
 		return err
@@ -313,24 +603,7 @@ func (sr *ServerRepository) DeleteAllClients() error {
 }
 
 func (sr *ServerRepository) DeleteAllRootDirectories() error {
-	key := []byte(PrefixRootDir)
-
-	err := sr.db.Update(func(txn *badger.Txn) error {
-		opts := badger.DefaultIteratorOptions
-		opts.PrefetchSize = 10
-		it := txn.NewIterator(opts)
-		defer it.Close()
-
-		for it.Seek(key); it.ValidForPrefix(key); it.Next() {
-			item := it.Item()
-			if err := txn.Delete(item.Key()); err != nil {
-				log.Println("quics err: ", err)
-				return err
-			}
-		}
-
-		return nil
-	})
+	_, err := deleteByPrefix(sr.db, PrefixRootDir, nil)
 	if err != nil {
 		log.Println("quics err: ", err)
 		return err
@@ -340,24 +613,7 @@ func (sr *ServerRepository) DeleteAllRootDirectories() error {
 }
 
 func (sr *ServerRepository) DeleteAllFiles() error {
-	key := []byte(PrefixFile)
-
-	err := sr.db.Update(func(txn *badger.Txn) error {
-		opts := badger.DefaultIteratorOptions
-		opts.PrefetchSize = 10
-		it := txn.NewIterator(opts)
-		defer it.Close()
-
-		for it.Seek(key); it.ValidForPrefix(key); it.Next() {
-			item := it.Item()
-			if err := txn.Delete(item.Key()); err != nil {
-				log.Println("quics err: ", err)
-				return err
-			}
-		}
-
-		return nil
-	})
+	_, err := deleteByPrefix(sr.db, PrefixFile, nil)
 	if err != nil {
 		log.Println("quics err: ", err)
 		return err
@@ -366,6 +622,7 @@ func (sr *ServerRepository) DeleteAllFiles() error {
 	return nil
 }
 
+// DeleteClientByUUID deletes client of uuid with changes pending for it
 func (sr *ServerRepository) DeleteClientByUUID(uuid string) error {
 	key := []byte(PrefixClient + uuid)
 
@@ -375,7 +632,7 @@ func (sr *ServerRepository) DeleteClientByUUID(uuid string) error {
 			return err
 		}
 
-		return nil
+		return txn.Delete([]byte(PrefixPending + uuid))
 	})
 	if err != nil {
 		log.Println("quics err: ", err)
@@ -423,10 +680,330 @@ func (sr *ServerRepository) DeleteFileByAfterPath(afterPath string) error {
 	return nil
 }
 
-func (sr *ServerRepository) GetAllHistories() ([]types.FileHistory, error) {
-	histories := []types.FileHistory{}
-
-	err := sr.db.View(func(txn *badger.Txn) error {
+// DeleteFiles deletes the file of afterPath exactly, or every file under afterPath directory when recursive is true
+// (empty afterPath with recursive means all files)
+// it returns the number of files deleted, or to be deleted when dryRun is true
+func (sr *ServerRepository) DeleteFiles(afterPath string, recursive bool, dryRun bool) (uint64, error) {
+	count := uint64(0)
+
+	txnFunc := func(txn *badger.Txn) error {
+		if !recursive {
+			key := []byte(PrefixFile + afterPath)
+			_, err := txn.Get(key)
+			if err == badger.ErrKeyNotFound {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			count++
+			if dryRun {
+				return nil
+			}
+			return txn.Delete(key)
+		}
+
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		prefix := []byte(PrefixFile + afterPath)
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			// prefix must be matched by path components (e.g., /root/a must not match /root/ab)
+			if isFileUnder(afterPath, it.Item().Key()) {
+				count++
+			}
+		}
+
+		return nil
+	}
+
+	var err error
+	switch {
+	case dryRun:
+		err = sr.db.View(txnFunc)
+	case recursive:
+		// many files can be too big for one transaction, so they are deleted in batches
+		count, err = deleteByPrefix(sr.db, PrefixFile+afterPath, func(key []byte) bool {
+			return isFileUnder(afterPath, key)
+		})
+	default:
+		err = sr.db.Update(txnFunc)
+	}
+	if err != nil {
+		log.Println("quics err: ", err)
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// UpdateFiles applies update to every file under afterPathPrefix accepted by match (nil match accepts all),
+// BulkUpdateBatchSize files per transaction; update returns whether it changed file, and only changed files are written
+// each file is read again in the transaction which writes it, so that a write made after matching is not overwritten
+// nothing is written when dryRun is set, and files which update fails for are reported instead of aborting the others
+func (sr *ServerRepository) UpdateFiles(afterPathPrefix string, match func(*types.File) bool, update func(*types.File) (bool, error), dryRun bool) (*types.BulkUpdateRes, error) {
+	bulkRes := &types.BulkUpdateRes{
+		Failures: []types.BulkFailure{},
+		DryRun:   dryRun,
+	}
+
+	keys := [][]byte{}
+	err := sr.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		prefix := []byte(PrefixFile + afterPathPrefix)
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			// prefix must be matched by path components (e.g., /root/a must not match /root/ab)
+			if isFileUnder(afterPathPrefix, it.Item().Key()) {
+				keys = append(keys, it.Item().KeyCopy(nil))
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	for start := 0; start < len(keys); start += BulkUpdateBatchSize {
+		end := start + BulkUpdateBatchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		batchRes := &types.BulkUpdateRes{}
+		txnFunc := func(txn *badger.Txn) error {
+			for _, key := range keys[start:end] {
+				item, err := txn.Get(key)
+				if err == badger.ErrKeyNotFound {
+					// removed after matching
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				val, err := item.ValueCopy(nil)
+				if err != nil {
+					return err
+				}
+				file := &types.File{}
+				if err := file.Decode(val); err != nil {
+					return err
+				}
+				if match != nil && !match(file) {
+					continue
+				}
+
+				batchRes.Matched++
+				changed, err := update(file)
+				if err != nil {
+					batchRes.Failed++
+					batchRes.Failures = append(batchRes.Failures, types.BulkFailure{AfterPath: file.AfterPath, Error: err.Error()})
+					continue
+				}
+				if !changed {
+					continue
+				}
+
+				batchRes.Updated++
+				if dryRun {
+					continue
+				}
+				if err := txn.Set(key, file.Encode()); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		}
+
+		if dryRun {
+			err = sr.db.View(txnFunc)
+		} else {
+			err = sr.db.Update(txnFunc)
+		}
+		if err != nil {
+			log.Println("quics err: ", err)
+			return nil, err
+		}
+
+		bulkRes.Matched += batchRes.Matched
+		bulkRes.Updated += batchRes.Updated
+		bulkRes.Failed += batchRes.Failed
+		for _, failure := range batchRes.Failures {
+			if len(bulkRes.Failures) < types.MaxBulkFailures {
+				bulkRes.Failures = append(bulkRes.Failures, failure)
+			}
+		}
+	}
+
+	return bulkRes, nil
+}
+
+// GetFilesByPattern gets files whose afterPath matches glob pattern
+// only keys with the static prefix of pattern are scanned
+func (sr *ServerRepository) GetFilesByPattern(pattern string) ([]types.File, error) {
+	files := []types.File{}
+	prefix := []byte(PrefixFile + utils.GlobStaticPrefix(pattern))
+
+	err := sr.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			item := it.Item()
+			if !utils.MatchGlobPattern(pattern, strings.TrimPrefix(string(item.Key()), PrefixFile)) {
+				continue
+			}
+
+			val, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+
+			file := types.File{}
+			if err := file.Decode(val); err != nil {
+				return err
+			}
+
+			files = append(files, file)
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	return files, nil
+}
+
+// GetFilesByTags gets files having every tag of tags
+func (sr *ServerRepository) GetFilesByTags(tags map[string]string) ([]types.File, error) {
+	files := []types.File{}
+	prefix := []byte(PrefixFile)
+
+	err := sr.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchSize = 10
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			val, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+
+			file := types.File{}
+			if err := file.Decode(val); err != nil {
+				return err
+			}
+
+			if utils.MatchTags(file.Tags, tags) {
+				files = append(files, file)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	return files, nil
+}
+
+// GetHistoriesByCommit returns histories committed with commit set of id
+func (sr *ServerRepository) GetHistoriesByCommit(id string) ([]types.FileHistory, error) {
+	histories := []types.FileHistory{}
+	prefix := []byte(PrefixHistory)
+
+	err := sr.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchSize = 10
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			val, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+
+			history := types.FileHistory{}
+			if err := history.Decode(val); err != nil {
+				return err
+			}
+
+			if history.CommitID == id {
+				histories = append(histories, history)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	return histories, nil
+}
+
+// GetHistoriesByPattern gets histories of files whose afterPath matches glob pattern
+func (sr *ServerRepository) GetHistoriesByPattern(pattern string) ([]types.FileHistory, error) {
+	histories := []types.FileHistory{}
+	prefix := []byte(PrefixHistory + utils.GlobStaticPrefix(pattern))
+
+	err := sr.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchSize = 10
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			val, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+
+			// key has timestamp after afterPath, so decoded afterPath is matched
+			history := types.FileHistory{}
+			if err := history.Decode(val); err != nil {
+				return err
+			}
+
+			if utils.MatchGlobPattern(pattern, history.AfterPath) {
+				histories = append(histories, history)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	return histories, nil
+}
+
+func (sr *ServerRepository) GetAllHistories() ([]types.FileHistory, error) {
+	histories := []types.FileHistory{}
+
+	err := sr.db.View(func(txn *badger.Txn) error {
 		opts := badger.DefaultIteratorOptions
 		opts.PrefetchSize = 10
 		it := txn.NewIterator(opts)
@@ -490,3 +1067,499 @@ func (sr *ServerRepository) GetHistoryByAfterPath(afterPath string) (*types.File
 
 	return history, nil
 }
+
+// MoveRootDirectory rewrites afterPath prefix of root directory, files, histories and conflicts in one transaction,
+// together with paths under it which clients (root directories and subscriptions), pending changes, shared links and commit sets refer to
+// ErrMoveTooLarge is returned when they do not fit in it
+func (sr *ServerRepository) MoveRootDirectory(fromAfterPath string, toAfterPath string) error {
+	err := sr.db.Update(func(txn *badger.Txn) error {
+		// move root directory itself
+		item, err := txn.Get([]byte(PrefixRootDir + fromAfterPath))
+		if err != nil {
+			log.Println("quics err: ", err)
+			return err
+		}
+		val, err := item.ValueCopy(nil)
+		if err != nil {
+			log.Println("quics err: ", err)
+			return err
+		}
+		rootDir := &types.RootDirectory{}
+		if err := rootDir.Decode(val); err != nil {
+			log.Println("quics err: ", err)
+			return err
+		}
+		oldRootDir := *rootDir
+		rootDir.AfterPath = toAfterPath
+		if err := txn.Delete([]byte(PrefixRootDir + fromAfterPath)); err != nil {
+			log.Println("quics err: ", err)
+			return err
+		}
+		if err := txn.Set([]byte(PrefixRootDir+toAfterPath), rootDir.Encode()); err != nil {
+			log.Println("quics err: ", err)
+			return err
+		}
+
+		// move files, histories and conflicts under the root directory
+		err = moveByPrefix(txn, PrefixFile, fromAfterPath, toAfterPath, func(val []byte) ([]byte, error) {
+			file := &types.File{}
+			if err := file.Decode(val); err != nil {
+				return nil, err
+			}
+			file.AfterPath = toAfterPath + strings.TrimPrefix(file.AfterPath, fromAfterPath)
+			file.RootDirKey = toAfterPath
+			if file.Conflict.AfterPath != "" {
+				file.Conflict.AfterPath = file.AfterPath
+				for uuid, stagingFile := range file.Conflict.StagingFiles {
+					stagingFile.AfterPath = file.AfterPath
+					file.Conflict.StagingFiles[uuid] = stagingFile
+				}
+			}
+			return file.Encode(), nil
+		})
+		if err != nil {
+			log.Println("quics err: ", err)
+			return err
+		}
+
+		err = moveByPrefix(txn, PrefixHistory, fromAfterPath, toAfterPath, func(val []byte) ([]byte, error) {
+			history := &types.FileHistory{}
+			if err := history.Decode(val); err != nil {
+				return nil, err
+			}
+			history.AfterPath = toAfterPath + strings.TrimPrefix(history.AfterPath, fromAfterPath)
+			return history.Encode(), nil
+		})
+		if err != nil {
+			log.Println("quics err: ", err)
+			return err
+		}
+
+		err = moveByPrefix(txn, PrefixConflict, fromAfterPath, toAfterPath, func(val []byte) ([]byte, error) {
+			conflict := &types.Conflict{}
+			if err := conflict.Decode(val); err != nil {
+				return nil, err
+			}
+			conflict.AfterPath = toAfterPath + strings.TrimPrefix(conflict.AfterPath, fromAfterPath)
+			for uuid, stagingFile := range conflict.StagingFiles {
+				stagingFile.AfterPath = conflict.AfterPath
+				conflict.StagingFiles[uuid] = stagingFile
+			}
+			return conflict.Encode(), nil
+		})
+		if err != nil {
+			log.Println("quics err: ", err)
+			return err
+		}
+
+		// paths under the root directory which other records refer to are moved as well
+		movePath := func(afterPath string) (string, bool) {
+			if afterPath != fromAfterPath && !strings.HasPrefix(afterPath, fromAfterPath+"/") {
+				return afterPath, false
+			}
+			return toAfterPath + strings.TrimPrefix(afterPath, fromAfterPath), true
+		}
+
+		// update root directory list and subscriptions of clients
+		err = updateByPrefix(txn, PrefixClient, func(val []byte) ([]byte, error) {
+			client := &types.Client{}
+			if err := client.Decode(val); err != nil {
+				return nil, err
+			}
+
+			updated := false
+			for i, root := range client.Root {
+				if root.AfterPath == oldRootDir.AfterPath {
+					client.Root[i].AfterPath = toAfterPath
+					updated = true
+				}
+			}
+			for i, subscription := range client.Subscriptions {
+				if moved, ok := movePath(subscription); ok {
+					client.Subscriptions[i] = moved
+					updated = true
+				}
+			}
+			if !updated {
+				return nil, nil
+			}
+			return client.Encode(), nil
+		})
+		if err != nil {
+			log.Println("quics err: ", err)
+			return err
+		}
+
+		// changes queued for offline clients are delivered by new paths
+		err = updateByPrefix(txn, PrefixPending, func(val []byte) ([]byte, error) {
+			pendingChanges := &types.PendingChanges{}
+			if err := pendingChanges.Decode(val); err != nil {
+				return nil, err
+			}
+
+			updated := false
+			for i, afterPath := range pendingChanges.AfterPaths {
+				if moved, ok := movePath(afterPath); ok {
+					pendingChanges.AfterPaths[i] = moved
+					updated = true
+				}
+			}
+			if !updated {
+				return nil, nil
+			}
+			return pendingChanges.Encode(), nil
+		})
+		if err != nil {
+			log.Println("quics err: ", err)
+			return err
+		}
+
+		// shared links keep pointing at moved files
+		err = updateByPrefix(txn, PrefixSharing, func(val []byte) ([]byte, error) {
+			sharing := &types.Sharing{}
+			if err := sharing.Decode(val); err != nil {
+				return nil, err
+			}
+
+			moved, ok := movePath(sharing.File.AfterPath)
+			if !ok {
+				return nil, nil
+			}
+			sharing.File.AfterPath = moved
+			sharing.File.RootDirKey = toAfterPath
+			return sharing.Encode(), nil
+		})
+		if err != nil {
+			log.Println("quics err: ", err)
+			return err
+		}
+
+		// staged contents of commit set are kept by index of member, so only paths of members are moved
+		err = updateByPrefix(txn, PrefixCommit, func(val []byte) ([]byte, error) {
+			commitSet := &types.CommitSet{}
+			if err := commitSet.Decode(val); err != nil {
+				return nil, err
+			}
+
+			updated := false
+			for i, member := range commitSet.Members {
+				if moved, ok := movePath(member.AfterPath); ok {
+					commitSet.Members[i].AfterPath = moved
+					updated = true
+				}
+			}
+			if !updated {
+				return nil, nil
+			}
+			return commitSet.Encode(), nil
+		})
+		if err != nil {
+			log.Println("quics err: ", err)
+			return err
+		}
+
+		return nil
+	})
+	if errors.Is(err, badger.ErrTxnTooBig) {
+		err = fmt.Errorf("%w: %s has too many files and histories to move in one transaction", ErrMoveTooLarge, fromAfterPath)
+	}
+	if err != nil {
+		log.Println("quics err: ", err)
+		return err
+	}
+
+	return nil
+}
+
+// moveByPrefix re-keys all entries of {prefix}{fromAfterPath}/* to {prefix}{toAfterPath}/* with updated value
+// updateByPrefix replaces value of every record of prefix with the one returned by update (nil: record is left as it is)
+func updateByPrefix(txn *badger.Txn, prefix string, update func(val []byte) ([]byte, error)) error {
+	// collect records first, because it is not allowed to modify keys while iterating same prefix
+	keys := [][]byte{}
+	vals := [][]byte{}
+
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchSize = 10
+	it := txn.NewIterator(opts)
+	for it.Seek([]byte(prefix)); it.ValidForPrefix([]byte(prefix)); it.Next() {
+		item := it.Item()
+		val, err := item.ValueCopy(nil)
+		if err != nil {
+			it.Close()
+			return err
+		}
+
+		keys = append(keys, item.KeyCopy(nil))
+		vals = append(vals, val)
+	}
+	it.Close()
+
+	for i, key := range keys {
+		newVal, err := update(vals[i])
+		if err != nil {
+			return err
+		}
+		if newVal == nil {
+			continue
+		}
+
+		if err := txn.Set(key, newVal); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func moveByPrefix(txn *badger.Txn, prefix string, fromAfterPath string, toAfterPath string, update func(val []byte) ([]byte, error)) error {
+	fromPrefix := []byte(prefix + fromAfterPath + "/")
+
+	// collect keys first, because it is not allowed to modify keys while iterating same prefix
+	keys := [][]byte{}
+	vals := [][]byte{}
+
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchSize = 10
+	it := txn.NewIterator(opts)
+	for it.Seek(fromPrefix); it.ValidForPrefix(fromPrefix); it.Next() {
+		item := it.Item()
+		val, err := item.ValueCopy(nil)
+		if err != nil {
+			it.Close()
+			return err
+		}
+
+		keys = append(keys, item.KeyCopy(nil))
+		vals = append(vals, val)
+	}
+	it.Close()
+
+	for i, key := range keys {
+		newVal, err := update(vals[i])
+		if err != nil {
+			return err
+		}
+
+		newKey := []byte(prefix + toAfterPath + strings.TrimPrefix(string(key), prefix+fromAfterPath))
+		if err := txn.Delete(key); err != nil {
+			return err
+		}
+		if err := txn.Set(newKey, newVal); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetClientsPage reads a page of clients matched with match (every client when it is nil)
+func (sr *ServerRepository) GetClientsPage(match func(*types.Client) bool, request *types.PageReq) (*types.Page[types.Client], error) {
+	page, err := getPageByPrefixWhere[types.Client](sr.db, PrefixClient, "", match, request)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	return page, nil
+}
+
+// GetRootDirectoriesPage reads a page of root directories whose keys start with afterPathPrefix and are matched with match
+func (sr *ServerRepository) GetRootDirectoriesPage(afterPathPrefix string, match func(*types.RootDirectory) bool, request *types.PageReq) (*types.Page[types.RootDirectory], error) {
+	page, err := getPageByPrefixWhere[types.RootDirectory](sr.db, PrefixRootDir, afterPathPrefix, match, request)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	return page, nil
+}
+
+// GetFilesPage reads a page of files whose keys start with afterPathPrefix and are matched with match
+func (sr *ServerRepository) GetFilesPage(afterPathPrefix string, match func(*types.File) bool, request *types.PageReq) (*types.Page[types.File], error) {
+	page, err := getPageByPrefixWhere[types.File](sr.db, PrefixFile, afterPathPrefix, match, request)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	return page, nil
+}
+
+// GetHistoriesPage reads a page of histories whose keys start with afterPathPrefix and are matched with match
+func (sr *ServerRepository) GetHistoriesPage(afterPathPrefix string, match func(*types.FileHistory) bool, request *types.PageReq) (*types.Page[types.FileHistory], error) {
+	page, err := getPageByPrefixWhere[types.FileHistory](sr.db, PrefixHistory, afterPathPrefix, match, request)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	return page, nil
+}
+
+// CountClients counts clients matched with match (every client by keys alone when it is nil)
+func (sr *ServerRepository) CountClients(match func(*types.Client) bool, ctx context.Context) (uint64, error) {
+	count, err := countByPrefix[types.Client](sr.db, PrefixClient, "", nil, match, ctx)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// CountRootDirectories counts root directories whose keys start with afterPathPrefix, whose after paths are matched with matchPath
+// and which are matched with match (root directories are counted by keys alone when it is nil)
+func (sr *ServerRepository) CountRootDirectories(afterPathPrefix string, matchPath func(afterPath string) bool, match func(*types.RootDirectory) bool, ctx context.Context) (uint64, error) {
+	count, err := countByPrefix[types.RootDirectory](sr.db, PrefixRootDir, afterPathPrefix, matchPath, match, ctx)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// CountFiles counts files whose keys start with afterPathPrefix, whose after paths are matched with matchPath
+// and which are matched with match (files are counted by keys alone when it is nil)
+func (sr *ServerRepository) CountFiles(afterPathPrefix string, matchPath func(afterPath string) bool, match func(*types.File) bool, ctx context.Context) (uint64, error) {
+	count, err := countByPrefix[types.File](sr.db, PrefixFile, afterPathPrefix, matchPath, match, ctx)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// CountHistories counts histories whose keys start with afterPathPrefix, whose after paths are matched with matchPath
+// and which are matched with match (histories are counted by keys alone when it is nil)
+func (sr *ServerRepository) CountHistories(afterPathPrefix string, matchPath func(afterPath string) bool, match func(*types.FileHistory) bool, ctx context.Context) (uint64, error) {
+	var matchKey func(key string) bool
+	if matchPath != nil {
+		// key of history is {afterPath}_{timestamp}
+		matchKey = func(key string) bool {
+			if i := strings.LastIndex(key, "_"); i >= 0 {
+				key = key[:i]
+			}
+			return matchPath(key)
+		}
+	}
+
+	count, err := countByPrefix[types.FileHistory](sr.db, PrefixHistory, afterPathPrefix, matchKey, match, ctx)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// GetTransfers returns transfers completed in [since, until) in order of completion
+func (sr *ServerRepository) GetTransfers(since time.Time, until time.Time) ([]types.Transfer, error) {
+	transfers := []types.Transfer{}
+	prefix := []byte(PrefixTransfer)
+	end := transferKey(&types.Transfer{Date: until})
+
+	err := sr.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchSize = 100
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Seek(transferKey(&types.Transfer{Date: since})); it.ValidForPrefix(prefix) && bytes.Compare(it.Item().Key(), end) < 0; it.Next() {
+			val, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+
+			transfer := types.Transfer{}
+			if err := transfer.Decode(val); err != nil {
+				return err
+			}
+			transfers = append(transfers, transfer)
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Println("quics err: ", err)
+		return nil, err
+	}
+
+	return transfers, nil
+}
+
+// DeleteTransfersBefore deletes transfers completed before the time and returns the number of deleted ones
+func (sr *ServerRepository) DeleteTransfersBefore(before time.Time) (uint64, error) {
+	end := transferKey(&types.Transfer{Date: before})
+	deleted, err := deleteByPrefix(sr.db, PrefixTransfer, func(key []byte) bool {
+		return bytes.Compare(key, end) < 0
+	})
+	if err != nil {
+		log.Println("quics err: ", err)
+		return 0, err
+	}
+
+	return deleted, nil
+}
+
+// isFileUnder checks whether key of file is afterPath or under afterPath directory (empty afterPath means all files)
+func isFileUnder(afterPath string, key []byte) bool {
+	return afterPath == "" || utils.IsUnderPath(afterPath, strings.TrimPrefix(string(key), PrefixFile))
+}
+
+// deleteByPrefix deletes every key with prefix accepted by match (nil match accepts all) and returns the number of deleted keys
+// keys are deleted in batches instead of one transaction, so a crash can leave them partially deleted
+// (callers record types.BulkOperation to resume it)
+func deleteByPrefix(db *badger.DB, prefix string, match func(key []byte) bool) (uint64, error) {
+	keys := [][]byte{}
+	err := db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Seek([]byte(prefix)); it.ValidForPrefix([]byte(prefix)); it.Next() {
+			if match == nil || match(it.Item().Key()) {
+				keys = append(keys, it.Item().KeyCopy(nil))
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	batch := db.NewWriteBatch()
+	defer batch.Cancel()
+
+	for _, key := range keys {
+		if err := batch.Delete(key); err != nil {
+			return 0, err
+		}
+	}
+
+	err = batch.Flush()
+	if err != nil {
+		return 0, err
+	}
+
+	return uint64(len(keys)), nil
+}
+
+func (sr *ServerRepository) ErrKeyNotFound() error {
+	return badger.ErrKeyNotFound
+}
+
+// GetSequence returns badger sequence by key
+func (sr *ServerRepository) GetSequence(key []byte, increment uint64) (uint64, error) {
+	seq, err := sr.db.GetSequence(key, increment)
+	if err != nil {
+		log.Println("quics err: ", err)
+		return 0, err
+	}
+	defer seq.Release()
+
+	return seq.Next()
+}
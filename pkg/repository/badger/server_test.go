@@ -0,0 +1,239 @@
+package badger
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/quic-s/quics/pkg/types"
+)
+
+func TestDeleteClientDeletesPendingChanges(t *testing.T) {
+	tests := []struct {
+		name        string
+		delete      func(db *badger.DB) error
+		wantClients []string // clients left with their pending changes
+	}{
+		{
+			name:        "remove client",
+			delete:      func(db *badger.DB) error { return (&ServerRepository{db: db}).DeleteClientByUUID("uuid-a") },
+			wantClients: []string{"uuid-b"},
+		},
+		{
+			name:   "remove all clients",
+			delete: func(db *badger.DB) error { return (&ServerRepository{db: db}).DeleteAllClients() },
+		},
+		{
+			name:        "unregister client",
+			delete:      func(db *badger.DB) error { return (&RegistrationRepository{db: db}).DeleteClient("uuid-a") },
+			wantClients: []string{"uuid-b"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+			sr := &SyncRepository{db: db}
+			for _, uuid := range []string{"uuid-a", "uuid-b"} {
+				client := &types.Client{UUID: uuid}
+				err := db.Update(func(txn *badger.Txn) error {
+					return txn.Set([]byte(PrefixClient+uuid), client.Encode())
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := sr.AddPendingChange(uuid, "/r/a", 10); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := tt.delete(db); err != nil {
+				t.Fatal(err)
+			}
+
+			left := map[string]bool{}
+			for _, uuid := range tt.wantClients {
+				left[uuid] = true
+			}
+			for _, uuid := range []string{"uuid-a", "uuid-b"} {
+				err := db.View(func(txn *badger.Txn) error {
+					_, err := txn.Get([]byte(PrefixPending + uuid))
+					return err
+				})
+				if kept := err == nil; kept != left[uuid] {
+					t.Errorf("pending changes of %s kept = %t, want %t", uuid, kept, left[uuid])
+				}
+			}
+		})
+	}
+}
+
+func TestMoveRootDirectory(t *testing.T) {
+	tests := []struct {
+		name         string
+		files        int
+		corrupt      bool // a history in the middle of subtree can not be decoded
+		wantErr      bool
+		wantTooLarge bool
+	}{
+		{name: "small subtree", files: 3},
+		{name: "failure rolls back", files: 100, corrupt: true, wantErr: true},
+		{name: "subtree too large for one transaction", files: 3000, wantErr: true, wantTooLarge: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// small memtable limits transaction to about 6000 writes, so that large subtree does not fit in one
+			db := openTestDBWithOptions(t, badger.DefaultOptions("").WithInMemory(true).WithMemTableSize(4<<20).WithValueThreshold(1<<10))
+			sr := &ServerRepository{db: db}
+
+			// records referring to paths under root directory (and of sibling directory, which must be left as they are)
+			client := &types.Client{UUID: "uuid", Root: []types.RootDirectory{{AfterPath: "/r"}}, Subscriptions: []string{"/r/d1", "/rs"}}
+			rootDir := &types.RootDirectory{AfterPath: "/r", UUIDs: []string{"uuid"}}
+			pendingChanges := &types.PendingChanges{UUID: "uuid", AfterPaths: []string{"/r/d1/f1", "/rs/a"}}
+			sharing := &types.Sharing{Link: "link", File: types.File{AfterPath: "/r/d1/f1", RootDirKey: "/r"}}
+			commitSet := &types.CommitSet{ID: "set", Members: []types.CommitMember{{AfterPath: "/r/d1/f1"}, {AfterPath: "/rs/a"}}}
+			batch := db.NewWriteBatch()
+			defer batch.Cancel()
+			for key, val := range map[string][]byte{
+				PrefixClient + client.UUID:          client.Encode(),
+				PrefixRootDir + "/r":                rootDir.Encode(),
+				PrefixPending + pendingChanges.UUID: pendingChanges.Encode(),
+				PrefixSharing + sharing.Link:        sharing.Encode(),
+				PrefixCommit + commitSet.ID:         commitSet.Encode(),
+			} {
+				if err := batch.Set([]byte(key), val); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for i := 0; i < tt.files; i++ {
+				afterPath := "/r/d" + strconv.Itoa(i%10) + "/f" + strconv.Itoa(i)
+				file := &types.File{AfterPath: afterPath, RootDirKey: "/r", LatestHash: afterPath + "-hash", LatestSyncTimestamp: 2}
+				if err := batch.Set([]byte(PrefixFile+afterPath), file.Encode()); err != nil {
+					t.Fatal(err)
+				}
+				for _, timestamp := range []string{"1", "2"} {
+					history := &types.FileHistory{AfterPath: afterPath, Hash: afterPath + "-" + timestamp}
+					if err := batch.Set([]byte(PrefixHistory+afterPath+"_"+timestamp), history.Encode()); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			if tt.corrupt {
+				if err := batch.Set([]byte(PrefixHistory+"/r/d5/f55_3"), []byte("broken")); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := batch.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			// sibling sharing prefix of root directory must not be moved
+			saveTestFile(t, db, "/rs/a", 1)
+
+			err := sr.MoveRootDirectory("/r", "/m")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("MoveRootDirectory() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if errors.Is(err, ErrMoveTooLarge) != tt.wantTooLarge {
+				t.Fatalf("MoveRootDirectory() error = %v, want %v: %t", err, ErrMoveTooLarge, tt.wantTooLarge)
+			}
+
+			from, to := "/r", "/m"
+			if tt.wantErr {
+				// nothing is moved
+				from, to = "/m", "/r"
+			}
+			if count := countKeys(t, db, PrefixFile+from+"/"); count != 0 {
+				t.Errorf("files left under %s = %d, want 0", from, count)
+			}
+			if count := countKeys(t, db, PrefixFile+to+"/"); count != tt.files {
+				t.Errorf("files under %s = %d, want %d", to, count, tt.files)
+			}
+			if count := countKeys(t, db, PrefixHistory+to+"/"); count < tt.files*2 {
+				t.Errorf("histories under %s = %d, want %d", to, count, tt.files*2)
+			}
+			if count := countKeys(t, db, PrefixRootDir+to); count != 1 {
+				t.Errorf("root directory %s is not found", to)
+			}
+			if count := countKeys(t, db, PrefixFile+"/rs/"); count != 1 {
+				t.Error("file of sibling directory is moved")
+			}
+
+			moved, err := sr.GetClientByUUID("uuid")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if moved.Root[0].AfterPath != to {
+				t.Errorf("root of client = %s, want %s", moved.Root[0].AfterPath, to)
+			}
+			if want := []string{to + "/d1", "/rs"}; !slices.Equal(moved.Subscriptions, want) {
+				t.Errorf("subscriptions of client = %v, want %v", moved.Subscriptions, want)
+			}
+			syncRepository := &SyncRepository{db: db}
+			movedPendingChanges, err := syncRepository.PopPendingChanges("uuid")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := []string{to + "/d1/f1", "/rs/a"}; !slices.Equal(movedPendingChanges.AfterPaths, want) {
+				t.Errorf("pending changes = %v, want %v", movedPendingChanges.AfterPaths, want)
+			}
+			movedSharing, err := (&SharingRepository{db: db}).GetLink("link")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if movedSharing.File.AfterPath != to+"/d1/f1" || movedSharing.File.RootDirKey != to {
+				t.Errorf("shared file = %s (root %s), want %s", movedSharing.File.AfterPath, movedSharing.File.RootDirKey, to+"/d1/f1")
+			}
+			movedCommitSet, err := syncRepository.GetCommitSet("set")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := []string{movedCommitSet.Members[0].AfterPath, movedCommitSet.Members[1].AfterPath}, []string{to + "/d1/f1", "/rs/a"}; !slices.Equal(got, want) {
+				t.Errorf("members of commit set = %v, want %v", got, want)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			file, err := sr.GetFileByAfterPath("/m/d1/f1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if file.AfterPath != "/m/d1/f1" || file.RootDirKey != "/m" || file.LatestHash != "/r/d1/f1-hash" {
+				t.Errorf("moved file = %s (root %s, hash %s)", file.AfterPath, file.RootDirKey, file.LatestHash)
+			}
+			history, err := sr.GetHistoryByAfterPath("/m/d1/f1_2")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if history.AfterPath != "/m/d1/f1" || history.Hash != "/r/d1/f1-2" {
+				t.Errorf("moved history = %s (hash %s)", history.AfterPath, history.Hash)
+			}
+		})
+	}
+}
+
+// countKeys counts entries which have the prefix
+func countKeys(t *testing.T, db *badger.DB, prefix string) int {
+	t.Helper()
+
+	count := 0
+	err := db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Seek([]byte(prefix)); it.ValidForPrefix([]byte(prefix)); it.Next() {
+			count++
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return count
+}
@@ -1,15 +1,22 @@
 package badger
 
 import (
+	"errors"
+	"fmt"
 	"log"
+	"strconv"
 
 	"github.com/dgraph-io/badger/v3"
 	"github.com/quic-s/quics/pkg/types"
+	"golang.org/x/exp/slices"
 )
 
 const (
 	PrefixFile     string = "file_"
 	PrefixConflict string = "conflict_"
+	PrefixPending  string = "pending_"
+	PrefixCommit   string = "commit_"
+	PrefixTransfer string = "transfer_"
 )
 
 type SyncRepository struct {
@@ -323,6 +330,351 @@ func (sr *SyncRepository) DeleteConflict(afterpath string) error {
 	return nil
 }
 
+// AddPendingChange queues afterPath to be pushed to offline client,
+// and collapses the queue to full resync marker when it would exceed maxLen
+func (sr *SyncRepository) AddPendingChange(uuid string, afterPath string, maxLen int) error {
+	key := []byte(PrefixPending + uuid)
+
+	err := sr.db.Update(func(txn *badger.Txn) error {
+		pendingChanges := &types.PendingChanges{
+			UUID: uuid,
+		}
+
+		item, err := txn.Get(key)
+		switch err {
+		case nil:
+			val, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			if err := pendingChanges.Decode(val); err != nil {
+				return err
+			}
+		case badger.ErrKeyNotFound:
+		default:
+			return err
+		}
+
+		// every path is scanned on full resync, so nothing is needed to be queued
+		if pendingChanges.FullResync || slices.Contains(pendingChanges.AfterPaths, afterPath) {
+			return nil
+		}
+
+		if len(pendingChanges.AfterPaths) >= maxLen {
+			pendingChanges.AfterPaths = nil
+			pendingChanges.FullResync = true
+		} else {
+			pendingChanges.AfterPaths = append(pendingChanges.AfterPaths, afterPath)
+		}
+
+		return txn.Set(key, pendingChanges.Encode())
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// PopPendingChanges returns queued changes of client and empties the queue
+// empty changes are returned when nothing is queued
+func (sr *SyncRepository) PopPendingChanges(uuid string) (*types.PendingChanges, error) {
+	key := []byte(PrefixPending + uuid)
+	pendingChanges := &types.PendingChanges{
+		UUID: uuid,
+	}
+
+	err := sr.db.Update(func(txn *badger.Txn) error {
+		item, err := txn.Get(key)
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		val, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		if err := pendingChanges.Decode(val); err != nil {
+			return err
+		}
+
+		return txn.Delete(key)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return pendingChanges, nil
+}
+
+// RequeuePendingChanges puts changes popped by PopPendingChanges back in front of those queued since then,
+// and collapses the queue to full resync marker when either is full resync or it would exceed maxLen
+func (sr *SyncRepository) RequeuePendingChanges(popped *types.PendingChanges, maxLen int) error {
+	key := []byte(PrefixPending + popped.UUID)
+
+	err := sr.db.Update(func(txn *badger.Txn) error {
+		queued := &types.PendingChanges{}
+
+		item, err := txn.Get(key)
+		switch err {
+		case nil:
+			val, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			if err := queued.Decode(val); err != nil {
+				return err
+			}
+		case badger.ErrKeyNotFound:
+		default:
+			return err
+		}
+
+		pendingChanges := &types.PendingChanges{
+			UUID:       popped.UUID,
+			AfterPaths: slices.Clone(popped.AfterPaths),
+			FullResync: popped.FullResync || queued.FullResync,
+		}
+		for _, afterPath := range queued.AfterPaths {
+			if !slices.Contains(pendingChanges.AfterPaths, afterPath) {
+				pendingChanges.AfterPaths = append(pendingChanges.AfterPaths, afterPath)
+			}
+		}
+		if pendingChanges.FullResync || len(pendingChanges.AfterPaths) > maxLen {
+			pendingChanges.AfterPaths = nil
+			pendingChanges.FullResync = true
+		}
+		if !pendingChanges.FullResync && len(pendingChanges.AfterPaths) == 0 {
+			return nil
+		}
+
+		return txn.Set(key, pendingChanges.Encode())
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SaveCommitSet creates/updates commit set
+func (sr *SyncRepository) SaveCommitSet(commitSet *types.CommitSet) error {
+	key := []byte(PrefixCommit + commitSet.ID)
+
+	err := sr.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(key, commitSet.Encode())
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetCommitSet returns commit set of id (badger.ErrKeyNotFound if it does not exist)
+func (sr *SyncRepository) GetCommitSet(id string) (*types.CommitSet, error) {
+	key := []byte(PrefixCommit + id)
+	commitSet := &types.CommitSet{}
+
+	err := sr.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(key)
+		if err != nil {
+			return err
+		}
+
+		val, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+
+		return commitSet.Decode(val)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return commitSet, nil
+}
+
+func (sr *SyncRepository) DeleteCommitSet(id string) error {
+	key := []byte(PrefixCommit + id)
+
+	err := sr.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(key)
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// CommitFiles saves files, their new histories and committed commit set in one transaction,
+// so that either every new version is visible or none of them is
+// the transaction is refused when any file has been synced since its new version was made (timestamp is not the next one)
+func (sr *SyncRepository) CommitFiles(commitSet *types.CommitSet, files []*types.File, fileHistories []*types.FileHistory) error {
+	err := sr.db.Update(func(txn *badger.Txn) error {
+		for _, file := range files {
+			latestSyncTimestamp := uint64(0)
+
+			item, err := txn.Get([]byte(PrefixFile + file.AfterPath))
+			switch err {
+			case nil:
+				current := &types.File{}
+				val, err := item.ValueCopy(nil)
+				if err != nil {
+					return err
+				}
+				if err := current.Decode(val); err != nil {
+					return err
+				}
+				latestSyncTimestamp = current.LatestSyncTimestamp
+			case badger.ErrKeyNotFound:
+			default:
+				return err
+			}
+
+			if file.LatestSyncTimestamp != latestSyncTimestamp+1 {
+				return errors.New("file has been changed while committing: " + file.AfterPath)
+			}
+
+			err = txn.Set([]byte(PrefixFile+file.AfterPath), file.Encode())
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, fileHistory := range fileHistories {
+			key := []byte(PrefixHistory + fileHistory.AfterPath + "_" + strconv.FormatUint(fileHistory.Timestamp, 10))
+			err := txn.Set(key, fileHistory.Encode())
+			if err != nil {
+				return err
+			}
+		}
+
+		return txn.Set([]byte(PrefixCommit+commitSet.ID), commitSet.Encode())
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SaveTransfer records completed transfer
+func (sr *SyncRepository) SaveTransfer(transfer *types.Transfer) error {
+	err := sr.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(transferKey(transfer), transfer.Encode())
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// transferKey orders transfers by completion time (zero padded unix nano), so that a period is read by seeking its start
+func transferKey(transfer *types.Transfer) []byte {
+	return []byte(fmt.Sprintf("%s%020d_%s", PrefixTransfer, transfer.Date.UnixNano(), transfer.AfterPath))
+}
+
 func (sr *SyncRepository) ErrKeyNotFound() error {
 	return badger.ErrKeyNotFound
 }
+
+// MoveFile re-keys histories of removed.AfterPath to file.AfterPath in one transaction, saves movedHistory which records the move
+// as new version of file, and leaves removed (with removedHistory) at source path as removed file
+// existing destination file is replaced with its histories only when overwrite is set
+func (sr *SyncRepository) MoveFile(removed *types.File, removedHistory *types.FileHistory, file *types.File, movedHistory *types.FileHistory, overwrite bool) error {
+	err := sr.db.Update(func(txn *badger.Txn) error {
+		_, err := txn.Get([]byte(PrefixFile + file.AfterPath))
+		if err == nil && !overwrite {
+			return errors.New("destination file already exists: " + file.AfterPath)
+		}
+		if err != nil && err != badger.ErrKeyNotFound {
+			return err
+		}
+
+		// histories of replaced destination are deleted first, so that they are not mixed with moved ones
+		if overwrite {
+			_, replacedKeys, err := getFileHistoriesInTxn(txn, file.AfterPath)
+			if err != nil {
+				return err
+			}
+			for _, key := range replacedKeys {
+				if err := txn.Delete(key); err != nil {
+					return err
+				}
+			}
+		}
+
+		histories, keys, err := getFileHistoriesInTxn(txn, removed.AfterPath)
+		if err != nil {
+			return err
+		}
+		for i, history := range histories {
+			history.AfterPath = file.AfterPath
+			if err := txn.Delete(keys[i]); err != nil {
+				return err
+			}
+			if err := txn.Set([]byte(PrefixHistory+file.AfterPath+"_"+strconv.FormatUint(history.Timestamp, 10)), history.Encode()); err != nil {
+				return err
+			}
+		}
+		if err := txn.Set([]byte(PrefixHistory+file.AfterPath+"_"+strconv.FormatUint(movedHistory.Timestamp, 10)), movedHistory.Encode()); err != nil {
+			return err
+		}
+
+		if err := txn.Set([]byte(PrefixHistory+removed.AfterPath+"_"+strconv.FormatUint(removedHistory.Timestamp, 10)), removedHistory.Encode()); err != nil {
+			return err
+		}
+		if err := txn.Set([]byte(PrefixFile+removed.AfterPath), removed.Encode()); err != nil {
+			return err
+		}
+		return txn.Set([]byte(PrefixFile+file.AfterPath), file.Encode())
+	})
+	if err != nil {
+		log.Println("quics err: ", err)
+		return err
+	}
+
+	return nil
+}
+
+// getFileHistoriesInTxn returns histories of the file of afterPath with their keys
+// they are collected first, because it is not allowed to modify keys while iterating same prefix
+func getFileHistoriesInTxn(txn *badger.Txn, afterPath string) ([]*types.FileHistory, [][]byte, error) {
+	histories := []*types.FileHistory{}
+	keys := [][]byte{}
+
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchSize = 10
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	prefix := []byte(PrefixHistory + afterPath + "_")
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		item := it.Item()
+		val, err := item.ValueCopy(nil)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		history := &types.FileHistory{}
+		if err := history.Decode(val); err != nil {
+			return nil, nil, err
+		}
+
+		// prefix can also match other file (e.g., /root/a and /root/a_b)
+		if history.AfterPath != afterPath {
+			continue
+		}
+		histories = append(histories, history)
+		keys = append(keys, item.KeyCopy(nil))
+	}
+
+	return histories, keys, nil
+}
@@ -0,0 +1,219 @@
+package badger
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/quic-s/quics/pkg/types"
+)
+
+// saveTestFile saves file of afterPath with histories of timestamps (the last one is latest)
+func saveTestFile(t *testing.T, db *badger.DB, afterPath string, timestamps ...uint64) *types.File {
+	t.Helper()
+
+	file := &types.File{
+		AfterPath:           afterPath,
+		RootDirKey:          "/r",
+		LatestHash:          afterPath + "-hash",
+		LatestSyncTimestamp: timestamps[len(timestamps)-1],
+		ContentsExisted:     true,
+	}
+	err := db.Update(func(txn *badger.Txn) error {
+		for _, timestamp := range timestamps {
+			history := &types.FileHistory{AfterPath: afterPath, Timestamp: timestamp, Hash: afterPath + "-" + strconv.FormatUint(timestamp, 10)}
+			if err := txn.Set([]byte(PrefixHistory+afterPath+"_"+strconv.FormatUint(timestamp, 10)), history.Encode()); err != nil {
+				return err
+			}
+		}
+		return txn.Set([]byte(PrefixFile+afterPath), file.Encode())
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return file
+}
+
+// getTestHistories returns histories of the file of afterPath by timestamp
+func getTestHistories(t *testing.T, db *badger.DB, afterPath string) map[uint64]*types.FileHistory {
+	t.Helper()
+
+	histories := map[uint64]*types.FileHistory{}
+	err := db.View(func(txn *badger.Txn) error {
+		found, _, err := getFileHistoriesInTxn(txn, afterPath)
+		for _, history := range found {
+			histories[history.Timestamp] = history
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return histories
+}
+
+func TestSyncRepositoryMoveFileKeepsHistories(t *testing.T) {
+	tests := []struct {
+		name       string
+		to         []uint64 // histories of existing destination (none when nil)
+		overwrite  bool
+		wantErr    bool
+		wantMoved  []uint64 // histories of destination after move
+		wantSource []uint64 // histories left at source after move
+	}{
+		{
+			name:       "new destination",
+			wantMoved:  []uint64{1, 2, 3, 4},
+			wantSource: []uint64{4},
+		},
+		{
+			name:       "replaced destination",
+			to:         []uint64{1, 2, 5, 6},
+			overwrite:  true,
+			wantMoved:  []uint64{1, 2, 3, 7},
+			wantSource: []uint64{4},
+		},
+		{
+			name:       "existing destination without overwrite",
+			to:         []uint64{1},
+			wantErr:    true,
+			wantMoved:  []uint64{1},
+			wantSource: []uint64{1, 2, 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+			sr := &SyncRepository{db: db}
+
+			file := saveTestFile(t, db, "/r/a", 1, 2, 3)
+			// sibling sharing prefix of history keys must not be moved
+			saveTestFile(t, db, "/r/a_b", 1)
+			if tt.to != nil {
+				saveTestFile(t, db, "/r/c", tt.to...)
+			}
+
+			timestamp := tt.wantMoved[len(tt.wantMoved)-1]
+			moved := *file
+			moved.AfterPath = "/r/c"
+			moved.LatestSyncTimestamp = timestamp
+			movedHistory := &types.FileHistory{AfterPath: "/r/c", Timestamp: timestamp, Hash: file.LatestHash, MovedFrom: "/r/a"}
+			removed := &types.File{AfterPath: "/r/a", RootDirKey: "/r", LatestSyncTimestamp: 4, ContentsExisted: true}
+			removedHistory := &types.FileHistory{AfterPath: "/r/a", Timestamp: 4}
+
+			err := sr.MoveFile(removed, removedHistory, &moved, movedHistory, tt.overwrite)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("MoveFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			for afterPath, want := range map[string][]uint64{"/r/c": tt.wantMoved, "/r/a": tt.wantSource} {
+				histories := getTestHistories(t, db, afterPath)
+				if len(histories) != len(want) {
+					t.Fatalf("histories of %s = %d, want %d", afterPath, len(histories), len(want))
+				}
+				for _, timestamp := range want {
+					if histories[timestamp] == nil {
+						t.Fatalf("history %d of %s is missing", timestamp, afterPath)
+					}
+				}
+			}
+			if len(getTestHistories(t, db, "/r/a_b")) != 1 {
+				t.Fatal("history of /r/a_b is moved")
+			}
+			if tt.wantErr {
+				return
+			}
+
+			// prior histories keep their contents hash, and the last one records the move
+			histories := getTestHistories(t, db, "/r/c")
+			for _, timestamp := range []uint64{1, 2, 3} {
+				if want := "/r/a-" + strconv.FormatUint(timestamp, 10); histories[timestamp].Hash != want {
+					t.Errorf("history %d of /r/c has hash %s, want %s", timestamp, histories[timestamp].Hash, want)
+				}
+			}
+			if histories[timestamp].MovedFrom != "/r/a" {
+				t.Errorf("moved history records MovedFrom = %q, want /r/a", histories[timestamp].MovedFrom)
+			}
+
+			source, err := sr.GetFileByPath("/r/a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if source.LatestHash != "" || source.LatestSyncTimestamp != 4 {
+				t.Errorf("source is not left as removed file: hash %q, timestamp %d", source.LatestHash, source.LatestSyncTimestamp)
+			}
+			destination, err := sr.GetFileByPath("/r/c")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if destination.LatestHash != file.LatestHash || destination.LatestSyncTimestamp != timestamp {
+				t.Errorf("destination is hash %q, timestamp %d, want %q, %d", destination.LatestHash, destination.LatestSyncTimestamp, file.LatestHash, timestamp)
+			}
+		})
+	}
+}
+
+func TestSyncRepositoryRequeuePendingChanges(t *testing.T) {
+	tests := []struct {
+		name   string
+		popped types.PendingChanges
+		queued []string // changes queued after pop
+		maxLen int
+		want   types.PendingChanges
+	}{
+		{
+			name:   "popped go before queued",
+			popped: types.PendingChanges{AfterPaths: []string{"/r/a", "/r/b"}},
+			queued: []string{"/r/c", "/r/a"},
+			maxLen: 10,
+			want:   types.PendingChanges{AfterPaths: []string{"/r/a", "/r/b", "/r/c"}},
+		},
+		{
+			name:   "full resync is kept",
+			popped: types.PendingChanges{FullResync: true},
+			queued: []string{"/r/c"},
+			maxLen: 10,
+			want:   types.PendingChanges{FullResync: true},
+		},
+		{
+			name:   "too many collapse to full resync",
+			popped: types.PendingChanges{AfterPaths: []string{"/r/a", "/r/b"}},
+			queued: []string{"/r/c"},
+			maxLen: 2,
+			want:   types.PendingChanges{FullResync: true},
+		},
+		{
+			name:   "nothing to requeue",
+			maxLen: 10,
+			want:   types.PendingChanges{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sr := &SyncRepository{db: openTestDB(t)}
+
+			for _, afterPath := range tt.queued {
+				if err := sr.AddPendingChange("uuid", afterPath, tt.maxLen); err != nil {
+					t.Fatal(err)
+				}
+			}
+			tt.popped.UUID = "uuid"
+			if err := sr.RequeuePendingChanges(&tt.popped, tt.maxLen); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := sr.PopPendingChanges("uuid")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.FullResync != tt.want.FullResync || strings.Join(got.AfterPaths, ",") != strings.Join(tt.want.AfterPaths, ",") {
+				t.Errorf("requeued = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
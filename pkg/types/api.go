@@ -0,0 +1,673 @@
+package types
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// APIVersion is the version of rest api spoken by this build, which is sent in APIVersionHeader of every request and response
+// MinAPIVersion is the oldest api version of client which server still accepts (bump APIVersion on breaking change of rest api,
+// and MinAPIVersion when server drops support of older clients)
+const (
+	APIVersion    = 1
+	MinAPIVersion = 1
+
+	APIVersionHeader    = "Quics-Api-Version"
+	APIMinVersionHeader = "Quics-Api-Min-Version"
+)
+
+// AdminTokenHeader carries admin token of running server, so that caller is served as admin (fields of REDACT_FIELDS are not hidden)
+// RedactedHeader is set to "true" on response whose fields are hidden from caller without admin token
+const (
+	AdminTokenHeader = "Quics-Admin-Token"
+	RedactedHeader   = "Quics-Redacted"
+)
+
+// RedactStrip and RedactMask select how field of REDACT_FIELDS is hidden from caller without admin token:
+// strip removes the field, and mask replaces its strings with "[REDACTED]" (and other values with null)
+// RedactNone disables redaction (REDACT_FIELDS=none)
+const (
+	RedactStrip = "strip"
+	RedactMask  = "mask"
+	RedactNone  = "none"
+)
+
+// RedactEndpoints are names of listing endpoints which rules of REDACT_FIELDS can be scoped to (e.g., clients:Ip=mask)
+var RedactEndpoints = []string{"clients", "directories", "conflicts", "files", "orphaned", "duplicates", "histories", "paths", "lineage", "locks"}
+
+// RedactRule hides Field (json field at any depth, case-insensitive) of responses of Endpoint from caller without admin token
+type RedactRule struct {
+	Endpoint string // one of RedactEndpoints (empty: every listing endpoint)
+	Field    string
+	Mode     string // RedactStrip or RedactMask
+}
+
+// FileMetadataHeader carries custom metadata of file as JSON object (set by upload, and sent with download)
+const FileMetadataHeader = "Quics-Metadata"
+
+// VersionIncompatible is the error code of request whose api version is out of range supported by server
+const VersionIncompatible = "VERSION_INCOMPATIBLE"
+
+// SafeMode is the error code of write rejected while server runs in safe mode (qis start --safe-mode)
+const SafeMode = "SAFE_MODE"
+
+// BulkOperationRunning is the error code of destructive bulk operation rejected while another one is running
+const BulkOperationRunning = "BULK_OPERATION_RUNNING"
+
+// APIVersionRange formats range of api versions between min and max (e.g., 1-2, or 1 when they are the same)
+func APIVersionRange(min int, max int) string {
+	if min == max {
+		return strconv.Itoa(max)
+	}
+	return strconv.Itoa(min) + "-" + strconv.Itoa(max)
+}
+
+// ScrubRes is used to report the result of integrity scrubbing of stored contents
+type ScrubRes struct {
+	Scanned        uint64
+	Corrupted      uint64
+	CorruptedFiles []string
+}
+
+// ReindexRes is used to report the result of rebuilding a derived index
+type ReindexRes struct {
+	Index   string
+	Scanned uint64 // primary records scanned
+	Updated uint64 // records whose index entry drifted and was rebuilt
+	Failed  uint64 // records which could not be indexed (e.g., stored contents are missing)
+}
+
+// TransferStatsRes is used to report transfers completed between Since and Until bucketed into windows of Bucket
+type TransferStatsRes struct {
+	Since   time.Time
+	Until   time.Time
+	Bucket  time.Duration
+	Buckets []TransferBucket
+	Total   TransferBucket // every transfer of the period as one window
+}
+
+// TransferBucket is aggregated transfers completed in a window starting at Start
+// Throughput is bytes per second over the whole window (not only while transferring)
+type TransferBucket struct {
+	Start      time.Time
+	Count      uint64
+	Uploads    uint64
+	Downloads  uint64
+	Bytes      int64
+	Throughput float64
+	AvgSize    int64
+	P50Size    int64
+	P95Size    int64
+}
+
+// EffectivePolicy is used to report sync behaviors resolved for a file with the policy each behavior came from
+type EffectivePolicy struct {
+	AfterPath string
+
+	Ignore                   bool
+	IgnoreSource             string
+	StoreContentOnly         bool
+	StoreContentOnlySource   string
+	Versioning               string // VersioningFull or VersioningLatest
+	VersioningSource         string
+	CompressOnTransfer       bool
+	CompressOnTransferSource string
+}
+
+const (
+	PolicySourceGlobal = "global default"
+)
+
+// CheckpointRes is used to report database files synced to disk by checkpoint
+type CheckpointRes struct {
+	SyncedFiles uint64
+	Duration    string
+}
+
+// DBStatsRes is used to report internals of database, so that operator can decide when to compact it or collect garbage of value log
+type DBStatsRes struct {
+	LSMSize          int64 // bytes of sst files
+	StaleLSMSize     int64 // bytes of overwritten or deleted entries which compaction would drop
+	Levels           []DBLevelStats
+	ValueLogFiles    int
+	ValueLogSize     int64 // bytes of sealed value log files (the newest one being written is not counted)
+	LiveValueLogSize int64 // bytes of value log still referenced by latest versions of keys
+	EstimatedGarbage int64 // ValueLogSize - LiveValueLogSize (at least), which value log gc can reclaim
+	// ValueLogGCRecommended is true when estimated garbage is large enough for value log gc to rewrite value log files
+	ValueLogGCRecommended bool
+	DBMaintenance
+}
+
+// DBLevelStats is used to report a level of LSM tree
+type DBLevelStats struct {
+	Level      int
+	Tables     int
+	Size       int64
+	TargetSize int64
+	StaleSize  int64
+}
+
+// DBCompactRes is used to report the result of compaction (and value log gc) of database
+type DBCompactRes struct {
+	LSMSizeBefore      int64
+	LSMSizeAfter       int64
+	ValueLogSizeBefore int64
+	ValueLogSizeAfter  int64
+	RewrittenLogFiles  uint64 // value log files rewritten by value log gc (0 when it is not requested)
+	Duration           string
+}
+
+// BrowseRes is used to show directory index of stored files (directories first, then files by name)
+type BrowseRes struct {
+	AfterPath string
+	Entries   []BrowseEntry
+}
+
+// BrowseEntry is a directory or a file of directory index
+// Versions are sync timestamps of stored histories of the file (the latest first)
+type BrowseEntry struct {
+	Name                string
+	AfterPath           string
+	IsDir               bool
+	Size                int64
+	ModTime             time.Time
+	LatestSyncTimestamp uint64
+	Versions            []uint64
+}
+
+const (
+	EventUpdate   = "UPDATE"
+	EventRemove   = "REMOVE"
+	EventConflict = "CONFLICT"
+	EventResolve  = "RESOLVE"
+	EventRollback = "ROLLBACK"
+
+	// EventContentMissing is published when stored contents of recorded version are missing (e.g., deleted out of band)
+	EventContentMissing = "CONTENT_MISSING"
+
+	// EventContentCorrupted is published when scrub finds stored contents of the latest version whose hash differs from the recorded one
+	EventContentCorrupted = "CONTENT_CORRUPTED"
+
+	// EventDiskFull is published when write is aborted because volume of data directory has no space left
+	EventDiskFull = "DISK_FULL"
+
+	// EventLockBroken is published when admin breaks lock of file, so that holder (UUID of event) learns it lost the lock
+	EventLockBroken = "LOCK_BROKEN"
+)
+
+// Event is used to notify change of file to event stream listeners
+type Event struct {
+	Type      string
+	AfterPath string
+	UUID      string
+	Timestamp uint64
+	Hash      string
+	Date      string
+	Reason    string `json:",omitempty"` // why lock was broken (EventLockBroken)
+}
+
+// EventOrderingPath and EventOrderingNone select whether events of the same afterPath are delivered in order (EVENT_ORDERING)
+// path delivers events of different paths in parallel, and none delivers every event in parallel
+const (
+	EventOrderingPath = "path"
+	EventOrderingNone = "none"
+)
+
+// EventOverflowDrop and EventOverflowBlock select what happens to event published while event queue is full (EVENT_OVERFLOW)
+// drop discards the event, and block makes publisher (e.g., sync) wait until there is space in queue
+const (
+	EventOverflowDrop  = "drop"
+	EventOverflowBlock = "block"
+)
+
+// EventStats is used to report delivery of events to event stream subscribers
+type EventStats struct {
+	Workers         int
+	Ordering        string
+	Overflow        string
+	QueueDepth      int // events waiting for workers
+	QueueCapacity   int
+	Published       uint64
+	Delivered       uint64 // events sent to listeners (an event is counted for each listener)
+	DroppedQueue    uint64 // events dropped because queue was full
+	DroppedListener uint64 // events dropped because listener was busy
+}
+
+const (
+	DiffAdded    = "A"
+	DiffModified = "M"
+	DiffRemoved  = "D"
+)
+
+// DiffEntry is used to report change of a file between two points in time
+type DiffEntry struct {
+	Status        string // DiffAdded, DiffModified or DiffRemoved
+	AfterPath     string
+	FromTimestamp uint64 // 0 when file did not exist
+	ToTimestamp   uint64 // 0 when file does not exist
+	FromHash      string
+	ToHash        string
+	Encrypted     bool // contents are encrypted by client, so they are not compared even with content option
+}
+
+// DirDiffRes is used to report changes of files under directory between two points in time
+type DirDiffRes struct {
+	AfterPath string
+	From      time.Time
+	To        time.Time
+	Entries   []DiffEntry
+}
+
+// FileLineageRes is used to report where file came from and where it went by moves (renames) recorded in histories
+type FileLineageRes struct {
+	AfterPath string
+	Moves     []FileMove // ordered by date
+}
+
+// FileMove is a move of file from From to To, recorded as the version of Timestamp
+type FileMove struct {
+	From      string
+	To        string
+	Date      string
+	Timestamp uint64
+	Hash      string
+}
+
+// DuplicatesRes is used to report sets of files sharing identical contents (by ContentHash),
+// and bytes which would be reclaimed by keeping only one file of each set
+type DuplicatesRes struct {
+	Groups           []DuplicateGroup // ordered by ReclaimableBytes (largest first)
+	DuplicateFiles   uint64           // files beyond the first one of each group
+	ReclaimableBytes int64
+}
+
+// DuplicateGroup is a set of files (more than one) whose latest contents are identical
+type DuplicateGroup struct {
+	ContentHash      string
+	Size             int64
+	AfterPaths       []string
+	ReclaimableBytes int64 // Size * (len(AfterPaths) - 1)
+}
+
+// SyncNowRes is used to report changes exchanged by sync pass run right away with client (qis sync now)
+type SyncNowRes struct {
+	UUID     string
+	Scanned  int  // files of root directories of client compared with those of client
+	Pushed   int  // files sent to client because server has newer version
+	Pulled   int  // contents received from client because server had only their metadata
+	Pending  int  // changes queued while client was offline, which are covered by this pass
+	Manifest bool // files are compared by merkle manifest instead of full listing
+}
+
+// LockInfo is active advisory lock of file (qis lock list)
+type LockInfo struct {
+	AfterPath  string
+	Holder     string
+	AcquiredAt time.Time
+	ExpiresAt  time.Time
+}
+
+// BreakLockRes is used to report lock released by admin instead of its holder (qis lock break)
+type BreakLockRes struct {
+	Lock     LockInfo
+	Reason   string
+	BrokenAt time.Time
+}
+
+// ConflictsRes is used to report unresolved conflicts grouped by root directory of conflicted files
+type ConflictsRes struct {
+	Directories []DirectoryConflicts // ordered by RootDir
+	Conflicts   uint64               // conflicted files of every directory
+}
+
+// DirectoryConflicts is a root directory with its conflicted files (ordered by AfterPath)
+type DirectoryConflicts struct {
+	RootDir   string
+	Conflicts []FileConflict
+}
+
+// FileConflict is a conflicted file with competing versions, one of which is kept by resolving it
+type FileConflict struct {
+	AfterPath  string
+	Candidates []ConflictCandidate // ordered by Side ("server" first)
+}
+
+// ConflictCandidate is a competing version of conflicted file
+// Side is "server" for version of server, or UUID of client which uploaded it (given as --keep of qis conflict resolve)
+type ConflictCandidate struct {
+	Side      string
+	UUID      string // client which edited this version
+	Hash      string
+	Timestamp uint64
+	Date      string
+	Size      int64
+}
+
+// RemoveRes is used to report the number of removed files (or files to be removed when DryRun is true)
+type RemoveRes struct {
+	Removed uint64
+	DryRun  bool
+}
+
+// BulkOperationRes is used to report progress of destructive bulk operation which is running (e.g., remove dir --all)
+// only one of them runs at a time, and Running is false when none is running
+type BulkOperationRes struct {
+	Running   bool
+	Kind      string // BulkRemoveClients, BulkRemoveDirectories, BulkRemoveFiles or BulkRemoveOrphanedFiles
+	AfterPath string
+	Purge     bool
+	StartedAt string
+	Phase     string // BulkPhasePurge or BulkPhaseRemove
+	Done      uint64 // files finished in the phase
+	Total     uint64 // files of the phase (0: not known until the phase is finished)
+}
+
+const (
+	BulkPhasePurge  = "purge"  // stored contents and histories of files are deleted
+	BulkPhaseRemove = "remove" // records are deleted
+)
+
+// CountRes is used to response the number of entries of logs endpoint (clients, directories, files, histories) narrowed by filter
+// KeysOnly is true when entries are counted by keys alone (filter has nothing but prefix, which is matched with keys)
+type CountRes struct {
+	Count    uint64
+	KeysOnly bool
+}
+
+// BulkUpdateRes is used to report files matched by bulk update and how many of them were changed
+// (or would be changed when DryRun is true); files which could not be updated are counted in Failed
+type BulkUpdateRes struct {
+	Matched  uint64
+	Updated  uint64
+	Failed   uint64
+	Failures []BulkFailure // at most MaxBulkFailures of failed files
+	DryRun   bool
+}
+
+// MaxBulkFailures is the number of failed files listed by BulkUpdateRes
+const MaxBulkFailures = 100
+
+// BulkFailure is a file which bulk update could not be applied to
+type BulkFailure struct {
+	AfterPath string
+	Error     string
+}
+
+// SetPasswordReq is used to change password of server; CurrentPassword must be the password in use unless server has none
+type SetPasswordReq struct {
+	CurrentPassword string
+	Password        string
+}
+
+// ResetPasswordReq is used to reset password of server to default one, authorized by admin token instead of password
+type ResetPasswordReq struct {
+	AdminToken string // contents of admin token file written by running server (utils.GetAdminTokenPath)
+}
+
+// SignedURLRes is url which downloads a version of file without login until ExpiresAt
+type SignedURLRes struct {
+	URL       string
+	ExpiresAt time.Time
+}
+
+// VersionKind selects how VersionSelector.Value is read
+type VersionKind string
+
+// VersionByOrdinal selects Value-th (1-based) version in history of file ordered by timestamp,
+// VersionByTimestamp selects version recorded at timestamp of Value, and VersionLatest selects the current version (Value is unused)
+const (
+	VersionByOrdinal   VersionKind = "ordinal"
+	VersionByTimestamp VersionKind = "timestamp"
+	VersionLatest      VersionKind = "latest"
+)
+
+// VersionSelector selects a version of file, which server resolves to its timestamp
+type VersionSelector struct {
+	Kind  VersionKind
+	Value uint64
+}
+
+// Validate reports whether selector selects a version; ordinal and timestamp must be positive
+func (selector *VersionSelector) Validate() error {
+	switch selector.Kind {
+	case VersionByOrdinal, VersionByTimestamp:
+		if selector.Value == 0 {
+			return errors.New(string(selector.Kind) + " of version must be positive")
+		}
+	case VersionLatest:
+		if selector.Value != 0 {
+			return errors.New("latest version does not take a value")
+		}
+	default:
+		return errors.New("unknown kind of version: " + string(selector.Kind))
+	}
+	return nil
+}
+
+// VersionRes is a version of file resolved from VersionSelector
+type VersionRes struct {
+	AfterPath string
+	Version   int    // 1-based ordinal in history of file, 0 when version is stored without history record
+	Versions  int    // the number of recorded versions of file
+	Timestamp uint64 // timestamp to download the version with
+}
+
+// FileDigestRes is what a version of file is expected to be when downloaded, so that a local copy is verified without contents
+type FileDigestRes struct {
+	AfterPath   string
+	Timestamp   uint64
+	ContentHash string // merkle root of contents (utils.MakeContentHashFromFile of downloaded file)
+	Size        int64
+	Encryption  Encryption // contents are ciphertext of client-side encryption unless zero value
+
+	// ChunkHashes are hex hashes of chunks of ChunkSize bytes of contents in order (leaves of merkle tree of ContentHash),
+	// only when requested (chunks=true), so that downloaded contents are verified chunk by chunk as they arrive
+	ChunkSize   int64    `json:",omitempty"`
+	ChunkHashes []string `json:",omitempty"`
+}
+
+// ProvisionEntry associates client of UUID with alias, ip and root directories (e.g., a row of qis client provision --file)
+type ProvisionEntry struct {
+	UUID     string
+	Alias    string
+	Ip       string
+	RootDirs []string // afterPath of registered root directories
+}
+
+// ProvisionRes is used to report result of each provisioned entry
+// nothing is applied when any entry is invalid or DryRun is true
+type ProvisionRes struct {
+	DryRun  bool
+	Applied bool
+	Results []ProvisionResult
+}
+
+type ProvisionResult struct {
+	Row    int // index of entry starting from 1
+	UUID   string
+	Status string // ProvisionCreated, ProvisionUpdated or ProvisionInvalid
+	Error  string
+}
+
+const (
+	ProvisionCreated = "created"
+	ProvisionUpdated = "updated"
+	ProvisionInvalid = "invalid"
+)
+
+// StreamStats is used to report stream usage of a quics-protocol connection
+type StreamStats struct {
+	Address  string
+	Active   int    // transactions in progress
+	Rejected uint64 // transactions rejected by the limit
+}
+
+// HandshakeStats is used to report registrations which new quics-protocol connections started with
+type HandshakeStats struct {
+	Accepted         uint64
+	Rejected         uint64            // connections closed because their registration failed
+	RejectedByReason map[string]uint64 // e.g., auth, timeout
+}
+
+// states of server reported by health endpoint
+const (
+	HealthStarting = "starting" // startup checks have not passed yet, so listeners are not bound
+	HealthReady    = "ready"
+	HealthDegraded = "degraded" // a check failed after startup (server keeps serving, but new protocol listener is refused)
+)
+
+// checks of server health run on startup and every HEALTH_CHECK_INTERVAL (HEALTH_CHECKS selects them)
+const (
+	HealthCheckDatabase = "database" // database is open and readable
+	HealthCheckDataDir  = "data-dir" // data directory and directory of synced contents are writable
+	HealthCheckTLS      = "tls"      // certificate of rest server is loadable, matches its key and is not expired
+	HealthCheckRecovery = "recovery" // no crash recovery (e.g., interrupted remove --all) is left pending
+	HealthCheckProtocol = "protocol" // quics protocol listener has not died (passes before it is started)
+)
+
+// HealthChecks is every check in the order they are run
+var HealthChecks = []string{HealthCheckDatabase, HealthCheckDataDir, HealthCheckTLS, HealthCheckRecovery, HealthCheckProtocol}
+
+// HealthRes is used to report state of the server and result of each check
+type HealthRes struct {
+	State     string
+	SafeMode  bool      // background mutators are disabled and writes are rejected (qis start --safe-mode)
+	CheckedAt time.Time // zero until checks are run for the first time
+	Checks    []HealthCheck
+}
+
+// HealthCheck is result of one check of server health
+type HealthCheck struct {
+	Name  string
+	OK    bool
+	Error string
+}
+
+// MetricsRes is used to report resource usage of the server
+type MetricsRes struct {
+	StartedAt         time.Time     // when server was started
+	Uptime            time.Duration // measured by server clock, so that it is not skewed by clock of client
+	MaxStreamsPerConn int
+	Connections       []StreamStats
+	Handshakes        HandshakeStats
+	Events            EventStats
+	Disk              DiskStats
+	TransfersInFlight int64 // contents being received from or sent to clients, uploaded or downloaded through rest api
+	DB                DBSizeStats
+	Logs              LogStats
+}
+
+// DBSizeStats is used to report bytes of database files measured by listing them (see DBStatsRes for garbage)
+type DBSizeStats struct {
+	LSMSize      int64  // bytes of sst files
+	ValueLogSize int64  // bytes of sealed value log files (the newest one being written is not counted)
+	CheckErr     string // error of measuring files
+}
+
+// LogStats is used to report errors and alerts among recent server logs kept in memory
+type LogStats struct {
+	Lines     int // the number of recent lines counted (at most logs.RingSize)
+	Errors    int
+	Alerts    int
+	LastError string
+}
+
+// DiskStats is used to report free space of volume which data directory is on
+type DiskStats struct {
+	Free     uint64 // bytes available to server
+	Total    uint64
+	LowSpace uint64 // free bytes below which low space is alerted (DISK_LOW_SPACE; 0: never)
+	IsLow    bool
+	ReadOnly bool   // writes are rejected since disk became full (DISK_FULL_READ_ONLY), until free space is above LowSpace
+	LastFull string // date when write was last aborted for disk full (empty: never)
+	CheckErr string // error of reading free space (e.g., unsupported file system)
+}
+
+// Page is used as envelope of list responses
+// NextCursor holds position and key of last item, so that next page can be read by seeking the key
+// Total is counted only when it is requested (see PageReq.CountTotal), since it takes scan of every entry
+type Page[T any] struct {
+	Items      []T     `json:"items"`
+	Total      *uint64 `json:"total,omitempty"`
+	Limit      uint64  `json:"limit"`
+	Offset     uint64  `json:"offset"`
+	NextOffset *uint64 `json:"nextOffset"`
+	NextCursor string  `json:"nextCursor,omitempty"`
+}
+
+// PageReq is used to request a page of list
+type PageReq struct {
+	Limit      uint64
+	Offset     uint64
+	Cursor     string
+	CountTotal bool // count every entry of list as Total of page
+
+	// Context cancels scan of the page when it is done (e.g., client disconnected); nil never cancels
+	Context context.Context `json:"-"`
+}
+
+// Err returns error of Context once it is done (nil while scan can go on)
+func (request *PageReq) Err() error {
+	if request.Context == nil {
+		return nil
+	}
+
+	return request.Context.Err()
+}
+
+// LogFilter narrows listings of logs endpoints (clients, directories, files, histories), and every set filter must match
+// lookup of the endpoint (e.g., uuid of client, afterPath or glob pattern of file, commit of histories) selects candidates first,
+// then Prefix narrows range of keys to scan when there is no lookup, and the other filters are applied to each candidate while iterating
+type LogFilter struct {
+	Owner    string            // owner of root directory which entry belongs to
+	Prefix   string            // after path prefix (directory itself and everything under it)
+	UUID     string            // client which attached (directories), edited latest version (files) or synced the version (histories)
+	Since    time.Time         // modification time (files) or date (histories) is at or after it
+	Until    time.Time         // modification time (files) or date (histories) is before it
+	MinSize  int64             // size of contents in bytes is at least it (files and histories)
+	MaxSize  int64             // size of contents in bytes is at most it (0: no upper limit)
+	Tags     map[string]string // file has every tag of them (files)
+	Metadata map[string]any    // custom metadata of file has every top-level field of it with equal value (files)
+}
+
+// IsEmpty checks whether no filter is set (nil filter is empty as well)
+func (f *LogFilter) IsEmpty() bool {
+	return f == nil || f.Owner == "" && f.Prefix == "" && f.UUID == "" && f.Since.IsZero() && f.Until.IsZero() &&
+		f.MinSize == 0 && f.MaxSize == 0 && len(f.Tags) == 0 && len(f.Metadata) == 0
+}
+
+// NewSinglePage wraps one item as a page
+func NewSinglePage[T any](item T) *Page[T] {
+	total := uint64(1)
+	return &Page[T]{
+		Items: []T{item},
+		Total: &total,
+		Limit: 1,
+	}
+}
+
+// NewPageFromItems makes a page from items which are already filtered in memory
+func NewPageFromItems[T any](items []T, request *PageReq) *Page[T] {
+	// items are already in memory, so total is counted without being requested
+	total := uint64(len(items))
+	page := &Page[T]{
+		Items:  []T{},
+		Total:  &total,
+		Limit:  request.Limit,
+		Offset: request.Offset,
+	}
+	if request.Offset >= total {
+		return page
+	}
+
+	end := total
+	if request.Limit != 0 && request.Offset+request.Limit < total {
+		end = request.Offset + request.Limit
+		page.NextOffset = &end
+	}
+	page.Items = items[request.Offset:end]
+
+	return page
+}
@@ -8,16 +8,19 @@ package types
 import (
 	"bytes"
 	"encoding/gob"
+	"encoding/json"
 	"io"
 	"log"
 	"os"
+	"sort"
 	"time"
 
 	"github.com/quic-s/quics-protocol/pkg/types/fileinfo"
+	"golang.org/x/exp/slices"
 )
 
 type DatabaseDataTypes interface {
-	Client | RootDirectory | File | FileHistory | FileMetadata | Sharing
+	Client | RootDirectory | File | FileHistory | FileMetadata | Sharing | PendingChanges
 }
 
 type DatabaseData[T DatabaseDataTypes] interface {
@@ -25,16 +28,165 @@ type DatabaseData[T DatabaseDataTypes] interface {
 	Decode(data []byte) error
 }
 
+const (
+	TransportQUIC = "quic"
+)
+
 type Server struct {
-	Password string
+	Password     string // plain password recorded by older version (read on start before PASSWORD of qis.env when it is set)
+	PasswordHash string // salted hash of password set by the last change, which current password is verified against
+}
+
+// BulkOperation is recorded while bulk removal (e.g., remove --all) is running,
+// so that the operation interrupted by crash is resumed on next startup
+// each operation is recorded by its ID, so that record of failed operation is not overwritten by the next one
+type BulkOperation struct {
+	ID        string // key, which is ordered by start time (empty for the record of older version)
+	Kind      string // BulkRemoveClients, BulkRemoveDirectories or BulkRemoveFiles
+	AfterPath string // directory of removed files (empty means all files)
+	Purge     bool   // stored contents and histories of removed files are deleted as well
+	StartedAt string
+}
+
+const (
+	BulkRemoveClients     = "remove-clients"
+	BulkRemoveDirectories = "remove-directories"
+	BulkRemoveFiles       = "remove-files"
+
+	// BulkRemoveOrphanedFiles runs one at a time with the others, but it is not recorded, because orphaned files are found again on retry
+	BulkRemoveOrphanedFiles = "remove-orphaned-files"
+)
+
+// CommitSet groups uploads of several files, so that new versions of all members are committed at once (or none of them)
+// members are staged in commit directory until the set is committed or aborted
+type CommitSet struct {
+	ID          string // key
+	Name        string
+	Status      string // CommitSetOpen or CommitSetCommitted
+	CreatedAt   string
+	CommittedAt string
+	Members     []CommitMember
+}
+
+// CommitMember is a file staged in commit set
+type CommitMember struct {
+	AfterPath string
+	Size      int64
+	Timestamp uint64 // timestamp of committed version (0 until the set is committed)
+}
+
+const (
+	CommitSetOpen      = "open"
+	CommitSetCommitted = "committed"
+)
+
+// RuntimeState is state kept only in memory while server is running,
+// which is saved on shutdown and restored on next startup so that restart does not lose it
+type RuntimeState struct {
+	SavedAt         string
+	LastHistoryDate time.Time // latest date stamped by server clock, so that dates of histories do not go backwards across restart
+	RecentLogs      []string  // recent server logs shown by qis server logs
+}
+
+// DBMaintenance records when maintenance of database was last run (zero: never)
+type DBMaintenance struct {
+	LastCompaction time.Time
+	LastValueLogGC time.Time
 }
 
 // Client is used to save connected client information
 type Client struct {
-	UUID string // key
-	Id   uint64
-	Ip   string
-	Root []RootDirectory
+	UUID      string // key
+	Id        uint64
+	Alias     string // name given by operator (e.g., qis client provision)
+	Ip        string
+	Root      []RootDirectory
+	Transport string // transport which client is connected with (e.g., quic)
+
+	// path prefixes which client subscribes to (e.g., /rootDir/sub)
+	// root directory without any subscription is synced entirely
+	Subscriptions []string
+
+	// transfers with client are paced by time of day (zero value: never limited)
+	Schedule BandwidthSchedule
+
+	// features of transfers negotiated on last registration (nil: client did not advertise them, so it is served as before)
+	Capabilities *Capabilities
+}
+
+// CompressionGzip is codec which contents can be compressed with in transfer to client
+const (
+	CompressionGzip = "gzip"
+)
+
+// ExtensionAppend and ExtensionManifestScan are protocol extensions which client can support
+const (
+	ExtensionAppend       = "append"        // client sends only appended bytes of contents when server offers base version
+	ExtensionManifestScan = "manifest-scan" // client answers MANIFESTSCAN of fullscan with its merkle manifest
+)
+
+// Capabilities are features of transfers advertised by client on registration, and the ones both client and server support
+// after negotiation (most preferred first), so that server uses only what each client can handle
+type Capabilities struct {
+	Compression []string // codecs of contents in transfer (CompressionGzip)
+	Encryption  []string // schemes of client-side encryption client can decrypt (EncryptionAES256GCM, EncryptionXChaCha20Poly1305)
+	Extensions  []string // protocol extensions (ExtensionAppend, ExtensionManifestScan)
+}
+
+// SupportsEncryption checks whether client can decrypt contents encrypted by scheme
+// (client which did not advertise capabilities is assumed to, as before negotiation)
+func (capabilities *Capabilities) SupportsEncryption(scheme string) bool {
+	return capabilities == nil || slices.Contains(capabilities.Encryption, scheme)
+}
+
+// SupportsExtension checks whether client supports protocol extension
+// (client which did not advertise capabilities is assumed to, as before negotiation)
+func (capabilities *Capabilities) SupportsExtension(extension string) bool {
+	return capabilities == nil || slices.Contains(capabilities.Extensions, extension)
+}
+
+// PickCompression returns the most preferred codec of contents in transfer to client (empty: contents are sent as they are)
+// client which did not advertise capabilities never receives compressed contents
+func (capabilities *Capabilities) PickCompression() string {
+	if capabilities == nil || len(capabilities.Compression) == 0 {
+		return ""
+	}
+	return capabilities.Compression[0]
+}
+
+// BandwidthSchedule limits bytes per second of transfers with client by time of day of server clock
+type BandwidthSchedule struct {
+	Windows []BandwidthWindow // the first window containing the time is applied
+	Else    uint64            // limit outside every window (0: unlimited)
+}
+
+// BandwidthWindow limits transfers to Limit bytes per second (0: unlimited) from Start until End minutes after midnight
+// window whose End is not after Start crosses midnight (e.g., 22:00-06:00)
+type BandwidthWindow struct {
+	Start int
+	End   int
+	Limit uint64
+}
+
+// LimitAt returns bytes per second allowed at t (0: unlimited)
+func (schedule *BandwidthSchedule) LimitAt(t time.Time) uint64 {
+	minute := t.Hour()*60 + t.Minute()
+	for _, window := range schedule.Windows {
+		if window.Contains(minute) {
+			return window.Limit
+		}
+	}
+
+	return schedule.Else
+}
+
+// Contains checks whether minute after midnight is in the window
+func (window *BandwidthWindow) Contains(minute int) bool {
+	if window.Start < window.End {
+		return window.Start <= minute && minute < window.End
+	}
+
+	return window.Start <= minute || minute < window.End
 }
 
 // RootDirectory is used when registering root directory to client
@@ -44,31 +196,124 @@ type RootDirectory struct {
 	Owner      string
 	Password   string
 	UUIDs      []string
+	AppendOnly bool // only new files can be synced (existing files can not be modified or deleted)
+
+	VersioningPolicies []VersioningPolicy // the first matched policy is applied (otherwise, full history is kept)
+	Policies           []SyncPolicy       // override server-wide extension defaults of files in this directory
+}
+
+const (
+	VersioningFull   = "full"   // keep every history
+	VersioningLatest = "latest" // keep only the latest history
+)
+
+// VersioningPolicy decides how many histories are kept for the files matched with pattern
+type VersioningPolicy struct {
+	Pattern string // extension (e.g., .mp4) or MIME type (e.g., video/mp4, video/*)
+	Mode    string // VersioningFull or VersioningLatest
+}
+
+// SyncPolicy sets sync behaviors of files matched with pattern
+// behaviors which the first matched policy does not mention are decided by the next level (directory > extension default > global default)
+type SyncPolicy struct {
+	Pattern   string   // extension (e.g., .tmp) or MIME type (e.g., video/mp4, video/*)
+	Behaviors []string // e.g., PolicyIgnore, PolicyNoVersioning
 }
 
+const (
+	PolicyIgnore             = "ignore"               // file is neither stored nor pushed to clients
+	PolicyStoreContentOnly   = "store-content-only"   // contents are stored but not pushed to other clients
+	PolicyNoVersioning       = "no-versioning"        // keep only the latest history (same as versioning latest)
+	PolicyCompressOnTransfer = "compress-on-transfer" // contents are gzip compressed when downloaded over rest api or pushed to client which negotiated gzip
+	PolicySync               = "sync"                 // every behavior of global default (e.g., to override extension default in directory)
+)
+
 // File is used to store the file's information
 type File struct {
 	AfterPath           string // key
 	BeforePath          string
 	RootDirKey          string
 	LatestHash          string
+	ContentHash         string // merkle root of latest contents (empty when contents are not received yet)
 	LatestSyncTimestamp uint64
 	LatestEditClient    string
 	ContentsExisted     bool
 	NeedForceSync       bool
 	Conflict            Conflict
+	Lock                FileLock          // advisory lock for cooperative editing
+	Tags                map[string]string // user labels to group files regardless of path (e.g., env=prod)
+	NoHistory           bool              // keep only the latest history of this file regardless of policies (e.g., caches, large binaries)
 	Metadata            FileMetadata
+	CustomMetadata      json.RawMessage // application defined attributes as compact JSON object (nil: none, see utils.ParseFileMetadata)
+	Encryption          Encryption      // client-side encryption of latest contents (zero value: plaintext)
+}
+
+// FileLock is advisory lock of file; sync of other clients is rejected while lock is active
+type FileLock struct {
+	Holder     string    // UUID of client holding the lock
+	AcquiredAt time.Time // when holder acquired the lock (kept while holder renews it)
+	ExpiresAt  time.Time // lock is released automatically after this time (to avoid deadlock from crashed client)
+}
+
+// IsActive checks whether lock is held and not expired yet
+func (lock *FileLock) IsActive(now time.Time) bool {
+	return lock.Holder != "" && now.Before(lock.ExpiresAt)
+}
+
+// IsHeldByOther checks whether active lock is held by another client than uuid
+func (lock *FileLock) IsHeldByOther(uuid string, now time.Time) bool {
+	return lock.IsActive(now) && lock.Holder != uuid
 }
 
 // FileHistory is used to store the file's history
 type FileHistory struct {
-	AfterPath  string // key
-	BeforePath string
-	Date       string
-	UUID       string
-	Timestamp  uint64
-	Hash       string
-	File       FileMetadata // must have file metadata at the point that client wanted in time
+	AfterPath   string // key
+	BeforePath  string
+	Date        string
+	UUID        string
+	Timestamp   uint64
+	Hash        string
+	ContentHash string       // merkle root of contents
+	File        FileMetadata // must have file metadata at the point that client wanted in time
+	CommitID    string       // commit set which this version was committed with (empty if uploaded alone)
+	ClientDate  string       // time reported by client (modification time of file), kept for reference
+	Encryption  Encryption   // client-side encryption of contents of this version (zero value: plaintext)
+	MovedFrom   string       // after path which file was moved (renamed) from by this version (empty if not moved)
+
+	// ContentLeaves are hashes of chunks of contents (leaves of merkle tree of ContentHash),
+	// kept so that contents appended to this version are hashed without reading this version again
+	ContentLeaves [][]byte `json:"-"`
+}
+
+// TimestampSourceServer and TimestampSourceClient select which clock stamps Date of new histories (TIMESTAMP_SOURCE)
+const (
+	TimestampSourceServer = "server"
+	TimestampSourceClient = "client"
+)
+
+// RegistrationAuthPassword and RegistrationAuthProof select credential which client must register with (REGISTRATION_AUTH)
+// password accepts either password or password proof, and proof accepts only password proof (password is never sent)
+const (
+	RegistrationAuthPassword = "password"
+	RegistrationAuthProof    = "proof"
+)
+
+// EncryptionAES256GCM and EncryptionXChaCha20Poly1305 are schemes which clients can encrypt contents with
+const (
+	EncryptionAES256GCM         = "aes-256-gcm"
+	EncryptionXChaCha20Poly1305 = "xchacha20-poly1305"
+)
+
+// Encryption describes contents encrypted by client before upload with a key which server never has
+// server stores and serves ciphertext as is, so hashes of contents (and dedup by them) are of ciphertext
+type Encryption struct {
+	Scheme string // EncryptionAES256GCM or EncryptionXChaCha20Poly1305 (empty: contents are plaintext)
+	Nonce  string // base64 encoded nonce used to encrypt the contents
+}
+
+// IsEncrypted checks whether contents are encrypted by client
+func (encryption *Encryption) IsEncrypted() bool {
+	return encryption.Scheme != ""
 }
 
 // FileMetadata retains file contents at last sync timestamp
@@ -79,6 +324,30 @@ type Conflict struct {
 	StagingFiles map[string]FileHistory
 }
 
+// PendingChanges is used to store changed paths which could not be pushed to offline client
+// FullResync is set instead of AfterPaths when too many changes are queued, so that client is fully scanned on reconnect
+type PendingChanges struct {
+	UUID       string // key
+	AfterPaths []string
+	FullResync bool
+}
+
+// TransferUpload and TransferDownload are directions of transfer seen from server
+const (
+	TransferUpload   = "upload"
+	TransferDownload = "download"
+)
+
+// Transfer is recorded whenever contents of a file are completely received from or sent to client, so that throughput can be reported
+type Transfer struct {
+	Date      time.Time // time when transfer completed (key, with AfterPath)
+	Direction string    // TransferUpload or TransferDownload
+	UUID      string    // client UUID (empty for rest api)
+	AfterPath string
+	Size      int64 // bytes of contents transferred
+	Duration  time.Duration
+}
+
 // Sharing is used to store the file download information
 type Sharing struct {
 	Link     string // key
@@ -104,7 +373,73 @@ func (server *Server) Decode(data []byte) error {
 	return decoder.Decode(server)
 }
 
+func (operation *BulkOperation) Encode() []byte {
+	buffer := bytes.Buffer{}
+	encoder := gob.NewEncoder(&buffer)
+	if err := encoder.Encode(operation); err != nil {
+		log.Println("quics: (BulkOperation.Encode) ", err)
+	}
+
+	return buffer.Bytes()
+}
+
+func (operation *BulkOperation) Decode(data []byte) error {
+	buffer := bytes.NewBuffer(data)
+	decoder := gob.NewDecoder(buffer)
+	return decoder.Decode(operation)
+}
+
+func (commitSet *CommitSet) Encode() []byte {
+	buffer := bytes.Buffer{}
+	encoder := gob.NewEncoder(&buffer)
+	if err := encoder.Encode(commitSet); err != nil {
+		log.Println("quics: (CommitSet.Encode) ", err)
+	}
+
+	return buffer.Bytes()
+}
+
+func (commitSet *CommitSet) Decode(data []byte) error {
+	buffer := bytes.NewBuffer(data)
+	decoder := gob.NewDecoder(buffer)
+	return decoder.Decode(commitSet)
+}
+
+func (state *RuntimeState) Encode() []byte {
+	buffer := bytes.Buffer{}
+	encoder := gob.NewEncoder(&buffer)
+	if err := encoder.Encode(state); err != nil {
+		log.Println("quics: (RuntimeState.Encode) ", err)
+	}
+
+	return buffer.Bytes()
+}
+
+func (state *RuntimeState) Decode(data []byte) error {
+	buffer := bytes.NewBuffer(data)
+	decoder := gob.NewDecoder(buffer)
+	return decoder.Decode(state)
+}
+
+func (maintenance *DBMaintenance) Encode() []byte {
+	buffer := bytes.Buffer{}
+	encoder := gob.NewEncoder(&buffer)
+	if err := encoder.Encode(maintenance); err != nil {
+		log.Println("quics: (DBMaintenance.Encode) ", err)
+	}
+
+	return buffer.Bytes()
+}
+
+func (maintenance *DBMaintenance) Decode(data []byte) error {
+	buffer := bytes.NewBuffer(data)
+	decoder := gob.NewDecoder(buffer)
+	return decoder.Decode(maintenance)
+}
+
 func (client *Client) Encode() []byte {
+	client.Normalize()
+
 	buffer := bytes.Buffer{}
 	encoder := gob.NewEncoder(&buffer)
 	if err := encoder.Encode(client); err != nil {
@@ -121,6 +456,8 @@ func (client *Client) Decode(data []byte) error {
 }
 
 func (rootDirectory *RootDirectory) Encode() []byte {
+	rootDirectory.Normalize()
+
 	buffer := bytes.Buffer{}
 	encoder := gob.NewEncoder(&buffer)
 	if err := encoder.Encode(rootDirectory); err != nil {
@@ -136,6 +473,48 @@ func (rootDirectory *RootDirectory) Decode(data []byte) error {
 	return decoder.Decode(rootDirectory)
 }
 
+// Normalize removes duplicated root directories of client keeping the last registered one and sorts them by afterPath,
+// so that client is stored the same however many times (and in whatever order) root directories are registered
+func (client *Client) Normalize() {
+	seen := map[string]bool{}
+	roots := []RootDirectory{}
+	for i := len(client.Root) - 1; i >= 0; i-- {
+		if seen[client.Root[i].AfterPath] {
+			continue
+		}
+		seen[client.Root[i].AfterPath] = true
+
+		root := client.Root[i]
+		root.Normalize()
+		roots = append(roots, root)
+	}
+	sort.Slice(roots, func(i, j int) bool {
+		return roots[i].AfterPath < roots[j].AfterPath
+	})
+
+	if client.Root != nil {
+		client.Root = roots
+	}
+}
+
+// Normalize removes duplicated UUIDs of root directory and sorts them
+func (rootDirectory *RootDirectory) Normalize() {
+	seen := map[string]bool{}
+	uuids := []string{}
+	for _, uuid := range rootDirectory.UUIDs {
+		if seen[uuid] {
+			continue
+		}
+		seen[uuid] = true
+		uuids = append(uuids, uuid)
+	}
+	sort.Strings(uuids)
+
+	if rootDirectory.UUIDs != nil {
+		rootDirectory.UUIDs = uuids
+	}
+}
+
 func (file *File) Encode() []byte {
 	buffer := bytes.Buffer{}
 	encoder := gob.NewEncoder(&buffer)
@@ -195,6 +574,11 @@ func (fileMetadata *FileMetadata) Decode(data []byte) error {
 }
 
 func (f *FileMetadata) WriteFileWithInfo(filePath string, fileContent io.Reader) error {
+	// zero-byte file can come without reader of its contents, and it is written as empty file (not as missing contents)
+	if fileContent == nil && !f.IsDir && f.Size == 0 {
+		fileContent = bytes.NewReader(nil)
+	}
+
 	info := fileinfo.FileInfo(*f)
 	err := info.WriteFileWithInfo(filePath, fileContent)
 	if err != nil {
@@ -253,6 +637,22 @@ func (fileMetadata *FileMetadata) WriteToFile(path string) error {
 	return nil
 }
 
+func (transfer *Transfer) Encode() []byte {
+	buffer := bytes.Buffer{}
+	encoder := gob.NewEncoder(&buffer)
+	if err := encoder.Encode(transfer); err != nil {
+		log.Println("quics: (Transfer.Encode) ", err)
+	}
+
+	return buffer.Bytes()
+}
+
+func (transfer *Transfer) Decode(data []byte) error {
+	buffer := bytes.NewBuffer(data)
+	decoder := gob.NewDecoder(buffer)
+	return decoder.Decode(transfer)
+}
+
 func (sharing *Sharing) Encode() []byte {
 	buffer := bytes.Buffer{}
 	encoder := gob.NewEncoder(&buffer)
@@ -269,6 +669,22 @@ func (sharing *Sharing) Decode(data []byte) error {
 	return decoder.Decode(sharing)
 }
 
+func (pendingChanges *PendingChanges) Encode() []byte {
+	buffer := bytes.Buffer{}
+	encoder := gob.NewEncoder(&buffer)
+	if err := encoder.Encode(pendingChanges); err != nil {
+		log.Println("quics: (PendingChanges.Encode) ", err)
+	}
+
+	return buffer.Bytes()
+}
+
+func (pendingChanges *PendingChanges) Decode(data []byte) error {
+	buffer := bytes.NewBuffer(data)
+	decoder := gob.NewDecoder(buffer)
+	return decoder.Decode(pendingChanges)
+}
+
 func (c *Conflict) Encode() []byte {
 	buffer := bytes.Buffer{}
 	encoder := gob.NewEncoder(&buffer)
@@ -0,0 +1,46 @@
+package types
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWriteFileWithInfoZeroByte(t *testing.T) {
+	tests := []struct {
+		name        string
+		size        int64
+		fileContent io.Reader
+		wantErr     bool
+	}{
+		{name: "zero-byte file without reader", size: 0, fileContent: nil},
+		{name: "zero-byte file with empty reader", size: 0, fileContent: bytes.NewReader(nil)},
+		{name: "contents shorter than size", size: 5, fileContent: bytes.NewReader(nil), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath := filepath.Join(t.TempDir(), "sub", "empty")
+			fileMetadata := &FileMetadata{Name: "empty", Size: tt.size, Mode: 0644, ModTime: time.Now()}
+
+			err := fileMetadata.WriteFileWithInfo(filePath, tt.fileContent)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("WriteFileWithInfo() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			info, err := os.Stat(filePath)
+			if err != nil {
+				t.Fatalf("zero-byte file is not written: %v", err)
+			}
+			if !info.Mode().IsRegular() || info.Size() != 0 {
+				t.Errorf("written file is %s of %d bytes, want empty regular file", info.Mode(), info.Size())
+			}
+		})
+	}
+}
@@ -21,6 +21,7 @@ const (
 	CONFLICTDOWNLOAD  = "CONFLICTDOWNLOAD"
 	CHOOSEONE         = "CHOOSEONE"
 	FULLSCAN          = "FULLSCAN"
+	MANIFESTSCAN      = "MANIFESTSCAN"
 	RESCAN            = "RESCAN"
 	NEEDCONTENT       = "NEEDCONTENT"
 	PING              = "PING"
@@ -41,10 +42,22 @@ type MessageData interface {
 type ClientRegisterReq struct {
 	UUID           string // client
 	ClientPassword string // client
+	PasswordProof  string // client (instead of ClientPassword, made by utils.MakeRegistrationProof)
+
+	// BandwidthSchedule is declared by client (e.g., 00:00-06:00:unlimited,else:1MB; see utils.ParseBandwidthSchedule)
+	// empty keeps schedule which is already set
+	BandwidthSchedule string
+
+	// Capabilities are features of transfers client supports (nil: client is served as before negotiation)
+	Capabilities *Capabilities
 }
 
 type ClientRegisterRes struct {
 	UUID string // client
+
+	// Capabilities are features of transfers supported by both client and server, which server uses with client
+	// (nil when client did not advertise them)
+	Capabilities *Capabilities
 }
 
 // ClientDisconnectorReq is used when disconnecting client with server from client to server
@@ -125,12 +138,31 @@ type PleaseSyncRes struct {
 	UUID      string
 	AfterPath string
 	Status    string
+
+	// SyncToken is consistency token of the version accepted for sync (see utils.MakeSyncToken),
+	// which client passes as If-Synced-To to read the version after sending its contents
+	SyncToken string
+
+	// AppendBase* describe previous version stored in server (0 timestamp: whole contents must be sent)
+	// when new contents only append bytes to it, client can send the appended bytes with PleaseTakeReq.AppendBase*
+	AppendBaseTimestamp uint64
+	AppendBaseHash      string
+	AppendBaseSize      int64
 }
 
 // PleaseTakeReq is used when client synchronize file to server
+// contents are bytes appended to version of AppendBaseTimestamp when it is not 0 (otherwise whole contents)
 type PleaseTakeReq struct {
-	UUID      string
-	AfterPath string
+	UUID                string
+	AfterPath           string
+	AppendBaseTimestamp uint64
+	AppendBaseHash      string
+
+	// Encryption is set when contents are encrypted by client (server stores them as ciphertext)
+	Encryption Encryption
+
+	// Urgent contents are received at full speed even during throttled window of bandwidth schedule of client
+	Urgent bool
 }
 
 // PleaseTakeRes is used to response to client of whether file is synchronized or not
@@ -145,6 +177,8 @@ type MustSyncReq struct {
 	LatestSyncTimestamp uint64
 	BeforePath          string
 	AfterPath           string
+	Encryption          Encryption // client decrypts contents by this when they are encrypted
+	Compression         string     // codec which contents sent with this request (FORCESYNC) are compressed with (empty: as they are)
 }
 
 // MustSyncRes is used to response to server that client will synchronize file
@@ -157,8 +191,9 @@ type MustSyncRes struct {
 
 // GiveYouReq is used when sending file to client
 type GiveYouReq struct {
-	UUID      string
-	AfterPath string
+	UUID        string
+	AfterPath   string
+	Compression string // codec which contents sent with this request are compressed with (empty: as they are)
 }
 
 // GiveYouRes is used to response to server that client received file
@@ -200,6 +235,27 @@ type SyncMetadata struct { // Per file
 	LastSyncHash        string
 }
 
+// AskManifestReq asks client for nodes of merkle manifest of sync metadata of its files (see utils.Manifest)
+// "" is prefix of root node, and request without Prefixes ends MANIFESTSCAN transaction
+type AskManifestReq struct {
+	UUID     string
+	Prefixes []string
+}
+
+type AskManifestRes struct {
+	UUID  string
+	Nodes []ManifestNode // in the order of requested prefixes
+}
+
+// ManifestNode is node of merkle manifest identified by hex prefix of hash of after path
+// inner node has hashes of its children, and leaf node (bucket) has sync metadata of its files instead
+type ManifestNode struct {
+	Prefix   string
+	Hash     []byte
+	Children [][]byte
+	Entries  []SyncMetadata
+}
+
 type RescanReq struct {
 	UUID          string
 	RootAfterPath []string
@@ -740,6 +796,38 @@ func (askAllMetaRes *AskAllMetaRes) Decode(data []byte) error {
 	return decoder.Decode(askAllMetaRes)
 }
 
+func (askManifestReq *AskManifestReq) Encode() ([]byte, error) {
+	buffer := bytes.Buffer{}
+	encoder := gob.NewEncoder(&buffer)
+	if err := encoder.Encode(askManifestReq); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+func (askManifestReq *AskManifestReq) Decode(data []byte) error {
+	buffer := bytes.NewBuffer(data)
+	decoder := gob.NewDecoder(buffer)
+	return decoder.Decode(askManifestReq)
+}
+
+func (askManifestRes *AskManifestRes) Encode() ([]byte, error) {
+	buffer := bytes.Buffer{}
+	encoder := gob.NewEncoder(&buffer)
+	if err := encoder.Encode(askManifestRes); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+func (askManifestRes *AskManifestRes) Decode(data []byte) error {
+	buffer := bytes.NewBuffer(data)
+	decoder := gob.NewDecoder(buffer)
+	return decoder.Decode(askManifestRes)
+}
+
 func (rescanReq *RescanReq) Encode() ([]byte, error) {
 	buffer := bytes.Buffer{}
 	encoder := gob.NewEncoder(&buffer)
@@ -0,0 +1,247 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/quic-s/quics/pkg/types"
+)
+
+// RateUnlimited is written instead of rate of window which is not limited
+const RateUnlimited = "unlimited"
+
+// throttleChunk is the maximum number of bytes read or written at once through Throttle,
+// so that bytes of slow rate are spread over time instead of sent in a burst
+const throttleChunk = 16 * 1024
+
+// rateUnits are suffixes of rates (bytes per second), checked in order
+var rateUnits = []struct {
+	suffix     string
+	multiplier uint64
+}{
+	{"GB", 1024 * 1024 * 1024},
+	{"MB", 1024 * 1024},
+	{"KB", 1024},
+	{"B", 1},
+}
+
+// ParseBandwidthSchedule parses comma separated windows of <HH:MM>-<HH:MM>:<rate> and else:<rate> for the rest of day
+// (e.g., "00:00-06:00:unlimited,else:1MB"); rate is bytes per second with optional B, KB, MB or GB (1024-based), or unlimited
+// empty schedule never limits
+func ParseBandwidthSchedule(schedule string) (*types.BandwidthSchedule, error) {
+	parsed := &types.BandwidthSchedule{Windows: []types.BandwidthWindow{}}
+	if strings.TrimSpace(schedule) == "" {
+		return parsed, nil
+	}
+
+	elseSet := false
+	for _, entry := range strings.Split(schedule, ",") {
+		entry = strings.TrimSpace(entry)
+		if rate, found := strings.CutPrefix(entry, "else:"); found {
+			if elseSet {
+				return nil, errors.New("else of bandwidth schedule is given more than once: " + schedule)
+			}
+			limit, err := ParseRate(rate)
+			if err != nil {
+				return nil, err
+			}
+			parsed.Else = limit
+			elseSet = true
+			continue
+		}
+
+		// 00:00-06:00:unlimited
+		start, rest, found := strings.Cut(entry, "-")
+		separator := strings.LastIndex(rest, ":")
+		if !found || separator == -1 {
+			return nil, errors.New("invalid bandwidth window (expected <HH:MM>-<HH:MM>:<rate> or else:<rate>): " + entry)
+		}
+		startMinute, err := parseMinuteOfDay(start)
+		if err != nil {
+			return nil, err
+		}
+		endMinute, err := parseMinuteOfDay(rest[:separator])
+		if err != nil {
+			return nil, err
+		}
+		limit, err := ParseRate(rest[separator+1:])
+		if err != nil {
+			return nil, err
+		}
+
+		parsed.Windows = append(parsed.Windows, types.BandwidthWindow{
+			Start: startMinute,
+			End:   endMinute,
+			Limit: limit,
+		})
+	}
+
+	return parsed, nil
+}
+
+// FormatBandwidthSchedule formats schedule in the same form as ParseBandwidthSchedule accepts
+func FormatBandwidthSchedule(schedule *types.BandwidthSchedule) string {
+	if len(schedule.Windows) == 0 && schedule.Else == 0 {
+		return ""
+	}
+
+	formatted := []string{}
+	for _, window := range schedule.Windows {
+		formatted = append(formatted, formatMinuteOfDay(window.Start)+"-"+formatMinuteOfDay(window.End)+":"+FormatRate(window.Limit))
+	}
+
+	return strings.Join(append(formatted, "else:"+FormatRate(schedule.Else)), ",")
+}
+
+// ParseRate parses bytes per second (e.g., 512KB, 1.5MB) or unlimited (0)
+func ParseRate(rate string) (uint64, error) {
+	rate = strings.TrimSpace(rate)
+	if strings.EqualFold(rate, RateUnlimited) {
+		return 0, nil
+	}
+
+	number, multiplier := strings.ToUpper(rate), uint64(1)
+	for _, unit := range rateUnits {
+		if trimmed, found := strings.CutSuffix(number, unit.suffix); found {
+			number, multiplier = trimmed, unit.multiplier
+			break
+		}
+	}
+
+	value, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+	if err != nil || value < 1 {
+		return 0, errors.New("invalid rate (expected bytes per second such as 512KB or 1MB, or " + RateUnlimited + "): " + rate)
+	}
+
+	return uint64(value * float64(multiplier)), nil
+}
+
+// FormatRate formats bytes per second with the largest unit dividing it (0: unlimited)
+func FormatRate(rate uint64) string {
+	if rate == 0 {
+		return RateUnlimited
+	}
+
+	for _, unit := range rateUnits {
+		if rate%unit.multiplier == 0 {
+			return strconv.FormatUint(rate/unit.multiplier, 10) + unit.suffix
+		}
+	}
+
+	return strconv.FormatUint(rate, 10) + "B"
+}
+
+// parseMinuteOfDay parses HH:MM into minutes after midnight (24:00 is the end of day)
+func parseMinuteOfDay(value string) (int, error) {
+	value = strings.TrimSpace(value)
+	if value == "24:00" {
+		return 24 * 60, nil
+	}
+
+	parsed, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, errors.New("invalid time of day (expected HH:MM): " + value)
+	}
+
+	return parsed.Hour()*60 + parsed.Minute(), nil
+}
+
+func formatMinuteOfDay(minute int) string {
+	return fmt.Sprintf("%02d:%02d", minute/60, minute%60)
+}
+
+// Throttle paces bytes of transfers sharing it (e.g., every transfer with a client) at the rate of its schedule at the time,
+// so that rate follows the schedule even during long transfer
+type Throttle struct {
+	mut      sync.Mutex
+	schedule types.BandwidthSchedule
+	next     time.Time // when bytes reserved so far are sent at the rate
+}
+
+func NewThrottle() *Throttle {
+	return &Throttle{}
+}
+
+// SetSchedule replaces schedule, which is applied from the next bytes
+func (t *Throttle) SetSchedule(schedule types.BandwidthSchedule) {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+
+	t.schedule = schedule
+}
+
+// Wait blocks until n bytes can be sent without exceeding rate of the schedule at the time
+func (t *Throttle) Wait(n int) {
+	t.mut.Lock()
+	now := time.Now()
+	limit := t.schedule.LimitAt(now)
+	if limit == 0 {
+		t.next = time.Time{}
+		t.mut.Unlock()
+		return
+	}
+
+	if t.next.Before(now) {
+		t.next = now
+	}
+	t.next = t.next.Add(time.Duration(float64(n) / float64(limit) * float64(time.Second)))
+	wait := t.next.Sub(now)
+	t.mut.Unlock()
+
+	time.Sleep(wait)
+}
+
+// Reader returns reader of r paced by t
+func (t *Throttle) Reader(r io.Reader) io.Reader {
+	return &throttledReader{reader: r, throttle: t}
+}
+
+// Writer returns writer to w paced by t
+func (t *Throttle) Writer(w io.Writer) io.Writer {
+	return &throttledWriter{writer: w, throttle: t}
+}
+
+type throttledReader struct {
+	reader   io.Reader
+	throttle *Throttle
+}
+
+func (tr *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > throttleChunk {
+		p = p[:throttleChunk]
+	}
+
+	n, err := tr.reader.Read(p)
+	tr.throttle.Wait(n)
+	return n, err
+}
+
+type throttledWriter struct {
+	writer   io.Writer
+	throttle *Throttle
+}
+
+func (tw *throttledWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > throttleChunk {
+			chunk = chunk[:throttleChunk]
+		}
+
+		tw.throttle.Wait(len(chunk))
+		n, err := tw.writer.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+
+	return written, nil
+}
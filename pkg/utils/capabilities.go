@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"strings"
+
+	"github.com/quic-s/quics/pkg/types"
+	"golang.org/x/exp/slices"
+)
+
+// ServerCapabilities returns features of transfers which server supports
+func ServerCapabilities() *types.Capabilities {
+	return &types.Capabilities{
+		Compression: []string{types.CompressionGzip},
+		Encryption:  []string{types.EncryptionAES256GCM, types.EncryptionXChaCha20Poly1305},
+		Extensions:  []string{types.ExtensionAppend, types.ExtensionManifestScan},
+	}
+}
+
+// NegotiateCapabilities returns features advertised by client which server supports as well, in order of preference of client
+// unknown features are dropped, so that newer client can advertise features which this server does not know (nil stays nil)
+func NegotiateCapabilities(advertised *types.Capabilities) *types.Capabilities {
+	if advertised == nil {
+		return nil
+	}
+
+	supported := ServerCapabilities()
+	return &types.Capabilities{
+		Compression: intersectCapabilities(advertised.Compression, supported.Compression),
+		Encryption:  intersectCapabilities(advertised.Encryption, supported.Encryption),
+		Extensions:  intersectCapabilities(advertised.Extensions, supported.Extensions),
+	}
+}
+
+func intersectCapabilities(advertised []string, supported []string) []string {
+	negotiated := []string{}
+	for _, feature := range advertised {
+		if slices.Contains(supported, feature) && !slices.Contains(negotiated, feature) {
+			negotiated = append(negotiated, feature)
+		}
+	}
+	return negotiated
+}
+
+// FormatCapabilities writes negotiated capabilities of client (e.g., compression=gzip encryption=aes-256-gcm extensions=append)
+// empty string is returned when client did not advertise them
+func FormatCapabilities(capabilities *types.Capabilities) string {
+	if capabilities == nil {
+		return ""
+	}
+
+	return "compression=" + formatCapabilityList(capabilities.Compression) +
+		" encryption=" + formatCapabilityList(capabilities.Encryption) +
+		" extensions=" + formatCapabilityList(capabilities.Extensions)
+}
+
+func formatCapabilityList(features []string) string {
+	if len(features) == 0 {
+		return "none"
+	}
+	return strings.Join(features, ",")
+}
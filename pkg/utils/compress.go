@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/quic-s/quics/pkg/types"
+)
+
+// CompressFile writes contents of srcPath compressed by codec into dstPath, keeping modification time of srcPath
+func CompressFile(srcPath string, dstPath string, codec string) error {
+	if codec != types.CompressionGzip {
+		return errors.New("unsupported compression codec: " + codec)
+	}
+
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	dst, err := os.OpenFile(dstPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	writer := gzip.NewWriter(dst)
+	_, err = io.Copy(writer, src)
+	if err == nil {
+		err = writer.Close()
+	}
+	closeErr := dst.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dstPath)
+		return err
+	}
+
+	return os.Chtimes(dstPath, info.ModTime(), info.ModTime())
+}
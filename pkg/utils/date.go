@@ -0,0 +1,16 @@
+package utils
+
+import (
+	"strings"
+	"time"
+)
+
+// ParseHistoryDate parses date of history which is saved by time.Time.String()
+func ParseHistoryDate(date string) (time.Time, error) {
+	// remove monotonic clock reading (e.g., m=+0.000000001)
+	if i := strings.Index(date, " m="); i != -1 {
+		date = date[:i]
+	}
+
+	return time.Parse("2006-01-02 15:04:05.999999999 -0700 MST", date)
+}
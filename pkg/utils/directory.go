@@ -17,44 +17,56 @@ func GetQuicsDirPath() string {
 	return filepath.Join(homeDir, ".quics")
 }
 
-// GetQuicsSyncDirPath $HOME/.quics/sync
-func GetQuicsSyncDirPath() string {
-	tempDir, err := os.UserHomeDir()
-	if err != nil {
-		log.Fatal(err)
-	}
+// dataDirPath is where badger database and synced contents are stored (empty: $HOME/.quics)
+var dataDirPath string
 
-	return filepath.Join(tempDir, ".quics", "sync")
+// SetQuicsDataDirPath changes data directory of the server
+func SetQuicsDataDirPath(path string) {
+	dataDirPath = path
 }
 
-// GetQuicsRootDirPath $HOME/.quics/sync/{rootDir}
-func GetQuicsRootDirPath(rootDir string) string {
-	tempDir, err := os.UserHomeDir()
-	if err != nil {
-		log.Fatal(err)
+// GetQuicsDataDirPath {dataDir} ($HOME/.quics by default)
+func GetQuicsDataDirPath() string {
+	if dataDirPath != "" {
+		return dataDirPath
 	}
 
-	return filepath.Join(tempDir, ".quics", "sync", rootDir)
+	return GetQuicsDirPath()
 }
 
-// GetQuicsHistoryPathByRootDir $HOME/.quics/sync/{rootDir}.history
-func GetQuicsHistoryPathByRootDir(rootDir string) string {
-	tempDir, err := os.UserHomeDir()
-	if err != nil {
-		log.Fatal(err)
-	}
+// GetAdminTokenPath $HOME/.quics/admin.token
+func GetAdminTokenPath() string {
+	return filepath.Join(GetQuicsDirPath(), "admin.token")
+}
 
-	return filepath.Join(tempDir, ".quics", "sync", rootDir+".history")
+// GetQuicsSyncDirPath {dataDir}/sync
+func GetQuicsSyncDirPath() string {
+	return filepath.Join(GetQuicsDataDirPath(), "sync")
 }
 
-// GetQuicsConflictPathByRootDir $HOME/.quics/sync/{rootDir}.conflict
+// GetQuicsRootDirPath {dataDir}/sync/{rootDir}
+func GetQuicsRootDirPath(rootDir string) string {
+	return filepath.Join(GetQuicsDataDirPath(), "sync", rootDir)
+}
+
+// GetQuicsHistoryPathByRootDir {dataDir}/sync/{rootDir}.history
+func GetQuicsHistoryPathByRootDir(rootDir string) string {
+	return filepath.Join(GetQuicsDataDirPath(), "sync", rootDir+".history")
+}
+
+// GetQuicsConflictPathByRootDir {dataDir}/sync/{rootDir}.conflict
 func GetQuicsConflictPathByRootDir(rootDir string) string {
-	tempDir, err := os.UserHomeDir()
-	if err != nil {
-		log.Fatal(err)
-	}
+	return filepath.Join(GetQuicsDataDirPath(), "sync", rootDir+".conflict")
+}
+
+// GetQuicsCommitDirPath {dataDir}/commits/{id} where members of open commit set are staged
+func GetQuicsCommitDirPath(id string) string {
+	return filepath.Join(GetQuicsDataDirPath(), "commits", id)
+}
 
-	return filepath.Join(tempDir, ".quics", "sync", rootDir+".conflict")
+// GetQuicsSpoolDirPath {dataDir}/spool where uploads larger than memory buffer are received before they are committed
+func GetQuicsSpoolDirPath() string {
+	return filepath.Join(GetQuicsDataDirPath(), "spool")
 }
 
 // ReadEnvFile reads .qis.env file if it is existed
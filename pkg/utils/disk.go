@@ -0,0 +1,33 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// IsDiskFull reports whether err is caused by volume having no space left (ENOSPC)
+// message is checked as well, because errors are often wrapped by their message (e.g., errors of repositories)
+func IsDiskFull(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, syscall.ENOSPC) {
+		return true
+	}
+
+	message := err.Error()
+	return strings.Contains(message, "no space left on device") || strings.Contains(message, "not enough space on the disk")
+}
+
+// CheckDirWritable creates and removes a temp file in dir to check that files can be written there
+func CheckDirWritable(dir string) error {
+	testFile, err := os.CreateTemp(dir, ".write-test-*")
+	if err != nil {
+		return err
+	}
+	testFile.Close()
+
+	return os.Remove(testFile.Name())
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+
+package utils
+
+import "syscall"
+
+// GetDiskSpace returns bytes available to unprivileged user and total bytes of volume which path is on
+func GetDiskSpace(path string) (uint64, uint64, error) {
+	stat := syscall.Statfs_t{}
+	err := syscall.Statfs(path, &stat)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// types of fields differ by platform (e.g., Bavail is int64 on freebsd)
+	return uint64(stat.Bavail) * uint64(stat.Bsize), uint64(stat.Blocks) * uint64(stat.Bsize), nil
+}
@@ -0,0 +1,21 @@
+//go:build windows
+
+package utils
+
+import "golang.org/x/sys/windows"
+
+// GetDiskSpace returns bytes available to the user and total bytes of volume which path is on
+func GetDiskSpace(path string) (uint64, uint64, error) {
+	pathPtr, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var free, total uint64
+	err = windows.GetDiskFreeSpaceEx(pathPtr, &free, &total, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return free, total, nil
+}
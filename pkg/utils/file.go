@@ -1,9 +1,15 @@
 package utils
 
 import (
+	"errors"
+	"fmt"
+	"mime"
+	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
+
+	"github.com/quic-s/quics/pkg/types"
 )
 
 // GetNamesByAfterPath extracts root directory name and file name from afterPath
@@ -33,8 +39,262 @@ func GetConflictFileNameByAfterPath(afterPath string, uuid string) string {
 
 func ExtractFileNameFromHistoryFile(historyFilePath string) string {
 	// e.g., fileName_timestamp
-	paths := strings.Split(historyFilePath, "/")
-	file := paths[len(paths)-1]
+	file := filepath.Base(historyFilePath)
 	fileNames := strings.Split(file, "_")
 	return fileNames[0]
 }
+
+// NormalizeAfterPath converts afterPath separated by \ (e.g., sent by windows client) to afterPath separated by /,
+// so that clients of every platform refer to the same stored path (e.g., \root\dir\a.txt is /root/dir/a.txt)
+// afterPath is converted back to separator of the platform with filepath.FromSlash when it is joined to local directory
+func NormalizeAfterPath(afterPath string) string {
+	return strings.ReplaceAll(afterPath, "\\", "/")
+}
+
+// ValidateAfterPath checks that afterPath is absolute path without empty, . or .. components (e.g., /root/../etc),
+// so that it can not point outside of directories of quics when it is joined to them
+func ValidateAfterPath(afterPath string) error {
+	if !strings.HasPrefix(afterPath, "/") || strings.ContainsAny(afterPath, "\\\x00") {
+		return errors.New("path must be absolute path separated by /: " + afterPath)
+	}
+
+	for _, name := range strings.Split(afterPath[1:], "/") {
+		if name == "" || name == "." || name == ".." {
+			return errors.New("path must not contain empty, . or .. components: " + afterPath)
+		}
+	}
+
+	return nil
+}
+
+// ValidateRootDirAfterPath checks root directory path (e.g., /rootDir) with ValidateAfterPath, and rejects name ending with suffix of
+// storage directories of root directory (e.g., /x.history), which would be mixed up with histories or conflicts of other root directory
+func ValidateRootDirAfterPath(afterPath string) error {
+	err := ValidateAfterPath(afterPath)
+	if err != nil {
+		return err
+	}
+
+	if strings.Contains(afterPath[1:], "/") {
+		return errors.New("path must be root directory path (e.g., /rootDir): " + afterPath)
+	}
+	if strings.HasSuffix(afterPath, ".history") || strings.HasSuffix(afterPath, ".conflict") {
+		return errors.New("name of root directory must not end with .history or .conflict: " + afterPath)
+	}
+
+	return nil
+}
+
+// ErrPathTooLong is returned when afterPath (or local path) is longer than the limit, or has a component longer than the limit
+var ErrPathTooLong = errors.New("PATH_TOO_LONG")
+
+// ErrPathTooDeep is returned when afterPath has more components than the limit
+var ErrPathTooDeep = errors.New("PATH_TOO_DEEP")
+
+// LocalNameMax is the maximum bytes of a file name which common file systems allow (e.g., ext4, APFS, NTFS)
+const LocalNameMax = 255
+
+// CheckPathLimits checks that afterPath is at most maxLength bytes and has at most maxDepth components
+// (e.g., /root/dir/a.txt has 3 components), 0 disables each limit
+func CheckPathLimits(afterPath string, maxLength int, maxDepth int) error {
+	if maxLength > 0 && len(afterPath) > maxLength {
+		return fmt.Errorf("%w: path is %d bytes, longer than %d bytes: %s", ErrPathTooLong, len(afterPath), maxLength, abbreviatePath(afterPath))
+	}
+
+	depth := strings.Count(strings.Trim(afterPath, "/"), "/") + 1
+	if maxDepth > 0 && depth > maxDepth {
+		return fmt.Errorf("%w: path has %d components, more than %d: %s", ErrPathTooDeep, depth, maxDepth, abbreviatePath(afterPath))
+	}
+
+	return nil
+}
+
+// ValidateLocalPath checks that localPath can be created on this platform,
+// so that download fails before anything is requested instead of with an opaque error of os
+func ValidateLocalPath(localPath string) error {
+	absPath, err := filepath.Abs(localPath)
+	if err != nil {
+		return err
+	}
+	if len(absPath) > LocalPathMax {
+		return fmt.Errorf("%w: local path is %d bytes, longer than %d bytes which this platform allows: %s", ErrPathTooLong, len(absPath), LocalPathMax, abbreviatePath(absPath))
+	}
+
+	for _, name := range strings.Split(absPath, string(filepath.Separator)) {
+		if len(name) > LocalNameMax {
+			return fmt.Errorf("%w: file name is %d bytes, longer than %d bytes: %s", ErrPathTooLong, len(name), LocalNameMax, abbreviatePath(name))
+		}
+	}
+
+	return nil
+}
+
+// abbreviatePath shortens pathological path written in error message (e.g., /root/aaaa...aaaa/a.txt)
+func abbreviatePath(path string) string {
+	if len(path) <= 128 {
+		return path
+	}
+	return path[:64] + "..." + path[len(path)-61:]
+}
+
+// ParseWatchDir parses <local directory>:<afterPath prefix> (e.g., /srv/public:/public) of server-side ingestion
+// local directory is made absolute, and prefix is root directory (or directory under it) whose files mirror the local directory
+func ParseWatchDir(value string) (string, string, error) {
+	i := strings.LastIndex(value, ":")
+	if i <= 0 || i == len(value)-1 {
+		return "", "", errors.New("watch dir must be <local directory>:<afterPath prefix> (e.g., /srv/public:/public): " + value)
+	}
+
+	localDir, err := filepath.Abs(value[:i])
+	if err != nil {
+		return "", "", err
+	}
+
+	prefix := strings.TrimSuffix(NormalizeAfterPath(value[i+1:]), "/")
+	err = ValidateAfterPath(prefix)
+	if err != nil {
+		return "", "", err
+	}
+
+	return localDir, prefix, nil
+}
+
+// IsUnderPath checks whether afterPath is same with prefix or under prefix directory
+func IsUnderPath(prefix string, afterPath string) bool {
+	return afterPath == prefix || strings.HasPrefix(afterPath, strings.TrimSuffix(prefix, "/")+"/")
+}
+
+// IsGlobPattern checks whether afterPath has meta characters of glob pattern (*, ?, [)
+func IsGlobPattern(afterPath string) bool {
+	return strings.ContainsAny(afterPath, "*?[")
+}
+
+// ValidateGlobPattern checks syntax of glob pattern
+func ValidateGlobPattern(pattern string) error {
+	_, err := path.Match(pattern, "")
+	if err != nil {
+		return errors.New("invalid glob pattern: " + pattern)
+	}
+	return nil
+}
+
+// GlobStaticPrefix returns the part of glob pattern before the first meta character,
+// so that only keys with the prefix are scanned to match the pattern
+func GlobStaticPrefix(pattern string) string {
+	i := strings.IndexAny(pattern, "*?[\\")
+	if i == -1 {
+		return pattern
+	}
+	return pattern[:i]
+}
+
+// MatchGlobPattern matches afterPath with glob pattern by path.Match semantics
+// unlike prefix matching, * does not match / (e.g., /root/*.txt does not match /root/logs/a.txt)
+func MatchGlobPattern(pattern string, afterPath string) bool {
+	matched, err := path.Match(pattern, afterPath)
+	return err == nil && matched
+}
+
+// IsSubscribedPath checks whether afterPath matches subscriptions
+// if there is no subscription under root directory of afterPath, every file of the root directory is subscribed
+func IsSubscribedPath(subscriptions []string, afterPath string) bool {
+	rootDirName, _ := GetNamesByAfterPath(afterPath)
+	rootDir := "/" + rootDirName
+
+	filtered := false
+	for _, subscription := range subscriptions {
+		if !IsUnderPath(rootDir, subscription) {
+			continue
+		}
+		filtered = true
+
+		if IsUnderPath(subscription, afterPath) {
+			return true
+		}
+	}
+
+	return !filtered
+}
+
+// ParseVersioningPolicies parses comma separated policies (e.g., ".mp4=latest,video/*=latest,.go=full")
+func ParseVersioningPolicies(policies string) ([]types.VersioningPolicy, error) {
+	parsed := []types.VersioningPolicy{}
+	if strings.TrimSpace(policies) == "" {
+		return parsed, nil
+	}
+
+	for _, policy := range strings.Split(policies, ",") {
+		pattern, mode, found := strings.Cut(strings.TrimSpace(policy), "=")
+		if !found || pattern == "" {
+			return nil, errors.New("invalid versioning policy (expected <pattern>=<mode>): " + policy)
+		}
+		err := validatePolicyPattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if mode != types.VersioningFull && mode != types.VersioningLatest {
+			return nil, errors.New("versioning mode must be " + types.VersioningFull + " or " + types.VersioningLatest + ": " + mode)
+		}
+
+		parsed = append(parsed, types.VersioningPolicy{
+			Pattern: strings.ToLower(pattern),
+			Mode:    mode,
+		})
+	}
+
+	return parsed, nil
+}
+
+// GetVersioningMode returns versioning mode of the first policy matched with afterPath
+func GetVersioningMode(policies []types.VersioningPolicy, afterPath string) string {
+	policy := FindVersioningPolicy(policies, afterPath)
+	if policy == nil {
+		return types.VersioningFull
+	}
+
+	return policy.Mode
+}
+
+// FindVersioningPolicy returns the first policy matched with afterPath (nil if nothing is matched)
+func FindVersioningPolicy(policies []types.VersioningPolicy, afterPath string) *types.VersioningPolicy {
+	for i, policy := range policies {
+		if MatchPolicyPattern(policy.Pattern, afterPath) {
+			return &policies[i]
+		}
+	}
+
+	return nil
+}
+
+// MatchPolicyPattern checks whether afterPath matches pattern of policy (extension or MIME type)
+// MIME type of the file is guessed by its extension
+func MatchPolicyPattern(pattern string, afterPath string) bool {
+	ext := strings.ToLower(filepath.Ext(afterPath))
+	mimeType, _, _ := strings.Cut(mime.TypeByExtension(ext), ";")
+
+	switch {
+	case strings.HasPrefix(pattern, "."):
+		return pattern == ext
+	case strings.HasSuffix(pattern, "/*"):
+		return mimeType != "" && strings.HasPrefix(mimeType, strings.TrimSuffix(pattern, "*"))
+	default:
+		return mimeType != "" && pattern == mimeType
+	}
+}
+
+func validatePolicyPattern(pattern string) error {
+	if !strings.HasPrefix(pattern, ".") && !strings.Contains(pattern, "/") {
+		return errors.New("pattern must be extension (e.g., .mp4) or MIME type (e.g., video/*): " + pattern)
+	}
+	return nil
+}
+
+// FormatVersioningPolicies formats policies in the same form as ParseVersioningPolicies accepts
+func FormatVersioningPolicies(policies []types.VersioningPolicy) string {
+	formatted := []string{}
+	for _, policy := range policies {
+		formatted = append(formatted, policy.Pattern+"="+policy.Mode)
+	}
+
+	return strings.Join(formatted, ",")
+}
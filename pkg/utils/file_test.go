@@ -0,0 +1,141 @@
+package utils
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeAfterPath(t *testing.T) {
+	tests := []struct {
+		name      string
+		windows   string // afterPath sent by windows client
+		linux     string // afterPath of the same file sent by linux client
+		wantValid bool
+	}{
+		{name: "file in root directory", windows: "\\root\\a.txt", linux: "/root/a.txt", wantValid: true},
+		{name: "file in sub directory", windows: "\\root\\dir\\sub\\a.txt", linux: "/root/dir/sub/a.txt", wantValid: true},
+		{name: "mixed separators", windows: "\\root/dir\\a.txt", linux: "/root/dir/a.txt", wantValid: true},
+		{name: "name with spaces", windows: "\\root\\my docs\\a b.txt", linux: "/root/my docs/a b.txt", wantValid: true},
+		{name: "root directory", windows: "\\root", linux: "/root", wantValid: true},
+		{name: "climbing out with backslash", windows: "\\root\\..\\etc\\passwd", linux: "/root/../etc/passwd", wantValid: false},
+		{name: "empty component", windows: "\\root\\\\a.txt", linux: "/root//a.txt", wantValid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NormalizeAfterPath(tt.windows)
+			if got != tt.linux {
+				t.Fatalf("NormalizeAfterPath(%q) = %q, want %q", tt.windows, got, tt.linux)
+			}
+			if NormalizeAfterPath(tt.linux) != tt.linux {
+				t.Errorf("NormalizeAfterPath(%q) changes path separated by /", tt.linux)
+			}
+
+			if err := ValidateAfterPath(got); (err == nil) != tt.wantValid {
+				t.Errorf("ValidateAfterPath(%q) error = %v, want valid %t", got, err, tt.wantValid)
+			}
+			// path which is not normalized is never accepted as it is
+			if err := ValidateAfterPath(tt.windows); err == nil {
+				t.Errorf("ValidateAfterPath(%q) accepts path separated by \\", tt.windows)
+			}
+
+			// both clients read and write the same stored file
+			if !tt.wantValid {
+				return
+			}
+			if GetHistoryFileNameByAfterPath(got, 1) != GetHistoryFileNameByAfterPath(tt.linux, 1) {
+				t.Errorf("history file of %q differs from history file of %q", tt.windows, tt.linux)
+			}
+		})
+	}
+}
+
+func TestCheckPathLimits(t *testing.T) {
+	tests := []struct {
+		name      string
+		afterPath string
+		maxLength int
+		maxDepth  int
+		wantErr   error
+	}{
+		{name: "within limits", afterPath: "/root/dir/a.txt", maxLength: 1024, maxDepth: 64},
+		{name: "exactly max length", afterPath: "/root/" + strings.Repeat("a", 1018), maxLength: 1024, maxDepth: 64},
+		{name: "longer than max length", afterPath: "/root/" + strings.Repeat("a", 1019), maxLength: 1024, maxDepth: 64, wantErr: ErrPathTooLong},
+		{name: "length counted in bytes", afterPath: "/root/" + strings.Repeat("가", 340), maxLength: 1024, maxDepth: 64, wantErr: ErrPathTooLong},
+		{name: "exactly max depth", afterPath: "/root" + strings.Repeat("/d", 63), maxLength: 1024, maxDepth: 64},
+		{name: "deeper than max depth", afterPath: "/root" + strings.Repeat("/d", 64), maxLength: 1024, maxDepth: 64, wantErr: ErrPathTooDeep},
+		{name: "root directory", afterPath: "/root", maxLength: 1024, maxDepth: 1},
+		{name: "directory with trailing slash", afterPath: "/root/dir/", maxLength: 1024, maxDepth: 2},
+		{name: "unlimited", afterPath: "/root" + strings.Repeat("/"+strings.Repeat("a", 100), 1000), maxLength: 0, maxDepth: 0},
+		{name: "too long and too deep", afterPath: "/root" + strings.Repeat("/d", 1000), maxLength: 1024, maxDepth: 64, wantErr: ErrPathTooLong},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckPathLimits(tt.afterPath, tt.maxLength, tt.maxDepth)
+			if !errors.Is(err, tt.wantErr) || (err == nil) != (tt.wantErr == nil) {
+				t.Fatalf("CheckPathLimits() error = %v, want %v", err, tt.wantErr)
+			}
+			// pathological path is abbreviated in error message
+			if err != nil && len(err.Error()) > 256 {
+				t.Errorf("error message is %d bytes: %s", len(err.Error()), err)
+			}
+		})
+	}
+}
+
+func TestValidateLocalPath(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name      string
+		localPath string
+		wantErr   error
+	}{
+		{name: "file", localPath: filepath.Join(dir, "a.txt")},
+		{name: "relative path", localPath: "a.txt"},
+		{name: "longest name", localPath: filepath.Join(dir, strings.Repeat("a", LocalNameMax))},
+		{name: "name too long", localPath: filepath.Join(dir, strings.Repeat("a", LocalNameMax+1)), wantErr: ErrPathTooLong},
+		{name: "directory name too long", localPath: filepath.Join(dir, strings.Repeat("a", LocalNameMax+1), "a.txt"), wantErr: ErrPathTooLong},
+		{name: "path too long", localPath: filepath.Join(dir, strings.Repeat(strings.Repeat("a", 100)+string(filepath.Separator), LocalPathMax/100+1), "a.txt"), wantErr: ErrPathTooLong},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateLocalPath(tt.localPath)
+			if !errors.Is(err, tt.wantErr) || (err == nil) != (tt.wantErr == nil) {
+				t.Errorf("ValidateLocalPath() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateRootDirAfterPath(t *testing.T) {
+	tests := []struct {
+		afterPath string
+		wantErr   bool
+	}{
+		{afterPath: "/root"},
+		{afterPath: "/root.txt"},
+		{afterPath: "root", wantErr: true},
+		{afterPath: "/", wantErr: true},
+		{afterPath: "/.", wantErr: true},
+		{afterPath: "/..", wantErr: true},
+		{afterPath: "/a\\b", wantErr: true},
+		{afterPath: "/a\x00b", wantErr: true},
+		{afterPath: "/root/sub", wantErr: true},
+		{afterPath: "/root.history", wantErr: true},
+		{afterPath: "/root.conflict", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.afterPath, func(t *testing.T) {
+			err := ValidateRootDirAfterPath(tt.afterPath)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateRootDirAfterPath() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
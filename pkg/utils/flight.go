@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrFlightPanicked is returned to callers which waited for a call whose fn panicked
+var ErrFlightPanicked = errors.New("FLIGHT_PANICKED")
+
+// FlightGroup runs at most one call of each key at a time, and callers of the same key which arrive while it runs
+// wait for it and share its result instead of running their own (nothing is kept after the call returns)
+type FlightGroup[T any] struct {
+	mut   sync.Mutex
+	calls map[string]*flightCall[T]
+}
+
+type flightCall[T any] struct {
+	done   chan struct{}
+	val    T
+	err    error
+	shared int // the number of callers which waited for this call
+}
+
+// Do runs fn for key unless a call of the same key is running, and reports whether result was shared with other callers
+// result is shared as is, so callers must not modify it
+func (g *FlightGroup[T]) Do(key string, fn func() (T, error)) (T, bool, error) {
+	g.mut.Lock()
+	if g.calls == nil {
+		g.calls = map[string]*flightCall[T]{}
+	}
+	if call, ok := g.calls[key]; ok {
+		call.shared++
+		g.mut.Unlock()
+
+		<-call.done
+		return call.val, true, call.err
+	}
+
+	call := &flightCall[T]{done: make(chan struct{})}
+	g.calls[key] = call
+	g.mut.Unlock()
+
+	// waiting callers are released with ErrFlightPanicked when fn panics, and the panic goes on in the caller which ran fn
+	defer func() {
+		recovered := recover()
+		if recovered != nil {
+			var zero T
+			call.val, call.err = zero, fmt.Errorf("%w: %v", ErrFlightPanicked, recovered)
+		}
+
+		g.mut.Lock()
+		delete(g.calls, key)
+		g.mut.Unlock()
+		close(call.done)
+
+		if recovered != nil {
+			panic(recovered)
+		}
+	}()
+
+	call.val, call.err = fn()
+
+	g.mut.Lock()
+	shared := call.shared > 0
+	g.mut.Unlock()
+	return call.val, shared, call.err
+}
@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+func TestFlightGroupDo(t *testing.T) {
+	errFailed := errors.New("failed")
+
+	tests := []struct {
+		name      string
+		fn        func() (int, error)
+		wantVal   int
+		wantErr   error
+		wantPanic bool
+	}{
+		{
+			name:    "result is shared",
+			fn:      func() (int, error) { return 1, nil },
+			wantVal: 1,
+		},
+		{
+			name:    "error is shared",
+			fn:      func() (int, error) { return 0, errFailed },
+			wantErr: errFailed,
+		},
+		{
+			name:      "panic releases waiters with error",
+			fn:        func() (int, error) { panic("broken") },
+			wantErr:   ErrFlightPanicked,
+			wantPanic: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var g FlightGroup[int]
+			started := make(chan struct{})
+			release := make(chan struct{})
+
+			leaderPanicked := make(chan bool, 1)
+			go func() {
+				defer func() { leaderPanicked <- recover() != nil }()
+				g.Do("key", func() (int, error) {
+					close(started)
+					<-release
+					return tt.fn()
+				})
+			}()
+			<-started
+
+			var wg sync.WaitGroup
+			for i := 0; i < 3; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					val, shared, err := g.Do("key", func() (int, error) {
+						t.Error("waiter ran its own call")
+						return 0, nil
+					})
+					if !shared || val != tt.wantVal || !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+						t.Errorf("Do() = %d, %t, %v, want %d, true, %v", val, shared, err, tt.wantVal, tt.wantErr)
+					}
+				}()
+			}
+
+			// waiters are registered before the call is released
+			for {
+				g.mut.Lock()
+				waiting := g.calls["key"].shared
+				g.mut.Unlock()
+				if waiting == 3 {
+					break
+				}
+				runtime.Gosched()
+			}
+			close(release)
+			wg.Wait()
+
+			if panicked := <-leaderPanicked; panicked != tt.wantPanic {
+				t.Errorf("leader panicked = %t, want %t", panicked, tt.wantPanic)
+			}
+			if len(g.calls) != 0 {
+				t.Errorf("calls are kept after return: %d", len(g.calls))
+			}
+		})
+	}
+}
@@ -3,11 +3,31 @@ package utils
 import (
 	"crypto/sha512"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash"
+	"io"
+	"os"
+	"runtime"
+	"sync"
 
 	"github.com/quic-s/quics/pkg/types"
 )
 
+// ErrLeavesMismatch is returned when hashes of chunks do not describe contents to be extended
+var ErrLeavesMismatch = errors.New("hashes of chunks do not match contents")
+
+// ErrChunkMismatch is returned when chunk of downloaded contents does not match its hash
+var ErrChunkMismatch = errors.New("CHUNK_MISMATCH")
+
+const (
+	// HashChunkSize is the size of chunk which is leaf of merkle tree of contents hash
+	HashChunkSize = 4 * 1024 * 1024 // 4MiB
+
+	// ParallelHashThreshold is the file size from which chunks are hashed in parallel
+	ParallelHashThreshold = 64 * 1024 * 1024 // 64MiB
+)
+
 func MakeHashFromFileMetadata(afterPath string, info *types.FileMetadata) string {
 	h := sha512.New()
 	h.Write([]byte(afterPath)) // /root/*
@@ -16,3 +36,307 @@ func MakeHashFromFileMetadata(afterPath string, info *types.FileMetadata) string
 	h.Write([]byte(fmt.Sprint(info.Size)))
 	return hex.EncodeToString(h.Sum(nil))
 }
+
+// MakeContentHashFromReader makes merkle root of contents reading only one chunk at a time
+func MakeContentHashFromReader(r io.Reader) (string, error) {
+	leaves, err := MakeContentLeavesFromReader(r)
+	if err != nil {
+		return "", err
+	}
+
+	return MakeContentHashFromLeaves(leaves), nil
+}
+
+// MakeContentHashFromLeaves makes merkle root of hashes of chunks
+func MakeContentHashFromLeaves(leaves [][]byte) string {
+	return hex.EncodeToString(makeMerkleRoot(leaves))
+}
+
+// MakeContentLeavesFromReader makes hashes of chunks of contents reading only one chunk at a time
+func MakeContentLeavesFromReader(r io.Reader) ([][]byte, error) {
+	leaves := [][]byte{}
+	buf := make([]byte, HashChunkSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			leaf := sha512.Sum512(buf[:n])
+			leaves = append(leaves, leaf[:])
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return leaves, nil
+}
+
+// ContentHasher makes hashes of chunks of contents written to it as they are written (e.g., teed from received stream),
+// so that contents are not read again to be hashed; memory usage is bounded regardless of the size of contents
+type ContentHasher struct {
+	chunk  hash.Hash
+	filled int
+	leaves [][]byte
+}
+
+func NewContentHasher() *ContentHasher {
+	return &ContentHasher{
+		chunk:  sha512.New(),
+		leaves: [][]byte{},
+	}
+}
+
+func (ch *ContentHasher) Write(p []byte) (int, error) {
+	written := len(p)
+	for len(p) > 0 {
+		n := HashChunkSize - ch.filled
+		if n > len(p) {
+			n = len(p)
+		}
+		ch.chunk.Write(p[:n])
+		ch.filled += n
+		p = p[n:]
+
+		if ch.filled == HashChunkSize {
+			ch.leaves = append(ch.leaves, ch.chunk.Sum(nil))
+			ch.chunk.Reset()
+			ch.filled = 0
+		}
+	}
+
+	return written, nil
+}
+
+// Leaves returns hashes of chunks of contents written so far, equal to MakeContentLeavesFromReader of the same contents
+// (nil for nil hasher, e.g., nothing was hashed)
+func (ch *ContentHasher) Leaves() [][]byte {
+	if ch == nil {
+		return nil
+	}
+
+	leaves := append([][]byte{}, ch.leaves...)
+	if ch.filled > 0 {
+		leaves = append(leaves, ch.chunk.Sum(nil))
+	}
+
+	return leaves
+}
+
+// ChunkVerifyingReader checks every chunk of HashChunkSize read through it against hex hashes of chunks (e.g., ChunkHashes of digest)
+// as soon as the chunk is complete, so that corrupted contents fail at the first bad chunk instead of after the whole contents are read
+type ChunkVerifyingReader struct {
+	r      io.Reader
+	hashes []string
+	chunk  hash.Hash
+	filled int
+	index  int // chunk being read
+}
+
+func NewChunkVerifyingReader(r io.Reader, hashes []string) *ChunkVerifyingReader {
+	return &ChunkVerifyingReader{
+		r:      r,
+		hashes: hashes,
+		chunk:  sha512.New(),
+	}
+}
+
+// Read returns ErrChunkMismatch instead of io.EOF when contents are shorter or longer than chunks of hashes
+func (cr *ChunkVerifyingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+
+	data := p[:n]
+	for len(data) > 0 {
+		m := HashChunkSize - cr.filled
+		if m > len(data) {
+			m = len(data)
+		}
+		cr.chunk.Write(data[:m])
+		cr.filled += m
+		data = data[m:]
+
+		if cr.filled == HashChunkSize {
+			verifyErr := cr.verifyChunk()
+			if verifyErr != nil {
+				return n, verifyErr
+			}
+		}
+	}
+
+	if err == io.EOF {
+		if cr.filled > 0 {
+			verifyErr := cr.verifyChunk()
+			if verifyErr != nil {
+				return n, verifyErr
+			}
+		}
+		if cr.index != len(cr.hashes) {
+			return n, fmt.Errorf("%w: contents end at chunk %d of %d", ErrChunkMismatch, cr.index, len(cr.hashes))
+		}
+	}
+
+	return n, err
+}
+
+func (cr *ChunkVerifyingReader) verifyChunk() error {
+	offset := int64(cr.index) * HashChunkSize
+	if cr.index >= len(cr.hashes) {
+		return fmt.Errorf("%w: contents are longer than %d chunks (offset %d)", ErrChunkMismatch, len(cr.hashes), offset)
+	}
+	if hex.EncodeToString(cr.chunk.Sum(nil)) != cr.hashes[cr.index] {
+		return fmt.Errorf("%w: chunk %d of %d (offset %d) does not match its hash", ErrChunkMismatch, cr.index+1, len(cr.hashes), offset)
+	}
+
+	cr.chunk.Reset()
+	cr.filled = 0
+	cr.index++
+	return nil
+}
+
+// MakeContentHashFromFile makes merkle root of file contents
+func MakeContentHashFromFile(filePath string) (string, error) {
+	leaves, err := MakeContentLeavesFromFile(filePath)
+	if err != nil {
+		return "", err
+	}
+
+	return MakeContentHashFromLeaves(leaves), nil
+}
+
+// MakeContentLeavesFromFile makes hashes of chunks of file contents
+// chunks of large file are hashed in parallel, and memory usage is bounded by the number of workers
+func MakeContentLeavesFromFile(filePath string) ([][]byte, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	if info.Size() < ParallelHashThreshold {
+		return MakeContentLeavesFromReader(file)
+	}
+
+	chunkNum := int((info.Size() + HashChunkSize - 1) / HashChunkSize)
+	leaves := make([][]byte, chunkNum)
+
+	workerNum := runtime.NumCPU()
+	if workerNum > chunkNum {
+		workerNum = chunkNum
+	}
+
+	chunkCh := make(chan int)
+	errCh := make(chan error, workerNum)
+	wg := sync.WaitGroup{}
+	for i := 0; i < workerNum; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			buf := make([]byte, HashChunkSize)
+			for chunk := range chunkCh {
+				n, err := file.ReadAt(buf, int64(chunk)*HashChunkSize)
+				if err != nil && err != io.EOF {
+					errCh <- err
+					return
+				}
+
+				leaf := sha512.Sum512(buf[:n])
+				leaves[chunk] = leaf[:]
+			}
+		}()
+	}
+
+	for chunk := 0; chunk < chunkNum; chunk++ {
+		select {
+		case chunkCh <- chunk:
+		case err := <-errCh:
+			close(chunkCh)
+			wg.Wait()
+			return nil, err
+		}
+	}
+	close(chunkCh)
+	wg.Wait()
+
+	select {
+	case err := <-errCh:
+		return nil, err
+	default:
+	}
+
+	return leaves, nil
+}
+
+// ExtendContentLeavesFromFile makes hashes of chunks of file whose first baseSize bytes are contents hashed into baseLeaves
+// (e.g., log file appended after it was hashed), so that only the last partial chunk of base and appended bytes are read
+// baseLeaves not matched with baseSize can not be extended, and ErrLeavesMismatch is returned
+func ExtendContentLeavesFromFile(filePath string, baseLeaves [][]byte, baseSize int64) ([][]byte, error) {
+	if baseSize < 0 || int64(len(baseLeaves)) != (baseSize+HashChunkSize-1)/HashChunkSize {
+		return nil, ErrLeavesMismatch
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() < baseSize {
+		return nil, ErrLeavesMismatch
+	}
+
+	// hashes of full chunks of base are not changed by appending, but the last partial chunk is filled with appended bytes
+	fullChunks := baseSize / HashChunkSize
+	_, err = file.Seek(fullChunks*HashChunkSize, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	tailLeaves, err := MakeContentLeavesFromReader(file)
+	if err != nil {
+		return nil, err
+	}
+
+	leaves := make([][]byte, 0, int(fullChunks)+len(tailLeaves))
+	leaves = append(leaves, baseLeaves[:fullChunks]...)
+	leaves = append(leaves, tailLeaves...)
+
+	return leaves, nil
+}
+
+// makeMerkleRoot combines hashes of chunks pairwise until one hash remains
+func makeMerkleRoot(leaves [][]byte) []byte {
+	if len(leaves) == 0 {
+		empty := sha512.Sum512(nil)
+		return empty[:]
+	}
+
+	for len(leaves) > 1 {
+		parents := make([][]byte, 0, (len(leaves)+1)/2)
+		for i := 0; i < len(leaves); i += 2 {
+			if i+1 == len(leaves) {
+				// odd node is promoted to upper level as it is
+				parents = append(parents, leaves[i])
+				continue
+			}
+
+			h := sha512.New()
+			h.Write(leaves[i])
+			h.Write(leaves[i+1])
+			parents = append(parents, h.Sum(nil))
+		}
+		leaves = parents
+	}
+
+	return leaves[0]
+}
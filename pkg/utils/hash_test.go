@@ -0,0 +1,278 @@
+package utils
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// writeTestContents writes size bytes of random contents to file in temp directory
+func writeTestContents(tb testing.TB, size int) (string, []byte) {
+	tb.Helper()
+
+	contents := make([]byte, size)
+	rand.New(rand.NewSource(int64(size))).Read(contents)
+	filePath := filepath.Join(tb.TempDir(), "contents")
+	if err := os.WriteFile(filePath, contents, 0600); err != nil {
+		tb.Fatal(err)
+	}
+
+	return filePath, contents
+}
+
+func TestMakeContentLeavesFromFile(t *testing.T) {
+	tests := []struct {
+		name       string
+		size       int
+		wantLeaves int
+	}{
+		{name: "empty", size: 0, wantLeaves: 0},
+		{name: "smaller than chunk", size: 1, wantLeaves: 1},
+		{name: "one chunk", size: HashChunkSize, wantLeaves: 1},
+		{name: "partial last chunk", size: HashChunkSize + 1, wantLeaves: 2},
+		{name: "hashed in parallel", size: ParallelHashThreshold + HashChunkSize/2, wantLeaves: ParallelHashThreshold/HashChunkSize + 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath, contents := writeTestContents(t, tt.size)
+
+			leaves, err := MakeContentLeavesFromFile(filePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(leaves) != tt.wantLeaves {
+				t.Fatalf("leaves = %d, want %d", len(leaves), tt.wantLeaves)
+			}
+
+			// parallel hashing of file makes the same leaves as streaming hashing of its contents
+			want, err := MakeContentLeavesFromReader(bytes.NewReader(contents))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := range want {
+				if !bytes.Equal(leaves[i], want[i]) {
+					t.Fatalf("leaf %d differs from streaming hash", i)
+				}
+			}
+
+			hash, err := MakeContentHashFromFile(filePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := MakeContentHashFromLeaves(want); hash != want {
+				t.Errorf("hash = %s, want %s", hash, want)
+			}
+		})
+	}
+}
+
+// BenchmarkMakeContentHash compares streaming hashing with parallel hashing of the same file,
+// and bytes allocated per operation stay bounded by chunk size (times workers) whatever the size of file is
+func BenchmarkMakeContentHash(b *testing.B) {
+	filePath, _ := writeTestContents(b, 256*1024*1024)
+
+	b.Run("streaming", func(b *testing.B) {
+		b.SetBytes(256 * 1024 * 1024)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			file, err := os.Open(filePath)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := MakeContentHashFromReader(file); err != nil {
+				b.Fatal(err)
+			}
+			file.Close()
+		}
+	})
+
+	b.Run("parallel", func(b *testing.B) {
+		b.SetBytes(256 * 1024 * 1024)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := MakeContentHashFromFile(filePath); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestExtendContentLeavesFromFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		baseSize int
+		size     int
+		leaves   func(baseLeaves [][]byte) [][]byte // leaves given as base (nil: leaves of base)
+		wantErr  error
+	}{
+		{name: "empty base", baseSize: 0, size: 10},
+		{name: "append within partial chunk", baseSize: 10, size: 20},
+		{name: "append fills partial chunk", baseSize: HashChunkSize - 1, size: HashChunkSize + 1},
+		{name: "append after full chunk", baseSize: HashChunkSize, size: HashChunkSize + 10},
+		{name: "append over several chunks", baseSize: HashChunkSize + 1, size: 3*HashChunkSize + 1},
+		{name: "nothing appended", baseSize: HashChunkSize + 1, size: HashChunkSize + 1},
+		{
+			name:     "leaves not matched with base size",
+			baseSize: HashChunkSize + 1,
+			size:     HashChunkSize + 10,
+			leaves:   func(baseLeaves [][]byte) [][]byte { return baseLeaves[:1] },
+			wantErr:  ErrLeavesMismatch,
+		},
+		{name: "file shorter than base", baseSize: 20, size: 10, wantErr: ErrLeavesMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath, contents := writeTestContents(t, tt.size)
+			base := contents
+			if tt.baseSize < len(base) {
+				base = base[:tt.baseSize]
+			}
+			baseLeaves, err := MakeContentLeavesFromReader(bytes.NewReader(base))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.leaves != nil {
+				baseLeaves = tt.leaves(baseLeaves)
+			}
+
+			leaves, err := ExtendContentLeavesFromFile(filePath, baseLeaves, int64(tt.baseSize))
+			if err != tt.wantErr {
+				t.Fatalf("ExtendContentLeavesFromFile() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			// extended leaves are the same as leaves of whole contents hashed again
+			want, err := MakeContentLeavesFromReader(bytes.NewReader(contents))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if MakeContentHashFromLeaves(leaves) != MakeContentHashFromLeaves(want) {
+				t.Errorf("hash of extended leaves differs from hash of whole contents (leaves: %d, want %d)", len(leaves), len(want))
+			}
+		})
+	}
+}
+
+// BenchmarkGrowingLogFile hashes log file after each append of 1 MiB, extending leaves of the previous version
+// or hashing whole file again
+func BenchmarkGrowingLogFile(b *testing.B) {
+	const appendSize, appends = 1024 * 1024, 64
+	appended := make([]byte, appendSize)
+	rand.New(rand.NewSource(appendSize)).Read(appended)
+
+	grow := func(b *testing.B, hash func(filePath string, leaves [][]byte, size int64) ([][]byte, error)) {
+		b.SetBytes(appendSize * appends)
+		for i := 0; i < b.N; i++ {
+			filePath := filepath.Join(b.TempDir(), "log")
+			file, err := os.Create(filePath)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			leaves, size := [][]byte{}, int64(0)
+			for j := 0; j < appends; j++ {
+				if _, err := file.Write(appended); err != nil {
+					b.Fatal(err)
+				}
+				leaves, err = hash(filePath, leaves, size)
+				if err != nil {
+					b.Fatal(err)
+				}
+				size += appendSize
+			}
+			file.Close()
+		}
+	}
+
+	b.Run("incremental", func(b *testing.B) {
+		grow(b, ExtendContentLeavesFromFile)
+	})
+	b.Run("full", func(b *testing.B) {
+		grow(b, func(filePath string, leaves [][]byte, size int64) ([][]byte, error) {
+			return MakeContentLeavesFromFile(filePath)
+		})
+	})
+}
+
+func TestContentHasher(t *testing.T) {
+	tests := []struct {
+		name      string
+		size      int
+		writeSize int // bytes written at once (as received from stream)
+	}{
+		{name: "empty", size: 0, writeSize: 1},
+		{name: "smaller than chunk", size: 10, writeSize: 3},
+		{name: "one chunk at once", size: HashChunkSize, writeSize: HashChunkSize},
+		{name: "one chunk in small writes", size: HashChunkSize, writeSize: 32 * 1024},
+		{name: "writes over chunk boundary", size: 2*HashChunkSize + 1, writeSize: 1000003},
+		{name: "several chunks at once", size: 3*HashChunkSize + 10, writeSize: 3*HashChunkSize + 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contents := make([]byte, tt.size)
+			rand.New(rand.NewSource(int64(tt.size))).Read(contents)
+
+			hasher := NewContentHasher()
+			for rest := contents; len(rest) > 0; {
+				n := tt.writeSize
+				if n > len(rest) {
+					n = len(rest)
+				}
+				if _, err := hasher.Write(rest[:n]); err != nil {
+					t.Fatal(err)
+				}
+				rest = rest[n:]
+			}
+
+			// streamed leaves are the same as leaves of stored contents hashed again
+			want, err := MakeContentLeavesFromReader(bytes.NewReader(contents))
+			if err != nil {
+				t.Fatal(err)
+			}
+			leaves := hasher.Leaves()
+			if len(leaves) != len(want) {
+				t.Fatalf("leaves = %d, want %d", len(leaves), len(want))
+			}
+			for i := range want {
+				if !bytes.Equal(leaves[i], want[i]) {
+					t.Fatalf("leaf %d differs from hash of stored contents", i)
+				}
+			}
+		})
+	}
+
+	if leaves := (*ContentHasher)(nil).Leaves(); leaves != nil {
+		t.Errorf("leaves of nil hasher = %d, want nil", len(leaves))
+	}
+}
+
+func TestContentHasherMemoryBounded(t *testing.T) {
+	const size = 256 * 1024 * 1024
+	contents := io.LimitReader(rand.New(rand.NewSource(size)), size)
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	hasher := NewContentHasher()
+	if _, err := io.Copy(io.Discard, io.TeeReader(contents, hasher)); err != nil {
+		t.Fatal(err)
+	}
+	leaves := hasher.Leaves()
+	runtime.ReadMemStats(&after)
+
+	if len(leaves) != size/HashChunkSize {
+		t.Fatalf("leaves = %d, want %d", len(leaves), size/HashChunkSize)
+	}
+	// only copy buffer and hashes of chunks are allocated whatever the size of contents is
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1024*1024 {
+		t.Errorf("hashing %d bytes allocated %d bytes", size, allocated)
+	}
+}
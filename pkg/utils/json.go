@@ -5,6 +5,11 @@ import (
 	"fmt"
 )
 
+// BodySnippetLen is the maximum length of body shown in the decode error
+const BodySnippetLen = 200
+
+// UnmarshalRequestBody decodes json body into dstStruct
+// decode error contains snippet of raw body, because unexpected body (e.g., html error page from proxy) is not readable from the error itself
 func UnmarshalRequestBody(body []byte, dstStruct any) error {
 	if len(body) == 0 {
 		return fmt.Errorf("empty body")
@@ -12,8 +17,17 @@ func UnmarshalRequestBody(body []byte, dstStruct any) error {
 
 	err := json.Unmarshal(body, dstStruct)
 	if err != nil {
-		return err
+		return fmt.Errorf("decode json body: %w (body: %q)", err, BodySnippet(body))
 	}
 
 	return nil
 }
+
+// BodySnippet returns the head of body up to BodySnippetLen
+func BodySnippet(body []byte) string {
+	if len(body) <= BodySnippetLen {
+		return string(body)
+	}
+
+	return string(body[:BodySnippetLen]) + "..."
+}
@@ -0,0 +1,106 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/quic-s/quics/pkg/types"
+	"golang.org/x/exp/slices"
+)
+
+// LineageFormats are formats which lineage of file can be written in (FormatLineage)
+var LineageFormats = []string{"text", "dot"}
+
+// FormatLineage writes lineage of file as text tree or as DOT graph of Graphviz (e.g., qis file history graph | dot -Tsvg)
+func FormatLineage(lineage *types.FileLineageRes, format string) (string, error) {
+	switch format {
+	case "", "text":
+		return formatLineageTree(lineage), nil
+	case "dot":
+		return formatLineageDOT(lineage), nil
+	}
+
+	return "", fmt.Errorf("unknown lineage format (%s): %s", strings.Join(LineageFormats, ", "), format)
+}
+
+// formatLineageTree writes each origin of lineage (path no move goes to) with paths it was moved to under it
+//
+//	/root/a.txt
+//	└── /root/b.txt (moved at 2024-01-02T15:04:05Z, timestamp 3)
+//	    └── /root/c.txt (moved at ..., timestamp 5) *
+func formatLineageTree(lineage *types.FileLineageRes) string {
+	children := map[string][]types.FileMove{}
+	moved := map[string]bool{}
+	for _, move := range lineage.Moves {
+		children[move.From] = append(children[move.From], move)
+		moved[move.To] = true
+	}
+
+	origins := []string{}
+	for _, move := range lineage.Moves {
+		if !moved[move.From] && !slices.Contains(origins, move.From) {
+			origins = append(origins, move.From)
+		}
+	}
+	// file which was never moved, or moves which only form cycles (e.g., a -> b -> a), start from the file itself
+	if len(origins) == 0 {
+		origins = append(origins, lineage.AfterPath)
+	}
+
+	tree := &strings.Builder{}
+	var visit func(path string, indent string, visiting map[string]bool)
+	visit = func(path string, indent string, visiting map[string]bool) {
+		visiting[path] = true
+		defer delete(visiting, path)
+
+		for i, move := range children[path] {
+			branch, next := "├── ", "│   "
+			if i == len(children[path])-1 {
+				branch, next = "└── ", "    "
+			}
+			fmt.Fprintf(tree, "%s%s%s (moved at %s, timestamp %d)%s\n", indent, branch, move.To, formatLineageDate(move.Date), move.Timestamp, markLineagePath(lineage, move.To))
+			if !visiting[move.To] {
+				visit(move.To, indent+next, visiting)
+			}
+		}
+	}
+	for _, origin := range origins {
+		fmt.Fprintf(tree, "%s%s\n", origin, markLineagePath(lineage, origin))
+		visit(origin, "", map[string]bool{})
+	}
+
+	return tree.String()
+}
+
+// formatLineageDOT writes lineage as directed graph whose edges are moves labeled with their timestamps and dates
+func formatLineageDOT(lineage *types.FileLineageRes) string {
+	graph := &strings.Builder{}
+	graph.WriteString("digraph lineage {\n")
+	graph.WriteString("\trankdir=LR;\n")
+	graph.WriteString("\tnode [shape=box];\n")
+	fmt.Fprintf(graph, "\t%s [style=bold];\n", strconv.Quote(lineage.AfterPath))
+	for _, move := range lineage.Moves {
+		fmt.Fprintf(graph, "\t%s -> %s [label=%s];\n", strconv.Quote(move.From), strconv.Quote(move.To), strconv.Quote("#"+strconv.FormatUint(move.Timestamp, 10)+" "+formatLineageDate(move.Date)))
+	}
+	graph.WriteString("}\n")
+
+	return graph.String()
+}
+
+func markLineagePath(lineage *types.FileLineageRes, path string) string {
+	if path == lineage.AfterPath {
+		return " *"
+	}
+	return ""
+}
+
+// formatLineageDate writes date of history as RFC3339 (as it is when it can not be parsed)
+func formatLineageDate(date string) string {
+	t, err := ParseHistoryDate(date)
+	if err != nil {
+		return date
+	}
+	return t.Format(time.RFC3339)
+}
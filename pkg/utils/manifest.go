@@ -0,0 +1,185 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/quic-s/quics/pkg/types"
+)
+
+const (
+	// ManifestFanout is the number of children of inner node of manifest (one hex digit of prefix)
+	ManifestFanout = 16
+
+	// ManifestDepth is the length of prefix of leaf node (bucket) of manifest, so that there are 16^3 = 4096 buckets
+	ManifestDepth = 3
+)
+
+// ErrInvalidManifestPrefix is returned when node of manifest is asked with prefix which is not hex digits up to ManifestDepth
+var ErrInvalidManifestPrefix = errors.New("INVALID_MANIFEST_PREFIX")
+
+const hexDigits = "0123456789abcdef"
+
+// Manifest is merkle tree of sync metadata of files, used to find changed files without listing all of them
+// files are placed in buckets by hex prefix of hash of after path (not by directory), so that the tree is balanced
+// even for a flat directory; both sides of reconciliation must build it with the same entries for unchanged files
+type Manifest struct {
+	buckets map[string][]types.SyncMetadata // leaf prefix -> entries sorted by after path
+	hashes  map[string][]byte               // prefix -> hash of node
+}
+
+// ManifestBucket returns prefix of leaf node which file of afterPath belongs to
+func ManifestBucket(afterPath string) string {
+	sum := sha512.Sum512([]byte(afterPath))
+	return hex.EncodeToString(sum[:])[:ManifestDepth]
+}
+
+// NewManifest builds manifest of entries
+func NewManifest(entries []types.SyncMetadata) *Manifest {
+	manifest := &Manifest{
+		buckets: map[string][]types.SyncMetadata{},
+		hashes:  map[string][]byte{},
+	}
+	for _, entry := range entries {
+		bucket := ManifestBucket(entry.AfterPath)
+		manifest.buckets[bucket] = append(manifest.buckets[bucket], entry)
+	}
+	for _, bucket := range manifest.buckets {
+		sort.Slice(bucket, func(i, j int) bool {
+			return bucket[i].AfterPath < bucket[j].AfterPath
+		})
+	}
+	manifest.hashNode("")
+
+	return manifest
+}
+
+// hashNode computes hashes of node of prefix and its descendants
+func (m *Manifest) hashNode(prefix string) []byte {
+	h := sha512.New()
+	if len(prefix) == ManifestDepth {
+		for _, entry := range m.buckets[prefix] {
+			h.Write(makeManifestLeaf(&entry))
+		}
+	} else {
+		for i := 0; i < ManifestFanout; i++ {
+			h.Write(m.hashNode(prefix + hexDigits[i:i+1]))
+		}
+	}
+	hash := h.Sum(nil)
+	m.hashes[prefix] = hash
+
+	return hash
+}
+
+// makeManifestLeaf hashes sync metadata of one file
+// before path is not included, since it differs between clients
+func makeManifestLeaf(entry *types.SyncMetadata) []byte {
+	h := sha512.New()
+	h.Write([]byte(entry.AfterPath))
+	h.Write([]byte{0})
+	h.Write([]byte(strconv.FormatUint(entry.LastUpdateTimestamp, 10)))
+	h.Write([]byte{0})
+	h.Write([]byte(entry.LastUpdateHash))
+	h.Write([]byte{0})
+	h.Write([]byte(strconv.FormatUint(entry.LastSyncTimestamp, 10)))
+	h.Write([]byte{0})
+	h.Write([]byte(entry.LastSyncHash))
+	return h.Sum(nil)
+}
+
+// Hash returns hash of node of prefix ("" is root)
+func (m *Manifest) Hash(prefix string) []byte {
+	return m.hashes[prefix]
+}
+
+// Entries returns entries of leaf node of prefix
+func (m *Manifest) Entries(prefix string) []types.SyncMetadata {
+	return m.buckets[prefix]
+}
+
+// Node returns node of prefix to be sent to the other side of reconciliation
+// inner node has hashes of its children, and leaf node has its entries instead
+func (m *Manifest) Node(prefix string) (*types.ManifestNode, error) {
+	hash, ok := m.hashes[prefix]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidManifestPrefix, prefix)
+	}
+
+	node := &types.ManifestNode{
+		Prefix: prefix,
+		Hash:   hash,
+	}
+	if len(prefix) == ManifestDepth {
+		node.Entries = m.buckets[prefix]
+		return node, nil
+	}
+
+	node.Children = make([][]byte, 0, ManifestFanout)
+	for i := 0; i < ManifestFanout; i++ {
+		node.Children = append(node.Children, m.hashes[prefix+hexDigits[i:i+1]])
+	}
+	return node, nil
+}
+
+// ReconcileManifest compares local manifest with remote one, descending only into nodes whose hashes differ
+// ask requests remote nodes of prefixes (one round trip per level)
+// it returns after paths of both sides in differing buckets, and remote entries of them by after path
+func ReconcileManifest(local *Manifest, ask func(prefixes []string) ([]types.ManifestNode, error)) ([]string, map[string]types.SyncMetadata, error) {
+	diff := []string{}
+	remote := map[string]types.SyncMetadata{}
+
+	prefixes := []string{""}
+	for len(prefixes) > 0 {
+		nodes, err := ask(prefixes)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(nodes) != len(prefixes) {
+			return nil, nil, fmt.Errorf("%d manifest nodes are received for %d prefixes", len(nodes), len(prefixes))
+		}
+
+		next := []string{}
+		for i, node := range nodes {
+			if node.Prefix != prefixes[i] {
+				return nil, nil, fmt.Errorf("manifest node %q is received for prefix %q", node.Prefix, prefixes[i])
+			}
+			if bytes.Equal(node.Hash, local.Hash(node.Prefix)) {
+				continue
+			}
+
+			if len(node.Prefix) == ManifestDepth {
+				localPaths := map[string]bool{}
+				for _, entry := range local.Entries(node.Prefix) {
+					localPaths[entry.AfterPath] = true
+					diff = append(diff, entry.AfterPath)
+				}
+				for _, entry := range node.Entries {
+					remote[entry.AfterPath] = entry
+					if !localPaths[entry.AfterPath] {
+						diff = append(diff, entry.AfterPath)
+					}
+				}
+				continue
+			}
+
+			if len(node.Children) != ManifestFanout {
+				return nil, nil, fmt.Errorf("manifest node %q has %d children", node.Prefix, len(node.Children))
+			}
+			for j, child := range node.Children {
+				childPrefix := node.Prefix + hexDigits[j:j+1]
+				if !bytes.Equal(child, local.Hash(childPrefix)) {
+					next = append(next, childPrefix)
+				}
+			}
+		}
+		prefixes = next
+	}
+
+	return diff, remote, nil
+}
@@ -0,0 +1,220 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/quic-s/quics/pkg/types"
+)
+
+// makeManifestEntries makes sync metadata of n files of root directory /r
+func makeManifestEntries(n int) []types.SyncMetadata {
+	entries := make([]types.SyncMetadata, 0, n)
+	for i := 0; i < n; i++ {
+		entries = append(entries, types.SyncMetadata{
+			AfterPath:           fmt.Sprintf("/r/%06d", i),
+			LastUpdateTimestamp: 1,
+			LastUpdateHash:      "hash",
+			LastSyncTimestamp:   1,
+			LastSyncHash:        "hash",
+		})
+	}
+	return entries
+}
+
+// askManifest answers asks of reconciliation with nodes of remote manifest counting round trips
+func askManifest(remote *Manifest, roundTrips *int) func(prefixes []string) ([]types.ManifestNode, error) {
+	return func(prefixes []string) ([]types.ManifestNode, error) {
+		*roundTrips++
+		nodes := []types.ManifestNode{}
+		for _, prefix := range prefixes {
+			node, err := remote.Node(prefix)
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, *node)
+		}
+		return nodes, nil
+	}
+}
+
+func TestReconcileManifest(t *testing.T) {
+	tests := []struct {
+		name           string
+		change         func(remote []types.SyncMetadata) []types.SyncMetadata
+		changed        []string // after paths of changed files
+		wantRoundTrips int
+	}{
+		{
+			name:           "unchanged",
+			change:         func(remote []types.SyncMetadata) []types.SyncMetadata { return remote },
+			wantRoundTrips: 1,
+		},
+		{
+			name: "file modified by client",
+			change: func(remote []types.SyncMetadata) []types.SyncMetadata {
+				remote[10].LastUpdateTimestamp = 2
+				return remote
+			},
+			changed:        []string{"/r/000010"},
+			wantRoundTrips: ManifestDepth + 1,
+		},
+		{
+			name: "file added by client",
+			change: func(remote []types.SyncMetadata) []types.SyncMetadata {
+				return append(remote, types.SyncMetadata{AfterPath: "/r/new"})
+			},
+			changed:        []string{"/r/new"},
+			wantRoundTrips: ManifestDepth + 1,
+		},
+		{
+			name: "file removed by client",
+			change: func(remote []types.SyncMetadata) []types.SyncMetadata {
+				return remote[1:]
+			},
+			changed:        []string{"/r/000000"},
+			wantRoundTrips: ManifestDepth + 1,
+		},
+		{
+			name: "several files changed",
+			change: func(remote []types.SyncMetadata) []types.SyncMetadata {
+				remote[3].LastSyncHash = "other"
+				remote[500].LastUpdateHash = "other"
+				return remote
+			},
+			changed:        []string{"/r/000003", "/r/000500"},
+			wantRoundTrips: ManifestDepth + 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			local := NewManifest(makeManifestEntries(1000))
+			remote := NewManifest(tt.change(makeManifestEntries(1000)))
+
+			roundTrips := 0
+			diff, remoteEntries, err := ReconcileManifest(local, askManifest(remote, &roundTrips))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if roundTrips != tt.wantRoundTrips {
+				t.Errorf("round trips = %d, want %d", roundTrips, tt.wantRoundTrips)
+			}
+
+			// every file of both sides in buckets of changed files is compared (and nothing else)
+			wantDiff := map[string]bool{}
+			wantRemote := map[string]bool{}
+			for _, afterPath := range tt.changed {
+				bucket := ManifestBucket(afterPath)
+				for _, entry := range local.Entries(bucket) {
+					wantDiff[entry.AfterPath] = true
+				}
+				for _, entry := range remote.Entries(bucket) {
+					wantDiff[entry.AfterPath] = true
+					wantRemote[entry.AfterPath] = true
+				}
+			}
+			gotDiff := map[string]bool{}
+			for _, afterPath := range diff {
+				gotDiff[afterPath] = true
+			}
+			if got, want := sortedKeys(gotDiff), sortedKeys(wantDiff); got != want {
+				t.Errorf("diff = %s, want %s", got, want)
+			}
+			gotRemote := map[string]bool{}
+			for afterPath := range remoteEntries {
+				gotRemote[afterPath] = true
+			}
+			if got, want := sortedKeys(gotRemote), sortedKeys(wantRemote); got != want {
+				t.Errorf("remote entries = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestReconcileManifestInvalidNodes(t *testing.T) {
+	local := NewManifest(makeManifestEntries(10))
+	remote := NewManifest(makeManifestEntries(11))
+
+	tests := []struct {
+		name   string
+		answer func(nodes []types.ManifestNode) []types.ManifestNode
+	}{
+		{
+			name:   "missing node",
+			answer: func(nodes []types.ManifestNode) []types.ManifestNode { return nodes[:len(nodes)-1] },
+		},
+		{
+			name: "node of other prefix",
+			answer: func(nodes []types.ManifestNode) []types.ManifestNode {
+				nodes[0].Prefix += "0"
+				return nodes
+			},
+		},
+		{
+			name: "inner node without children",
+			answer: func(nodes []types.ManifestNode) []types.ManifestNode {
+				nodes[0].Children = nil
+				return nodes
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			roundTrips := 0
+			ask := askManifest(remote, &roundTrips)
+			_, _, err := ReconcileManifest(local, func(prefixes []string) ([]types.ManifestNode, error) {
+				nodes, err := ask(prefixes)
+				if err != nil {
+					return nil, err
+				}
+				return tt.answer(nodes), nil
+			})
+			if err == nil {
+				t.Error("invalid nodes are reconciled without error")
+			}
+		})
+	}
+}
+
+func TestManifestNodeInvalidPrefix(t *testing.T) {
+	manifest := NewManifest(makeManifestEntries(10))
+
+	for _, prefix := range []string{"g", "0000", "x0"} {
+		if _, err := manifest.Node(prefix); !errors.Is(err, ErrInvalidManifestPrefix) {
+			t.Errorf("Node(%q) error = %v, want %v", prefix, err, ErrInvalidManifestPrefix)
+		}
+	}
+}
+
+// BenchmarkReconcileManifest reconciles directory of 100k files with few changes (after both manifests are built)
+func BenchmarkReconcileManifest(b *testing.B) {
+	local := NewManifest(makeManifestEntries(100000))
+	changed := makeManifestEntries(100000)
+	for _, i := range []int{1, 10, 100, 1000, 10000} {
+		changed[i].LastUpdateTimestamp = 2
+	}
+	remote := NewManifest(changed)
+
+	b.ResetTimer()
+	roundTrips := 0
+	for i := 0; i < b.N; i++ {
+		if _, _, err := ReconcileManifest(local, askManifest(remote, &roundTrips)); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(roundTrips)/float64(b.N), "round-trips/op")
+}
+
+func sortedKeys(set map[string]bool) string {
+	keys := []string{}
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
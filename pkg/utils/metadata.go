@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// MaxFileMetadataSize is the size of compact JSON of custom metadata a file can have (in bytes)
+// it is small enough to be sent as a header of download
+const MaxFileMetadataSize = 4096
+
+// ParseFileMetadata validates custom metadata of file given as JSON object and returns its compact form
+// empty string, null and {} clear metadata (nil is returned)
+func ParseFileMetadata(metadata string) (json.RawMessage, error) {
+	metadata = strings.TrimSpace(metadata)
+	if metadata == "" {
+		return nil, nil
+	}
+
+	fields := map[string]any{}
+	err := json.Unmarshal([]byte(metadata), &fields)
+	if err != nil {
+		return nil, errors.New("metadata must be JSON object: " + err.Error())
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	compact := &bytes.Buffer{}
+	err = json.Compact(compact, []byte(metadata))
+	if err != nil {
+		return nil, errors.New("metadata must be JSON object: " + err.Error())
+	}
+	if compact.Len() > MaxFileMetadataSize {
+		return nil, fmt.Errorf("metadata is larger than %d bytes (%d bytes)", MaxFileMetadataSize, compact.Len())
+	}
+
+	return json.RawMessage(compact.Bytes()), nil
+}
+
+// ParseFileMetadataFields parses custom metadata given as JSON object into its fields (nil when it is empty)
+// e.g., {"project":"web","reviewed":true} as filter whose fields files must have
+func ParseFileMetadataFields(metadata string) (map[string]any, error) {
+	compact, err := ParseFileMetadata(metadata)
+	if err != nil || compact == nil {
+		return nil, err
+	}
+
+	fields := map[string]any{}
+	err = json.Unmarshal(compact, &fields)
+	if err != nil {
+		return nil, err
+	}
+
+	return fields, nil
+}
+
+// MatchFileMetadata checks whether metadata has every top-level field of filter with equal value (empty filter matches all)
+func MatchFileMetadata(metadata json.RawMessage, filter map[string]any) bool {
+	if len(filter) == 0 {
+		return true
+	}
+	if len(metadata) == 0 {
+		return false
+	}
+
+	fields := map[string]any{}
+	err := json.Unmarshal(metadata, &fields)
+	if err != nil {
+		return false
+	}
+	for key, value := range filter {
+		field, ok := fields[key]
+		if !ok || !reflect.DeepEqual(field, value) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,6 @@
+//go:build !windows && !darwin
+
+package utils
+
+// LocalPathMax is the maximum bytes of absolute path which this platform allows (PATH_MAX)
+const LocalPathMax = 4096
@@ -0,0 +1,7 @@
+//go:build windows
+
+package utils
+
+// LocalPathMax is the maximum length of absolute path which this platform allows
+// go adds \\?\ prefix to long absolute paths, so the limit is that of extended-length paths rather than MAX_PATH (260)
+const LocalPathMax = 32767
@@ -0,0 +1,149 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/quic-s/quics/pkg/types"
+	"golang.org/x/exp/slices"
+)
+
+var syncPolicyBehaviors = []string{types.PolicyIgnore, types.PolicyStoreContentOnly, types.PolicyNoVersioning, types.PolicyCompressOnTransfer, types.PolicySync}
+
+// policyLevel is policies of a level of resolution (e.g., extension default, directory)
+type policyLevel struct {
+	source   string
+	policies []types.SyncPolicy
+}
+
+// ParseSyncPolicies parses comma separated policies whose behaviors are joined with + (e.g., ".tmp=ignore,.log=no-versioning+compress-on-transfer")
+func ParseSyncPolicies(policies string) ([]types.SyncPolicy, error) {
+	parsed := []types.SyncPolicy{}
+	if strings.TrimSpace(policies) == "" {
+		return parsed, nil
+	}
+
+	for _, policy := range strings.Split(policies, ",") {
+		pattern, behaviors, found := strings.Cut(strings.TrimSpace(policy), "=")
+		if !found || pattern == "" || behaviors == "" {
+			return nil, errors.New("invalid sync policy (expected <pattern>=<behavior>[+<behavior>]): " + policy)
+		}
+		err := validatePolicyPattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		syncPolicy := types.SyncPolicy{
+			Pattern: strings.ToLower(pattern),
+		}
+		for _, behavior := range strings.Split(behaviors, "+") {
+			if !slices.Contains(syncPolicyBehaviors, behavior) {
+				return nil, errors.New("sync policy behavior must be one of " + strings.Join(syncPolicyBehaviors, ", ") + ": " + behavior)
+			}
+			if !slices.Contains(syncPolicy.Behaviors, behavior) {
+				syncPolicy.Behaviors = append(syncPolicy.Behaviors, behavior)
+			}
+		}
+		if slices.Contains(syncPolicy.Behaviors, types.PolicySync) && len(syncPolicy.Behaviors) != 1 {
+			return nil, errors.New(types.PolicySync + " can not be combined with other behaviors: " + policy)
+		}
+
+		parsed = append(parsed, syncPolicy)
+	}
+
+	return parsed, nil
+}
+
+// FormatSyncPolicies formats policies in the same form as ParseSyncPolicies accepts
+func FormatSyncPolicies(policies []types.SyncPolicy) string {
+	formatted := []string{}
+	for _, policy := range policies {
+		formatted = append(formatted, formatSyncPolicy(policy))
+	}
+
+	return strings.Join(formatted, ",")
+}
+
+func formatSyncPolicy(policy types.SyncPolicy) string {
+	return policy.Pattern + "=" + strings.Join(policy.Behaviors, "+")
+}
+
+// ResolvePolicy resolves sync behaviors of afterPath in the order of
+// directory policy (versioning policies, then sync policies) > extension default (server-wide) > global default
+// rootDir is nil when file is out of registered root directories
+func ResolvePolicy(rootDir *types.RootDirectory, defaults []types.SyncPolicy, afterPath string) *types.EffectivePolicy {
+	effective := &types.EffectivePolicy{
+		AfterPath:                afterPath,
+		IgnoreSource:             types.PolicySourceGlobal,
+		StoreContentOnlySource:   types.PolicySourceGlobal,
+		Versioning:               types.VersioningFull,
+		VersioningSource:         types.PolicySourceGlobal,
+		CompressOnTransferSource: types.PolicySourceGlobal,
+	}
+
+	// lower level is applied first, so that higher level overwrites it
+	levels := []policyLevel{{source: "extension default", policies: defaults}}
+	if rootDir != nil {
+		levels = append(levels, policyLevel{source: "directory " + rootDir.AfterPath, policies: rootDir.Policies})
+	}
+
+	for _, level := range levels {
+		decide(level.policies, afterPath, types.PolicyIgnore, func(on bool, source string) {
+			effective.Ignore, effective.IgnoreSource = on, level.source+" ("+source+")"
+		})
+		decide(level.policies, afterPath, types.PolicyStoreContentOnly, func(on bool, source string) {
+			effective.StoreContentOnly, effective.StoreContentOnlySource = on, level.source+" ("+source+")"
+		})
+		decide(level.policies, afterPath, types.PolicyNoVersioning, func(on bool, source string) {
+			effective.Versioning, effective.VersioningSource = types.VersioningFull, level.source+" ("+source+")"
+			if on {
+				effective.Versioning = types.VersioningLatest
+			}
+		})
+		decide(level.policies, afterPath, types.PolicyCompressOnTransfer, func(on bool, source string) {
+			effective.CompressOnTransfer, effective.CompressOnTransferSource = on, level.source+" ("+source+")"
+		})
+	}
+
+	// versioning policy of directory is the most specific one
+	if rootDir != nil {
+		policy := FindVersioningPolicy(rootDir.VersioningPolicies, afterPath)
+		if policy != nil {
+			effective.Versioning = policy.Mode
+			effective.VersioningSource = "directory " + rootDir.AfterPath + " versioning (" + policy.Pattern + "=" + policy.Mode + ")"
+		}
+	}
+
+	return effective
+}
+
+// ResolveFilePolicy resolves sync behaviors of file as ResolvePolicy does, then applies settings of the file itself,
+// which are more specific than any policy of its root directory
+func ResolveFilePolicy(rootDir *types.RootDirectory, defaults []types.SyncPolicy, file *types.File) *types.EffectivePolicy {
+	effective := ResolvePolicy(rootDir, defaults, file.AfterPath)
+	if file.NoHistory {
+		effective.Versioning = types.VersioningLatest
+		effective.VersioningSource = "file " + file.AfterPath + " (no-history)"
+	}
+
+	return effective
+}
+
+// decide calls set with the first policy matched with afterPath which mentions behavior
+// PolicySync mentions every behavior and turns it off
+func decide(policies []types.SyncPolicy, afterPath string, behavior string, set func(on bool, source string)) {
+	for _, policy := range policies {
+		if !MatchPolicyPattern(policy.Pattern, afterPath) {
+			continue
+		}
+
+		switch {
+		case slices.Contains(policy.Behaviors, behavior):
+			set(true, formatSyncPolicy(policy))
+			return
+		case slices.Contains(policy.Behaviors, types.PolicySync):
+			set(false, formatSyncPolicy(policy))
+			return
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/quic-s/quics/pkg/types"
+	"golang.org/x/exp/slices"
+)
+
+// provisionColumns are columns of provisioning csv (root is semicolon separated root directories)
+var provisionColumns = []string{"uuid", "alias", "ip", "root"}
+
+// ParseProvisionFile parses clients to provision from json (array of entries) or csv with header (uuid,alias,ip,root) by extension of name
+// e.g., csv row: 0b2c...,laptop-01,10.0.0.11,/docs;/photos
+func ParseProvisionFile(name string, data []byte) ([]types.ProvisionEntry, error) {
+	entries := []types.ProvisionEntry{}
+
+	if strings.EqualFold(filepath.Ext(name), ".json") {
+		err := json.Unmarshal(data, &entries)
+		if err != nil {
+			return nil, errors.New("invalid json: " + err.Error())
+		}
+	} else {
+		reader := csv.NewReader(bytes.NewReader(data))
+		reader.TrimLeadingSpace = true
+		records, err := reader.ReadAll()
+		if err != nil {
+			return nil, errors.New("invalid csv: " + err.Error())
+		}
+		if len(records) == 0 {
+			return nil, errors.New("csv header (" + strings.Join(provisionColumns, ",") + ") is required")
+		}
+
+		columns := map[string]int{}
+		for i, column := range records[0] {
+			column = strings.ToLower(strings.TrimSpace(column))
+			if !slices.Contains(provisionColumns, column) {
+				return nil, errors.New("unknown csv column (expected " + strings.Join(provisionColumns, ",") + "): " + column)
+			}
+			columns[column] = i
+		}
+		if _, ok := columns["uuid"]; !ok {
+			return nil, errors.New("uuid column is required")
+		}
+
+		for _, record := range records[1:] {
+			value := func(column string) string {
+				i, ok := columns[column]
+				if !ok {
+					return ""
+				}
+				return strings.TrimSpace(record[i])
+			}
+
+			entry := types.ProvisionEntry{
+				UUID:  value("uuid"),
+				Alias: value("alias"),
+				Ip:    value("ip"),
+			}
+			for _, rootDir := range strings.Split(value("root"), ";") {
+				if rootDir = strings.TrimSpace(rootDir); rootDir != "" {
+					entry.RootDirs = append(entry.RootDirs, rootDir)
+				}
+			}
+			entries = append(entries, entry)
+		}
+	}
+
+	if len(entries) == 0 {
+		return nil, errors.New("no client to provision")
+	}
+
+	// every row is checked before anything is requested, so that errors of the whole file are reported at once
+	errs := []string{}
+	seen := map[string]int{}
+	for i, entry := range entries {
+		row := i + 1
+		if entry.UUID == "" {
+			errs = append(errs, fmt.Sprintf("row %d: uuid is required", row))
+		} else if err := ValidateUUID(entry.UUID); err != nil {
+			errs = append(errs, fmt.Sprintf("row %d: %s", row, err.Error()))
+		} else if first, ok := seen[entry.UUID]; ok {
+			errs = append(errs, fmt.Sprintf("row %d: uuid is duplicated with row %d: %s", row, first, entry.UUID))
+		} else {
+			seen[entry.UUID] = row
+		}
+
+		for _, rootDir := range entry.RootDirs {
+			err := ValidateAfterPath(rootDir)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("row %d: %s", row, err.Error()))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.New(strings.Join(errs, "\n"))
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+
+	"github.com/quic-s/quics/pkg/types"
+	"golang.org/x/exp/slices"
+)
+
+// ParseRedactRules parses comma separated rules of [<endpoint>:]<field>[=strip|mask] (e.g., "Password,Owner=mask,clients:Ip=mask")
+// field is stripped unless mask is given, and "none" disables redaction
+func ParseRedactRules(rules string) ([]types.RedactRule, error) {
+	parsed := []types.RedactRule{}
+	if strings.TrimSpace(rules) == "" || strings.TrimSpace(rules) == types.RedactNone {
+		return parsed, nil
+	}
+
+	for _, rule := range strings.Split(rules, ",") {
+		scoped, mode, found := strings.Cut(strings.TrimSpace(rule), "=")
+		if !found {
+			mode = types.RedactStrip
+		}
+		if mode != types.RedactStrip && mode != types.RedactMask {
+			return nil, errors.New("redact mode must be " + types.RedactStrip + " or " + types.RedactMask + ": " + rule)
+		}
+
+		endpoint, field, found := strings.Cut(scoped, ":")
+		if !found {
+			endpoint, field = "", scoped
+		} else if !slices.Contains(types.RedactEndpoints, endpoint) {
+			return nil, errors.New("redact endpoint must be one of " + strings.Join(types.RedactEndpoints, ", ") + ": " + rule)
+		}
+		if field == "" || strings.IndexFunc(field, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' }) != -1 {
+			return nil, errors.New("invalid redact rule (expected [<endpoint>:]<field>[=strip|mask]): " + rule)
+		}
+
+		parsed = append(parsed, types.RedactRule{
+			Endpoint: endpoint,
+			Field:    field,
+			Mode:     mode,
+		})
+	}
+
+	return parsed, nil
+}
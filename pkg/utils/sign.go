@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// SignDownload returns hex encoded HMAC-SHA256 of afterPath, timestamp (version) and expires (unix seconds) by key
+func SignDownload(key []byte, afterPath string, timestamp uint64, expires int64) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(afterPath + "\n" + strconv.FormatUint(timestamp, 10) + "\n" + strconv.FormatInt(expires, 10)))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyDownloadSignature checks signature made by SignDownload in constant time
+func VerifyDownloadSignature(key []byte, afterPath string, timestamp uint64, expires int64, signature string) bool {
+	expected := SignDownload(key, afterPath, timestamp, expires)
+
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+// RegistrationProofLabel is label of keying material exported from TLS session of connection, which password proof is bound to
+const RegistrationProofLabel = "EXPORTER-quics-registration"
+
+// RegistrationProofLength is the size of keying material which password proof is made with (in bytes)
+const RegistrationProofLength = 32
+
+// MakeRegistrationProof returns hex encoded HMAC-SHA256 of keying material of connection and uuid by password,
+// so that client proves it knows password without sending it, and the proof can not be replayed on other connection
+// keyingMaterial is ExportKeyingMaterial(RegistrationProofLabel, nil, RegistrationProofLength) of TLS session of the connection
+func MakeRegistrationProof(password string, keyingMaterial []byte, uuid string) string {
+	mac := hmac.New(sha256.New, []byte(password))
+	mac.Write(keyingMaterial)
+	mac.Write([]byte("\n" + uuid))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyRegistrationProof checks proof made by MakeRegistrationProof in constant time
+func VerifyRegistrationProof(password string, keyingMaterial []byte, uuid string, proof string) bool {
+	expected := MakeRegistrationProof(password, keyingMaterial, uuid)
+
+	return hmac.Equal([]byte(expected), []byte(proof))
+}
+
+// PasswordHashIterations is the number of PBKDF2 iterations of password hash
+const PasswordHashIterations = 100000
+
+// PasswordSaltLength is the size of random salt of password hash (in bytes)
+const PasswordSaltLength = 16
+
+// MakePasswordHash returns PBKDF2-SHA256 of password with random salt, encoded as hex salt and hex hash joined by colon
+func MakePasswordHash(password string) (string, error) {
+	salt := make([]byte, PasswordSaltLength)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(salt) + ":" + hex.EncodeToString(makePasswordKey(password, salt)), nil
+}
+
+// VerifyPasswordHash checks password against hash made by MakePasswordHash in constant time
+func VerifyPasswordHash(passwordHash string, password string) bool {
+	encodedSalt, encodedKey, found := strings.Cut(passwordHash, ":")
+	if !found {
+		return false
+	}
+	salt, err := hex.DecodeString(encodedSalt)
+	if err != nil {
+		return false
+	}
+	key, err := hex.DecodeString(encodedKey)
+	if err != nil {
+		return false
+	}
+
+	return hmac.Equal(key, makePasswordKey(password, salt))
+}
+
+func makePasswordKey(password string, salt []byte) []byte {
+	return pbkdf2.Key([]byte(password), salt, PasswordHashIterations, sha256.Size, sha256.New)
+}
@@ -0,0 +1,96 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+)
+
+// Spool holds contents received from reader fully before they are committed to the store
+// the first memoryLimit bytes are kept in memory and the rest spills to temp file in spool directory,
+// so that memory used by an upload stays bounded regardless of its size
+type Spool struct {
+	memory *bytes.Buffer
+	file   *os.File // nil when contents fit in memory
+	size   int64
+	reader io.Reader
+}
+
+// SpoolContents reads all contents of reader into new spool whose memory buffer is at most memoryLimit bytes
+// temp file is removed when reading fails, otherwise Close must be called after the contents are read
+func SpoolContents(reader io.Reader, memoryLimit int64) (*Spool, error) {
+	if memoryLimit < 0 {
+		return nil, errors.New("memory limit of spool must not be negative")
+	}
+
+	spool := &Spool{memory: &bytes.Buffer{}}
+
+	n, err := io.Copy(spool.memory, io.LimitReader(reader, memoryLimit))
+	if err != nil {
+		return nil, err
+	}
+	spool.size = n
+
+	// memory buffer is full, so the rest (if any) goes to temp file
+	if n == memoryLimit {
+		err = os.MkdirAll(GetQuicsSpoolDirPath(), 0700)
+		if err != nil {
+			return nil, err
+		}
+		spool.file, err = os.CreateTemp(GetQuicsSpoolDirPath(), "upload-*")
+		if err != nil {
+			return nil, err
+		}
+
+		n, err = io.Copy(spool.file, reader)
+		if err == nil {
+			_, err = spool.file.Seek(0, io.SeekStart)
+		}
+		if err != nil {
+			spool.Close()
+			return nil, err
+		}
+		spool.size += n
+	}
+
+	if spool.file == nil {
+		spool.reader = spool.memory
+	} else {
+		spool.reader = io.MultiReader(spool.memory, spool.file)
+	}
+
+	return spool, nil
+}
+
+// Size returns the number of bytes spooled
+func (s *Spool) Size() int64 {
+	return s.size
+}
+
+// Spilled reports whether contents were larger than memory buffer and spilled to temp file
+func (s *Spool) Spilled() bool {
+	return s.file != nil
+}
+
+// Read reads spooled contents once from the beginning
+func (s *Spool) Read(p []byte) (int, error) {
+	return s.reader.Read(p)
+}
+
+// Close releases memory buffer and removes temp file
+func (s *Spool) Close() error {
+	s.memory = &bytes.Buffer{}
+	s.reader = s.memory
+	if s.file == nil {
+		return nil
+	}
+
+	err := s.file.Close()
+	removeErr := os.Remove(s.file.Name())
+	s.file = nil
+	if err != nil {
+		return err
+	}
+	return removeErr
+}
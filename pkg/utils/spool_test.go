@@ -0,0 +1,131 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"runtime"
+	"testing"
+)
+
+var errReceive = errors.New("connection lost")
+
+// failingReader returns contents and then fails as client going away in the middle of upload
+type failingReader struct {
+	reader io.Reader
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if err == io.EOF {
+		return n, errReceive
+	}
+	return n, err
+}
+
+// spoolDirEntries returns the number of temp files left in spool directory
+func spoolDirEntries(t *testing.T) int {
+	t.Helper()
+
+	entries, err := os.ReadDir(GetQuicsSpoolDirPath())
+	if os.IsNotExist(err) {
+		return 0
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(entries)
+}
+
+func TestSpoolContents(t *testing.T) {
+	tests := []struct {
+		name        string
+		size        int
+		memoryLimit int64
+		fail        bool // reading contents fails after size bytes
+		wantSpilled bool
+		wantErr     bool
+	}{
+		{name: "smaller than buffer", size: 10, memoryLimit: 16},
+		{name: "as large as buffer", size: 16, memoryLimit: 16, wantSpilled: true},
+		{name: "larger than buffer", size: 1000, memoryLimit: 16, wantSpilled: true},
+		{name: "no buffer", size: 10, memoryLimit: 0, wantSpilled: true},
+		{name: "empty", size: 0, memoryLimit: 16},
+		{name: "negative buffer", size: 10, memoryLimit: -1, wantErr: true},
+		{name: "fails within buffer", size: 10, memoryLimit: 16, fail: true, wantErr: true},
+		{name: "fails after spilling", size: 1000, memoryLimit: 16, fail: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetQuicsDataDirPath(t.TempDir())
+			defer SetQuicsDataDirPath("")
+
+			contents := make([]byte, tt.size)
+			rand.New(rand.NewSource(int64(tt.size))).Read(contents)
+			var reader io.Reader = bytes.NewReader(contents)
+			if tt.fail {
+				reader = &failingReader{reader: reader}
+			}
+
+			spool, err := SpoolContents(reader, tt.memoryLimit)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SpoolContents() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if n := spoolDirEntries(t); n != 0 {
+					t.Errorf("%d temp files are left after failed upload", n)
+				}
+				return
+			}
+
+			if spool.Size() != int64(tt.size) {
+				t.Errorf("size = %d, want %d", spool.Size(), tt.size)
+			}
+			if spool.Spilled() != tt.wantSpilled {
+				t.Errorf("spilled = %t, want %t", spool.Spilled(), tt.wantSpilled)
+			}
+			spooled, err := io.ReadAll(spool)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(spooled, contents) {
+				t.Error("spooled contents differ from uploaded contents")
+			}
+
+			if err := spool.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if n := spoolDirEntries(t); n != 0 {
+				t.Errorf("%d temp files are left after close", n)
+			}
+		})
+	}
+}
+
+func TestSpoolContentsMemoryBounded(t *testing.T) {
+	SetQuicsDataDirPath(t.TempDir())
+	defer SetQuicsDataDirPath("")
+
+	const size, memoryLimit = 64 * 1024 * 1024, 1024
+	contents := io.LimitReader(rand.New(rand.NewSource(size)), size)
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	spool, err := SpoolContents(contents, memoryLimit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spool.Close()
+	runtime.ReadMemStats(&after)
+
+	if spool.Size() != size || !spool.Spilled() {
+		t.Fatalf("spooled %d bytes (spilled: %t), want %d bytes spilled", spool.Size(), spool.Spilled(), size)
+	}
+	// contents go through copy buffers, so allocation is far below size of upload whatever the size is
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 4*1024*1024 {
+		t.Errorf("spooling %d bytes allocated %d bytes", size, allocated)
+	}
+}
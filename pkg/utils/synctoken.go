@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidSyncToken is returned when consistency token is not in the form made by MakeSyncToken
+var ErrInvalidSyncToken = errors.New("INVALID_SYNC_TOKEN")
+
+// MakeSyncToken makes consistency token of write which saved version of timestamp of file of afterPath (e.g., 3:/root/a.txt)
+// read given the token responds only after the version (or newer one) is fully visible, so that writer reads its own write
+func MakeSyncToken(afterPath string, timestamp uint64) string {
+	return strconv.FormatUint(timestamp, 10) + ":" + afterPath
+}
+
+// ParseSyncToken returns after path and timestamp of consistency token
+func ParseSyncToken(token string) (string, uint64, error) {
+	timestamp, afterPath, ok := strings.Cut(token, ":")
+	if !ok || afterPath == "" {
+		return "", 0, fmt.Errorf("%w: token must be <timestamp>:<afterPath>: %q", ErrInvalidSyncToken, token)
+	}
+
+	parsedTimestamp, err := strconv.ParseUint(timestamp, 10, 64)
+	if err != nil || parsedTimestamp == 0 {
+		return "", 0, fmt.Errorf("%w: timestamp must be positive integer: %q", ErrInvalidSyncToken, token)
+	}
+
+	return NormalizeAfterPath(afterPath), parsedTimestamp, nil
+}
@@ -0,0 +1,116 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	// MaxTags is the number of tags a file can have
+	MaxTags = 32
+
+	// MaxTagKeyLength and MaxTagValueLength bound size of each tag (in bytes)
+	MaxTagKeyLength   = 64
+	MaxTagValueLength = 256
+)
+
+var tagKeyRegexp = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// ParseTags parses comma separated key=value tags (e.g., "env=prod,team=web")
+func ParseTags(tags string) (map[string]string, error) {
+	parsed := map[string]string{}
+	if strings.TrimSpace(tags) == "" {
+		return parsed, nil
+	}
+
+	for _, tag := range strings.Split(tags, ",") {
+		key, value, found := strings.Cut(strings.TrimSpace(tag), "=")
+		if !found {
+			return nil, errors.New("invalid tag (expected <key>=<value>): " + tag)
+		}
+		err := ValidateTag(key, value)
+		if err != nil {
+			return nil, err
+		}
+
+		parsed[key] = value
+	}
+
+	return parsed, nil
+}
+
+// ValidateTag checks key (letters, digits, _, . and -) and value (no comma or control character) of a tag and their length
+func ValidateTag(key string, value string) error {
+	if !tagKeyRegexp.MatchString(key) {
+		return errors.New("tag key must consist of letters, digits, _, . or -: " + key)
+	}
+	if len(key) > MaxTagKeyLength {
+		return fmt.Errorf("tag key is longer than %d bytes: %s", MaxTagKeyLength, key)
+	}
+	if len(value) > MaxTagValueLength {
+		return fmt.Errorf("tag value of %s is longer than %d bytes", key, MaxTagValueLength)
+	}
+	if strings.ContainsFunc(value, func(r rune) bool { return r == ',' || r < 0x20 || r == 0x7f }) {
+		return errors.New("tag value must not contain comma or control character: " + key)
+	}
+
+	return nil
+}
+
+// ApplyTags returns tags with keys of unset removed and set added (or replaced), and whether they are changed
+// tags are not modified, and error is returned when the result has more than MaxTags tags
+func ApplyTags(tags map[string]string, set map[string]string, unset []string) (map[string]string, bool, error) {
+	applied := map[string]string{}
+	for key, value := range tags {
+		applied[key] = value
+	}
+
+	changed := false
+	for _, key := range unset {
+		if _, ok := applied[key]; ok {
+			delete(applied, key)
+			changed = true
+		}
+	}
+	for key, value := range set {
+		if current, ok := applied[key]; !ok || current != value {
+			applied[key] = value
+			changed = true
+		}
+	}
+	if len(applied) > MaxTags {
+		return nil, false, fmt.Errorf("file can not have more than %d tags", MaxTags)
+	}
+
+	return applied, changed, nil
+}
+
+// FormatTags formats tags sorted by key in the same form as ParseTags accepts
+func FormatTags(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	formatted := []string{}
+	for _, key := range keys {
+		formatted = append(formatted, key+"="+tags[key])
+	}
+
+	return strings.Join(formatted, ",")
+}
+
+// MatchTags checks whether tags have every key=value of filter (empty filter matches all)
+func MatchTags(tags map[string]string, filter map[string]string) bool {
+	for key, value := range filter {
+		if tag, ok := tags[key]; !ok || tag != value {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,22 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// ErrInvalidUUID is returned when client UUID is empty or not in canonical form
+var ErrInvalidUUID = errors.New("INVALID_UUID")
+
+var uuidRegexp = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// ValidateUUID checks client UUID is in canonical form (e.g., 0b2c5e1a-7f3d-4c2b-9e8a-1d2c3b4a5f6e),
+// so that malformed one is rejected before it is used as url parameter or database key
+func ValidateUUID(uuid string) error {
+	if !uuidRegexp.MatchString(uuid) {
+		return fmt.Errorf("%w: client uuid must be 8-4-4-4-12 hex digits: %q", ErrInvalidUUID, uuid)
+	}
+
+	return nil
+}